@@ -0,0 +1,25 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"opensnack/internal/config"
+)
+
+// runConfig implements `opensnack config print [yaml|toml]`, which shows
+// the effective configuration with the Postgres password hidden.
+func runConfig(cfg *config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "print" || len(args) > 2 {
+		return fmt.Errorf("usage: opensnack config print [yaml|toml]")
+	}
+	format := "yaml"
+	if len(args) == 2 {
+		format = args[1]
+	}
+	return cfg.Redacted().Encode(out, format)
+}
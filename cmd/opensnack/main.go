@@ -5,9 +5,17 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"opensnack/internal/config"
 	"opensnack/internal/db"
 	"opensnack/internal/logging"
 	"opensnack/internal/resource"
@@ -17,32 +25,151 @@ import (
 )
 
 func main() {
-	logger, err := logging.New()
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "opensnack:", err)
+		os.Exit(2)
+	}
+
+	logger, err := logging.New(cfg.Logging)
 	if err != nil {
 		panic(err)
 	}
 	zap.ReplaceGlobals(logger)
 	defer logger.Sync()
 
-	pg := db.Connect() // returns *gorm.DB
-	store := resource.NewGormStore(pg)
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			if cfg.Storage.Backend != "postgres" {
+				fmt.Println("the " + cfg.Storage.Backend + " storage backend has no schema to migrate")
+				return
+			}
+			if err := runMigrate(db.Connect(cfg.Storage.Postgres), args[1:], os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, "opensnack migrate:", err)
+				os.Exit(1)
+			}
+			return
+		case "ca":
+			if err := runCA(cfg, args[1:], os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, "opensnack ca:", err)
+				os.Exit(1)
+			}
+			return
+		case "config":
+			if err := runConfig(cfg, args[1:], os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, "opensnack config:", err)
+				os.Exit(1)
+			}
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+			os.Exit(2)
+		}
+	}
+
+	store, closeStore := openStore(cfg.Storage)
+	defer closeStore()
+
+	// SIGINT and SIGTERM stop the servers and the router's background
+	// work, then close the store.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	handler := router.NewWithConfig(ctx, store, cfg)
+	servers := []*http.Server{newServer(cfg.Listen.Addr, handler, cfg.Timeouts)}
+
+	// The HTTPS listener is optional and serves the same handler.
+	if addr := cfg.Listen.HTTPSAddr; addr != "" {
+		tlsCfg, err := tlsConfig(cfg.Listen, cfg.S3Domains)
+		if err != nil {
+			zap.L().Fatal("configuring TLS",
+				zap.Error(err),
+			)
+		}
+		tlsSrv := newServer(addr, handler, cfg.Timeouts)
+		tlsSrv.TLSConfig = tlsCfg
+		servers = append(servers, tlsSrv)
+		go func() {
+			if err := tlsSrv.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				zap.L().Fatal("https server exited",
+					zap.Error(err),
+				)
+			}
+		}()
+		zap.L().Info("https server started on " + addr)
+	}
+
+	go func() {
+		if err := servers[0].ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zap.L().Fatal("http server exited",
+				zap.Error(err),
+			)
+		}
+	}()
+	zap.L().Info("server started on " + cfg.Listen.Addr)
+
+	<-ctx.Done()
+	stop()
+	zap.L().Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			zap.L().Warn("shutting down "+srv.Addr,
+				zap.Error(err),
+			)
+		}
+	}
+}
 
-	handler := router.New(store)
+// shutdownTimeout is how long in-flight requests get to finish on
+// shutdown.
+const shutdownTimeout = 10 * time.Second
 
-	srv := &http.Server{
-		Addr:           ":4566",
+func newServer(addr string, handler http.Handler, timeouts config.Timeouts) *http.Server {
+	return &http.Server{
+		Addr:           addr,
 		Handler:        handler,
-		ReadTimeout:    15 * time.Second,
-		WriteTimeout:   15 * time.Second,
-		IdleTimeout:    60 * time.Second,
+		ReadTimeout:    timeouts.Read,
+		WriteTimeout:   timeouts.Write,
+		IdleTimeout:    timeouts.Idle,
 		MaxHeaderBytes: 1 << 20,
 	}
+}
 
-	if err := srv.ListenAndServe(); err != nil {
-		zap.L().Fatal("http server exited",
-			zap.Error(err),
-		)
+// openStore opens the configured resource store: "postgres", "bolt", an
+// embedded single-file store for running without a database, or
+// "memory", which forgets everything on exit.
+func openStore(cfg config.Storage) (resource.Store, func()) {
+	if cfg.Backend == "memory" {
+		return resource.NewMemoryStore(), func() {}
+	}
+	if cfg.Backend == "bolt" {
+		path := cfg.BoltPath
+		store, err := resource.OpenBoltStore(path)
+		if err != nil {
+			zap.L().Fatal("opening bolt store",
+				zap.String("path", path),
+				zap.Error(err),
+			)
+		}
+		return store, func() { store.Close() }
 	}
-	zap.L().Info("server started on :4566")
 
+	pg := db.Connect(cfg.Postgres) // returns *gorm.DB
+
+	// Bring the schema up to date unless the operator runs
+	// `opensnack migrate` as a separate step.
+	if cfg.AutoMigrate {
+		if _, err := db.Migrate(pg); err != nil {
+			zap.L().Fatal("schema migration failed",
+				zap.Error(err),
+			)
+		}
+	}
+	return resource.NewGormStore(pg), func() {}
 }
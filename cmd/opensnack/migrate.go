@@ -0,0 +1,61 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"opensnack/internal/db"
+
+	"gorm.io/gorm"
+)
+
+// runMigrate implements `opensnack migrate [status]`.
+func runMigrate(pg *gorm.DB, args []string, out io.Writer) error {
+	if len(args) > 0 && args[0] == "status" {
+		return migrationStatus(pg, out)
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("usage: opensnack migrate [status]")
+	}
+
+	ran, err := db.Migrate(pg)
+	if err != nil {
+		return err
+	}
+	if len(ran) == 0 {
+		fmt.Fprintln(out, "schema is up to date")
+	}
+	for _, m := range ran {
+		fmt.Fprintf(out, "applied %04d_%s\n", m.Version, m.Name)
+	}
+	return nil
+}
+
+// migrationStatus lists every built-in migration and when it was applied.
+func migrationStatus(pg *gorm.DB, out io.Writer) error {
+	migrations, err := db.Migrations()
+	if err != nil {
+		return err
+	}
+	applied, err := db.AppliedMigrations(pg)
+	if err != nil {
+		return err
+	}
+	at := map[int]time.Time{}
+	for _, a := range applied {
+		at[a.Version] = a.AppliedAt
+	}
+	for _, m := range migrations {
+		state := "pending"
+		if t, ok := at[m.Version]; ok {
+			state = "applied " + t.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(out, "%04d_%s\t%s\n", m.Version, m.Name, state)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"opensnack/internal/config"
+	"opensnack/internal/localca"
+)
+
+// tlsConfig returns the HTTPS listener's configuration: the certificate
+// in cfg.TLSCert and cfg.TLSKey if set, otherwise leaves minted by the
+// generated CA for localhost and the S3 domains.
+func tlsConfig(cfg config.Listen, s3Domains []string) (*tls.Config, error) {
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		if cfg.TLSCert == "" || cfg.TLSKey == "" {
+			return nil, errors.New("tls_cert and tls_key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading the TLS certificate: %w", err)
+		}
+		return &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}, nil
+	}
+	ca, err := localca.LoadOrCreate(cfg.TLSDir, s3Domains...)
+	if err != nil {
+		return nil, err
+	}
+	return ca.TLSConfig(), nil
+}
+
+// runCA implements `opensnack ca [file]`, which writes the generated CA
+// certificate to file, or stdout, for adding to trust stores.
+func runCA(cfg *config.Config, args []string, out io.Writer) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: opensnack ca [file]")
+	}
+	ca, err := localca.LoadOrCreate(cfg.Listen.TLSDir, cfg.S3Domains...)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		return os.WriteFile(args[0], ca.PEM, 0o644)
+	}
+	_, err = out.Write(ca.PEM)
+	return err
+}
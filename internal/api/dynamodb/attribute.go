@@ -0,0 +1,487 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// AttributeValue is a typed DynamoDB value. Exactly one field is set;
+// M and L are non-nil (possibly empty) when the value is a map or list.
+type AttributeValue struct {
+	S    *string
+	N    *string
+	B    []byte
+	BOOL *bool
+	NULL *bool
+	SS   []string
+	NS   []string
+	BS   [][]byte
+	M    map[string]AttributeValue
+	L    []AttributeValue
+}
+
+// Item is a DynamoDB item: attribute name to typed value.
+type Item map[string]AttributeValue
+
+var errEmptyAttributeValue = errors.New("Supplied AttributeValue is empty, must contain exactly one of the supported datatypes")
+
+func (v AttributeValue) MarshalJSON() ([]byte, error) {
+	switch {
+	case v.S != nil:
+		return json.Marshal(map[string]string{"S": *v.S})
+	case v.N != nil:
+		return json.Marshal(map[string]string{"N": *v.N})
+	case v.B != nil:
+		return json.Marshal(map[string][]byte{"B": v.B})
+	case v.BOOL != nil:
+		return json.Marshal(map[string]bool{"BOOL": *v.BOOL})
+	case v.NULL != nil:
+		return json.Marshal(map[string]bool{"NULL": *v.NULL})
+	case v.SS != nil:
+		return json.Marshal(map[string][]string{"SS": v.SS})
+	case v.NS != nil:
+		return json.Marshal(map[string][]string{"NS": v.NS})
+	case v.BS != nil:
+		return json.Marshal(map[string][][]byte{"BS": v.BS})
+	case v.M != nil:
+		return json.Marshal(map[string]map[string]AttributeValue{"M": v.M})
+	case v.L != nil:
+		return json.Marshal(map[string][]AttributeValue{"L": v.L})
+	}
+	return nil, errEmptyAttributeValue
+}
+
+func (v *AttributeValue) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 1 {
+		return errEmptyAttributeValue
+	}
+	*v = AttributeValue{}
+	for typ, body := range raw {
+		var err error
+		switch typ {
+		case "S":
+			err = json.Unmarshal(body, &v.S)
+		case "N":
+			err = json.Unmarshal(body, &v.N)
+		case "B":
+			err = json.Unmarshal(body, &v.B)
+			if err == nil && v.B == nil {
+				v.B = []byte{}
+			}
+		case "BOOL":
+			err = json.Unmarshal(body, &v.BOOL)
+		case "NULL":
+			err = json.Unmarshal(body, &v.NULL)
+		case "SS":
+			err = json.Unmarshal(body, &v.SS)
+		case "NS":
+			err = json.Unmarshal(body, &v.NS)
+		case "BS":
+			err = json.Unmarshal(body, &v.BS)
+		case "M":
+			err = json.Unmarshal(body, &v.M)
+			if err == nil && v.M == nil {
+				v.M = map[string]AttributeValue{}
+			}
+		case "L":
+			err = json.Unmarshal(body, &v.L)
+			if err == nil && v.L == nil {
+				v.L = []AttributeValue{}
+			}
+		default:
+			return errEmptyAttributeValue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if v.Type() == "" {
+		return errEmptyAttributeValue
+	}
+	return nil
+}
+
+// Type returns the DynamoDB type descriptor (S, N, B, BOOL, NULL, SS, NS,
+// BS, M or L).
+func (v AttributeValue) Type() string {
+	switch {
+	case v.S != nil:
+		return "S"
+	case v.N != nil:
+		return "N"
+	case v.B != nil:
+		return "B"
+	case v.BOOL != nil:
+		return "BOOL"
+	case v.NULL != nil:
+		return "NULL"
+	case v.SS != nil:
+		return "SS"
+	case v.NS != nil:
+		return "NS"
+	case v.BS != nil:
+		return "BS"
+	case v.M != nil:
+		return "M"
+	case v.L != nil:
+		return "L"
+	}
+	return ""
+}
+
+func stringValue(s string) AttributeValue { return AttributeValue{S: &s} }
+func numberValue(n string) AttributeValue { return AttributeValue{N: &n} }
+func boolValue(b bool) AttributeValue     { return AttributeValue{BOOL: &b} }
+
+// parseNumber parses a DynamoDB number exactly.
+func parseNumber(n string) (*big.Rat, bool) {
+	return new(big.Rat).SetString(strings.TrimSpace(n))
+}
+
+// formatNumber renders r the way DynamoDB returns numbers: no exponent and
+// no trailing zeros.
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	s := r.FloatString(38)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// validateValue checks the per-type rules DynamoDB enforces on input values.
+func validateValue(v AttributeValue) error {
+	switch v.Type() {
+	case "":
+		return errEmptyAttributeValue
+	case "N":
+		if _, ok := parseNumber(*v.N); !ok {
+			return errors.New("A value provided cannot be converted into a number")
+		}
+	case "SS", "NS", "BS":
+		if len(v.SS)+len(v.NS)+len(v.BS) == 0 {
+			kind := map[string]string{"SS": "string", "NS": "number", "BS": "binary"}[v.Type()]
+			return errors.New("One or more parameter values were invalid: An " + kind + " set  may not be empty")
+		}
+		seen := map[string]bool{}
+		for _, m := range setMembers(v) {
+			k := canonicalKey(m)
+			if seen[k] {
+				return errors.New("One or more parameter values were invalid: Input collection contains duplicates")
+			}
+			seen[k] = true
+			if m.N != nil {
+				if _, ok := parseNumber(*m.N); !ok {
+					return errors.New("A value provided cannot be converted into a number")
+				}
+			}
+		}
+	case "M":
+		for _, e := range v.M {
+			if err := validateValue(e); err != nil {
+				return err
+			}
+		}
+	case "L":
+		for _, e := range v.L {
+			if err := validateValue(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setMembers returns the members of a set value as scalar values.
+func setMembers(v AttributeValue) []AttributeValue {
+	var out []AttributeValue
+	for _, s := range v.SS {
+		out = append(out, stringValue(s))
+	}
+	for _, n := range v.NS {
+		out = append(out, numberValue(n))
+	}
+	for _, b := range v.BS {
+		out = append(out, AttributeValue{B: b})
+	}
+	return out
+}
+
+// canonicalKey renders a scalar value so that equal values (including
+// numerically equal numbers such as "1" and "1.0") produce the same string.
+func canonicalKey(v AttributeValue) string {
+	switch v.Type() {
+	case "S":
+		return "S:" + *v.S
+	case "N":
+		if r, ok := parseNumber(*v.N); ok {
+			return "N:" + r.RatString()
+		}
+		return "N:" + *v.N
+	case "B":
+		buf, _ := json.Marshal(v.B)
+		return "B:" + string(buf)
+	}
+	buf, _ := json.Marshal(v)
+	return string(buf)
+}
+
+// compareValues orders two scalar values of the same type (S, N or B).
+// ok is false when the values are not comparable.
+func compareValues(a, b AttributeValue) (cmp int, ok bool) {
+	switch {
+	case a.S != nil && b.S != nil:
+		return strings.Compare(*a.S, *b.S), true
+	case a.N != nil && b.N != nil:
+		ra, okA := parseNumber(*a.N)
+		rb, okB := parseNumber(*b.N)
+		if !okA || !okB {
+			return 0, false
+		}
+		return ra.Cmp(rb), true
+	case a.B != nil && b.B != nil:
+		return bytes.Compare(a.B, b.B), true
+	}
+	return 0, false
+}
+
+// equalValues reports whether two values are equal. Sets compare without
+// regard to order, numbers compare numerically.
+func equalValues(a, b AttributeValue) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Type() {
+	case "S", "N", "B":
+		c, ok := compareValues(a, b)
+		return ok && c == 0
+	case "BOOL":
+		return *a.BOOL == *b.BOOL
+	case "NULL":
+		return true
+	case "SS", "NS", "BS":
+		am, bm := setMembers(a), setMembers(b)
+		if len(am) != len(bm) {
+			return false
+		}
+		keys := map[string]bool{}
+		for _, m := range am {
+			keys[canonicalKey(m)] = true
+		}
+		for _, m := range bm {
+			if !keys[canonicalKey(m)] {
+				return false
+			}
+		}
+		return true
+	case "M":
+		if len(a.M) != len(b.M) {
+			return false
+		}
+		for k, av := range a.M {
+			bv, ok := b.M[k]
+			if !ok || !equalValues(av, bv) {
+				return false
+			}
+		}
+		return true
+	case "L":
+		if len(a.L) != len(b.L) {
+			return false
+		}
+		for i := range a.L {
+			if !equalValues(a.L[i], b.L[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// copyItem returns a deep copy of an item.
+func copyItem(item Item) Item {
+	if item == nil {
+		return nil
+	}
+	buf, _ := json.Marshal(item)
+	var out Item
+	_ = json.Unmarshal(buf, &out)
+	return out
+}
+
+// itemSize approximates DynamoDB's item size: attribute names plus values.
+func itemSize(item Item) int {
+	size := 0
+	for name, v := range item {
+		size += len(name) + valueSize(v)
+	}
+	return size
+}
+
+func valueSize(v AttributeValue) int {
+	switch v.Type() {
+	case "S":
+		return len(*v.S)
+	case "N":
+		return (len(strings.TrimLeft(*v.N, "-0"))+1)/2 + 1
+	case "B":
+		return len(v.B)
+	case "BOOL", "NULL":
+		return 1
+	case "SS", "NS", "BS":
+		n := 0
+		for _, m := range setMembers(v) {
+			n += valueSize(m)
+		}
+		return n
+	case "M":
+		n := 3
+		for k, e := range v.M {
+			n += len(k) + valueSize(e) + 1
+		}
+		return n
+	case "L":
+		n := 3
+		for _, e := range v.L {
+			n += valueSize(e) + 1
+		}
+		return n
+	}
+	return 0
+}
+
+// sortedNames returns the attribute names of an item in a stable order.
+func sortedNames(item Item) []string {
+	names := make([]string, 0, len(item))
+	for k := range item {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// normalizeValue rewrites numbers (including set members and nested values)
+// to the canonical form DynamoDB returns, e.g. "1.50" becomes "1.5".
+func normalizeValue(v AttributeValue) AttributeValue {
+	switch v.Type() {
+	case "N":
+		if r, ok := parseNumber(*v.N); ok {
+			return numberValue(formatNumber(r))
+		}
+	case "NS":
+		out := make([]string, len(v.NS))
+		for i, n := range v.NS {
+			out[i] = *normalizeValue(numberValue(n)).N
+		}
+		return AttributeValue{NS: out}
+	case "M":
+		out := make(map[string]AttributeValue, len(v.M))
+		for k, e := range v.M {
+			out[k] = normalizeValue(e)
+		}
+		return AttributeValue{M: out}
+	case "L":
+		out := make([]AttributeValue, len(v.L))
+		for i, e := range v.L {
+			out[i] = normalizeValue(e)
+		}
+		return AttributeValue{L: out}
+	}
+	return v
+}
+
+// addNumbers returns a + b for two N values.
+func addNumbers(a, b AttributeValue) (AttributeValue, error) {
+	ra, okA := parseNumber(*a.N)
+	rb, okB := parseNumber(*b.N)
+	if !okA || !okB {
+		return AttributeValue{}, errors.New("A value provided cannot be converted into a number")
+	}
+	return numberValue(formatNumber(new(big.Rat).Add(ra, rb))), nil
+}
+
+// subtractNumbers returns a - b for two N values.
+func subtractNumbers(a, b AttributeValue) (AttributeValue, error) {
+	ra, okA := parseNumber(*a.N)
+	rb, okB := parseNumber(*b.N)
+	if !okA || !okB {
+		return AttributeValue{}, errors.New("A value provided cannot be converted into a number")
+	}
+	return numberValue(formatNumber(new(big.Rat).Sub(ra, rb))), nil
+}
+
+// setFromMembers builds a set of the given type from scalar members.
+func setFromMembers(typ string, members []AttributeValue) AttributeValue {
+	switch typ {
+	case "SS":
+		out := []string{}
+		for _, m := range members {
+			out = append(out, *m.S)
+		}
+		return AttributeValue{SS: out}
+	case "NS":
+		out := []string{}
+		for _, m := range members {
+			out = append(out, *m.N)
+		}
+		return AttributeValue{NS: out}
+	}
+	out := [][]byte{}
+	for _, m := range members {
+		out = append(out, m.B)
+	}
+	return AttributeValue{BS: out}
+}
+
+// setUnion adds the members of b to the set a. Both must be sets of the
+// same type.
+func setUnion(a, b AttributeValue) AttributeValue {
+	members := setMembers(a)
+	seen := map[string]bool{}
+	for _, m := range members {
+		seen[canonicalKey(m)] = true
+	}
+	for _, m := range setMembers(b) {
+		if !seen[canonicalKey(m)] {
+			seen[canonicalKey(m)] = true
+			members = append(members, m)
+		}
+	}
+	return setFromMembers(a.Type(), members)
+}
+
+// setDifference removes the members of b from the set a. ok is false when
+// nothing is left, since DynamoDB does not store empty sets.
+func setDifference(a, b AttributeValue) (out AttributeValue, ok bool) {
+	drop := map[string]bool{}
+	for _, m := range setMembers(b) {
+		drop[canonicalKey(m)] = true
+	}
+	var members []AttributeValue
+	for _, m := range setMembers(a) {
+		if !drop[canonicalKey(m)] {
+			members = append(members, m)
+		}
+	}
+	if len(members) == 0 {
+		return AttributeValue{}, false
+	}
+	return setFromMembers(a.Type(), members), true
+}
+
+func isSetType(typ string) bool {
+	return typ == "SS" || typ == "NS" || typ == "BS"
+}
@@ -0,0 +1,687 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"opensnack/internal/awsresponses"
+	"opensnack/internal/resource"
+	"opensnack/internal/util"
+
+	"github.com/google/uuid"
+)
+
+//
+// BACKUPS AND POINT-IN-TIME RECOVERY
+//
+// An on-demand backup is a dynamodb/"backup" resource holding the table
+// description and a copy of every item, keyed by the backup ARN.
+//
+// While point-in-time recovery is enabled, every item write also appends
+// a dynamodb/"item-change" resource with the item's new image (nil for a
+// delete). Enabling PITR records the current items as the baseline, so
+// replaying the changes up to a time rebuilds the table as it was then.
+// The history is dropped when PITR is disabled or the table is deleted.
+//
+
+// continuousBackups is the stored PITR setting of a table.
+type continuousBackups struct {
+	Enabled   bool    `json:"point_in_time_recovery_enabled"`
+	EnabledAt float64 `json:"earliest_restorable_time,omitempty"`
+}
+
+// itemChange is one entry of a table's change history.
+type itemChange struct {
+	Table  string `json:"table"`
+	ItemID string `json:"item_id"`
+	Item   Item   `json:"item,omitempty"`
+	At     int64  `json:"at"` // unix nanoseconds
+}
+
+// storedBackup is the JSON persisted for each backup.
+type storedBackup struct {
+	Description BackupDescription `json:"description"`
+	Table       TableDescription  `json:"table"`
+	Items       []Item            `json:"items"`
+}
+
+func epochSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+func fromEpochSeconds(s float64) time.Time {
+	sec, frac := math.Modf(s)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// continuousBackups returns the PITR setting of a table.
+func (h *Handler) continuousBackups(ctx context.Context, ns, table string) continuousBackups {
+	var stored struct {
+		ContinuousBackups continuousBackups `json:"continuous_backups"`
+	}
+	if res, err := h.Store.Get(ctx, table, "dynamodb", "table", ns); err == nil {
+		json.Unmarshal(res.Attributes, &stored)
+	}
+	return stored.ContinuousBackups
+}
+
+// recordChange appends an item write to the table's change history if
+// point-in-time recovery is enabled. Callers hold the table's write lock.
+func (h *Handler) recordChange(ctx context.Context, s resource.Store, ns string, td *TableDescription, old, item Item) *ddbError {
+	if !h.continuousBackups(ctx, ns, td.TableName).Enabled {
+		return nil
+	}
+	image := item
+	if image == nil {
+		image = old
+	}
+	return h.appendChange(ctx, s, ns, td, itemID(td, primaryKey(td.KeySchema, image)), item, time.Now())
+}
+
+func (h *Handler) appendChange(ctx context.Context, s resource.Store, ns string, td *TableDescription, id string, item Item, at time.Time) *ddbError {
+	buf, err := json.Marshal(itemChange{Table: td.TableName, ItemID: id, Item: item, At: at.UnixNano()})
+	if err != nil {
+		return errInternal(err)
+	}
+	err = s.Create(ctx, &resource.Resource{
+		ID:         td.TableName + "/" + h.nextSequenceNumber(),
+		Namespace:  ns,
+		Service:    "dynamodb",
+		Type:       "item-change",
+		Attributes: buf,
+	})
+	if err != nil {
+		return errInternal(err)
+	}
+	return nil
+}
+
+// startHistory records the current items of a table as the baseline of
+// its change history. Callers hold the table's write lock.
+func (h *Handler) startHistory(ctx context.Context, ns string, td *TableDescription, at time.Time) *ddbError {
+	items, derr := h.tableItems(ctx, ns, td.TableName)
+	if derr != nil {
+		return derr
+	}
+	for _, item := range items {
+		if derr := h.appendChange(ctx, h.Store, ns, td, itemID(td, primaryKey(td.KeySchema, item)), item, at); derr != nil {
+			return derr
+		}
+	}
+	return nil
+}
+
+// tableChanges returns the change history of a table in write order.
+func (h *Handler) tableChanges(ctx context.Context, ns, table string) ([]resource.Resource, error) {
+	page, err := h.Store.Query(ctx, resource.Query{
+		Service:   "dynamodb",
+		Type:      "item-change",
+		Namespace: ns,
+		IDPrefix:  table + "/",
+	})
+	return page.Resources, err
+}
+
+// itemsAt replays a table's change history up to t.
+func (h *Handler) itemsAt(ctx context.Context, ns, table string, t time.Time) ([]Item, *ddbError) {
+	changes, err := h.tableChanges(ctx, ns, table)
+	if err != nil {
+		return nil, errInternal(err)
+	}
+	state := map[string]Item{}
+	for _, res := range changes {
+		var c itemChange
+		if err := json.Unmarshal(res.Attributes, &c); err != nil {
+			return nil, errInternal(err)
+		}
+		if c.At > t.UnixNano() {
+			continue
+		}
+		if c.Item == nil {
+			delete(state, c.ItemID)
+		} else {
+			state[c.ItemID] = c.Item
+		}
+	}
+	ids := make([]string, 0, len(state))
+	for id := range state {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	items := make([]Item, len(ids))
+	for i, id := range ids {
+		items[i] = state[id]
+	}
+	return items, nil
+}
+
+// dropHistory deletes the change history of a table.
+func (h *Handler) dropHistory(ctx context.Context, ns, table string) {
+	changes, err := h.tableChanges(ctx, ns, table)
+	if err != nil {
+		return
+	}
+	for _, res := range changes {
+		h.Store.Delete(ctx, res.ID, "dynamodb", "item-change", ns)
+	}
+}
+
+// restorableWindow returns the times a table can be restored to.
+func (h *Handler) restorableWindow(ctx context.Context, ns, table string) (earliest, latest time.Time, ok bool) {
+	cb := h.continuousBackups(ctx, ns, table)
+	if !cb.Enabled {
+		return time.Time{}, time.Time{}, false
+	}
+	return fromEpochSeconds(cb.EnabledAt), time.Now(), true
+}
+
+// continuousBackupsDescription reports the PITR status and restore
+// window of a table.
+func (h *Handler) continuousBackupsDescription(ctx context.Context, ns, table string) ContinuousBackupsDescription {
+	pitr := PointInTimeRecoveryDescription{PointInTimeRecoveryStatus: "DISABLED"}
+	if earliest, latest, ok := h.restorableWindow(ctx, ns, table); ok {
+		pitr.PointInTimeRecoveryStatus = "ENABLED"
+		pitr.EarliestRestorableDateTime = epochSeconds(earliest)
+		pitr.LatestRestorableDateTime = epochSeconds(latest)
+	}
+	return ContinuousBackupsDescription{
+		ContinuousBackupsStatus:        "ENABLED",
+		PointInTimeRecoveryDescription: pitr,
+	}
+}
+
+//
+// RESTORES
+//
+
+// restoreOptions are the overrides shared by both restore operations.
+type restoreOptions struct {
+	billingMode string
+	gsis        []GlobalSecondaryIndex
+	lsis        []LocalSecondaryIndex
+	throughput  *ProvisionedThroughput
+	sse         *SSESpecification
+}
+
+// restoreTable creates target from the description and items of a source
+// table. Callers hold the target's write lock.
+func (h *Handler) restoreTable(ctx context.Context, ns string, source *TableDescription, items []Item, target string, opts restoreOptions, summary *RestoreSummary) (*TableDescription, *ddbError) {
+	if target == "" {
+		return nil, errValidation("TargetTableName is required")
+	}
+	if _, err := h.Store.Get(ctx, target, "dynamodb", "table", ns); err == nil {
+		return nil, &ddbError{Type: "TableAlreadyExistsException", Message: "Table already exists: " + target}
+	}
+
+	now := time.Now().UTC()
+	td := *source
+	td.TableName = target
+	td.TableArn = tableArn(ctx, target)
+	td.TableId = uuid.New().String()
+	td.TableStatus = "ACTIVE"
+	td.CreationDateTime = epochSeconds(now)
+	td.StreamSpecification = nil
+	td.LatestStreamArn = ""
+	td.LatestStreamLabel = ""
+	td.RestoreSummary = summary
+	td.ItemCount, td.TableSizeBytes = 0, 0
+
+	billingMode := "PROVISIONED"
+	if td.BillingModeSummary != nil {
+		billingMode = td.BillingModeSummary.BillingMode
+	}
+	if opts.billingMode != "" {
+		billingMode = opts.billingMode
+		td.BillingModeSummary = buildBillingModeSummary(billingMode)
+	}
+	if opts.throughput != nil {
+		td.ProvisionedThroughput = buildProvisionedThroughputDesc(opts.throughput)
+	}
+
+	gsis := td.GlobalSecondaryIndexes
+	if opts.gsis != nil {
+		gsis = nil
+		for _, gsi := range opts.gsis {
+			desc := GlobalSecondaryIndexDescription{IndexName: gsi.IndexName, KeySchema: gsi.KeySchema, Projection: gsi.Projection, IndexStatus: "ACTIVE"}
+			if billingMode == "PROVISIONED" {
+				desc.ProvisionedThroughput = buildProvisionedThroughputDesc(gsi.ProvisionedThroughput)
+			}
+			gsis = append(gsis, desc)
+		}
+	}
+	td.GlobalSecondaryIndexes = make([]GlobalSecondaryIndexDescription, len(gsis))
+	for i, gsi := range gsis {
+		gsi.IndexArn = td.TableArn + "/index/" + gsi.IndexName
+		gsi.ItemCount, gsi.IndexSizeBytes = 0, 0
+		td.GlobalSecondaryIndexes[i] = gsi
+	}
+
+	lsis := td.LocalSecondaryIndexes
+	if opts.lsis != nil {
+		lsis = nil
+		for _, lsi := range opts.lsis {
+			lsis = append(lsis, LocalSecondaryIndexDescription{IndexName: lsi.IndexName, KeySchema: lsi.KeySchema, Projection: lsi.Projection})
+		}
+	}
+	td.LocalSecondaryIndexes = make([]LocalSecondaryIndexDescription, len(lsis))
+	for i, lsi := range lsis {
+		lsi.IndexArn = td.TableArn + "/index/" + lsi.IndexName
+		lsi.ItemCount, lsi.IndexSizeBytes = 0, 0
+		td.LocalSecondaryIndexes[i] = lsi
+	}
+
+	if opts.sse != nil {
+		td.SSEDescription = nil
+		if opts.sse.Enabled {
+			td.SSEDescription = &SSEDescription{Status: "ENABLED", SSEType: "KMS", KMSMasterKeyArn: opts.sse.KMSMasterKeyId}
+		}
+	}
+	cleanTableDescription(&td)
+
+	buf, err := json.Marshal(map[string]any{
+		"table_description": td,
+		"created_at":        now,
+	})
+	if err != nil {
+		return nil, errInternal(err)
+	}
+	err = h.Store.Create(ctx, &resource.Resource{ID: target, Namespace: ns, Service: "dynamodb", Type: "table", Attributes: buf})
+	if err != nil {
+		return nil, errInternal(err)
+	}
+	for _, item := range items {
+		if derr := h.storeItem(ctx, h.Store, ns, &td, nil, item); derr != nil {
+			return nil, derr
+		}
+		td.ItemCount++
+		td.TableSizeBytes += int64(itemSize(item))
+	}
+	return &td, nil
+}
+
+//
+// BACKUP HANDLERS
+//
+
+func errBackupNotFound(arn string) *ddbError {
+	return &ddbError{Type: "BackupNotFoundException", Message: "Backup not found: " + arn}
+}
+
+// loadBackup returns a stored backup by ARN.
+func (h *Handler) loadBackup(ctx context.Context, ns, arn string) (*storedBackup, *ddbError) {
+	if arn == "" {
+		return nil, errValidation("BackupArn is required")
+	}
+	res, err := h.Store.Get(ctx, arn, "dynamodb", "backup", ns)
+	if err != nil {
+		return nil, errBackupNotFound(arn)
+	}
+	var b storedBackup
+	if err := json.Unmarshal(res.Attributes, &b); err != nil {
+		return nil, errInternal(err)
+	}
+	return &b, nil
+}
+
+// featureDetails describes the indexes and settings of a table.
+func (h *Handler) featureDetails(ctx context.Context, ns string, td *TableDescription) SourceTableFeatureDetails {
+	var f SourceTableFeatureDetails
+	for _, lsi := range td.LocalSecondaryIndexes {
+		f.LocalSecondaryIndexes = append(f.LocalSecondaryIndexes, LocalSecondaryIndexInfo{
+			IndexName: lsi.IndexName, KeySchema: lsi.KeySchema, Projection: lsi.Projection,
+		})
+	}
+	for _, gsi := range td.GlobalSecondaryIndexes {
+		info := GlobalSecondaryIndexInfo{IndexName: gsi.IndexName, KeySchema: gsi.KeySchema, Projection: gsi.Projection}
+		if pt := gsi.ProvisionedThroughput; pt != nil {
+			info.ProvisionedThroughput = &ProvisionedThroughput{ReadCapacityUnits: pt.ReadCapacityUnits, WriteCapacityUnits: pt.WriteCapacityUnits}
+		}
+		f.GlobalSecondaryIndexes = append(f.GlobalSecondaryIndexes, info)
+	}
+	f.StreamDescription = td.StreamSpecification
+	f.SSEDescription = td.SSEDescription
+
+	var stored struct {
+		TTL *struct {
+			Enabled       bool   `json:"enabled"`
+			AttributeName string `json:"attribute_name"`
+		} `json:"ttl_specification"`
+	}
+	if res, err := h.Store.Get(ctx, td.TableName, "dynamodb", "table", ns); err == nil {
+		json.Unmarshal(res.Attributes, &stored)
+	}
+	if stored.TTL != nil && stored.TTL.Enabled {
+		f.TimeToLiveDescription = &TimeToLiveDescription{TimeToLiveStatus: "ENABLED", AttributeName: stored.TTL.AttributeName}
+	}
+	return f
+}
+
+// CreateBackup takes an on-demand backup of a table
+func (h *Handler) CreateBackup(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req CreateBackupInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if req.BackupName == "" {
+		writeError(w, errValidation("BackupName is required"))
+		return
+	}
+
+	defer h.lockTables(ns, false, req.TableName)()
+
+	td, derr := h.loadTable(r.Context(), ns, req.TableName)
+	if derr != nil {
+		if derr.Type == "ResourceNotFoundException" {
+			derr = &ddbError{Type: "TableNotFoundException", Message: "Table not found: " + extractTableName(req.TableName)}
+		}
+		writeError(w, derr)
+		return
+	}
+	items, derr := h.tableItems(r.Context(), ns, td.TableName)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	now := time.Now()
+	var size int64
+	for _, item := range items {
+		size += int64(itemSize(item))
+	}
+	billingMode := "PROVISIONED"
+	if td.BillingModeSummary != nil {
+		billingMode = td.BillingModeSummary.BillingMode
+	}
+	source := SourceTableDetails{
+		TableName:             td.TableName,
+		TableId:               td.TableId,
+		TableArn:              td.TableArn,
+		TableSizeBytes:        size,
+		KeySchema:             td.KeySchema,
+		TableCreationDateTime: td.CreationDateTime,
+		ItemCount:             int64(len(items)),
+		BillingMode:           billingMode,
+	}
+	if pt := td.ProvisionedThroughput; pt != nil {
+		source.ProvisionedThroughput = &ProvisionedThroughput{ReadCapacityUnits: pt.ReadCapacityUnits, WriteCapacityUnits: pt.WriteCapacityUnits}
+	}
+
+	arn := fmt.Sprintf("%s/backup/%013d-%s", tableArn(r.Context(), td.TableName), now.UnixMilli(), util.RandomHex(4))
+	backup := storedBackup{
+		Description: BackupDescription{
+			BackupDetails: BackupDetails{
+				BackupArn:              arn,
+				BackupName:             req.BackupName,
+				BackupSizeBytes:        size,
+				BackupStatus:           "AVAILABLE",
+				BackupType:             "USER",
+				BackupCreationDateTime: epochSeconds(now),
+			},
+			SourceTableDetails:        source,
+			SourceTableFeatureDetails: h.featureDetails(r.Context(), ns, td),
+		},
+		Table: *td,
+		Items: items,
+	}
+	buf, err := json.Marshal(backup)
+	if err != nil {
+		writeError(w, errInternal(err))
+		return
+	}
+	if err := h.Store.Create(r.Context(), &resource.Resource{ID: arn, Namespace: ns, Service: "dynamodb", Type: "backup", Attributes: buf}); err != nil {
+		writeError(w, errInternal(err))
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, CreateBackupOutput{BackupDetails: backup.Description.BackupDetails})
+}
+
+// ListBackups lists backups, optionally for one table and time range
+func (h *Handler) ListBackups(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req ListBackupsInput
+	if r.ContentLength != 0 {
+		if derr := decodeInput(r, &req); derr != nil {
+			writeError(w, derr)
+			return
+		}
+	}
+	switch req.BackupType {
+	case "", "ALL", "USER":
+	case "SYSTEM", "AWS_BACKUP":
+		awsresponses.WriteJSON(w, http.StatusOK, ListBackupsOutput{BackupSummaries: []BackupSummary{}})
+		return
+	default:
+		writeError(w, errValidation("1 validation error detected: Value '"+req.BackupType+"' at 'backupType' failed to satisfy constraint: "+
+			"Member must satisfy enum value set: [USER, SYSTEM, AWS_BACKUP, ALL]"))
+		return
+	}
+	if req.Limit != nil && (*req.Limit < 1 || *req.Limit > 100) {
+		writeError(w, errValidation("1 validation error detected: Value '"+strconv.Itoa(*req.Limit)+
+			"' at 'limit' failed to satisfy constraint: Member must have value between 1 and 100"))
+		return
+	}
+
+	resources, err := h.Store.List(r.Context(), "dynamodb", "backup", ns)
+	if err != nil {
+		writeError(w, errInternal(err))
+		return
+	}
+	table := extractTableName(req.TableName)
+	var summaries []BackupSummary
+	for _, res := range resources {
+		var b storedBackup
+		if json.Unmarshal(res.Attributes, &b) != nil {
+			continue
+		}
+		d, src := b.Description.BackupDetails, b.Description.SourceTableDetails
+		if table != "" && src.TableName != table {
+			continue
+		}
+		if req.TimeRangeLowerBound != nil && d.BackupCreationDateTime < *req.TimeRangeLowerBound {
+			continue
+		}
+		if req.TimeRangeUpperBound != nil && d.BackupCreationDateTime > *req.TimeRangeUpperBound {
+			continue
+		}
+		summaries = append(summaries, BackupSummary{
+			TableName:              src.TableName,
+			TableId:                src.TableId,
+			TableArn:               src.TableArn,
+			BackupArn:              d.BackupArn,
+			BackupName:             d.BackupName,
+			BackupCreationDateTime: d.BackupCreationDateTime,
+			BackupStatus:           d.BackupStatus,
+			BackupType:             d.BackupType,
+			BackupSizeBytes:        d.BackupSizeBytes,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].BackupCreationDateTime != summaries[j].BackupCreationDateTime {
+			return summaries[i].BackupCreationDateTime < summaries[j].BackupCreationDateTime
+		}
+		return summaries[i].BackupArn < summaries[j].BackupArn
+	})
+
+	if req.ExclusiveStartBackupArn != "" {
+		for i, s := range summaries {
+			if s.BackupArn == req.ExclusiveStartBackupArn {
+				summaries = summaries[i+1:]
+				break
+			}
+		}
+	}
+	out := ListBackupsOutput{BackupSummaries: summaries}
+	if req.Limit != nil && len(summaries) > *req.Limit {
+		out.BackupSummaries = summaries[:*req.Limit]
+		out.LastEvaluatedBackupArn = out.BackupSummaries[*req.Limit-1].BackupArn
+	}
+	if out.BackupSummaries == nil {
+		out.BackupSummaries = []BackupSummary{}
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, out)
+}
+
+// DescribeBackup describes one backup
+func (h *Handler) DescribeBackup(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req BackupArnInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	b, derr := h.loadBackup(r.Context(), ns, req.BackupArn)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, DescribeBackupOutput{BackupDescription: b.Description})
+}
+
+// DeleteBackup deletes one backup
+func (h *Handler) DeleteBackup(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req BackupArnInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	b, derr := h.loadBackup(r.Context(), ns, req.BackupArn)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if err := h.Store.Delete(r.Context(), req.BackupArn, "dynamodb", "backup", ns); err != nil {
+		writeError(w, errInternal(err))
+		return
+	}
+
+	b.Description.BackupDetails.BackupStatus = "DELETED"
+	awsresponses.WriteJSON(w, http.StatusOK, DeleteBackupOutput{BackupDescription: b.Description})
+}
+
+// RestoreTableFromBackup creates a new table from a backup
+func (h *Handler) RestoreTableFromBackup(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req RestoreTableFromBackupInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	defer h.lockTables(ns, true, req.TargetTableName)()
+
+	b, derr := h.loadBackup(r.Context(), ns, req.BackupArn)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	td, derr := h.restoreTable(r.Context(), ns, &b.Table, b.Items, req.TargetTableName, restoreOptions{
+		billingMode: req.BillingModeOverride,
+		gsis:        req.GlobalSecondaryIndexOverride,
+		lsis:        req.LocalSecondaryIndexOverride,
+		throughput:  req.ProvisionedThroughputOverride,
+		sse:         req.SSESpecificationOverride,
+	}, &RestoreSummary{
+		SourceBackupArn: req.BackupArn,
+		SourceTableArn:  b.Table.TableArn,
+		RestoreDateTime: b.Description.BackupDetails.BackupCreationDateTime,
+	})
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, RestoreTableFromBackupOutput{TableDescription: *td})
+}
+
+// RestoreTableToPointInTime creates a new table from a table's change
+// history
+func (h *Handler) RestoreTableToPointInTime(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req RestoreTableToPointInTimeInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	source := req.SourceTableName
+	if source == "" {
+		source = req.SourceTableArn
+	}
+	if source == "" {
+		writeError(w, errValidation("Either SourceTableArn or SourceTableName must be specified"))
+		return
+	}
+	if req.UseLatestRestorableTime == (req.RestoreDateTime != nil) {
+		writeError(w, errValidation("Exactly one of RestoreDateTime or UseLatestRestorableTime must be specified"))
+		return
+	}
+
+	defer h.lockTables(ns, true, source, req.TargetTableName)()
+
+	td, derr := h.loadTable(r.Context(), ns, source)
+	if derr != nil {
+		if derr.Type == "ResourceNotFoundException" {
+			derr = &ddbError{Type: "TableNotFoundException", Message: "Table not found: " + extractTableName(source)}
+		}
+		writeError(w, derr)
+		return
+	}
+	earliest, latest, ok := h.restorableWindow(r.Context(), ns, td.TableName)
+	if !ok {
+		writeError(w, &ddbError{Type: "PointInTimeRecoveryUnavailableException",
+			Message: "Point in time recovery is not enabled for table '" + td.TableName + "'"})
+		return
+	}
+	at := latest
+	if req.RestoreDateTime != nil {
+		at = fromEpochSeconds(*req.RestoreDateTime)
+		if at.Before(earliest) || at.After(latest) {
+			writeError(w, &ddbError{Type: "InvalidRestoreTimeException", Message: fmt.Sprintf(
+				"Restore time must be between %s and %s", earliest.UTC().Format(time.RFC3339), latest.UTC().Format(time.RFC3339))})
+			return
+		}
+	}
+
+	items, derr := h.itemsAt(r.Context(), ns, td.TableName, at)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	restored, derr := h.restoreTable(r.Context(), ns, td, items, req.TargetTableName, restoreOptions{
+		billingMode: req.BillingModeOverride,
+		gsis:        req.GlobalSecondaryIndexOverride,
+		lsis:        req.LocalSecondaryIndexOverride,
+		throughput:  req.ProvisionedThroughputOverride,
+		sse:         req.SSESpecificationOverride,
+	}, &RestoreSummary{
+		SourceTableArn:  td.TableArn,
+		RestoreDateTime: epochSeconds(at),
+	})
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, RestoreTableToPointInTimeOutput{TableDescription: *restored})
+}
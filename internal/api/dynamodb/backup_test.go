@@ -0,0 +1,241 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"opensnack/internal/api/dynamodb"
+	"opensnack/internal/resource"
+)
+
+// tableKeys returns the sorted pk values of every item in a table.
+func tableKeys(t *testing.T, h *dynamodb.Handler, table string) string {
+	t.Helper()
+	var out dynamodb.ScanOutput
+	mustCall(t, h, "Scan", `{"TableName":"`+table+`"}`, &out)
+	var keys []string
+	for _, item := range out.Items {
+		keys = append(keys, *item["pk"].S)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func TestBackups(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"a"},"v":{"N":"1"}}}`, nil)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"b"}}}`, nil)
+
+	var created dynamodb.CreateBackupOutput
+	mustCall(t, h, "CreateBackup", `{"TableName":"users","BackupName":"nightly"}`, &created)
+	arn := created.BackupDetails.BackupArn
+	if !strings.Contains(arn, ":table/users/backup/") || created.BackupDetails.BackupStatus != "AVAILABLE" {
+		t.Fatalf("unexpected backup: %+v", created.BackupDetails)
+	}
+
+	// Later writes do not reach the backup.
+	mustCall(t, h, "DeleteItem", `{"TableName":"users","Key":{"pk":{"S":"a"}}}`, nil)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"c"}}}`, nil)
+
+	var desc dynamodb.DescribeBackupOutput
+	mustCall(t, h, "DescribeBackup", `{"BackupArn":"`+arn+`"}`, &desc)
+	if src := desc.BackupDescription.SourceTableDetails; src.TableName != "users" || src.ItemCount != 2 {
+		t.Fatalf("unexpected source details: %+v", src)
+	}
+
+	var restored dynamodb.RestoreTableFromBackupOutput
+	mustCall(t, h, "RestoreTableFromBackup", `{"BackupArn":"`+arn+`","TargetTableName":"users-copy"}`, &restored)
+	td := restored.TableDescription
+	if td.TableName != "users-copy" || td.RestoreSummary == nil || td.RestoreSummary.SourceBackupArn != arn {
+		t.Fatalf("unexpected restored table: %+v", td)
+	}
+	if keys := tableKeys(t, h, "users-copy"); keys != "a,b" {
+		t.Fatalf("unexpected restored items: %s", keys)
+	}
+	expectError(t, h, "RestoreTableFromBackup", `{"BackupArn":"`+arn+`","TargetTableName":"users"}`, "TableAlreadyExistsException")
+
+	mustCall(t, h, "CreateBackup", `{"TableName":"users-copy","BackupName":"copy"}`, nil)
+	var list dynamodb.ListBackupsOutput
+	mustCall(t, h, "ListBackups", `{"TableName":"users"}`, &list)
+	if len(list.BackupSummaries) != 1 || list.BackupSummaries[0].BackupName != "nightly" {
+		t.Fatalf("unexpected backups for users: %+v", list)
+	}
+	list = dynamodb.ListBackupsOutput{}
+	mustCall(t, h, "ListBackups", `{"Limit":1}`, &list)
+	if len(list.BackupSummaries) != 1 || list.LastEvaluatedBackupArn != arn {
+		t.Fatalf("unexpected first page: %+v", list)
+	}
+	list = dynamodb.ListBackupsOutput{}
+	mustCall(t, h, "ListBackups", `{"Limit":1,"ExclusiveStartBackupArn":"`+arn+`"}`, &list)
+	if len(list.BackupSummaries) != 1 || list.BackupSummaries[0].BackupName != "copy" || list.LastEvaluatedBackupArn != "" {
+		t.Fatalf("unexpected second page: %+v", list)
+	}
+
+	var deleted dynamodb.DeleteBackupOutput
+	mustCall(t, h, "DeleteBackup", `{"BackupArn":"`+arn+`"}`, &deleted)
+	if deleted.BackupDescription.BackupDetails.BackupStatus != "DELETED" {
+		t.Fatalf("unexpected deleted backup: %+v", deleted.BackupDescription.BackupDetails)
+	}
+	expectError(t, h, "DescribeBackup", `{"BackupArn":"`+arn+`"}`, "BackupNotFoundException")
+	expectError(t, h, "CreateBackup", `{"TableName":"nope","BackupName":"x"}`, "TableNotFoundException")
+}
+
+func TestRestoreTableToPointInTime(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"a"}}}`, nil)
+
+	expectError(t, h, "RestoreTableToPointInTime", `{"SourceTableName":"users","TargetTableName":"t0","UseLatestRestorableTime":true}`,
+		"PointInTimeRecoveryUnavailableException")
+
+	mustCall(t, h, "UpdateContinuousBackups", `{"TableName":"users","PointInTimeRecoverySpecification":{"PointInTimeRecoveryEnabled":true}}`, nil)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"b"},"v":{"N":"1"}}}`, nil)
+	time.Sleep(10 * time.Millisecond)
+	point := float64(time.Now().UnixNano()) / 1e9
+	time.Sleep(10 * time.Millisecond)
+	mustCall(t, h, "DeleteItem", `{"TableName":"users","Key":{"pk":{"S":"a"}}}`, nil)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"b"},"v":{"N":"2"}}}`, nil)
+
+	var cb dynamodb.DescribeContinuousBackupsOutput
+	mustCall(t, h, "DescribeContinuousBackups", `{"TableName":"users"}`, &cb)
+	pitr := cb.ContinuousBackupsDescription.PointInTimeRecoveryDescription
+	if pitr.PointInTimeRecoveryStatus != "ENABLED" || pitr.EarliestRestorableDateTime == 0 || pitr.EarliestRestorableDateTime > point {
+		t.Fatalf("unexpected PITR description: %+v", pitr)
+	}
+
+	ts := strconv.FormatFloat(point, 'f', -1, 64)
+	var out dynamodb.RestoreTableToPointInTimeOutput
+	mustCall(t, h, "RestoreTableToPointInTime", `{"SourceTableName":"users","TargetTableName":"then","RestoreDateTime":`+ts+`}`, &out)
+	if out.TableDescription.RestoreSummary == nil || out.TableDescription.RestoreSummary.SourceTableArn == "" {
+		t.Fatalf("unexpected restored table: %+v", out.TableDescription)
+	}
+	var got dynamodb.GetItemOutput
+	mustCall(t, h, "GetItem", `{"TableName":"then","Key":{"pk":{"S":"b"}}}`, &got)
+	if keys := tableKeys(t, h, "then"); keys != "a,b" || *got.Item["v"].N != "1" {
+		t.Fatalf("unexpected point-in-time items: %s %s", keys, itemJSON(got.Item))
+	}
+
+	mustCall(t, h, "RestoreTableToPointInTime", `{"SourceTableName":"users","TargetTableName":"now","UseLatestRestorableTime":true}`, nil)
+	if keys := tableKeys(t, h, "now"); keys != "b" {
+		t.Fatalf("unexpected latest items: %s", keys)
+	}
+
+	expectError(t, h, "RestoreTableToPointInTime", `{"SourceTableName":"users","TargetTableName":"t1","RestoreDateTime":1}`,
+		"InvalidRestoreTimeException")
+
+	mustCall(t, h, "UpdateContinuousBackups", `{"TableName":"users","PointInTimeRecoverySpecification":{"PointInTimeRecoveryEnabled":false}}`, nil)
+	expectError(t, h, "RestoreTableToPointInTime", `{"SourceTableName":"users","TargetTableName":"t2","UseLatestRestorableTime":true}`,
+		"PointInTimeRecoveryUnavailableException")
+}
+
+func TestExportTableToPointInTime(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("OPENSNACK_OBJECT_ROOT", root)
+
+	store := resource.NewMemoryStore()
+	store.Create(t.Context(), &resource.Resource{ID: "exports", Namespace: "ns1", Service: "s3", Type: "bucket", Attributes: []byte(`{}`)})
+	h := dynamodb.NewHandler(store)
+	createTable(t, h, "users", false)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"a"},"n":{"N":"1"}}}`, nil)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"b"}}}`, nil)
+
+	var desc dynamodb.DescribeTableOutput
+	mustCall(t, h, "DescribeTable", `{"TableName":"users"}`, &desc)
+	tableArn := desc.Table.TableArn
+
+	body := `{"TableArn":"` + tableArn + `","S3Bucket":"exports","S3Prefix":"ddb","ClientToken":"tok"}`
+	expectError(t, h, "ExportTableToPointInTime", body, "PointInTimeRecoveryUnavailableException")
+	mustCall(t, h, "UpdateContinuousBackups", `{"TableName":"users","PointInTimeRecoverySpecification":{"PointInTimeRecoveryEnabled":true}}`, nil)
+
+	var out dynamodb.ExportTableToPointInTimeOutput
+	mustCall(t, h, "ExportTableToPointInTime", body, &out)
+	export := out.ExportDescription
+	if export.ExportStatus != "COMPLETED" || export.ItemCount != 2 || export.ExportFormat != "DYNAMODB_JSON" {
+		t.Fatalf("unexpected export: %+v", export)
+	}
+
+	// The same client token returns the same export.
+	var again dynamodb.ExportTableToPointInTimeOutput
+	mustCall(t, h, "ExportTableToPointInTime", body, &again)
+	if again.ExportDescription.ExportArn != export.ExportArn {
+		t.Fatalf("expected the original export, got %s", again.ExportDescription.ExportArn)
+	}
+
+	dir := filepath.Join(root, "ns1", "exports", filepath.Dir(export.ExportManifest))
+	var summary map[string]any
+	raw, err := os.ReadFile(filepath.Join(dir, "manifest-summary.json"))
+	if err != nil || json.Unmarshal(raw, &summary) != nil || summary["exportArn"] != export.ExportArn {
+		t.Fatalf("unexpected manifest summary: %v %s", err, raw)
+	}
+	var files struct {
+		DataFileS3Key string `json:"dataFileS3Key"`
+	}
+	raw, err = os.ReadFile(filepath.Join(dir, "manifest-files.json"))
+	if err != nil || json.Unmarshal(raw, &files) != nil {
+		t.Fatalf("unexpected manifest files: %v %s", err, raw)
+	}
+
+	f, err := os.Open(filepath.Join(root, "ns1", "exports", files.DataFileS3Key))
+	if err != nil {
+		t.Fatalf("missing data file: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("data file is not gzip: %v", err)
+	}
+	var keys []string
+	lines := bufio.NewScanner(gz)
+	for lines.Scan() {
+		var line struct {
+			Item dynamodb.Item `json:"Item"`
+		}
+		if err := json.Unmarshal(lines.Bytes(), &line); err != nil {
+			t.Fatalf("invalid data line %q: %v", lines.Text(), err)
+		}
+		keys = append(keys, *line.Item["pk"].S)
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "a,b" {
+		t.Fatalf("unexpected exported items: %v", keys)
+	}
+
+	var described dynamodb.DescribeExportOutput
+	mustCall(t, h, "DescribeExport", `{"ExportArn":"`+export.ExportArn+`"}`, &described)
+	if described.ExportDescription.ExportManifest != export.ExportManifest {
+		t.Fatalf("unexpected described export: %+v", described.ExportDescription)
+	}
+
+	mustCall(t, h, "ExportTableToPointInTime", `{"TableArn":"`+tableArn+`","S3Bucket":"missing"}`, &out)
+	if out.ExportDescription.ExportStatus != "FAILED" || out.ExportDescription.FailureCode != "S3NoSuchBucket" {
+		t.Fatalf("expected a failed export, got %+v", out.ExportDescription)
+	}
+
+	var list dynamodb.ListExportsOutput
+	mustCall(t, h, "ListExports", `{"TableArn":"`+tableArn+`","MaxResults":1}`, &list)
+	if len(list.ExportSummaries) != 1 || list.NextToken == "" {
+		t.Fatalf("unexpected first page: %+v", list)
+	}
+	next := list.NextToken
+	list = dynamodb.ListExportsOutput{}
+	mustCall(t, h, "ListExports", `{"TableArn":"`+tableArn+`","NextToken":"`+next+`"}`, &list)
+	if len(list.ExportSummaries) != 1 || list.NextToken != "" {
+		t.Fatalf("unexpected second page: %+v", list)
+	}
+
+	expectError(t, h, "ExportTableToPointInTime", `{"TableArn":"`+tableArn+`","S3Bucket":"exports","ExportFormat":"ION"}`, "ValidationException")
+	expectError(t, h, "DescribeExport", `{"ExportArn":"`+tableArn+`/export/nope"}`, "ExportNotFoundException")
+}
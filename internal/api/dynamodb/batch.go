@@ -0,0 +1,278 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb
+
+import (
+	"net/http"
+	"sort"
+
+	"opensnack/internal/awsresponses"
+	"opensnack/internal/util"
+)
+
+//
+// BATCH OPERATIONS
+//
+// BatchGetItem and BatchWriteItem validate the whole request up front and
+// then process each key on its own. Keys that cannot be processed are
+// handed back in UnprocessedKeys / UnprocessedItems so the caller can
+// retry them, exactly as the SDK retry helpers expect: reads beyond the
+// 16 MB response limit, and writes the store failed to apply.
+//
+
+const (
+	maxBatchGetKeys   = 100
+	maxBatchWrites    = 25
+	maxBatchGetResult = 16 * 1024 * 1024
+)
+
+// capacityTotals sums per-item ConsumedCapacity into one entry per table.
+type capacityTotals map[string]float64
+
+func (c capacityTotals) add(cc *ConsumedCapacity, factor float64) {
+	if cc != nil {
+		c[cc.TableName] += cc.CapacityUnits * factor
+	}
+}
+
+func (c capacityTotals) list() []ConsumedCapacity {
+	if len(c) == 0 {
+		return nil
+	}
+	out := make([]ConsumedCapacity, 0, len(c))
+	for _, table := range sortedTables(c) {
+		out = append(out, ConsumedCapacity{TableName: table, CapacityUnits: c[table]})
+	}
+	return out
+}
+
+// sortedTables returns the keys of a per-table map in a stable order.
+func sortedTables[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for table := range m {
+		out = append(out, table)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// batchGetTable is one validated RequestItems entry of BatchGetItem.
+type batchGetTable struct {
+	td         *TableDescription
+	request    KeysAndAttributes
+	projection []docPath
+}
+
+// BatchGetItem reads up to 100 items from one or more tables
+func (h *Handler) BatchGetItem(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req BatchGetItemInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if len(req.RequestItems) == 0 {
+		writeError(w, errValidation("1 validation error detected: Value null at 'requestItems' failed to satisfy constraint: "+
+			"Member must have length greater than or equal to 1"))
+		return
+	}
+
+	total := 0
+	projections := map[string][]docPath{}
+	for table, ka := range req.RequestItems {
+		if len(ka.Keys) == 0 {
+			writeError(w, errValidation("1 validation error detected: Value '[]' at 'requestItems."+table+".member.keys' "+
+				"failed to satisfy constraint: Member must have length greater than or equal to 1"))
+			return
+		}
+		total += len(ka.Keys)
+		if ka.AttributesToGet != nil && ka.ProjectionExpression != "" {
+			writeError(w, errValidation("Can not use both expression and non-expression parameters in the same request: "+
+				"Non-expression parameters: {AttributesToGet} Expression parameters: {ProjectionExpression}"))
+			return
+		}
+		ctx, derr := newExprContext(ka.ExpressionAttributeNames, nil)
+		if derr != nil {
+			writeError(w, derr)
+			return
+		}
+		projection, derr := ctx.projection(ka.ProjectionExpression)
+		if derr != nil {
+			writeError(w, derr)
+			return
+		}
+		if projection == nil {
+			projection = topLevelPaths(ka.AttributesToGet)
+		}
+		if derr := ctx.checkUnused(); derr != nil {
+			writeError(w, derr)
+			return
+		}
+		projections[table] = projection
+	}
+	if total > maxBatchGetKeys {
+		writeError(w, errValidation("Too many items requested for the BatchGetItem call"))
+		return
+	}
+
+	defer h.lockTables(ns, false, sortedTables(req.RequestItems)...)()
+
+	tables := map[string]*batchGetTable{}
+	for table, ka := range req.RequestItems {
+		td, derr := h.loadTable(r.Context(), ns, table)
+		if derr != nil {
+			writeError(w, &ddbError{Type: "ResourceNotFoundException", Message: "Requested resource not found"})
+			return
+		}
+		seen := map[string]bool{}
+		for _, key := range ka.Keys {
+			if derr := validateKey(td, key); derr != nil {
+				writeError(w, derr)
+				return
+			}
+			id := itemID(td, normalizeItem(key))
+			if seen[id] {
+				writeError(w, errValidation("Provided list of item keys contains duplicates"))
+				return
+			}
+			seen[id] = true
+		}
+		tables[table] = &batchGetTable{td: td, request: ka, projection: projections[table]}
+	}
+
+	out := BatchGetItemOutput{
+		Responses:       map[string][]Item{},
+		UnprocessedKeys: map[string]KeysAndAttributes{},
+	}
+	capacity := capacityTotals{}
+	size := 0
+	for _, table := range sortedTables(tables) {
+		t := tables[table]
+		out.Responses[table] = []Item{}
+		for i, key := range t.request.Keys {
+			if size >= maxBatchGetResult {
+				rest := t.request
+				rest.Keys = t.request.Keys[i:]
+				out.UnprocessedKeys[table] = rest
+				break
+			}
+			item, derr := h.getItem(r.Context(), ns, t.td, normalizeItem(key))
+			if derr != nil {
+				writeError(w, derr)
+				return
+			}
+			capacity.add(consumedCapacity(req.ReturnConsumedCapacity, t.td.TableName, item, false, t.request.ConsistentRead), 1)
+			if item == nil {
+				continue
+			}
+			size += itemSize(item)
+			out.Responses[table] = append(out.Responses[table], projectPaths(item, t.projection))
+		}
+	}
+	out.ConsumedCapacity = capacity.list()
+
+	awsresponses.WriteJSON(w, http.StatusOK, out)
+}
+
+// batchWrite is one validated WriteRequest of BatchWriteItem.
+type batchWrite struct {
+	table   string
+	td      *TableDescription
+	request WriteRequest
+	key     Item
+	item    Item
+}
+
+// BatchWriteItem puts or deletes up to 25 items in one or more tables
+func (h *Handler) BatchWriteItem(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req BatchWriteItemInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if len(req.RequestItems) == 0 {
+		writeError(w, errValidation("1 validation error detected: Value null at 'requestItems' failed to satisfy constraint: "+
+			"Member must have length greater than or equal to 1"))
+		return
+	}
+	total := 0
+	for _, requests := range req.RequestItems {
+		total += len(requests)
+	}
+	if total > maxBatchWrites {
+		writeError(w, errValidation("Too many items requested for the BatchWriteItem call"))
+		return
+	}
+
+	defer h.lockTables(ns, true, sortedTables(req.RequestItems)...)()
+
+	var writes []batchWrite
+	for _, table := range sortedTables(req.RequestItems) {
+		requests := req.RequestItems[table]
+		if len(requests) == 0 {
+			writeError(w, errValidation("1 validation error detected: Value '[]' at 'requestItems."+table+".member' "+
+				"failed to satisfy constraint: Member must have length greater than or equal to 1"))
+			return
+		}
+		td, derr := h.loadTable(r.Context(), ns, table)
+		if derr != nil {
+			writeError(w, &ddbError{Type: "ResourceNotFoundException", Message: "Requested resource not found"})
+			return
+		}
+		seen := map[string]bool{}
+		for _, wr := range requests {
+			bw := batchWrite{table: table, td: td, request: wr}
+			switch {
+			case (wr.PutRequest == nil) == (wr.DeleteRequest == nil):
+				writeError(w, errValidation("Supplied WriteRequest must contain exactly one of PutRequest or DeleteRequest"))
+				return
+			case wr.PutRequest != nil:
+				if derr := validateItem(td, wr.PutRequest.Item); derr != nil {
+					writeError(w, derr)
+					return
+				}
+				bw.item = normalizeItem(wr.PutRequest.Item)
+				bw.key = primaryKey(td.KeySchema, bw.item)
+			default:
+				if derr := validateKey(td, wr.DeleteRequest.Key); derr != nil {
+					writeError(w, derr)
+					return
+				}
+				bw.key = normalizeItem(wr.DeleteRequest.Key)
+			}
+			id := itemID(td, bw.key)
+			if seen[id] {
+				writeError(w, errValidation("Provided list of item keys contains duplicates"))
+				return
+			}
+			seen[id] = true
+			writes = append(writes, bw)
+		}
+	}
+
+	out := BatchWriteItemOutput{UnprocessedItems: map[string][]WriteRequest{}}
+	capacity := capacityTotals{}
+	for _, bw := range writes {
+		old, derr := h.getItem(r.Context(), ns, bw.td, bw.key)
+		if derr == nil {
+			derr = h.writeItem(r.Context(), h.Store, ns, bw.td, old, bw.item)
+		}
+		if derr != nil {
+			out.UnprocessedItems[bw.table] = append(out.UnprocessedItems[bw.table], bw.request)
+			continue
+		}
+		sized := bw.item
+		if sized == nil {
+			sized = old
+		}
+		capacity.add(consumedCapacity(req.ReturnConsumedCapacity, bw.td.TableName, sized, true, true), 1)
+	}
+	out.ConsumedCapacity = capacity.list()
+
+	awsresponses.WriteJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,78 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"opensnack/internal/api/dynamodb"
+	"opensnack/internal/resource"
+)
+
+func TestBatchWriteAndGetItem(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+	createTable(t, h, "events", true)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"gone"}}}`, nil)
+
+	var write dynamodb.BatchWriteItemOutput
+	mustCall(t, h, "BatchWriteItem", `{"ReturnConsumedCapacity":"TOTAL","RequestItems":{`+
+		`"users":[{"PutRequest":{"Item":{"pk":{"S":"u1"},"name":{"S":"Ann"}}}},{"DeleteRequest":{"Key":{"pk":{"S":"gone"}}}}],`+
+		`"events":[{"PutRequest":{"Item":{"pk":{"S":"e"},"sk":{"N":"1"}}}}]}}`, &write)
+	if len(write.UnprocessedItems) != 0 || len(write.ConsumedCapacity) != 2 || write.ConsumedCapacity[1].CapacityUnits != 2 {
+		t.Fatalf("unexpected batch write output: %+v", write)
+	}
+
+	var get dynamodb.BatchGetItemOutput
+	mustCall(t, h, "BatchGetItem", `{"RequestItems":{`+
+		`"users":{"Keys":[{"pk":{"S":"u1"}},{"pk":{"S":"gone"}}],"ProjectionExpression":"#n","ExpressionAttributeNames":{"#n":"name"}},`+
+		`"events":{"Keys":[{"pk":{"S":"e"},"sk":{"N":"1"}}]}}}`, &get)
+	if len(get.Responses["users"]) != 1 || itemJSON(get.Responses["users"][0]) != `{"name":{"S":"Ann"}}` {
+		t.Fatalf("unexpected users response: %+v", get.Responses["users"])
+	}
+	if len(get.Responses["events"]) != 1 || get.UnprocessedKeys == nil || len(get.UnprocessedKeys) != 0 {
+		t.Fatalf("unexpected batch get output: %+v", get)
+	}
+}
+
+func TestBatchWriteItem_Validation(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+
+	var many []string
+	for i := 0; i < 26; i++ {
+		many = append(many, fmt.Sprintf(`{"PutRequest":{"Item":{"pk":{"S":"u%d"}}}}`, i))
+	}
+	cases := []struct {
+		body, errType, want string
+	}{
+		{`{"RequestItems":{}}`, "ValidationException", "requestItems"},
+		{`{"RequestItems":{"users":[` + strings.Join(many, ",") + `]}}`, "ValidationException", "Too many items requested"},
+		{`{"RequestItems":{"users":[{"PutRequest":{"Item":{"pk":{"S":"a"}}}},{"DeleteRequest":{"Key":{"pk":{"S":"a"}}}}]}}`,
+			"ValidationException", "contains duplicates"},
+		{`{"RequestItems":{"users":[{}]}}`, "ValidationException", "exactly one of PutRequest or DeleteRequest"},
+		{`{"RequestItems":{"users":[{"PutRequest":{"Item":{"other":{"S":"a"}}}}]}}`, "ValidationException", "Missing the key pk"},
+		{`{"RequestItems":{"nope":[{"PutRequest":{"Item":{"pk":{"S":"a"}}}}]}}`, "ResourceNotFoundException", "not found"},
+	}
+	for _, c := range cases {
+		if msg := expectError(t, h, "BatchWriteItem", c.body, c.errType); !strings.Contains(msg, c.want) {
+			t.Fatalf("%s: expected %q, got %q", c.body, c.want, msg)
+		}
+	}
+
+	// A rejected batch writes nothing.
+	var scan dynamodb.ScanOutput
+	mustCall(t, h, "Scan", `{"TableName":"users"}`, &scan)
+	if scan.Count != 0 {
+		t.Fatalf("expected no items, got %d", scan.Count)
+	}
+
+	if msg := expectError(t, h, "BatchGetItem", `{"RequestItems":{"users":{"Keys":[{"pk":{"S":"a"}},{"pk":{"S":"a"}}]}}}`,
+		"ValidationException"); !strings.Contains(msg, "contains duplicates") {
+		t.Fatalf("unexpected message: %s", msg)
+	}
+}
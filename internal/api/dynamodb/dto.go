@@ -126,6 +126,7 @@ type TableDescription struct {
 	LatestStreamArn           string                            `json:"LatestStreamArn,omitempty"`
 	LatestStreamLabel         string                            `json:"LatestStreamLabel,omitempty"`
 	SSEDescription            *SSEDescription                   `json:"SSEDescription,omitempty"`
+	RestoreSummary            *RestoreSummary                   `json:"RestoreSummary,omitempty"`
 	ItemCount                 int64                             `json:"ItemCount"`
 	TableSizeBytes            int64                             `json:"TableSizeBytes"`
 	DeletionProtectionEnabled bool                              `json:"DeletionProtectionEnabled,omitempty"`
@@ -169,14 +170,26 @@ type ListTablesOutput struct {
 
 // UpdateTableInput is the input for UpdateTable
 type UpdateTableInput struct {
-	TableName                   string                 `json:"TableName"`
-	AttributeDefinitions        []AttributeDefinition  `json:"AttributeDefinitions,omitempty"`
-	BillingMode                 string                 `json:"BillingMode,omitempty"`
-	ProvisionedThroughput       *ProvisionedThroughput `json:"ProvisionedThroughput,omitempty"`
-	GlobalSecondaryIndexUpdates []any                  `json:"GlobalSecondaryIndexUpdates,omitempty"`
-	StreamSpecification         *StreamSpecification   `json:"StreamSpecification,omitempty"`
-	SSESpecification            *SSESpecification      `json:"SSESpecification,omitempty"`
-	DeletionProtectionEnabled   *bool                  `json:"DeletionProtectionEnabled,omitempty"`
+	TableName                   string                       `json:"TableName"`
+	AttributeDefinitions        []AttributeDefinition        `json:"AttributeDefinitions,omitempty"`
+	BillingMode                 string                       `json:"BillingMode,omitempty"`
+	ProvisionedThroughput       *ProvisionedThroughput       `json:"ProvisionedThroughput,omitempty"`
+	GlobalSecondaryIndexUpdates []GlobalSecondaryIndexUpdate `json:"GlobalSecondaryIndexUpdates,omitempty"`
+	StreamSpecification         *StreamSpecification         `json:"StreamSpecification,omitempty"`
+	SSESpecification            *SSESpecification            `json:"SSESpecification,omitempty"`
+	DeletionProtectionEnabled   *bool                        `json:"DeletionProtectionEnabled,omitempty"`
+}
+
+// GlobalSecondaryIndexUpdate creates, updates or deletes one GSI
+type GlobalSecondaryIndexUpdate struct {
+	Create *GlobalSecondaryIndex `json:"Create,omitempty"`
+	Update *struct {
+		IndexName             string                 `json:"IndexName"`
+		ProvisionedThroughput *ProvisionedThroughput `json:"ProvisionedThroughput,omitempty"`
+	} `json:"Update,omitempty"`
+	Delete *struct {
+		IndexName string `json:"IndexName"`
+	} `json:"Delete,omitempty"`
 }
 
 // UpdateTableOutput is the output for UpdateTable
@@ -228,3 +241,675 @@ type DescribeContinuousBackupsOutput struct {
 type UpdateContinuousBackupsOutput struct {
 	ContinuousBackupsDescription ContinuousBackupsDescription `json:"ContinuousBackupsDescription"`
 }
+
+// ConsumedCapacity reports the capacity units an item operation used
+type ConsumedCapacity struct {
+	TableName     string  `json:"TableName"`
+	CapacityUnits float64 `json:"CapacityUnits"`
+}
+
+// AttributeValueUpdate is a legacy UpdateItem AttributeUpdates entry
+type AttributeValueUpdate struct {
+	Action string          `json:"Action,omitempty"` // PUT, DELETE, ADD
+	Value  *AttributeValue `json:"Value,omitempty"`
+}
+
+// PutItemInput is the input for PutItem
+type PutItemInput struct {
+	TableName                           string            `json:"TableName"`
+	Item                                Item              `json:"Item"`
+	ConditionExpression                 string            `json:"ConditionExpression,omitempty"`
+	ExpressionAttributeNames            map[string]string `json:"ExpressionAttributeNames,omitempty"`
+	ExpressionAttributeValues           Item              `json:"ExpressionAttributeValues,omitempty"`
+	ReturnValuesOnConditionCheckFailure string            `json:"ReturnValuesOnConditionCheckFailure,omitempty"`
+	ReturnValues                        string            `json:"ReturnValues,omitempty"`
+	ReturnConsumedCapacity              string            `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+// PutItemOutput is the output for PutItem
+type PutItemOutput struct {
+	Attributes       Item              `json:"Attributes,omitempty"`
+	ConsumedCapacity *ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+}
+
+// GetItemInput is the input for GetItem
+type GetItemInput struct {
+	TableName                string            `json:"TableName"`
+	Key                      Item              `json:"Key"`
+	AttributesToGet          []string          `json:"AttributesToGet,omitempty"`
+	ProjectionExpression     string            `json:"ProjectionExpression,omitempty"`
+	ExpressionAttributeNames map[string]string `json:"ExpressionAttributeNames,omitempty"`
+	ConsistentRead           bool              `json:"ConsistentRead,omitempty"`
+	ReturnConsumedCapacity   string            `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+// GetItemOutput is the output for GetItem
+type GetItemOutput struct {
+	Item             Item              `json:"Item,omitempty"`
+	ConsumedCapacity *ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+}
+
+// DeleteItemInput is the input for DeleteItem
+type DeleteItemInput struct {
+	TableName                           string            `json:"TableName"`
+	Key                                 Item              `json:"Key"`
+	ConditionExpression                 string            `json:"ConditionExpression,omitempty"`
+	ExpressionAttributeNames            map[string]string `json:"ExpressionAttributeNames,omitempty"`
+	ExpressionAttributeValues           Item              `json:"ExpressionAttributeValues,omitempty"`
+	ReturnValuesOnConditionCheckFailure string            `json:"ReturnValuesOnConditionCheckFailure,omitempty"`
+	ReturnValues                        string            `json:"ReturnValues,omitempty"`
+	ReturnConsumedCapacity              string            `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+// DeleteItemOutput is the output for DeleteItem
+type DeleteItemOutput struct {
+	Attributes       Item              `json:"Attributes,omitempty"`
+	ConsumedCapacity *ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+}
+
+// UpdateItemInput is the input for UpdateItem
+type UpdateItemInput struct {
+	TableName                           string                          `json:"TableName"`
+	Key                                 Item                            `json:"Key"`
+	AttributeUpdates                    map[string]AttributeValueUpdate `json:"AttributeUpdates,omitempty"`
+	UpdateExpression                    string                          `json:"UpdateExpression,omitempty"`
+	ConditionExpression                 string                          `json:"ConditionExpression,omitempty"`
+	ExpressionAttributeNames            map[string]string               `json:"ExpressionAttributeNames,omitempty"`
+	ExpressionAttributeValues           Item                            `json:"ExpressionAttributeValues,omitempty"`
+	ReturnValuesOnConditionCheckFailure string                          `json:"ReturnValuesOnConditionCheckFailure,omitempty"`
+	ReturnValues                        string                          `json:"ReturnValues,omitempty"`
+	ReturnConsumedCapacity              string                          `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+// UpdateItemOutput is the output for UpdateItem
+type UpdateItemOutput struct {
+	Attributes       Item              `json:"Attributes,omitempty"`
+	ConsumedCapacity *ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+}
+
+// QueryInput is the input for Query
+type QueryInput struct {
+	TableName                 string            `json:"TableName"`
+	IndexName                 string            `json:"IndexName,omitempty"`
+	KeyConditionExpression    string            `json:"KeyConditionExpression,omitempty"`
+	FilterExpression          string            `json:"FilterExpression,omitempty"`
+	ProjectionExpression      string            `json:"ProjectionExpression,omitempty"`
+	AttributesToGet           []string          `json:"AttributesToGet,omitempty"`
+	ExpressionAttributeNames  map[string]string `json:"ExpressionAttributeNames,omitempty"`
+	ExpressionAttributeValues Item              `json:"ExpressionAttributeValues,omitempty"`
+	ScanIndexForward          *bool             `json:"ScanIndexForward,omitempty"`
+	Limit                     *int              `json:"Limit,omitempty"`
+	ExclusiveStartKey         Item              `json:"ExclusiveStartKey,omitempty"`
+	Select                    string            `json:"Select,omitempty"`
+	ConsistentRead            bool              `json:"ConsistentRead,omitempty"`
+	ReturnConsumedCapacity    string            `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+// ScanInput is the input for Scan
+type ScanInput struct {
+	TableName                 string            `json:"TableName"`
+	IndexName                 string            `json:"IndexName,omitempty"`
+	FilterExpression          string            `json:"FilterExpression,omitempty"`
+	ProjectionExpression      string            `json:"ProjectionExpression,omitempty"`
+	AttributesToGet           []string          `json:"AttributesToGet,omitempty"`
+	ExpressionAttributeNames  map[string]string `json:"ExpressionAttributeNames,omitempty"`
+	ExpressionAttributeValues Item              `json:"ExpressionAttributeValues,omitempty"`
+	Limit                     *int              `json:"Limit,omitempty"`
+	ExclusiveStartKey         Item              `json:"ExclusiveStartKey,omitempty"`
+	Select                    string            `json:"Select,omitempty"`
+	Segment                   *int              `json:"Segment,omitempty"`
+	TotalSegments             *int              `json:"TotalSegments,omitempty"`
+	ConsistentRead            bool              `json:"ConsistentRead,omitempty"`
+	ReturnConsumedCapacity    string            `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+// PageSummary is the part of a Query or Scan response returned on its own
+// for Select=COUNT
+type PageSummary struct {
+	Count            int               `json:"Count"`
+	ScannedCount     int               `json:"ScannedCount"`
+	LastEvaluatedKey Item              `json:"LastEvaluatedKey,omitempty"`
+	ConsumedCapacity *ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+}
+
+// QueryOutput is the output for Query
+type QueryOutput struct {
+	Items []Item `json:"Items"`
+	PageSummary
+}
+
+// ScanOutput is the output for Scan
+type ScanOutput struct {
+	Items []Item `json:"Items"`
+	PageSummary
+}
+
+// KeysAndAttributes is the set of keys BatchGetItem reads from one table
+type KeysAndAttributes struct {
+	Keys                     []Item            `json:"Keys"`
+	AttributesToGet          []string          `json:"AttributesToGet,omitempty"`
+	ProjectionExpression     string            `json:"ProjectionExpression,omitempty"`
+	ExpressionAttributeNames map[string]string `json:"ExpressionAttributeNames,omitempty"`
+	ConsistentRead           bool              `json:"ConsistentRead,omitempty"`
+}
+
+// BatchGetItemInput is the input for BatchGetItem
+type BatchGetItemInput struct {
+	RequestItems           map[string]KeysAndAttributes `json:"RequestItems"`
+	ReturnConsumedCapacity string                       `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+// BatchGetItemOutput is the output for BatchGetItem
+type BatchGetItemOutput struct {
+	Responses        map[string][]Item            `json:"Responses"`
+	UnprocessedKeys  map[string]KeysAndAttributes `json:"UnprocessedKeys"`
+	ConsumedCapacity []ConsumedCapacity           `json:"ConsumedCapacity,omitempty"`
+}
+
+// PutRequest is a put inside a BatchWriteItem call
+type PutRequest struct {
+	Item Item `json:"Item"`
+}
+
+// DeleteRequest is a delete inside a BatchWriteItem call
+type DeleteRequest struct {
+	Key Item `json:"Key"`
+}
+
+// WriteRequest is one put or delete inside a BatchWriteItem call
+type WriteRequest struct {
+	PutRequest    *PutRequest    `json:"PutRequest,omitempty"`
+	DeleteRequest *DeleteRequest `json:"DeleteRequest,omitempty"`
+}
+
+// BatchWriteItemInput is the input for BatchWriteItem
+type BatchWriteItemInput struct {
+	RequestItems           map[string][]WriteRequest `json:"RequestItems"`
+	ReturnConsumedCapacity string                    `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+// BatchWriteItemOutput is the output for BatchWriteItem
+type BatchWriteItemOutput struct {
+	UnprocessedItems map[string][]WriteRequest `json:"UnprocessedItems"`
+	ConsumedCapacity []ConsumedCapacity        `json:"ConsumedCapacity,omitempty"`
+}
+
+// TransactGet reads one item inside TransactGetItems
+type TransactGet struct {
+	TableName                string            `json:"TableName"`
+	Key                      Item              `json:"Key"`
+	ProjectionExpression     string            `json:"ProjectionExpression,omitempty"`
+	ExpressionAttributeNames map[string]string `json:"ExpressionAttributeNames,omitempty"`
+}
+
+// TransactGetItem wraps a TransactGet
+type TransactGetItem struct {
+	Get *TransactGet `json:"Get"`
+}
+
+// TransactGetItemsInput is the input for TransactGetItems
+type TransactGetItemsInput struct {
+	TransactItems          []TransactGetItem `json:"TransactItems"`
+	ReturnConsumedCapacity string            `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+// ItemResponse is one item returned by TransactGetItems
+type ItemResponse struct {
+	Item Item `json:"Item,omitempty"`
+}
+
+// TransactGetItemsOutput is the output for TransactGetItems
+type TransactGetItemsOutput struct {
+	Responses        []ItemResponse     `json:"Responses"`
+	ConsumedCapacity []ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+}
+
+// TransactWriteOperation is a ConditionCheck, Put, Delete or Update
+// inside TransactWriteItems. Item is only used by Put, UpdateExpression
+// only by Update.
+type TransactWriteOperation struct {
+	TableName                           string            `json:"TableName"`
+	Key                                 Item              `json:"Key,omitempty"`
+	Item                                Item              `json:"Item,omitempty"`
+	UpdateExpression                    string            `json:"UpdateExpression,omitempty"`
+	ConditionExpression                 string            `json:"ConditionExpression,omitempty"`
+	ExpressionAttributeNames            map[string]string `json:"ExpressionAttributeNames,omitempty"`
+	ExpressionAttributeValues           Item              `json:"ExpressionAttributeValues,omitempty"`
+	ReturnValuesOnConditionCheckFailure string            `json:"ReturnValuesOnConditionCheckFailure,omitempty"`
+}
+
+// TransactWriteItem holds exactly one TransactWriteOperation
+type TransactWriteItem struct {
+	ConditionCheck *TransactWriteOperation `json:"ConditionCheck,omitempty"`
+	Put            *TransactWriteOperation `json:"Put,omitempty"`
+	Delete         *TransactWriteOperation `json:"Delete,omitempty"`
+	Update         *TransactWriteOperation `json:"Update,omitempty"`
+}
+
+// TransactWriteItemsInput is the input for TransactWriteItems
+type TransactWriteItemsInput struct {
+	TransactItems          []TransactWriteItem `json:"TransactItems"`
+	ClientRequestToken     string              `json:"ClientRequestToken,omitempty"`
+	ReturnConsumedCapacity string              `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+// TransactWriteItemsOutput is the output for TransactWriteItems
+type TransactWriteItemsOutput struct {
+	ConsumedCapacity []ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+}
+
+// CancellationReason explains why one item of a transaction failed
+type CancellationReason struct {
+	Code    string `json:"Code"`
+	Message string `json:"Message,omitempty"`
+	Item    Item   `json:"Item,omitempty"`
+}
+
+// Identity identifies the service that made a change, such as TTL
+type Identity struct {
+	PrincipalId string `json:"PrincipalId"`
+	Type        string `json:"Type"`
+}
+
+// StreamRecord is the item-level part of a stream Record
+type StreamRecord struct {
+	ApproximateCreationDateTime float64 `json:"ApproximateCreationDateTime"`
+	Keys                        Item    `json:"Keys"`
+	NewImage                    Item    `json:"NewImage,omitempty"`
+	OldImage                    Item    `json:"OldImage,omitempty"`
+	SequenceNumber              string  `json:"SequenceNumber"`
+	SizeBytes                   int     `json:"SizeBytes"`
+	StreamViewType              string  `json:"StreamViewType"`
+}
+
+// Record is one DynamoDB Streams change record
+type Record struct {
+	AwsRegion    string       `json:"awsRegion"`
+	Dynamodb     StreamRecord `json:"dynamodb"`
+	EventID      string       `json:"eventID"`
+	EventName    string       `json:"eventName"`
+	EventSource  string       `json:"eventSource"`
+	EventVersion string       `json:"eventVersion"`
+	UserIdentity *Identity    `json:"userIdentity,omitempty"`
+}
+
+// StreamSummary is one entry of ListStreams
+type StreamSummary struct {
+	StreamArn   string `json:"StreamArn"`
+	StreamLabel string `json:"StreamLabel"`
+	TableName   string `json:"TableName"`
+}
+
+// ListStreamsInput is the input for ListStreams
+type ListStreamsInput struct {
+	TableName               string `json:"TableName,omitempty"`
+	Limit                   int    `json:"Limit,omitempty"`
+	ExclusiveStartStreamArn string `json:"ExclusiveStartStreamArn,omitempty"`
+}
+
+// ListStreamsOutput is the output for ListStreams
+type ListStreamsOutput struct {
+	Streams                []StreamSummary `json:"Streams"`
+	LastEvaluatedStreamArn string          `json:"LastEvaluatedStreamArn,omitempty"`
+}
+
+// SequenceNumberRange is the range of records in a shard
+type SequenceNumberRange struct {
+	StartingSequenceNumber string `json:"StartingSequenceNumber"`
+	EndingSequenceNumber   string `json:"EndingSequenceNumber,omitempty"`
+}
+
+// Shard is one shard of a stream
+type Shard struct {
+	ShardId             string              `json:"ShardId"`
+	SequenceNumberRange SequenceNumberRange `json:"SequenceNumberRange"`
+}
+
+// StreamDescription describes a stream
+type StreamDescription struct {
+	StreamArn               string             `json:"StreamArn"`
+	StreamLabel             string             `json:"StreamLabel"`
+	StreamStatus            string             `json:"StreamStatus"`
+	StreamViewType          string             `json:"StreamViewType"`
+	CreationRequestDateTime float64            `json:"CreationRequestDateTime"`
+	TableName               string             `json:"TableName"`
+	KeySchema               []KeySchemaElement `json:"KeySchema"`
+	Shards                  []Shard            `json:"Shards"`
+}
+
+// DescribeStreamInput is the input for DescribeStream
+type DescribeStreamInput struct {
+	StreamArn             string `json:"StreamArn"`
+	Limit                 int    `json:"Limit,omitempty"`
+	ExclusiveStartShardId string `json:"ExclusiveStartShardId,omitempty"`
+}
+
+// DescribeStreamOutput is the output for DescribeStream
+type DescribeStreamOutput struct {
+	StreamDescription StreamDescription `json:"StreamDescription"`
+}
+
+// GetShardIteratorInput is the input for GetShardIterator
+type GetShardIteratorInput struct {
+	StreamArn         string `json:"StreamArn"`
+	ShardId           string `json:"ShardId"`
+	ShardIteratorType string `json:"ShardIteratorType"`
+	SequenceNumber    string `json:"SequenceNumber,omitempty"`
+}
+
+// GetShardIteratorOutput is the output for GetShardIterator
+type GetShardIteratorOutput struct {
+	ShardIterator string `json:"ShardIterator"`
+}
+
+// GetRecordsInput is the input for GetRecords
+type GetRecordsInput struct {
+	ShardIterator string `json:"ShardIterator"`
+	Limit         int    `json:"Limit,omitempty"`
+}
+
+// GetRecordsOutput is the output for GetRecords
+type GetRecordsOutput struct {
+	Records           []Record `json:"Records"`
+	NextShardIterator string   `json:"NextShardIterator,omitempty"`
+}
+
+// ExecuteStatementInput is the input for ExecuteStatement
+type ExecuteStatementInput struct {
+	Statement                           string           `json:"Statement"`
+	Parameters                          []AttributeValue `json:"Parameters,omitempty"`
+	ConsistentRead                      bool             `json:"ConsistentRead,omitempty"`
+	NextToken                           string           `json:"NextToken,omitempty"`
+	Limit                               *int             `json:"Limit,omitempty"`
+	ReturnConsumedCapacity              string           `json:"ReturnConsumedCapacity,omitempty"`
+	ReturnValuesOnConditionCheckFailure string           `json:"ReturnValuesOnConditionCheckFailure,omitempty"`
+}
+
+// ExecuteStatementOutput is the output for ExecuteStatement
+type ExecuteStatementOutput struct {
+	Items            []Item            `json:"Items"`
+	NextToken        string            `json:"NextToken,omitempty"`
+	LastEvaluatedKey Item              `json:"LastEvaluatedKey,omitempty"`
+	ConsumedCapacity *ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+}
+
+// BatchStatementRequest is one statement of BatchExecuteStatement
+type BatchStatementRequest struct {
+	Statement                           string           `json:"Statement"`
+	Parameters                          []AttributeValue `json:"Parameters,omitempty"`
+	ConsistentRead                      bool             `json:"ConsistentRead,omitempty"`
+	ReturnValuesOnConditionCheckFailure string           `json:"ReturnValuesOnConditionCheckFailure,omitempty"`
+}
+
+// BatchExecuteStatementInput is the input for BatchExecuteStatement
+type BatchExecuteStatementInput struct {
+	Statements             []BatchStatementRequest `json:"Statements"`
+	ReturnConsumedCapacity string                  `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+// BatchStatementError is the error of one failed batch statement
+type BatchStatementError struct {
+	Code    string `json:"Code"`
+	Message string `json:"Message,omitempty"`
+	Item    Item   `json:"Item,omitempty"`
+}
+
+// BatchStatementResponse is the result of one batch statement
+type BatchStatementResponse struct {
+	TableName string               `json:"TableName,omitempty"`
+	Item      Item                 `json:"Item,omitempty"`
+	Error     *BatchStatementError `json:"Error,omitempty"`
+}
+
+// BatchExecuteStatementOutput is the output for BatchExecuteStatement
+type BatchExecuteStatementOutput struct {
+	Responses        []BatchStatementResponse `json:"Responses"`
+	ConsumedCapacity []ConsumedCapacity       `json:"ConsumedCapacity,omitempty"`
+}
+
+// ParameterizedStatement is one statement of ExecuteTransaction
+type ParameterizedStatement struct {
+	Statement                           string           `json:"Statement"`
+	Parameters                          []AttributeValue `json:"Parameters,omitempty"`
+	ReturnValuesOnConditionCheckFailure string           `json:"ReturnValuesOnConditionCheckFailure,omitempty"`
+}
+
+// ExecuteTransactionInput is the input for ExecuteTransaction
+type ExecuteTransactionInput struct {
+	TransactStatements     []ParameterizedStatement `json:"TransactStatements"`
+	ClientRequestToken     string                   `json:"ClientRequestToken,omitempty"`
+	ReturnConsumedCapacity string                   `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+// ExecuteTransactionOutput is the output for ExecuteTransaction. Responses
+// is only set for a read transaction.
+type ExecuteTransactionOutput struct {
+	Responses        []ItemResponse     `json:"Responses,omitempty"`
+	ConsumedCapacity []ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+}
+
+// RestoreSummary describes the backup or table a table was restored from
+type RestoreSummary struct {
+	SourceBackupArn   string  `json:"SourceBackupArn,omitempty"`
+	SourceTableArn    string  `json:"SourceTableArn,omitempty"`
+	RestoreDateTime   float64 `json:"RestoreDateTime"`
+	RestoreInProgress bool    `json:"RestoreInProgress"`
+}
+
+// BackupDetails describes a backup
+type BackupDetails struct {
+	BackupArn              string  `json:"BackupArn"`
+	BackupName             string  `json:"BackupName"`
+	BackupSizeBytes        int64   `json:"BackupSizeBytes"`
+	BackupStatus           string  `json:"BackupStatus"`
+	BackupType             string  `json:"BackupType"`
+	BackupCreationDateTime float64 `json:"BackupCreationDateTime"`
+}
+
+// SourceTableDetails describes the table a backup was taken from
+type SourceTableDetails struct {
+	TableName             string                 `json:"TableName"`
+	TableId               string                 `json:"TableId"`
+	TableArn              string                 `json:"TableArn"`
+	TableSizeBytes        int64                  `json:"TableSizeBytes"`
+	KeySchema             []KeySchemaElement     `json:"KeySchema"`
+	TableCreationDateTime float64                `json:"TableCreationDateTime"`
+	ProvisionedThroughput *ProvisionedThroughput `json:"ProvisionedThroughput,omitempty"`
+	ItemCount             int64                  `json:"ItemCount"`
+	BillingMode           string                 `json:"BillingMode"`
+}
+
+// LocalSecondaryIndexInfo describes an index of a backed up table
+type LocalSecondaryIndexInfo struct {
+	IndexName  string             `json:"IndexName"`
+	KeySchema  []KeySchemaElement `json:"KeySchema"`
+	Projection Projection         `json:"Projection"`
+}
+
+// GlobalSecondaryIndexInfo describes an index of a backed up table
+type GlobalSecondaryIndexInfo struct {
+	IndexName             string                 `json:"IndexName"`
+	KeySchema             []KeySchemaElement     `json:"KeySchema"`
+	Projection            Projection             `json:"Projection"`
+	ProvisionedThroughput *ProvisionedThroughput `json:"ProvisionedThroughput,omitempty"`
+}
+
+// SourceTableFeatureDetails describes the indexes and settings of a
+// backed up table
+type SourceTableFeatureDetails struct {
+	LocalSecondaryIndexes  []LocalSecondaryIndexInfo  `json:"LocalSecondaryIndexes,omitempty"`
+	GlobalSecondaryIndexes []GlobalSecondaryIndexInfo `json:"GlobalSecondaryIndexes,omitempty"`
+	StreamDescription      *StreamSpecification       `json:"StreamDescription,omitempty"`
+	TimeToLiveDescription  *TimeToLiveDescription     `json:"TimeToLiveDescription,omitempty"`
+	SSEDescription         *SSEDescription            `json:"SSEDescription,omitempty"`
+}
+
+// BackupDescription is the full description of a backup
+type BackupDescription struct {
+	BackupDetails             BackupDetails             `json:"BackupDetails"`
+	SourceTableDetails        SourceTableDetails        `json:"SourceTableDetails"`
+	SourceTableFeatureDetails SourceTableFeatureDetails `json:"SourceTableFeatureDetails"`
+}
+
+// BackupSummary is one entry of ListBackups
+type BackupSummary struct {
+	TableName              string  `json:"TableName"`
+	TableId                string  `json:"TableId"`
+	TableArn               string  `json:"TableArn"`
+	BackupArn              string  `json:"BackupArn"`
+	BackupName             string  `json:"BackupName"`
+	BackupCreationDateTime float64 `json:"BackupCreationDateTime"`
+	BackupStatus           string  `json:"BackupStatus"`
+	BackupType             string  `json:"BackupType"`
+	BackupSizeBytes        int64   `json:"BackupSizeBytes"`
+}
+
+// CreateBackupInput is the input for CreateBackup
+type CreateBackupInput struct {
+	TableName  string `json:"TableName"`
+	BackupName string `json:"BackupName"`
+}
+
+// CreateBackupOutput is the output for CreateBackup
+type CreateBackupOutput struct {
+	BackupDetails BackupDetails `json:"BackupDetails"`
+}
+
+// ListBackupsInput is the input for ListBackups
+type ListBackupsInput struct {
+	TableName               string   `json:"TableName,omitempty"`
+	Limit                   *int     `json:"Limit,omitempty"`
+	TimeRangeLowerBound     *float64 `json:"TimeRangeLowerBound,omitempty"`
+	TimeRangeUpperBound     *float64 `json:"TimeRangeUpperBound,omitempty"`
+	ExclusiveStartBackupArn string   `json:"ExclusiveStartBackupArn,omitempty"`
+	BackupType              string   `json:"BackupType,omitempty"`
+}
+
+// ListBackupsOutput is the output for ListBackups
+type ListBackupsOutput struct {
+	BackupSummaries        []BackupSummary `json:"BackupSummaries"`
+	LastEvaluatedBackupArn string          `json:"LastEvaluatedBackupArn,omitempty"`
+}
+
+// BackupArnInput is the input for DescribeBackup and DeleteBackup
+type BackupArnInput struct {
+	BackupArn string `json:"BackupArn"`
+}
+
+// DescribeBackupOutput is the output for DescribeBackup
+type DescribeBackupOutput struct {
+	BackupDescription BackupDescription `json:"BackupDescription"`
+}
+
+// DeleteBackupOutput is the output for DeleteBackup
+type DeleteBackupOutput struct {
+	BackupDescription BackupDescription `json:"BackupDescription"`
+}
+
+// RestoreTableFromBackupInput is the input for RestoreTableFromBackup
+type RestoreTableFromBackupInput struct {
+	TargetTableName               string                 `json:"TargetTableName"`
+	BackupArn                     string                 `json:"BackupArn"`
+	BillingModeOverride           string                 `json:"BillingModeOverride,omitempty"`
+	GlobalSecondaryIndexOverride  []GlobalSecondaryIndex `json:"GlobalSecondaryIndexOverride,omitempty"`
+	LocalSecondaryIndexOverride   []LocalSecondaryIndex  `json:"LocalSecondaryIndexOverride,omitempty"`
+	ProvisionedThroughputOverride *ProvisionedThroughput `json:"ProvisionedThroughputOverride,omitempty"`
+	SSESpecificationOverride      *SSESpecification      `json:"SSESpecificationOverride,omitempty"`
+}
+
+// RestoreTableFromBackupOutput is the output for RestoreTableFromBackup
+type RestoreTableFromBackupOutput struct {
+	TableDescription TableDescription `json:"TableDescription"`
+}
+
+// RestoreTableToPointInTimeInput is the input for RestoreTableToPointInTime
+type RestoreTableToPointInTimeInput struct {
+	SourceTableArn                string                 `json:"SourceTableArn,omitempty"`
+	SourceTableName               string                 `json:"SourceTableName,omitempty"`
+	TargetTableName               string                 `json:"TargetTableName"`
+	UseLatestRestorableTime       bool                   `json:"UseLatestRestorableTime,omitempty"`
+	RestoreDateTime               *float64               `json:"RestoreDateTime,omitempty"`
+	BillingModeOverride           string                 `json:"BillingModeOverride,omitempty"`
+	GlobalSecondaryIndexOverride  []GlobalSecondaryIndex `json:"GlobalSecondaryIndexOverride,omitempty"`
+	LocalSecondaryIndexOverride   []LocalSecondaryIndex  `json:"LocalSecondaryIndexOverride,omitempty"`
+	ProvisionedThroughputOverride *ProvisionedThroughput `json:"ProvisionedThroughputOverride,omitempty"`
+	SSESpecificationOverride      *SSESpecification      `json:"SSESpecificationOverride,omitempty"`
+}
+
+// RestoreTableToPointInTimeOutput is the output for RestoreTableToPointInTime
+type RestoreTableToPointInTimeOutput struct {
+	TableDescription TableDescription `json:"TableDescription"`
+}
+
+// ExportDescription describes a table export
+type ExportDescription struct {
+	ExportArn       string  `json:"ExportArn"`
+	ExportStatus    string  `json:"ExportStatus"`
+	StartTime       float64 `json:"StartTime"`
+	EndTime         float64 `json:"EndTime,omitempty"`
+	ExportManifest  string  `json:"ExportManifest,omitempty"`
+	TableArn        string  `json:"TableArn"`
+	TableId         string  `json:"TableId"`
+	ExportTime      float64 `json:"ExportTime"`
+	ClientToken     string  `json:"ClientToken,omitempty"`
+	S3Bucket        string  `json:"S3Bucket"`
+	S3BucketOwner   string  `json:"S3BucketOwner,omitempty"`
+	S3Prefix        string  `json:"S3Prefix,omitempty"`
+	S3SseAlgorithm  string  `json:"S3SseAlgorithm,omitempty"`
+	S3SseKmsKeyId   string  `json:"S3SseKmsKeyId,omitempty"`
+	FailureCode     string  `json:"FailureCode,omitempty"`
+	FailureMessage  string  `json:"FailureMessage,omitempty"`
+	ExportFormat    string  `json:"ExportFormat"`
+	ExportType      string  `json:"ExportType"`
+	BilledSizeBytes int64   `json:"BilledSizeBytes"`
+	ItemCount       int64   `json:"ItemCount"`
+}
+
+// ExportTableToPointInTimeInput is the input for ExportTableToPointInTime
+type ExportTableToPointInTimeInput struct {
+	TableArn       string   `json:"TableArn"`
+	ExportTime     *float64 `json:"ExportTime,omitempty"`
+	ClientToken    string   `json:"ClientToken,omitempty"`
+	S3Bucket       string   `json:"S3Bucket"`
+	S3BucketOwner  string   `json:"S3BucketOwner,omitempty"`
+	S3Prefix       string   `json:"S3Prefix,omitempty"`
+	S3SseAlgorithm string   `json:"S3SseAlgorithm,omitempty"`
+	S3SseKmsKeyId  string   `json:"S3SseKmsKeyId,omitempty"`
+	ExportFormat   string   `json:"ExportFormat,omitempty"`
+	ExportType     string   `json:"ExportType,omitempty"`
+}
+
+// ExportTableToPointInTimeOutput is the output for ExportTableToPointInTime
+type ExportTableToPointInTimeOutput struct {
+	ExportDescription ExportDescription `json:"ExportDescription"`
+}
+
+// DescribeExportInput is the input for DescribeExport
+type DescribeExportInput struct {
+	ExportArn string `json:"ExportArn"`
+}
+
+// DescribeExportOutput is the output for DescribeExport
+type DescribeExportOutput struct {
+	ExportDescription ExportDescription `json:"ExportDescription"`
+}
+
+// ListExportsInput is the input for ListExports
+type ListExportsInput struct {
+	TableArn   string `json:"TableArn,omitempty"`
+	MaxResults *int   `json:"MaxResults,omitempty"`
+	NextToken  string `json:"NextToken,omitempty"`
+}
+
+// ExportSummary is one entry of ListExports
+type ExportSummary struct {
+	ExportArn    string `json:"ExportArn"`
+	ExportStatus string `json:"ExportStatus"`
+	ExportType   string `json:"ExportType"`
+}
+
+// ListExportsOutput is the output for ListExports
+type ListExportsOutput struct {
+	ExportSummaries []ExportSummary `json:"ExportSummaries"`
+	NextToken       string          `json:"NextToken,omitempty"`
+}
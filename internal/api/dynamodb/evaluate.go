@@ -0,0 +1,591 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//
+// EXPRESSION EVALUATION
+//
+// Conditions evaluate against an item and never fail at runtime: an
+// operand that does not exist or has the wrong type makes the comparison
+// false. Updates apply SET, REMOVE, ADD and DELETE to a copy of the item,
+// evaluating every SET operand against the item as it was before the
+// update, like DynamoDB does.
+//
+
+// getPath resolves a document path in item.
+func getPath(item Item, p docPath) (AttributeValue, bool) {
+	v, ok := item[p[0].name]
+	for _, e := range p[1:] {
+		if !ok {
+			return AttributeValue{}, false
+		}
+		if e.isIndex {
+			if v.L == nil || e.index >= len(v.L) {
+				return AttributeValue{}, false
+			}
+			v = v.L[e.index]
+		} else {
+			if v.M == nil {
+				return AttributeValue{}, false
+			}
+			v, ok = v.M[e.name]
+		}
+	}
+	return v, ok
+}
+
+var errInvalidUpdatePath = errValidation("The document path provided in the update expression is invalid for update")
+
+// setPath writes value at p. Every parent of p must already exist; an
+// index past the end of a list appends.
+func setPath(item Item, p docPath, value AttributeValue) *ddbError {
+	if len(p) == 1 {
+		item[p[0].name] = value
+		return nil
+	}
+	root, ok := item[p[0].name]
+	if !ok {
+		return errInvalidUpdatePath
+	}
+	root, err := setIn(root, p[1:], value)
+	if err != nil {
+		return err
+	}
+	item[p[0].name] = root
+	return nil
+}
+
+func setIn(v AttributeValue, rest docPath, value AttributeValue) (AttributeValue, *ddbError) {
+	e := rest[0]
+	if e.isIndex {
+		if v.L == nil {
+			return v, errInvalidUpdatePath
+		}
+		if len(rest) == 1 {
+			if e.index >= len(v.L) {
+				v.L = append(v.L, value)
+			} else {
+				v.L[e.index] = value
+			}
+			return v, nil
+		}
+		if e.index >= len(v.L) {
+			return v, errInvalidUpdatePath
+		}
+		child, err := setIn(v.L[e.index], rest[1:], value)
+		if err != nil {
+			return v, err
+		}
+		v.L[e.index] = child
+		return v, nil
+	}
+
+	if v.M == nil {
+		return v, errInvalidUpdatePath
+	}
+	if len(rest) == 1 {
+		v.M[e.name] = value
+		return v, nil
+	}
+	child, ok := v.M[e.name]
+	if !ok {
+		return v, errInvalidUpdatePath
+	}
+	child, err := setIn(child, rest[1:], value)
+	if err != nil {
+		return v, err
+	}
+	v.M[e.name] = child
+	return v, nil
+}
+
+// removePath deletes the value at p. Missing paths are ignored.
+func removePath(item Item, p docPath) {
+	if len(p) == 1 {
+		delete(item, p[0].name)
+		return
+	}
+	if root, ok := item[p[0].name]; ok {
+		item[p[0].name] = removeIn(root, p[1:])
+	}
+}
+
+func removeIn(v AttributeValue, rest docPath) AttributeValue {
+	e := rest[0]
+	if e.isIndex {
+		if v.L == nil || e.index >= len(v.L) {
+			return v
+		}
+		if len(rest) == 1 {
+			v.L = append(v.L[:e.index:e.index], v.L[e.index+1:]...)
+			return v
+		}
+		v.L[e.index] = removeIn(v.L[e.index], rest[1:])
+		return v
+	}
+	if v.M == nil {
+		return v
+	}
+	if len(rest) == 1 {
+		delete(v.M, e.name)
+		return v
+	}
+	if child, ok := v.M[e.name]; ok {
+		v.M[e.name] = removeIn(child, rest[1:])
+	}
+	return v
+}
+
+// copyValue returns a deep copy of a value.
+func copyValue(v AttributeValue) AttributeValue {
+	return copyItem(Item{"v": v})["v"]
+}
+
+// eval resolves a condition operand.
+func (o *operand) eval(item Item) (AttributeValue, bool) {
+	switch o.kind {
+	case operandValue:
+		return o.value, true
+	case operandPath:
+		return getPath(item, o.path)
+	case operandFunc:
+		if o.name == "size" {
+			v, ok := o.args[0].eval(item)
+			if !ok {
+				return AttributeValue{}, false
+			}
+			n, ok := valueLength(v)
+			if !ok {
+				return AttributeValue{}, false
+			}
+			return numberValue(strconv.Itoa(n)), true
+		}
+	}
+	return AttributeValue{}, false
+}
+
+// valueLength implements size(): string length, binary length, set,
+// list or map element count.
+func valueLength(v AttributeValue) (int, bool) {
+	switch v.Type() {
+	case "S":
+		return utf8.RuneCountInString(*v.S), true
+	case "B":
+		return len(v.B), true
+	case "SS", "NS", "BS":
+		return len(v.SS) + len(v.NS) + len(v.BS), true
+	case "L":
+		return len(v.L), true
+	case "M":
+		return len(v.M), true
+	}
+	return 0, false
+}
+
+// evalCondition reports whether item satisfies c. A nil item is treated
+// as an item with no attributes.
+func evalCondition(c *condExpr, item Item) bool {
+	switch c.op {
+	case "AND":
+		return evalCondition(c.left, item) && evalCondition(c.right, item)
+	case "OR":
+		return evalCondition(c.left, item) || evalCondition(c.right, item)
+	case "NOT":
+		return !evalCondition(c.left, item)
+	case "=", "<>":
+		a, aok := c.args[0].eval(item)
+		b, bok := c.args[1].eval(item)
+		equal := aok && bok && equalValues(a, b)
+		if c.op == "=" {
+			return equal
+		}
+		return !equal
+	case "<", "<=", ">", ">=":
+		a, aok := c.args[0].eval(item)
+		b, bok := c.args[1].eval(item)
+		if !aok || !bok {
+			return false
+		}
+		cmp, ok := compareValues(a, b)
+		if !ok {
+			return false
+		}
+		switch c.op {
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		}
+		return cmp >= 0
+	case "BETWEEN":
+		v, ok := c.args[0].eval(item)
+		lo, lok := c.args[1].eval(item)
+		hi, hok := c.args[2].eval(item)
+		if !ok || !lok || !hok {
+			return false
+		}
+		c1, ok1 := compareValues(v, lo)
+		c2, ok2 := compareValues(v, hi)
+		return ok1 && ok2 && c1 >= 0 && c2 <= 0
+	case "IN":
+		v, ok := c.args[0].eval(item)
+		if !ok {
+			return false
+		}
+		for _, o := range c.args[1:] {
+			if candidate, ok := o.eval(item); ok && equalValues(v, candidate) {
+				return true
+			}
+		}
+		return false
+	case "FUNC":
+		return evalFunction(c.name, c.args, item)
+	}
+	return false
+}
+
+func evalFunction(fn string, args []*operand, item Item) bool {
+	v, ok := args[0].eval(item)
+	switch fn {
+	case "attribute_exists":
+		return ok
+	case "attribute_not_exists":
+		return !ok
+	}
+	if !ok {
+		return false
+	}
+	arg, argOK := args[1].eval(item)
+	if !argOK {
+		return false
+	}
+	switch fn {
+	case "attribute_type":
+		return arg.S != nil && v.Type() == *arg.S
+	case "begins_with":
+		switch {
+		case v.S != nil && arg.S != nil:
+			return strings.HasPrefix(*v.S, *arg.S)
+		case v.B != nil && arg.B != nil:
+			return bytes.HasPrefix(v.B, arg.B)
+		}
+	case "contains":
+		switch {
+		case v.S != nil && arg.S != nil:
+			return strings.Contains(*v.S, *arg.S)
+		case v.B != nil && arg.B != nil:
+			return bytes.Contains(v.B, arg.B)
+		case isSetType(v.Type()):
+			for _, m := range setMembers(v) {
+				if equalValues(m, arg) {
+					return true
+				}
+			}
+		case v.L != nil:
+			for _, e := range v.L {
+				if equalValues(e, arg) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// checkCondition returns ConditionalCheckFailedException when the current
+// item (nil if absent) does not satisfy cond.
+func checkCondition(cond *condExpr, current Item, onFailure string) *ddbError {
+	if cond == nil || evalCondition(cond, current) {
+		return nil
+	}
+	e := &ddbError{Type: "ConditionalCheckFailedException", Message: "The conditional request failed"}
+	if onFailure == "ALL_OLD" && current != nil {
+		e.Item = current
+	}
+	return e
+}
+
+var errOperandType = errValidation("An operand in the update expression has an incorrect data type")
+
+// evalSetValue resolves the right-hand side of a SET action.
+func evalSetValue(o *operand, item Item) (AttributeValue, *ddbError) {
+	switch o.kind {
+	case operandValue:
+		return o.value, nil
+	case operandPath:
+		v, ok := getPath(item, o.path)
+		if !ok {
+			return AttributeValue{}, errValidation("The provided expression refers to an attribute that does not exist in the item")
+		}
+		return v, nil
+	case operandArith:
+		a, err := evalSetValue(o.args[0], item)
+		if err != nil {
+			return a, err
+		}
+		b, err := evalSetValue(o.args[1], item)
+		if err != nil {
+			return b, err
+		}
+		if a.N == nil || b.N == nil {
+			return AttributeValue{}, errOperandType
+		}
+		var (
+			out    AttributeValue
+			numErr error
+		)
+		if o.name == "+" {
+			out, numErr = addNumbers(a, b)
+		} else {
+			out, numErr = subtractNumbers(a, b)
+		}
+		if numErr != nil {
+			return out, errValidation(numErr.Error())
+		}
+		return out, nil
+	case operandFunc:
+		switch o.name {
+		case "if_not_exists":
+			if v, ok := getPath(item, o.args[0].path); ok {
+				return v, nil
+			}
+			return evalSetValue(o.args[1], item)
+		case "list_append":
+			a, err := evalSetValue(o.args[0], item)
+			if err != nil {
+				return a, err
+			}
+			b, err := evalSetValue(o.args[1], item)
+			if err != nil {
+				return b, err
+			}
+			if a.L == nil || b.L == nil {
+				return AttributeValue{}, errValidation("Invalid UpdateExpression: Incorrect operand type for operator or function; " +
+					"operator or function: list_append, operand type: " + typeName(firstNonList(a, b).Type()))
+			}
+			return AttributeValue{L: append(append([]AttributeValue{}, a.L...), b.L...)}, nil
+		}
+	}
+	return AttributeValue{}, errOperandType
+}
+
+func firstNonList(a, b AttributeValue) AttributeValue {
+	if a.L == nil {
+		return a
+	}
+	return b
+}
+
+// applyUpdate applies u to item in place. keys are the primary key
+// attribute names, which an update may not touch.
+func applyUpdate(u *updateExpr, item Item, keys ...string) *ddbError {
+	for _, p := range u.paths() {
+		for _, k := range keys {
+			if k != "" && p[0].name == k {
+				return errValidation("One or more parameter values were invalid: Cannot update attribute " + k +
+					". This attribute is part of the key")
+			}
+		}
+	}
+
+	before := copyItem(item)
+
+	// Resolve every SET operand before anything is written.
+	values := make([]AttributeValue, len(u.set))
+	for i, a := range u.set {
+		v, err := evalSetValue(a.value, before)
+		if err != nil {
+			return err
+		}
+		values[i] = copyValue(v)
+	}
+	for i, a := range u.set {
+		if err := setPath(item, a.path, values[i]); err != nil {
+			return err
+		}
+	}
+
+	// Remove list elements from the highest index down so earlier
+	// removals do not shift later ones.
+	removes := append([]updateAction{}, u.remove...)
+	sort.SliceStable(removes, func(i, j int) bool {
+		return comparePaths(removes[i].path, removes[j].path) > 0
+	})
+	for _, a := range removes {
+		removePath(item, a.path)
+	}
+
+	for _, a := range u.add {
+		value := a.value.value
+		typ := value.Type()
+		if typ != "N" && !isSetType(typ) {
+			return errValidation("Invalid UpdateExpression: Incorrect operand type for operator or function; " +
+				"operator: ADD, operand type: " + typeName(typ))
+		}
+		current, exists := getPath(item, a.path)
+		if !exists {
+			if err := setPath(item, a.path, copyValue(value)); err != nil {
+				return err
+			}
+			continue
+		}
+		if current.Type() != typ {
+			return errOperandType
+		}
+		next := setUnion(current, value)
+		if typ == "N" {
+			sum, err := addNumbers(current, value)
+			if err != nil {
+				return errValidation(err.Error())
+			}
+			next = sum
+		}
+		if err := setPath(item, a.path, next); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range u.del {
+		value := a.value.value
+		if !isSetType(value.Type()) {
+			return errValidation("Invalid UpdateExpression: Incorrect operand type for operator or function; " +
+				"operator: DELETE, operand type: " + typeName(value.Type()))
+		}
+		current, exists := getPath(item, a.path)
+		if !exists {
+			continue
+		}
+		if current.Type() != value.Type() {
+			return errOperandType
+		}
+		if rest, ok := setDifference(current, value); ok {
+			if err := setPath(item, a.path, rest); err != nil {
+				return err
+			}
+		} else {
+			removePath(item, a.path)
+		}
+	}
+	return nil
+}
+
+// comparePaths orders paths element by element, list indexes numerically.
+func comparePaths(a, b docPath) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, y := a[i], b[i]
+		switch {
+		case x.isIndex && y.isIndex:
+			if x.index != y.index {
+				return x.index - y.index
+			}
+		case x.isIndex != y.isIndex:
+			if x.isIndex {
+				return -1
+			}
+			return 1
+		default:
+			if c := strings.Compare(x.name, y.name); c != 0 {
+				return c
+			}
+		}
+	}
+	return len(a) - len(b)
+}
+
+// projectPaths returns the parts of item selected by paths. Selected list
+// elements keep their order but are packed together, as in DynamoDB.
+func projectPaths(item Item, paths []docPath) Item {
+	if item == nil || paths == nil {
+		return item
+	}
+	root := &projectionNode{}
+	for _, p := range paths {
+		v, ok := getPath(item, p)
+		if !ok {
+			continue
+		}
+		n := root
+		for _, e := range p {
+			n = n.child(e)
+		}
+		v = copyValue(v)
+		n.leaf = &v
+	}
+	out := Item{}
+	for name, n := range root.fields {
+		out[name] = n.build()
+	}
+	return out
+}
+
+type projectionNode struct {
+	leaf   *AttributeValue
+	fields map[string]*projectionNode
+	elems  map[int]*projectionNode
+}
+
+func (n *projectionNode) child(e pathElem) *projectionNode {
+	if e.isIndex {
+		if n.elems == nil {
+			n.elems = map[int]*projectionNode{}
+		}
+		if n.elems[e.index] == nil {
+			n.elems[e.index] = &projectionNode{}
+		}
+		return n.elems[e.index]
+	}
+	if n.fields == nil {
+		n.fields = map[string]*projectionNode{}
+	}
+	if n.fields[e.name] == nil {
+		n.fields[e.name] = &projectionNode{}
+	}
+	return n.fields[e.name]
+}
+
+func (n *projectionNode) build() AttributeValue {
+	if n.leaf != nil {
+		return *n.leaf
+	}
+	if n.elems != nil {
+		idx := make([]int, 0, len(n.elems))
+		for i := range n.elems {
+			idx = append(idx, i)
+		}
+		sort.Ints(idx)
+		out := []AttributeValue{}
+		for _, i := range idx {
+			out = append(out, n.elems[i].build())
+		}
+		return AttributeValue{L: out}
+	}
+	out := map[string]AttributeValue{}
+	for name, c := range n.fields {
+		out[name] = c.build()
+	}
+	return AttributeValue{M: out}
+}
+
+// topLevelPaths turns attribute names into single-element paths.
+func topLevelPaths(names []string) []docPath {
+	if names == nil {
+		return nil
+	}
+	out := make([]docPath, len(names))
+	for i, n := range names {
+		out[i] = docPath{{name: n}}
+	}
+	return out
+}
@@ -0,0 +1,319 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"opensnack/internal/api/s3"
+	"opensnack/internal/awsresponses"
+	"opensnack/internal/resource"
+	"opensnack/internal/util"
+)
+
+//
+// TABLE EXPORTS
+//
+// ExportTableToPointInTime writes the table as it was at ExportTime into
+// an opensnack S3 bucket, laid out the way DynamoDB does it:
+//
+//	<prefix>/AWSDynamoDB/<export id>/manifest-summary.json
+//	<prefix>/AWSDynamoDB/<export id>/manifest-files.json
+//	<prefix>/AWSDynamoDB/<export id>/data/<hex>.json.gz
+//
+// Exports run synchronously, so they are COMPLETED (or FAILED) by the
+// time the call returns. Each is a dynamodb/"export" resource keyed by
+// its ARN.
+//
+
+const exportManifestVersion = "2020-06-30"
+
+// writeExport writes the data file and manifests of an export.
+func (h *Handler) writeExport(ctx context.Context, ns string, desc *ExportDescription, items []Item) error {
+	id := path.Base(desc.ExportArn)
+	base := path.Join(desc.S3Prefix, "AWSDynamoDB", id)
+
+	var raw bytes.Buffer
+	gz := gzip.NewWriter(&raw)
+	enc := json.NewEncoder(gz)
+	var size int64
+	for _, item := range items {
+		if err := enc.Encode(map[string]Item{"Item": item}); err != nil {
+			return err
+		}
+		size += int64(itemSize(item))
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	dataKey := path.Join(base, "data", util.RandomHex(13)+".json.gz")
+	etag, err := h.Objects.WriteObject(ctx, ns, desc.S3Bucket, dataKey, raw.Bytes())
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(raw.Bytes())
+
+	files, err := json.Marshal(map[string]any{
+		"itemCount":     len(items),
+		"md5":           base64.StdEncoding.EncodeToString(sum[:]),
+		"etag":          etag,
+		"dataFileS3Key": dataKey,
+	})
+	if err != nil {
+		return err
+	}
+	filesKey := path.Join(base, "manifest-files.json")
+	if _, err := h.Objects.WriteObject(ctx, ns, desc.S3Bucket, filesKey, append(files, '\n')); err != nil {
+		return err
+	}
+
+	desc.EndTime = epochSeconds(time.Now())
+	desc.ItemCount = int64(len(items))
+	desc.BilledSizeBytes = size
+	desc.ExportManifest = path.Join(base, "manifest-summary.json")
+
+	summary, err := json.Marshal(map[string]any{
+		"version":            exportManifestVersion,
+		"exportArn":          desc.ExportArn,
+		"startTime":          fromEpochSeconds(desc.StartTime).UTC().Format(time.RFC3339Nano),
+		"endTime":            fromEpochSeconds(desc.EndTime).UTC().Format(time.RFC3339Nano),
+		"tableArn":           desc.TableArn,
+		"tableId":            desc.TableId,
+		"exportTime":         fromEpochSeconds(desc.ExportTime).UTC().Format(time.RFC3339Nano),
+		"s3Bucket":           desc.S3Bucket,
+		"s3Prefix":           desc.S3Prefix,
+		"s3SseAlgorithm":     desc.S3SseAlgorithm,
+		"s3SseKmsKeyId":      desc.S3SseKmsKeyId,
+		"manifestFilesS3Key": filesKey,
+		"billedSizeBytes":    size,
+		"itemCount":          len(items),
+		"outputFormat":       desc.ExportFormat,
+		"exportType":         desc.ExportType,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = h.Objects.WriteObject(ctx, ns, desc.S3Bucket, desc.ExportManifest, summary)
+	return err
+}
+
+// loadExports returns every stored export.
+func (h *Handler) loadExports(ctx context.Context, ns string) ([]ExportDescription, error) {
+	resources, err := h.Store.List(ctx, "dynamodb", "export", ns)
+	if err != nil {
+		return nil, err
+	}
+	var out []ExportDescription
+	for _, res := range resources {
+		var desc ExportDescription
+		if json.Unmarshal(res.Attributes, &desc) == nil {
+			out = append(out, desc)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ExportArn < out[j].ExportArn })
+	return out, nil
+}
+
+// ExportTableToPointInTime exports a table to an S3 bucket
+func (h *Handler) ExportTableToPointInTime(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req ExportTableToPointInTimeInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if req.TableArn == "" || req.S3Bucket == "" {
+		writeError(w, errValidation("TableArn and S3Bucket are required"))
+		return
+	}
+	if req.ExportFormat == "" {
+		req.ExportFormat = "DYNAMODB_JSON"
+	}
+	if req.ExportType == "" {
+		req.ExportType = "FULL_EXPORT"
+	}
+	if req.ExportFormat != "DYNAMODB_JSON" {
+		writeError(w, errValidation("ExportFormat "+req.ExportFormat+" is not supported; only DYNAMODB_JSON is"))
+		return
+	}
+	if req.ExportType != "FULL_EXPORT" {
+		writeError(w, errValidation("ExportType "+req.ExportType+" is not supported; only FULL_EXPORT is"))
+		return
+	}
+
+	defer h.lockTables(ns, false, req.TableArn)()
+
+	td, derr := h.loadTable(r.Context(), ns, req.TableArn)
+	if derr != nil {
+		if derr.Type == "ResourceNotFoundException" {
+			derr = &ddbError{Type: "TableNotFoundException", Message: "Table not found: " + extractTableName(req.TableArn)}
+		}
+		writeError(w, derr)
+		return
+	}
+
+	if req.ClientToken != "" {
+		exports, err := h.loadExports(r.Context(), ns)
+		if err != nil {
+			writeError(w, errInternal(err))
+			return
+		}
+		for _, prev := range exports {
+			if prev.ClientToken != req.ClientToken {
+				continue
+			}
+			if prev.TableArn != td.TableArn || prev.S3Bucket != req.S3Bucket || prev.S3Prefix != req.S3Prefix {
+				writeError(w, &ddbError{Type: "ExportConflictException",
+					Message: "There was a conflict when writing to the specified S3 bucket with ClientToken " + req.ClientToken})
+				return
+			}
+			awsresponses.WriteJSON(w, http.StatusOK, ExportTableToPointInTimeOutput{ExportDescription: prev})
+			return
+		}
+	}
+
+	earliest, latest, ok := h.restorableWindow(r.Context(), ns, td.TableName)
+	if !ok {
+		writeError(w, &ddbError{Type: "PointInTimeRecoveryUnavailableException",
+			Message: "Point in time recovery is not enabled for table '" + td.TableName + "'"})
+		return
+	}
+	at := latest
+	if req.ExportTime != nil {
+		at = fromEpochSeconds(*req.ExportTime)
+		if at.Before(earliest) || at.After(latest) {
+			writeError(w, &ddbError{Type: "InvalidExportTimeException", Message: fmt.Sprintf(
+				"Export time must be between %s and %s", earliest.UTC().Format(time.RFC3339), latest.UTC().Format(time.RFC3339))})
+			return
+		}
+	}
+
+	now := time.Now()
+	desc := ExportDescription{
+		ExportArn:      fmt.Sprintf("%s/export/%013d-%s", td.TableArn, now.UnixMilli(), util.RandomHex(4)),
+		ExportStatus:   "COMPLETED",
+		StartTime:      epochSeconds(now),
+		TableArn:       td.TableArn,
+		TableId:        td.TableId,
+		ExportTime:     epochSeconds(at),
+		ClientToken:    req.ClientToken,
+		S3Bucket:       req.S3Bucket,
+		S3BucketOwner:  req.S3BucketOwner,
+		S3Prefix:       req.S3Prefix,
+		S3SseAlgorithm: req.S3SseAlgorithm,
+		S3SseKmsKeyId:  req.S3SseKmsKeyId,
+		ExportFormat:   req.ExportFormat,
+		ExportType:     req.ExportType,
+	}
+
+	items, derr := h.itemsAt(r.Context(), ns, td.TableName, at)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if err := h.writeExport(r.Context(), ns, &desc, items); err != nil {
+		desc.ExportStatus = "FAILED"
+		desc.EndTime = epochSeconds(time.Now())
+		desc.FailureCode = "S3WriteFailed"
+		if errors.Is(err, s3.ErrNoSuchBucket) {
+			desc.FailureCode = "S3NoSuchBucket"
+		}
+		desc.FailureMessage = err.Error()
+	}
+
+	buf, err := json.Marshal(desc)
+	if err != nil {
+		writeError(w, errInternal(err))
+		return
+	}
+	if err := h.Store.Create(r.Context(), &resource.Resource{ID: desc.ExportArn, Namespace: ns, Service: "dynamodb", Type: "export", Attributes: buf}); err != nil {
+		writeError(w, errInternal(err))
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, ExportTableToPointInTimeOutput{ExportDescription: desc})
+}
+
+// DescribeExport describes one export
+func (h *Handler) DescribeExport(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req DescribeExportInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	res, err := h.Store.Get(r.Context(), req.ExportArn, "dynamodb", "export", ns)
+	if err != nil {
+		writeError(w, &ddbError{Type: "ExportNotFoundException", Message: "Export not found: " + req.ExportArn})
+		return
+	}
+	var desc ExportDescription
+	if err := json.Unmarshal(res.Attributes, &desc); err != nil {
+		writeError(w, errInternal(err))
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, DescribeExportOutput{ExportDescription: desc})
+}
+
+// ListExports lists exports, optionally for one table
+func (h *Handler) ListExports(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req ListExportsInput
+	if r.ContentLength != 0 {
+		if derr := decodeInput(r, &req); derr != nil {
+			writeError(w, derr)
+			return
+		}
+	}
+	limit := 25
+	if req.MaxResults != nil {
+		if *req.MaxResults < 1 || *req.MaxResults > 25 {
+			writeError(w, errValidation("1 validation error detected: Value '"+strconv.Itoa(*req.MaxResults)+
+				"' at 'maxResults' failed to satisfy constraint: Member must have value between 1 and 25"))
+			return
+		}
+		limit = *req.MaxResults
+	}
+
+	exports, err := h.loadExports(r.Context(), ns)
+	if err != nil {
+		writeError(w, errInternal(err))
+		return
+	}
+	summaries := []ExportSummary{}
+	for _, desc := range exports {
+		if req.TableArn != "" && desc.TableArn != req.TableArn {
+			continue
+		}
+		if req.NextToken != "" && desc.ExportArn <= req.NextToken {
+			continue
+		}
+		summaries = append(summaries, ExportSummary{ExportArn: desc.ExportArn, ExportStatus: desc.ExportStatus, ExportType: desc.ExportType})
+	}
+	out := ListExportsOutput{ExportSummaries: summaries}
+	if len(summaries) > limit {
+		out.ExportSummaries = summaries[:limit]
+		out.NextToken = summaries[limit-1].ExportArn
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, out)
+}
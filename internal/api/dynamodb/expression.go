@@ -0,0 +1,847 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//
+// EXPRESSIONS
+//
+// ConditionExpression, UpdateExpression, ProjectionExpression (and later
+// KeyConditionExpression and FilterExpression) share one lexer and parser.
+// Parsing resolves ExpressionAttributeNames and ExpressionAttributeValues
+// up front and records which placeholders were used, so unused ones can be
+// rejected the way DynamoDB does.
+//
+
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokIdent            // attribute name, keyword or function name
+	tokName             // #placeholder
+	tokValue            // :placeholder
+	tokNumber           // list index
+	tokPunct            // = <> < <= > >= ( ) , . [ ] + -
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// pathElem is one step of a document path: a map key or a list index.
+type pathElem struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+// docPath is a document path such as a.b[2].c. The first element is
+// always a top-level attribute name.
+type docPath []pathElem
+
+func (p docPath) String() string {
+	var b strings.Builder
+	for i, e := range p {
+		switch {
+		case e.isIndex:
+			b.WriteString("[" + strconv.Itoa(e.index) + "]")
+		case i > 0:
+			b.WriteString("." + e.name)
+		default:
+			b.WriteString(e.name)
+		}
+	}
+	return b.String()
+}
+
+const (
+	operandPath = iota
+	operandValue
+	operandFunc
+	operandArith
+)
+
+// operand is a path, a placeholder value, a function call (size,
+// if_not_exists, list_append) or an arithmetic SET operand.
+type operand struct {
+	kind  int
+	path  docPath
+	value AttributeValue
+	name  string // function name, or "+"/"-" for arithmetic
+	args  []*operand
+}
+
+// condExpr is a node of a condition: AND, OR, NOT, a comparator,
+// BETWEEN, IN, or FUNC for attribute_exists and friends.
+type condExpr struct {
+	op          string
+	name        string
+	left, right *condExpr
+	args        []*operand
+}
+
+// updateAction is one SET, REMOVE, ADD or DELETE action.
+type updateAction struct {
+	path  docPath
+	value *operand
+}
+
+type updateExpr struct {
+	set, remove, add, del []updateAction
+}
+
+// paths returns every path the update writes to.
+func (u *updateExpr) paths() []docPath {
+	var out []docPath
+	for _, list := range [][]updateAction{u.set, u.remove, u.add, u.del} {
+		for _, a := range list {
+			out = append(out, a.path)
+		}
+	}
+	return out
+}
+
+// exprContext holds the placeholders of a request.
+type exprContext struct {
+	names      map[string]string
+	values     Item
+	usedNames  map[string]bool
+	usedValues map[string]bool
+}
+
+func newExprContext(names map[string]string, values Item) (*exprContext, *ddbError) {
+	if names != nil && len(names) == 0 {
+		return nil, errValidation("ExpressionAttributeNames must not be empty")
+	}
+	if values != nil && len(values) == 0 {
+		return nil, errValidation("ExpressionAttributeValues must not be empty")
+	}
+	for _, k := range sortedNames(values) {
+		if err := validateValue(values[k]); err != nil {
+			return nil, errValidation("ExpressionAttributeValues contains invalid value: " + err.Error() + " for key " + k)
+		}
+	}
+	return &exprContext{
+		names:      names,
+		values:     normalizeItem(values),
+		usedNames:  map[string]bool{},
+		usedValues: map[string]bool{},
+	}, nil
+}
+
+// checkUnused rejects placeholders that no expression referred to.
+func (c *exprContext) checkUnused() *ddbError {
+	var names, values []string
+	for k := range c.names {
+		if !c.usedNames[k] {
+			names = append(names, k)
+		}
+	}
+	for k := range c.values {
+		if !c.usedValues[k] {
+			values = append(values, k)
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(values)
+	if len(names) > 0 {
+		return errValidation("Value provided in ExpressionAttributeNames unused in expressions: keys: {" + strings.Join(names, ", ") + "}")
+	}
+	if len(values) > 0 {
+		return errValidation("Value provided in ExpressionAttributeValues unused in expressions: keys: {" + strings.Join(values, ", ") + "}")
+	}
+	return nil
+}
+
+// condition parses a condition expression. An empty expression yields nil.
+func (c *exprContext) condition(kind, expr string) (*condExpr, *ddbError) {
+	if expr == "" {
+		return nil, nil
+	}
+	p, err := c.parser(kind, expr)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return cond, nil
+}
+
+// update parses an UpdateExpression.
+func (c *exprContext) update(expr string) (*updateExpr, *ddbError) {
+	p, err := c.parser("UpdateExpression", expr)
+	if err != nil {
+		return nil, err
+	}
+	u, err := p.parseUpdate()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOverlap("UpdateExpression", u.paths()); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// projection parses a ProjectionExpression. An empty expression yields nil.
+func (c *exprContext) projection(expr string) ([]docPath, *ddbError) {
+	if expr == "" {
+		return nil, nil
+	}
+	p, err := c.parser("ProjectionExpression", expr)
+	if err != nil {
+		return nil, err
+	}
+	var paths []docPath
+	for {
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	if err := checkOverlap("ProjectionExpression", paths); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// checkOverlap rejects two paths where one is a prefix of the other.
+func checkOverlap(kind string, paths []docPath) *ddbError {
+	for i := range paths {
+		for j := i + 1; j < len(paths); j++ {
+			a, b := paths[i], paths[j]
+			n := len(a)
+			if len(b) < n {
+				n = len(b)
+			}
+			same := true
+			for k := 0; k < n; k++ {
+				if a[k] != b[k] {
+					same = false
+					break
+				}
+			}
+			if same {
+				return errValidation("Invalid " + kind + ": Two document paths overlap with each other; " +
+					"must remove or rewrite one of these paths; path one: [" + a.String() + "], path two: [" + b.String() + "]")
+			}
+		}
+	}
+	return nil
+}
+
+//
+// LEXER
+//
+
+func lex(kind, expr string) ([]token, *ddbError) {
+	var toks []token
+	isWord := func(c byte) bool {
+		return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+	}
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#' || c == ':':
+			j := i + 1
+			for j < len(expr) && isWord(expr[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, syntaxError(kind, string(c), expr[i:])
+			}
+			k := tokName
+			if c == ':' {
+				k = tokValue
+			}
+			toks = append(toks, token{k, expr[i:j]})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(expr) && expr[j] >= '0' && expr[j] <= '9' {
+				j++
+			}
+			toks = append(toks, token{tokNumber, expr[i:j]})
+			i = j
+		case isWord(c):
+			j := i
+			for j < len(expr) && isWord(expr[j]) {
+				j++
+			}
+			toks = append(toks, token{tokIdent, expr[i:j]})
+			i = j
+		case c == '<' && i+1 < len(expr) && (expr[i+1] == '>' || expr[i+1] == '='):
+			toks = append(toks, token{tokPunct, expr[i : i+2]})
+			i += 2
+		case c == '>' && i+1 < len(expr) && expr[i+1] == '=':
+			toks = append(toks, token{tokPunct, ">="})
+			i += 2
+		case strings.IndexByte("=<>(),.[]+-", c) >= 0:
+			toks = append(toks, token{tokPunct, string(c)})
+			i++
+		default:
+			return nil, syntaxError(kind, string(c), expr[i:])
+		}
+	}
+	return append(toks, token{tokEOF, "<EOF>"}), nil
+}
+
+func syntaxError(kind, tok, near string) *ddbError {
+	if len(near) > 20 {
+		near = near[:20]
+	}
+	return errValidation(fmt.Sprintf("Invalid %s: Syntax error; token: \"%s\", near: \"%s\"", kind, tok, near))
+}
+
+//
+// PARSER
+//
+
+type exprParser struct {
+	kind string
+	toks []token
+	pos  int
+	ctx  *exprContext
+}
+
+// keywords cannot be used as bare attribute names.
+var keywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "BETWEEN": true, "IN": true,
+	"SET": true, "REMOVE": true, "ADD": true, "DELETE": true,
+}
+
+func (c *exprContext) parser(kind, expr string) (*exprParser, *ddbError) {
+	toks, err := lex(kind, expr)
+	if err != nil {
+		return nil, err
+	}
+	return &exprParser{kind: kind, toks: toks, ctx: c}, nil
+}
+
+func (p *exprParser) peek() token { return p.toks[p.pos] }
+
+func (p *exprParser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) isKeyword(word string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, word)
+}
+
+func (p *exprParser) accept(punct string) bool {
+	if t := p.peek(); t.kind == tokPunct && t.text == punct {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) errorAt() *ddbError {
+	t := p.peek()
+	near := t.text
+	if p.pos+1 < len(p.toks) && p.toks[p.pos+1].kind != tokEOF {
+		near += " " + p.toks[p.pos+1].text
+	}
+	if p.pos > 0 {
+		near = p.toks[p.pos-1].text + " " + near
+	}
+	return syntaxError(p.kind, t.text, near)
+}
+
+func (p *exprParser) expect(punct string) *ddbError {
+	if !p.accept(punct) {
+		return p.errorAt()
+	}
+	return nil
+}
+
+func (p *exprParser) expectEOF() *ddbError {
+	if p.peek().kind != tokEOF {
+		return p.errorAt()
+	}
+	return nil
+}
+
+// isCall reports whether the next tokens are a function call.
+func (p *exprParser) isCall() bool {
+	return p.peek().kind == tokIdent && p.toks[p.pos+1].kind == tokPunct && p.toks[p.pos+1].text == "("
+}
+
+func (p *exprParser) attributeName() (string, *ddbError) {
+	t := p.peek()
+	switch t.kind {
+	case tokIdent:
+		if keywords[strings.ToUpper(t.text)] {
+			return "", p.errorAt()
+		}
+		p.next()
+		return t.text, nil
+	case tokName:
+		p.next()
+		name, ok := p.ctx.names[t.text]
+		if !ok {
+			return "", errValidation("Invalid " + p.kind + ": An expression attribute name used in the document path is not defined; attribute name: " + t.text)
+		}
+		p.ctx.usedNames[t.text] = true
+		return name, nil
+	}
+	return "", p.errorAt()
+}
+
+func (p *exprParser) parsePath() (docPath, *ddbError) {
+	name, err := p.attributeName()
+	if err != nil {
+		return nil, err
+	}
+	path := docPath{{name: name}}
+	for {
+		switch {
+		case p.accept("."):
+			name, err := p.attributeName()
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, pathElem{name: name})
+		case p.accept("["):
+			t := p.peek()
+			if t.kind != tokNumber {
+				return nil, p.errorAt()
+			}
+			p.next()
+			n, convErr := strconv.Atoi(t.text)
+			if convErr != nil {
+				return nil, errValidation("Invalid " + p.kind + ": List index is too large; index: " + t.text)
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			path = append(path, pathElem{index: n, isIndex: true})
+		default:
+			return path, nil
+		}
+	}
+}
+
+func (p *exprParser) parseValue() (*operand, *ddbError) {
+	t := p.next()
+	v, ok := p.ctx.values[t.text]
+	if !ok {
+		return nil, errValidation("Invalid " + p.kind + ": An expression attribute value used in expression is not defined; attribute value: " + t.text)
+	}
+	p.ctx.usedValues[t.text] = true
+	return &operand{kind: operandValue, value: v}, nil
+}
+
+// parseArgs parses "( operand, ... )" using parse for each argument.
+func (p *exprParser) parseArgs(fn string, want int, parse func() (*operand, *ddbError)) ([]*operand, *ddbError) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []*operand
+	for {
+		arg, err := parse()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if len(args) != want {
+		return nil, errValidation(fmt.Sprintf("Invalid %s: Incorrect number of operands for operator or function; "+
+			"operator or function: %s, number of operands: %d", p.kind, fn, len(args)))
+	}
+	return args, nil
+}
+
+func (p *exprParser) functionError(msg, fn string) *ddbError {
+	return errValidation("Invalid " + p.kind + ": " + msg + "; function: " + fn)
+}
+
+// conditionFunctions maps the functions usable as conditions to their arity.
+var conditionFunctions = map[string]int{
+	"attribute_exists":     1,
+	"attribute_not_exists": 1,
+	"attribute_type":       2,
+	"begins_with":          2,
+	"contains":             2,
+}
+
+// parseOperand parses an operand of a condition: a path, a value or size().
+func (p *exprParser) parseOperand() (*operand, *ddbError) {
+	t := p.peek()
+	switch {
+	case t.kind == tokValue:
+		return p.parseValue()
+	case p.isCall():
+		fn := t.text
+		if fn != "size" {
+			if _, ok := conditionFunctions[fn]; ok {
+				return nil, p.functionError("The function is not allowed to be used this way in an expression", fn)
+			}
+			if fn == "if_not_exists" || fn == "list_append" {
+				return nil, p.functionError("The function is not allowed in a condition expression", fn)
+			}
+			return nil, p.functionError("Invalid function name", fn)
+		}
+		p.next()
+		args, err := p.parseArgs(fn, 1, p.parsePathOperand)
+		if err != nil {
+			return nil, err
+		}
+		return &operand{kind: operandFunc, name: fn, args: args}, nil
+	case t.kind == tokIdent || t.kind == tokName:
+		return p.parsePathOperand()
+	}
+	return nil, p.errorAt()
+}
+
+func (p *exprParser) parsePathOperand() (*operand, *ddbError) {
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return &operand{kind: operandPath, path: path}, nil
+}
+
+func (p *exprParser) parseOr() (*condExpr, *ddbError) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &condExpr{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (*condExpr, *ddbError) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &condExpr{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (*condExpr, *ddbError) {
+	if p.isKeyword("NOT") {
+		p.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &condExpr{op: "NOT", left: inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (*condExpr, *ddbError) {
+	if p.accept("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+
+	if p.isCall() {
+		fn := p.peek().text
+		if arity, ok := conditionFunctions[fn]; ok {
+			p.next()
+			args, err := p.parseArgs(fn, arity, p.parseOperand)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.checkFunctionArgs(fn, args); err != nil {
+				return nil, err
+			}
+			return &condExpr{op: "FUNC", name: fn, args: args}, nil
+		}
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	switch {
+	case t.kind == tokPunct && (t.text == "=" || t.text == "<>" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="):
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &condExpr{op: t.text, args: []*operand{left, right}}, nil
+
+	case p.isKeyword("BETWEEN"):
+		p.next()
+		lo, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isKeyword("AND") {
+			return nil, p.errorAt()
+		}
+		p.next()
+		hi, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if lo.kind == operandValue && hi.kind == operandValue {
+			if c, ok := compareValues(lo.value, hi.value); ok && c > 0 {
+				return nil, errValidation("Invalid " + p.kind + ": The BETWEEN operator requires upper bound to be greater than or equal to lower bound; " +
+					"lower bound operand: AttributeValue: {" + lo.value.Type() + ":" + scalarString(lo.value) + "}, " +
+					"upper bound operand: AttributeValue: {" + hi.value.Type() + ":" + scalarString(hi.value) + "}")
+			}
+		}
+		return &condExpr{op: "BETWEEN", args: []*operand{left, lo, hi}}, nil
+
+	case p.isKeyword("IN"):
+		p.next()
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		args := []*operand{left}
+		for {
+			v, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		if len(args) > 101 {
+			return nil, errValidation("Invalid " + p.kind + ": The expression contains too many operands for the IN operator; the maximum is 100")
+		}
+		return &condExpr{op: "IN", args: args}, nil
+	}
+	return nil, p.errorAt()
+}
+
+// validTypeNames are the values attribute_type accepts.
+var validTypeNames = map[string]bool{
+	"S": true, "N": true, "B": true, "SS": true, "NS": true, "BS": true,
+	"BOOL": true, "NULL": true, "L": true, "M": true,
+}
+
+func (p *exprParser) checkFunctionArgs(fn string, args []*operand) *ddbError {
+	switch fn {
+	case "attribute_exists", "attribute_not_exists", "attribute_type":
+		if args[0].kind != operandPath {
+			return errValidation("Invalid " + p.kind + ": Operator or function requires a document path; operator or function: " + fn)
+		}
+	}
+	if fn == "attribute_type" {
+		t := args[1]
+		if t.kind != operandValue || t.value.S == nil || !validTypeNames[*t.value.S] {
+			return errValidation("Invalid " + p.kind + ": Invalid attribute type name found; type: " + scalarString(t.value) +
+				", valid types: {B,NULL,SS,BOOL,L,BS,N,NS,S,M}")
+		}
+	}
+	if fn == "begins_with" && args[1].kind == operandValue {
+		if typ := args[1].value.Type(); typ != "S" && typ != "B" {
+			return errValidation("Invalid " + p.kind + ": Incorrect operand type for operator or function; operator or function: begins_with, operand type: " + typeName(typ))
+		}
+	}
+	return nil
+}
+
+// parseUpdate parses "SET ... REMOVE ... ADD ... DELETE ..." clauses.
+func (p *exprParser) parseUpdate() (*updateExpr, *ddbError) {
+	u := &updateExpr{}
+	seen := map[string]bool{}
+	if p.peek().kind == tokEOF {
+		return nil, errValidation("Invalid UpdateExpression: The expression can not be empty;")
+	}
+	for p.peek().kind != tokEOF {
+		t := p.peek()
+		clause := strings.ToUpper(t.text)
+		if t.kind != tokIdent || (clause != "SET" && clause != "REMOVE" && clause != "ADD" && clause != "DELETE") {
+			return nil, p.errorAt()
+		}
+		if seen[clause] {
+			return nil, errValidation("Invalid UpdateExpression: The \"" + clause + "\" section can only be used once in an update expression;")
+		}
+		seen[clause] = true
+		p.next()
+
+		for {
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			action := updateAction{path: path}
+			switch clause {
+			case "SET":
+				if err := p.expect("="); err != nil {
+					return nil, err
+				}
+				if action.value, err = p.parseSetValue(); err != nil {
+					return nil, err
+				}
+				u.set = append(u.set, action)
+			case "REMOVE":
+				u.remove = append(u.remove, action)
+			case "ADD", "DELETE":
+				if p.peek().kind != tokValue {
+					return nil, p.errorAt()
+				}
+				if action.value, err = p.parseValue(); err != nil {
+					return nil, err
+				}
+				if clause == "ADD" {
+					u.add = append(u.add, action)
+				} else {
+					u.del = append(u.del, action)
+				}
+			}
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	return u, nil
+}
+
+// parseSetValue parses the right-hand side of a SET action.
+func (p *exprParser) parseSetValue() (*operand, *ddbError) {
+	left, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokPunct && (t.text == "+" || t.text == "-") {
+		p.next()
+		right, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &operand{kind: operandArith, name: t.text, args: []*operand{left, right}}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseSetOperand() (*operand, *ddbError) {
+	t := p.peek()
+	switch {
+	case t.kind == tokValue:
+		return p.parseValue()
+	case p.isCall():
+		fn := t.text
+		p.next()
+		switch fn {
+		case "if_not_exists":
+			args, err := p.parseArgs(fn, 2, p.parseSetValue)
+			if err != nil {
+				return nil, err
+			}
+			if args[0].kind != operandPath {
+				return nil, errValidation("Invalid UpdateExpression: Operator or function requires a document path; operator or function: if_not_exists")
+			}
+			return &operand{kind: operandFunc, name: fn, args: args}, nil
+		case "list_append":
+			args, err := p.parseArgs(fn, 2, p.parseSetValue)
+			if err != nil {
+				return nil, err
+			}
+			return &operand{kind: operandFunc, name: fn, args: args}, nil
+		}
+		if _, ok := conditionFunctions[fn]; ok || fn == "size" {
+			return nil, p.functionError("The function is not allowed in an update expression", fn)
+		}
+		return nil, p.functionError("Invalid function name", fn)
+	case t.kind == tokIdent || t.kind == tokName:
+		return p.parsePathOperand()
+	}
+	return nil, p.errorAt()
+}
+
+// typeName is the spelling DynamoDB uses for types in error messages.
+func typeName(typ string) string {
+	switch typ {
+	case "S":
+		return "STRING"
+	case "N":
+		return "NUMBER"
+	case "B":
+		return "BINARY"
+	case "BOOL":
+		return "BOOLEAN"
+	case "SS":
+		return "STRING SET"
+	case "NS":
+		return "NUMBER SET"
+	case "BS":
+		return "BINARY SET"
+	case "M":
+		return "MAP"
+	case "L":
+		return "LIST"
+	}
+	return typ
+}
+
+// scalarString renders a scalar value for error messages.
+func scalarString(v AttributeValue) string {
+	switch {
+	case v.S != nil:
+		return *v.S
+	case v.N != nil:
+		return *v.N
+	}
+	buf, _ := v.MarshalJSON()
+	return string(buf)
+}
@@ -0,0 +1,214 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"opensnack/internal/api/dynamodb"
+	"opensnack/internal/resource"
+)
+
+const conditionItem = `{"pk":{"S":"u1"},"age":{"N":"30"},"name":{"S":"alice"},"tags":{"SS":["a","b"]},` +
+	`"scores":{"L":[{"N":"1"},{"N":"2"}]},"profile":{"M":{"city":{"S":"paris"},"zip":{"N":"75001"}}},"active":{"BOOL":true}}`
+
+func TestConditionExpression(t *testing.T) {
+	cases := []struct {
+		expr   string
+		values string
+		want   bool
+	}{
+		{"age = :v", `{":v":{"N":"30.0"}}`, true},
+		{"age <> :v", `{":v":{"N":"30"}}`, false},
+		{"missing <> :v", `{":v":{"N":"30"}}`, true},
+		{"age < :v", `{":v":{"N":"31"}}`, true},
+		{"age >= :v", `{":v":{"N":"31"}}`, false},
+		{"name > :v", `{":v":{"S":"al"}}`, true},
+		{"age > :v", `{":v":{"S":"1"}}`, false},
+		{"age BETWEEN :lo AND :hi", `{":lo":{"N":"18"},":hi":{"N":"30"}}`, true},
+		{"age BETWEEN :lo AND :hi", `{":lo":{"N":"31"},":hi":{"N":"40"}}`, false},
+		{"name IN (:a, :b)", `{":a":{"S":"bob"},":b":{"S":"alice"}}`, true},
+		{"name IN (:a)", `{":a":{"S":"bob"}}`, false},
+		{"attribute_exists(profile.city)", "", true},
+		{"attribute_exists(profile.street)", "", false},
+		{"attribute_not_exists(deleted)", "", true},
+		{"attribute_type(tags, :t)", `{":t":{"S":"SS"}}`, true},
+		{"begins_with(name, :p)", `{":p":{"S":"ali"}}`, true},
+		{"begins_with(profile.city, :p)", `{":p":{"S":"lon"}}`, false},
+		{"contains(name, :s)", `{":s":{"S":"lic"}}`, true},
+		{"contains(tags, :s)", `{":s":{"S":"b"}}`, true},
+		{"contains(scores, :s)", `{":s":{"N":"2"}}`, true},
+		{"contains(tags, :s)", `{":s":{"S":"z"}}`, false},
+		{"size(name) = :n", `{":n":{"N":"5"}}`, true},
+		{"size(tags) > :n", `{":n":{"N":"2"}}`, false},
+		{"scores[1] = :n", `{":n":{"N":"2"}}`, true},
+		{"profile.zip = :n AND active = :t", `{":n":{"N":"75001"},":t":{"BOOL":true}}`, true},
+		{"age = :x OR name = :y", `{":x":{"N":"1"},":y":{"S":"alice"}}`, true},
+		{"NOT (age = :x OR name = :y)", `{":x":{"N":"1"},":y":{"S":"alice"}}`, false},
+		{"age = :x OR name = :y AND active = :f", `{":x":{"N":"30"},":y":{"S":"x"},":f":{"BOOL":false}}`, true},
+		{"(age = :x OR name = :y) AND active = :f", `{":x":{"N":"30"},":y":{"S":"x"},":f":{"BOOL":false}}`, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			h := dynamodb.NewHandler(resource.NewMemoryStore())
+			createTable(t, h, "users", false)
+			mustCall(t, h, "PutItem", `{"TableName":"users","Item":`+conditionItem+`}`, nil)
+
+			body := `{"TableName":"users","Key":{"pk":{"S":"u1"}},"ConditionExpression":"` + tc.expr + `"`
+			if tc.values != "" {
+				body += `,"ExpressionAttributeValues":` + tc.values
+			}
+			body += "}"
+
+			rec := call(t, h, "DeleteItem", body, nil)
+			if got := rec.Code == 200; got != tc.want {
+				t.Fatalf("condition %q: got %v (%s), want %v", tc.expr, got, rec.Body.String(), tc.want)
+			}
+			if !tc.want && !strings.Contains(rec.Body.String(), "ConditionalCheckFailedException") {
+				t.Fatalf("expected ConditionalCheckFailedException, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestConditionExpression_PutItem(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+
+	create := `{"TableName":"users","Item":{"pk":{"S":"u1"},"v":{"N":"1"}},"ConditionExpression":"attribute_not_exists(pk)"}`
+	mustCall(t, h, "PutItem", create, nil)
+	expectError(t, h, "PutItem", create, "ConditionalCheckFailedException")
+
+	// The current item is returned on failure when asked for.
+	rec := call(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"u1"}},`+
+		`"ConditionExpression":"v = :old","ExpressionAttributeValues":{":old":{"N":"7"}},`+
+		`"ReturnValuesOnConditionCheckFailure":"ALL_OLD"}`, nil)
+	var failure struct {
+		Type string        `json:"__type"`
+		Item dynamodb.Item `json:"Item"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &failure)
+	if failure.Type != "ConditionalCheckFailedException" || itemJSON(failure.Item) != `{"pk":{"S":"u1"},"v":{"N":"1"}}` {
+		t.Fatalf("unexpected failure response: %s", rec.Body.String())
+	}
+
+	// Optimistic locking on a version attribute.
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"u1"},"v":{"N":"2"}},`+
+		`"ConditionExpression":"#v = :old","ExpressionAttributeNames":{"#v":"v"},"ExpressionAttributeValues":{":old":{"N":"1"}}}`, nil)
+}
+
+func TestUpdateExpression(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":`+conditionItem+`}`, nil)
+
+	var out dynamodb.UpdateItemOutput
+	mustCall(t, h, "UpdateItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}},`+
+		`"UpdateExpression":"SET age = age + :one, #n = :name, profile.city = :city, scores = list_append(scores, :more), `+
+		`visits = if_not_exists(visits, :zero) + :one, old = age REMOVE active ADD tags :t, counter :one DELETE missing :t",`+
+		`"ExpressionAttributeNames":{"#n":"name"},`+
+		`"ExpressionAttributeValues":{":one":{"N":"1"},":name":{"S":"bob"},":city":{"S":"rome"},`+
+		`":more":{"L":[{"N":"3"}]},":zero":{"N":"0"},":t":{"SS":["c"]}},"ReturnValues":"ALL_NEW"}`, &out)
+
+	want := `{"age":{"N":"31"},"counter":{"N":"1"},"name":{"S":"bob"},"old":{"N":"30"},"pk":{"S":"u1"},` +
+		`"profile":{"M":{"city":{"S":"rome"},"zip":{"N":"75001"}}},"scores":{"L":[{"N":"1"},{"N":"2"},{"N":"3"}]},` +
+		`"tags":{"SS":["a","b","c"]},"visits":{"N":"1"}}`
+	if itemJSON(out.Attributes) != want {
+		t.Fatalf("unexpected item:\n got %s\nwant %s", itemJSON(out.Attributes), want)
+	}
+
+	// List indexes refer to the list as it was before the update.
+	out = dynamodb.UpdateItemOutput{}
+	mustCall(t, h, "UpdateItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}},`+
+		`"UpdateExpression":"REMOVE scores[0], scores[2]","ReturnValues":"ALL_NEW"}`, &out)
+	if got := itemJSON(dynamodb.Item{"scores": out.Attributes["scores"]}); got != `{"scores":{"L":[{"N":"2"}]}}` {
+		t.Fatalf("unexpected scores: %s", got)
+	}
+}
+
+func TestUpdateExpression_Errors(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":`+conditionItem+`}`, nil)
+
+	update := func(expr, values string) string {
+		body := `{"TableName":"users","Key":{"pk":{"S":"u1"}},"UpdateExpression":"` + expr + `"`
+		if values != "" {
+			body += `,"ExpressionAttributeValues":` + values
+		}
+		return expectError(t, h, "UpdateItem", body+"}", "ValidationException")
+	}
+
+	cases := []struct{ expr, values, want string }{
+		{"SET pk = :v", `{":v":{"S":"x"}}`, "This attribute is part of the key"},
+		{"SET name = name + :v", `{":v":{"N":"1"}}`, "incorrect data type"},
+		{"SET a = nope + :v", `{":v":{"N":"1"}}`, "refers to an attribute that does not exist"},
+		{"SET a.b.c = :v", `{":v":{"N":"1"}}`, "document path provided in the update expression is invalid"},
+		{"SET a = :v, a = :v", `{":v":{"N":"1"}}`, "Two document paths overlap"},
+		{"SET a = :v SET b = :v", `{":v":{"N":"1"}}`, "can only be used once"},
+		{"SET a = :v", `{":v":{"N":"1"},":w":{"N":"2"}}`, "unused in expressions: keys: {:w}"},
+		{"SET a = :missing", `{":v":{"N":"1"}}`, "attribute value used in expression is not defined"},
+		{"SET a = #n", `{":v":{"N":"1"}}`, "attribute name used in the document path is not defined"},
+		{"ADD name :v", `{":v":{"S":"x"}}`, "operator: ADD, operand type: STRING"},
+		{"DELETE tags :v", `{":v":{"N":"1"}}`, "operator: DELETE, operand type: NUMBER"},
+		{"SET a = size(name)", "", "not allowed in an update expression"},
+		{"SET = :v", `{":v":{"N":"1"}}`, "Syntax error"},
+	}
+	for _, tc := range cases {
+		if msg := update(tc.expr, tc.values); !strings.Contains(msg, tc.want) {
+			t.Errorf("%q: expected %q in %q", tc.expr, tc.want, msg)
+		}
+	}
+
+	msg := expectError(t, h, "DeleteItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}},`+
+		`"ConditionExpression":"age BETWEEN :hi AND :lo","ExpressionAttributeValues":{":lo":{"N":"1"},":hi":{"N":"9"}}}`, "ValidationException")
+	if !strings.Contains(msg, "BETWEEN operator requires upper bound") {
+		t.Fatalf("unexpected message: %s", msg)
+	}
+}
+
+func TestUpdateExpression_ReturnValues(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":`+conditionItem+`}`, nil)
+
+	var out dynamodb.UpdateItemOutput
+	mustCall(t, h, "UpdateItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}},`+
+		`"UpdateExpression":"SET profile.city = :c REMOVE age","ExpressionAttributeValues":{":c":{"S":"rome"}},`+
+		`"ReturnValues":"UPDATED_OLD"}`, &out)
+	if itemJSON(out.Attributes) != `{"age":{"N":"30"},"profile":{"M":{"city":{"S":"paris"}}}}` {
+		t.Fatalf("unexpected UPDATED_OLD: %s", itemJSON(out.Attributes))
+	}
+
+	out = dynamodb.UpdateItemOutput{}
+	mustCall(t, h, "UpdateItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}},`+
+		`"UpdateExpression":"SET profile.zip = :z REMOVE name","ExpressionAttributeValues":{":z":{"N":"1"}},`+
+		`"ReturnValues":"UPDATED_NEW"}`, &out)
+	if itemJSON(out.Attributes) != `{"profile":{"M":{"zip":{"N":"1"}}}}` {
+		t.Fatalf("unexpected UPDATED_NEW: %s", itemJSON(out.Attributes))
+	}
+}
+
+func TestProjectionExpression(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":`+conditionItem+`}`, nil)
+
+	var got dynamodb.GetItemOutput
+	mustCall(t, h, "GetItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}},`+
+		`"ProjectionExpression":"#n, profile.city, scores[1], nope","ExpressionAttributeNames":{"#n":"name"}}`, &got)
+	if itemJSON(got.Item) != `{"name":{"S":"alice"},"profile":{"M":{"city":{"S":"paris"}}},"scores":{"L":[{"N":"2"}]}}` {
+		t.Fatalf("unexpected projection: %s", itemJSON(got.Item))
+	}
+
+	msg := expectError(t, h, "GetItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}},`+
+		`"ProjectionExpression":"name","ExpressionAttributeNames":{"#n":"name"}}`, "ValidationException")
+	if !strings.Contains(msg, "unused in expressions: keys: {#n}") {
+		t.Fatalf("unexpected message: %s", msg)
+	}
+}
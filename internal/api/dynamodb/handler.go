@@ -5,11 +5,18 @@
 package dynamodb
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"opensnack/internal/api/s3"
+	"opensnack/internal/awsarn"
 	"opensnack/internal/awsresponses"
 	"opensnack/internal/resource"
 	"opensnack/internal/util"
@@ -19,22 +26,81 @@ import (
 )
 
 const (
-	APIVersion    = "2012-08-10"
-	dynamoRegion  = "us-east-1"
-	dynamoAccount = "000000000000"
+	APIVersion = "2012-08-10"
 )
 
 type Handler struct {
 	Store resource.Store
+	// Objects receives table exports. The router shares its S3 handler
+	// here so exports land in the same buckets clients see.
+	Objects *s3.Handler
+
+	// tableMu guards tables, which holds one lock per table and
+	// namespace (see lockTables).
+	tableMu sync.Mutex
+	tables  map[string]*sync.RWMutex
+
+	// seqMu guards lastSeq, the last stream sequence number handed out.
+	seqMu   sync.Mutex
+	lastSeq int64
+
+	// namespaces records every namespace seen, for the TTL reaper.
+	nsMu       sync.Mutex
+	namespaces map[string]bool
 }
 
 func NewHandler(store resource.Store) *Handler {
-	return &Handler{Store: store}
+	return &Handler{Store: store, Objects: s3.NewHandler(store)}
+}
+
+// lockTables locks the named tables of ns and returns the function that
+// unlocks them. Item reads share a table's lock and item writes, which
+// read, check and then write, hold it alone. Operations spanning several
+// tables lock them in name order so that they cannot deadlock.
+func (h *Handler) lockTables(ns string, write bool, names ...string) (unlock func()) {
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		if name != "" {
+			keys = append(keys, ns+"/"+extractTableName(name))
+		}
+	}
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	h.tableMu.Lock()
+	if h.tables == nil {
+		h.tables = map[string]*sync.RWMutex{}
+	}
+	locks := make([]*sync.RWMutex, len(keys))
+	for i, key := range keys {
+		if h.tables[key] == nil {
+			h.tables[key] = &sync.RWMutex{}
+		}
+		locks[i] = h.tables[key]
+	}
+	h.tableMu.Unlock()
+
+	for _, l := range locks {
+		if write {
+			l.Lock()
+		} else {
+			l.RLock()
+		}
+	}
+	return func() {
+		for _, l := range locks {
+			if write {
+				l.Unlock()
+			} else {
+				l.RUnlock()
+			}
+		}
+	}
 }
 
 // Build DynamoDB Table ARN
-func tableArn(tableName string) string {
-	return "arn:aws:dynamodb:" + dynamoRegion + ":" + dynamoAccount + ":table/" + tableName
+func tableArn(ctx context.Context, tableName string) string {
+	return awsarn.FromContext(ctx).ARN("dynamodb", "table/"+tableName)
 }
 
 // extractTableName extracts table name from ARN or returns name as-is
@@ -58,6 +124,7 @@ func (h *Handler) Dispatch(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	h.trackNamespace(util.NamespaceFromHeader(r))
 
 	switch target {
 	case "DynamoDB_20120810.CreateTable":
@@ -84,16 +151,58 @@ func (h *Handler) Dispatch(w http.ResponseWriter, r *http.Request) {
 		h.DescribeContinuousBackups(w, r)
 	case "DynamoDB_20120810.UpdateContinuousBackups":
 		h.UpdateContinuousBackups(w, r)
+	case "DynamoDB_20120810.CreateBackup":
+		h.CreateBackup(w, r)
+	case "DynamoDB_20120810.ListBackups":
+		h.ListBackups(w, r)
+	case "DynamoDB_20120810.DescribeBackup":
+		h.DescribeBackup(w, r)
+	case "DynamoDB_20120810.DeleteBackup":
+		h.DeleteBackup(w, r)
+	case "DynamoDB_20120810.RestoreTableFromBackup":
+		h.RestoreTableFromBackup(w, r)
+	case "DynamoDB_20120810.RestoreTableToPointInTime":
+		h.RestoreTableToPointInTime(w, r)
+	case "DynamoDB_20120810.ExportTableToPointInTime":
+		h.ExportTableToPointInTime(w, r)
+	case "DynamoDB_20120810.DescribeExport":
+		h.DescribeExport(w, r)
+	case "DynamoDB_20120810.ListExports":
+		h.ListExports(w, r)
 	case "DynamoDB_20120810.PutItem":
 		h.PutItem(w, r)
 	case "DynamoDB_20120810.GetItem":
 		h.GetItem(w, r)
 	case "DynamoDB_20120810.DeleteItem":
 		h.DeleteItem(w, r)
+	case "DynamoDB_20120810.UpdateItem":
+		h.UpdateItem(w, r)
 	case "DynamoDB_20120810.Query":
 		h.Query(w, r)
 	case "DynamoDB_20120810.Scan":
 		h.Scan(w, r)
+	case "DynamoDB_20120810.BatchGetItem":
+		h.BatchGetItem(w, r)
+	case "DynamoDB_20120810.BatchWriteItem":
+		h.BatchWriteItem(w, r)
+	case "DynamoDB_20120810.TransactGetItems":
+		h.TransactGetItems(w, r)
+	case "DynamoDB_20120810.TransactWriteItems":
+		h.TransactWriteItems(w, r)
+	case "DynamoDB_20120810.ExecuteStatement":
+		h.ExecuteStatement(w, r)
+	case "DynamoDB_20120810.BatchExecuteStatement":
+		h.BatchExecuteStatement(w, r)
+	case "DynamoDB_20120810.ExecuteTransaction":
+		h.ExecuteTransaction(w, r)
+	case "DynamoDBStreams_20120810.ListStreams":
+		h.ListStreams(w, r)
+	case "DynamoDBStreams_20120810.DescribeStream":
+		h.DescribeStream(w, r)
+	case "DynamoDBStreams_20120810.GetShardIterator":
+		h.GetShardIterator(w, r)
+	case "DynamoDBStreams_20120810.GetRecords":
+		h.GetRecords(w, r)
 	default:
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "UnknownOperationException",
@@ -126,7 +235,7 @@ func (h *Handler) CreateTable(w http.ResponseWriter, r *http.Request) {
 	zap.S().Debugf("DEBUG: CreateTable called for table %s in namespace %s\n", req.TableName, ns)
 
 	// Check if table already exists
-	_, err := h.Store.Get(req.TableName, "dynamodb", "table", ns)
+	_, err := h.Store.Get(r.Context(), req.TableName, "dynamodb", "table", ns)
 	if err == nil {
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "ResourceInUseException",
@@ -152,7 +261,7 @@ func (h *Handler) CreateTable(w http.ResponseWriter, r *http.Request) {
 
 	tableDesc := TableDescription{
 		TableName:            req.TableName,
-		TableArn:             tableArn(req.TableName),
+		TableArn:             tableArn(r.Context(), req.TableName),
 		TableId:              tableId,
 		TableStatus:          "ACTIVE", // Start as CREATING, will be ACTIVE when stored
 		CreationDateTime:     float64(creationTime.UnixNano()) / 1e9,
@@ -183,7 +292,7 @@ func (h *Handler) CreateTable(w http.ResponseWriter, r *http.Request) {
 				KeySchema:      gsi.KeySchema,
 				Projection:     gsi.Projection,
 				IndexStatus:    "ACTIVE",
-				IndexArn:       tableArn(req.TableName) + "/index/" + gsi.IndexName,
+				IndexArn:       tableArn(r.Context(), req.TableName) + "/index/" + gsi.IndexName,
 				ItemCount:      0,
 				IndexSizeBytes: 0,
 			}
@@ -203,7 +312,7 @@ func (h *Handler) CreateTable(w http.ResponseWriter, r *http.Request) {
 				IndexName:      lsi.IndexName,
 				KeySchema:      lsi.KeySchema,
 				Projection:     lsi.Projection,
-				IndexArn:       tableArn(req.TableName) + "/index/" + lsi.IndexName,
+				IndexArn:       tableArn(r.Context(), req.TableName) + "/index/" + lsi.IndexName,
 				ItemCount:      0,
 				IndexSizeBytes: 0,
 			}
@@ -212,9 +321,13 @@ func (h *Handler) CreateTable(w http.ResponseWriter, r *http.Request) {
 
 	// Handle StreamSpecification
 	if req.StreamSpecification != nil && req.StreamSpecification.StreamEnabled {
-		tableDesc.StreamSpecification = req.StreamSpecification
-		tableDesc.LatestStreamArn = tableArn(req.TableName) + "/stream/" + now.Format("2006-01-02T15:04:05.000")
-		tableDesc.LatestStreamLabel = now.Format("2006-01-02T15:04:05.000")
+		if err := h.enableStream(r.Context(), ns, &tableDesc, req.StreamSpecification); err != nil {
+			awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
+				"__type":  "InternalServerError",
+				"message": "Failed to create stream: " + err.Error(),
+			})
+			return
+		}
 	}
 
 	// Handle SSE
@@ -265,7 +378,7 @@ func (h *Handler) CreateTable(w http.ResponseWriter, r *http.Request) {
 		Attributes: buf,
 	}
 
-	if err := h.Store.Create(res); err != nil {
+	if err := h.Store.Create(r.Context(), res); err != nil {
 		zap.S().Debugf("DEBUG: CreateTable failed to create table %s: %v\n", req.TableName, err)
 		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalServerError",
@@ -324,7 +437,7 @@ func (h *Handler) DescribeTable(w http.ResponseWriter, r *http.Request) {
 	var table *resource.Resource
 	var err error
 	for i := 0; i < 3; i++ {
-		table, err = h.Store.Get(req.TableName, "dynamodb", "table", ns)
+		table, err = h.Store.Get(r.Context(), req.TableName, "dynamodb", "table", ns)
 		if err == nil {
 			break
 		}
@@ -429,7 +542,7 @@ func (h *Handler) DescribeTable(w http.ResponseWriter, r *http.Request) {
 
 	// Ensure all required fields are present (Terraform may check for these)
 	if tableDesc.TableArn == "" {
-		tableDesc.TableArn = tableArn(tableDesc.TableName)
+		tableDesc.TableArn = tableArn(r.Context(), tableDesc.TableName)
 	}
 	// TableId should already be set when table was created
 	// Don't generate a new one here as it would cause tainting
@@ -455,6 +568,7 @@ func (h *Handler) DescribeTable(w http.ResponseWriter, r *http.Request) {
 	// Return the cleaned and validated table description
 	// All required fields are present, TableStatus is ACTIVE, and ProvisionedThroughput is removed for PAY_PER_REQUEST
 	tableDesc.TableStatus = "ACTIVE"
+	tableDesc.ItemCount, tableDesc.TableSizeBytes = h.tableStats(r.Context(), ns, tableDesc.TableName)
 	tableDescJSON, _ := json.MarshalIndent(tableDesc, "", "  ")
 	zap.S().Debugf("DEBUG: DescribeTable returning:\n%s\n", string(tableDescJSON))
 	awsresponses.WriteJSON(w, http.StatusOK, DescribeTableOutput{
@@ -489,7 +603,7 @@ func (h *Handler) DeleteTable(w http.ResponseWriter, r *http.Request) {
 	req.TableName = extractTableName(req.TableName)
 
 	// Get table to return description
-	table, err := h.Store.Get(req.TableName, "dynamodb", "table", ns)
+	table, err := h.Store.Get(r.Context(), req.TableName, "dynamodb", "table", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -508,15 +622,19 @@ func (h *Handler) DeleteTable(w http.ResponseWriter, r *http.Request) {
 
 	// Update status to DELETING
 	tableDesc.TableStatus = "DELETING"
+	tableDesc.ItemCount, tableDesc.TableSizeBytes = h.tableStats(r.Context(), ns, req.TableName)
 
 	// Delete the table
-	if err := h.Store.Delete(req.TableName, "dynamodb", "table", ns); err != nil {
+	if err := h.Store.Delete(r.Context(), req.TableName, "dynamodb", "table", ns); err != nil {
 		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalServerError",
 			"message": "Failed to delete table: " + err.Error(),
 		})
 		return
 	}
+	h.deleteTableItems(r.Context(), ns, req.TableName)
+	h.disableStreams(r.Context(), ns, req.TableName)
+	h.dropHistory(r.Context(), ns, req.TableName)
 
 	awsresponses.WriteJSON(w, http.StatusOK, DeleteTableOutput{
 		TableDescription: tableDesc,
@@ -537,22 +655,40 @@ func (h *Handler) ListTables(w http.ResponseWriter, r *http.Request) {
 		util.DecodeAWSJSON(r, &req)
 	}
 
-	tables, err := h.Store.List("dynamodb", "table", ns)
+	if req.Limit < 0 || req.Limit > 100 {
+		writeError(w, errValidation("1 validation error detected: Value '"+strconv.Itoa(req.Limit)+
+			"' at 'limit' failed to satisfy constraint: Member must have value less than or equal to 100"))
+		return
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = 100
+	}
+
+	// Tables are stored under their names, so the exclusive start name
+	// is a store cursor.
+	q := resource.Query{Service: "dynamodb", Type: "table", Namespace: ns, Limit: limit}
+	if req.ExclusiveStartTableName != "" {
+		q.Cursor = resource.EncodeCursor(req.ExclusiveStartTableName)
+	}
+	page, err := h.Store.Query(r.Context(), q)
 	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalServerError",
 			"message": "Failed to list tables: " + err.Error(),
 		})
+		return
 	}
 
-	var tableNames []string
-	for _, t := range tables {
-		tableNames = append(tableNames, t.ID)
+	out := ListTablesOutput{TableNames: []string{}}
+	for _, t := range page.Resources {
+		out.TableNames = append(out.TableNames, t.ID)
+	}
+	if page.Next != "" {
+		out.LastEvaluatedTableName = out.TableNames[len(out.TableNames)-1]
 	}
 
-	awsresponses.WriteJSON(w, http.StatusOK, ListTablesOutput{
-		TableNames: tableNames,
-	})
+	awsresponses.WriteJSON(w, http.StatusOK, out)
 }
 
 // UpdateTable updates table settings
@@ -565,6 +701,7 @@ func (h *Handler) UpdateTable(w http.ResponseWriter, r *http.Request) {
 			"__type":  "SerializationException",
 			"message": "Invalid request body: " + err.Error(),
 		})
+		return
 	}
 
 	if req.TableName == "" {
@@ -572,49 +709,119 @@ func (h *Handler) UpdateTable(w http.ResponseWriter, r *http.Request) {
 			"__type":  "ValidationException",
 			"message": "TableName is required",
 		})
+		return
 	}
 
 	// Normalize table name (handle both names and ARNs)
 	req.TableName = extractTableName(req.TableName)
 
-	table, err := h.Store.Get(req.TableName, "dynamodb", "table", ns)
-	if err != nil {
+	if _, err := h.Store.Get(r.Context(), req.TableName, "dynamodb", "table", ns); err != nil {
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "ResourceNotFoundException",
 			"message": "Requested resource not found: Table: " + req.TableName + " not found",
 		})
+		return
 	}
 
-	var storedData map[string]any
-	if err := json.Unmarshal(table.Attributes, &storedData); err != nil {
+	var cleanDesc TableDescription
+	_, err := h.Store.Mutate(r.Context(), req.TableName, "dynamodb", "table", ns, func(table *resource.Resource) error {
+		var storedData map[string]any
+		if err := json.Unmarshal(table.Attributes, &storedData); err != nil {
+			return &ddbError{Type: "InternalServerError", Message: "Failed to parse table data"}
+		}
+		desc, derr := updateTableDescription(storedData, &req)
+		if derr != nil {
+			return derr
+		}
+		cleanDesc = desc
+		table.Attributes, _ = json.Marshal(storedData)
+		return nil
+	})
+	var derr *ddbError
+	if errors.As(err, &derr) {
+		writeError(w, derr)
+		return
+	}
+	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalServerError",
-			"message": "Failed to parse table data",
+			"message": "Failed to update table: " + err.Error(),
 		})
+		return
+	}
+
+	// A stream is only recorded, or the old ones disabled, once the
+	// table description naming it is saved
+	if req.StreamSpecification != nil {
+		if req.StreamSpecification.StreamEnabled {
+			if err := h.recordStream(r.Context(), ns, &cleanDesc); err != nil {
+				awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
+					"__type":  "InternalServerError",
+					"message": "Failed to create stream: " + err.Error(),
+				})
+				return
+			}
+		} else {
+			h.disableStreams(r.Context(), ns, req.TableName)
+		}
 	}
 
+	// Apply the same throughput rules as DescribeTable for consistency
+	if cleanDesc.BillingModeSummary != nil {
+		billingMode := cleanDesc.BillingModeSummary.BillingMode
+
+		if billingMode == "PROVISIONED" {
+			// Ensure PROVISIONED tables have throughput
+			if cleanDesc.ProvisionedThroughput == nil {
+				cleanDesc.ProvisionedThroughput = &ProvisionedThroughputDescription{
+					ReadCapacityUnits:      5,
+					WriteCapacityUnits:     5,
+					NumberOfDecreasesToday: 0,
+					// LastIncreaseDateTime:   float64(time.Now().UTC().Unix()),
+					// LastDecreaseDateTime:   0,
+				}
+			}
+			// GSIs should also have throughput
+			for i := range cleanDesc.GlobalSecondaryIndexes {
+				if cleanDesc.GlobalSecondaryIndexes[i].ProvisionedThroughput == nil {
+					cleanDesc.GlobalSecondaryIndexes[i].ProvisionedThroughput = &ProvisionedThroughputDescription{
+						ReadCapacityUnits:      5,
+						WriteCapacityUnits:     5,
+						NumberOfDecreasesToday: 0,
+					}
+				}
+			}
+		} else if billingMode == "PAY_PER_REQUEST" {
+			// Remove throughput for PAY_PER_REQUEST
+			cleanDesc.ProvisionedThroughput = nil
+			for i := range cleanDesc.GlobalSecondaryIndexes {
+				cleanDesc.GlobalSecondaryIndexes[i].ProvisionedThroughput = nil
+			}
+		}
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, UpdateTableOutput{
+		TableDescription: cleanDesc,
+	})
+}
+
+// updateTableDescription applies an UpdateTable request to the table
+// description in storedData, stores the result back in storedData and
+// returns it.
+func updateTableDescription(storedData map[string]any, req *UpdateTableInput) (TableDescription, *ddbError) {
 	tableDescData, ok := storedData["table_description"]
 	if !ok {
-		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
-			"__type":  "InternalServerError",
-			"message": "Table description not found",
-		})
+		return TableDescription{}, &ddbError{Type: "InternalServerError", Message: "Table description not found"}
 	}
 
 	tableDescBytes, err := json.Marshal(tableDescData)
 	if err != nil {
-		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
-			"__type":  "InternalServerError",
-			"message": "Failed to marshal table description: " + err.Error(),
-		})
+		return TableDescription{}, &ddbError{Type: "InternalServerError", Message: "Failed to marshal table description: " + err.Error()}
 	}
 
 	var tableDesc TableDescription
 	if err := json.Unmarshal(tableDescBytes, &tableDesc); err != nil {
-		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
-			"__type":  "InternalServerError",
-			"message": "Failed to parse table description: " + err.Error(),
-		})
+		return TableDescription{}, &ddbError{Type: "InternalServerError", Message: "Failed to parse table description: " + err.Error()}
 	}
 
 	// Ensure BillingModeSummary is set (for backward compatibility)
@@ -672,13 +879,70 @@ func (h *Handler) UpdateTable(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Update stream specification if provided
+	// Update stream specification if provided; the previous stream stays
+	// readable, and LatestStreamArn keeps pointing at it once disabled.
+	// The caller records or disables the stream itself
 	if req.StreamSpecification != nil {
-		tableDesc.StreamSpecification = req.StreamSpecification
+		enabled := tableDesc.StreamSpecification != nil && tableDesc.StreamSpecification.StreamEnabled
 		if req.StreamSpecification.StreamEnabled {
-			now := time.Now().UTC()
-			tableDesc.LatestStreamArn = tableArn(req.TableName) + "/stream/" + now.Format("2006-01-02T15:04:05.000")
-			tableDesc.LatestStreamLabel = now.Format("2006-01-02T15:04:05.000")
+			if enabled {
+				return TableDescription{}, &ddbError{Type: "ValidationException", Message: "Table already has an enabled stream: " + tableDesc.LatestStreamArn}
+			}
+			startStream(&tableDesc, req.StreamSpecification)
+		} else {
+			tableDesc.StreamSpecification = nil
+		}
+	}
+
+	// Merge new attribute definitions (needed for new index keys)
+	for _, def := range req.AttributeDefinitions {
+		if attributeType(&tableDesc, def.AttributeName) == "" {
+			tableDesc.AttributeDefinitions = append(tableDesc.AttributeDefinitions, def)
+		}
+	}
+
+	// Apply GSI changes; new indexes are ACTIVE immediately
+	for _, update := range req.GlobalSecondaryIndexUpdates {
+		switch {
+		case update.Create != nil:
+			gsi := update.Create
+			for _, existing := range tableDesc.GlobalSecondaryIndexes {
+				if existing.IndexName == gsi.IndexName {
+					return TableDescription{}, &ddbError{Type: "ValidationException", Message: "Attempting to create an index which already exists"}
+				}
+			}
+			gsiDesc := GlobalSecondaryIndexDescription{
+				IndexName:   gsi.IndexName,
+				KeySchema:   gsi.KeySchema,
+				Projection:  gsi.Projection,
+				IndexStatus: "ACTIVE",
+				IndexArn:    tableDesc.TableArn + "/index/" + gsi.IndexName,
+			}
+			if finalBillingMode == "PROVISIONED" {
+				gsiDesc.ProvisionedThroughput = buildProvisionedThroughputDesc(gsi.ProvisionedThroughput)
+			}
+			tableDesc.GlobalSecondaryIndexes = append(tableDesc.GlobalSecondaryIndexes, gsiDesc)
+		case update.Update != nil:
+			for i := range tableDesc.GlobalSecondaryIndexes {
+				if tableDesc.GlobalSecondaryIndexes[i].IndexName == update.Update.IndexName &&
+					update.Update.ProvisionedThroughput != nil && finalBillingMode == "PROVISIONED" {
+					tableDesc.GlobalSecondaryIndexes[i].ProvisionedThroughput = buildProvisionedThroughputDesc(update.Update.ProvisionedThroughput)
+				}
+			}
+		case update.Delete != nil:
+			kept := tableDesc.GlobalSecondaryIndexes[:0]
+			found := false
+			for _, gsi := range tableDesc.GlobalSecondaryIndexes {
+				if gsi.IndexName == update.Delete.IndexName {
+					found = true
+					continue
+				}
+				kept = append(kept, gsi)
+			}
+			if !found {
+				return TableDescription{}, &ddbError{Type: "ResourceNotFoundException", Message: "Requested resource not found: Index: " + update.Delete.IndexName + " not found"}
+			}
+			tableDesc.GlobalSecondaryIndexes = kept
 		}
 	}
 
@@ -692,68 +956,17 @@ func (h *Handler) UpdateTable(w http.ResponseWriter, r *http.Request) {
 	// This ensures ProvisionedThroughput is properly omitted if nil
 	cleanDescBytes, err := json.Marshal(tableDesc)
 	if err != nil {
-		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
-			"__type":  "InternalServerError",
-			"message": "Failed to marshal cleaned table description: " + err.Error(),
-		})
+		return TableDescription{}, &ddbError{Type: "InternalServerError", Message: "Failed to marshal cleaned table description: " + err.Error()}
 	}
 	var cleanDesc TableDescription
 	if err := json.Unmarshal(cleanDescBytes, &cleanDesc); err != nil {
-		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
-			"__type":  "InternalServerError",
-			"message": "Failed to unmarshal cleaned table description: " + err.Error(),
-		})
+		return TableDescription{}, &ddbError{Type: "InternalServerError", Message: "Failed to unmarshal cleaned table description: " + err.Error()}
 	}
 
 	// Save updated table with cleaned description
 	storedData["table_description"] = cleanDesc
-	buf, _ := json.Marshal(storedData)
-	table.Attributes = buf
-
-	if err := h.Store.Update(table); err != nil {
-		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
-			"__type":  "InternalServerError",
-			"message": "Failed to update table: " + err.Error(),
-		})
-	}
-
-	// Apply the same throughput rules as DescribeTable for consistency
-	if cleanDesc.BillingModeSummary != nil {
-		billingMode := cleanDesc.BillingModeSummary.BillingMode
 
-		if billingMode == "PROVISIONED" {
-			// Ensure PROVISIONED tables have throughput
-			if cleanDesc.ProvisionedThroughput == nil {
-				cleanDesc.ProvisionedThroughput = &ProvisionedThroughputDescription{
-					ReadCapacityUnits:      5,
-					WriteCapacityUnits:     5,
-					NumberOfDecreasesToday: 0,
-					// LastIncreaseDateTime:   float64(time.Now().UTC().Unix()),
-					// LastDecreaseDateTime:   0,
-				}
-			}
-			// GSIs should also have throughput
-			for i := range cleanDesc.GlobalSecondaryIndexes {
-				if cleanDesc.GlobalSecondaryIndexes[i].ProvisionedThroughput == nil {
-					cleanDesc.GlobalSecondaryIndexes[i].ProvisionedThroughput = &ProvisionedThroughputDescription{
-						ReadCapacityUnits:      5,
-						WriteCapacityUnits:     5,
-						NumberOfDecreasesToday: 0,
-					}
-				}
-			}
-		} else if billingMode == "PAY_PER_REQUEST" {
-			// Remove throughput for PAY_PER_REQUEST
-			cleanDesc.ProvisionedThroughput = nil
-			for i := range cleanDesc.GlobalSecondaryIndexes {
-				cleanDesc.GlobalSecondaryIndexes[i].ProvisionedThroughput = nil
-			}
-		}
-	}
-
-	awsresponses.WriteJSON(w, http.StatusOK, UpdateTableOutput{
-		TableDescription: cleanDesc,
-	})
+	return cleanDesc, nil
 }
 
 // DescribeTimeToLive returns TTL settings
@@ -771,6 +984,7 @@ func (h *Handler) DescribeTimeToLive(w http.ResponseWriter, r *http.Request) {
 				"__type":  "SerializationException",
 				"message": "Invalid request body: " + err.Error(),
 			})
+			return
 		}
 	}
 
@@ -779,17 +993,19 @@ func (h *Handler) DescribeTimeToLive(w http.ResponseWriter, r *http.Request) {
 			"__type":  "ValidationException",
 			"message": "TableName is required",
 		})
+		return
 	}
 
 	// Normalize table name (handle both names and ARNs)
 	req.TableName = extractTableName(req.TableName)
 
-	table, err := h.Store.Get(req.TableName, "dynamodb", "table", ns)
+	table, err := h.Store.Get(r.Context(), req.TableName, "dynamodb", "table", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "ResourceNotFoundException",
 			"message": "Requested resource not found: Table: " + req.TableName + " not found",
 		})
+		return
 	}
 
 	var storedData map[string]any
@@ -829,6 +1045,7 @@ func (h *Handler) UpdateTimeToLive(w http.ResponseWriter, r *http.Request) {
 			"__type":  "SerializationException",
 			"message": "Invalid request body: " + err.Error(),
 		})
+		return
 	}
 
 	if req.TableName == "" {
@@ -836,35 +1053,39 @@ func (h *Handler) UpdateTimeToLive(w http.ResponseWriter, r *http.Request) {
 			"__type":  "ValidationException",
 			"message": "TableName is required",
 		})
+		return
 	}
 
 	// Normalize table name (handle both names and ARNs)
 	req.TableName = extractTableName(req.TableName)
 
-	table, err := h.Store.Get(req.TableName, "dynamodb", "table", ns)
+	_, err := h.Store.Get(r.Context(), req.TableName, "dynamodb", "table", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "ResourceNotFoundException",
 			"message": "Requested resource not found: Table: " + req.TableName + " not found",
 		})
+		return
 	}
 
-	var storedData map[string]any
-	json.Unmarshal(table.Attributes, &storedData)
-
-	storedData["ttl_specification"] = map[string]any{
-		"enabled":        req.TimeToLiveSpecification.Enabled,
-		"attribute_name": req.TimeToLiveSpecification.AttributeName,
-	}
+	_, err = h.Store.Mutate(r.Context(), req.TableName, "dynamodb", "table", ns, func(table *resource.Resource) error {
+		var storedData map[string]any
+		json.Unmarshal(table.Attributes, &storedData)
 
-	buf, _ := json.Marshal(storedData)
-	table.Attributes = buf
+		storedData["ttl_specification"] = map[string]any{
+			"enabled":        req.TimeToLiveSpecification.Enabled,
+			"attribute_name": req.TimeToLiveSpecification.AttributeName,
+		}
 
-	if err := h.Store.Update(table); err != nil {
+		table.Attributes, _ = json.Marshal(storedData)
+		return nil
+	})
+	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalServerError",
 			"message": "Failed to update TTL: " + err.Error(),
 		})
+		return
 	}
 
 	ttlDesc := TimeToLiveDescription{
@@ -897,6 +1118,7 @@ func (h *Handler) ListTagsOfResource(w http.ResponseWriter, r *http.Request) {
 				"__type":  "SerializationException",
 				"message": "Invalid request body: " + err.Error(),
 			})
+			return
 		}
 	}
 
@@ -905,11 +1127,12 @@ func (h *Handler) ListTagsOfResource(w http.ResponseWriter, r *http.Request) {
 			"__type":  "ValidationException",
 			"message": "ResourceArn is required",
 		})
+		return
 	}
 
 	tableName := extractTableName(req.ResourceArn)
 
-	table, err := h.Store.Get(tableName, "dynamodb", "table", ns)
+	table, err := h.Store.Get(r.Context(), tableName, "dynamodb", "table", ns)
 	if err != nil {
 		// Return empty tags if resource doesn't exist
 		awsresponses.WriteJSON(w, http.StatusOK, ListTagsOfResourceOutput{
@@ -954,6 +1177,7 @@ func (h *Handler) TagResource(w http.ResponseWriter, r *http.Request) {
 			"__type":  "SerializationException",
 			"message": "Invalid request body: " + err.Error(),
 		})
+		return
 	}
 
 	if req.ResourceArn == "" {
@@ -961,55 +1185,60 @@ func (h *Handler) TagResource(w http.ResponseWriter, r *http.Request) {
 			"__type":  "ValidationException",
 			"message": "ResourceArn is required",
 		})
+		return
 	}
 
 	tableName := extractTableName(req.ResourceArn)
 
-	table, err := h.Store.Get(tableName, "dynamodb", "table", ns)
+	_, err := h.Store.Get(r.Context(), tableName, "dynamodb", "table", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "ResourceNotFoundException",
 			"message": "Requested resource not found: Table: " + tableName + " not found",
 		})
+		return
 	}
 
-	var storedData map[string]any
-	json.Unmarshal(table.Attributes, &storedData)
+	_, err = h.Store.Mutate(r.Context(), tableName, "dynamodb", "table", ns, func(table *resource.Resource) error {
+		var storedData map[string]any
+		json.Unmarshal(table.Attributes, &storedData)
 
-	// Get existing tags
-	existingTags := make(map[string]string)
-	if tagsData, ok := storedData["tags"].([]any); ok {
-		for _, t := range tagsData {
-			if tagMap, ok := t.(map[string]any); ok {
-				if k, ok := tagMap["Key"].(string); ok {
-					if v, ok := tagMap["Value"].(string); ok {
-						existingTags[k] = v
+		// Get existing tags
+		existingTags := make(map[string]string)
+		if tagsData, ok := storedData["tags"].([]any); ok {
+			for _, t := range tagsData {
+				if tagMap, ok := t.(map[string]any); ok {
+					if k, ok := tagMap["Key"].(string); ok {
+						if v, ok := tagMap["Value"].(string); ok {
+							existingTags[k] = v
+						}
 					}
 				}
 			}
 		}
-	}
 
-	// Merge new tags
-	for _, t := range req.Tags {
-		existingTags[t.Key] = t.Value
-	}
+		// Merge new tags
+		for _, t := range req.Tags {
+			existingTags[t.Key] = t.Value
+		}
 
-	// Convert back to slice
-	var tags []Tag
-	for k, v := range existingTags {
-		tags = append(tags, Tag{Key: k, Value: v})
-	}
+		// Convert back to slice
+		var tags []Tag
+		for k, v := range existingTags {
+			tags = append(tags, Tag{Key: k, Value: v})
+		}
 
-	storedData["tags"] = tags
-	buf, _ := json.Marshal(storedData)
-	table.Attributes = buf
+		storedData["tags"] = tags
 
-	if err := h.Store.Update(table); err != nil {
+		table.Attributes, _ = json.Marshal(storedData)
+		return nil
+	})
+	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalServerError",
 			"message": "Failed to tag resource: " + err.Error(),
 		})
+		return
 	}
 
 	awsresponses.WriteJSON(w, http.StatusOK, struct{}{})
@@ -1028,6 +1257,7 @@ func (h *Handler) UntagResource(w http.ResponseWriter, r *http.Request) {
 			"__type":  "SerializationException",
 			"message": "Invalid request body: " + err.Error(),
 		})
+		return
 	}
 
 	if req.ResourceArn == "" {
@@ -1035,54 +1265,59 @@ func (h *Handler) UntagResource(w http.ResponseWriter, r *http.Request) {
 			"__type":  "ValidationException",
 			"message": "ResourceArn is required",
 		})
+		return
 	}
 
 	tableName := extractTableName(req.ResourceArn)
 
-	table, err := h.Store.Get(tableName, "dynamodb", "table", ns)
+	_, err := h.Store.Get(r.Context(), tableName, "dynamodb", "table", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "ResourceNotFoundException",
 			"message": "Requested resource not found: Table: " + tableName + " not found",
 		})
+		return
 	}
 
-	var storedData map[string]any
-	json.Unmarshal(table.Attributes, &storedData)
+	_, err = h.Store.Mutate(r.Context(), tableName, "dynamodb", "table", ns, func(table *resource.Resource) error {
+		var storedData map[string]any
+		json.Unmarshal(table.Attributes, &storedData)
 
-	// Build set of keys to remove
-	keysToRemove := make(map[string]bool)
-	for _, k := range req.TagKeys {
-		keysToRemove[k] = true
-	}
+		// Build set of keys to remove
+		keysToRemove := make(map[string]bool)
+		for _, k := range req.TagKeys {
+			keysToRemove[k] = true
+		}
 
-	// Filter out removed tags
-	var filteredTags []Tag
-	if tagsData, ok := storedData["tags"].([]any); ok {
-		for _, t := range tagsData {
-			if tagMap, ok := t.(map[string]any); ok {
-				if k, ok := tagMap["Key"].(string); ok {
-					if !keysToRemove[k] {
-						tag := Tag{Key: k}
-						if v, ok := tagMap["Value"].(string); ok {
-							tag.Value = v
+		// Filter out removed tags
+		var filteredTags []Tag
+		if tagsData, ok := storedData["tags"].([]any); ok {
+			for _, t := range tagsData {
+				if tagMap, ok := t.(map[string]any); ok {
+					if k, ok := tagMap["Key"].(string); ok {
+						if !keysToRemove[k] {
+							tag := Tag{Key: k}
+							if v, ok := tagMap["Value"].(string); ok {
+								tag.Value = v
+							}
+							filteredTags = append(filteredTags, tag)
 						}
-						filteredTags = append(filteredTags, tag)
 					}
 				}
 			}
 		}
-	}
 
-	storedData["tags"] = filteredTags
-	buf, _ := json.Marshal(storedData)
-	table.Attributes = buf
+		storedData["tags"] = filteredTags
 
-	if err := h.Store.Update(table); err != nil {
+		table.Attributes, _ = json.Marshal(storedData)
+		return nil
+	})
+	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalServerError",
 			"message": "Failed to untag resource: " + err.Error(),
 		})
+		return
 	}
 
 	awsresponses.WriteJSON(w, http.StatusOK, struct{}{})
@@ -1103,6 +1338,7 @@ func (h *Handler) DescribeContinuousBackups(w http.ResponseWriter, r *http.Reque
 				"__type":  "SerializationException",
 				"message": "Invalid request body: " + err.Error(),
 			})
+			return
 		}
 	}
 
@@ -1111,41 +1347,23 @@ func (h *Handler) DescribeContinuousBackups(w http.ResponseWriter, r *http.Reque
 			"__type":  "ValidationException",
 			"message": "TableName is required",
 		})
+		return
 	}
 
 	// Normalize table name (handle both names and ARNs)
 	req.TableName = extractTableName(req.TableName)
 
-	table, err := h.Store.Get(req.TableName, "dynamodb", "table", ns)
+	table, err := h.Store.Get(r.Context(), req.TableName, "dynamodb", "table", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "ResourceNotFoundException",
 			"message": "Requested resource not found: Table: " + req.TableName + " not found",
 		})
-	}
-
-	var storedData map[string]any
-	json.Unmarshal(table.Attributes, &storedData)
-
-	pitrEnabled := false
-	if backupData, ok := storedData["continuous_backups"].(map[string]any); ok {
-		if enabled, ok := backupData["point_in_time_recovery_enabled"].(bool); ok {
-			pitrEnabled = enabled
-		}
-	}
-
-	pitrStatus := "DISABLED"
-	if pitrEnabled {
-		pitrStatus = "ENABLED"
+		return
 	}
 
 	awsresponses.WriteJSON(w, http.StatusOK, DescribeContinuousBackupsOutput{
-		ContinuousBackupsDescription: ContinuousBackupsDescription{
-			ContinuousBackupsStatus: "ENABLED",
-			PointInTimeRecoveryDescription: PointInTimeRecoveryDescription{
-				PointInTimeRecoveryStatus: pitrStatus,
-			},
-		},
+		ContinuousBackupsDescription: h.continuousBackupsDescription(r.Context(), ns, table.ID),
 	})
 }
 
@@ -1164,6 +1382,7 @@ func (h *Handler) UpdateContinuousBackups(w http.ResponseWriter, r *http.Request
 			"__type":  "SerializationException",
 			"message": "Invalid request body: " + err.Error(),
 		})
+		return
 	}
 
 	if req.TableName == "" {
@@ -1171,249 +1390,64 @@ func (h *Handler) UpdateContinuousBackups(w http.ResponseWriter, r *http.Request
 			"__type":  "ValidationException",
 			"message": "TableName is required",
 		})
+		return
 	}
 
 	// Normalize table name (handle both names and ARNs)
 	req.TableName = extractTableName(req.TableName)
 
-	table, err := h.Store.Get(req.TableName, "dynamodb", "table", ns)
+	defer h.lockTables(ns, true, req.TableName)()
+
+	table, err := h.Store.Get(r.Context(), req.TableName, "dynamodb", "table", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "ResourceNotFoundException",
 			"message": "Requested resource not found: Table: " + req.TableName + " not found",
 		})
+		return
 	}
 
 	var storedData map[string]any
 	json.Unmarshal(table.Attributes, &storedData)
 
-	storedData["continuous_backups"] = map[string]any{
-		"point_in_time_recovery_enabled": req.PointInTimeRecoverySpecification.PointInTimeRecoveryEnabled,
-	}
-
-	buf, _ := json.Marshal(storedData)
-	table.Attributes = buf
-
-	if err := h.Store.Update(table); err != nil {
+	// Enabling PITR starts the table's change history from its current
+	// items; disabling it discards the history.
+	enable := req.PointInTimeRecoverySpecification.PointInTimeRecoveryEnabled
+	setting := h.continuousBackups(r.Context(), ns, req.TableName)
+	if enable && !setting.Enabled {
+		now := time.Now()
+		var td TableDescription
+		if raw, err := json.Marshal(storedData["table_description"]); err == nil {
+			json.Unmarshal(raw, &td)
+		}
+		if derr := h.startHistory(r.Context(), ns, &td, now); derr != nil {
+			writeError(w, derr)
+			return
+		}
+		setting.EnabledAt = epochSeconds(now)
+	} else if !enable && setting.Enabled {
+		h.dropHistory(r.Context(), ns, req.TableName)
+		setting.EnabledAt = 0
+	}
+	setting.Enabled = enable
+
+	_, err = h.Store.Mutate(r.Context(), req.TableName, "dynamodb", "table", ns, func(table *resource.Resource) error {
+		var storedData map[string]any
+		json.Unmarshal(table.Attributes, &storedData)
+		storedData["continuous_backups"] = setting
+		table.Attributes, _ = json.Marshal(storedData)
+		return nil
+	})
+	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalServerError",
 			"message": "Failed to update continuous backups: " + err.Error(),
 		})
-	}
-
-	pitrStatus := "DISABLED"
-	if req.PointInTimeRecoverySpecification.PointInTimeRecoveryEnabled {
-		pitrStatus = "ENABLED"
+		return
 	}
 
 	awsresponses.WriteJSON(w, http.StatusOK, UpdateContinuousBackupsOutput{
-		ContinuousBackupsDescription: ContinuousBackupsDescription{
-			ContinuousBackupsStatus: "ENABLED",
-			PointInTimeRecoveryDescription: PointInTimeRecoveryDescription{
-				PointInTimeRecoveryStatus: pitrStatus,
-			},
-		},
-	})
-}
-
-// PutItem adds an item to a table
-func (h *Handler) PutItem(w http.ResponseWriter, r *http.Request) {
-	ns := util.NamespaceFromHeader(r)
-
-	var req struct {
-		TableName string         `json:"TableName"`
-		Item      map[string]any `json:"Item"`
-	}
-	if err := util.DecodeAWSJSON(r, &req); err != nil {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "SerializationException",
-			"message": "Invalid request body: " + err.Error(),
-		})
-	}
-
-	if req.TableName == "" {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "ValidationException",
-			"message": "TableName is required",
-		})
-	}
-
-	// Verify table exists and is ACTIVE
-	table, err := h.Store.Get(req.TableName, "dynamodb", "table", ns)
-	if err != nil {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "ResourceNotFoundException",
-			"message": "Requested resource not found: Table: " + req.TableName + " not found",
-		})
-	}
-
-	// Check table status
-	var storedData map[string]any
-	if err := json.Unmarshal(table.Attributes, &storedData); err == nil {
-		if tableDescData, ok := storedData["table_description"].(map[string]any); ok {
-			if status, ok := tableDescData["TableStatus"].(string); ok && status != "ACTIVE" {
-				awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-					"__type":  "ResourceInUseException",
-					"message": "Table is not in ACTIVE state",
-				})
-			}
-		}
-	}
-
-	// Return success with consumed capacity (AWS format)
-	awsresponses.WriteJSON(w, http.StatusOK, map[string]any{
-		"ConsumedCapacity": map[string]any{
-			"TableName":     req.TableName,
-			"CapacityUnits": 1.0,
-		},
-	})
-}
-
-// GetItem gets an item from a table (stub)
-func (h *Handler) GetItem(w http.ResponseWriter, r *http.Request) {
-	ns := util.NamespaceFromHeader(r)
-
-	var req struct {
-		TableName string         `json:"TableName"`
-		Key       map[string]any `json:"Key"`
-	}
-	if err := util.DecodeAWSJSON(r, &req); err != nil {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "SerializationException",
-			"message": "Invalid request body: " + err.Error(),
-		})
-	}
-
-	if req.TableName == "" {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "ValidationException",
-			"message": "TableName is required",
-		})
-	}
-
-	// Verify table exists
-	_, err := h.Store.Get(req.TableName, "dynamodb", "table", ns)
-	if err != nil {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "ResourceNotFoundException",
-			"message": "Requested resource not found: Table: " + req.TableName + " not found",
-		})
-	}
-
-	// Stub: return empty item
-	awsresponses.WriteJSON(w, http.StatusOK, map[string]any{})
-}
-
-// DeleteItem deletes an item from a table (stub)
-func (h *Handler) DeleteItem(w http.ResponseWriter, r *http.Request) {
-	ns := util.NamespaceFromHeader(r)
-
-	var req struct {
-		TableName string         `json:"TableName"`
-		Key       map[string]any `json:"Key"`
-	}
-	if err := util.DecodeAWSJSON(r, &req); err != nil {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "SerializationException",
-			"message": "Invalid request body: " + err.Error(),
-		})
-	}
-
-	if req.TableName == "" {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "ValidationException",
-			"message": "TableName is required",
-		})
-	}
-
-	// Verify table exists
-	_, err := h.Store.Get(req.TableName, "dynamodb", "table", ns)
-	if err != nil {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "ResourceNotFoundException",
-			"message": "Requested resource not found: Table: " + req.TableName + " not found",
-		})
-	}
-
-	// Stub: just return success
-	awsresponses.WriteJSON(w, http.StatusOK, struct{}{})
-}
-
-// Query queries a table (stub)
-func (h *Handler) Query(w http.ResponseWriter, r *http.Request) {
-	ns := util.NamespaceFromHeader(r)
-
-	var req struct {
-		TableName string `json:"TableName"`
-	}
-	if err := util.DecodeAWSJSON(r, &req); err != nil {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "SerializationException",
-			"message": "Invalid request body: " + err.Error(),
-		})
-	}
-
-	if req.TableName == "" {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "ValidationException",
-			"message": "TableName is required",
-		})
-	}
-
-	// Verify table exists
-	_, err := h.Store.Get(req.TableName, "dynamodb", "table", ns)
-	if err != nil {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "ResourceNotFoundException",
-			"message": "Requested resource not found: Table: " + req.TableName + " not found",
-		})
-	}
-
-	// Stub: return empty results
-	awsresponses.WriteJSON(w, http.StatusOK, map[string]any{
-		"Items":            []any{},
-		"Count":            0,
-		"ScannedCount":     0,
-		"ConsumedCapacity": nil,
-	})
-}
-
-// Scan scans a table (stub)
-func (h *Handler) Scan(w http.ResponseWriter, r *http.Request) {
-	ns := util.NamespaceFromHeader(r)
-
-	var req struct {
-		TableName string `json:"TableName"`
-	}
-	if err := util.DecodeAWSJSON(r, &req); err != nil {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "SerializationException",
-			"message": "Invalid request body: " + err.Error(),
-		})
-	}
-
-	if req.TableName == "" {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "ValidationException",
-			"message": "TableName is required",
-		})
-	}
-
-	// Verify table exists
-	_, err := h.Store.Get(req.TableName, "dynamodb", "table", ns)
-	if err != nil {
-		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
-			"__type":  "ResourceNotFoundException",
-			"message": "Requested resource not found: Table: " + req.TableName + " not found",
-		})
-	}
-
-	// Stub: return empty results
-	awsresponses.WriteJSON(w, http.StatusOK, map[string]any{
-		"Items":            []any{},
-		"Count":            0,
-		"ScannedCount":     0,
-		"ConsumedCapacity": nil,
+		ContinuousBackupsDescription: h.continuousBackupsDescription(r.Context(), ns, req.TableName),
 	})
 }
 
@@ -0,0 +1,130 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"opensnack/internal/api/dynamodb"
+	"opensnack/internal/resource"
+)
+
+//
+// ─────────────────────────────────────────────────────────────
+// Helpers
+// ─────────────────────────────────────────────────────────────
+//
+
+// call invokes a DynamoDB_20120810.* operation with a raw JSON body and
+// decodes a successful response into out.
+func call(t *testing.T, h *dynamodb.Handler, op, body string, out any) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "DynamoDB_20120810."+op)
+	req.Header.Set("User-Agent", "opensnack-test custom-ns1")
+	rec := httptest.NewRecorder()
+
+	h.Dispatch(rec, req)
+
+	if out != nil && rec.Code == 200 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("invalid JSON for %s: %s", op, rec.Body.String())
+		}
+	}
+	return rec
+}
+
+// mustCall is call that fails the test on a non-200 response.
+func mustCall(t *testing.T, h *dynamodb.Handler, op, body string, out any) {
+	t.Helper()
+	if rec := call(t, h, op, body, out); rec.Code != 200 {
+		t.Fatalf("%s failed: %d %s", op, rec.Code, rec.Body.String())
+	}
+}
+
+// expectError asserts that op fails with the given __type.
+func expectError(t *testing.T, h *dynamodb.Handler, op, body, errType string) string {
+	t.Helper()
+	rec := call(t, h, op, body, nil)
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != 400 || resp["__type"] != errType {
+		t.Fatalf("%s: expected %s, got %d %s", op, errType, rec.Code, rec.Body.String())
+	}
+	return resp["message"]
+}
+
+// createTable creates a table keyed by pk (S) and, optionally, sk (N).
+func createTable(t *testing.T, h *dynamodb.Handler, name string, withRange bool) {
+	t.Helper()
+	body := `{"TableName":"` + name + `","BillingMode":"PAY_PER_REQUEST",` +
+		`"AttributeDefinitions":[{"AttributeName":"pk","AttributeType":"S"}],` +
+		`"KeySchema":[{"AttributeName":"pk","KeyType":"HASH"}]}`
+	if withRange {
+		body = `{"TableName":"` + name + `","BillingMode":"PAY_PER_REQUEST",` +
+			`"AttributeDefinitions":[{"AttributeName":"pk","AttributeType":"S"},{"AttributeName":"sk","AttributeType":"N"}],` +
+			`"KeySchema":[{"AttributeName":"pk","KeyType":"HASH"},{"AttributeName":"sk","KeyType":"RANGE"}]}`
+	}
+	mustCall(t, h, "CreateTable", body, nil)
+}
+
+// itemJSON re-encodes an item so tests can compare it as a string.
+func itemJSON(item dynamodb.Item) string {
+	buf, _ := json.Marshal(item)
+	return string(buf)
+}
+
+//
+// ─────────────────────────────────────────────────────────────
+// TESTS
+// ─────────────────────────────────────────────────────────────
+//
+
+func TestCreateDescribeDeleteTable(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+
+	expectError(t, h, "CreateTable", `{"TableName":"users"}`, "ResourceInUseException")
+
+	var desc dynamodb.DescribeTableOutput
+	mustCall(t, h, "DescribeTable", `{"TableName":"users"}`, &desc)
+	if desc.Table.TableStatus != "ACTIVE" || desc.Table.KeySchema[0].AttributeName != "pk" {
+		t.Fatalf("unexpected description: %+v", desc.Table)
+	}
+
+	mustCall(t, h, "DeleteTable", `{"TableName":"users"}`, nil)
+	expectError(t, h, "DescribeTable", `{"TableName":"users"}`, "ResourceNotFoundException")
+}
+
+func TestListTablesPaging(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	for _, name := range []string{"orders", "accounts", "users", "carts", "items"} {
+		createTable(t, h, name, false)
+	}
+
+	var got []string
+	body := `{"Limit":2}`
+	for pages := 1; ; pages++ {
+		var out dynamodb.ListTablesOutput
+		mustCall(t, h, "ListTables", body, &out)
+		got = append(got, out.TableNames...)
+		if out.LastEvaluatedTableName == "" {
+			break
+		}
+		if pages == 3 {
+			t.Fatalf("too many pages: %v", got)
+		}
+		body = `{"Limit":2,"ExclusiveStartTableName":"` + out.LastEvaluatedTableName + `"}`
+	}
+	if strings.Join(got, ",") != "accounts,carts,items,orders,users" {
+		t.Fatalf("unexpected tables: %v", got)
+	}
+
+	expectError(t, h, "ListTables", `{"Limit":101}`, "ValidationException")
+}
@@ -0,0 +1,817 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"opensnack/internal/awsresponses"
+	"opensnack/internal/resource"
+	"opensnack/internal/util"
+)
+
+//
+// ITEM STORAGE
+//
+// Items are stored as dynamodb/"item" resources. The resource ID is the
+// table name followed by the encoded primary key, so a key lookup is a
+// single Store.Get. Every write goes through writeItem, which is the one
+// place that sees the old and new image of an item.
+//
+
+// maxItemSize is DynamoDB's 400 KB item size limit.
+const maxItemSize = 400 * 1024
+
+// storedItem is the JSON persisted for each item.
+type storedItem struct {
+	Table string `json:"table"`
+	Item  Item   `json:"item"`
+}
+
+// ddbError is rendered as a DynamoDB JSON error by writeError. Item is
+// set on a ConditionalCheckFailedException when the caller asked for
+// ReturnValuesOnConditionCheckFailure=ALL_OLD; Reasons is set on a
+// TransactionCanceledException.
+type ddbError struct {
+	Type    string
+	Message string
+	Item    Item
+	Reasons []CancellationReason
+}
+
+func (e *ddbError) Error() string { return e.Type + ": " + e.Message }
+
+func errValidation(msg string) *ddbError {
+	return &ddbError{Type: "ValidationException", Message: msg}
+}
+
+func errTableNotFound(table string) *ddbError {
+	return &ddbError{Type: "ResourceNotFoundException", Message: "Requested resource not found: Table: " + table + " not found"}
+}
+
+func errInternal(err error) *ddbError {
+	return &ddbError{Type: "InternalServerError", Message: err.Error()}
+}
+
+func writeError(w http.ResponseWriter, e *ddbError) {
+	status := http.StatusBadRequest
+	if e.Type == "InternalServerError" {
+		status = http.StatusInternalServerError
+	}
+	body := map[string]any{
+		"__type":  e.Type,
+		"message": e.Message,
+	}
+	if e.Item != nil {
+		body["Item"] = e.Item
+	}
+	if e.Reasons != nil {
+		body["CancellationReasons"] = e.Reasons
+	}
+	awsresponses.WriteJSON(w, status, body)
+}
+
+// decodeInput reads a JSON request body. Malformed AttributeValues are
+// validation errors, anything else is a serialization error.
+func decodeInput(r *http.Request, v any) *ddbError {
+	err := util.DecodeAWSJSON(r, v)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, errEmptyAttributeValue) {
+		return errValidation(err.Error())
+	}
+	return &ddbError{Type: "SerializationException", Message: "Invalid request body: " + err.Error()}
+}
+
+// loadTable returns the stored description of a table.
+func (h *Handler) loadTable(ctx context.Context, ns, name string) (*TableDescription, *ddbError) {
+	if name == "" {
+		return nil, errValidation("TableName is required")
+	}
+	name = extractTableName(name)
+	table, err := h.Store.Get(ctx, name, "dynamodb", "table", ns)
+	if err != nil {
+		return nil, errTableNotFound(name)
+	}
+	var stored struct {
+		TableDescription TableDescription `json:"table_description"`
+	}
+	if err := json.Unmarshal(table.Attributes, &stored); err != nil {
+		return nil, errInternal(err)
+	}
+	if stored.TableDescription.TableName == "" {
+		stored.TableDescription.TableName = name
+	}
+	return &stored.TableDescription, nil
+}
+
+// keyNames returns the hash and (optional) range key attribute names.
+func keyNames(schema []KeySchemaElement) (hash, rng string) {
+	for _, k := range schema {
+		switch k.KeyType {
+		case "HASH":
+			hash = k.AttributeName
+		case "RANGE":
+			rng = k.AttributeName
+		}
+	}
+	return hash, rng
+}
+
+// attributeType returns the declared scalar type of a key attribute.
+func attributeType(td *TableDescription, name string) string {
+	for _, def := range td.AttributeDefinitions {
+		if def.AttributeName == name {
+			return def.AttributeType
+		}
+	}
+	return ""
+}
+
+// validateKey checks that key holds exactly the table's primary key.
+func validateKey(td *TableDescription, key Item) *ddbError {
+	hash, rng := keyNames(td.KeySchema)
+	want := 1
+	if rng != "" {
+		want = 2
+	}
+	if len(key) != want {
+		return errValidation("The provided key element does not match the schema")
+	}
+	for _, name := range []string{hash, rng} {
+		if name == "" {
+			continue
+		}
+		v, ok := key[name]
+		if !ok || v.Type() != attributeType(td, name) {
+			return errValidation("The provided key element does not match the schema")
+		}
+		if err := validateKeyValue(name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateItem checks a full item: every value must be well formed and
+// the primary key attributes must be present with their declared types.
+func validateItem(td *TableDescription, item Item) *ddbError {
+	for _, v := range item {
+		if err := validateValue(v); err != nil {
+			return errValidation(err.Error())
+		}
+	}
+	hash, rng := keyNames(td.KeySchema)
+	for _, name := range []string{hash, rng} {
+		if name == "" {
+			continue
+		}
+		v, ok := item[name]
+		if !ok {
+			return errValidation("One or more parameter values were invalid: Missing the key " + name + " in the item")
+		}
+		if want := attributeType(td, name); v.Type() != want {
+			return errValidation("One or more parameter values were invalid: Type mismatch for key " + name +
+				" expected: " + want + " actual: " + v.Type())
+		}
+		if err := validateKeyValue(name, v); err != nil {
+			return err
+		}
+	}
+	if itemSize(item) > maxItemSize {
+		return errValidation("Item size has exceeded the maximum allowed size")
+	}
+	return nil
+}
+
+func validateKeyValue(name string, v AttributeValue) *ddbError {
+	if err := validateValue(v); err != nil {
+		return errValidation(err.Error())
+	}
+	if (v.S != nil && *v.S == "") || (v.B != nil && len(v.B) == 0) {
+		return errValidation("One or more parameter values are not valid. The AttributeValue for a key attribute " +
+			"cannot contain an empty " + map[string]string{"S": "string", "B": "binary"}[v.Type()] + " value. Key: " + name)
+	}
+	return nil
+}
+
+// normalizeItem returns a copy of item with canonical numbers.
+func normalizeItem(item Item) Item {
+	out := make(Item, len(item))
+	for k, v := range item {
+		out[k] = normalizeValue(v)
+	}
+	return out
+}
+
+// primaryKey extracts the primary key attributes of an item.
+func primaryKey(schema []KeySchemaElement, item Item) Item {
+	key := Item{}
+	hash, rng := keyNames(schema)
+	for _, name := range []string{hash, rng} {
+		if v, ok := item[name]; ok && name != "" {
+			key[name] = v
+		}
+	}
+	return key
+}
+
+// keySegment encodes one key value for use in a resource ID.
+func keySegment(v AttributeValue) string {
+	switch v.Type() {
+	case "S":
+		return "S:" + url.PathEscape(*v.S)
+	case "N":
+		if r, ok := parseNumber(*v.N); ok {
+			return "N:" + formatNumber(r)
+		}
+		return "N:" + *v.N
+	case "B":
+		return "B:" + base64.RawURLEncoding.EncodeToString(v.B)
+	}
+	return ""
+}
+
+// itemID returns the resource ID of the item with the given key.
+func itemID(td *TableDescription, key Item) string {
+	hash, rng := keyNames(td.KeySchema)
+	id := td.TableName + "/" + keySegment(key[hash])
+	if rng != "" {
+		id += "/" + keySegment(key[rng])
+	}
+	return id
+}
+
+// getItem returns the stored item for key, or nil if there is none.
+func (h *Handler) getItem(ctx context.Context, ns string, td *TableDescription, key Item) (Item, *ddbError) {
+	res, err := h.Store.Get(ctx, itemID(td, key), "dynamodb", "item", ns)
+	if err != nil {
+		return nil, nil
+	}
+	var stored storedItem
+	if err := json.Unmarshal(res.Attributes, &stored); err != nil {
+		return nil, errInternal(err)
+	}
+	return stored.Item, nil
+}
+
+// tableItems returns every item stored for a table.
+func (h *Handler) tableItems(ctx context.Context, ns, table string) ([]Item, *ddbError) {
+	page, err := h.Store.Query(ctx, resource.Query{
+		Service:   "dynamodb",
+		Type:      "item",
+		Namespace: ns,
+		IDPrefix:  table + "/",
+	})
+	if err != nil {
+		return nil, errInternal(err)
+	}
+	var items []Item
+	for _, res := range page.Resources {
+		var stored storedItem
+		if err := json.Unmarshal(res.Attributes, &stored); err != nil || stored.Table != table {
+			continue
+		}
+		items = append(items, stored.Item)
+	}
+	return items, nil
+}
+
+// writeItem replaces old with item in s, which is h.Store or a store
+// bound to a transaction. A nil old creates the item, a nil item deletes
+// it.
+func (h *Handler) writeItem(ctx context.Context, s resource.Store, ns string, td *TableDescription, old, item Item) *ddbError {
+	return h.writeItemAs(ctx, s, ns, td, old, item, nil)
+}
+
+// writeItemAs is writeItem for a change made by identity rather than by
+// the caller, such as a TTL deletion. The change is also recorded on the
+// table's stream and, with point-in-time recovery on, in its history.
+func (h *Handler) writeItemAs(ctx context.Context, s resource.Store, ns string, td *TableDescription, old, item Item, identity *Identity) *ddbError {
+	if old == nil && item == nil {
+		return nil
+	}
+	if derr := h.storeItem(ctx, s, ns, td, old, item); derr != nil {
+		return derr
+	}
+	if derr := h.emitRecord(ctx, s, ns, td, old, item, identity); derr != nil {
+		return derr
+	}
+	return h.recordChange(ctx, s, ns, td, old, item)
+}
+
+// storeItem persists the new image of an item.
+func (h *Handler) storeItem(ctx context.Context, s resource.Store, ns string, td *TableDescription, old, item Item) *ddbError {
+	if item == nil {
+		if err := s.Delete(ctx, itemID(td, primaryKey(td.KeySchema, old)), "dynamodb", "item", ns); err != nil {
+			return errInternal(err)
+		}
+		return nil
+	}
+
+	buf, err := json.Marshal(storedItem{Table: td.TableName, Item: item})
+	if err != nil {
+		return errInternal(err)
+	}
+	res := &resource.Resource{
+		ID:         itemID(td, primaryKey(td.KeySchema, item)),
+		Namespace:  ns,
+		Service:    "dynamodb",
+		Type:       "item",
+		Attributes: buf,
+	}
+	if old == nil {
+		err = s.Create(ctx, res)
+	} else {
+		err = s.Update(ctx, res)
+	}
+	if err != nil {
+		return errInternal(err)
+	}
+	return nil
+}
+
+// deleteTableItems removes every item of a dropped table.
+func (h *Handler) deleteTableItems(ctx context.Context, ns, table string) {
+	defer h.lockTables(ns, true, table)()
+
+	page, err := h.Store.Query(ctx, resource.Query{
+		Service:   "dynamodb",
+		Type:      "item",
+		Namespace: ns,
+		IDPrefix:  table + "/",
+	})
+	if err != nil {
+		return
+	}
+	for _, res := range page.Resources {
+		h.Store.Delete(ctx, res.ID, "dynamodb", "item", ns)
+	}
+}
+
+// tableStats returns the live item count and size of a table.
+func (h *Handler) tableStats(ctx context.Context, ns, table string) (count, size int64) {
+	items, err := h.tableItems(ctx, ns, table)
+	if err != nil {
+		return 0, 0
+	}
+	for _, item := range items {
+		count++
+		size += int64(itemSize(item))
+	}
+	return count, size
+}
+
+// consumedCapacity returns the ConsumedCapacity block if the caller asked
+// for one. Writes cost one unit per KB, strongly consistent reads one unit
+// per 4 KB and eventually consistent reads half that.
+func consumedCapacity(mode, table string, item Item, write, consistent bool) *ConsumedCapacity {
+	if mode == "" || mode == "NONE" {
+		return nil
+	}
+	size := float64(itemSize(item))
+	var units float64
+	if write {
+		units = math.Max(1, math.Ceil(size/1024))
+	} else {
+		units = math.Max(1, math.Ceil(size/4096))
+		if !consistent {
+			units /= 2
+		}
+	}
+	return &ConsumedCapacity{TableName: table, CapacityUnits: units}
+}
+
+// returnValues builds the Attributes of a write response. changed lists
+// the paths an update touched, for UPDATED_OLD and UPDATED_NEW.
+func returnValues(mode string, old, item Item, changed []docPath) Item {
+	var out Item
+	switch mode {
+	case "ALL_OLD":
+		out = old
+	case "ALL_NEW":
+		out = item
+	case "UPDATED_OLD":
+		out = projectPaths(old, changed)
+	case "UPDATED_NEW":
+		out = projectPaths(item, changed)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// applyAttributeUpdates applies a legacy AttributeUpdates map to item and
+// returns the names it changed.
+func applyAttributeUpdates(td *TableDescription, item Item, updates map[string]AttributeValueUpdate) ([]string, *ddbError) {
+	hash, rng := keyNames(td.KeySchema)
+	names := make([]string, 0, len(updates))
+	for name := range updates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		update := updates[name]
+		if name == hash || name == rng {
+			return nil, errValidation("One or more parameter values were invalid: Cannot update attribute " + name +
+				". This attribute is part of the key")
+		}
+		if update.Value != nil {
+			if err := validateValue(*update.Value); err != nil {
+				return nil, errValidation(err.Error())
+			}
+		}
+		action := update.Action
+		if action == "" {
+			action = "PUT"
+		}
+		current, exists := item[name]
+
+		switch action {
+		case "PUT":
+			if update.Value == nil {
+				return nil, errValidation("One or more parameter values were invalid: " +
+					"Only DELETE action is allowed when no attribute value is specified")
+			}
+			item[name] = normalizeValue(*update.Value)
+
+		case "DELETE":
+			if update.Value == nil {
+				delete(item, name)
+				continue
+			}
+			if !isSetType(update.Value.Type()) {
+				return nil, errValidation("One or more parameter values were invalid: " +
+					"DELETE action with value is not supported for the type " + update.Value.Type())
+			}
+			if !exists {
+				continue
+			}
+			if current.Type() != update.Value.Type() {
+				return nil, errValidation("Type mismatch for attribute to update")
+			}
+			if rest, ok := setDifference(current, *update.Value); ok {
+				item[name] = rest
+			} else {
+				delete(item, name)
+			}
+
+		case "ADD":
+			if update.Value == nil {
+				return nil, errValidation("One or more parameter values were invalid: " +
+					"Only DELETE action is allowed when no attribute value is specified")
+			}
+			value := normalizeValue(*update.Value)
+			typ := value.Type()
+			if typ != "N" && !isSetType(typ) && typ != "L" {
+				return nil, errValidation("One or more parameter values were invalid: " +
+					"ADD action is not supported for the type " + typ)
+			}
+			if !exists {
+				item[name] = value
+				continue
+			}
+			if current.Type() != typ {
+				return nil, errValidation("Type mismatch for attribute to update")
+			}
+			switch {
+			case typ == "N":
+				sum, err := addNumbers(current, value)
+				if err != nil {
+					return nil, errValidation(err.Error())
+				}
+				item[name] = sum
+			case typ == "L":
+				item[name] = AttributeValue{L: append(append([]AttributeValue{}, current.L...), value.L...)}
+			default:
+				item[name] = setUnion(current, value)
+			}
+
+		default:
+			return nil, errValidation("1 validation error detected: Value '" + action +
+				"' at 'attributeUpdates." + name + ".member.action' failed to satisfy constraint: " +
+				"Member must satisfy enum value set: [ADD, PUT, DELETE]")
+		}
+	}
+	return names, nil
+}
+
+// validateReturnValues checks ReturnValues and
+// ReturnValuesOnConditionCheckFailure for a write operation.
+func validateReturnValues(mode, onFailure string, update bool) *ddbError {
+	switch mode {
+	case "", "NONE", "ALL_OLD":
+	case "ALL_NEW", "UPDATED_OLD", "UPDATED_NEW":
+		if !update {
+			return errValidation("ReturnValues can only be ALL_OLD or NONE")
+		}
+	default:
+		if update {
+			return errValidation("ReturnValues can only be NONE, ALL_OLD, UPDATED_OLD, ALL_NEW or UPDATED_NEW")
+		}
+		return errValidation("ReturnValues can only be ALL_OLD or NONE")
+	}
+	switch onFailure {
+	case "", "NONE", "ALL_OLD":
+		return nil
+	}
+	return errValidation("1 validation error detected: Value '" + onFailure + "' at 'returnValuesOnConditionCheckFailure' " +
+		"failed to satisfy constraint: Member must satisfy enum value set: [ALL_OLD, NONE]")
+}
+
+// PutItem creates or replaces an item
+func (h *Handler) PutItem(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req PutItemInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := validateReturnValues(req.ReturnValues, req.ReturnValuesOnConditionCheckFailure, false); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	ctx, derr := newExprContext(req.ExpressionAttributeNames, req.ExpressionAttributeValues)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	cond, derr := ctx.condition("ConditionExpression", req.ConditionExpression)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := ctx.checkUnused(); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	defer h.lockTables(ns, true, req.TableName)()
+
+	td, derr := h.loadTable(r.Context(), ns, req.TableName)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := validateItem(td, req.Item); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	item := normalizeItem(req.Item)
+
+	old, derr := h.getItem(r.Context(), ns, td, primaryKey(td.KeySchema, item))
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := checkCondition(cond, old, req.ReturnValuesOnConditionCheckFailure); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := h.writeItem(r.Context(), h.Store, ns, td, old, item); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, PutItemOutput{
+		Attributes:       returnValues(req.ReturnValues, old, item, nil),
+		ConsumedCapacity: consumedCapacity(req.ReturnConsumedCapacity, td.TableName, item, true, true),
+	})
+}
+
+// GetItem returns a single item by primary key
+func (h *Handler) GetItem(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req GetItemInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if req.AttributesToGet != nil && req.ProjectionExpression != "" {
+		writeError(w, errValidation("Can not use both expression and non-expression parameters in the same request: "+
+			"Non-expression parameters: {AttributesToGet} Expression parameters: {ProjectionExpression}"))
+		return
+	}
+
+	ctx, derr := newExprContext(req.ExpressionAttributeNames, nil)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	projection, derr := ctx.projection(req.ProjectionExpression)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if projection == nil {
+		projection = topLevelPaths(req.AttributesToGet)
+	}
+	if derr := ctx.checkUnused(); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	defer h.lockTables(ns, false, req.TableName)()
+
+	td, derr := h.loadTable(r.Context(), ns, req.TableName)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := validateKey(td, req.Key); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	item, derr := h.getItem(r.Context(), ns, td, normalizeItem(req.Key))
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, GetItemOutput{
+		Item:             projectPaths(item, projection),
+		ConsumedCapacity: consumedCapacity(req.ReturnConsumedCapacity, td.TableName, item, false, req.ConsistentRead),
+	})
+}
+
+// DeleteItem deletes a single item by primary key
+func (h *Handler) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req DeleteItemInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := validateReturnValues(req.ReturnValues, req.ReturnValuesOnConditionCheckFailure, false); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	ctx, derr := newExprContext(req.ExpressionAttributeNames, req.ExpressionAttributeValues)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	cond, derr := ctx.condition("ConditionExpression", req.ConditionExpression)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := ctx.checkUnused(); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	defer h.lockTables(ns, true, req.TableName)()
+
+	td, derr := h.loadTable(r.Context(), ns, req.TableName)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := validateKey(td, req.Key); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	old, derr := h.getItem(r.Context(), ns, td, normalizeItem(req.Key))
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := checkCondition(cond, old, req.ReturnValuesOnConditionCheckFailure); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := h.writeItem(r.Context(), h.Store, ns, td, old, nil); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, DeleteItemOutput{
+		Attributes:       returnValues(req.ReturnValues, old, nil, nil),
+		ConsumedCapacity: consumedCapacity(req.ReturnConsumedCapacity, td.TableName, old, true, true),
+	})
+}
+
+// UpdateItem edits the attributes of an item, creating it if needed
+func (h *Handler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req UpdateItemInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := validateReturnValues(req.ReturnValues, req.ReturnValuesOnConditionCheckFailure, true); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if req.AttributeUpdates != nil && req.UpdateExpression != "" {
+		writeError(w, errValidation("Can not use both expression and non-expression parameters in the same request: "+
+			"Non-expression parameters: {AttributeUpdates} Expression parameters: {UpdateExpression}"))
+		return
+	}
+
+	ctx, derr := newExprContext(req.ExpressionAttributeNames, req.ExpressionAttributeValues)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	var update *updateExpr
+	if req.UpdateExpression != "" {
+		if update, derr = ctx.update(req.UpdateExpression); derr != nil {
+			writeError(w, derr)
+			return
+		}
+	}
+	cond, derr := ctx.condition("ConditionExpression", req.ConditionExpression)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := ctx.checkUnused(); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	defer h.lockTables(ns, true, req.TableName)()
+
+	td, derr := h.loadTable(r.Context(), ns, req.TableName)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := validateKey(td, req.Key); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	key := normalizeItem(req.Key)
+
+	old, derr := h.getItem(r.Context(), ns, td, key)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := checkCondition(cond, old, req.ReturnValuesOnConditionCheckFailure); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	item := copyItem(old)
+	if item == nil {
+		item = copyItem(key)
+	}
+	var changed []docPath
+	if update != nil {
+		hash, rng := keyNames(td.KeySchema)
+		if derr := applyUpdate(update, item, hash, rng); derr != nil {
+			writeError(w, derr)
+			return
+		}
+		changed = update.paths()
+	} else {
+		names, derr := applyAttributeUpdates(td, item, req.AttributeUpdates)
+		if derr != nil {
+			writeError(w, derr)
+			return
+		}
+		changed = topLevelPaths(names)
+	}
+	for _, v := range item {
+		if err := validateValue(v); err != nil {
+			writeError(w, errValidation(err.Error()))
+			return
+		}
+	}
+	if itemSize(item) > maxItemSize {
+		writeError(w, errValidation("Item size to update has exceeded the maximum allowed size"))
+		return
+	}
+	if derr := h.writeItem(r.Context(), h.Store, ns, td, old, item); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, UpdateItemOutput{
+		Attributes:       returnValues(req.ReturnValues, old, item, changed),
+		ConsumedCapacity: consumedCapacity(req.ReturnConsumedCapacity, td.TableName, item, true, true),
+	})
+}
@@ -0,0 +1,195 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"opensnack/internal/api/dynamodb"
+	"opensnack/internal/resource"
+)
+
+func TestPutGetDeleteItem(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+
+	item := `{"pk":{"S":"u1"},"age":{"N":"30.50"},"tags":{"SS":["a","b"]},` +
+		`"profile":{"M":{"active":{"BOOL":true},"nick":{"NULL":true}}},"history":{"L":[]},"raw":{"B":"AQI="}}`
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":`+item+`}`, nil)
+
+	var got dynamodb.GetItemOutput
+	mustCall(t, h, "GetItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}}}`, &got)
+	want := `{"age":{"N":"30.5"},"history":{"L":[]},"pk":{"S":"u1"},` +
+		`"profile":{"M":{"active":{"BOOL":true},"nick":{"NULL":true}}},"raw":{"B":"AQI="},"tags":{"SS":["a","b"]}}`
+	if itemJSON(got.Item) != want {
+		t.Fatalf("unexpected item:\n got %s\nwant %s", itemJSON(got.Item), want)
+	}
+
+	var projected dynamodb.GetItemOutput
+	mustCall(t, h, "GetItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}},"AttributesToGet":["age"]}`, &projected)
+	if itemJSON(projected.Item) != `{"age":{"N":"30.5"}}` {
+		t.Fatalf("unexpected projection: %s", itemJSON(projected.Item))
+	}
+
+	// Replacing returns the previous image.
+	var put dynamodb.PutItemOutput
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"u1"},"age":{"N":"31"}},"ReturnValues":"ALL_OLD"}`, &put)
+	if *put.Attributes["age"].N != "30.5" {
+		t.Fatalf("expected ALL_OLD image, got %s", itemJSON(put.Attributes))
+	}
+
+	var del dynamodb.DeleteItemOutput
+	mustCall(t, h, "DeleteItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}},"ReturnValues":"ALL_OLD"}`, &del)
+	if itemJSON(del.Attributes) != `{"age":{"N":"31"},"pk":{"S":"u1"}}` {
+		t.Fatalf("unexpected deleted image: %s", itemJSON(del.Attributes))
+	}
+
+	got = dynamodb.GetItemOutput{}
+	mustCall(t, h, "GetItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}}}`, &got)
+	if got.Item != nil {
+		t.Fatalf("expected no item after delete, got %s", itemJSON(got.Item))
+	}
+}
+
+func TestItem_CompositeKey(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "events", true)
+
+	mustCall(t, h, "PutItem", `{"TableName":"events","Item":{"pk":{"S":"a/b"},"sk":{"N":"1"},"v":{"S":"one"}}}`, nil)
+	mustCall(t, h, "PutItem", `{"TableName":"events","Item":{"pk":{"S":"a/b"},"sk":{"N":"2"},"v":{"S":"two"}}}`, nil)
+
+	// Numerically equal keys address the same item.
+	var got dynamodb.GetItemOutput
+	mustCall(t, h, "GetItem", `{"TableName":"events","Key":{"pk":{"S":"a/b"},"sk":{"N":"1.0"}}}`, &got)
+	if got.Item == nil || *got.Item["v"].S != "one" {
+		t.Fatalf("expected item one, got %s", itemJSON(got.Item))
+	}
+
+	var desc dynamodb.DescribeTableOutput
+	mustCall(t, h, "DescribeTable", `{"TableName":"events"}`, &desc)
+	if desc.Table.ItemCount != 2 {
+		t.Fatalf("expected ItemCount 2, got %d", desc.Table.ItemCount)
+	}
+
+	// Dropping the table drops its items.
+	mustCall(t, h, "DeleteTable", `{"TableName":"events"}`, nil)
+	createTable(t, h, "events", true)
+	got = dynamodb.GetItemOutput{}
+	mustCall(t, h, "GetItem", `{"TableName":"events","Key":{"pk":{"S":"a/b"},"sk":{"N":"1"}}}`, &got)
+	if got.Item != nil {
+		t.Fatalf("items should not survive DeleteTable, got %s", itemJSON(got.Item))
+	}
+}
+
+func TestItem_Validation(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "events", true)
+
+	cases := []struct {
+		op, body, want string
+	}{
+		{"PutItem", `{"TableName":"events","Item":{"pk":{"S":"a"}}}`, "Missing the key sk in the item"},
+		{"PutItem", `{"TableName":"events","Item":{"pk":{"S":"a"},"sk":{"S":"1"}}}`, "Type mismatch for key sk expected: N actual: S"},
+		{"PutItem", `{"TableName":"events","Item":{"pk":{"S":""},"sk":{"N":"1"}}}`, "cannot contain an empty string value"},
+		{"PutItem", `{"TableName":"events","Item":{"pk":{"S":"a"},"sk":{"N":"x"}}}`, "cannot be converted into a number"},
+		{"PutItem", `{"TableName":"events","Item":{"pk":{"S":"a"},"sk":{"N":"1"},"s":{"SS":[]}}}`, "may not be empty"},
+		{"PutItem", `{"TableName":"events","Item":{"pk":{"S":"a"},"sk":{"N":"1"},"bad":{}}}`, "Supplied AttributeValue is empty"},
+		{"PutItem", `{"TableName":"events","Item":{"pk":{"S":"a"},"sk":{"N":"1"}},"ReturnValues":"ALL_NEW"}`, "ReturnValues"},
+		{"GetItem", `{"TableName":"events","Key":{"pk":{"S":"a"}}}`, "does not match the schema"},
+		{"GetItem", `{"TableName":"events","Key":{"pk":{"S":"a"},"sk":{"N":"1"},"x":{"S":"y"}}}`, "does not match the schema"},
+		{"DeleteItem", `{"TableName":"events","Key":{"pk":{"N":"1"},"sk":{"N":"1"}}}`, "does not match the schema"},
+		{"UpdateItem", `{"TableName":"events","Key":{"pk":{"S":"a"},"sk":{"N":"1"}},"AttributeUpdates":{"sk":{"Action":"PUT","Value":{"N":"2"}}}}`, "part of the key"},
+	}
+	for _, tc := range cases {
+		if msg := expectError(t, h, tc.op, tc.body, "ValidationException"); !strings.Contains(msg, tc.want) {
+			t.Errorf("%s %s: expected %q in %q", tc.op, tc.body, tc.want, msg)
+		}
+	}
+
+	expectError(t, h, "GetItem", `{"TableName":"missing","Key":{"pk":{"S":"a"}}}`, "ResourceNotFoundException")
+}
+
+func TestUpdateItem_AttributeUpdates(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+
+	// UpdateItem creates the item when it does not exist.
+	var out dynamodb.UpdateItemOutput
+	mustCall(t, h, "UpdateItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}},`+
+		`"AttributeUpdates":{"name":{"Value":{"S":"ann"}},"visits":{"Action":"ADD","Value":{"N":"1"}},`+
+		`"tags":{"Action":"ADD","Value":{"SS":["a","b"]}}},"ReturnValues":"ALL_NEW"}`, &out)
+	if itemJSON(out.Attributes) != `{"name":{"S":"ann"},"pk":{"S":"u1"},"tags":{"SS":["a","b"]},"visits":{"N":"1"}}` {
+		t.Fatalf("unexpected ALL_NEW: %s", itemJSON(out.Attributes))
+	}
+
+	out = dynamodb.UpdateItemOutput{}
+	mustCall(t, h, "UpdateItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}},`+
+		`"AttributeUpdates":{"visits":{"Action":"ADD","Value":{"N":"2.5"}},"tags":{"Action":"DELETE","Value":{"SS":["a"]}}},`+
+		`"ReturnValues":"UPDATED_OLD"}`, &out)
+	if itemJSON(out.Attributes) != `{"tags":{"SS":["a","b"]},"visits":{"N":"1"}}` {
+		t.Fatalf("unexpected UPDATED_OLD: %s", itemJSON(out.Attributes))
+	}
+
+	out = dynamodb.UpdateItemOutput{}
+	mustCall(t, h, "UpdateItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}},`+
+		`"AttributeUpdates":{"name":{"Action":"DELETE"},"tags":{"Action":"DELETE","Value":{"SS":["b"]}},`+
+		`"visits":{"Action":"ADD","Value":{"N":"-0.5"}}},"ReturnValues":"UPDATED_NEW"}`, &out)
+	if itemJSON(out.Attributes) != `{"visits":{"N":"3"}}` {
+		t.Fatalf("unexpected UPDATED_NEW: %s", itemJSON(out.Attributes))
+	}
+
+	var got dynamodb.GetItemOutput
+	mustCall(t, h, "GetItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}}}`, &got)
+	if itemJSON(got.Item) != `{"pk":{"S":"u1"},"visits":{"N":"3"}}` {
+		t.Fatalf("unexpected stored item: %s", itemJSON(got.Item))
+	}
+
+	msg := expectError(t, h, "UpdateItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}},`+
+		`"AttributeUpdates":{"visits":{"Action":"ADD","Value":{"S":"x"}}}}`, "ValidationException")
+	if !strings.Contains(msg, "ADD action is not supported for the type S") {
+		t.Fatalf("unexpected message: %s", msg)
+	}
+}
+
+func TestUpdateItem_Concurrent(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "a", false)
+	createTable(t, h, "b", false)
+
+	add := func(table string) string {
+		return `{"TableName":"` + table + `","Key":{"pk":{"S":"n"}},"UpdateExpression":"ADD c :one",` +
+			`"ExpressionAttributeValues":{":one":{"N":"1"}}}`
+	}
+	// Transactions lock both tables, whichever order they name them in.
+	both := func(first, second string) string {
+		return `{"TransactItems":[{"Update":` + add(first) + `},{"Update":` + add(second) + `}]}`
+	}
+	var wg sync.WaitGroup
+	for range 20 {
+		for _, req := range []struct{ op, body string }{
+			{"UpdateItem", add("a")},
+			{"UpdateItem", add("b")},
+			{"TransactWriteItems", both("a", "b")},
+			{"TransactWriteItems", both("b", "a")},
+		} {
+			wg.Go(func() {
+				if rec := call(t, h, req.op, req.body, nil); rec.Code != 200 {
+					t.Errorf("%s failed: %d %s", req.op, rec.Code, rec.Body.String())
+				}
+			})
+		}
+	}
+	wg.Wait()
+
+	for _, table := range []string{"a", "b"} {
+		var out dynamodb.GetItemOutput
+		mustCall(t, h, "GetItem", `{"TableName":"`+table+`","Key":{"pk":{"S":"n"}}}`, &out)
+		if got := itemJSON(out.Item); got != `{"c":{"N":"60"},"pk":{"S":"n"}}` {
+			t.Fatalf("%s: expected every increment to apply, got %s", table, got)
+		}
+	}
+}
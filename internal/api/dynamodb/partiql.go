@@ -0,0 +1,1003 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+//
+// PARTIQL
+//
+// ExecuteStatement, BatchExecuteStatement and ExecuteTransaction accept
+// DynamoDB's dialect of PartiQL: SELECT, INSERT, UPDATE and DELETE on a
+// single table, plus EXISTS(SELECT ...) as a transaction condition check.
+// Statements are parsed into the same condition and update trees as the
+// expression parameters, so a WHERE clause is evaluated exactly like a
+// FilterExpression and the SET/REMOVE clauses of an UPDATE exactly like an
+// UpdateExpression. Literals and ? parameters become values at parse time.
+//
+
+type pqlKind int
+
+const (
+	pqlEOF    pqlKind = iota
+	pqlIdent          // keyword or unquoted identifier
+	pqlQuoted         // "quoted identifier"
+	pqlString         // 'string literal'
+	pqlNumber         // numeric literal
+	pqlParam          // ?
+	pqlPunct          // = <> != < <= > >= ( ) , . [ ] { } : + - * << >>
+)
+
+type pqlToken struct {
+	kind pqlKind
+	text string
+}
+
+// statement is a parsed PartiQL statement.
+type statement struct {
+	verb       string // SELECT, INSERT, UPDATE, DELETE or EXISTS
+	table      string
+	index      string
+	projection []docPath // nil selects every attribute
+	where      *condExpr
+	orderBy    docPath
+	descending bool
+	item       Item // INSERT
+	update     *updateExpr
+	returning  string // in ReturnValues spelling, e.g. ALL_OLD
+}
+
+// isRead reports whether the statement only reads.
+func (s *statement) isRead() bool { return s.verb == "SELECT" || s.verb == "EXISTS" }
+
+func errStatement(detail string) *ddbError {
+	return errValidation("Statement wasn't well formed, can't be processed: " + detail)
+}
+
+var errParameterCount = errValidation("Number of parameters in request and statement don't match.")
+
+// parseStatement parses one statement, substituting params for its ?
+// placeholders in order.
+func parseStatement(text string, params []AttributeValue) (*statement, *ddbError) {
+	for _, v := range params {
+		if err := validateValue(v); err != nil {
+			return nil, errValidation(err.Error())
+		}
+	}
+	toks, derr := lexPartiQL(text)
+	if derr != nil {
+		return nil, derr
+	}
+	p := &pqlParser{toks: toks, params: params}
+
+	var st *statement
+	switch {
+	case p.isKeyword("SELECT"):
+		st, derr = p.parseSelect()
+	case p.isKeyword("INSERT"):
+		st, derr = p.parseInsert()
+	case p.isKeyword("UPDATE"):
+		st, derr = p.parseUpdate()
+	case p.isKeyword("DELETE"):
+		st, derr = p.parseDelete()
+	case p.isKeyword("EXISTS"):
+		st, derr = p.parseExists()
+	default:
+		derr = p.unexpected()
+	}
+	if derr != nil {
+		return nil, derr
+	}
+	if p.peek().kind != pqlEOF {
+		return nil, p.unexpected()
+	}
+	if p.used != len(params) {
+		return nil, errParameterCount
+	}
+	return st, nil
+}
+
+//
+// LEXER
+//
+
+func lexPartiQL(text string) ([]pqlToken, *ddbError) {
+	var toks []pqlToken
+	isWord := func(c byte) bool {
+		return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+	}
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			j := i + 1
+			for {
+				if j >= len(text) {
+					return nil, errStatement("Unterminated literal starting at " + strconv.Itoa(i))
+				}
+				if text[j] == c {
+					if j+1 < len(text) && text[j+1] == c {
+						b.WriteByte(c)
+						j += 2
+						continue
+					}
+					break
+				}
+				b.WriteByte(text[j])
+				j++
+			}
+			k := pqlString
+			if c == '"' {
+				k = pqlQuoted
+			}
+			toks = append(toks, pqlToken{k, b.String()})
+			i = j + 1
+		case isDigit(c) || (c == '.' && i+1 < len(text) && isDigit(text[i+1])):
+			j := i
+			for j < len(text) && isDigit(text[j]) {
+				j++
+			}
+			if j < len(text) && text[j] == '.' {
+				j++
+				for j < len(text) && isDigit(text[j]) {
+					j++
+				}
+			}
+			if j < len(text) && (text[j] == 'e' || text[j] == 'E') {
+				k := j + 1
+				if k < len(text) && (text[k] == '+' || text[k] == '-') {
+					k++
+				}
+				if k < len(text) && isDigit(text[k]) {
+					for j = k; j < len(text) && isDigit(text[j]); j++ {
+					}
+				}
+			}
+			toks = append(toks, pqlToken{pqlNumber, text[i:j]})
+			i = j
+		case isWord(c):
+			j := i
+			for j < len(text) && isWord(text[j]) {
+				j++
+			}
+			toks = append(toks, pqlToken{pqlIdent, text[i:j]})
+			i = j
+		case c == '?':
+			toks = append(toks, pqlToken{pqlParam, "?"})
+			i++
+		case i+1 < len(text) && (text[i:i+2] == "<>" || text[i:i+2] == "!=" || text[i:i+2] == "<=" ||
+			text[i:i+2] == ">=" || text[i:i+2] == "<<" || text[i:i+2] == ">>"):
+			toks = append(toks, pqlToken{pqlPunct, text[i : i+2]})
+			i += 2
+		case strings.IndexByte("=<>(),.[]{}:+-*", c) >= 0:
+			toks = append(toks, pqlToken{pqlPunct, string(c)})
+			i++
+		default:
+			return nil, errStatement("Unexpected character '" + string(c) + "'")
+		}
+	}
+	return append(toks, pqlToken{pqlEOF, ""}), nil
+}
+
+//
+// PARSER
+//
+
+type pqlParser struct {
+	toks   []pqlToken
+	pos    int
+	params []AttributeValue
+	used   int
+}
+
+// reservedWords cannot be used as unquoted table or attribute names.
+var reservedWords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "OR": true, "NOT": true,
+	"BETWEEN": true, "IN": true, "IS": true, "MISSING": true, "NULL": true, "TRUE": true,
+	"FALSE": true, "INSERT": true, "INTO": true, "VALUE": true, "UPDATE": true, "SET": true,
+	"REMOVE": true, "DELETE": true, "RETURNING": true, "ORDER": true, "BY": true, "EXISTS": true,
+}
+
+func (p *pqlParser) peek() pqlToken { return p.toks[p.pos] }
+
+func (p *pqlParser) next() pqlToken {
+	t := p.toks[p.pos]
+	if t.kind != pqlEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *pqlParser) isKeyword(word string) bool {
+	t := p.peek()
+	return t.kind == pqlIdent && strings.EqualFold(t.text, word)
+}
+
+func (p *pqlParser) isPunct(punct string) bool {
+	t := p.peek()
+	return t.kind == pqlPunct && t.text == punct
+}
+
+func (p *pqlParser) accept(punct string) bool {
+	if p.isPunct(punct) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *pqlParser) acceptKeyword(word string) bool {
+	if p.isKeyword(word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *pqlParser) unexpected() *ddbError {
+	t := p.peek()
+	switch t.kind {
+	case pqlEOF:
+		return errStatement("Unexpected end of statement")
+	case pqlString:
+		return errStatement("Unexpected token: '" + t.text + "'")
+	case pqlQuoted:
+		return errStatement("Unexpected token: \"" + t.text + "\"")
+	}
+	return errStatement("Unexpected token: " + t.text)
+}
+
+func (p *pqlParser) expect(punct string) *ddbError {
+	if !p.accept(punct) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *pqlParser) expectKeyword(word string) *ddbError {
+	if !p.acceptKeyword(word) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+// isCall reports whether the next tokens are a function call.
+func (p *pqlParser) isCall() bool {
+	next := p.toks[min(p.pos+1, len(p.toks)-1)]
+	return p.peek().kind == pqlIdent && next.kind == pqlPunct && next.text == "("
+}
+
+// identifier parses a table, index or attribute name.
+func (p *pqlParser) identifier() (string, *ddbError) {
+	t := p.peek()
+	switch {
+	case t.kind == pqlQuoted:
+	case t.kind == pqlIdent && !reservedWords[strings.ToUpper(t.text)]:
+	default:
+		return "", p.unexpected()
+	}
+	p.next()
+	return t.text, nil
+}
+
+func (p *pqlParser) parseTarget(st *statement) *ddbError {
+	var derr *ddbError
+	if st.table, derr = p.identifier(); derr != nil {
+		return derr
+	}
+	if p.accept(".") {
+		if st.index, derr = p.identifier(); derr != nil {
+			return derr
+		}
+	}
+	return nil
+}
+
+func (p *pqlParser) parsePath() (docPath, *ddbError) {
+	name, derr := p.identifier()
+	if derr != nil {
+		return nil, derr
+	}
+	path := docPath{{name: name}}
+	for {
+		switch {
+		case p.accept("."):
+			name, derr := p.identifier()
+			if derr != nil {
+				return nil, derr
+			}
+			path = append(path, pathElem{name: name})
+		case p.accept("["):
+			t := p.peek()
+			switch t.kind {
+			case pqlNumber:
+				n, err := strconv.Atoi(t.text)
+				if err != nil || n < 0 {
+					return nil, errStatement("Invalid list index: " + t.text)
+				}
+				path = append(path, pathElem{index: n, isIndex: true})
+			case pqlString:
+				path = append(path, pathElem{name: t.text})
+			default:
+				return nil, p.unexpected()
+			}
+			p.next()
+			if derr := p.expect("]"); derr != nil {
+				return nil, derr
+			}
+		default:
+			return path, nil
+		}
+	}
+}
+
+func (p *pqlParser) parseWhere(st *statement, required bool) *ddbError {
+	if !p.acceptKeyword("WHERE") {
+		if required {
+			return p.unexpected()
+		}
+		return nil
+	}
+	var derr *ddbError
+	st.where, derr = p.parseOr()
+	return derr
+}
+
+func (p *pqlParser) parseSelect() (*statement, *ddbError) {
+	p.next()
+	st := &statement{verb: "SELECT"}
+	if !p.accept("*") {
+		for {
+			path, derr := p.parsePath()
+			if derr != nil {
+				return nil, derr
+			}
+			st.projection = append(st.projection, path)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if derr := checkOverlap("ProjectionExpression", st.projection); derr != nil {
+			return nil, derr
+		}
+	}
+	if derr := p.expectKeyword("FROM"); derr != nil {
+		return nil, derr
+	}
+	if derr := p.parseTarget(st); derr != nil {
+		return nil, derr
+	}
+	if derr := p.parseWhere(st, false); derr != nil {
+		return nil, derr
+	}
+	if p.acceptKeyword("ORDER") {
+		if derr := p.expectKeyword("BY"); derr != nil {
+			return nil, derr
+		}
+		var derr *ddbError
+		if st.orderBy, derr = p.parsePath(); derr != nil {
+			return nil, derr
+		}
+		if p.acceptKeyword("DESC") {
+			st.descending = true
+		} else {
+			p.acceptKeyword("ASC")
+		}
+	}
+	return st, nil
+}
+
+func (p *pqlParser) parseExists() (*statement, *ddbError) {
+	p.next()
+	if derr := p.expect("("); derr != nil {
+		return nil, derr
+	}
+	if !p.isKeyword("SELECT") {
+		return nil, p.unexpected()
+	}
+	st, derr := p.parseSelect()
+	if derr != nil {
+		return nil, derr
+	}
+	if derr := p.expect(")"); derr != nil {
+		return nil, derr
+	}
+	st.verb = "EXISTS"
+	return st, nil
+}
+
+func (p *pqlParser) parseInsert() (*statement, *ddbError) {
+	p.next()
+	st := &statement{verb: "INSERT"}
+	if derr := p.expectKeyword("INTO"); derr != nil {
+		return nil, derr
+	}
+	if derr := p.parseTarget(st); derr != nil {
+		return nil, derr
+	}
+	if derr := p.expectKeyword("VALUE"); derr != nil {
+		return nil, derr
+	}
+	v, derr := p.parseLiteral()
+	if derr != nil {
+		return nil, derr
+	}
+	if v.M == nil {
+		return nil, errValidation("Unsupported operation: Inserting a value that is not a tuple is not supported")
+	}
+	st.item = normalizeItem(v.M)
+	return st, nil
+}
+
+func (p *pqlParser) parseUpdate() (*statement, *ddbError) {
+	p.next()
+	st := &statement{verb: "UPDATE", update: &updateExpr{}}
+	if derr := p.parseTarget(st); derr != nil {
+		return nil, derr
+	}
+	for {
+		if p.acceptKeyword("SET") {
+			if derr := p.parseAssignments(st.update); derr != nil {
+				return nil, derr
+			}
+		} else if p.acceptKeyword("REMOVE") {
+			for {
+				path, derr := p.parsePath()
+				if derr != nil {
+					return nil, derr
+				}
+				st.update.remove = append(st.update.remove, updateAction{path: path})
+				if !p.accept(",") {
+					break
+				}
+			}
+		} else {
+			break
+		}
+	}
+	if len(st.update.paths()) == 0 {
+		return nil, p.unexpected()
+	}
+	if derr := checkOverlap("UpdateExpression", st.update.paths()); derr != nil {
+		return nil, derr
+	}
+	if derr := p.parseWhere(st, true); derr != nil {
+		return nil, derr
+	}
+	return st, p.parseReturning(st)
+}
+
+// parseAssignments parses "path = value, ..." after SET. set_add and
+// set_delete become ADD and DELETE actions.
+func (p *pqlParser) parseAssignments(u *updateExpr) *ddbError {
+	for {
+		path, derr := p.parsePath()
+		if derr != nil {
+			return derr
+		}
+		if derr := p.expect("="); derr != nil {
+			return derr
+		}
+		if fn := strings.ToLower(p.peek().text); p.isCall() && (fn == "set_add" || fn == "set_delete") {
+			p.next()
+			p.next()
+			target, derr := p.parsePath()
+			if derr != nil {
+				return derr
+			}
+			if comparePaths(target, path) != 0 {
+				return errValidation(fn + " must modify the attribute it is assigned to: " + path.String())
+			}
+			if derr := p.expect(","); derr != nil {
+				return derr
+			}
+			v, derr := p.parseLiteral()
+			if derr != nil {
+				return derr
+			}
+			if derr := p.expect(")"); derr != nil {
+				return derr
+			}
+			action := updateAction{path: path, value: &operand{kind: operandValue, value: normalizeValue(v)}}
+			if fn == "set_add" {
+				u.add = append(u.add, action)
+			} else {
+				u.del = append(u.del, action)
+			}
+		} else {
+			value, derr := p.parseSetValue()
+			if derr != nil {
+				return derr
+			}
+			u.set = append(u.set, updateAction{path: path, value: value})
+		}
+		if !p.accept(",") {
+			return nil
+		}
+	}
+}
+
+// parseSetValue parses the right-hand side of a SET assignment.
+func (p *pqlParser) parseSetValue() (*operand, *ddbError) {
+	left, derr := p.parseSetOperand()
+	if derr != nil {
+		return nil, derr
+	}
+	if t := p.peek(); t.kind == pqlPunct && (t.text == "+" || t.text == "-") {
+		p.next()
+		right, derr := p.parseSetOperand()
+		if derr != nil {
+			return nil, derr
+		}
+		return &operand{kind: operandArith, name: t.text, args: []*operand{left, right}}, nil
+	}
+	return left, nil
+}
+
+func (p *pqlParser) parseSetOperand() (*operand, *ddbError) {
+	if p.isCall() {
+		fn := strings.ToLower(p.next().text)
+		if fn != "list_append" {
+			return nil, errValidation("Unsupported function in SET clause: " + fn)
+		}
+		args, derr := p.parseArgs(p.parseSetValue)
+		if derr != nil {
+			return nil, derr
+		}
+		if len(args) != 2 {
+			return nil, errValidation("Incorrect number of arguments for function: list_append")
+		}
+		return &operand{kind: operandFunc, name: fn, args: args}, nil
+	}
+	return p.parseOperand()
+}
+
+func (p *pqlParser) parseDelete() (*statement, *ddbError) {
+	p.next()
+	st := &statement{verb: "DELETE"}
+	if derr := p.expectKeyword("FROM"); derr != nil {
+		return nil, derr
+	}
+	if derr := p.parseTarget(st); derr != nil {
+		return nil, derr
+	}
+	if derr := p.parseWhere(st, true); derr != nil {
+		return nil, derr
+	}
+	if derr := p.parseReturning(st); derr != nil {
+		return nil, derr
+	}
+	if st.returning != "" && st.returning != "ALL_OLD" {
+		return nil, errValidation("Unsupported RETURNING clause for DELETE: only ALL OLD * is supported")
+	}
+	return st, nil
+}
+
+// parseReturning parses "RETURNING ALL|MODIFIED OLD|NEW *".
+func (p *pqlParser) parseReturning(st *statement) *ddbError {
+	if !p.acceptKeyword("RETURNING") {
+		return nil
+	}
+	var scope, image string
+	switch {
+	case p.acceptKeyword("ALL"):
+		scope = "ALL_"
+	case p.acceptKeyword("MODIFIED"):
+		scope = "UPDATED_"
+	default:
+		return p.unexpected()
+	}
+	switch {
+	case p.acceptKeyword("OLD"):
+		image = "OLD"
+	case p.acceptKeyword("NEW"):
+		image = "NEW"
+	default:
+		return p.unexpected()
+	}
+	if derr := p.expect("*"); derr != nil {
+		return derr
+	}
+	st.returning = scope + image
+	return nil
+}
+
+//
+// WHERE CLAUSES
+//
+
+func (p *pqlParser) parseOr() (*condExpr, *ddbError) {
+	left, derr := p.parseAnd()
+	if derr != nil {
+		return nil, derr
+	}
+	for p.acceptKeyword("OR") {
+		right, derr := p.parseAnd()
+		if derr != nil {
+			return nil, derr
+		}
+		left = &condExpr{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *pqlParser) parseAnd() (*condExpr, *ddbError) {
+	left, derr := p.parseNot()
+	if derr != nil {
+		return nil, derr
+	}
+	for p.acceptKeyword("AND") {
+		right, derr := p.parseNot()
+		if derr != nil {
+			return nil, derr
+		}
+		left = &condExpr{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *pqlParser) parseNot() (*condExpr, *ddbError) {
+	if p.acceptKeyword("NOT") {
+		inner, derr := p.parseNot()
+		if derr != nil {
+			return nil, derr
+		}
+		return &condExpr{op: "NOT", left: inner}, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *pqlParser) parsePredicate() (*condExpr, *ddbError) {
+	if p.accept("(") {
+		inner, derr := p.parseOr()
+		if derr != nil {
+			return nil, derr
+		}
+		return inner, p.expect(")")
+	}
+
+	if p.isCall() {
+		fn := strings.ToLower(p.peek().text)
+		if arity, ok := conditionFunctions[fn]; ok {
+			p.next()
+			args, derr := p.parseArgs(p.parseOperand)
+			if derr != nil {
+				return nil, derr
+			}
+			if len(args) != arity {
+				return nil, errValidation("Incorrect number of arguments for function: " + fn)
+			}
+			if fn != "begins_with" && fn != "contains" && args[0].kind != operandPath {
+				return nil, errValidation("Function " + fn + " requires a document path as its first argument")
+			}
+			return &condExpr{op: "FUNC", name: fn, args: args}, nil
+		}
+	}
+
+	left, derr := p.parseOperand()
+	if derr != nil {
+		return nil, derr
+	}
+	t := p.peek()
+	switch {
+	case t.kind == pqlPunct && (t.text == "=" || t.text == "<>" || t.text == "!=" || t.text == "<" ||
+		t.text == "<=" || t.text == ">" || t.text == ">="):
+		p.next()
+		right, derr := p.parseOperand()
+		if derr != nil {
+			return nil, derr
+		}
+		op := t.text
+		if op == "!=" {
+			op = "<>"
+		}
+		return &condExpr{op: op, args: []*operand{left, right}}, nil
+
+	case p.acceptKeyword("BETWEEN"):
+		lo, derr := p.parseOperand()
+		if derr != nil {
+			return nil, derr
+		}
+		if derr := p.expectKeyword("AND"); derr != nil {
+			return nil, derr
+		}
+		hi, derr := p.parseOperand()
+		if derr != nil {
+			return nil, derr
+		}
+		return &condExpr{op: "BETWEEN", args: []*operand{left, lo, hi}}, nil
+
+	case p.acceptKeyword("IN"):
+		closing := "]"
+		if p.accept("(") {
+			closing = ")"
+		} else if derr := p.expect("["); derr != nil {
+			return nil, derr
+		}
+		args := []*operand{left}
+		for {
+			v, derr := p.parseOperand()
+			if derr != nil {
+				return nil, derr
+			}
+			args = append(args, v)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if derr := p.expect(closing); derr != nil {
+			return nil, derr
+		}
+		return &condExpr{op: "IN", args: args}, nil
+
+	case p.acceptKeyword("IS"):
+		negate := p.acceptKeyword("NOT")
+		var c *condExpr
+		switch {
+		case p.acceptKeyword("MISSING"):
+			c = &condExpr{op: "FUNC", name: "attribute_not_exists", args: []*operand{left}}
+		case p.acceptKeyword("NULL"):
+			c = &condExpr{op: "FUNC", name: "attribute_type", args: []*operand{left, {kind: operandValue, value: stringValue("NULL")}}}
+		default:
+			return nil, p.unexpected()
+		}
+		if left.kind != operandPath {
+			return nil, errValidation("IS " + strings.TrimPrefix(c.name, "attribute_") + " requires a document path")
+		}
+		if negate {
+			c = &condExpr{op: "NOT", left: c}
+		}
+		return c, nil
+	}
+	return nil, p.unexpected()
+}
+
+// parseArgs parses "( operand, ... )".
+func (p *pqlParser) parseArgs(parse func() (*operand, *ddbError)) ([]*operand, *ddbError) {
+	if derr := p.expect("("); derr != nil {
+		return nil, derr
+	}
+	var args []*operand
+	for {
+		arg, derr := parse()
+		if derr != nil {
+			return nil, derr
+		}
+		args = append(args, arg)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return args, p.expect(")")
+}
+
+// parseOperand parses a path, a literal, a parameter or size(path).
+func (p *pqlParser) parseOperand() (*operand, *ddbError) {
+	t := p.peek()
+	switch {
+	case p.isCall():
+		fn := strings.ToLower(t.text)
+		if fn != "size" {
+			return nil, errValidation("Unsupported function: " + t.text)
+		}
+		p.next()
+		args, derr := p.parseArgs(p.parseOperand)
+		if derr != nil {
+			return nil, derr
+		}
+		if len(args) != 1 || args[0].kind != operandPath {
+			return nil, errValidation("Function size requires a single document path argument")
+		}
+		return &operand{kind: operandFunc, name: fn, args: args}, nil
+	case t.kind == pqlQuoted,
+		t.kind == pqlIdent && !reservedWords[strings.ToUpper(t.text)]:
+		path, derr := p.parsePath()
+		if derr != nil {
+			return nil, derr
+		}
+		return &operand{kind: operandPath, path: path}, nil
+	}
+	v, derr := p.parseLiteral()
+	if derr != nil {
+		return nil, derr
+	}
+	return &operand{kind: operandValue, value: normalizeValue(v)}, nil
+}
+
+// parseLiteral parses a value: a string, number, boolean, NULL, tuple
+// {'k': v}, list [v], set <<v>> or ? parameter.
+func (p *pqlParser) parseLiteral() (AttributeValue, *ddbError) {
+	t := p.peek()
+	switch {
+	case t.kind == pqlParam:
+		p.next()
+		if p.used >= len(p.params) {
+			return AttributeValue{}, errParameterCount
+		}
+		v := p.params[p.used]
+		p.used++
+		return normalizeValue(v), nil
+	case t.kind == pqlString:
+		p.next()
+		return stringValue(t.text), nil
+	case t.kind == pqlNumber:
+		p.next()
+		return p.number(t.text)
+	case p.isPunct("-") && p.toks[p.pos+1].kind == pqlNumber:
+		p.next()
+		return p.number("-" + p.next().text)
+	case p.isKeyword("TRUE"), p.isKeyword("FALSE"):
+		p.next()
+		return boolValue(strings.EqualFold(t.text, "TRUE")), nil
+	case p.isKeyword("NULL"):
+		p.next()
+		null := true
+		return AttributeValue{NULL: &null}, nil
+	case p.accept("{"):
+		m := Item{}
+		for !p.accept("}") {
+			if len(m) > 0 {
+				if derr := p.expect(","); derr != nil {
+					return AttributeValue{}, derr
+				}
+			}
+			k := p.peek()
+			if k.kind != pqlString && k.kind != pqlQuoted {
+				return AttributeValue{}, p.unexpected()
+			}
+			p.next()
+			if derr := p.expect(":"); derr != nil {
+				return AttributeValue{}, derr
+			}
+			v, derr := p.parseLiteral()
+			if derr != nil {
+				return AttributeValue{}, derr
+			}
+			if _, dup := m[k.text]; dup {
+				return AttributeValue{}, errValidation("Duplicate attribute name in tuple: " + k.text)
+			}
+			m[k.text] = v
+		}
+		return AttributeValue{M: m}, nil
+	case p.isPunct("[") || p.isPunct("<<"):
+		open := p.next().text
+		closing := map[string]string{"[": "]", "<<": ">>"}[open]
+		members := []AttributeValue{}
+		for !p.accept(closing) {
+			if len(members) > 0 {
+				if derr := p.expect(","); derr != nil {
+					return AttributeValue{}, derr
+				}
+			}
+			v, derr := p.parseLiteral()
+			if derr != nil {
+				return AttributeValue{}, derr
+			}
+			members = append(members, v)
+		}
+		if open == "[" {
+			return AttributeValue{L: members}, nil
+		}
+		return setLiteral(members)
+	}
+	return AttributeValue{}, p.unexpected()
+}
+
+func (p *pqlParser) number(text string) (AttributeValue, *ddbError) {
+	v := numberValue(text)
+	if err := validateValue(v); err != nil {
+		return AttributeValue{}, errValidation(err.Error())
+	}
+	return normalizeValue(v), nil
+}
+
+// setLiteral builds a string, number or binary set from <<...>> members.
+func setLiteral(members []AttributeValue) (AttributeValue, *ddbError) {
+	if len(members) == 0 {
+		return AttributeValue{}, errValidation("Sets may not be empty")
+	}
+	typ := members[0].Type()
+	for _, m := range members {
+		if m.Type() != typ {
+			return AttributeValue{}, errValidation("Set contains values of different types")
+		}
+	}
+	switch typ {
+	case "S", "N", "B":
+	default:
+		return AttributeValue{}, errValidation("Sets can only contain strings, numbers or binary values")
+	}
+	v := normalizeValue(setFromMembers(typ+"S", members))
+	if err := validateValue(v); err != nil {
+		return AttributeValue{}, errValidation(err.Error())
+	}
+	return v, nil
+}
+
+//
+// KEYS
+//
+
+// conjuncts flattens a chain of ANDs.
+func conjuncts(c *condExpr) []*condExpr {
+	if c == nil {
+		return nil
+	}
+	if c.op == "AND" {
+		return append(conjuncts(c.left), conjuncts(c.right)...)
+	}
+	return []*condExpr{c}
+}
+
+// allOf rebuilds the AND of conds, or nil when there are none.
+func allOf(conds []*condExpr) *condExpr {
+	var out *condExpr
+	for _, c := range conds {
+		if out == nil {
+			out = c
+		} else {
+			out = &condExpr{op: "AND", left: out, right: c}
+		}
+	}
+	return out
+}
+
+// equality returns the attribute and value of an "attr = value" condition
+// on a top-level attribute.
+func equality(c *condExpr) (string, AttributeValue, bool) {
+	if c.op != "=" {
+		return "", AttributeValue{}, false
+	}
+	path, value := c.args[0], c.args[1]
+	if path.kind == operandValue {
+		path, value = value, path
+	}
+	if path.kind != operandPath || value.kind != operandValue || len(path.path) != 1 {
+		return "", AttributeValue{}, false
+	}
+	return path.path[0].name, value.value, true
+}
+
+// splitKey pulls the equalities on names out of a WHERE clause. It
+// returns the values found and the rest of the clause.
+func splitKey(where *condExpr, names ...string) (Item, *condExpr) {
+	key := Item{}
+	var rest []*condExpr
+	for _, c := range conjuncts(where) {
+		name, v, ok := equality(c)
+		if ok {
+			if _, seen := key[name]; !seen && slices.Contains(names, name) {
+				key[name] = v
+				continue
+			}
+		}
+		rest = append(rest, c)
+	}
+	return key, allOf(rest)
+}
+
+// itemKey extracts the full primary key a write or point read must name.
+func (s *statement) itemKey(td *TableDescription) (Item, *condExpr, *ddbError) {
+	hash, rng := keyNames(td.KeySchema)
+	key, rest := splitKey(s.where, hash, rng)
+	if _, ok := key[hash]; !ok {
+		return nil, nil, errValidation("Where clause does not contain a mandatory equality on all key attributes")
+	}
+	if _, ok := key[rng]; rng != "" && !ok {
+		return nil, nil, errValidation("Where clause does not contain a mandatory equality on all key attributes")
+	}
+	if derr := validateKey(td, key); derr != nil {
+		return nil, nil, derr
+	}
+	return key, rest, nil
+}
@@ -0,0 +1,204 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb_test
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"opensnack/internal/api/dynamodb"
+	"opensnack/internal/resource"
+)
+
+// statement builds an ExecuteStatement request body.
+func statement(stmt string, extra string) string {
+	buf, _ := json.Marshal(stmt)
+	return `{"Statement":` + string(buf) + extra + `}`
+}
+
+func TestExecuteStatement_Select(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	seedEvents(t, h)
+
+	var out dynamodb.ExecuteStatementOutput
+	mustCall(t, h, "ExecuteStatement", statement(`SELECT * FROM "events" WHERE pk = 'a' AND sk >= 3`, ""), &out)
+	if sortKeys(out.Items) != "3,4,5" {
+		t.Fatalf("unexpected items: %s", sortKeys(out.Items))
+	}
+
+	out = dynamodb.ExecuteStatementOutput{}
+	mustCall(t, h, "ExecuteStatement", statement(`SELECT sk FROM events WHERE pk = ? AND kind = 'k1' ORDER BY sk DESC`,
+		`,"Parameters":[{"S":"b"}]`), &out)
+	if sortKeys(out.Items) != "5,3,1" || itemJSON(out.Items[0]) != `{"sk":{"N":"5"}}` {
+		t.Fatalf("unexpected ordered items: %+v", out.Items)
+	}
+
+	// A scan filtered on a non-key attribute, two items per page.
+	var keys []string
+	token := ""
+	for pages := 0; ; pages++ {
+		extra := `,"Limit":2`
+		if token != "" {
+			extra += `,"NextToken":"` + token + `"`
+		}
+		out = dynamodb.ExecuteStatementOutput{}
+		mustCall(t, h, "ExecuteStatement", statement(`SELECT pk, sk FROM events WHERE sk BETWEEN 2 AND 3 OR kind IS MISSING`, extra), &out)
+		for _, item := range out.Items {
+			keys = append(keys, *item["pk"].S+*item["sk"].N)
+		}
+		if token = out.NextToken; token == "" {
+			break
+		}
+		if pages > 10 {
+			t.Fatal("paging did not terminate")
+		}
+	}
+	if strings.Join(keys, ",") != "a2,a3,b2,b3" {
+		t.Fatalf("unexpected paged items: %v", keys)
+	}
+}
+
+func TestExecuteStatement_Writes(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+
+	mustCall(t, h, "ExecuteStatement", statement(`INSERT INTO users VALUE {'pk': 'u1', 'n': 1, 'tags': <<'a'>>, 'addr': {'city': 'Leeds'}}`, ""), nil)
+	expectError(t, h, "ExecuteStatement", statement(`INSERT INTO users VALUE {'pk': 'u1'}`, ""), "DuplicateItemException")
+
+	var out dynamodb.ExecuteStatementOutput
+	mustCall(t, h, "ExecuteStatement", statement(`UPDATE users SET n = n + 1 SET tags = set_add(tags, <<'b'>>) REMOVE addr.city `+
+		`WHERE pk = 'u1' AND n = 1 RETURNING ALL NEW *`, ""), &out)
+	if len(out.Items) != 1 || itemJSON(out.Items[0]) != `{"addr":{"M":{}},"n":{"N":"2"},"pk":{"S":"u1"},"tags":{"SS":["a","b"]}}` {
+		t.Fatalf("unexpected updated item: %+v", out.Items)
+	}
+
+	// Extra WHERE conditions behave like a ConditionExpression.
+	expectError(t, h, "ExecuteStatement", statement(`UPDATE users SET n = 5 WHERE pk = 'u1' AND n = 1`, ""), "ConditionalCheckFailedException")
+	expectError(t, h, "ExecuteStatement", statement(`UPDATE users SET n = 5 WHERE pk = 'missing'`, ""), "ConditionalCheckFailedException")
+	expectError(t, h, "ExecuteStatement", statement(`DELETE FROM users WHERE pk = 'u1' AND n > 10`, ""), "ConditionalCheckFailedException")
+
+	out = dynamodb.ExecuteStatementOutput{}
+	mustCall(t, h, "ExecuteStatement", statement(`DELETE FROM users WHERE pk = 'u1' RETURNING ALL OLD *`, ""), &out)
+	if len(out.Items) != 1 || *out.Items[0]["n"].N != "2" {
+		t.Fatalf("unexpected deleted item: %+v", out.Items)
+	}
+	mustCall(t, h, "ExecuteStatement", statement(`SELECT * FROM users`, ""), &out)
+	if len(out.Items) != 0 {
+		t.Fatalf("expected no items, got %+v", out.Items)
+	}
+}
+
+func TestExecuteStatement_Errors(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+
+	cases := []struct {
+		body, errType, want string
+	}{
+		{statement(`SELEKT * FROM users`, ""), "ValidationException", "wasn't well formed"},
+		{statement(`SELECT * FROM users WHERE pk = 'a`, ""), "ValidationException", "Unterminated"},
+		{statement(`SELECT * FROM users WHERE pk = ?`, ""), "ValidationException", "Number of parameters"},
+		{statement(`SELECT * FROM users`, `,"Parameters":[{"S":"a"}]`), "ValidationException", "Number of parameters"},
+		{statement(`UPDATE users SET n = 1 WHERE n = 1`, ""), "ValidationException", "mandatory equality on all key attributes"},
+		{statement(`DELETE FROM users WHERE pk = 'a' OR pk = 'b'`, ""), "ValidationException", "mandatory equality"},
+		{statement(`SELECT * FROM users ORDER BY pk`, ""), "ValidationException", "ORDER BY"},
+		{statement(`SELECT * FROM users`, `,"NextToken":"bogus"`), "ValidationException", "NextToken"},
+		{statement(`SELECT * FROM nope`, ""), "ResourceNotFoundException", "not found"},
+	}
+	for _, c := range cases {
+		if msg := expectError(t, h, "ExecuteStatement", c.body, c.errType); !strings.Contains(msg, c.want) {
+			t.Fatalf("%s: expected %q, got %q", c.body, c.want, msg)
+		}
+	}
+}
+
+func TestBatchExecuteStatement(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"taken"}}}`, nil)
+
+	var out dynamodb.BatchExecuteStatementOutput
+	mustCall(t, h, "BatchExecuteStatement", `{"Statements":[`+
+		`{"Statement":"INSERT INTO users VALUE {'pk': ?, 'n': 1}","Parameters":[{"S":"u1"}]},`+
+		`{"Statement":"INSERT INTO users VALUE {'pk': 'taken'}"},`+
+		`{"Statement":"UPDATE users SET n = 1 WHERE pk = 'taken' AND n = 2","ReturnValuesOnConditionCheckFailure":"ALL_OLD"}]}`, &out)
+	if len(out.Responses) != 3 || out.Responses[0].Error != nil || out.Responses[0].TableName != "users" {
+		t.Fatalf("unexpected responses: %+v", out.Responses)
+	}
+	if e := out.Responses[1].Error; e == nil || e.Code != "DuplicateItem" {
+		t.Fatalf("expected DuplicateItem, got %+v", e)
+	}
+	if e := out.Responses[2].Error; e == nil || e.Code != "ConditionalCheckFailed" || *e.Item["pk"].S != "taken" {
+		t.Fatalf("expected ConditionalCheckFailed with the item, got %+v", e)
+	}
+
+	out = dynamodb.BatchExecuteStatementOutput{}
+	mustCall(t, h, "BatchExecuteStatement", `{"Statements":[`+
+		`{"Statement":"SELECT n FROM users WHERE pk = 'u1'"},`+
+		`{"Statement":"SELECT * FROM users WHERE pk = 'nobody'"},`+
+		`{"Statement":"SELECT * FROM users WHERE n = 1"}]}`, &out)
+	if itemJSON(out.Responses[0].Item) != `{"n":{"N":"1"}}` || out.Responses[1].Item != nil || out.Responses[1].Error != nil {
+		t.Fatalf("unexpected read responses: %+v", out.Responses)
+	}
+	if e := out.Responses[2].Error; e == nil || e.Code != "ValidationError" {
+		t.Fatalf("expected a ValidationError for a read without the key, got %+v", e)
+	}
+
+	expectError(t, h, "BatchExecuteStatement", `{"Statements":[`+
+		`{"Statement":"SELECT * FROM users WHERE pk = 'u1'"},{"Statement":"DELETE FROM users WHERE pk = 'u1'"}]}`, "ValidationException")
+}
+
+func TestExecuteTransaction(t *testing.T) {
+	store := &TxStore{MemoryStore: resource.NewMemoryStore()}
+	h := dynamodb.NewHandler(store)
+	createTable(t, h, "accounts", false)
+	mustCall(t, h, "PutItem", `{"TableName":"accounts","Item":{"pk":{"S":"a"},"balance":{"N":"100"}}}`, nil)
+	mustCall(t, h, "PutItem", `{"TableName":"accounts","Item":{"pk":{"S":"b"},"balance":{"N":"0"}}}`, nil)
+
+	move := func(amount int, token string) string {
+		n := strconv.Itoa(amount)
+		body := `{"TransactStatements":[` +
+			`{"Statement":"UPDATE accounts SET balance = balance - ` + n + ` WHERE pk = 'a' AND balance >= ` + n + `"},` +
+			`{"Statement":"UPDATE accounts SET balance = balance + ` + n + ` WHERE pk = 'b'"},` +
+			`{"Statement":"EXISTS(SELECT * FROM accounts WHERE pk = 'audit')"}]`
+		if token != "" {
+			body += `,"ClientRequestToken":"` + token + `"`
+		}
+		return body + `}`
+	}
+
+	// The audit row does not exist yet, so nothing moves.
+	rec := call(t, h, "ExecuteTransaction", move(30, ""), nil)
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "[None, None, ConditionalCheckFailed]") {
+		t.Fatalf("expected cancellation, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	mustCall(t, h, "ExecuteStatement", statement(`INSERT INTO accounts VALUE {'pk': 'audit'}`, ""), nil)
+	mustCall(t, h, "ExecuteTransaction", move(30, "tok-1"), nil)
+	mustCall(t, h, "ExecuteTransaction", move(30, "tok-1"), nil)
+	if store.txs != 1 {
+		t.Fatalf("expected one store transaction, got %d", store.txs)
+	}
+	expectError(t, h, "ExecuteTransaction", move(40, "tok-1"), "IdempotentParameterMismatchException")
+
+	var out dynamodb.ExecuteTransactionOutput
+	mustCall(t, h, "ExecuteTransaction", `{"TransactStatements":[`+
+		`{"Statement":"SELECT balance FROM accounts WHERE pk = 'a'"},{"Statement":"SELECT balance FROM accounts WHERE pk = 'b'"}]}`, &out)
+	if len(out.Responses) != 2 || *out.Responses[0].Item["balance"].N != "70" || *out.Responses[1].Item["balance"].N != "30" {
+		t.Fatalf("unexpected balances: %+v", out.Responses)
+	}
+
+	rec = call(t, h, "ExecuteTransaction", move(500, ""), nil)
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "[ConditionalCheckFailed, None, None]") {
+		t.Fatalf("expected overdraft to be cancelled, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	expectError(t, h, "ExecuteTransaction", `{"TransactStatements":[`+
+		`{"Statement":"DELETE FROM accounts WHERE pk = 'a'"},{"Statement":"UPDATE accounts SET x = 1 WHERE pk = 'a'"}]}`, "ValidationException")
+	expectError(t, h, "ExecuteTransaction", `{"TransactStatements":[`+
+		`{"Statement":"SELECT * FROM accounts WHERE pk = 'a'"},{"Statement":"DELETE FROM accounts WHERE pk = 'b'"}]}`, "ValidationException")
+}
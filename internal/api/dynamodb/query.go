@@ -0,0 +1,606 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"opensnack/internal/awsresponses"
+	"opensnack/internal/util"
+)
+
+//
+// QUERY AND SCAN
+//
+// Both operations read the items of a table (or of one of its secondary
+// indexes), order them, skip past ExclusiveStartKey and then evaluate up
+// to Limit items, stopping early at DynamoDB's 1 MB page size. Query keeps
+// the items matching its key condition, ordered by the range key; Scan
+// keeps the items of its segment, ordered by the full key.
+//
+
+// maxPageBytes is the most data a single Query or Scan page evaluates.
+const maxPageBytes = 1024 * 1024
+
+// indexInfo describes the table itself or one of its secondary indexes.
+type indexInfo struct {
+	name       string
+	keySchema  []KeySchemaElement
+	projection Projection
+	global     bool
+}
+
+// resolveIndex returns the table's primary index or the named index.
+func resolveIndex(td *TableDescription, name string) (*indexInfo, *ddbError) {
+	if name == "" {
+		return &indexInfo{keySchema: td.KeySchema, projection: Projection{ProjectionType: "ALL"}}, nil
+	}
+	for _, gsi := range td.GlobalSecondaryIndexes {
+		if gsi.IndexName == name {
+			return &indexInfo{name: name, keySchema: gsi.KeySchema, projection: gsi.Projection, global: true}, nil
+		}
+	}
+	for _, lsi := range td.LocalSecondaryIndexes {
+		if lsi.IndexName == name {
+			return &indexInfo{name: name, keySchema: lsi.KeySchema, projection: lsi.Projection}, nil
+		}
+	}
+	return nil, errValidation("The table does not have the specified index: " + name)
+}
+
+// keyAttributes returns the table key names followed by any index key
+// names the table key does not already cover.
+func (idx *indexInfo) keyAttributes(td *TableDescription) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, schema := range [][]KeySchemaElement{td.KeySchema, idx.keySchema} {
+		hash, rng := keyNames(schema)
+		for _, n := range []string{hash, rng} {
+			if n != "" && !seen[n] {
+				seen[n] = true
+				names = append(names, n)
+			}
+		}
+	}
+	return names
+}
+
+// contains reports whether item is present in the index: secondary
+// indexes are sparse and only hold items that have their key attributes.
+func (idx *indexInfo) contains(td *TableDescription, item Item) bool {
+	hash, rng := keyNames(idx.keySchema)
+	for _, n := range []string{hash, rng} {
+		if n == "" {
+			continue
+		}
+		if v, ok := item[n]; !ok || v.Type() != attributeType(td, n) {
+			return false
+		}
+	}
+	return true
+}
+
+// project applies the index projection to an item.
+func (idx *indexInfo) project(td *TableDescription, item Item) Item {
+	switch idx.projection.ProjectionType {
+	case "", "ALL":
+		return item
+	}
+	names := idx.keyAttributes(td)
+	if idx.projection.ProjectionType == "INCLUDE" {
+		names = append(names, idx.projection.NonKeyAttributes...)
+	}
+	return projectPaths(item, topLevelPaths(names))
+}
+
+// readPlan is a validated Query or Scan.
+type readPlan struct {
+	td         *TableDescription
+	index      *indexInfo
+	keyCond    *condExpr
+	filter     *condExpr
+	projection []docPath
+	selectMode string
+	limit      int
+	startKey   Item
+	forward    bool
+	query      bool
+
+	segment, totalSegments int
+}
+
+// orderAttributes are the attributes items are sorted by: the range key
+// for a Query, the full key for a Scan, then the table key to break ties
+// between index entries.
+func (p *readPlan) orderAttributes() []string {
+	hash, rng := keyNames(p.index.keySchema)
+	var names []string
+	if !p.query {
+		names = append(names, hash)
+	}
+	if rng != "" {
+		names = append(names, rng)
+	}
+	seen := map[string]bool{}
+	for _, n := range names {
+		seen[n] = true
+	}
+	for _, n := range p.index.keyAttributes(p.td) {
+		if !seen[n] {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// compareItems orders two items by attrs, in the plan's direction.
+func (p *readPlan) compareItems(attrs []string, a, b Item) int {
+	for _, n := range attrs {
+		av, aok := a[n]
+		bv, bok := b[n]
+		var c int
+		switch {
+		case !aok && !bok:
+			continue
+		case !aok:
+			c = -1
+		case !bok:
+			c = 1
+		default:
+			var ok bool
+			if c, ok = compareValues(av, bv); !ok {
+				c = compareStrings(av.Type(), bv.Type())
+			}
+		}
+		if c != 0 {
+			if !p.forward {
+				return -c
+			}
+			return c
+		}
+	}
+	return 0
+}
+
+func compareStrings(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// inSegment reports whether item belongs to the plan's scan segment.
+func (p *readPlan) inSegment(item Item) bool {
+	if p.totalSegments <= 1 {
+		return true
+	}
+	hash, _ := keyNames(p.index.keySchema)
+	f := fnv.New32a()
+	f.Write([]byte(canonicalKey(item[hash])))
+	return int(f.Sum32()%uint32(p.totalSegments)) == p.segment
+}
+
+// validateStartKey checks that ExclusiveStartKey carries the table key and
+// the index key.
+func (p *readPlan) validateStartKey() *ddbError {
+	if p.startKey == nil {
+		return nil
+	}
+	for _, n := range p.index.keyAttributes(p.td) {
+		v, ok := p.startKey[n]
+		if !ok || v.Type() != attributeType(p.td, n) {
+			return errValidation("The provided starting key is invalid: The provided key element does not match the schema")
+		}
+	}
+	return nil
+}
+
+// run executes the plan and returns the page of items.
+func (h *Handler) run(ctx context.Context, ns string, p *readPlan, capacityMode string, consistent bool) ([]Item, PageSummary, *ddbError) {
+	all, derr := h.tableItems(ctx, ns, p.td.TableName)
+	if derr != nil {
+		return nil, PageSummary{}, derr
+	}
+
+	type candidate struct {
+		full, view Item
+	}
+	var candidates []candidate
+	for _, item := range all {
+		if !p.index.contains(p.td, item) {
+			continue
+		}
+		if p.keyCond != nil && !evalCondition(p.keyCond, item) {
+			continue
+		}
+		if !p.inSegment(item) {
+			continue
+		}
+		candidates = append(candidates, candidate{full: item, view: p.index.project(p.td, item)})
+	}
+
+	attrs := p.orderAttributes()
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return p.compareItems(attrs, candidates[i].full, candidates[j].full) < 0
+	})
+
+	start := 0
+	if p.startKey != nil {
+		start = sort.Search(len(candidates), func(i int) bool {
+			return p.compareItems(attrs, candidates[i].full, p.startKey) > 0
+		})
+	}
+
+	items := []Item{}
+	page := PageSummary{}
+	bytes := 0
+	i := start
+	for ; i < len(candidates); i++ {
+		if p.limit > 0 && page.ScannedCount >= p.limit || bytes >= maxPageBytes {
+			break
+		}
+		c := candidates[i]
+		page.ScannedCount++
+		bytes += itemSize(c.view)
+
+		if p.filter != nil && !evalCondition(p.filter, c.view) {
+			continue
+		}
+		page.Count++
+		if p.selectMode == "COUNT" {
+			continue
+		}
+		item := c.view
+		if p.selectMode == "ALL_ATTRIBUTES" {
+			item = c.full
+		}
+		items = append(items, projectPaths(item, p.projection))
+	}
+	if i < len(candidates) && page.ScannedCount > 0 {
+		page.LastEvaluatedKey = projectPaths(candidates[i-1].full, topLevelPaths(p.index.keyAttributes(p.td)))
+	}
+
+	if capacityMode != "" && capacityMode != "NONE" {
+		units := math.Max(1, math.Ceil(float64(bytes)/4096))
+		if !consistent {
+			units /= 2
+		}
+		page.ConsumedCapacity = &ConsumedCapacity{TableName: p.td.TableName, CapacityUnits: units}
+	}
+	return items, page, nil
+}
+
+// planRead validates the parts of a Query or Scan request they share.
+func (h *Handler) planRead(ctx context.Context, ns, table, indexName, selectMode string, limit *int, startKey Item, consistent bool) (*readPlan, *ddbError) {
+	if limit != nil && *limit < 1 {
+		return nil, errValidation("1 validation error detected: Value '" + strconv.Itoa(*limit) +
+			"' at 'limit' failed to satisfy constraint: Member must have value greater than or equal to 1")
+	}
+	td, derr := h.loadTable(ctx, ns, table)
+	if derr != nil {
+		return nil, derr
+	}
+	idx, derr := resolveIndex(td, indexName)
+	if derr != nil {
+		return nil, derr
+	}
+	if consistent && idx.global {
+		return nil, errValidation("Consistent reads are not supported on global secondary indexes")
+	}
+	p := &readPlan{td: td, index: idx, forward: true, selectMode: selectMode}
+	if startKey != nil {
+		p.startKey = normalizeItem(startKey)
+	}
+	if limit != nil {
+		p.limit = *limit
+	}
+	return p, p.validateStartKey()
+}
+
+// resolveSelect applies the Select rules once the projection is known.
+func (p *readPlan) resolveSelect() *ddbError {
+	switch p.selectMode {
+	case "":
+		switch {
+		case p.projection != nil:
+			p.selectMode = "SPECIFIC_ATTRIBUTES"
+		case p.index.name != "":
+			p.selectMode = "ALL_PROJECTED_ATTRIBUTES"
+		default:
+			p.selectMode = "ALL_ATTRIBUTES"
+		}
+		return nil
+	case "ALL_ATTRIBUTES":
+		if p.index.global && p.index.projection.ProjectionType != "ALL" {
+			return errValidation("One or more parameter values were invalid: Select type ALL_ATTRIBUTES is not supported for global secondary index " +
+				p.index.name + " because its projection type is not ALL")
+		}
+	case "ALL_PROJECTED_ATTRIBUTES":
+		if p.index.name == "" {
+			return errValidation("One or more parameter values were invalid: Select type ALL_PROJECTED_ATTRIBUTES is supported only for index queries")
+		}
+	case "SPECIFIC_ATTRIBUTES":
+		if p.projection == nil {
+			return errValidation("One or more parameter values were invalid: Must specify the AttributesToGet or ProjectionExpression when choosing to get SPECIFIC_ATTRIBUTES")
+		}
+		return nil
+	case "COUNT":
+	default:
+		return errValidation("1 validation error detected: Value '" + p.selectMode + "' at 'select' failed to satisfy constraint: " +
+			"Member must satisfy enum value set: [SPECIFIC_ATTRIBUTES, COUNT, ALL_ATTRIBUTES, ALL_PROJECTED_ATTRIBUTES]")
+	}
+	if p.projection != nil {
+		return errValidation("One or more parameter values were invalid: Cannot specify the AttributesToGet or ProjectionExpression when choosing to get " + p.selectMode)
+	}
+	return nil
+}
+
+// validateKeyCondition checks that a KeyConditionExpression is an
+// equality on the hash key, optionally ANDed with one range key condition.
+func validateKeyCondition(cond *condExpr, td *TableDescription, idx *indexInfo) *ddbError {
+	hash, rng := keyNames(idx.keySchema)
+	leaves := []*condExpr{cond}
+	if cond.op == "AND" {
+		leaves = []*condExpr{cond.left, cond.right}
+	}
+
+	seen := map[string]bool{}
+	for _, leaf := range leaves {
+		switch leaf.op {
+		case "AND":
+			return errValidation("Query key condition not supported")
+		case "OR", "NOT", "IN", "<>":
+			return errValidation("Invalid operator used in KeyConditionExpression: " + leaf.op)
+		case "FUNC":
+			if leaf.name != "begins_with" {
+				return errValidation("Invalid operator used in KeyConditionExpression: " + leaf.name)
+			}
+		}
+		if leaf.args[0].kind != operandPath || len(leaf.args[0].path) != 1 {
+			return errValidation("Query key condition not supported")
+		}
+		name := leaf.args[0].path[0].name
+		switch name {
+		case hash:
+			if leaf.op != "=" {
+				return errValidation("Query key condition not supported")
+			}
+		case rng:
+		default:
+			missing := hash
+			if seen[hash] && rng != "" {
+				missing = rng
+			}
+			return errValidation("Query condition missed key schema element: " + missing)
+		}
+		if seen[name] {
+			return errValidation("KeyConditionExpressions must only contain one condition per key")
+		}
+		seen[name] = true
+
+		want := attributeType(td, name)
+		for _, arg := range leaf.args[1:] {
+			if arg.kind != operandValue {
+				return errValidation("Query key condition not supported")
+			}
+			if arg.value.Type() != want {
+				return errValidation("One or more parameter values were invalid: Condition parameter type does not match schema type")
+			}
+		}
+		if leaf.op == "FUNC" && want == "N" {
+			return errValidation("Invalid KeyConditionExpression: Incorrect operand type for operator or function; operator or function: begins_with, operand type: NUMBER")
+		}
+	}
+	if !seen[hash] {
+		return errValidation("Query condition missed key schema element: " + hash)
+	}
+	return nil
+}
+
+// conditionPaths returns every document path a condition refers to.
+func conditionPaths(c *condExpr) []docPath {
+	if c == nil {
+		return nil
+	}
+	var out []docPath
+	var walk func(o *operand)
+	walk = func(o *operand) {
+		if o.kind == operandPath {
+			out = append(out, o.path)
+		}
+		for _, a := range o.args {
+			walk(a)
+		}
+	}
+	for _, a := range c.args {
+		walk(a)
+	}
+	out = append(out, conditionPaths(c.left)...)
+	return append(out, conditionPaths(c.right)...)
+}
+
+// Query reads the items that share a partition key
+func (h *Handler) Query(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req QueryInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if req.AttributesToGet != nil && req.ProjectionExpression != "" {
+		writeError(w, errValidation("Can not use both expression and non-expression parameters in the same request: "+
+			"Non-expression parameters: {AttributesToGet} Expression parameters: {ProjectionExpression}"))
+		return
+	}
+	if req.KeyConditionExpression == "" {
+		writeError(w, errValidation("Either the KeyConditions or KeyConditionExpression parameter must be specified in the request."))
+		return
+	}
+
+	ctx, derr := newExprContext(req.ExpressionAttributeNames, req.ExpressionAttributeValues)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	keyCond, derr := ctx.condition("KeyConditionExpression", req.KeyConditionExpression)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	filter, derr := ctx.condition("FilterExpression", req.FilterExpression)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	projection, derr := ctx.projection(req.ProjectionExpression)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if projection == nil {
+		projection = topLevelPaths(req.AttributesToGet)
+	}
+	if derr := ctx.checkUnused(); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	defer h.lockTables(ns, false, req.TableName)()
+
+	plan, derr := h.planRead(r.Context(), ns, req.TableName, req.IndexName, req.Select, req.Limit, req.ExclusiveStartKey, req.ConsistentRead)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	plan.query = true
+	plan.keyCond = keyCond
+	plan.filter = filter
+	plan.projection = projection
+	if req.ScanIndexForward != nil {
+		plan.forward = *req.ScanIndexForward
+	}
+	if derr := plan.resolveSelect(); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := validateKeyCondition(keyCond, plan.td, plan.index); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	hash, rng := keyNames(plan.index.keySchema)
+	for _, p := range conditionPaths(filter) {
+		if p[0].name == hash || p[0].name == rng {
+			writeError(w, errValidation("Filter Expression can only contain non-primary key attributes: Primary key attribute: "+p[0].name))
+			return
+		}
+	}
+
+	items, page, derr := h.run(r.Context(), ns, plan, req.ReturnConsumedCapacity, req.ConsistentRead)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if plan.selectMode == "COUNT" {
+		awsresponses.WriteJSON(w, http.StatusOK, page)
+		return
+	}
+	awsresponses.WriteJSON(w, http.StatusOK, QueryOutput{Items: items, PageSummary: page})
+}
+
+// Scan reads every item in a table or index
+func (h *Handler) Scan(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req ScanInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if req.AttributesToGet != nil && req.ProjectionExpression != "" {
+		writeError(w, errValidation("Can not use both expression and non-expression parameters in the same request: "+
+			"Non-expression parameters: {AttributesToGet} Expression parameters: {ProjectionExpression}"))
+		return
+	}
+
+	segment, totalSegments := 0, 1
+	switch {
+	case req.Segment != nil && req.TotalSegments == nil:
+		writeError(w, errValidation("The TotalSegments parameter is required but was not present in the request when Segment parameter is present"))
+		return
+	case req.Segment == nil && req.TotalSegments != nil:
+		writeError(w, errValidation("The Segment parameter is required but was not present in the request when parameter TotalSegments is present"))
+		return
+	case req.Segment != nil:
+		segment, totalSegments = *req.Segment, *req.TotalSegments
+		if totalSegments < 1 || totalSegments > 1000000 {
+			writeError(w, errValidation("1 validation error detected: Value '"+strconv.Itoa(totalSegments)+
+				"' at 'totalSegments' failed to satisfy constraint: Member must have value between 1 and 1000000"))
+			return
+		}
+		if segment < 0 || segment >= totalSegments {
+			writeError(w, errValidation("The Segment parameter is zero-based and must be less than parameter TotalSegments: Segment: "+
+				strconv.Itoa(segment)+" is not less than TotalSegments: "+strconv.Itoa(totalSegments)))
+			return
+		}
+	}
+
+	ctx, derr := newExprContext(req.ExpressionAttributeNames, req.ExpressionAttributeValues)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	filter, derr := ctx.condition("FilterExpression", req.FilterExpression)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	projection, derr := ctx.projection(req.ProjectionExpression)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if projection == nil {
+		projection = topLevelPaths(req.AttributesToGet)
+	}
+	if derr := ctx.checkUnused(); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	defer h.lockTables(ns, false, req.TableName)()
+
+	plan, derr := h.planRead(r.Context(), ns, req.TableName, req.IndexName, req.Select, req.Limit, req.ExclusiveStartKey, req.ConsistentRead)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	plan.filter = filter
+	plan.projection = projection
+	plan.segment, plan.totalSegments = segment, totalSegments
+	if derr := plan.resolveSelect(); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	items, page, derr := h.run(r.Context(), ns, plan, req.ReturnConsumedCapacity, req.ConsistentRead)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if plan.selectMode == "COUNT" {
+		awsresponses.WriteJSON(w, http.StatusOK, page)
+		return
+	}
+	awsresponses.WriteJSON(w, http.StatusOK, ScanOutput{Items: items, PageSummary: page})
+}
@@ -0,0 +1,290 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"opensnack/internal/api/dynamodb"
+	"opensnack/internal/resource"
+)
+
+// seedEvents fills an events table with pk a/b and sk 1..5.
+func seedEvents(t *testing.T, h *dynamodb.Handler) {
+	t.Helper()
+	createTable(t, h, "events", true)
+	for _, pk := range []string{"a", "b"} {
+		for sk := 1; sk <= 5; sk++ {
+			item := fmt.Sprintf(`{"pk":{"S":"%s"},"sk":{"N":"%d"},"kind":{"S":"k%d"}}`, pk, sk, sk%2)
+			mustCall(t, h, "PutItem", `{"TableName":"events","Item":`+item+`}`, nil)
+		}
+	}
+}
+
+// sortKeys returns the sk values of a page in order.
+func sortKeys(items []dynamodb.Item) string {
+	var out []string
+	for _, it := range items {
+		out = append(out, *it["sk"].N)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestQuery_KeyConditions(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	seedEvents(t, h)
+
+	cases := []struct {
+		cond, values, want string
+	}{
+		{"pk = :p", `":p":{"S":"a"}`, "1,2,3,4,5"},
+		{"pk = :p AND sk = :v", `":p":{"S":"a"},":v":{"N":"3"}`, "3"},
+		{"pk = :p AND sk < :v", `":p":{"S":"a"},":v":{"N":"3"}`, "1,2"},
+		{"pk = :p AND sk <= :v", `":p":{"S":"a"},":v":{"N":"3"}`, "1,2,3"},
+		{"sk > :v AND pk = :p", `":p":{"S":"a"},":v":{"N":"3"}`, "4,5"},
+		{"pk = :p AND sk >= :v", `":p":{"S":"a"},":v":{"N":"3"}`, "3,4,5"},
+		{"pk = :p AND sk BETWEEN :lo AND :hi", `":p":{"S":"b"},":lo":{"N":"2"},":hi":{"N":"4"}`, "2,3,4"},
+		{"pk = :p", `":p":{"S":"missing"}`, ""},
+	}
+	for _, c := range cases {
+		var out dynamodb.QueryOutput
+		mustCall(t, h, "Query", `{"TableName":"events","KeyConditionExpression":"`+c.cond+`","ExpressionAttributeValues":{`+c.values+`}}`, &out)
+		if got := sortKeys(out.Items); got != c.want || out.Count != len(out.Items) {
+			t.Fatalf("%s: got %q (count %d), want %q", c.cond, got, out.Count, c.want)
+		}
+	}
+
+	var rev dynamodb.QueryOutput
+	mustCall(t, h, "Query", `{"TableName":"events","KeyConditionExpression":"pk = :p","ScanIndexForward":false,`+
+		`"ExpressionAttributeValues":{":p":{"S":"a"}}}`, &rev)
+	if got := sortKeys(rev.Items); got != "5,4,3,2,1" {
+		t.Fatalf("expected descending order, got %s", got)
+	}
+}
+
+func TestQuery_BeginsWith(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	mustCall(t, h, "CreateTable", `{"TableName":"docs","BillingMode":"PAY_PER_REQUEST",`+
+		`"AttributeDefinitions":[{"AttributeName":"pk","AttributeType":"S"},{"AttributeName":"path","AttributeType":"S"}],`+
+		`"KeySchema":[{"AttributeName":"pk","KeyType":"HASH"},{"AttributeName":"path","KeyType":"RANGE"}]}`, nil)
+	for _, p := range []string{"img/a", "img/b", "doc/a"} {
+		mustCall(t, h, "PutItem", `{"TableName":"docs","Item":{"pk":{"S":"x"},"path":{"S":"`+p+`"}}}`, nil)
+	}
+
+	var out dynamodb.QueryOutput
+	mustCall(t, h, "Query", `{"TableName":"docs","KeyConditionExpression":"pk = :p AND begins_with(#p, :pre)",`+
+		`"ExpressionAttributeNames":{"#p":"path"},"ExpressionAttributeValues":{":p":{"S":"x"},":pre":{"S":"img/"}}}`, &out)
+	if out.Count != 2 || *out.Items[0]["path"].S != "img/a" {
+		t.Fatalf("unexpected begins_with result: %+v", out)
+	}
+}
+
+func TestQuery_PagingAndFilter(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	seedEvents(t, h)
+
+	var seen []string
+	var start string
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("paging did not terminate")
+		}
+		body := `{"TableName":"events","KeyConditionExpression":"pk = :p","Limit":2,"ExpressionAttributeValues":{":p":{"S":"a"}}`
+		if start != "" {
+			body += `,"ExclusiveStartKey":` + start
+		}
+		var out dynamodb.QueryOutput
+		mustCall(t, h, "Query", body+`}`, &out)
+		seen = append(seen, sortKeys(out.Items))
+		if out.LastEvaluatedKey == nil {
+			break
+		}
+		start = itemJSON(out.LastEvaluatedKey)
+	}
+	if got := strings.Join(seen, "|"); got != "1,2|3,4|5" {
+		t.Fatalf("unexpected pages: %s", got)
+	}
+
+	// ScannedCount counts the items read before the filter is applied.
+	var filtered dynamodb.QueryOutput
+	mustCall(t, h, "Query", `{"TableName":"events","KeyConditionExpression":"pk = :p","FilterExpression":"kind = :k",`+
+		`"ExpressionAttributeValues":{":p":{"S":"a"},":k":{"S":"k1"}}}`, &filtered)
+	if filtered.Count != 3 || filtered.ScannedCount != 5 || sortKeys(filtered.Items) != "1,3,5" {
+		t.Fatalf("unexpected filter result: %+v", filtered)
+	}
+
+	rec := call(t, h, "Query", `{"TableName":"events","KeyConditionExpression":"pk = :p","Select":"COUNT",`+
+		`"ExpressionAttributeValues":{":p":{"S":"b"}}}`, nil)
+	var count map[string]json.RawMessage
+	json.Unmarshal(rec.Body.Bytes(), &count)
+	if _, ok := count["Items"]; ok || string(count["Count"]) != "5" {
+		t.Fatalf("unexpected COUNT response: %s", rec.Body.String())
+	}
+}
+
+func TestQuery_Validation(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	seedEvents(t, h)
+
+	cases := []struct {
+		body, want string
+	}{
+		{`{"TableName":"events"}`, "KeyConditionExpression parameter must be specified"},
+		{`{"TableName":"events","KeyConditionExpression":"sk = :v","ExpressionAttributeValues":{":v":{"N":"1"}}}`,
+			"Query condition missed key schema element: pk"},
+		{`{"TableName":"events","KeyConditionExpression":"pk < :v","ExpressionAttributeValues":{":v":{"S":"a"}}}`,
+			"Query key condition not supported"},
+		{`{"TableName":"events","KeyConditionExpression":"pk = :v OR sk = :n","ExpressionAttributeValues":{":v":{"S":"a"},":n":{"N":"1"}}}`,
+			"Invalid operator used in KeyConditionExpression: OR"},
+		{`{"TableName":"events","KeyConditionExpression":"pk = :v AND kind = :n","ExpressionAttributeValues":{":v":{"S":"a"},":n":{"S":"k1"}}}`,
+			"Query condition missed key schema element: sk"},
+		{`{"TableName":"events","KeyConditionExpression":"pk = :v","ExpressionAttributeValues":{":v":{"N":"1"}}}`,
+			"Condition parameter type does not match schema type"},
+		{`{"TableName":"events","KeyConditionExpression":"pk = :v","FilterExpression":"sk > :n","ExpressionAttributeValues":{":v":{"S":"a"},":n":{"N":"1"}}}`,
+			"Primary key attribute: sk"},
+		{`{"TableName":"events","KeyConditionExpression":"pk = :v","Limit":0,"ExpressionAttributeValues":{":v":{"S":"a"}}}`,
+			"Member must have value greater than or equal to 1"},
+		{`{"TableName":"events","KeyConditionExpression":"pk = :v","ExclusiveStartKey":{"pk":{"S":"a"}},"ExpressionAttributeValues":{":v":{"S":"a"}}}`,
+			"The provided starting key is invalid"},
+		{`{"TableName":"events","IndexName":"nope","KeyConditionExpression":"pk = :v","ExpressionAttributeValues":{":v":{"S":"a"}}}`,
+			"The table does not have the specified index: nope"},
+		{`{"TableName":"events","Select":"SPECIFIC_ATTRIBUTES","KeyConditionExpression":"pk = :v","ExpressionAttributeValues":{":v":{"S":"a"}}}`,
+			"Must specify the AttributesToGet or ProjectionExpression"},
+	}
+	for _, c := range cases {
+		if msg := expectError(t, h, "Query", c.body, "ValidationException"); !strings.Contains(msg, c.want) {
+			t.Fatalf("%s: expected %q, got %q", c.body, c.want, msg)
+		}
+	}
+	expectError(t, h, "Query", `{"TableName":"nope","KeyConditionExpression":"pk = :v","ExpressionAttributeValues":{":v":{"S":"a"}}}`,
+		"ResourceNotFoundException")
+}
+
+func TestScan_SegmentsAndPaging(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	seedEvents(t, h)
+
+	var all dynamodb.ScanOutput
+	mustCall(t, h, "Scan", `{"TableName":"events","ProjectionExpression":"pk, sk"}`, &all)
+	if all.Count != 10 || len(all.Items[0]) != 2 {
+		t.Fatalf("unexpected scan: %+v", all)
+	}
+
+	total := 0
+	for seg := 0; seg < 3; seg++ {
+		var out dynamodb.ScanOutput
+		mustCall(t, h, "Scan", fmt.Sprintf(`{"TableName":"events","Segment":%d,"TotalSegments":3}`, seg), &out)
+		total += out.Count
+	}
+	if total != 10 {
+		t.Fatalf("segments covered %d items, want 10", total)
+	}
+
+	var page dynamodb.ScanOutput
+	mustCall(t, h, "Scan", `{"TableName":"events","Limit":4,"FilterExpression":"sk > :n","ExpressionAttributeValues":{":n":{"N":"2"}}}`, &page)
+	if page.ScannedCount != 4 || page.LastEvaluatedKey == nil {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+	var rest dynamodb.ScanOutput
+	mustCall(t, h, "Scan", `{"TableName":"events","FilterExpression":"sk > :n","ExpressionAttributeValues":{":n":{"N":"2"}},`+
+		`"ExclusiveStartKey":`+itemJSON(page.LastEvaluatedKey)+`}`, &rest)
+	if page.Count+rest.Count != 6 || rest.ScannedCount != 6 || rest.LastEvaluatedKey != nil {
+		t.Fatalf("unexpected remainder: %+v", rest)
+	}
+
+	msg := expectError(t, h, "Scan", `{"TableName":"events","Segment":3,"TotalSegments":3}`, "ValidationException")
+	if !strings.Contains(msg, "must be less than parameter TotalSegments") {
+		t.Fatalf("unexpected message: %s", msg)
+	}
+	expectError(t, h, "Scan", `{"TableName":"events","Segment":0}`, "ValidationException")
+}
+
+func TestQuery_SecondaryIndexes(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	mustCall(t, h, "CreateTable", `{"TableName":"orders","BillingMode":"PAY_PER_REQUEST",`+
+		`"AttributeDefinitions":[{"AttributeName":"pk","AttributeType":"S"},{"AttributeName":"sk","AttributeType":"N"},`+
+		`{"AttributeName":"status","AttributeType":"S"},{"AttributeName":"total","AttributeType":"N"}],`+
+		`"KeySchema":[{"AttributeName":"pk","KeyType":"HASH"},{"AttributeName":"sk","KeyType":"RANGE"}],`+
+		`"GlobalSecondaryIndexes":[{"IndexName":"by-status","KeySchema":[{"AttributeName":"status","KeyType":"HASH"}],`+
+		`"Projection":{"ProjectionType":"KEYS_ONLY"}}],`+
+		`"LocalSecondaryIndexes":[{"IndexName":"by-total","KeySchema":[{"AttributeName":"pk","KeyType":"HASH"},{"AttributeName":"total","KeyType":"RANGE"}],`+
+		`"Projection":{"ProjectionType":"INCLUDE","NonKeyAttributes":["note"]}}]}`, nil)
+
+	items := []string{
+		`{"pk":{"S":"c1"},"sk":{"N":"1"},"status":{"S":"open"},"total":{"N":"30"},"note":{"S":"x"},"extra":{"S":"y"}}`,
+		`{"pk":{"S":"c1"},"sk":{"N":"2"},"status":{"S":"shipped"},"total":{"N":"10"}}`,
+		`{"pk":{"S":"c1"},"sk":{"N":"3"},"total":{"N":"20"}}`,
+		`{"pk":{"S":"c2"},"sk":{"N":"1"},"status":{"S":"open"}}`,
+	}
+	for _, it := range items {
+		mustCall(t, h, "PutItem", `{"TableName":"orders","Item":`+it+`}`, nil)
+	}
+
+	// The GSI is sparse and projects only keys.
+	var open dynamodb.QueryOutput
+	mustCall(t, h, "Query", `{"TableName":"orders","IndexName":"by-status","KeyConditionExpression":"#s = :s",`+
+		`"ExpressionAttributeNames":{"#s":"status"},"ExpressionAttributeValues":{":s":{"S":"open"}}}`, &open)
+	if open.Count != 2 || itemJSON(open.Items[0]) != `{"pk":{"S":"c1"},"sk":{"N":"1"},"status":{"S":"open"}}` {
+		t.Fatalf("unexpected GSI query: %+v", open.Items)
+	}
+
+	var scan dynamodb.ScanOutput
+	mustCall(t, h, "Scan", `{"TableName":"orders","IndexName":"by-status"}`, &scan)
+	if scan.Count != 3 {
+		t.Fatalf("expected 3 items in sparse GSI, got %d", scan.Count)
+	}
+
+	// The LSI orders by total and projects the INCLUDE attributes.
+	var byTotal dynamodb.QueryOutput
+	mustCall(t, h, "Query", `{"TableName":"orders","IndexName":"by-total","KeyConditionExpression":"pk = :p AND #t > :t",`+
+		`"ExpressionAttributeNames":{"#t":"total"},"ExpressionAttributeValues":{":p":{"S":"c1"},":t":{"N":"5"}}}`, &byTotal)
+	if got := sortKeys(byTotal.Items); got != "2,3,1" {
+		t.Fatalf("unexpected LSI order: %s", got)
+	}
+	if _, ok := byTotal.Items[2]["extra"]; ok || *byTotal.Items[2]["note"].S != "x" {
+		t.Fatalf("unexpected LSI projection: %s", itemJSON(byTotal.Items[2]))
+	}
+
+	// Local indexes can fetch the whole item, global ones cannot.
+	var full dynamodb.QueryOutput
+	mustCall(t, h, "Query", `{"TableName":"orders","IndexName":"by-total","Select":"ALL_ATTRIBUTES","KeyConditionExpression":"pk = :p",`+
+		`"ExpressionAttributeValues":{":p":{"S":"c1"}}}`, &full)
+	if *full.Items[2]["extra"].S != "y" {
+		t.Fatalf("expected full item from LSI, got %s", itemJSON(full.Items[2]))
+	}
+	expectError(t, h, "Query", `{"TableName":"orders","IndexName":"by-status","Select":"ALL_ATTRIBUTES","KeyConditionExpression":"#s = :s",`+
+		`"ExpressionAttributeNames":{"#s":"status"},"ExpressionAttributeValues":{":s":{"S":"open"}}}`, "ValidationException")
+	expectError(t, h, "Query", `{"TableName":"orders","IndexName":"by-status","ConsistentRead":true,"KeyConditionExpression":"#s = :s",`+
+		`"ExpressionAttributeNames":{"#s":"status"},"ExpressionAttributeValues":{":s":{"S":"open"}}}`, "ValidationException")
+}
+
+func TestUpdateTable_GlobalSecondaryIndexes(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"u1"},"email":{"S":"a@example.com"}}}`, nil)
+
+	mustCall(t, h, "UpdateTable", `{"TableName":"users","AttributeDefinitions":[{"AttributeName":"email","AttributeType":"S"}],`+
+		`"GlobalSecondaryIndexUpdates":[{"Create":{"IndexName":"by-email","KeySchema":[{"AttributeName":"email","KeyType":"HASH"}],`+
+		`"Projection":{"ProjectionType":"ALL"}}}]}`, nil)
+
+	var out dynamodb.QueryOutput
+	mustCall(t, h, "Query", `{"TableName":"users","IndexName":"by-email","KeyConditionExpression":"email = :e",`+
+		`"ExpressionAttributeValues":{":e":{"S":"a@example.com"}}}`, &out)
+	if out.Count != 1 || *out.Items[0]["pk"].S != "u1" {
+		t.Fatalf("unexpected index query: %+v", out)
+	}
+
+	expectError(t, h, "UpdateTable", `{"TableName":"users","GlobalSecondaryIndexUpdates":[{"Create":{"IndexName":"by-email",`+
+		`"KeySchema":[{"AttributeName":"email","KeyType":"HASH"}],"Projection":{"ProjectionType":"ALL"}}}]}`, "ValidationException")
+
+	mustCall(t, h, "UpdateTable", `{"TableName":"users","GlobalSecondaryIndexUpdates":[{"Delete":{"IndexName":"by-email"}}]}`, nil)
+	expectError(t, h, "Query", `{"TableName":"users","IndexName":"by-email","KeyConditionExpression":"email = :e",`+
+		`"ExpressionAttributeValues":{":e":{"S":"a@example.com"}}}`, "ValidationException")
+	expectError(t, h, "UpdateTable", `{"TableName":"users","GlobalSecondaryIndexUpdates":[{"Delete":{"IndexName":"by-email"}}]}`,
+		"ResourceNotFoundException")
+}
@@ -0,0 +1,497 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"opensnack/internal/awsresponses"
+	"opensnack/internal/util"
+)
+
+//
+// STATEMENT EXECUTION
+//
+// A SELECT becomes a Query when its WHERE clause pins the partition key
+// and a Scan otherwise, with the whole clause applied as the filter.
+// Writes and the point reads of batches and transactions must name the
+// full primary key; any other conditions in their WHERE clause act as a
+// ConditionExpression. The NextToken of a SELECT is the encoded
+// LastEvaluatedKey.
+//
+
+const maxBatchStatements = 25
+
+// stmtTarget is the item a write or point read addresses.
+type stmtTarget struct {
+	td   *TableDescription
+	key  Item
+	rest *condExpr // the WHERE clause without the key equalities
+}
+
+// stagedStatement is the outcome of evaluating a write.
+type stagedStatement struct {
+	write    *pendingWrite // nil when nothing changes
+	items    []Item        // RETURNING values
+	capacity *ConsumedCapacity
+}
+
+func encodeNextToken(key Item) string {
+	buf, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func decodeNextToken(token string) (Item, *ddbError) {
+	if token == "" {
+		return nil, nil
+	}
+	var key Item
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || json.Unmarshal(buf, &key) != nil || len(key) == 0 {
+		return nil, errValidation("Given NextToken is not valid")
+	}
+	return key, nil
+}
+
+// statementErrorCode is the Code of a per-statement error or cancellation
+// reason: the exception name without its suffix.
+func statementErrorCode(typ string) string {
+	if typ == "ValidationException" {
+		return "ValidationError"
+	}
+	return strings.TrimSuffix(typ, "Exception")
+}
+
+// target resolves the table and primary key a statement addresses.
+func (h *Handler) target(ctx context.Context, ns string, st *statement) (*stmtTarget, *ddbError) {
+	td, derr := h.loadTable(ctx, ns, st.table)
+	if derr != nil {
+		return nil, derr
+	}
+	if st.index != "" {
+		return nil, errValidation("Index is not supported for this statement: " + st.table + "." + st.index)
+	}
+	if st.verb == "INSERT" {
+		if derr := validateItem(td, st.item); derr != nil {
+			return nil, derr
+		}
+		return &stmtTarget{td: td, key: primaryKey(td.KeySchema, st.item)}, nil
+	}
+	key, rest, derr := st.itemKey(td)
+	if derr != nil {
+		return nil, derr
+	}
+	return &stmtTarget{td: td, key: normalizeItem(key), rest: rest}, nil
+}
+
+// pointRead reads the one item a SELECT addresses by its full key.
+func (h *Handler) pointRead(ctx context.Context, ns string, st *statement, t *stmtTarget) (Item, *ddbError) {
+	item, derr := h.getItem(ctx, ns, t.td, t.key)
+	if derr != nil || item == nil {
+		return nil, derr
+	}
+	if t.rest != nil && !evalCondition(t.rest, item) {
+		return nil, nil
+	}
+	return projectPaths(item, st.projection), nil
+}
+
+// statementTables lists the tables statements refer to.
+func statementTables(statements []*statement) []string {
+	var tables []string
+	for _, st := range statements {
+		if st != nil {
+			tables = append(tables, st.table)
+		}
+	}
+	return tables
+}
+
+// stage evaluates a write or EXISTS check against the stored item without
+// writing anything. Callers hold the table's write lock.
+func (h *Handler) stage(ctx context.Context, ns string, st *statement, t *stmtTarget, onFailure, capacityMode string) (*stagedStatement, *ddbError) {
+	old, derr := h.getItem(ctx, ns, t.td, t.key)
+	if derr != nil {
+		return nil, derr
+	}
+	conditionFailed := &ddbError{Type: "ConditionalCheckFailedException", Message: "The conditional request failed"}
+
+	switch st.verb {
+	case "EXISTS":
+		if old == nil {
+			return nil, conditionFailed
+		}
+		if derr := checkCondition(t.rest, old, onFailure); derr != nil {
+			return nil, derr
+		}
+		return &stagedStatement{capacity: consumedCapacity(capacityMode, t.td.TableName, old, false, true)}, nil
+
+	case "INSERT":
+		if old != nil {
+			return nil, &ddbError{Type: "DuplicateItemException", Message: "Duplicate primary key exists in table"}
+		}
+		item := normalizeItem(st.item)
+		return &stagedStatement{
+			write:    &pendingWrite{td: t.td, item: item},
+			capacity: consumedCapacity(capacityMode, t.td.TableName, item, true, true),
+		}, nil
+
+	case "DELETE":
+		if derr := checkCondition(t.rest, old, onFailure); derr != nil {
+			return nil, derr
+		}
+		out := &stagedStatement{capacity: consumedCapacity(capacityMode, t.td.TableName, old, true, true)}
+		if old != nil {
+			out.write = &pendingWrite{td: t.td, old: old}
+			if st.returning == "ALL_OLD" {
+				out.items = []Item{old}
+			}
+		}
+		return out, nil
+	}
+
+	// UPDATE only changes an existing item.
+	if old == nil {
+		return nil, conditionFailed
+	}
+	if derr := checkCondition(t.rest, old, onFailure); derr != nil {
+		return nil, derr
+	}
+	item := copyItem(old)
+	hash, rng := keyNames(t.td.KeySchema)
+	if derr := applyUpdate(st.update, item, hash, rng); derr != nil {
+		return nil, derr
+	}
+	for _, v := range item {
+		if err := validateValue(v); err != nil {
+			return nil, errValidation(err.Error())
+		}
+	}
+	if itemSize(item) > maxItemSize {
+		return nil, errValidation("Item size to update has exceeded the maximum allowed size")
+	}
+	out := &stagedStatement{
+		write:    &pendingWrite{td: t.td, old: old, item: item},
+		capacity: consumedCapacity(capacityMode, t.td.TableName, item, true, true),
+	}
+	if values := returnValues(st.returning, old, item, st.update.paths()); values != nil {
+		out.items = []Item{values}
+	}
+	return out, nil
+}
+
+// selectItems runs a SELECT as a Query or Scan and returns one page.
+func (h *Handler) selectItems(ctx context.Context, ns string, st *statement, limit *int, startKey Item, consistent bool, capacityMode string) ([]Item, PageSummary, *ddbError) {
+	p, derr := h.planRead(ctx, ns, st.table, st.index, "", limit, startKey, consistent)
+	if derr != nil {
+		return nil, PageSummary{}, derr
+	}
+	p.filter = st.where
+	p.projection = st.projection
+
+	hash, rng := keyNames(p.index.keySchema)
+	if key, _ := splitKey(st.where, hash); len(key) == 1 {
+		p.query = true
+		p.keyCond = &condExpr{op: "=", args: []*operand{
+			{kind: operandPath, path: docPath{{name: hash}}},
+			{kind: operandValue, value: key[hash]},
+		}}
+	}
+	if st.orderBy != nil {
+		if !p.query {
+			return nil, PageSummary{}, errValidation("Must have WHERE clause in the statement when using ORDER BY clause.")
+		}
+		if len(st.orderBy) != 1 || (st.orderBy[0].name != hash && st.orderBy[0].name != rng) {
+			return nil, PageSummary{}, errValidation("Variable reference " + st.orderBy.String() + " in ORDER BY clause must be a key attribute")
+		}
+		p.forward = !st.descending
+	}
+	if derr := p.resolveSelect(); derr != nil {
+		return nil, PageSummary{}, derr
+	}
+	return h.run(ctx, ns, p, capacityMode, consistent)
+}
+
+// ExecuteStatement runs one PartiQL statement
+func (h *Handler) ExecuteStatement(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req ExecuteStatementInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if derr := validateReturnValues("", req.ReturnValuesOnConditionCheckFailure, false); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	st, derr := parseStatement(req.Statement, req.Parameters)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if st.verb == "EXISTS" {
+		writeError(w, errValidation("EXISTS is only supported in ExecuteTransaction"))
+		return
+	}
+
+	defer h.lockTables(ns, st.verb != "SELECT", st.table)()
+
+	if st.verb == "SELECT" {
+		startKey, derr := decodeNextToken(req.NextToken)
+		if derr != nil {
+			writeError(w, derr)
+			return
+		}
+		items, page, derr := h.selectItems(r.Context(), ns, st, req.Limit, startKey, req.ConsistentRead, req.ReturnConsumedCapacity)
+		if derr != nil {
+			writeError(w, derr)
+			return
+		}
+		out := ExecuteStatementOutput{Items: items, LastEvaluatedKey: page.LastEvaluatedKey, ConsumedCapacity: page.ConsumedCapacity}
+		if page.LastEvaluatedKey != nil {
+			out.NextToken = encodeNextToken(page.LastEvaluatedKey)
+		}
+		awsresponses.WriteJSON(w, http.StatusOK, out)
+		return
+	}
+
+	t, derr := h.target(r.Context(), ns, st)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	staged, derr := h.stage(r.Context(), ns, st, t, req.ReturnValuesOnConditionCheckFailure, req.ReturnConsumedCapacity)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if pw := staged.write; pw != nil {
+		if derr := h.writeItem(r.Context(), h.Store, ns, pw.td, pw.old, pw.item); derr != nil {
+			writeError(w, derr)
+			return
+		}
+	}
+
+	items := staged.items
+	if items == nil {
+		items = []Item{}
+	}
+	awsresponses.WriteJSON(w, http.StatusOK, ExecuteStatementOutput{Items: items, ConsumedCapacity: staged.capacity})
+}
+
+// BatchExecuteStatement runs up to 25 point reads or up to 25 writes,
+// each succeeding or failing on its own
+func (h *Handler) BatchExecuteStatement(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req BatchExecuteStatementInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if len(req.Statements) == 0 || len(req.Statements) > maxBatchStatements {
+		writeError(w, errValidation("1 validation error detected: Value at 'statements' failed to satisfy constraint: "+
+			"Member must have length less than or equal to 25, Member must have length greater than or equal to 1"))
+		return
+	}
+
+	out := BatchExecuteStatementOutput{Responses: make([]BatchStatementResponse, len(req.Statements))}
+	fail := func(i int, derr *ddbError) {
+		out.Responses[i].Error = &BatchStatementError{Code: statementErrorCode(derr.Type), Message: derr.Message, Item: derr.Item}
+	}
+
+	statements := make([]*statement, len(req.Statements))
+	reads, writes := 0, 0
+	for i, s := range req.Statements {
+		st, derr := parseStatement(s.Statement, s.Parameters)
+		if derr == nil && st.verb == "EXISTS" {
+			derr = errValidation("EXISTS is only supported in ExecuteTransaction")
+		}
+		if derr == nil {
+			derr = validateReturnValues("", s.ReturnValuesOnConditionCheckFailure, false)
+		}
+		if derr != nil {
+			fail(i, derr)
+			continue
+		}
+		statements[i] = st
+		if st.isRead() {
+			reads++
+		} else {
+			writes++
+		}
+	}
+	if reads > 0 && writes > 0 {
+		writeError(w, errValidation("Supplied statements must be either all reads or all writes"))
+		return
+	}
+
+	defer h.lockTables(ns, writes > 0, statementTables(statements)...)()
+
+	capacity := capacityTotals{}
+	for i, st := range statements {
+		if st == nil {
+			continue
+		}
+		s := req.Statements[i]
+		t, derr := h.target(r.Context(), ns, st)
+		if derr != nil {
+			fail(i, derr)
+			continue
+		}
+		out.Responses[i].TableName = t.td.TableName
+
+		if st.isRead() {
+			item, derr := h.pointRead(r.Context(), ns, st, t)
+			if derr != nil {
+				fail(i, derr)
+				continue
+			}
+			out.Responses[i].Item = item
+			capacity.add(consumedCapacity(req.ReturnConsumedCapacity, t.td.TableName, item, false, s.ConsistentRead), 1)
+			continue
+		}
+
+		staged, derr := h.stage(r.Context(), ns, st, t, s.ReturnValuesOnConditionCheckFailure, req.ReturnConsumedCapacity)
+		if derr == nil && staged.write != nil {
+			derr = h.writeItem(r.Context(), h.Store, ns, t.td, staged.write.old, staged.write.item)
+		}
+		if derr != nil {
+			fail(i, derr)
+			continue
+		}
+		capacity.add(staged.capacity, 1)
+	}
+	out.ConsumedCapacity = capacity.list()
+
+	awsresponses.WriteJSON(w, http.StatusOK, out)
+}
+
+// ExecuteTransaction runs up to 100 statements atomically: either all
+// point reads, or writes and EXISTS checks
+func (h *Handler) ExecuteTransaction(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req ExecuteTransactionInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if len(req.TransactStatements) == 0 || len(req.TransactStatements) > maxTransactItems {
+		writeError(w, errValidation("1 validation error detected: Value at 'transactStatements' failed to satisfy constraint: "+
+			"Member must have length less than or equal to 100, Member must have length greater than or equal to 1"))
+		return
+	}
+	if len(req.ClientRequestToken) > 36 {
+		writeError(w, errValidation("1 validation error detected: Value at 'clientRequestToken' failed to satisfy constraint: "+
+			"Member must have length less than or equal to 36"))
+		return
+	}
+
+	statements := make([]*statement, len(req.TransactStatements))
+	selects := 0
+	for i, s := range req.TransactStatements {
+		st, derr := parseStatement(s.Statement, s.Parameters)
+		if derr != nil {
+			writeError(w, derr)
+			return
+		}
+		if derr := validateReturnValues("", s.ReturnValuesOnConditionCheckFailure, false); derr != nil {
+			writeError(w, derr)
+			return
+		}
+		if st.verb == "SELECT" {
+			selects++
+		}
+		statements[i] = st
+	}
+	if selects > 0 && selects < len(statements) {
+		writeError(w, errValidation("Transaction must contain either only SELECT statements or only write and EXISTS statements"))
+		return
+	}
+
+	defer h.lockTables(ns, selects == 0, statementTables(statements)...)()
+
+	targets := make([]*stmtTarget, len(statements))
+	seen := map[string]bool{}
+	for i, st := range statements {
+		t, derr := h.target(r.Context(), ns, st)
+		if derr != nil {
+			writeError(w, derr)
+			return
+		}
+		id := itemID(t.td, t.key)
+		if seen[id] {
+			writeError(w, errValidation("Transaction request cannot include multiple operations on one item"))
+			return
+		}
+		seen[id] = true
+		targets[i] = t
+	}
+
+	capacity := capacityTotals{}
+	if selects > 0 {
+		out := ExecuteTransactionOutput{Responses: make([]ItemResponse, len(statements))}
+		for i, st := range statements {
+			item, derr := h.pointRead(r.Context(), ns, st, targets[i])
+			if derr != nil {
+				writeError(w, derr)
+				return
+			}
+			out.Responses[i] = ItemResponse{Item: item}
+			capacity.add(consumedCapacity(req.ReturnConsumedCapacity, targets[i].td.TableName, item, false, true), 2)
+		}
+		out.ConsumedCapacity = capacity.list()
+		awsresponses.WriteJSON(w, http.StatusOK, out)
+		return
+	}
+
+	replayed, recordToken, derr := h.checkClientToken(r.Context(), ns, req.ClientRequestToken, req.TransactStatements)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	var writes []pendingWrite
+	reasons := make([]CancellationReason, len(statements))
+	cancelled := false
+	for i, st := range statements {
+		staged, derr := h.stage(r.Context(), ns, st, targets[i], req.TransactStatements[i].ReturnValuesOnConditionCheckFailure, req.ReturnConsumedCapacity)
+		if derr != nil {
+			if derr.Type == "InternalServerError" {
+				writeError(w, derr)
+				return
+			}
+			reasons[i] = CancellationReason{Code: statementErrorCode(derr.Type), Message: derr.Message, Item: derr.Item}
+			cancelled = true
+			continue
+		}
+		reasons[i] = CancellationReason{Code: "None"}
+		capacity.add(staged.capacity, 2)
+		if staged.write != nil {
+			writes = append(writes, *staged.write)
+		}
+	}
+
+	if replayed {
+		awsresponses.WriteJSON(w, http.StatusOK, ExecuteTransactionOutput{ConsumedCapacity: capacity.list()})
+		return
+	}
+	if cancelled {
+		writeError(w, errTransactionCanceled(reasons))
+		return
+	}
+	if derr := h.commit(r.Context(), ns, writes, recordToken); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, ExecuteTransactionOutput{ConsumedCapacity: capacity.list()})
+}
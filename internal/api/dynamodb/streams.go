@@ -0,0 +1,501 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"opensnack/internal/awsarn"
+	"opensnack/internal/awsresponses"
+	"opensnack/internal/resource"
+	"opensnack/internal/util"
+
+	"github.com/google/uuid"
+)
+
+//
+// STREAMS
+//
+// Every item write on a table with a stream enabled appends a change
+// record, stored as a dynamodb/"stream-record" resource. The resource ID
+// is the table name followed by the zero-padded sequence number, so the
+// records of a table sort in write order. The stream view type decides
+// which item images a record keeps.
+//
+// Streams themselves are dynamodb/"stream" resources keyed by ARN. A
+// stream stays readable after it is disabled or its table is deleted, and
+// records are kept for 24 hours. Each stream has a single shard; shard
+// iterators are opaque tokens holding the last sequence number read.
+//
+
+const (
+	streamRetention = 24 * time.Hour
+	iteratorTTL     = 15 * time.Minute
+	streamLabelFmt  = "2006-01-02T15:04:05.000"
+)
+
+// storedRecord is the JSON persisted for each stream record.
+type storedRecord struct {
+	StreamArn string `json:"stream_arn"`
+	Table     string `json:"table"`
+	Record    Record `json:"record"`
+}
+
+// storedStream is the JSON persisted for each stream.
+type storedStream struct {
+	StreamArn string             `json:"stream_arn"`
+	Label     string             `json:"label"`
+	Table     string             `json:"table"`
+	ViewType  string             `json:"view_type"`
+	Status    string             `json:"status"`
+	KeySchema []KeySchemaElement `json:"key_schema"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+// shardIterator is the decoded form of a ShardIterator token.
+type shardIterator struct {
+	StreamArn string `json:"a"`
+	ShardID   string `json:"s"`
+	After     string `json:"p"`
+	IssuedAt  int64  `json:"t"`
+}
+
+func errStreamNotFound(arn string) *ddbError {
+	return &ddbError{Type: "ResourceNotFoundException", Message: "Requested resource not found: Stream: " + arn + " not found"}
+}
+
+// enableStream gives td a new stream and records it.
+func (h *Handler) enableStream(ctx context.Context, ns string, td *TableDescription, spec *StreamSpecification) error {
+	startStream(td, spec)
+	return h.recordStream(ctx, ns, td)
+}
+
+// startStream points td at a new stream, labelled with the current time.
+func startStream(td *TableDescription, spec *StreamSpecification) {
+	td.StreamSpecification = spec
+	td.LatestStreamLabel = time.Now().UTC().Format(streamLabelFmt)
+	td.LatestStreamArn = td.TableArn + "/stream/" + td.LatestStreamLabel
+}
+
+// recordStream stores the stream td's LatestStreamArn names.
+func (h *Handler) recordStream(ctx context.Context, ns string, td *TableDescription) error {
+	buf, err := json.Marshal(storedStream{
+		StreamArn: td.LatestStreamArn,
+		Label:     td.LatestStreamLabel,
+		Table:     td.TableName,
+		ViewType:  td.StreamSpecification.StreamViewType,
+		Status:    "ENABLED",
+		KeySchema: td.KeySchema,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	return h.Store.Create(ctx, &resource.Resource{
+		ID:         td.LatestStreamArn,
+		Namespace:  ns,
+		Service:    "dynamodb",
+		Type:       "stream",
+		Attributes: buf,
+	})
+}
+
+// disableStreams marks every enabled stream of a table DISABLED.
+func (h *Handler) disableStreams(ctx context.Context, ns, table string) {
+	page, err := h.Store.Query(ctx, resource.Query{
+		Service:   "dynamodb",
+		Type:      "stream",
+		Namespace: ns,
+		Match:     map[string]any{"table": table, "status": "ENABLED"},
+	})
+	if err != nil {
+		return
+	}
+	for _, res := range page.Resources {
+		h.Store.Mutate(ctx, res.ID, "dynamodb", "stream", ns, func(res *resource.Resource) error {
+			var st storedStream
+			if err := json.Unmarshal(res.Attributes, &st); err != nil {
+				return err
+			}
+			st.Status = "DISABLED"
+			buf, err := json.Marshal(st)
+			if err != nil {
+				return err
+			}
+			res.Attributes = buf
+			return nil
+		})
+	}
+}
+
+// loadStream returns a stored stream by ARN.
+func (h *Handler) loadStream(ctx context.Context, ns, arn string) (*storedStream, *ddbError) {
+	if arn == "" {
+		return nil, errValidation("StreamArn is required")
+	}
+	res, err := h.Store.Get(ctx, arn, "dynamodb", "stream", ns)
+	if err != nil {
+		return nil, errStreamNotFound(arn)
+	}
+	var st storedStream
+	if err := json.Unmarshal(res.Attributes, &st); err != nil {
+		return nil, errInternal(err)
+	}
+	return &st, nil
+}
+
+// shardID returns the ID of a stream's only shard.
+func shardID(arn string) string {
+	f := fnv.New32a()
+	f.Write([]byte(arn))
+	return fmt.Sprintf("shardId-00000000000000000001-%08x", f.Sum32())
+}
+
+// streamRecords returns the live records of a stream in sequence order.
+func (h *Handler) streamRecords(ctx context.Context, ns string, st *storedStream, now time.Time) ([]Record, *ddbError) {
+	page, err := h.Store.Query(ctx, resource.Query{
+		Service:   "dynamodb",
+		Type:      "stream-record",
+		Namespace: ns,
+		IDPrefix:  st.Table + "/",
+		Match:     map[string]any{"stream_arn": st.StreamArn},
+	})
+	if err != nil {
+		return nil, errInternal(err)
+	}
+	cutoff := float64(now.Add(-streamRetention).Unix())
+	var records []Record
+	for _, res := range page.Resources {
+		var stored storedRecord
+		if json.Unmarshal(res.Attributes, &stored) != nil {
+			continue
+		}
+		if stored.Record.Dynamodb.ApproximateCreationDateTime < cutoff {
+			continue
+		}
+		records = append(records, stored.Record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Dynamodb.SequenceNumber < records[j].Dynamodb.SequenceNumber
+	})
+	return records, nil
+}
+
+// trimStreamRecords deletes the records of a namespace older than the
+// stream retention period.
+func (h *Handler) trimStreamRecords(ctx context.Context, ns string, now time.Time) {
+	resources, err := h.Store.List(ctx, "dynamodb", "stream-record", ns)
+	if err != nil {
+		return
+	}
+	cutoff := float64(now.Add(-streamRetention).Unix())
+	for _, res := range resources {
+		var stored storedRecord
+		if json.Unmarshal(res.Attributes, &stored) == nil && stored.Record.Dynamodb.ApproximateCreationDateTime < cutoff {
+			h.Store.Delete(ctx, res.ID, "dynamodb", "stream-record", ns)
+		}
+	}
+}
+
+// nextSequenceNumber returns a stream sequence number larger than any
+// handed out before.
+func (h *Handler) nextSequenceNumber() string {
+	h.seqMu.Lock()
+	defer h.seqMu.Unlock()
+	seq := time.Now().UnixNano()
+	if seq <= h.lastSeq {
+		seq = h.lastSeq + 1
+	}
+	h.lastSeq = seq
+	return fmt.Sprintf("%021d", seq)
+}
+
+// emitRecord appends the change from old to item to the table's stream.
+// identity is nil for changes made by the caller.
+func (h *Handler) emitRecord(ctx context.Context, s resource.Store, ns string, td *TableDescription, old, item Item, identity *Identity) *ddbError {
+	spec := td.StreamSpecification
+	if spec == nil || !spec.StreamEnabled || td.LatestStreamArn == "" {
+		return nil
+	}
+
+	rec := Record{
+		AwsRegion:    awsarn.FromContext(ctx).Region,
+		EventID:      strings.ReplaceAll(uuid.NewString(), "-", ""),
+		EventSource:  "aws:dynamodb",
+		EventVersion: "1.1",
+		UserIdentity: identity,
+	}
+	image := item
+	switch {
+	case old == nil:
+		rec.EventName = "INSERT"
+	case item == nil:
+		rec.EventName = "REMOVE"
+		image = old
+	default:
+		rec.EventName = "MODIFY"
+	}
+
+	sr := StreamRecord{
+		ApproximateCreationDateTime: float64(time.Now().Unix()),
+		Keys:                        primaryKey(td.KeySchema, image),
+		SequenceNumber:              h.nextSequenceNumber(),
+		StreamViewType:              spec.StreamViewType,
+	}
+	switch spec.StreamViewType {
+	case "NEW_IMAGE":
+		sr.NewImage = item
+	case "OLD_IMAGE":
+		sr.OldImage = old
+	case "NEW_AND_OLD_IMAGES":
+		sr.NewImage, sr.OldImage = item, old
+	}
+	sr.SizeBytes = itemSize(sr.Keys) + itemSize(sr.NewImage) + itemSize(sr.OldImage)
+	rec.Dynamodb = sr
+
+	buf, err := json.Marshal(storedRecord{StreamArn: td.LatestStreamArn, Table: td.TableName, Record: rec})
+	if err != nil {
+		return errInternal(err)
+	}
+	err = s.Create(ctx, &resource.Resource{
+		ID:         td.TableName + "/" + sr.SequenceNumber,
+		Namespace:  ns,
+		Service:    "dynamodb",
+		Type:       "stream-record",
+		Attributes: buf,
+	})
+	if err != nil {
+		return errInternal(err)
+	}
+	return nil
+}
+
+// ListStreams lists the streams of the caller's tables
+func (h *Handler) ListStreams(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req ListStreamsInput
+	if r.ContentLength != 0 {
+		if derr := decodeInput(r, &req); derr != nil {
+			writeError(w, derr)
+			return
+		}
+	}
+	if req.Limit < 0 || req.Limit > 100 {
+		writeError(w, errValidation("1 validation error detected: Value '"+strconv.Itoa(req.Limit)+
+			"' at 'limit' failed to satisfy constraint: Member must have value less than or equal to 100"))
+		return
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = 100
+	}
+
+	// Streams are stored under their ARNs, so the exclusive start ARN is
+	// a store cursor.
+	q := resource.Query{Service: "dynamodb", Type: "stream", Namespace: ns, Limit: limit}
+	if req.TableName != "" {
+		q.Match = map[string]any{"table": extractTableName(req.TableName)}
+	}
+	if req.ExclusiveStartStreamArn != "" {
+		q.Cursor = resource.EncodeCursor(req.ExclusiveStartStreamArn)
+	}
+	page, err := h.Store.Query(r.Context(), q)
+	if err != nil {
+		writeError(w, errInternal(err))
+		return
+	}
+
+	out := ListStreamsOutput{Streams: []StreamSummary{}}
+	for _, res := range page.Resources {
+		var st storedStream
+		if json.Unmarshal(res.Attributes, &st) != nil {
+			continue
+		}
+		out.Streams = append(out.Streams, StreamSummary{StreamArn: st.StreamArn, StreamLabel: st.Label, TableName: st.Table})
+	}
+	if page.Next != "" && len(out.Streams) > 0 {
+		out.LastEvaluatedStreamArn = out.Streams[len(out.Streams)-1].StreamArn
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, out)
+}
+
+// DescribeStream describes a stream and its shard
+func (h *Handler) DescribeStream(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req DescribeStreamInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	st, derr := h.loadStream(r.Context(), ns, req.StreamArn)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	records, derr := h.streamRecords(r.Context(), ns, st, time.Now())
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	shard := Shard{ShardId: shardID(st.StreamArn)}
+	shard.SequenceNumberRange.StartingSequenceNumber = fmt.Sprintf("%021d", st.CreatedAt.UnixNano())
+	if len(records) > 0 {
+		shard.SequenceNumberRange.StartingSequenceNumber = records[0].Dynamodb.SequenceNumber
+	}
+	if st.Status == "DISABLED" {
+		shard.SequenceNumberRange.EndingSequenceNumber = shard.SequenceNumberRange.StartingSequenceNumber
+		if len(records) > 0 {
+			shard.SequenceNumberRange.EndingSequenceNumber = records[len(records)-1].Dynamodb.SequenceNumber
+		}
+	}
+	desc := StreamDescription{
+		StreamArn:               st.StreamArn,
+		StreamLabel:             st.Label,
+		StreamStatus:            st.Status,
+		StreamViewType:          st.ViewType,
+		CreationRequestDateTime: float64(st.CreatedAt.Unix()),
+		TableName:               st.Table,
+		KeySchema:               st.KeySchema,
+		Shards:                  []Shard{},
+	}
+	if req.ExclusiveStartShardId == "" || req.ExclusiveStartShardId < shard.ShardId {
+		desc.Shards = append(desc.Shards, shard)
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, DescribeStreamOutput{StreamDescription: desc})
+}
+
+// GetShardIterator returns an iterator positioned in a shard
+func (h *Handler) GetShardIterator(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req GetShardIteratorInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	st, derr := h.loadStream(r.Context(), ns, req.StreamArn)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if req.ShardId != shardID(st.StreamArn) {
+		writeError(w, &ddbError{Type: "ResourceNotFoundException", Message: "Requested resource not found: Shard does not exist"})
+		return
+	}
+
+	it := shardIterator{StreamArn: st.StreamArn, ShardID: req.ShardId, IssuedAt: time.Now().Unix()}
+	switch req.ShardIteratorType {
+	case "TRIM_HORIZON":
+	case "LATEST":
+		records, derr := h.streamRecords(r.Context(), ns, st, time.Now())
+		if derr != nil {
+			writeError(w, derr)
+			return
+		}
+		if len(records) > 0 {
+			it.After = records[len(records)-1].Dynamodb.SequenceNumber
+		}
+	case "AT_SEQUENCE_NUMBER", "AFTER_SEQUENCE_NUMBER":
+		seq, err := strconv.ParseInt(req.SequenceNumber, 10, 64)
+		if err != nil || seq < 1 {
+			writeError(w, errValidation("Invalid SequenceNumber: "+req.SequenceNumber))
+			return
+		}
+		if req.ShardIteratorType == "AT_SEQUENCE_NUMBER" {
+			seq--
+		}
+		it.After = fmt.Sprintf("%021d", seq)
+	default:
+		writeError(w, errValidation("1 validation error detected: Value '"+req.ShardIteratorType+"' at 'shardIteratorType' "+
+			"failed to satisfy constraint: Member must satisfy enum value set: [AFTER_SEQUENCE_NUMBER, LATEST, AT_SEQUENCE_NUMBER, TRIM_HORIZON]"))
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, GetShardIteratorOutput{ShardIterator: encodeIterator(it)})
+}
+
+func encodeIterator(it shardIterator) string {
+	buf, _ := json.Marshal(it)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func decodeIterator(token string) (shardIterator, bool) {
+	var it shardIterator
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || json.Unmarshal(buf, &it) != nil || it.StreamArn == "" {
+		return it, false
+	}
+	return it, true
+}
+
+// GetRecords reads the records after a shard iterator
+func (h *Handler) GetRecords(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req GetRecordsInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if req.Limit < 0 || req.Limit > 1000 {
+		writeError(w, errValidation("1 validation error detected: Value '"+strconv.Itoa(req.Limit)+
+			"' at 'limit' failed to satisfy constraint: Member must have value less than or equal to 1000"))
+		return
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = 1000
+	}
+
+	it, ok := decodeIterator(req.ShardIterator)
+	if !ok {
+		writeError(w, errValidation("Invalid ShardIterator"))
+		return
+	}
+	now := time.Now()
+	if issued := time.Unix(it.IssuedAt, 0); now.Sub(issued) > iteratorTTL {
+		writeError(w, &ddbError{Type: "ExpiredIteratorException", Message: "Iterator expired. The iterator was created at time " +
+			issued.UTC().Format(time.RFC1123) + " while right now the time is " + now.UTC().Format(time.RFC1123)})
+		return
+	}
+	st, derr := h.loadStream(r.Context(), ns, it.StreamArn)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+	all, derr := h.streamRecords(r.Context(), ns, st, now)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	start := sort.Search(len(all), func(i int) bool { return all[i].Dynamodb.SequenceNumber > it.After })
+	end := min(start+limit, len(all))
+	out := GetRecordsOutput{Records: append([]Record{}, all[start:end]...)}
+	if end > start {
+		it.After = all[end-1].Dynamodb.SequenceNumber
+	}
+	// A disabled stream's shard is closed once it has been read to the end.
+	if st.Status == "ENABLED" || end < len(all) {
+		it.IssuedAt = now.Unix()
+		out.NextShardIterator = encodeIterator(it)
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,177 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"opensnack/internal/api/dynamodb"
+	"opensnack/internal/resource"
+)
+
+// streamsCall invokes a DynamoDBStreams_20120810.* operation.
+func streamsCall(t *testing.T, h *dynamodb.Handler, op, body string, out any) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("X-Amz-Target", "DynamoDBStreams_20120810."+op)
+	req.Header.Set("User-Agent", "opensnack-test custom-ns1")
+	rec := httptest.NewRecorder()
+	h.Dispatch(rec, req)
+	if out != nil && rec.Code == 200 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("invalid JSON for %s: %s", op, rec.Body.String())
+		}
+	}
+	return rec
+}
+
+func mustStreams(t *testing.T, h *dynamodb.Handler, op, body string, out any) {
+	t.Helper()
+	if rec := streamsCall(t, h, op, body, out); rec.Code != 200 {
+		t.Fatalf("%s failed: %d %s", op, rec.Code, rec.Body.String())
+	}
+}
+
+// iterator returns a shard iterator for the only shard of a stream.
+func iterator(t *testing.T, h *dynamodb.Handler, arn, typ, seq string) string {
+	t.Helper()
+	var desc dynamodb.DescribeStreamOutput
+	mustStreams(t, h, "DescribeStream", `{"StreamArn":"`+arn+`"}`, &desc)
+	body := `{"StreamArn":"` + arn + `","ShardId":"` + desc.StreamDescription.Shards[0].ShardId + `","ShardIteratorType":"` + typ + `"`
+	if seq != "" {
+		body += `,"SequenceNumber":"` + seq + `"`
+	}
+	var out dynamodb.GetShardIteratorOutput
+	mustStreams(t, h, "GetShardIterator", body+`}`, &out)
+	return out.ShardIterator
+}
+
+func eventNames(records []dynamodb.Record) string {
+	var names []string
+	for _, r := range records {
+		names = append(names, r.EventName)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestStreams_Records(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	mustCall(t, h, "CreateTable", `{"TableName":"users","BillingMode":"PAY_PER_REQUEST",`+
+		`"AttributeDefinitions":[{"AttributeName":"pk","AttributeType":"S"}],"KeySchema":[{"AttributeName":"pk","KeyType":"HASH"}],`+
+		`"StreamSpecification":{"StreamEnabled":true,"StreamViewType":"NEW_AND_OLD_IMAGES"}}`, nil)
+
+	var desc dynamodb.DescribeTableOutput
+	mustCall(t, h, "DescribeTable", `{"TableName":"users"}`, &desc)
+	arn := desc.Table.LatestStreamArn
+	if !strings.Contains(arn, ":table/users/stream/") {
+		t.Fatalf("unexpected LatestStreamArn %q", arn)
+	}
+
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"u1"},"v":{"N":"1"}}}`, nil)
+	mustCall(t, h, "UpdateItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}},"UpdateExpression":"SET v = :v","ExpressionAttributeValues":{":v":{"N":"2"}}}`, nil)
+	mustCall(t, h, "DeleteItem", `{"TableName":"users","Key":{"pk":{"S":"u1"}}}`, nil)
+
+	var streams dynamodb.ListStreamsOutput
+	mustStreams(t, h, "ListStreams", `{"TableName":"users"}`, &streams)
+	if len(streams.Streams) != 1 || streams.Streams[0].StreamArn != arn {
+		t.Fatalf("unexpected streams: %+v", streams)
+	}
+
+	var page dynamodb.GetRecordsOutput
+	mustStreams(t, h, "GetRecords", `{"ShardIterator":"`+iterator(t, h, arn, "TRIM_HORIZON", "")+`","Limit":2}`, &page)
+	if eventNames(page.Records) != "INSERT,MODIFY" || page.NextShardIterator == "" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	modify := page.Records[1].Dynamodb
+	if *modify.OldImage["v"].N != "1" || *modify.NewImage["v"].N != "2" || *modify.Keys["pk"].S != "u1" ||
+		modify.StreamViewType != "NEW_AND_OLD_IMAGES" || page.Records[1].EventSource != "aws:dynamodb" {
+		t.Fatalf("unexpected MODIFY record: %+v", page.Records[1])
+	}
+
+	var rest dynamodb.GetRecordsOutput
+	mustStreams(t, h, "GetRecords", `{"ShardIterator":"`+page.NextShardIterator+`"}`, &rest)
+	if eventNames(rest.Records) != "REMOVE" || rest.Records[0].Dynamodb.NewImage != nil || rest.Records[0].UserIdentity != nil {
+		t.Fatalf("unexpected second page: %+v", rest)
+	}
+
+	// AT_SEQUENCE_NUMBER includes the record, AFTER_SEQUENCE_NUMBER skips it.
+	seq := page.Records[1].Dynamodb.SequenceNumber
+	mustStreams(t, h, "GetRecords", `{"ShardIterator":"`+iterator(t, h, arn, "AT_SEQUENCE_NUMBER", seq)+`"}`, &page)
+	if eventNames(page.Records) != "MODIFY,REMOVE" {
+		t.Fatalf("unexpected AT_SEQUENCE_NUMBER records: %s", eventNames(page.Records))
+	}
+	mustStreams(t, h, "GetRecords", `{"ShardIterator":"`+iterator(t, h, arn, "AFTER_SEQUENCE_NUMBER", seq)+`"}`, &page)
+	if eventNames(page.Records) != "REMOVE" {
+		t.Fatalf("unexpected AFTER_SEQUENCE_NUMBER records: %s", eventNames(page.Records))
+	}
+
+	// LATEST only sees new writes.
+	latest := iterator(t, h, arn, "LATEST", "")
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"u2"}}}`, nil)
+	mustStreams(t, h, "GetRecords", `{"ShardIterator":"`+latest+`"}`, &page)
+	if eventNames(page.Records) != "INSERT" || *page.Records[0].Dynamodb.Keys["pk"].S != "u2" {
+		t.Fatalf("unexpected LATEST records: %+v", page.Records)
+	}
+
+	if rec := streamsCall(t, h, "GetRecords", `{"ShardIterator":"bogus"}`, nil); rec.Code != 400 {
+		t.Fatalf("expected invalid iterator error, got %d", rec.Code)
+	}
+}
+
+func TestStreams_UpdateTable(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "users", false)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"before"}}}`, nil)
+
+	var streams dynamodb.ListStreamsOutput
+	mustStreams(t, h, "ListStreams", `{}`, &streams)
+	if len(streams.Streams) != 0 {
+		t.Fatalf("expected no streams, got %+v", streams)
+	}
+
+	var updated dynamodb.UpdateTableOutput
+	mustCall(t, h, "UpdateTable", `{"TableName":"users","StreamSpecification":{"StreamEnabled":true,"StreamViewType":"KEYS_ONLY"}}`, &updated)
+	arn := updated.TableDescription.LatestStreamArn
+	if arn == "" {
+		t.Fatal("expected a stream ARN after enabling the stream")
+	}
+	expectError(t, h, "UpdateTable", `{"TableName":"users","StreamSpecification":{"StreamEnabled":true,"StreamViewType":"NEW_IMAGE"}}`,
+		"ValidationException")
+
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"after"},"v":{"S":"x"}}}`, nil)
+	mustCall(t, h, "UpdateTable", `{"TableName":"users","StreamSpecification":{"StreamEnabled":false}}`, nil)
+	mustCall(t, h, "PutItem", `{"TableName":"users","Item":{"pk":{"S":"disabled"}}}`, nil)
+
+	var desc dynamodb.DescribeStreamOutput
+	mustStreams(t, h, "DescribeStream", `{"StreamArn":"`+arn+`"}`, &desc)
+	if desc.StreamDescription.StreamStatus != "DISABLED" || desc.StreamDescription.Shards[0].SequenceNumberRange.EndingSequenceNumber == "" {
+		t.Fatalf("unexpected disabled stream: %+v", desc.StreamDescription)
+	}
+
+	// The closed shard holds only the write made while it was enabled.
+	var page dynamodb.GetRecordsOutput
+	mustStreams(t, h, "GetRecords", `{"ShardIterator":"`+iterator(t, h, arn, "TRIM_HORIZON", "")+`"}`, &page)
+	if len(page.Records) != 1 || page.NextShardIterator != "" {
+		t.Fatalf("unexpected records from closed shard: %+v", page)
+	}
+	r := page.Records[0].Dynamodb
+	if *r.Keys["pk"].S != "after" || r.NewImage != nil || r.OldImage != nil || r.StreamViewType != "KEYS_ONLY" {
+		t.Fatalf("unexpected KEYS_ONLY record: %+v", r)
+	}
+
+	var table dynamodb.DescribeTableOutput
+	mustCall(t, h, "DescribeTable", `{"TableName":"users"}`, &table)
+	if table.Table.LatestStreamArn != arn || table.Table.StreamSpecification != nil {
+		t.Fatalf("unexpected table after disabling stream: %+v", table.Table)
+	}
+
+	if rec := streamsCall(t, h, "DescribeStream", `{"StreamArn":"`+arn+`x"}`, nil); rec.Code != 400 ||
+		!strings.Contains(rec.Body.String(), "ResourceNotFoundException") {
+		t.Fatalf("expected ResourceNotFoundException, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,449 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"opensnack/internal/awsresponses"
+	"opensnack/internal/resource"
+	"opensnack/internal/util"
+)
+
+//
+// TRANSACTIONS
+//
+// TransactWriteItems evaluates every condition and builds every new image
+// before anything is written. If any item fails, nothing is written and
+// the caller gets a TransactionCanceledException with one reason per
+// item. Otherwise the writes are committed together: inside a database
+// transaction when the store supports one (resource.Transactor), or in
+// order with the earlier writes undone if a later one fails.
+//
+// A ClientRequestToken is remembered for ten minutes; repeating the same
+// request with it is a no-op, repeating a different request is an error.
+//
+
+const (
+	maxTransactItems = 100
+	clientTokenTTL   = 10 * time.Minute
+)
+
+// pendingWrite is one item change staged by a transaction.
+type pendingWrite struct {
+	td        *TableDescription
+	old, item Item
+}
+
+// commit applies writes atomically. extra runs after the writes, on the
+// same store, so it commits or rolls back with them.
+func (h *Handler) commit(ctx context.Context, ns string, writes []pendingWrite, extra func(s resource.Store) error) *ddbError {
+	apply := func(s resource.Store, undo bool) *ddbError {
+		for i, pw := range writes {
+			derr := h.writeItem(ctx, s, ns, pw.td, pw.old, pw.item)
+			if derr == nil {
+				continue
+			}
+			if undo {
+				for j := i - 1; j >= 0; j-- {
+					h.storeItem(ctx, s, ns, writes[j].td, writes[j].item, writes[j].old)
+				}
+			}
+			return derr
+		}
+		if extra != nil {
+			if err := extra(s); err != nil {
+				var derr *ddbError
+				if errors.As(err, &derr) {
+					return derr
+				}
+				return errInternal(err)
+			}
+		}
+		return nil
+	}
+
+	tx, ok := h.Store.(resource.Transactor)
+	if !ok {
+		return apply(h.Store, true)
+	}
+	var derr *ddbError
+	err := tx.Transaction(ctx, func(s resource.Store) error {
+		if derr = apply(s, false); derr != nil {
+			return derr
+		}
+		return nil
+	})
+	if derr != nil {
+		return derr
+	}
+	if err != nil {
+		return errInternal(err)
+	}
+	return nil
+}
+
+// errTransactionCanceled reports a transaction that was not applied.
+func errTransactionCanceled(reasons []CancellationReason) *ddbError {
+	codes := make([]string, len(reasons))
+	for i, reason := range reasons {
+		codes[i] = reason.Code
+	}
+	return &ddbError{
+		Type:    "TransactionCanceledException",
+		Message: "Transaction cancelled, please refer cancellation reasons for specific reasons [" + strings.Join(codes, ", ") + "]",
+		Reasons: reasons,
+	}
+}
+
+// clientToken is the stored form of a ClientRequestToken.
+type clientToken struct {
+	Hash      string `json:"hash"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// checkClientToken looks up a ClientRequestToken for a request made of
+// items. It reports whether the same request was already applied and
+// returns the function that records the token as part of this request's
+// commit.
+func (h *Handler) checkClientToken(ctx context.Context, ns, token string, items any) (bool, func(resource.Store) error, *ddbError) {
+	if token == "" {
+		return false, nil, nil
+	}
+	buf, err := json.Marshal(items)
+	if err != nil {
+		return false, nil, errInternal(err)
+	}
+	sum := sha256.Sum256(buf)
+	hash := hex.EncodeToString(sum[:])
+
+	id := clientTokenID(token)
+	if res, err := h.Store.Get(ctx, id, "dynamodb", "client-token", ns); err == nil {
+		var stored clientToken
+		if json.Unmarshal(res.Attributes, &stored) == nil && time.Now().Unix() < stored.ExpiresAt {
+			if stored.Hash != hash {
+				return false, nil, &ddbError{Type: "IdempotentParameterMismatchException",
+					Message: "Request parameters do not match the original request for this ClientRequestToken"}
+			}
+			return true, nil, nil
+		}
+		// Expired tokens are only removed when they are next looked up.
+		_ = h.Store.Delete(ctx, id, "dynamodb", "client-token", ns)
+	}
+
+	record := func(s resource.Store) error {
+		attrs, err := json.Marshal(clientToken{Hash: hash, ExpiresAt: time.Now().Add(clientTokenTTL).Unix()})
+		if err != nil {
+			return err
+		}
+		err = s.Create(ctx, &resource.Resource{ID: id, Namespace: ns, Service: "dynamodb", Type: "client-token", Attributes: attrs})
+		if errors.Is(err, resource.ErrDuplicate) {
+			return &ddbError{Type: "TransactionInProgressException",
+				Message: "Another transaction with the same ClientRequestToken is in progress"}
+		}
+		return err
+	}
+	return false, record, nil
+}
+
+// clientTokenID is the resource ID of a ClientRequestToken. Resource IDs
+// are unique per namespace across every type, so the token is prefixed
+// to keep it from colliding with, say, a table of the same name.
+func clientTokenID(token string) string {
+	return "client-token/" + token
+}
+
+// transactOp is one parsed TransactWriteItems entry.
+type transactOp struct {
+	kind   string // ConditionCheck, Put, Delete or Update
+	op     *TransactWriteOperation
+	cond   *condExpr
+	update *updateExpr
+}
+
+// parseTransactOp validates the shape and expressions of one entry.
+func parseTransactOp(item TransactWriteItem) (*transactOp, *ddbError) {
+	var ops []*transactOp
+	for kind, op := range map[string]*TransactWriteOperation{
+		"ConditionCheck": item.ConditionCheck, "Put": item.Put, "Delete": item.Delete, "Update": item.Update,
+	} {
+		if op != nil {
+			ops = append(ops, &transactOp{kind: kind, op: op})
+		}
+	}
+	if len(ops) != 1 {
+		return nil, errValidation("TransactItems can only contain one of Check, Put, Update or Delete")
+	}
+	t := ops[0]
+	if derr := validateReturnValues("", t.op.ReturnValuesOnConditionCheckFailure, false); derr != nil {
+		return nil, derr
+	}
+
+	ctx, derr := newExprContext(t.op.ExpressionAttributeNames, t.op.ExpressionAttributeValues)
+	if derr != nil {
+		return nil, derr
+	}
+	switch t.kind {
+	case "ConditionCheck":
+		if t.op.ConditionExpression == "" {
+			return nil, errValidation("The ConditionExpression must be specified for a ConditionCheck")
+		}
+	case "Update":
+		if t.op.UpdateExpression == "" {
+			return nil, errValidation("The UpdateExpression must be specified for an Update")
+		}
+		if t.update, derr = ctx.update(t.op.UpdateExpression); derr != nil {
+			return nil, derr
+		}
+	}
+	if t.cond, derr = ctx.condition("ConditionExpression", t.op.ConditionExpression); derr != nil {
+		return nil, derr
+	}
+	if derr := ctx.checkUnused(); derr != nil {
+		return nil, derr
+	}
+	return t, nil
+}
+
+// evaluate checks the entry's condition against the stored item and
+// builds the new image. ok is false for a ConditionCheck, which writes
+// nothing.
+func (t *transactOp) evaluate(td *TableDescription, key, old Item) (item Item, ok bool, reason CancellationReason) {
+	reason = CancellationReason{Code: "None"}
+	if derr := checkCondition(t.cond, old, t.op.ReturnValuesOnConditionCheckFailure); derr != nil {
+		return nil, false, CancellationReason{Code: "ConditionalCheckFailed", Message: derr.Message, Item: derr.Item}
+	}
+	switch t.kind {
+	case "ConditionCheck":
+		return nil, false, reason
+	case "Put":
+		return normalizeItem(t.op.Item), true, reason
+	case "Delete":
+		return nil, true, reason
+	}
+
+	item = copyItem(old)
+	if item == nil {
+		item = copyItem(key)
+	}
+	hash, rng := keyNames(td.KeySchema)
+	if derr := applyUpdate(t.update, item, hash, rng); derr != nil {
+		return nil, false, CancellationReason{Code: "ValidationError", Message: derr.Message}
+	}
+	for _, v := range item {
+		if err := validateValue(v); err != nil {
+			return nil, false, CancellationReason{Code: "ValidationError", Message: err.Error()}
+		}
+	}
+	if itemSize(item) > maxItemSize {
+		return nil, false, CancellationReason{Code: "ValidationError", Message: "Item size to update has exceeded the maximum allowed size"}
+	}
+	return item, true, reason
+}
+
+// TransactWriteItems applies up to 100 writes atomically
+func (h *Handler) TransactWriteItems(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req TransactWriteItemsInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if len(req.TransactItems) == 0 || len(req.TransactItems) > maxTransactItems {
+		writeError(w, errValidation("1 validation error detected: Value at 'transactItems' failed to satisfy constraint: "+
+			"Member must have length less than or equal to 100, Member must have length greater than or equal to 1"))
+		return
+	}
+	if len(req.ClientRequestToken) > 36 {
+		writeError(w, errValidation("1 validation error detected: Value at 'clientRequestToken' failed to satisfy constraint: "+
+			"Member must have length less than or equal to 36"))
+		return
+	}
+
+	ops := make([]*transactOp, len(req.TransactItems))
+	for i, item := range req.TransactItems {
+		t, derr := parseTransactOp(item)
+		if derr != nil {
+			writeError(w, derr)
+			return
+		}
+		ops[i] = t
+	}
+
+	tables := make([]string, len(ops))
+	for i, t := range ops {
+		tables[i] = t.op.TableName
+	}
+	defer h.lockTables(ns, true, tables...)()
+	replayed, recordToken, derr := h.checkClientToken(r.Context(), ns, req.ClientRequestToken, req.TransactItems)
+	if derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	type target struct {
+		td  *TableDescription
+		key Item
+	}
+	targets := make([]target, len(ops))
+	seen := map[string]bool{}
+	for i, t := range ops {
+		td, derr := h.loadTable(r.Context(), ns, t.op.TableName)
+		if derr != nil {
+			writeError(w, derr)
+			return
+		}
+		var key Item
+		if t.kind == "Put" {
+			if derr := validateItem(td, t.op.Item); derr != nil {
+				writeError(w, derr)
+				return
+			}
+			key = primaryKey(td.KeySchema, normalizeItem(t.op.Item))
+		} else {
+			if derr := validateKey(td, t.op.Key); derr != nil {
+				writeError(w, derr)
+				return
+			}
+			key = normalizeItem(t.op.Key)
+		}
+		id := itemID(td, key)
+		if seen[id] {
+			writeError(w, errValidation("Transaction request cannot include multiple operations on one item"))
+			return
+		}
+		seen[id] = true
+		targets[i] = target{td: td, key: key}
+	}
+
+	capacity := capacityTotals{}
+	var writes []pendingWrite
+	reasons := make([]CancellationReason, len(ops))
+	cancelled := false
+	for i, t := range ops {
+		td := targets[i].td
+		old, derr := h.getItem(r.Context(), ns, td, targets[i].key)
+		if derr != nil {
+			writeError(w, derr)
+			return
+		}
+		item, write, reason := t.evaluate(td, targets[i].key, old)
+		reasons[i] = reason
+		if reason.Code != "None" {
+			cancelled = true
+			continue
+		}
+		if !write {
+			capacity.add(consumedCapacity(req.ReturnConsumedCapacity, td.TableName, old, false, true), 2)
+			continue
+		}
+		sized := item
+		if sized == nil {
+			sized = old
+		}
+		capacity.add(consumedCapacity(req.ReturnConsumedCapacity, td.TableName, sized, true, true), 2)
+		writes = append(writes, pendingWrite{td: td, old: old, item: item})
+	}
+
+	if replayed {
+		awsresponses.WriteJSON(w, http.StatusOK, TransactWriteItemsOutput{ConsumedCapacity: capacity.list()})
+		return
+	}
+	if cancelled {
+		writeError(w, errTransactionCanceled(reasons))
+		return
+	}
+	if derr := h.commit(r.Context(), ns, writes, recordToken); derr != nil {
+		writeError(w, derr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, TransactWriteItemsOutput{ConsumedCapacity: capacity.list()})
+}
+
+// TransactGetItems reads up to 100 items as one consistent snapshot
+func (h *Handler) TransactGetItems(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req TransactGetItemsInput
+	if derr := decodeInput(r, &req); derr != nil {
+		writeError(w, derr)
+		return
+	}
+	if len(req.TransactItems) == 0 || len(req.TransactItems) > maxTransactItems {
+		writeError(w, errValidation("1 validation error detected: Value at 'transactItems' failed to satisfy constraint: "+
+			"Member must have length less than or equal to 100, Member must have length greater than or equal to 1"))
+		return
+	}
+
+	projections := make([][]docPath, len(req.TransactItems))
+	for i, item := range req.TransactItems {
+		if item.Get == nil {
+			writeError(w, errValidation("TransactItems can only contain Get"))
+			return
+		}
+		ctx, derr := newExprContext(item.Get.ExpressionAttributeNames, nil)
+		if derr != nil {
+			writeError(w, derr)
+			return
+		}
+		if projections[i], derr = ctx.projection(item.Get.ProjectionExpression); derr != nil {
+			writeError(w, derr)
+			return
+		}
+		if derr := ctx.checkUnused(); derr != nil {
+			writeError(w, derr)
+			return
+		}
+	}
+
+	// Holding the tables' locks gives the reads a single snapshot.
+	tables := make([]string, len(req.TransactItems))
+	for i, item := range req.TransactItems {
+		tables[i] = item.Get.TableName
+	}
+	defer h.lockTables(ns, false, tables...)()
+
+	out := TransactGetItemsOutput{Responses: make([]ItemResponse, len(req.TransactItems))}
+	capacity := capacityTotals{}
+	seen := map[string]bool{}
+	for i, item := range req.TransactItems {
+		td, derr := h.loadTable(r.Context(), ns, item.Get.TableName)
+		if derr != nil {
+			writeError(w, derr)
+			return
+		}
+		if derr := validateKey(td, item.Get.Key); derr != nil {
+			writeError(w, derr)
+			return
+		}
+		key := normalizeItem(item.Get.Key)
+		id := itemID(td, key)
+		if seen[id] {
+			writeError(w, errValidation("Transaction request cannot include multiple operations on one item"))
+			return
+		}
+		seen[id] = true
+
+		found, derr := h.getItem(r.Context(), ns, td, key)
+		if derr != nil {
+			writeError(w, derr)
+			return
+		}
+		out.Responses[i] = ItemResponse{Item: projectPaths(found, projections[i])}
+		capacity.add(consumedCapacity(req.ReturnConsumedCapacity, td.TableName, found, false, true), 2)
+	}
+	out.ConsumedCapacity = capacity.list()
+
+	awsresponses.WriteJSON(w, http.StatusOK, out)
+}
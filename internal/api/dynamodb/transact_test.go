@@ -0,0 +1,198 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"opensnack/internal/api/dynamodb"
+	"opensnack/internal/resource"
+)
+
+// TxStore counts the transactions run on a MemoryStore and can be told to
+// fail the write of one resource ID.
+type TxStore struct {
+	*resource.MemoryStore
+	failID string
+	txs    int
+}
+
+func (s *TxStore) Create(ctx context.Context, r *resource.Resource) error {
+	if r.ID == s.failID {
+		return errors.New("injected failure")
+	}
+	return s.MemoryStore.Create(ctx, r)
+}
+
+func (s *TxStore) Transaction(ctx context.Context, fn func(tx resource.Store) error) error {
+	s.txs++
+	return s.MemoryStore.Transaction(ctx, func(tx resource.Store) error {
+		return fn(failingTx{Store: tx, failID: s.failID})
+	})
+}
+
+// failingTx fails the write of failID inside a transaction.
+type failingTx struct {
+	resource.Store
+	failID string
+}
+
+func (tx failingTx) Create(ctx context.Context, r *resource.Resource) error {
+	if r.ID == tx.failID {
+		return errors.New("injected failure")
+	}
+	return tx.Store.Create(ctx, r)
+}
+
+// transfer moves amount between two accounts, guarded by the balance.
+func transfer(from, to, amount string) string {
+	return `{"TransactItems":[` +
+		`{"Update":{"TableName":"accounts","Key":{"pk":{"S":"` + from + `"}},"UpdateExpression":"SET balance = balance - :a",` +
+		`"ConditionExpression":"balance >= :a","ExpressionAttributeValues":{":a":{"N":"` + amount + `"}},"ReturnValuesOnConditionCheckFailure":"ALL_OLD"}},` +
+		`{"Update":{"TableName":"accounts","Key":{"pk":{"S":"` + to + `"}},"UpdateExpression":"ADD balance :a",` +
+		`"ExpressionAttributeValues":{":a":{"N":"` + amount + `"}}}}]`
+}
+
+func balances(t *testing.T, h *dynamodb.Handler) string {
+	t.Helper()
+	var out dynamodb.TransactGetItemsOutput
+	mustCall(t, h, "TransactGetItems", `{"TransactItems":[`+
+		`{"Get":{"TableName":"accounts","Key":{"pk":{"S":"a"}},"ProjectionExpression":"balance"}},`+
+		`{"Get":{"TableName":"accounts","Key":{"pk":{"S":"b"}},"ProjectionExpression":"balance"}}]}`, &out)
+	var parts []string
+	for _, r := range out.Responses {
+		if r.Item == nil {
+			parts = append(parts, "-")
+			continue
+		}
+		parts = append(parts, *r.Item["balance"].N)
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestTransactWriteItems(t *testing.T) {
+	store := &TxStore{MemoryStore: resource.NewMemoryStore()}
+	h := dynamodb.NewHandler(store)
+	createTable(t, h, "accounts", false)
+	mustCall(t, h, "PutItem", `{"TableName":"accounts","Item":{"pk":{"S":"a"},"balance":{"N":"100"}}}`, nil)
+
+	mustCall(t, h, "TransactWriteItems", transfer("a", "b", "30")+`}`, nil)
+	if got := balances(t, h); got != "70,30" {
+		t.Fatalf("unexpected balances after transfer: %s", got)
+	}
+	if store.txs != 1 {
+		t.Fatalf("expected the write to use a store transaction, got %d", store.txs)
+	}
+
+	// An overdraft cancels both halves and explains why.
+	rec := call(t, h, "TransactWriteItems", transfer("a", "b", "500")+`}`, nil)
+	var cancelled struct {
+		Type    string                        `json:"__type"`
+		Message string                        `json:"message"`
+		Reasons []dynamodb.CancellationReason `json:"CancellationReasons"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &cancelled)
+	if cancelled.Type != "TransactionCanceledException" || len(cancelled.Reasons) != 2 ||
+		cancelled.Reasons[0].Code != "ConditionalCheckFailed" || cancelled.Reasons[1].Code != "None" ||
+		*cancelled.Reasons[0].Item["balance"].N != "70" {
+		t.Fatalf("unexpected cancellation: %s", rec.Body.String())
+	}
+	if !strings.HasSuffix(cancelled.Message, "[ConditionalCheckFailed, None]") {
+		t.Fatalf("unexpected message: %s", cancelled.Message)
+	}
+	if got := balances(t, h); got != "70,30" {
+		t.Fatalf("cancelled transaction changed balances: %s", got)
+	}
+
+	// A failing store write rolls back the writes before it.
+	store.failID = "accounts/S:c"
+	rec = call(t, h, "TransactWriteItems", `{"TransactItems":[`+
+		`{"Put":{"TableName":"accounts","Item":{"pk":{"S":"b"},"balance":{"N":"0"}}}},`+
+		`{"Put":{"TableName":"accounts","Item":{"pk":{"S":"c"},"balance":{"N":"0"}}}}]}`, nil)
+	if rec.Code != 500 {
+		t.Fatalf("expected store failure, got %d %s", rec.Code, rec.Body.String())
+	}
+	if got := balances(t, h); got != "70,30" {
+		t.Fatalf("failed transaction was not rolled back: %s", got)
+	}
+}
+
+func TestTransactWriteItems_ClientRequestToken(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "accounts", false)
+	mustCall(t, h, "PutItem", `{"TableName":"accounts","Item":{"pk":{"S":"a"},"balance":{"N":"100"}}}`, nil)
+
+	req := transfer("a", "b", "10") + `,"ClientRequestToken":"tok-1"}`
+	mustCall(t, h, "TransactWriteItems", req, nil)
+	mustCall(t, h, "TransactWriteItems", req, nil)
+	if got := balances(t, h); got != "90,10" {
+		t.Fatalf("retried request was applied twice: %s", got)
+	}
+
+	expectError(t, h, "TransactWriteItems", transfer("a", "b", "20")+`,"ClientRequestToken":"tok-1"}`,
+		"IdempotentParameterMismatchException")
+}
+
+func TestTransactWriteItems_ExpiredClientRequestToken(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := dynamodb.NewHandler(store)
+	createTable(t, h, "accounts", false)
+	mustCall(t, h, "PutItem", `{"TableName":"accounts","Item":{"pk":{"S":"a"},"balance":{"N":"100"}}}`, nil)
+
+	// A token remembered from another request, ten minutes ago.
+	err := store.Create(context.Background(), &resource.Resource{
+		ID: "client-token/tok-1", Namespace: "default", Service: "dynamodb", Type: "client-token",
+		Attributes: []byte(`{"hash":"other","expires_at":1}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustCall(t, h, "TransactWriteItems", transfer("a", "b", "10")+`,"ClientRequestToken":"tok-1"}`, nil)
+	if got := balances(t, h); got != "90,10" {
+		t.Fatalf("expected the expired token to be reusable: %s", got)
+	}
+	expectError(t, h, "TransactWriteItems", transfer("a", "b", "20")+`,"ClientRequestToken":"tok-1"}`,
+		"IdempotentParameterMismatchException")
+}
+
+func TestTransactWriteItems_Validation(t *testing.T) {
+	h := dynamodb.NewHandler(resource.NewMemoryStore())
+	createTable(t, h, "accounts", false)
+	mustCall(t, h, "PutItem", `{"TableName":"accounts","Item":{"pk":{"S":"a"},"balance":{"N":"1"}}}`, nil)
+
+	cases := []struct {
+		body, want string
+	}{
+		{`{"TransactItems":[]}`, "transactItems"},
+		{`{"TransactItems":[{"Put":{"TableName":"accounts","Item":{"pk":{"S":"a"}}},"Delete":{"TableName":"accounts","Key":{"pk":{"S":"a"}}}}]}`,
+			"can only contain one of"},
+		{`{"TransactItems":[{"Put":{"TableName":"accounts","Item":{"pk":{"S":"a"}}}},{"Delete":{"TableName":"accounts","Key":{"pk":{"S":"a"}}}}]}`,
+			"multiple operations on one item"},
+		{`{"TransactItems":[{"ConditionCheck":{"TableName":"accounts","Key":{"pk":{"S":"a"}}}}]}`, "ConditionExpression must be specified"},
+		{`{"TransactItems":[{"Update":{"TableName":"accounts","Key":{"pk":{"S":"a"}},"UpdateExpression":"SET x = :v"}}]}`,
+			"attribute value used in expression is not defined"},
+	}
+	for _, c := range cases {
+		if msg := expectError(t, h, "TransactWriteItems", c.body, "ValidationException"); !strings.Contains(msg, c.want) {
+			t.Fatalf("%s: expected %q, got %q", c.body, c.want, msg)
+		}
+	}
+
+	// ConditionCheck guards a write on another item without changing it.
+	rec := call(t, h, "TransactWriteItems", `{"TransactItems":[`+
+		`{"ConditionCheck":{"TableName":"accounts","Key":{"pk":{"S":"a"}},"ConditionExpression":"balance > :z","ExpressionAttributeValues":{":z":{"N":"5"}}}},`+
+		`{"Put":{"TableName":"accounts","Item":{"pk":{"S":"b"},"balance":{"N":"1"}}}}]}`, nil)
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "TransactionCanceledException") {
+		t.Fatalf("expected cancellation, got %d %s", rec.Code, rec.Body.String())
+	}
+	if got := balances(t, h); got != "1,-" {
+		t.Fatalf("unexpected balances: %s", got)
+	}
+}
@@ -0,0 +1,155 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"opensnack/internal/resource"
+
+	"go.uber.org/zap"
+)
+
+//
+// TIME TO LIVE
+//
+// The TTL reaper periodically deletes the items whose TTL attribute holds
+// an epoch-seconds number in the past, table by table in every namespace
+// the handler knows of. Like DynamoDB it ignores values more than five
+// years old, and each deletion is recorded on the table's stream as a
+// REMOVE made by the DynamoDB service principal. The same sweep drops
+// stream records older than the 24 hour retention period.
+//
+
+const ttlMaxAge = 5 * 365 * 24 * time.Hour
+
+// ttlIdentity is the userIdentity of records for TTL deletions.
+var ttlIdentity = &Identity{PrincipalId: "dynamodb.amazonaws.com", Type: "Service"}
+
+// trackNamespace remembers a namespace that has made DynamoDB requests.
+func (h *Handler) trackNamespace(ns string) {
+	h.nsMu.Lock()
+	defer h.nsMu.Unlock()
+	if h.namespaces == nil {
+		h.namespaces = map[string]bool{}
+	}
+	h.namespaces[ns] = true
+}
+
+// knownNamespaces returns the namespaces that may hold tables: the ones
+// seen by this handler plus, when the store can list them, every
+// namespace with a stored table.
+func (h *Handler) knownNamespaces(ctx context.Context) []string {
+	set := map[string]bool{}
+	h.nsMu.Lock()
+	for ns := range h.namespaces {
+		set[ns] = true
+	}
+	h.nsMu.Unlock()
+
+	if lister, ok := h.Store.(resource.NamespaceLister); ok {
+		stored, err := lister.Namespaces(ctx, "dynamodb", "table")
+		if err != nil {
+			zap.S().Warnf("ttl: listing namespaces failed: %v", err)
+		}
+		for _, ns := range stored {
+			set[ns] = true
+		}
+	}
+
+	out := make([]string, 0, len(set))
+	for ns := range set {
+		out = append(out, ns)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// RunTTLReaper sweeps expired items every interval until ctx is done.
+func (h *Handler) RunTTLReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if n := h.SweepExpiredItems(ctx, now); n > 0 {
+				zap.S().Debugf("ttl: deleted %d expired items", n)
+			}
+		}
+	}
+}
+
+// SweepExpiredItems deletes every item whose TTL had passed at now and
+// returns how many it deleted.
+func (h *Handler) SweepExpiredItems(ctx context.Context, now time.Time) int {
+	deleted := 0
+	for _, ns := range h.knownNamespaces(ctx) {
+		h.trimStreamRecords(ctx, ns, now)
+		tables, err := h.Store.List(ctx, "dynamodb", "table", ns)
+		if err != nil {
+			continue
+		}
+		for _, table := range tables {
+			var stored struct {
+				TableDescription TableDescription `json:"table_description"`
+				TTL              *struct {
+					Enabled       bool   `json:"enabled"`
+					AttributeName string `json:"attribute_name"`
+				} `json:"ttl_specification"`
+			}
+			if json.Unmarshal(table.Attributes, &stored) != nil || stored.TTL == nil ||
+				!stored.TTL.Enabled || stored.TTL.AttributeName == "" {
+				continue
+			}
+			td := &stored.TableDescription
+			if td.TableName == "" {
+				td.TableName = table.ID
+			}
+			deleted += h.sweepTable(ctx, ns, td, stored.TTL.AttributeName, now)
+		}
+	}
+	return deleted
+}
+
+// sweepTable deletes the expired items of one table.
+func (h *Handler) sweepTable(ctx context.Context, ns string, td *TableDescription, attr string, now time.Time) int {
+	defer h.lockTables(ns, true, td.TableName)()
+
+	items, derr := h.tableItems(ctx, ns, td.TableName)
+	if derr != nil {
+		return 0
+	}
+	deleted := 0
+	for _, item := range items {
+		if !ttlExpired(item[attr], now) {
+			continue
+		}
+		if derr := h.writeItemAs(ctx, h.Store, ns, td, item, nil, ttlIdentity); derr != nil {
+			zap.S().Warnf("ttl: deleting item from %s failed: %s", td.TableName, derr.Message)
+			continue
+		}
+		deleted++
+	}
+	return deleted
+}
+
+// ttlExpired reports whether a TTL attribute value is in the past. Only
+// numbers count, and values more than five years old are ignored.
+func ttlExpired(v AttributeValue, now time.Time) bool {
+	if v.N == nil {
+		return false
+	}
+	secs, err := strconv.ParseFloat(*v.N, 64)
+	if err != nil {
+		return false
+	}
+	return secs < float64(now.Unix()) && secs >= float64(now.Add(-ttlMaxAge).Unix())
+}
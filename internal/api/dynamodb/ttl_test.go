@@ -0,0 +1,91 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package dynamodb_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"opensnack/internal/api/dynamodb"
+	"opensnack/internal/resource"
+)
+
+// callNS is call for a request made from another namespace.
+func callNS(t *testing.T, h *dynamodb.Handler, ns, op, body string) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("X-Amz-Target", "DynamoDB_20120810."+op)
+	req.Header.Set("User-Agent", "opensnack-test custom-"+ns)
+	rec := httptest.NewRecorder()
+	h.Dispatch(rec, req)
+	if rec.Code != 200 {
+		t.Fatalf("%s in %s failed: %d %s", op, ns, rec.Code, rec.Body.String())
+	}
+}
+
+func TestSweepExpiredItems(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := dynamodb.NewHandler(store)
+	mustCall(t, h, "CreateTable", `{"TableName":"sessions","BillingMode":"PAY_PER_REQUEST",`+
+		`"AttributeDefinitions":[{"AttributeName":"pk","AttributeType":"S"}],"KeySchema":[{"AttributeName":"pk","KeyType":"HASH"}],`+
+		`"StreamSpecification":{"StreamEnabled":true,"StreamViewType":"NEW_AND_OLD_IMAGES"}}`, nil)
+	mustCall(t, h, "UpdateTimeToLive", `{"TableName":"sessions","TimeToLiveSpecification":{"Enabled":true,"AttributeName":"expires"}}`, nil)
+
+	now := time.Now()
+	epoch := func(d time.Duration) string { return strconv.FormatInt(now.Add(d).Unix(), 10) }
+	items := map[string]string{
+		"expired": `{"N":"` + epoch(-time.Minute) + `"}`,
+		"future":  `{"N":"` + epoch(time.Hour) + `"}`,
+		"ancient": `{"N":"` + epoch(-6*365*24*time.Hour) + `"}`,
+		"string":  `{"S":"` + epoch(-time.Minute) + `"}`,
+	}
+	for pk, ttl := range items {
+		mustCall(t, h, "PutItem", `{"TableName":"sessions","Item":{"pk":{"S":"`+pk+`"},"expires":`+ttl+`}}`, nil)
+	}
+
+	// The same table in another namespace has no TTL configured.
+	callNS(t, h, "ns2", "CreateTable", `{"TableName":"sessions","BillingMode":"PAY_PER_REQUEST",`+
+		`"AttributeDefinitions":[{"AttributeName":"pk","AttributeType":"S"}],"KeySchema":[{"AttributeName":"pk","KeyType":"HASH"}]}`)
+	callNS(t, h, "ns2", "PutItem", `{"TableName":"sessions","Item":{"pk":{"S":"expired"},"expires":`+items["expired"]+`}}`)
+
+	if n := h.SweepExpiredItems(t.Context(), now); n != 1 {
+		t.Fatalf("expected 1 expired item, deleted %d", n)
+	}
+	var scan dynamodb.ScanOutput
+	mustCall(t, h, "Scan", `{"TableName":"sessions"}`, &scan)
+	if scan.Count != 3 {
+		t.Fatalf("expected 3 remaining items, got %d", scan.Count)
+	}
+	if _, err := store.Get(t.Context(), "sessions/S:expired", "dynamodb", "item", "ns2"); err != nil {
+		t.Fatalf("item in another namespace was deleted: %v", err)
+	}
+
+	// The deletion is on the stream, attributed to the TTL service.
+	var removes []dynamodb.Record
+	records, _ := store.List(t.Context(), "dynamodb", "stream-record", "ns1")
+	for _, res := range records {
+		var stored struct {
+			Record dynamodb.Record `json:"record"`
+		}
+		json.Unmarshal(res.Attributes, &stored)
+		if stored.Record.EventName == "REMOVE" {
+			removes = append(removes, stored.Record)
+		}
+	}
+	if len(removes) != 1 {
+		t.Fatalf("expected one REMOVE record, got %d", len(removes))
+	}
+	rec := removes[0]
+	if rec.UserIdentity == nil || rec.UserIdentity.Type != "Service" || rec.UserIdentity.PrincipalId != "dynamodb.amazonaws.com" {
+		t.Fatalf("unexpected userIdentity: %+v", rec.UserIdentity)
+	}
+	if *rec.Dynamodb.Keys["pk"].S != "expired" || rec.Dynamodb.OldImage == nil || rec.Dynamodb.NewImage != nil {
+		t.Fatalf("unexpected record: %+v", rec.Dynamodb)
+	}
+}
@@ -55,6 +55,7 @@ type DescribeInstancesResponse struct {
 	XMLName      xml.Name      `xml:"http://ec2.amazonaws.com/doc/2016-11-15/ DescribeInstancesResponse"`
 	RequestId    string        `xml:"requestId"`
 	Reservations []Reservation `xml:"reservationSet>item"`
+	NextToken    string        `xml:"nextToken,omitempty"`
 }
 
 type Reservation struct {
@@ -302,6 +303,7 @@ type DescribeVolumesResponse struct {
 	XMLName   xml.Name `xml:"http://ec2.amazonaws.com/doc/2016-11-15/ DescribeVolumesResponse"`
 	RequestId string   `xml:"requestId"`
 	Volumes   []Volume `xml:"volumeSet>item"`
+	NextToken string   `xml:"nextToken,omitempty"`
 }
 
 type Volume struct {
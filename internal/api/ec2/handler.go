@@ -5,12 +5,15 @@
 package ec2
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"opensnack/internal/awsarn"
 	"opensnack/internal/awsresponses"
 	"opensnack/internal/resource"
 	"opensnack/internal/util"
@@ -20,8 +23,6 @@ import (
 
 const (
 	APIVersion      = "2016-11-15"
-	ec2Region       = "us-east-1"
-	ec2Account      = "000000000000"
 	defaultVpcId    = "vpc-00000000"
 	defaultSubnetId = "subnet-00000000"
 )
@@ -38,7 +39,7 @@ func NewHandler(store resource.Store) *Handler {
 
 // ensureInstanceFields ensures all required fields are populated for Terraform compatibility
 // This is critical - Terraform blindly indexes [0] on these slices without checking length
-func ensureInstanceFields(instance Instance, privateIp string, privateDns string, now time.Time) Instance {
+func ensureInstanceFields(instance Instance, privateIp string, privateDns string, now time.Time, ownerId string) Instance {
 	// Ensure root device fields (required by Terraform)
 	if instance.RootDeviceType == "" {
 		instance.RootDeviceType = "ebs"
@@ -102,7 +103,7 @@ func ensureInstanceFields(instance Instance, privateIp string, privateDns string
 					NetworkInterfaceId: "eni-00000000",
 					SubnetId:           instance.SubnetId,
 					VpcId:              instance.VpcId,
-					OwnerId:            ec2Account,
+					OwnerId:            ownerId,
 					Status:             "in-use",
 					MacAddress:         "02:00:00:00:00:00",
 					PrivateIpAddress:   privateIp,
@@ -274,7 +275,7 @@ func (h *Handler) RunInstances(w http.ResponseWriter, r *http.Request) {
 		availabilityZone = r.URL.Query().Get("Placement.AvailabilityZone")
 	}
 	if availabilityZone == "" {
-		availabilityZone = "us-east-1a"
+		availabilityZone = awsarn.FromContext(r.Context()).AvailabilityZone()
 	}
 
 	now := time.Now().UTC()
@@ -327,7 +328,7 @@ func (h *Handler) RunInstances(w http.ResponseWriter, r *http.Request) {
 						NetworkInterfaceId: "eni-00000000",
 						SubnetId:           defaultSubnetId,
 						VpcId:              defaultVpcId,
-						OwnerId:            ec2Account,
+						OwnerId:            awsarn.FromContext(r.Context()).AccountID,
 						Status:             "in-use",
 						MacAddress:         "02:00:00:00:00:00",
 						PrivateIpAddress:   privateIp,
@@ -391,13 +392,13 @@ func (h *Handler) RunInstances(w http.ResponseWriter, r *http.Request) {
 			Attributes: buf,
 		}
 
-		h.Store.Create(res)
+		h.Store.Create(r.Context(), res)
 	}
 
 	resp := RunInstancesResponse{
 		RequestId:     awsresponses.NextRequestID(),
 		ReservationId: reservationId,
-		OwnerId:       ec2Account,
+		OwnerId:       awsarn.FromContext(r.Context()).AccountID,
 		GroupSet: GroupSet{
 			Items: []SecurityGroup{
 				{
@@ -428,33 +429,17 @@ func (h *Handler) DescribeInstances(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var instancesWithRes []instanceWithReservation
+	var nextToken string
 
 	if len(instanceIds) > 0 {
 		// Describe specific instances
 		for _, instanceId := range instanceIds {
-			res, err := h.Store.Get(instanceId, "ec2", "instance", ns)
+			// Persist normalized values back to storage to prevent drift
+			instance, entry, err := h.mutateInstance(r.Context(), ns, instanceId, nil)
 			if err != nil {
 				continue
 			}
 
-			var entry map[string]any
-			if err := json.Unmarshal(res.Attributes, &entry); err != nil {
-				continue
-			}
-
-			instanceBytes, _ := json.Marshal(entry["instance"])
-			var instance Instance
-			json.Unmarshal(instanceBytes, &instance)
-
-			// Ensure all required fields are populated
-			instance = ensureInstanceFields(instance, instance.PrivateIpAddress, instance.PrivateDnsName, time.Now().UTC())
-
-			// Persist normalized values back to storage to prevent drift
-			entry["instance"] = instance
-			buf, _ := json.Marshal(entry)
-			res.Attributes = buf
-			h.Store.Update(res)
-
 			reservationId, _ := entry["reservation_id"].(string)
 			if reservationId == "" {
 				// Fallback: generate one (shouldn't happen if RunInstances stored it)
@@ -467,39 +452,29 @@ func (h *Handler) DescribeInstances(w http.ResponseWriter, r *http.Request) {
 			})
 		}
 	} else {
-		// List all instances
-		allInstances, err := h.Store.List("ec2", "instance", ns)
-		if err == nil {
-			for _, instRes := range allInstances {
-				var entry map[string]any
-				if err := json.Unmarshal(instRes.Attributes, &entry); err != nil {
-					continue
-				}
-
-				instanceBytes, _ := json.Marshal(entry["instance"])
-				var instance Instance
-				json.Unmarshal(instanceBytes, &instance)
-
-				// Ensure all required fields are populated
-				instance = ensureInstanceFields(instance, instance.PrivateIpAddress, instance.PrivateDnsName, time.Now().UTC())
-
-				// Persist normalized values back to storage to prevent drift
-				entry["instance"] = instance
-				buf, _ := json.Marshal(entry)
-				instRes.Attributes = buf
-				h.Store.Update(&instRes)
-
-				reservationId, _ := entry["reservation_id"].(string)
-				if reservationId == "" {
-					// Fallback: generate one (shouldn't happen if RunInstances stored it)
-					reservationId = "r-" + strings.ReplaceAll(uuid.New().String(), "-", "")[:17]
-				}
+		// List all instances, a page at a time
+		page, ok := h.describePage(w, r, resource.Query{Service: "ec2", Type: "instance", Namespace: ns})
+		if !ok {
+			return
+		}
+		nextToken = page.Next
+		for _, instRes := range page.Resources {
+			// Persist normalized values back to storage to prevent drift
+			instance, entry, err := h.mutateInstance(r.Context(), ns, instRes.ID, nil)
+			if err != nil {
+				continue
+			}
 
-				instancesWithRes = append(instancesWithRes, instanceWithReservation{
-					instance:      instance,
-					reservationId: reservationId,
-				})
+			reservationId, _ := entry["reservation_id"].(string)
+			if reservationId == "" {
+				// Fallback: generate one (shouldn't happen if RunInstances stored it)
+				reservationId = "r-" + strings.ReplaceAll(uuid.New().String(), "-", "")[:17]
 			}
+
+			instancesWithRes = append(instancesWithRes, instanceWithReservation{
+				instance:      instance,
+				reservationId: reservationId,
+			})
 		}
 	}
 
@@ -514,7 +489,7 @@ func (h *Handler) DescribeInstances(w http.ResponseWriter, r *http.Request) {
 	reservations := make([]Reservation, 0, len(reservationMap))
 	for reservationId, instList := range reservationMap {
 		// Get ownerId and groupSet from first instance (they should be consistent)
-		var ownerId string = ec2Account
+		var ownerId string = awsarn.FromContext(r.Context()).AccountID
 		var groupSet GroupSet
 		if len(instList) > 0 {
 			// Use security groups from the first instance
@@ -555,6 +530,7 @@ func (h *Handler) DescribeInstances(w http.ResponseWriter, r *http.Request) {
 	resp := DescribeInstancesResponse{
 		RequestId:    awsresponses.NextRequestID(),
 		Reservations: reservations,
+		NextToken:    nextToken,
 	}
 
 	awsresponses.WriteXML(w, resp)
@@ -573,34 +549,20 @@ func (h *Handler) TerminateInstances(w http.ResponseWriter, r *http.Request) {
 	changes := make([]InstanceStateChange, 0, len(instanceIds))
 
 	for _, instanceId := range instanceIds {
-		res, err := h.Store.Get(instanceId, "ec2", "instance", ns)
+		var previousState InstanceState
+		instance, _, err := h.mutateInstance(r.Context(), ns, instanceId, func(instance *Instance) {
+			previousState = instance.InstanceState
+
+			// Update instance state to terminated
+			instance.InstanceState = InstanceState{
+				Code: 48, // terminated
+				Name: "terminated",
+			}
+		})
 		if err != nil {
 			continue
 		}
 
-		var entry map[string]any
-		json.Unmarshal(res.Attributes, &entry)
-
-		instanceBytes, _ := json.Marshal(entry["instance"])
-		var instance Instance
-		json.Unmarshal(instanceBytes, &instance)
-
-		// Ensure all required fields are populated before updating
-		instance = ensureInstanceFields(instance, instance.PrivateIpAddress, instance.PrivateDnsName, time.Now().UTC())
-
-		previousState := instance.InstanceState
-
-		// Update instance state to terminated
-		instance.InstanceState = InstanceState{
-			Code: 48, // terminated
-			Name: "terminated",
-		}
-
-		entry["instance"] = instance
-		buf, _ := json.Marshal(entry)
-		res.Attributes = buf
-		h.Store.Update(res)
-
 		changes = append(changes, InstanceStateChange{
 			InstanceId:    instanceId,
 			CurrentState:  instance.InstanceState,
@@ -649,7 +611,7 @@ func (h *Handler) CreateVolume(w http.ResponseWriter, r *http.Request) {
 		availabilityZone = r.URL.Query().Get("AvailabilityZone")
 	}
 	if availabilityZone == "" {
-		availabilityZone = "us-east-1a"
+		availabilityZone = awsarn.FromContext(r.Context()).AvailabilityZone()
 	}
 
 	volumeId := "vol-" + strings.ReplaceAll(uuid.New().String(), "-", "")[:17]
@@ -679,7 +641,7 @@ func (h *Handler) CreateVolume(w http.ResponseWriter, r *http.Request) {
 		Attributes: buf,
 	}
 
-	if err := h.Store.Create(res); err != nil {
+	if err := h.Store.Create(r.Context(), res); err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusInternalServerError, "InternalFailure", "Failed to create volume", volumeId)
 		return
 	}
@@ -735,11 +697,12 @@ func (h *Handler) DescribeVolumes(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var volumes []Volume
+	var nextToken string
 
 	if len(filteredVolumeIds) > 0 {
 		// Describe specific volumes
 		for _, volumeId := range filteredVolumeIds {
-			res, err := h.Store.Get(volumeId, "ec2", "volume", ns)
+			res, err := h.Store.Get(r.Context(), volumeId, "ec2", "volume", ns)
 			if err != nil {
 				continue
 			}
@@ -758,7 +721,7 @@ func (h *Handler) DescribeVolumes(w http.ResponseWriter, r *http.Request) {
 			volume.Attachments = nil
 
 			// Load attachments - only add if there are actual attachments
-			attachments, _ := h.Store.List("ec2", "volume_attachment", ns)
+			attachments := h.volumeAttachments(r.Context(), ns, volumeId)
 			for _, attRes := range attachments {
 				var attEntry map[string]any
 				if err := json.Unmarshal(attRes.Attributes, &attEntry); err != nil {
@@ -783,58 +746,129 @@ func (h *Handler) DescribeVolumes(w http.ResponseWriter, r *http.Request) {
 			volumes = append(volumes, volume)
 		}
 	} else {
-		// List all volumes
-		allVolumes, err := h.Store.List("ec2", "volume", ns)
-		if err == nil {
-			for _, volRes := range allVolumes {
-				var entry map[string]any
-				if err := json.Unmarshal(volRes.Attributes, &entry); err != nil {
-					continue
-				}
+		// List all volumes, a page at a time
+		page, ok := h.describePage(w, r, resource.Query{Service: "ec2", Type: "volume", Namespace: ns})
+		if !ok {
+			return
+		}
+		nextToken = page.Next
+		for _, volRes := range page.Resources {
+			var entry map[string]any
+			if err := json.Unmarshal(volRes.Attributes, &entry); err != nil {
+				continue
+			}
 
-				volumeBytes, _ := json.Marshal(entry["volume"])
-				var volume Volume
-				json.Unmarshal(volumeBytes, &volume)
+			volumeBytes, _ := json.Marshal(entry["volume"])
+			var volume Volume
+			json.Unmarshal(volumeBytes, &volume)
 
-				// CRITICAL: Ensure Attachments is nil (not empty slice) when no attachments
-				volume.Attachments = nil
+			// CRITICAL: Ensure Attachments is nil (not empty slice) when no attachments
+			volume.Attachments = nil
 
-				// Load attachments - only add if there are actual attachments
-				attachments, _ := h.Store.List("ec2", "volume_attachment", ns)
-				for _, attRes := range attachments {
-					var attEntry map[string]any
-					if err := json.Unmarshal(attRes.Attributes, &attEntry); err != nil {
-						continue
-					}
+			// Load attachments - only add if there are actual attachments
+			attachments := h.volumeAttachments(r.Context(), ns, volume.VolumeId)
+			for _, attRes := range attachments {
+				var attEntry map[string]any
+				if err := json.Unmarshal(attRes.Attributes, &attEntry); err != nil {
+					continue
+				}
+
+				if attEntry["volume_id"].(string) == volume.VolumeId {
+					attBytes, _ := json.Marshal(attEntry["attachment"])
+					var attachment VolumeAttachment
+					json.Unmarshal(attBytes, &attachment)
 
-					if attEntry["volume_id"].(string) == volume.VolumeId {
-						attBytes, _ := json.Marshal(attEntry["attachment"])
-						var attachment VolumeAttachment
-						json.Unmarshal(attBytes, &attachment)
-
-						// Only include attached attachments (not detached)
-						if attachment.State == "attached" {
-							if volume.Attachments == nil {
-								volume.Attachments = make([]VolumeAttachment, 0)
-							}
-							volume.Attachments = append(volume.Attachments, attachment)
+					// Only include attached attachments (not detached)
+					if attachment.State == "attached" {
+						if volume.Attachments == nil {
+							volume.Attachments = make([]VolumeAttachment, 0)
 						}
+						volume.Attachments = append(volume.Attachments, attachment)
 					}
 				}
-
-				volumes = append(volumes, volume)
 			}
+
+			volumes = append(volumes, volume)
 		}
 	}
 
 	resp := DescribeVolumesResponse{
 		RequestId: awsresponses.NextRequestID(),
 		Volumes:   volumes,
+		NextToken: nextToken,
 	}
 
 	awsresponses.WriteXML(w, resp)
 }
 
+// mutateInstance applies fn, which may be nil, to a stored instance and
+// saves it. The instance's required fields are filled in first, so every
+// caller also persists the normalized values. It returns the saved
+// instance and the stored entry around it.
+func (h *Handler) mutateInstance(ctx context.Context, ns, instanceId string, fn func(instance *Instance)) (Instance, map[string]any, error) {
+	var instance Instance
+	var entry map[string]any
+	_, err := h.Store.Mutate(ctx, instanceId, "ec2", "instance", ns, func(res *resource.Resource) error {
+		entry = nil
+		if err := json.Unmarshal(res.Attributes, &entry); err != nil {
+			return err
+		}
+
+		instanceBytes, _ := json.Marshal(entry["instance"])
+		instance = Instance{}
+		json.Unmarshal(instanceBytes, &instance)
+
+		// Ensure all required fields are populated
+		instance = ensureInstanceFields(instance, instance.PrivateIpAddress, instance.PrivateDnsName, time.Now().UTC(), awsarn.FromContext(ctx).AccountID)
+		if fn != nil {
+			fn(&instance)
+		}
+
+		entry["instance"] = instance
+		res.Attributes, _ = json.Marshal(entry)
+		return nil
+	})
+	return instance, entry, err
+}
+
+// volumeAttachments returns the attachment records of a volume.
+func (h *Handler) volumeAttachments(ctx context.Context, ns, volumeId string) []resource.Resource {
+	page, _ := h.Store.Query(ctx, resource.Query{
+		Service:   "ec2",
+		Type:      "volume_attachment",
+		Namespace: ns,
+		Match:     map[string]any{"volume_id": volumeId},
+	})
+	return page.Resources
+}
+
+// describePage runs one page of a Describe* call that lists everything.
+// MaxResults must be between 5 and 1000; NextToken is the store cursor.
+func (h *Handler) describePage(w http.ResponseWriter, r *http.Request, q resource.Query) (resource.Page, bool) {
+	if raw := r.FormValue("MaxResults"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 5 || n > 1000 {
+			awsresponses.WriteErrorXML(w, http.StatusBadRequest, "InvalidParameterValue",
+				"MaxResults must be between 5 and 1000", "")
+			return resource.Page{}, false
+		}
+		q.Limit = n
+	}
+	q.Cursor = r.FormValue("NextToken")
+
+	page, err := h.Store.Query(r.Context(), q)
+	if errors.Is(err, resource.ErrInvalidCursor) {
+		awsresponses.WriteErrorXML(w, http.StatusBadRequest, "InvalidPaginationToken",
+			"The specified pagination token is not valid", "")
+		return resource.Page{}, false
+	}
+	if err != nil {
+		awsresponses.WriteErrorXML(w, http.StatusInternalServerError, "InternalError", err.Error(), "")
+		return resource.Page{}, false
+	}
+	return page, true
+}
+
 // DeleteVolume deletes an EBS volume
 func (h *Handler) DeleteVolume(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
@@ -851,7 +885,7 @@ func (h *Handler) DeleteVolume(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if volume is attached
-	attachments, _ := h.Store.List("ec2", "volume_attachment", ns)
+	attachments := h.volumeAttachments(r.Context(), ns, volumeId)
 	for _, attRes := range attachments {
 		var attEntry map[string]any
 		if err := json.Unmarshal(attRes.Attributes, &attEntry); err != nil {
@@ -869,7 +903,7 @@ func (h *Handler) DeleteVolume(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	h.Store.Delete(volumeId, "ec2", "volume", ns)
+	h.Store.Delete(r.Context(), volumeId, "ec2", "volume", ns)
 
 	resp := DeleteVolumeResponse{
 		ResponseMetadata: ResponseMetadata{
@@ -906,14 +940,14 @@ func (h *Handler) AttachVolume(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify volume exists
-	_, err := h.Store.Get(volumeId, "ec2", "volume", ns)
+	_, err := h.Store.Get(r.Context(), volumeId, "ec2", "volume", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusNotFound, "InvalidVolume.NotFound", "Volume not found", volumeId)
 		return
 	}
 
 	// Verify instance exists
-	_, err = h.Store.Get(instanceId, "ec2", "instance", ns)
+	_, err = h.Store.Get(r.Context(), instanceId, "ec2", "instance", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusNotFound, "InvalidInstanceID.NotFound", "Instance not found", instanceId)
 		return
@@ -947,7 +981,7 @@ func (h *Handler) AttachVolume(w http.ResponseWriter, r *http.Request) {
 		Attributes: buf,
 	}
 
-	if err := h.Store.Create(res); err != nil {
+	if err := h.Store.Create(r.Context(), res); err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusInternalServerError, "InternalFailure", "Failed to attach volume", volumeId)
 		return
 	}
@@ -990,7 +1024,7 @@ func (h *Handler) DetachVolume(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Find attachment
-	attachments, _ := h.Store.List("ec2", "volume_attachment", ns)
+	attachments := h.volumeAttachments(r.Context(), ns, volumeId)
 	var attachmentRes *resource.Resource
 	var attachment VolumeAttachment
 
@@ -1028,12 +1062,15 @@ func (h *Handler) DetachVolume(w http.ResponseWriter, r *http.Request) {
 	// Update attachment state
 	attachment.State = "detached"
 
-	var attEntry map[string]any
-	json.Unmarshal(attachmentRes.Attributes, &attEntry)
-	attEntry["attachment"] = attachment
-	buf, _ := json.Marshal(attEntry)
-	attachmentRes.Attributes = buf
-	h.Store.Update(attachmentRes)
+	h.Store.Mutate(r.Context(), attachmentRes.ID, "ec2", "volume_attachment", ns, func(res *resource.Resource) error {
+		var attEntry map[string]any
+		if err := json.Unmarshal(res.Attributes, &attEntry); err != nil {
+			return err
+		}
+		attEntry["attachment"] = attachment
+		res.Attributes, _ = json.Marshal(attEntry)
+		return nil
+	})
 
 	resp := DetachVolumeResponse{
 		DetachVolumeResult: DetachVolumeResult{
@@ -1232,7 +1269,7 @@ func (h *Handler) DescribeVpcs(w http.ResponseWriter, r *http.Request) {
 		for _, vpcId := range filteredVpcIds {
 			vpcs = append(vpcs, Vpc{
 				VpcId:           vpcId,
-				OwnerId:         ec2Account,
+				OwnerId:         awsarn.FromContext(r.Context()).AccountID,
 				CidrBlock:       "10.0.0.0/16",
 				InstanceTenancy: "default",
 				IsDefault:       vpcId == defaultVpcId,
@@ -1243,7 +1280,7 @@ func (h *Handler) DescribeVpcs(w http.ResponseWriter, r *http.Request) {
 		// Return default VPC if no specific VPCs requested
 		vpcs = append(vpcs, Vpc{
 			VpcId:           defaultVpcId,
-			OwnerId:         ec2Account,
+			OwnerId:         awsarn.FromContext(r.Context()).AccountID,
 			CidrBlock:       "10.0.0.0/16",
 			InstanceTenancy: "default",
 			IsDefault:       true,
@@ -1280,7 +1317,7 @@ func (h *Handler) DescribeInstanceAttribute(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Verify instance exists
-	_, err := h.Store.Get(instanceId, "ec2", "instance", ns)
+	_, err := h.Store.Get(r.Context(), instanceId, "ec2", "instance", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusBadRequest, "InvalidInstanceID.NotFound", "The instance ID '"+instanceId+"' does not exist", instanceId)
 		return
@@ -1329,25 +1366,11 @@ func (h *Handler) ModifyInstanceAttribute(w http.ResponseWriter, r *http.Request
 	}
 
 	// Verify instance exists
-	res, err := h.Store.Get(instanceId, "ec2", "instance", ns)
-	if err != nil {
+	if _, err := h.Store.Get(r.Context(), instanceId, "ec2", "instance", ns); err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusBadRequest, "InvalidInstanceID.NotFound", "The instance ID '"+instanceId+"' does not exist", instanceId)
 		return
 	}
 
-	var entry map[string]any
-	if err := json.Unmarshal(res.Attributes, &entry); err != nil {
-		awsresponses.WriteErrorXML(w, http.StatusInternalServerError, "InternalFailure", "Failed to decode instance metadata", "")
-		return
-	}
-
-	instanceBytes, _ := json.Marshal(entry["instance"])
-	var instance Instance
-	json.Unmarshal(instanceBytes, &instance)
-
-	// Ensure all required fields are populated before updating
-	instance = ensureInstanceFields(instance, instance.PrivateIpAddress, instance.PrivateDnsName, time.Now().UTC())
-
 	// Handle different attribute modifications
 	// Handle disableApiStop
 	if disableApiStop := r.FormValue("DisableApiStop.Value"); disableApiStop != "" {
@@ -1374,10 +1397,10 @@ func (h *Handler) ModifyInstanceAttribute(w http.ResponseWriter, r *http.Request
 	}
 
 	// Update instance in store
-	entry["instance"] = instance
-	buf, _ := json.Marshal(entry)
-	res.Attributes = buf
-	h.Store.Update(res)
+	if _, _, err := h.mutateInstance(r.Context(), ns, instanceId, nil); err != nil {
+		awsresponses.WriteErrorXML(w, http.StatusInternalServerError, "InternalFailure", "Failed to decode instance metadata", "")
+		return
+	}
 
 	resp := ModifyInstanceAttributeResponse{
 		Return: true,
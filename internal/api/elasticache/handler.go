@@ -6,12 +6,14 @@ package elasticache
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"opensnack/internal/awsarn"
 	"opensnack/internal/awsresponses"
 	"opensnack/internal/resource"
 	"opensnack/internal/util"
@@ -68,7 +70,7 @@ func (h *Handler) CreateCacheCluster(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if cluster already exists
-	_, err := h.Store.Get(cacheClusterId, "elasticache", "cache-cluster", ns)
+	_, err := h.Store.Get(r.Context(), cacheClusterId, "elasticache", "cache-cluster", ns)
 	if err == nil {
 		awsresponses.WriteErrorXML(w, http.StatusBadRequest, "CacheClusterAlreadyExists", "Cache cluster already exists: "+cacheClusterId, "")
 		return
@@ -122,7 +124,7 @@ func (h *Handler) CreateCacheCluster(w http.ResponseWriter, r *http.Request) {
 				Port:    port,
 			},
 			ParameterGroupStatus:     "in-sync",
-			CustomerAvailabilityZone: "us-east-1a",
+			CustomerAvailabilityZone: awsarn.FromContext(r.Context()).AvailabilityZone(),
 		}
 	}
 
@@ -141,7 +143,7 @@ func (h *Handler) CreateCacheCluster(w http.ResponseWriter, r *http.Request) {
 		EngineVersion:              "6.0",
 		CacheClusterStatus:         "available",
 		NumCacheNodes:              numCacheNodes,
-		PreferredAvailabilityZone:  "us-east-1a",
+		PreferredAvailabilityZone:  awsarn.FromContext(r.Context()).AvailabilityZone(),
 		CacheClusterCreateTime:     now,
 		PreferredMaintenanceWindow: "sun:05:00-sun:09:00",
 		CacheSecurityGroups: CacheSecurityGroupMemberships{
@@ -172,7 +174,7 @@ func (h *Handler) CreateCacheCluster(w http.ResponseWriter, r *http.Request) {
 		AuthTokenEnabled:         false,
 		TransitEncryptionEnabled: false,
 		AtRestEncryptionEnabled:  false,
-		ARN:                      "arn:aws:elasticache:" + elasticacheRegion + ":" + elasticacheAccount + ":cluster:" + cacheClusterId,
+		ARN:                      awsarn.FromContext(r.Context()).ARN("elasticache", "cluster:"+cacheClusterId),
 	}
 
 	// Store the cache cluster
@@ -189,7 +191,7 @@ func (h *Handler) CreateCacheCluster(w http.ResponseWriter, r *http.Request) {
 		Attributes: attributesBytes,
 	}
 
-	err = h.Store.Create(res)
+	err = h.Store.Create(r.Context(), res)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusInternalServerError, "InternalFailure", "Failed to create cache cluster", "")
 		return
@@ -220,11 +222,12 @@ func (h *Handler) DescribeCacheClusters(w http.ResponseWriter, r *http.Request)
 	}
 
 	var clusters []CacheCluster
+	var marker string
 
 	if len(cacheClusterIds) > 0 {
 		// Describe specific clusters
 		for _, clusterId := range cacheClusterIds {
-			res, err := h.Store.Get(clusterId, "elasticache", "cache-cluster", ns)
+			res, err := h.Store.Get(r.Context(), clusterId, "elasticache", "cache-cluster", ns)
 			if err != nil {
 				continue
 			}
@@ -241,21 +244,39 @@ func (h *Handler) DescribeCacheClusters(w http.ResponseWriter, r *http.Request)
 			clusters = append(clusters, cluster)
 		}
 	} else {
-		// List all clusters
-		allClusters, err := h.Store.List("elasticache", "cache-cluster", ns)
-		if err == nil {
-			for _, clusterRes := range allClusters {
-				var entry map[string]any
-				if err := json.Unmarshal(clusterRes.Attributes, &entry); err != nil {
-					continue
-				}
-
-				clusterBytes, _ := json.Marshal(entry["cache_cluster"])
-				var cluster CacheCluster
-				json.Unmarshal(clusterBytes, &cluster)
-
-				clusters = append(clusters, cluster)
+		// List all clusters, MaxRecords at a time
+		q := resource.Query{Service: "elasticache", Type: "cache-cluster", Namespace: ns, Limit: 100}
+		if raw := r.FormValue("MaxRecords"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 20 || n > 100 {
+				awsresponses.WriteErrorXML(w, http.StatusBadRequest, "InvalidParameterValue", "MaxRecords must be between 20 and 100", "")
+				return
 			}
+			q.Limit = n
+		}
+		q.Cursor = r.FormValue("Marker")
+
+		page, err := h.Store.Query(r.Context(), q)
+		if errors.Is(err, resource.ErrInvalidCursor) {
+			awsresponses.WriteErrorXML(w, http.StatusBadRequest, "InvalidParameterValue", "Invalid Marker", "")
+			return
+		}
+		if err != nil {
+			awsresponses.WriteErrorXML(w, http.StatusInternalServerError, "InternalFailure", err.Error(), "")
+			return
+		}
+		marker = page.Next
+		for _, clusterRes := range page.Resources {
+			var entry map[string]any
+			if err := json.Unmarshal(clusterRes.Attributes, &entry); err != nil {
+				continue
+			}
+
+			clusterBytes, _ := json.Marshal(entry["cache_cluster"])
+			var cluster CacheCluster
+			json.Unmarshal(clusterBytes, &cluster)
+
+			clusters = append(clusters, cluster)
 		}
 	}
 
@@ -267,6 +288,7 @@ func (h *Handler) DescribeCacheClusters(w http.ResponseWriter, r *http.Request)
 			CacheClusters: CacheClusterList{
 				CacheCluster: clusters,
 			},
+			Marker: marker,
 		},
 		ResponseMetadata: ResponseMetadata{
 			RequestId: requestId,
@@ -291,7 +313,7 @@ func (h *Handler) DeleteCacheCluster(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the cluster first
-	res, err := h.Store.Get(cacheClusterId, "elasticache", "cache-cluster", ns)
+	res, err := h.Store.Get(r.Context(), cacheClusterId, "elasticache", "cache-cluster", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusNotFound, "CacheClusterNotFound", "Cache cluster not found: "+cacheClusterId, "")
 		return
@@ -311,7 +333,7 @@ func (h *Handler) DeleteCacheCluster(w http.ResponseWriter, r *http.Request) {
 	cluster.CacheClusterStatus = "deleting"
 
 	// Delete from store
-	err = h.Store.Delete(cacheClusterId, "elasticache", "cache-cluster", ns)
+	err = h.Store.Delete(r.Context(), cacheClusterId, "elasticache", "cache-cluster", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusInternalServerError, "InternalFailure", "Failed to delete cache cluster", "")
 		return
@@ -373,7 +395,7 @@ func (h *Handler) ListTagsForResource(w http.ResponseWriter, r *http.Request) {
 	cacheClusterId := parts[6]
 
 	// Get cluster from store
-	cluster, err := h.Store.Get(cacheClusterId, "elasticache", "cache-cluster", ns)
+	cluster, err := h.Store.Get(r.Context(), cacheClusterId, "elasticache", "cache-cluster", ns)
 	if err != nil {
 		// AWS returns empty tags if resource doesn't exist
 		resp := ListTagsForResourceResponse{
@@ -0,0 +1,285 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package iam
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"opensnack/internal/awsresponses"
+	"opensnack/internal/resource"
+	"opensnack/internal/util"
+)
+
+//
+// ACCESS KEYS
+//
+// Access keys are stored by AccessKeyId with the user they belong to and
+// their secret, so the SigV4 middleware can verify requests signed with
+// them (see SecretAccessKey).
+//
+
+// maxAccessKeys is the per-user limit AWS enforces.
+const maxAccessKeys = 2
+
+var (
+	errAccessKeyNotFound = errors.New("access key not found")
+	errDeleteConflict    = errors.New("user still has access keys")
+)
+
+type accessKey struct {
+	UserName        string `json:"user_name"`
+	SecretAccessKey string `json:"secret_access_key"`
+	Status          string `json:"status"`
+	CreatedAt       string `json:"created_at"`
+}
+
+func newAccessKeyID() string {
+	b := make([]byte, 10)
+	rand.Read(b)
+	return "AKIA" + base32.StdEncoding.EncodeToString(b)
+}
+
+func newSecretAccessKey() string {
+	b := make([]byte, 30)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// SecretAccessKey returns the secret of an active access key created
+// through CreateAccessKey in namespace ns. Keys whose user no longer
+// exists are refused, so a key left behind by a deleted user cannot sign.
+func (h *Handler) SecretAccessKey(ctx context.Context, ns, accessKeyID string) (string, bool) {
+	key, err := h.loadAccessKey(ctx, ns, accessKeyID)
+	if err != nil || key.Status != "Active" {
+		return "", false
+	}
+	if _, err := h.Store.Get(ctx, key.UserName, "iam", "user", ns); err != nil {
+		return "", false
+	}
+	return key.SecretAccessKey, true
+}
+
+// deleteUser deletes a user that holds no access keys and returns
+// errDeleteConflict otherwise. The check and the delete share a
+// transaction when the store supports one.
+func (h *Handler) deleteUser(ctx context.Context, ns, name string) error {
+	del := func(s resource.Store) error {
+		page, err := s.Query(ctx, resource.Query{
+			Service: "iam", Type: "access_key", Namespace: ns,
+			Match: map[string]any{"user_name": name},
+			Limit: 1,
+		})
+		if err != nil {
+			return err
+		}
+		if len(page.Resources) > 0 {
+			return errDeleteConflict
+		}
+		return s.Delete(ctx, name, "iam", "user", ns)
+	}
+	if tx, ok := h.Store.(resource.Transactor); ok {
+		return tx.Transaction(ctx, del)
+	}
+	return del(h.Store)
+}
+
+func (h *Handler) loadAccessKey(ctx context.Context, ns, accessKeyID string) (*accessKey, error) {
+	if accessKeyID == "" {
+		return nil, errAccessKeyNotFound
+	}
+	res, err := h.Store.Get(ctx, accessKeyID, "iam", "access_key", ns)
+	if err != nil {
+		return nil, errAccessKeyNotFound
+	}
+	var key accessKey
+	if err := json.Unmarshal(res.Attributes, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+//
+// CreateAccessKey
+//
+
+func (h *Handler) CreateAccessKey(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	ns := util.NamespaceFromHeader(r)
+	userName := r.FormValue("UserName")
+
+	if userName == "" {
+		awsresponses.WriteErrorXML(w, 400, "MissingParameter", "UserName is required", "")
+		return
+	}
+	if _, err := h.Store.Get(r.Context(), userName, "iam", "user", ns); err != nil {
+		awsresponses.WriteErrorXML(w, 404, "NoSuchEntity", "The user with name "+userName+" cannot be found.", userName)
+		return
+	}
+
+	page, err := h.Store.Query(r.Context(), resource.Query{
+		Service: "iam", Type: "access_key", Namespace: ns,
+		Match: map[string]any{"user_name": userName},
+	})
+	if err != nil {
+		awsresponses.WriteErrorXML(w, 500, "ServiceFailure", err.Error(), "")
+		return
+	}
+	if len(page.Resources) >= maxAccessKeys {
+		awsresponses.WriteErrorXML(w, 409, "LimitExceeded", "Cannot exceed quota for AccessKeysPerUser: 2", userName)
+		return
+	}
+
+	id := newAccessKeyID()
+	key := accessKey{
+		UserName:        userName,
+		SecretAccessKey: newSecretAccessKey(),
+		Status:          "Active",
+		CreatedAt:       time.Now().UTC().Format(time.RFC3339),
+	}
+	buf, _ := json.Marshal(key)
+	err = h.Store.Create(r.Context(), &resource.Resource{
+		ID:         id,
+		Namespace:  ns,
+		Service:    "iam",
+		Type:       "access_key",
+		Attributes: buf,
+	})
+	if err != nil {
+		awsresponses.WriteErrorXML(w, 500, "ServiceFailure", err.Error(), "")
+		return
+	}
+
+	resp := CreateAccessKeyResponse{
+		CreateAccessKeyResult: CreateAccessKeyResult{
+			AccessKey: AccessKey{
+				UserName:        userName,
+				AccessKeyId:     id,
+				Status:          key.Status,
+				SecretAccessKey: key.SecretAccessKey,
+				CreateDate:      key.CreatedAt,
+			},
+		},
+		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	}
+	awsresponses.WriteXML(w, resp)
+}
+
+//
+// ListAccessKeys
+//
+
+func (h *Handler) ListAccessKeys(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	ns := util.NamespaceFromHeader(r)
+	userName := r.FormValue("UserName")
+
+	if userName == "" {
+		awsresponses.WriteErrorXML(w, 400, "MissingParameter", "UserName is required", "")
+		return
+	}
+	if _, err := h.Store.Get(r.Context(), userName, "iam", "user", ns); err != nil {
+		awsresponses.WriteErrorXML(w, 404, "NoSuchEntity", "The user with name "+userName+" cannot be found.", userName)
+		return
+	}
+
+	page, ok := h.listPage(w, r, resource.Query{
+		Service: "iam", Type: "access_key", Namespace: ns,
+		Match: map[string]any{"user_name": userName},
+	})
+	if !ok {
+		return
+	}
+
+	var keys []AccessKeyMetadata
+	for _, it := range page.Resources {
+		var key accessKey
+		if err := json.Unmarshal(it.Attributes, &key); err != nil {
+			continue
+		}
+		keys = append(keys, AccessKeyMetadata{
+			UserName:    key.UserName,
+			AccessKeyId: it.ID,
+			Status:      key.Status,
+			CreateDate:  key.CreatedAt,
+		})
+	}
+
+	resp := ListAccessKeysResponse{
+		ListAccessKeysResult: ListAccessKeysResult{
+			AccessKeyMetadata: keys,
+			IsTruncated:       page.Next != "",
+			Marker:            page.Next,
+		},
+		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	}
+	awsresponses.WriteXML(w, resp)
+}
+
+//
+// UpdateAccessKey
+//
+
+func (h *Handler) UpdateAccessKey(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	ns := util.NamespaceFromHeader(r)
+	id := r.FormValue("AccessKeyId")
+	userName := r.FormValue("UserName")
+	status := r.FormValue("Status")
+
+	if status != "Active" && status != "Inactive" {
+		awsresponses.WriteErrorXML(w, 400, "ValidationError", "Status must be Active or Inactive", "")
+		return
+	}
+	if key, err := h.loadAccessKey(r.Context(), ns, id); err != nil || (userName != "" && key.UserName != userName) {
+		awsresponses.WriteErrorXML(w, 404, "NoSuchEntity", "The Access Key with id "+id+" cannot be found.", id)
+		return
+	}
+
+	_, err := h.Store.Mutate(r.Context(), id, "iam", "access_key", ns, func(res *resource.Resource) error {
+		var key accessKey
+		json.Unmarshal(res.Attributes, &key)
+		key.Status = status
+		res.Attributes, _ = json.Marshal(key)
+		return nil
+	})
+	if err != nil {
+		awsresponses.WriteErrorXML(w, 500, "ServiceFailure", err.Error(), "")
+		return
+	}
+
+	resp := UpdateAccessKeyResponse{
+		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	}
+	awsresponses.WriteXML(w, resp)
+}
+
+//
+// DeleteAccessKey
+//
+
+func (h *Handler) DeleteAccessKey(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	ns := util.NamespaceFromHeader(r)
+	id := r.FormValue("AccessKeyId")
+	userName := r.FormValue("UserName")
+
+	if key, err := h.loadAccessKey(r.Context(), ns, id); err != nil || (userName != "" && key.UserName != userName) {
+		awsresponses.WriteErrorXML(w, 404, "NoSuchEntity", "The Access Key with id "+id+" cannot be found.", id)
+		return
+	}
+	_ = h.Store.Delete(r.Context(), id, "iam", "access_key", ns)
+
+	resp := DeleteAccessKeyResponse{
+		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	}
+	awsresponses.WriteXML(w, resp)
+}
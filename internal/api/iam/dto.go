@@ -35,21 +35,19 @@ type CreateRoleResponse struct {
 //
 
 type Role struct {
-	XMLName          xml.Name `xml:"Role"`
-	Path             string   `xml:"Path"`
-	RoleName         string   `xml:"RoleName"`
-	Arn              string   `xml:"Arn"`
-	AssumeRolePolicy string   `xml:"AssumeRolePolicyDocument"`
-	CreateDate       string   `xml:"CreateDate"`
+	Path             string `xml:"Path"`
+	RoleName         string `xml:"RoleName"`
+	Arn              string `xml:"Arn"`
+	AssumeRolePolicy string `xml:"AssumeRolePolicyDocument"`
+	CreateDate       string `xml:"CreateDate"`
 }
 
 type User struct {
-	XMLName    xml.Name `xml:"User"`
-	Path       string   `xml:"Path"`
-	UserName   string   `xml:"UserName"`
-	UserId     string   `xml:"UserId"`
-	Arn        string   `xml:"Arn"`
-	CreateDate string   `xml:"CreateDate"`
+	Path       string `xml:"Path"`
+	UserName   string `xml:"UserName"`
+	UserId     string `xml:"UserId"`
+	Arn        string `xml:"Arn"`
+	CreateDate string `xml:"CreateDate"`
 }
 
 //
@@ -157,10 +155,9 @@ type GetPolicyResponse struct {
 //
 
 type PolicyVersion struct {
-	XMLName          xml.Name `xml:"PolicyVersion"`
-	VersionId        string   `xml:"VersionId"`
-	IsDefaultVersion bool     `xml:"IsDefaultVersion"`
-	Document         string   `xml:"Document"`
+	VersionId        string `xml:"VersionId"`
+	IsDefaultVersion bool   `xml:"IsDefaultVersion"`
+	Document         string `xml:"Document"`
 }
 
 type GetPolicyVersionResult struct {
@@ -213,6 +210,8 @@ type AttachedPolicy struct {
 type ListAttachedRolePoliciesResult struct {
 	XMLName          xml.Name         `xml:"ListAttachedRolePoliciesResult"`
 	AttachedPolicies []AttachedPolicy `xml:"AttachedPolicies>member"`
+	IsTruncated      bool             `xml:"IsTruncated"`
+	Marker           string           `xml:"Marker,omitempty"`
 }
 
 type ListAttachedRolePoliciesResponse struct {
@@ -237,6 +236,8 @@ type AttachUserPolicyResponse struct {
 type ListAttachedUserPoliciesResult struct {
 	XMLName          xml.Name         `xml:"ListAttachedUserPoliciesResult"`
 	AttachedPolicies []AttachedPolicy `xml:"AttachedPolicies>member"`
+	IsTruncated      bool             `xml:"IsTruncated"`
+	Marker           string           `xml:"Marker,omitempty"`
 }
 
 type ListAttachedUserPoliciesResponse struct {
@@ -287,3 +288,56 @@ type ListRolesResponse struct {
 	ListRolesResult  ListRolesResult  `xml:"ListRolesResult"`
 	ResponseMetadata ResponseMetadata `xml:"ResponseMetadata"`
 }
+
+//
+// Access keys
+//
+
+type AccessKey struct {
+	UserName        string `xml:"UserName"`
+	AccessKeyId     string `xml:"AccessKeyId"`
+	Status          string `xml:"Status"`
+	SecretAccessKey string `xml:"SecretAccessKey"`
+	CreateDate      string `xml:"CreateDate"`
+}
+
+type CreateAccessKeyResult struct {
+	XMLName   xml.Name  `xml:"CreateAccessKeyResult"`
+	AccessKey AccessKey `xml:"AccessKey"`
+}
+
+type CreateAccessKeyResponse struct {
+	XMLName               xml.Name              `xml:"CreateAccessKeyResponse"`
+	CreateAccessKeyResult CreateAccessKeyResult `xml:"CreateAccessKeyResult"`
+	ResponseMetadata      ResponseMetadata      `xml:"ResponseMetadata"`
+}
+
+type AccessKeyMetadata struct {
+	UserName    string `xml:"UserName"`
+	AccessKeyId string `xml:"AccessKeyId"`
+	Status      string `xml:"Status"`
+	CreateDate  string `xml:"CreateDate"`
+}
+
+type ListAccessKeysResult struct {
+	XMLName           xml.Name            `xml:"ListAccessKeysResult"`
+	AccessKeyMetadata []AccessKeyMetadata `xml:"AccessKeyMetadata>member"`
+	IsTruncated       bool                `xml:"IsTruncated"`
+	Marker            string              `xml:"Marker,omitempty"`
+}
+
+type ListAccessKeysResponse struct {
+	XMLName              xml.Name             `xml:"ListAccessKeysResponse"`
+	ListAccessKeysResult ListAccessKeysResult `xml:"ListAccessKeysResult"`
+	ResponseMetadata     ResponseMetadata     `xml:"ResponseMetadata"`
+}
+
+type UpdateAccessKeyResponse struct {
+	XMLName          xml.Name         `xml:"UpdateAccessKeyResponse"`
+	ResponseMetadata ResponseMetadata `xml:"ResponseMetadata"`
+}
+
+type DeleteAccessKeyResponse struct {
+	XMLName          xml.Name         `xml:"DeleteAccessKeyResponse"`
+	ResponseMetadata ResponseMetadata `xml:"ResponseMetadata"`
+}
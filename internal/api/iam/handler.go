@@ -5,13 +5,17 @@
 package iam
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"opensnack/internal/awsarn"
 	"opensnack/internal/awsresponses"
 	"opensnack/internal/resource"
 	"opensnack/internal/util"
@@ -19,54 +23,67 @@ import (
 
 const (
 	APIVersion = "2010-05-08"
-	iamAccount = "000000000000"
-	iamRegion  = "us-east-1"
 )
 
 //
 // Construct ARNs
 //
 
-func roleArn(name string) string {
-	return "arn:aws:iam::" + iamAccount + ":role/" + name
+func roleArn(ctx context.Context, name string) string {
+	return awsarn.FromContext(ctx).GlobalARN("iam", "role/"+name)
 }
 
-func policyArn(name string) string {
-	return "arn:aws:iam::" + iamAccount + ":policy/" + name
+func policyArn(ctx context.Context, name string) string {
+	return awsarn.FromContext(ctx).GlobalARN("iam", "policy/"+name)
 }
 
 //
 // Helper: Count policy attachments
 //
 
-func (h *Handler) countPolicyAttachments(policyName, ns string) int {
+func (h *Handler) countPolicyAttachments(ctx context.Context, policyName, ns string) int {
 	count := 0
+	match := map[string]any{"policy": policyName}
 
-	// Count role attachments
-	roleAttachments, _ := h.Store.List("iam", "attachment", ns)
-	for _, att := range roleAttachments {
-		var attr map[string]any
-		if err := json.Unmarshal(att.Attributes, &attr); err != nil {
-			continue
-		}
-		if policy, ok := attr["policy"].(string); ok && policy == policyName {
-			count++
-		}
+	// Count role and user attachments
+	for _, typ := range []string{"attachment", "user_attachment"} {
+		page, _ := h.Store.Query(ctx, resource.Query{Service: "iam", Type: typ, Namespace: ns, Match: match})
+		count += len(page.Resources)
 	}
 
-	// Count user attachments
-	userAttachments, _ := h.Store.List("iam", "user_attachment", ns)
-	for _, att := range userAttachments {
-		var attr map[string]any
-		if err := json.Unmarshal(att.Attributes, &attr); err != nil {
-			continue
-		}
-		if policy, ok := attr["policy"].(string); ok && policy == policyName {
-			count++
+	return count
+}
+
+//
+// Helper: Paginate List* results
+//
+// List actions take MaxItems and Marker and answer with IsTruncated and
+// a Marker for the next page, which is the store's cursor.
+//
+
+func (h *Handler) listPage(w http.ResponseWriter, r *http.Request, q resource.Query) (resource.Page, bool) {
+	q.Limit = 100
+	if raw := r.FormValue("MaxItems"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 1000 {
+			awsresponses.WriteErrorXML(w, http.StatusBadRequest, "ValidationError",
+				"MaxItems must be between 1 and 1000", "")
+			return resource.Page{}, false
 		}
+		q.Limit = n
 	}
+	q.Cursor = r.FormValue("Marker")
 
-	return count
+	page, err := h.Store.Query(r.Context(), q)
+	if errors.Is(err, resource.ErrInvalidCursor) {
+		awsresponses.WriteErrorXML(w, http.StatusBadRequest, "InvalidInput", "Invalid Marker", "")
+		return resource.Page{}, false
+	}
+	if err != nil {
+		awsresponses.WriteErrorXML(w, http.StatusInternalServerError, "ServiceFailure", err.Error(), "")
+		return resource.Page{}, false
+	}
+	return page, true
 }
 
 //
@@ -100,7 +117,7 @@ func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := h.Store.Get(userName, "iam", "user", ns)
+	res, err := h.Store.Get(r.Context(), userName, "iam", "user", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, 404, "NoSuchEntity", "User does not exist", userName)
 		return
@@ -124,7 +141,7 @@ func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
 		Path:       path,
 		UserName:   userName,
 		UserId:     userID,
-		Arn:        userArn(userName),
+		Arn:        userArn(r.Context(), userName),
 		CreateDate: createdAt,
 	}
 
@@ -142,8 +159,8 @@ func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
 // CreateUser
 //
 
-func userArn(name string) string {
-	return "arn:aws:iam::" + iamAccount + ":user/" + name
+func userArn(ctx context.Context, name string) string {
+	return awsarn.FromContext(ctx).GlobalARN("iam", "user/"+name)
 }
 
 func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
@@ -162,7 +179,7 @@ func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Idempotent: return existing user if present
-	if existing, err := h.Store.Get(name, "iam", "user", ns); err == nil {
+	if existing, err := h.Store.Get(r.Context(), name, "iam", "user", ns); err == nil {
 		var attr map[string]any
 		if err := json.Unmarshal(existing.Attributes, &attr); err != nil {
 			awsresponses.WriteErrorXML(w, 500, "InternalFailure", "Failed to parse user attributes", name)
@@ -183,7 +200,7 @@ func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 					Path:       path,
 					UserName:   name,
 					UserId:     userID,
-					Arn:        userArn(name),
+					Arn:        userArn(r.Context(), name),
 					CreateDate: createdAt,
 				},
 			},
@@ -202,7 +219,7 @@ func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	buf, _ := json.Marshal(entry)
-	err := h.Store.Create(&resource.Resource{
+	err := h.Store.Create(r.Context(), &resource.Resource{
 		ID:         name,
 		Namespace:  ns,
 		Service:    "iam",
@@ -220,7 +237,7 @@ func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 				Path:       path,
 				UserName:   name,
 				UserId:     userId,
-				Arn:        userArn(name),
+				Arn:        userArn(r.Context(), name),
 				CreateDate: entry["created_at"].(string),
 			},
 		},
@@ -268,7 +285,7 @@ func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get existing user
-	res, err := h.Store.Get(name, "iam", "user", ns)
+	res, err := h.Store.Get(r.Context(), name, "iam", "user", ns)
 	if err != nil {
 		// If user doesn't exist, be lenient:
 		// - If not renaming (newUserName is empty), return success (idempotent)
@@ -283,7 +300,7 @@ func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		}
 		// If renaming and user doesn't exist, check if new name already exists
 		// (this handles the case where the user was already renamed)
-		if _, err2 := h.Store.Get(newUserName, "iam", "user", ns); err2 == nil {
+		if _, err2 := h.Store.Get(r.Context(), newUserName, "iam", "user", ns); err2 == nil {
 			// New name already exists, treat as success (idempotent)
 			resp := UpdateUserResponse{
 				ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
@@ -302,33 +319,28 @@ func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	// Handle rename: need to change resource ID
 	if newUserName != "" && newUserName != name {
 		// Check if new name already exists
-		if existing, err := h.Store.Get(newUserName, "iam", "user", ns); err == nil {
+		if _, err := h.Store.Get(r.Context(), newUserName, "iam", "user", ns); err == nil {
 			// New name already exists, just update its attributes
-			var existingAttr map[string]any
-			json.Unmarshal(existing.Attributes, &existingAttr)
-
-			// Update path if provided
-			if newPath != "" {
-				existingAttr["path"] = newPath
-			}
-			existingAttr["name"] = newUserName
-
-			buf, _ := json.Marshal(existingAttr)
-			updated := &resource.Resource{
-				ID:         newUserName,
-				Namespace:  ns,
-				Service:    "iam",
-				Type:       "user",
-				Attributes: buf,
-			}
-			err = h.Store.Update(updated)
+			_, err = h.Store.Mutate(r.Context(), newUserName, "iam", "user", ns, func(existing *resource.Resource) error {
+				var existingAttr map[string]any
+				json.Unmarshal(existing.Attributes, &existingAttr)
+
+				// Update path if provided
+				if newPath != "" {
+					existingAttr["path"] = newPath
+				}
+				existingAttr["name"] = newUserName
+
+				existing.Attributes, _ = json.Marshal(existingAttr)
+				return nil
+			})
 			if err != nil {
 				awsresponses.WriteJSON(w, 500, err.Error())
 			}
 
 			// Delete old user if it's different
 			if name != newUserName {
-				_ = h.Store.Delete(name, "iam", "user", ns)
+				_ = h.Store.Delete(r.Context(), name, "iam", "user", ns)
 			}
 		} else {
 			// Create new user with new name
@@ -346,13 +358,13 @@ func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 				Type:       "user",
 				Attributes: buf,
 			}
-			err = h.Store.Create(newUser)
+			err = h.Store.Create(r.Context(), newUser)
 			if err != nil {
 				awsresponses.WriteJSON(w, 500, err.Error())
 			}
 
 			// Delete old user
-			_ = h.Store.Delete(name, "iam", "user", ns)
+			_ = h.Store.Delete(r.Context(), name, "iam", "user", ns)
 		}
 	} else {
 		// No rename, just update attributes
@@ -369,16 +381,13 @@ func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 		// Only update if there are actual changes
 		if needsUpdate {
-			buf, _ := json.Marshal(attr)
-			updated := &resource.Resource{
-				ID:         res.ID,
-				Namespace:  res.Namespace,
-				Service:    res.Service,
-				Type:       res.Type,
-				Attributes: buf,
-			}
-
-			err = h.Store.Update(updated)
+			_, err = h.Store.Mutate(r.Context(), res.ID, res.Service, res.Type, res.Namespace, func(user *resource.Resource) error {
+				var attr map[string]any
+				json.Unmarshal(user.Attributes, &attr)
+				attr["path"] = newPath
+				user.Attributes, _ = json.Marshal(attr)
+				return nil
+			})
 			if err != nil {
 				awsresponses.WriteJSON(w, 500, err.Error())
 			}
@@ -407,9 +416,17 @@ func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 	if name == "" {
 		awsresponses.WriteErrorXML(w, 400, "MissingParameter", "UserName is required", "")
+		return
 	}
 
-	_ = h.Store.Delete(name, "iam", "user", ns)
+	if err := h.deleteUser(r.Context(), ns, name); err != nil {
+		if errors.Is(err, errDeleteConflict) {
+			awsresponses.WriteErrorXML(w, 409, "DeleteConflict", "Cannot delete entity, must delete access keys first.", name)
+			return
+		}
+		awsresponses.WriteErrorXML(w, 500, "ServiceFailure", err.Error(), "")
+		return
+	}
 
 	resp := DeleteUserResponse{
 		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
@@ -426,13 +443,13 @@ func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	ns := util.NamespaceFromHeader(r)
 
-	items, err := h.Store.List("iam", "user", ns)
-	if err != nil {
-		awsresponses.WriteJSON(w, 500, err.Error())
+	page, ok := h.listPage(w, r, resource.Query{Service: "iam", Type: "user", Namespace: ns})
+	if !ok {
+		return
 	}
 
 	var users []User
-	for _, it := range items {
+	for _, it := range page.Resources {
 		var attr map[string]any
 		if err := json.Unmarshal(it.Attributes, &attr); err != nil {
 			continue
@@ -449,7 +466,7 @@ func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
 			Path:       path,
 			UserName:   it.ID,
 			UserId:     userID,
-			Arn:        userArn(it.ID),
+			Arn:        userArn(r.Context(), it.ID),
 			CreateDate: createdAt,
 		})
 	}
@@ -457,7 +474,8 @@ func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	resp := ListUsersResponse{
 		ListUsersResult: ListUsersResult{
 			Users:       users,
-			IsTruncated: false,
+			IsTruncated: page.Next != "",
+			Marker:      page.Next,
 		},
 		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
 	}
@@ -469,13 +487,13 @@ func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	ns := util.NamespaceFromHeader(r)
 
-	items, err := h.Store.List("iam", "role", ns)
-	if err != nil {
-		awsresponses.WriteJSON(w, 500, err.Error())
+	page, ok := h.listPage(w, r, resource.Query{Service: "iam", Type: "role", Namespace: ns})
+	if !ok {
+		return
 	}
 
 	var roles []Role
-	for _, it := range items {
+	for _, it := range page.Resources {
 		var attr map[string]any
 		json.Unmarshal(it.Attributes, &attr)
 
@@ -485,7 +503,7 @@ func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) {
 		roles = append(roles, Role{
 			Path:             "/",
 			RoleName:         it.ID,
-			Arn:              roleArn(it.ID),
+			Arn:              roleArn(r.Context(), it.ID),
 			AssumeRolePolicy: assume,
 			CreateDate:       created,
 		})
@@ -494,7 +512,8 @@ func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) {
 	resp := ListRolesResponse{
 		ListRolesResult: ListRolesResult{
 			Roles:       roles,
-			IsTruncated: false,
+			IsTruncated: page.Next != "",
+			Marker:      page.Next,
 		},
 		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
 	}
@@ -555,6 +574,15 @@ func (h *Handler) Dispatch(w http.ResponseWriter, r *http.Request) {
 	case "ListAttachedUserPolicies":
 		h.ListAttachedUserPolicies(w, r)
 
+	case "CreateAccessKey":
+		h.CreateAccessKey(w, r)
+	case "ListAccessKeys":
+		h.ListAccessKeys(w, r)
+	case "UpdateAccessKey":
+		h.UpdateAccessKey(w, r)
+	case "DeleteAccessKey":
+		h.DeleteAccessKey(w, r)
+
 	default:
 		awsresponses.WriteErrorXML(
 			w,
@@ -582,7 +610,7 @@ func (h *Handler) CreateRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Idempotent: return existing role if present
-	if existing, err := h.Store.Get(name, "iam", "role", ns); err == nil {
+	if existing, err := h.Store.Get(r.Context(), name, "iam", "role", ns); err == nil {
 		var attr map[string]any
 		if err := json.Unmarshal(existing.Attributes, &attr); err != nil {
 			awsresponses.WriteErrorXML(w, 500, "InternalFailure", "Failed to parse role attributes", name)
@@ -597,7 +625,7 @@ func (h *Handler) CreateRole(w http.ResponseWriter, r *http.Request) {
 				Role: Role{
 					Path:             "/",
 					RoleName:         name,
-					Arn:              roleArn(name),
+					Arn:              roleArn(r.Context(), name),
 					AssumeRolePolicy: assumePolicy,
 					CreateDate:       createdAt,
 				},
@@ -615,7 +643,7 @@ func (h *Handler) CreateRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	buf, _ := json.Marshal(entry)
-	err := h.Store.Create(&resource.Resource{
+	err := h.Store.Create(r.Context(), &resource.Resource{
 		ID:         name,
 		Namespace:  ns,
 		Service:    "iam",
@@ -631,7 +659,7 @@ func (h *Handler) CreateRole(w http.ResponseWriter, r *http.Request) {
 			Role: Role{
 				Path:             "/",
 				RoleName:         name,
-				Arn:              roleArn(name),
+				Arn:              roleArn(r.Context(), name),
 				AssumeRolePolicy: policyDoc,
 				CreateDate:       entry["created_at"].(string),
 			},
@@ -653,7 +681,7 @@ func (h *Handler) GetRole(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 	name := r.URL.Query().Get("RoleName")
 
-	res, err := h.Store.Get(name, "iam", "role", ns)
+	res, err := h.Store.Get(r.Context(), name, "iam", "role", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, 404, "NoSuchEntity", "Role does not exist", name)
 		return
@@ -673,7 +701,7 @@ func (h *Handler) GetRole(w http.ResponseWriter, r *http.Request) {
 			Role: Role{
 				Path:             "/",
 				RoleName:         name,
-				Arn:              roleArn(name),
+				Arn:              roleArn(r.Context(), name),
 				AssumeRolePolicy: assumePolicy,
 				CreateDate:       createdAt,
 			},
@@ -693,7 +721,7 @@ func (h *Handler) DeleteRole(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 	name := r.URL.Query().Get("RoleName")
 
-	_ = h.Store.Delete(name, "iam", "role", ns)
+	_ = h.Store.Delete(r.Context(), name, "iam", "role", ns)
 
 	awsresponses.WriteEmpty200(w, nil)
 }
@@ -722,7 +750,7 @@ func (h *Handler) CreatePolicy(w http.ResponseWriter, r *http.Request) {
 	policyId := "A" + strings.ToUpper(hex.EncodeToString(hash[:]))[:20]
 
 	// Idempotent
-	if existing, err := h.Store.Get(name, "iam", "policy", ns); err == nil {
+	if existing, err := h.Store.Get(r.Context(), name, "iam", "policy", ns); err == nil {
 		var attr map[string]any
 		json.Unmarshal(existing.Attributes, &attr)
 
@@ -733,7 +761,7 @@ func (h *Handler) CreatePolicy(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Count attachments
-		attachmentCount := h.countPolicyAttachments(name, ns)
+		attachmentCount := h.countPolicyAttachments(r.Context(), name, ns)
 
 		// Safely extract attributes with defaults
 		policyId, _ := attr["policy_id"].(string)
@@ -752,7 +780,7 @@ func (h *Handler) CreatePolicy(w http.ResponseWriter, r *http.Request) {
 				Policy: Policy{
 					PolicyName:       name,
 					PolicyId:         policyId,
-					Arn:              policyArn(name),
+					Arn:              policyArn(r.Context(), name),
 					Path:             path,
 					DefaultVersionId: "v1",
 					CreateDate:       createdAt,
@@ -780,7 +808,7 @@ func (h *Handler) CreatePolicy(w http.ResponseWriter, r *http.Request) {
 
 	buf, _ := json.Marshal(entry)
 
-	err := h.Store.Create(&resource.Resource{
+	err := h.Store.Create(r.Context(), &resource.Resource{
 		ID:         name,
 		Namespace:  ns,
 		Service:    "iam",
@@ -796,7 +824,7 @@ func (h *Handler) CreatePolicy(w http.ResponseWriter, r *http.Request) {
 			Policy: Policy{
 				PolicyName:       name,
 				PolicyId:         policyId,
-				Arn:              policyArn(name),
+				Arn:              policyArn(r.Context(), name),
 				Path:             path,
 				DefaultVersionId: "v1",
 				CreateDate:       now,
@@ -829,7 +857,7 @@ func (h *Handler) GetPolicy(w http.ResponseWriter, r *http.Request) {
 
 	name := arn[strings.LastIndex(arn, "/")+1:]
 
-	res, err := h.Store.Get(name, "iam", "policy", ns)
+	res, err := h.Store.Get(r.Context(), name, "iam", "policy", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, 404, "NoSuchEntity", "Policy does not exist", name)
 	}
@@ -849,7 +877,7 @@ func (h *Handler) GetPolicy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Count attachments
-	attachmentCount := h.countPolicyAttachments(name, ns)
+	attachmentCount := h.countPolicyAttachments(r.Context(), name, ns)
 
 	resp := GetPolicyResponse{
 		GetPolicyResult: GetPolicyResult{
@@ -897,7 +925,7 @@ func (h *Handler) GetPolicyVersion(w http.ResponseWriter, r *http.Request) {
 
 	name := arn[strings.LastIndex(arn, "/")+1:]
 
-	res, err := h.Store.Get(name, "iam", "policy", ns)
+	res, err := h.Store.Get(r.Context(), name, "iam", "policy", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, 404, "NoSuchEntity", "Policy missing", arn)
 	}
@@ -944,7 +972,7 @@ func (h *Handler) ListPolicyVersions(w http.ResponseWriter, r *http.Request) {
 
 	name := arn[strings.LastIndex(arn, "/")+1:]
 
-	res, err := h.Store.Get(name, "iam", "policy", ns)
+	res, err := h.Store.Get(r.Context(), name, "iam", "policy", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, 404, "NoSuchEntity", "Policy does not exist", name)
 	}
@@ -985,7 +1013,7 @@ func (h *Handler) DeletePolicy(w http.ResponseWriter, r *http.Request) {
 
 	name := arn[strings.LastIndex(arn, "/")+1:]
 
-	_ = h.Store.Delete(name, "iam", "policy", ns)
+	_ = h.Store.Delete(r.Context(), name, "iam", "policy", ns)
 
 	awsresponses.WriteEmpty200(w, nil)
 }
@@ -1012,7 +1040,7 @@ func (h *Handler) AttachRolePolicy(w http.ResponseWriter, r *http.Request) {
 
 	buf, _ := json.Marshal(entry)
 
-	_ = h.Store.Create(&resource.Resource{
+	_ = h.Store.Create(r.Context(), &resource.Resource{
 		ID:         id,
 		Namespace:  ns,
 		Service:    "iam",
@@ -1041,7 +1069,7 @@ func (h *Handler) DetachRolePolicy(w http.ResponseWriter, r *http.Request) {
 
 	id := role + ":" + name
 
-	_ = h.Store.Delete(id, "iam", "attachment", ns)
+	_ = h.Store.Delete(r.Context(), id, "iam", "attachment", ns)
 
 	resp := AttachRolePolicyResponse{
 		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
@@ -1059,31 +1087,17 @@ func (h *Handler) ListAttachedRolePolicies(w http.ResponseWriter, r *http.Reques
 	ns := util.NamespaceFromHeader(r)
 	role := r.URL.Query().Get("RoleName")
 
-	items, _ := h.Store.List("iam", "attachment", ns)
-
-	var list []AttachedPolicy
-	for _, it := range items {
-		var attr map[string]any
-		if err := json.Unmarshal(it.Attributes, &attr); err != nil {
-			continue
-		}
-
-		roleName, _ := attr["role"].(string)
-		if roleName == role {
-			policyName, _ := attr["policy"].(string)
-			policyArn, _ := attr["policy_arn"].(string)
-			if policyName != "" && policyArn != "" {
-				list = append(list, AttachedPolicy{
-					PolicyName: policyName,
-					PolicyArn:  policyArn,
-				})
-			}
-		}
+	// Attachment IDs are <role>:<policy>
+	page, ok := h.listPage(w, r, resource.Query{Service: "iam", Type: "attachment", Namespace: ns, IDPrefix: role + ":"})
+	if !ok {
+		return
 	}
 
 	resp := ListAttachedRolePoliciesResponse{
 		ListAttachedRolePoliciesResult: ListAttachedRolePoliciesResult{
-			AttachedPolicies: list,
+			AttachedPolicies: attachedPolicies(page.Resources),
+			IsTruncated:      page.Next != "",
+			Marker:           page.Next,
 		},
 		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
 	}
@@ -1127,7 +1141,7 @@ func (h *Handler) AttachUserPolicy(w http.ResponseWriter, r *http.Request) {
 
 	buf, _ := json.Marshal(entry)
 
-	_ = h.Store.Create(&resource.Resource{
+	_ = h.Store.Create(r.Context(), &resource.Resource{
 		ID:         id,
 		Namespace:  ns,
 		Service:    "iam",
@@ -1170,7 +1184,7 @@ func (h *Handler) DetachUserPolicy(w http.ResponseWriter, r *http.Request) {
 	name := arn[strings.LastIndex(arn, "/")+1:]
 	id := "user:" + userName + ":" + name
 
-	_ = h.Store.Delete(id, "iam", "user_attachment", ns)
+	_ = h.Store.Delete(r.Context(), id, "iam", "user_attachment", ns)
 
 	resp := AttachUserPolicyResponse{
 		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
@@ -1196,8 +1210,25 @@ func (h *Handler) ListAttachedUserPolicies(w http.ResponseWriter, r *http.Reques
 		awsresponses.WriteErrorXML(w, 400, "MissingParameter", "UserName is required", "")
 	}
 
-	items, _ := h.Store.List("iam", "user_attachment", ns)
+	// User attachment IDs are user:<user>:<policy>
+	page, ok := h.listPage(w, r, resource.Query{Service: "iam", Type: "user_attachment", Namespace: ns, IDPrefix: "user:" + userName + ":"})
+	if !ok {
+		return
+	}
+
+	resp := ListAttachedUserPoliciesResponse{
+		ListAttachedUserPoliciesResult: ListAttachedUserPoliciesResult{
+			AttachedPolicies: attachedPolicies(page.Resources),
+			IsTruncated:      page.Next != "",
+			Marker:           page.Next,
+		},
+		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	}
+
+	awsresponses.WriteXML(w, resp)
+}
 
+func attachedPolicies(items []resource.Resource) []AttachedPolicy {
 	var list []AttachedPolicy
 	for _, it := range items {
 		var attr map[string]any
@@ -1205,25 +1236,14 @@ func (h *Handler) ListAttachedUserPolicies(w http.ResponseWriter, r *http.Reques
 			continue
 		}
 
-		user, _ := attr["user"].(string)
-		if user == userName {
-			policyName, _ := attr["policy"].(string)
-			policyArn, _ := attr["policy_arn"].(string)
-			if policyName != "" && policyArn != "" {
-				list = append(list, AttachedPolicy{
-					PolicyName: policyName,
-					PolicyArn:  policyArn,
-				})
-			}
+		policyName, _ := attr["policy"].(string)
+		policyArn, _ := attr["policy_arn"].(string)
+		if policyName != "" && policyArn != "" {
+			list = append(list, AttachedPolicy{
+				PolicyName: policyName,
+				PolicyArn:  policyArn,
+			})
 		}
 	}
-
-	resp := ListAttachedUserPoliciesResponse{
-		ListAttachedUserPoliciesResult: ListAttachedUserPoliciesResult{
-			AttachedPolicies: list,
-		},
-		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
-	}
-
-	awsresponses.WriteXML(w, resp)
+	return list
 }
@@ -7,83 +7,33 @@ package iam_test
 import (
 	"encoding/json"
 	"encoding/xml"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
 
 	"opensnack/internal/api/iam"
 	"opensnack/internal/resource"
-
-	"github.com/labstack/echo/v4"
 )
 
-//
-// MockStore (same pattern as SQS/SNS)
-//
-
-type MockStore struct {
-	data map[string]resource.Resource
-}
-
-func NewMockStore() *MockStore {
-	return &MockStore{data: map[string]resource.Resource{}}
-}
-
-func key(id, ns string) string {
-	return ns + "|" + id
-}
-
-func (m *MockStore) Create(r *resource.Resource) error {
-	m.data[key(r.ID, r.Namespace)] = *r
-	return nil
-}
-
-func (m *MockStore) Update(r *resource.Resource) error {
-	m.data[key(r.ID, r.Namespace)] = *r
-	return nil
-}
-
-func (m *MockStore) Get(id, service, typ, ns string) (*resource.Resource, error) {
-	v, ok := m.data[key(id, ns)]
-	if !ok {
-		return nil, echo.NewHTTPError(404)
-	}
-	return &v, nil
-}
-
-func (m *MockStore) List(service, typ, ns string) ([]resource.Resource, error) {
-	out := []resource.Resource{}
-	for _, v := range m.data {
-		if v.Service == service && v.Type == typ && v.Namespace == ns {
-			out = append(out, v)
-		}
-	}
-	return out, nil
-}
-
-func (m *MockStore) Delete(id, service, typ, ns string) error {
-	delete(m.data, key(id, ns))
-	return nil
-}
-
 //
 // Test helper
 //
 
-func ctx(method, target string, body *strings.Reader) (echo.Context, *httptest.ResponseRecorder, *echo.Echo) {
-	e := echo.New()
-
+func ctx(method, target string, body *strings.Reader) (*http.Request, *httptest.ResponseRecorder) {
 	if body == nil {
 		body = strings.NewReader("")
 	}
 
 	req := httptest.NewRequest(method, target, body)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("X-Opensnack-Namespace", "ns1")
+	req.Header.Set("User-Agent", "opensnack-test custom-ns1")
 
 	rec := httptest.NewRecorder()
-	return e.NewContext(req, rec), rec, e
+	return req, rec
 }
 
 //
@@ -93,16 +43,13 @@ func ctx(method, target string, body *strings.Reader) (echo.Context, *httptest.R
 //
 
 func TestCreateRole(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := iam.NewHandler(store)
 
 	body := strings.NewReader(`RoleName=MyRole&AssumeRolePolicyDocument=%7B%7D`)
-	c, rec, _ := ctx("POST", "/iam?Action=CreateRole", body)
+	req, rec := ctx("POST", "/iam?Action=CreateRole", body)
 
-	err := h.Dispatch(c)
-	if err != nil {
-		t.Fatal(err)
-	}
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
@@ -118,16 +65,16 @@ func TestCreateRole(t *testing.T) {
 }
 
 func TestCreateRole_Idempotent(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := iam.NewHandler(store)
 
 	body := strings.NewReader(`RoleName=SameRole&AssumeRolePolicyDocument=%7B%7D`)
-	c1, _, _ := ctx("POST", "/iam?Action=CreateRole", body)
-	_ = h.Dispatch(c1)
+	req1, rec1 := ctx("POST", "/iam?Action=CreateRole", body)
+	h.Dispatch(rec1, req1)
 
 	body2 := strings.NewReader(`RoleName=SameRole&AssumeRolePolicyDocument=%7B%7D`)
-	c2, rec2, _ := ctx("POST", "/iam?Action=CreateRole", body2)
-	_ = h.Dispatch(c2)
+	req2, rec2 := ctx("POST", "/iam?Action=CreateRole", body2)
+	h.Dispatch(rec2, req2)
 
 	if rec2.Code != 200 {
 		t.Fatalf("idempotent create returned %d", rec2.Code)
@@ -135,7 +82,7 @@ func TestCreateRole_Idempotent(t *testing.T) {
 }
 
 func TestGetRole(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := iam.NewHandler(store)
 
 	entry := map[string]any{
@@ -145,7 +92,7 @@ func TestGetRole(t *testing.T) {
 	}
 	buf, _ := json.Marshal(entry)
 
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:         "FetchRole",
 		Namespace:  "ns1",
 		Service:    "iam",
@@ -153,8 +100,8 @@ func TestGetRole(t *testing.T) {
 		Attributes: buf,
 	})
 
-	c, rec, _ := ctx("POST", "/iam?Action=GetRole&RoleName=FetchRole", nil)
-	_ = h.Dispatch(c)
+	req, rec := ctx("POST", "/iam?Action=GetRole&RoleName=FetchRole", nil)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
@@ -166,13 +113,13 @@ func TestGetRole(t *testing.T) {
 }
 
 func TestDeleteRole(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := iam.NewHandler(store)
 
 	entry := map[string]any{"name": "KillRole"}
 	buf, _ := json.Marshal(entry)
 
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:         "KillRole",
 		Namespace:  "ns1",
 		Service:    "iam",
@@ -180,29 +127,26 @@ func TestDeleteRole(t *testing.T) {
 		Attributes: buf,
 	})
 
-	c, rec, _ := ctx("POST", "/iam?Action=DeleteRole&RoleName=KillRole", nil)
-	_ = h.Dispatch(c)
+	req, rec := ctx("POST", "/iam?Action=DeleteRole&RoleName=KillRole", nil)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("delete returned %d", rec.Code)
 	}
 
-	if _, err := store.Get("KillRole", "iam", "role", "ns1"); err == nil {
+	if _, err := store.Get(t.Context(), "KillRole", "iam", "role", "ns1"); err == nil {
 		t.Fatalf("role not deleted")
 	}
 }
 
 func TestCreatePolicy(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := iam.NewHandler(store)
 
 	body := strings.NewReader(`PolicyName=MyPolicy&PolicyDocument=%7B%7D`)
-	c, rec, _ := ctx("POST", "/iam?Action=CreatePolicy", body)
+	req, rec := ctx("POST", "/iam?Action=CreatePolicy", body)
 
-	err := h.Dispatch(c)
-	if err != nil {
-		t.Fatal(err)
-	}
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
@@ -214,7 +158,7 @@ func TestCreatePolicy(t *testing.T) {
 }
 
 func TestGetPolicy(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := iam.NewHandler(store)
 
 	entry := map[string]any{
@@ -224,7 +168,7 @@ func TestGetPolicy(t *testing.T) {
 	}
 	buf, _ := json.Marshal(entry)
 
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:         "FetchPolicy",
 		Namespace:  "ns1",
 		Service:    "iam",
@@ -233,8 +177,8 @@ func TestGetPolicy(t *testing.T) {
 	})
 
 	arn := "arn:aws:iam::000000000000:policy/FetchPolicy"
-	c, rec, _ := ctx("POST", "/iam?Action=GetPolicy&PolicyArn="+arn, nil)
-	_ = h.Dispatch(c)
+	req, rec := ctx("POST", "/iam?Action=GetPolicy&PolicyArn="+arn, nil)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200")
@@ -246,7 +190,7 @@ func TestGetPolicy(t *testing.T) {
 }
 
 func TestGetPolicyVersion(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := iam.NewHandler(store)
 
 	entry := map[string]any{
@@ -256,7 +200,7 @@ func TestGetPolicyVersion(t *testing.T) {
 	}
 	buf, _ := json.Marshal(entry)
 
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:         "VersionedPolicy",
 		Namespace:  "ns1",
 		Service:    "iam",
@@ -267,8 +211,8 @@ func TestGetPolicyVersion(t *testing.T) {
 	arn := "arn:aws:iam::000000000000:policy/VersionedPolicy"
 	url := "/iam?Action=GetPolicyVersion&PolicyArn=" + arn + "&VersionId=v1"
 
-	c, rec, _ := ctx("POST", url, nil)
-	_ = h.Dispatch(c)
+	req, rec := ctx("POST", url, nil)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200")
@@ -280,28 +224,28 @@ func TestGetPolicyVersion(t *testing.T) {
 }
 
 func TestAttachRolePolicy(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := iam.NewHandler(store)
 
-	c, rec, _ := ctx("POST",
+	req, rec := ctx("POST",
 		"/iam?Action=AttachRolePolicy&RoleName=R1&PolicyArn=arn:aws:iam::000000000000:policy/P1",
 		nil,
 	)
-	_ = h.Dispatch(c)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200")
 	}
 
 	// attachment should exist
-	_, err := store.Get("R1:P1", "iam", "attachment", "ns1")
+	_, err := store.Get(t.Context(), "R1:P1", "iam", "attachment", "ns1")
 	if err != nil {
 		t.Fatalf("attachment not created")
 	}
 }
 
 func TestListAttachedRolePolicies(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := iam.NewHandler(store)
 
 	// Seed attachments
@@ -312,7 +256,7 @@ func TestListAttachedRolePolicies(t *testing.T) {
 	}
 	buf, _ := json.Marshal(entry)
 
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:         "R2:P1",
 		Namespace:  "ns1",
 		Service:    "iam",
@@ -320,8 +264,8 @@ func TestListAttachedRolePolicies(t *testing.T) {
 		Attributes: buf,
 	})
 
-	c, rec, _ := ctx("POST", "/iam?Action=ListAttachedRolePolicies&RoleName=R2", nil)
-	_ = h.Dispatch(c)
+	req, rec := ctx("POST", "/iam?Action=ListAttachedRolePolicies&RoleName=R2", nil)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200")
@@ -336,7 +280,7 @@ func TestListAttachedRolePolicies(t *testing.T) {
 }
 
 func TestDetachRolePolicy(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := iam.NewHandler(store)
 
 	entry := map[string]any{
@@ -346,7 +290,7 @@ func TestDetachRolePolicy(t *testing.T) {
 	}
 	buf, _ := json.Marshal(entry)
 
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:         "DetachR:DetachP",
 		Namespace:  "ns1",
 		Service:    "iam",
@@ -354,17 +298,88 @@ func TestDetachRolePolicy(t *testing.T) {
 		Attributes: buf,
 	})
 
-	c, rec, _ := ctx("POST",
+	req, rec := ctx("POST",
 		"/iam?Action=DetachRolePolicy&RoleName=DetachR&PolicyArn=arn:aws:iam::000000000000:policy/DetachP",
 		nil,
 	)
-	_ = h.Dispatch(c)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
 	}
 
-	if _, err := store.Get("DetachR:DetachP", "iam", "attachment", "ns1"); err == nil {
+	if _, err := store.Get(t.Context(), "DetachR:DetachP", "iam", "attachment", "ns1"); err == nil {
 		t.Fatalf("attachment should be deleted")
 	}
 }
+
+func TestListUsers_Marker(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := iam.NewHandler(store)
+
+	for i := range 5 {
+		req, rec := ctx("POST", "/iam", strings.NewReader(fmt.Sprintf("Action=CreateUser&UserName=user%d", i)))
+		h.Dispatch(rec, req)
+		if rec.Code != 200 {
+			t.Fatalf("CreateUser user%d: %d %s", i, rec.Code, rec.Body.String())
+		}
+	}
+
+	seen := map[string]bool{}
+	marker := ""
+	for pages := 1; ; pages++ {
+		if pages > 5 {
+			t.Fatalf("paging did not terminate")
+		}
+
+		form := url.Values{"Action": {"ListUsers"}, "MaxItems": {"2"}}
+		if marker != "" {
+			form.Set("Marker", marker)
+		}
+		req, rec := ctx("POST", "/iam", strings.NewReader(form.Encode()))
+		h.Dispatch(rec, req)
+
+		if rec.Code != 200 {
+			t.Fatalf("page %d: expected 200, got %d: %s", pages, rec.Code, rec.Body.String())
+		}
+
+		var resp iam.ListUsersResponse
+		if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid XML: %v", err)
+		}
+		result := resp.ListUsersResult
+
+		if len(result.Users) > 2 {
+			t.Fatalf("page %d has %d users, MaxItems is 2", pages, len(result.Users))
+		}
+		for _, u := range result.Users {
+			if seen[u.UserName] {
+				t.Fatalf("user %s listed twice", u.UserName)
+			}
+			seen[u.UserName] = true
+		}
+
+		if !result.IsTruncated {
+			break
+		}
+		if result.Marker == "" {
+			t.Fatalf("page %d is truncated without a Marker", pages)
+		}
+		marker = result.Marker
+	}
+
+	if len(seen) != 5 {
+		t.Fatalf("expected 5 users across pages, got %v", seen)
+	}
+}
+
+func TestListUsers_InvalidMarker(t *testing.T) {
+	h := iam.NewHandler(resource.NewMemoryStore())
+
+	req, rec := ctx("POST", "/iam", strings.NewReader("Action=ListUsers&Marker=bogus"))
+	h.Dispatch(rec, req)
+
+	if rec.Code != 400 {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
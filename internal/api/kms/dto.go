@@ -78,6 +78,19 @@ type GetKeyRotationStatusOutput struct {
 	KeyID              string `json:"KeyId"`
 }
 
+// ListKeysInput represents the request to list KMS keys
+type ListKeysInput struct {
+	Limit  *int32 `json:"Limit,omitempty"`
+	Marker string `json:"Marker,omitempty"`
+}
+
+// ListKeysOutput represents the response from listing KMS keys
+type ListKeysOutput struct {
+	Keys       []KeyMetadata `json:"Keys"`
+	Truncated  bool          `json:"Truncated"`
+	NextMarker string        `json:"NextMarker,omitempty"`
+}
+
 // ListResourceTagsInput represents the request to list tags for a KMS key
 type ListResourceTagsInput struct {
 	KeyID   string `json:"KeyId"`
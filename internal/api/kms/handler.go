@@ -5,11 +5,14 @@
 package kms
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
+	"opensnack/internal/awsarn"
 	"opensnack/internal/awsresponses"
 	"opensnack/internal/resource"
 	"opensnack/internal/util"
@@ -19,8 +22,6 @@ import (
 
 const (
 	APIVersion = "2014-11-01"
-	kmsRegion  = "us-east-1"
-	kmsAccount = "000000000000"
 )
 
 type Handler struct {
@@ -32,8 +33,8 @@ func NewHandler(store resource.Store) *Handler {
 }
 
 // Build KMS Key ARN
-func keyArn(keyID string) string {
-	return "arn:aws:kms:" + kmsRegion + ":" + kmsAccount + ":key/" + keyID
+func keyArn(ctx context.Context, keyID string) string {
+	return awsarn.FromContext(ctx).ARN("kms", "key/"+keyID)
 }
 
 // writeKMSJSON writes JSON response with KMS-specific Content-Type
@@ -130,11 +131,11 @@ func (h *Handler) CreateKey(w http.ResponseWriter, r *http.Request) {
 	now := time.Now().UTC()
 	creationDate := float64(now.Unix())
 
-	arn := keyArn(keyIDFormatted)
+	arn := keyArn(r.Context(), keyIDFormatted)
 
 	// Build key metadata
 	keyMetadata := KeyMetadata{
-		AWSAccountID:          kmsAccount,
+		AWSAccountID:          awsarn.FromContext(r.Context()).AccountID,
 		ARN:                   arn,
 		CreationDate:          creationDate,
 		CustomerMasterKeySpec: customerMasterKeySpec,
@@ -178,7 +179,7 @@ func (h *Handler) CreateKey(w http.ResponseWriter, r *http.Request) {
 		Attributes: buf,
 	}
 
-	if err := h.Store.Create(res); err != nil {
+	if err := h.Store.Create(r.Context(), res); err != nil {
 		writeKMSJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalFailure",
 			"message": "Failed to create key: " + err.Error(),
@@ -222,7 +223,7 @@ func (h *Handler) DescribeKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get key from store
-	res, err := h.Store.Get(keyID, "kms", "key", ns)
+	res, err := h.Store.Get(r.Context(), keyID, "kms", "key", ns)
 	if err != nil {
 		writeKMSJSON(w, http.StatusNotFound, map[string]any{
 			"__type":  "NotFoundException",
@@ -249,11 +250,45 @@ func (h *Handler) DescribeKey(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// ListKeys lists all KMS keys
+// ListKeys lists KMS keys a page at a time
 func (h *Handler) ListKeys(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
-	keys, err := h.Store.List("kms", "key", ns)
+	var req ListKeysInput
+	if err := util.DecodeAWSJSON(r, &req); err != nil {
+		writeKMSJSON(w, http.StatusBadRequest, map[string]any{
+			"__type":  "InvalidParameterException",
+			"message": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	limit := 100
+	if req.Limit != nil {
+		if *req.Limit < 1 || *req.Limit > 1000 {
+			writeKMSJSON(w, http.StatusBadRequest, map[string]any{
+				"__type":  "ValidationException",
+				"message": "Limit must be between 1 and 1000",
+			})
+			return
+		}
+		limit = int(*req.Limit)
+	}
+
+	page, err := h.Store.Query(r.Context(), resource.Query{
+		Service:   "kms",
+		Type:      "key",
+		Namespace: ns,
+		Limit:     limit,
+		Cursor:    req.Marker,
+	})
+	if errors.Is(err, resource.ErrInvalidCursor) {
+		writeKMSJSON(w, http.StatusBadRequest, map[string]any{
+			"__type":  "InvalidMarkerException",
+			"message": "Invalid marker: " + req.Marker,
+		})
+		return
+	}
 	if err != nil {
 		writeKMSJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalFailure",
@@ -262,8 +297,8 @@ func (h *Handler) ListKeys(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	keyList := make([]KeyMetadata, 0, len(keys))
-	for _, keyRes := range keys {
+	keyList := make([]KeyMetadata, 0, len(page.Resources))
+	for _, keyRes := range page.Resources {
 		var entry map[string]any
 		if err := json.Unmarshal(keyRes.Attributes, &entry); err != nil {
 			continue
@@ -278,9 +313,10 @@ func (h *Handler) ListKeys(w http.ResponseWriter, r *http.Request) {
 		keyList = append(keyList, keyMetadata)
 	}
 
-	writeKMSJSON(w, http.StatusOK, map[string]any{
-		"Keys":      keyList,
-		"Truncated": false,
+	writeKMSJSON(w, http.StatusOK, ListKeysOutput{
+		Keys:       keyList,
+		Truncated:  page.Next != "",
+		NextMarker: page.Next,
 	})
 }
 
@@ -315,7 +351,7 @@ func (h *Handler) GetKeyPolicy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get key from store
-	res, err := h.Store.Get(keyID, "kms", "key", ns)
+	res, err := h.Store.Get(r.Context(), keyID, "kms", "key", ns)
 	if err != nil {
 		writeKMSJSON(w, http.StatusNotFound, map[string]any{
 			"__type":  "NotFoundException",
@@ -348,7 +384,7 @@ func (h *Handler) GetKeyPolicy(w http.ResponseWriter, r *http.Request) {
       "Sid": "Enable IAM User Permissions",
       "Effect": "Allow",
       "Principal": {
-        "AWS": "arn:aws:iam::000000000000:root"
+        "AWS": "` + awsarn.FromContext(r.Context()).GlobalARN("iam", "root") + `"
       },
       "Action": "kms:*",
       "Resource": "*"
@@ -393,7 +429,7 @@ func (h *Handler) GetKeyRotationStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get key from store
-	res, err := h.Store.Get(keyID, "kms", "key", ns)
+	res, err := h.Store.Get(r.Context(), keyID, "kms", "key", ns)
 	if err != nil {
 		writeKMSJSON(w, http.StatusNotFound, map[string]any{
 			"__type":  "NotFoundException",
@@ -454,7 +490,7 @@ func (h *Handler) ListResourceTags(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get key from store
-	res, err := h.Store.Get(keyID, "kms", "key", ns)
+	res, err := h.Store.Get(r.Context(), keyID, "kms", "key", ns)
 	if err != nil {
 		writeKMSJSON(w, http.StatusNotFound, map[string]any{
 			"__type":  "NotFoundException",
@@ -538,7 +574,7 @@ func (h *Handler) ScheduleKeyDeletion(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get key from store
-	res, err := h.Store.Get(keyID, "kms", "key", ns)
+	_, err := h.Store.Get(r.Context(), keyID, "kms", "key", ns)
 	if err != nil {
 		writeKMSJSON(w, http.StatusNotFound, map[string]any{
 			"__type":  "NotFoundException",
@@ -558,28 +594,27 @@ func (h *Handler) ScheduleKeyDeletion(w http.ResponseWriter, r *http.Request) {
 	deletionDate := now.AddDate(0, 0, int(pendingWindowInDays))
 
 	// Update key entry with deletion date
-	var entry map[string]any
-	if err := json.Unmarshal(res.Attributes, &entry); err != nil {
-		writeKMSJSON(w, http.StatusInternalServerError, map[string]any{
-			"__type":  "InternalFailure",
-			"message": "Failed to decode key metadata",
-		})
-		return
-	}
+	_, err = h.Store.Mutate(r.Context(), keyID, "kms", "key", ns, func(res *resource.Resource) error {
+		var entry map[string]any
+		if err := json.Unmarshal(res.Attributes, &entry); err != nil {
+			return errors.New("failed to decode key metadata")
+		}
 
-	entry["deletion_date"] = float64(deletionDate.Unix())
-	entry["pending_window_in_days"] = pendingWindowInDays
+		entry["deletion_date"] = float64(deletionDate.Unix())
+		entry["pending_window_in_days"] = pendingWindowInDays
 
-	// Update key metadata state to PendingDeletion
-	keyMetadataBytes, _ := json.Marshal(entry["key_metadata"])
-	var keyMetadata KeyMetadata
-	json.Unmarshal(keyMetadataBytes, &keyMetadata)
-	keyMetadata.KeyState = "PendingDeletion"
-	entry["key_metadata"] = keyMetadata
+		// Update key metadata state to PendingDeletion
+		keyMetadataBytes, _ := json.Marshal(entry["key_metadata"])
+		var keyMetadata KeyMetadata
+		json.Unmarshal(keyMetadataBytes, &keyMetadata)
+		keyMetadata.KeyState = "PendingDeletion"
+		entry["key_metadata"] = keyMetadata
 
-	buf, _ := json.Marshal(entry)
-	res.Attributes = buf
-	if err := h.Store.Update(res); err != nil {
+		buf, _ := json.Marshal(entry)
+		res.Attributes = buf
+		return nil
+	})
+	if err != nil {
 		writeKMSJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalFailure",
 			"message": "Failed to schedule key deletion: " + err.Error(),
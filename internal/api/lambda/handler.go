@@ -5,25 +5,24 @@
 package lambda
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"opensnack/internal/awsarn"
 	"opensnack/internal/resource"
 	"opensnack/internal/util"
 
 	"opensnack/internal/awsresponses"
 )
 
-const (
-	lambdaRegion  = "us-east-1"
-	lambdaAccount = "000000000000"
-)
-
-func functionArn(name string) string {
-	return "arn:aws:lambda:" + lambdaRegion + ":" + lambdaAccount + ":function:" + name
+func functionArn(ctx context.Context, name string) string {
+	return awsarn.FromContext(ctx).ARN("lambda", "function:"+name)
 }
 
 // Helper to safely convert JSON numbers (float64) to int
@@ -94,7 +93,7 @@ func (h *Handler) Dispatch(w http.ResponseWriter, r *http.Request) {
 		// If target is empty, try to infer from path
 		if target == "" {
 			path := r.URL.Path
-			if r.Method == "POST" && (path == "/lambda/2015-03-31/functions" || path == "/lambda") {
+			if r.Method == "POST" && (strings.HasSuffix(path, "/2015-03-31/functions") || path == "/lambda") {
 				h.CreateFunction(w, r)
 				return
 			}
@@ -150,7 +149,7 @@ func (h *Handler) CreateFunction(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if function already exists (idempotent)
-	if existing, err := h.Store.Get(req.FunctionName, "lambda", "function", ns); err == nil {
+	if existing, err := h.Store.Get(r.Context(), req.FunctionName, "lambda", "function", ns); err == nil {
 		var attr map[string]any
 		json.Unmarshal(existing.Attributes, &attr)
 
@@ -161,7 +160,7 @@ func (h *Handler) CreateFunction(w http.ResponseWriter, r *http.Request) {
 
 		resp := map[string]any{
 			"FunctionName":    req.FunctionName,
-			"FunctionArn":     functionArn(req.FunctionName),
+			"FunctionArn":     functionArn(r.Context(), req.FunctionName),
 			"Runtime":         getString(attr, "runtime"),
 			"Role":            getString(attr, "role"),
 			"Handler":         getString(attr, "handler"),
@@ -248,7 +247,7 @@ func (h *Handler) CreateFunction(w http.ResponseWriter, r *http.Request) {
 		Attributes: buf,
 	}
 
-	if err := h.Store.Create(res); err != nil {
+	if err := h.Store.Create(r.Context(), res); err != nil {
 		awsresponses.WriteJSON(w, 500, map[string]any{
 			"__type":  "ServiceException",
 			"message": "Failed to create function: " + err.Error(),
@@ -258,7 +257,7 @@ func (h *Handler) CreateFunction(w http.ResponseWriter, r *http.Request) {
 	lastModified := now.Format(time.RFC3339)
 	resp := map[string]any{
 		"FunctionName":    req.FunctionName,
-		"FunctionArn":     functionArn(req.FunctionName),
+		"FunctionArn":     functionArn(r.Context(), req.FunctionName),
 		"Runtime":         req.Runtime,
 		"Role":            req.Role,
 		"Handler":         req.Handler,
@@ -331,7 +330,7 @@ func (h *Handler) GetFunction(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	res, err := h.Store.Get(req.FunctionName, "lambda", "function", ns)
+	res, err := h.Store.Get(r.Context(), req.FunctionName, "lambda", "function", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 404, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -350,7 +349,7 @@ func (h *Handler) GetFunction(w http.ResponseWriter, r *http.Request) {
 
 	configuration := map[string]any{
 		"FunctionName":    req.FunctionName,
-		"FunctionArn":     functionArn(req.FunctionName),
+		"FunctionArn":     functionArn(r.Context(), req.FunctionName),
 		"Runtime":         getString(attr, "runtime"),
 		"Role":            getString(attr, "role"),
 		"Handler":         getString(attr, "handler"),
@@ -410,7 +409,7 @@ func (h *Handler) DeleteFunction(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	_ = h.Store.Delete(req.FunctionName, "lambda", "function", ns)
+	_ = h.Store.Delete(r.Context(), req.FunctionName, "lambda", "function", ns)
 
 	w.WriteHeader(204)
 }
@@ -422,16 +421,44 @@ func (h *Handler) DeleteFunction(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) ListFunctions(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
-	items, err := h.Store.List("lambda", "function", ns)
+	// Marker and MaxItems arrive as query parameters
+	q := resource.Query{
+		Service:   "lambda",
+		Type:      "function",
+		Namespace: ns,
+		Limit:     50,
+		Cursor:    r.URL.Query().Get("Marker"),
+	}
+	if raw := r.URL.Query().Get("MaxItems"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 50 {
+			awsresponses.WriteJSON(w, 400, map[string]any{
+				"__type":  "InvalidParameterValueException",
+				"message": "MaxItems must be between 1 and 50",
+			})
+			return
+		}
+		q.Limit = n
+	}
+
+	page, err := h.Store.Query(r.Context(), q)
+	if errors.Is(err, resource.ErrInvalidCursor) {
+		awsresponses.WriteJSON(w, 400, map[string]any{
+			"__type":  "InvalidParameterValueException",
+			"message": "Invalid Marker: " + q.Cursor,
+		})
+		return
+	}
 	if err != nil {
 		awsresponses.WriteJSON(w, 500, map[string]any{
 			"__type":  "ServiceException",
 			"message": "Failed to list functions: " + err.Error(),
 		})
+		return
 	}
 
 	functions := make([]map[string]any, 0)
-	for _, item := range items {
+	for _, item := range page.Resources {
 		var attr map[string]any
 		json.Unmarshal(item.Attributes, &attr)
 
@@ -442,7 +469,7 @@ func (h *Handler) ListFunctions(w http.ResponseWriter, r *http.Request) {
 
 		fn := map[string]any{
 			"FunctionName":    item.ID,
-			"FunctionArn":     functionArn(item.ID),
+			"FunctionArn":     functionArn(r.Context(), item.ID),
 			"Runtime":         getString(attr, "runtime"),
 			"Role":            getString(attr, "role"),
 			"Handler":         getString(attr, "handler"),
@@ -471,6 +498,9 @@ func (h *Handler) ListFunctions(w http.ResponseWriter, r *http.Request) {
 	resp := map[string]any{
 		"Functions": functions,
 	}
+	if page.Next != "" {
+		resp["NextMarker"] = page.Next
+	}
 
 	awsresponses.WriteJSON(w, 200, resp)
 }
@@ -502,7 +532,7 @@ func (h *Handler) UpdateFunctionCode(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	res, err := h.Store.Get(req.FunctionName, "lambda", "function", ns)
+	_, err := h.Store.Get(r.Context(), req.FunctionName, "lambda", "function", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 404, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -511,9 +541,6 @@ func (h *Handler) UpdateFunctionCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var attr map[string]any
-	json.Unmarshal(res.Attributes, &attr)
-
 	// Update code info
 	codeSize := 0
 	codeSha256 := "fake-sha256-hash"
@@ -525,13 +552,19 @@ func (h *Handler) UpdateFunctionCode(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	attr["code_size"] = codeSize
-	attr["code_sha256"] = codeSha256
-	attr["last_modified"] = time.Now().UTC().Format(time.RFC3339)
+	var attr map[string]any
+	_, err = h.Store.Mutate(r.Context(), req.FunctionName, "lambda", "function", ns, func(res *resource.Resource) error {
+		attr = nil
+		json.Unmarshal(res.Attributes, &attr)
 
-	buf, _ := json.Marshal(attr)
-	res.Attributes = buf
-	if err := h.Store.Update(res); err != nil {
+		attr["code_size"] = codeSize
+		attr["code_sha256"] = codeSha256
+		attr["last_modified"] = time.Now().UTC().Format(time.RFC3339)
+
+		res.Attributes, _ = json.Marshal(attr)
+		return nil
+	})
+	if err != nil {
 		awsresponses.WriteJSON(w, 500, map[string]any{
 			"__type":  "ServiceException",
 			"message": "Failed to update function: " + err.Error(),
@@ -545,7 +578,7 @@ func (h *Handler) UpdateFunctionCode(w http.ResponseWriter, r *http.Request) {
 
 	resp := map[string]any{
 		"FunctionName":    req.FunctionName,
-		"FunctionArn":     functionArn(req.FunctionName),
+		"FunctionArn":     functionArn(r.Context(), req.FunctionName),
 		"Runtime":         getString(attr, "runtime"),
 		"Role":            getString(attr, "role"),
 		"Handler":         getString(attr, "handler"),
@@ -602,7 +635,7 @@ func (h *Handler) UpdateFunctionConfiguration(w http.ResponseWriter, r *http.Req
 		})
 	}
 
-	res, err := h.Store.Get(req.FunctionName, "lambda", "function", ns)
+	_, err := h.Store.Get(r.Context(), req.FunctionName, "lambda", "function", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 404, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -612,35 +645,38 @@ func (h *Handler) UpdateFunctionConfiguration(w http.ResponseWriter, r *http.Req
 	}
 
 	var attr map[string]any
-	json.Unmarshal(res.Attributes, &attr)
+	_, err = h.Store.Mutate(r.Context(), req.FunctionName, "lambda", "function", ns, func(res *resource.Resource) error {
+		attr = nil
+		json.Unmarshal(res.Attributes, &attr)
 
-	// Update only provided fields
-	if req.Role != "" {
-		attr["role"] = req.Role
-	}
-	if req.Handler != "" {
-		attr["handler"] = req.Handler
-	}
-	if req.Description != "" {
-		attr["description"] = req.Description
-	}
-	if req.Timeout > 0 {
-		attr["timeout"] = req.Timeout
-	}
-	if req.MemorySize > 0 {
-		attr["memory_size"] = req.MemorySize
-	}
-	if req.Environment != nil && req.Environment["Variables"] != nil {
-		if vars, ok := req.Environment["Variables"].(map[string]any); ok {
-			attr["environment"] = vars
+		// Update only provided fields
+		if req.Role != "" {
+			attr["role"] = req.Role
+		}
+		if req.Handler != "" {
+			attr["handler"] = req.Handler
+		}
+		if req.Description != "" {
+			attr["description"] = req.Description
+		}
+		if req.Timeout > 0 {
+			attr["timeout"] = req.Timeout
+		}
+		if req.MemorySize > 0 {
+			attr["memory_size"] = req.MemorySize
+		}
+		if req.Environment != nil && req.Environment["Variables"] != nil {
+			if vars, ok := req.Environment["Variables"].(map[string]any); ok {
+				attr["environment"] = vars
+			}
 		}
-	}
 
-	attr["last_modified"] = time.Now().UTC().Format(time.RFC3339)
+		attr["last_modified"] = time.Now().UTC().Format(time.RFC3339)
 
-	buf, _ := json.Marshal(attr)
-	res.Attributes = buf
-	if err := h.Store.Update(res); err != nil {
+		res.Attributes, _ = json.Marshal(attr)
+		return nil
+	})
+	if err != nil {
 		awsresponses.WriteJSON(w, 500, map[string]any{
 			"__type":  "ServiceException",
 			"message": "Failed to update function: " + err.Error(),
@@ -654,7 +690,7 @@ func (h *Handler) UpdateFunctionConfiguration(w http.ResponseWriter, r *http.Req
 
 	resp := map[string]any{
 		"FunctionName":    req.FunctionName,
-		"FunctionArn":     functionArn(req.FunctionName),
+		"FunctionArn":     functionArn(r.Context(), req.FunctionName),
 		"Runtime":         getString(attr, "runtime"),
 		"Role":            getString(attr, "role"),
 		"Handler":         getString(attr, "handler"),
@@ -727,7 +763,7 @@ func (h *Handler) ListTags(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	res, err := h.Store.Get(functionName, "lambda", "function", ns)
+	res, err := h.Store.Get(r.Context(), functionName, "lambda", "function", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 404, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -792,7 +828,7 @@ func (h *Handler) TagResource(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	res, err := h.Store.Get(functionName, "lambda", "function", ns)
+	_, err := h.Store.Get(r.Context(), functionName, "lambda", "function", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 404, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -801,24 +837,26 @@ func (h *Handler) TagResource(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var attr map[string]any
-	json.Unmarshal(res.Attributes, &attr)
+	_, err = h.Store.Mutate(r.Context(), functionName, "lambda", "function", ns, func(res *resource.Resource) error {
+		var attr map[string]any
+		json.Unmarshal(res.Attributes, &attr)
 
-	// Merge tags
-	existingTags, _ := attr["tags"].(map[string]any)
-	if existingTags == nil {
-		existingTags = make(map[string]any)
-	}
+		// Merge tags
+		existingTags, _ := attr["tags"].(map[string]any)
+		if existingTags == nil {
+			existingTags = make(map[string]any)
+		}
 
-	for k, v := range req.Tags {
-		existingTags[k] = v
-	}
+		for k, v := range req.Tags {
+			existingTags[k] = v
+		}
 
-	attr["tags"] = existingTags
+		attr["tags"] = existingTags
 
-	buf, _ := json.Marshal(attr)
-	res.Attributes = buf
-	if err := h.Store.Update(res); err != nil {
+		res.Attributes, _ = json.Marshal(attr)
+		return nil
+	})
+	if err != nil {
 		awsresponses.WriteJSON(w, 500, map[string]any{
 			"__type":  "ServiceException",
 			"message": "Failed to update function: " + err.Error(),
@@ -863,7 +901,7 @@ func (h *Handler) UntagResource(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	res, err := h.Store.Get(functionName, "lambda", "function", ns)
+	_, err := h.Store.Get(r.Context(), functionName, "lambda", "function", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 404, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -872,21 +910,23 @@ func (h *Handler) UntagResource(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var attr map[string]any
-	json.Unmarshal(res.Attributes, &attr)
+	_, err = h.Store.Mutate(r.Context(), functionName, "lambda", "function", ns, func(res *resource.Resource) error {
+		var attr map[string]any
+		json.Unmarshal(res.Attributes, &attr)
 
-	// Remove tags
-	existingTags, _ := attr["tags"].(map[string]any)
-	if existingTags != nil {
-		for _, key := range req.TagKeys {
-			delete(existingTags, key)
+		// Remove tags
+		existingTags, _ := attr["tags"].(map[string]any)
+		if existingTags != nil {
+			for _, key := range req.TagKeys {
+				delete(existingTags, key)
+			}
+			attr["tags"] = existingTags
 		}
-		attr["tags"] = existingTags
-	}
 
-	buf, _ := json.Marshal(attr)
-	res.Attributes = buf
-	if err := h.Store.Update(res); err != nil {
+		res.Attributes, _ = json.Marshal(attr)
+		return nil
+	})
+	if err != nil {
 		awsresponses.WriteJSON(w, 500, map[string]any{
 			"__type":  "ServiceException",
 			"message": "Failed to update function: " + err.Error(),
@@ -914,7 +954,7 @@ func (h *Handler) GetFunctionREST(w http.ResponseWriter, r *http.Request) {
 	}
 	ns := util.NamespaceFromHeader(r)
 
-	res, err := h.Store.Get(functionName, "lambda", "function", ns)
+	res, err := h.Store.Get(r.Context(), functionName, "lambda", "function", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 404, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -933,7 +973,7 @@ func (h *Handler) GetFunctionREST(w http.ResponseWriter, r *http.Request) {
 
 	configuration := map[string]any{
 		"FunctionName":    functionName,
-		"FunctionArn":     functionArn(functionName),
+		"FunctionArn":     functionArn(r.Context(), functionName),
 		"Runtime":         getString(attr, "runtime"),
 		"Role":            getString(attr, "role"),
 		"Handler":         getString(attr, "handler"),
@@ -983,7 +1023,7 @@ func (h *Handler) GetFunctionConfigurationREST(w http.ResponseWriter, r *http.Re
 	}
 	ns := util.NamespaceFromHeader(r)
 
-	res, err := h.Store.Get(functionName, "lambda", "function", ns)
+	res, err := h.Store.Get(r.Context(), functionName, "lambda", "function", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 404, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -1002,7 +1042,7 @@ func (h *Handler) GetFunctionConfigurationREST(w http.ResponseWriter, r *http.Re
 
 	resp := map[string]any{
 		"FunctionName":    functionName,
-		"FunctionArn":     functionArn(functionName),
+		"FunctionArn":     functionArn(r.Context(), functionName),
 		"Runtime":         getString(attr, "runtime"),
 		"Role":            getString(attr, "role"),
 		"Handler":         getString(attr, "handler"),
@@ -1041,7 +1081,7 @@ func (h *Handler) DeleteFunctionREST(w http.ResponseWriter, r *http.Request) {
 	}
 	ns := util.NamespaceFromHeader(r)
 
-	_ = h.Store.Delete(functionName, "lambda", "function", ns)
+	_ = h.Store.Delete(r.Context(), functionName, "lambda", "function", ns)
 
 	w.WriteHeader(204)
 }
@@ -1060,7 +1100,7 @@ func (h *Handler) ListVersionsByFunctionREST(w http.ResponseWriter, r *http.Requ
 	}
 	ns := util.NamespaceFromHeader(r)
 
-	res, err := h.Store.Get(functionName, "lambda", "function", ns)
+	res, err := h.Store.Get(r.Context(), functionName, "lambda", "function", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 404, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -1080,7 +1120,7 @@ func (h *Handler) ListVersionsByFunctionREST(w http.ResponseWriter, r *http.Requ
 	// Return $LATEST version
 	version := map[string]any{
 		"FunctionName":    functionName,
-		"FunctionArn":     functionArn(functionName),
+		"FunctionArn":     functionArn(r.Context(), functionName),
 		"Runtime":         getString(attr, "runtime"),
 		"Role":            getString(attr, "role"),
 		"Handler":         getString(attr, "handler"),
@@ -1125,7 +1165,7 @@ func (h *Handler) GetFunctionCodeSigningConfigREST(w http.ResponseWriter, r *htt
 	ns := util.NamespaceFromHeader(r)
 
 	// First check if function exists
-	_, err := h.Store.Get(functionName, "lambda", "function", ns)
+	_, err := h.Store.Get(r.Context(), functionName, "lambda", "function", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 404, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -1165,7 +1205,7 @@ func (h *Handler) GetFunctionCodeSigningConfig(w http.ResponseWriter, r *http.Re
 	}
 
 	// First check if function exists
-	_, err := h.Store.Get(req.FunctionName, "lambda", "function", ns)
+	_, err := h.Store.Get(r.Context(), req.FunctionName, "lambda", "function", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 404, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -1206,7 +1246,7 @@ func (h *Handler) ListVersionsByFunction(w http.ResponseWriter, r *http.Request)
 		})
 	}
 
-	res, err := h.Store.Get(req.FunctionName, "lambda", "function", ns)
+	res, err := h.Store.Get(r.Context(), req.FunctionName, "lambda", "function", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 404, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -1226,7 +1266,7 @@ func (h *Handler) ListVersionsByFunction(w http.ResponseWriter, r *http.Request)
 	// Return $LATEST version
 	version := map[string]any{
 		"FunctionName":    req.FunctionName,
-		"FunctionArn":     functionArn(req.FunctionName),
+		"FunctionArn":     functionArn(r.Context(), req.FunctionName),
 		"Runtime":         getString(attr, "runtime"),
 		"Role":            getString(attr, "role"),
 		"Handler":         getString(attr, "handler"),
@@ -33,8 +33,15 @@ type PutLogEventsResponse struct {
 }
 
 // DescribeLogGroups
+type DescribeLogGroupsRequest struct {
+	LogGroupNamePrefix string `json:"logGroupNamePrefix,omitempty"`
+	Limit              *int   `json:"limit,omitempty"`
+	NextToken          string `json:"nextToken,omitempty"`
+}
+
 type DescribeLogGroupsResponse struct {
 	LogGroups []LogGroupElement `json:"logGroups"`
+	NextToken string            `json:"nextToken,omitempty"`
 }
 
 type LogGroupElement struct {
@@ -44,8 +51,16 @@ type LogGroupElement struct {
 }
 
 // DescribeLogStreams
+type DescribeLogStreamsRequest struct {
+	LogGroupName        string `json:"logGroupName"`
+	LogStreamNamePrefix string `json:"logStreamNamePrefix,omitempty"`
+	Limit               *int   `json:"limit,omitempty"`
+	NextToken           string `json:"nextToken,omitempty"`
+}
+
 type DescribeLogStreamsResponse struct {
 	LogStreams []LogStreamElement `json:"logStreams"`
+	NextToken  string             `json:"nextToken,omitempty"`
 }
 
 type LogStreamElement struct {
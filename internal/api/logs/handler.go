@@ -5,28 +5,26 @@
 package logs
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"opensnack/internal/awsarn"
 	"opensnack/internal/awsresponses"
 	"opensnack/internal/resource"
 	"opensnack/internal/util"
 )
 
-const (
-	logsRegion  = "us-east-1"
-	logsAccount = "000000000000"
-)
-
-func LogGroupArn(name string) string {
-	return "arn:aws:logs:" + logsRegion + ":" + logsAccount + ":log-group:" + name + ":*"
+func LogGroupArn(ctx context.Context, name string) string {
+	return awsarn.FromContext(ctx).ARN("logs", "log-group:"+name+":*")
 }
 
-func LogStreamArn(group, stream string) string {
-	return "arn:aws:logs:" + logsRegion + ":" + logsAccount + ":log-group:" + group + ":log-stream:" + stream
+func LogStreamArn(ctx context.Context, group, stream string) string {
+	return awsarn.FromContext(ctx).ARN("logs", "log-group:"+group+":log-stream:"+stream)
 }
 
 type Handler struct {
@@ -94,7 +92,7 @@ func (h *Handler) CreateLogGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Idempotent
-	if _, err := h.Store.Get(logGroupName, "logs", "log_group", ns); err == nil {
+	if _, err := h.Store.Get(r.Context(), logGroupName, "logs", "log_group", ns); err == nil {
 		w.WriteHeader(200)
 		return
 	}
@@ -107,13 +105,13 @@ func (h *Handler) CreateLogGroup(w http.ResponseWriter, r *http.Request) {
 
 	entry := map[string]any{
 		"group":      logGroupName,
-		"arn":        LogGroupArn(logGroupName),
+		"arn":        LogGroupArn(r.Context(), logGroupName),
 		"tags":       tags,
 		"created_at": time.Now().UnixMilli(),
 	}
 
 	buf, _ := json.Marshal(entry)
-	err := h.Store.Create(&resource.Resource{
+	err := h.Store.Create(r.Context(), &resource.Resource{
 		ID:         logGroupName,
 		Namespace:  ns,
 		Service:    "logs",
@@ -135,11 +133,22 @@ func (h *Handler) CreateLogGroup(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) DescribeLogGroups(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
-	items, _ := h.Store.List("logs", "log_group", ns)
+	var req DescribeLogGroupsRequest
+	util.DecodeAWSJSON(r, &req)
+
+	page, ok := h.describePage(w, r, resource.Query{
+		Service:   "logs",
+		Type:      "log_group",
+		Namespace: ns,
+		IDPrefix:  req.LogGroupNamePrefix,
+	}, req.Limit, req.NextToken)
+	if !ok {
+		return
+	}
 
-	resp := DescribeLogGroupsResponse{LogGroups: []LogGroupElement{}}
+	resp := DescribeLogGroupsResponse{LogGroups: []LogGroupElement{}, NextToken: page.Next}
 
-	for _, it := range items {
+	for _, it := range page.Resources {
 		var attr map[string]any
 		json.Unmarshal(it.Attributes, &attr)
 
@@ -153,6 +162,37 @@ func (h *Handler) DescribeLogGroups(w http.ResponseWriter, r *http.Request) {
 	awsresponses.WriteJSON(w, 200, resp)
 }
 
+// describePage runs one page of a Describe* action. limit defaults to
+// 50; nextToken is the store cursor.
+func (h *Handler) describePage(w http.ResponseWriter, r *http.Request, q resource.Query, limit *int, nextToken string) (resource.Page, bool) {
+	q.Limit = 50
+	if limit != nil {
+		if *limit < 1 || *limit > 50 {
+			awsresponses.WriteJSON(w, 400, map[string]any{
+				"__type":  "InvalidParameterException",
+				"message": "limit must be between 1 and 50",
+			})
+			return resource.Page{}, false
+		}
+		q.Limit = *limit
+	}
+	q.Cursor = nextToken
+
+	page, err := h.Store.Query(r.Context(), q)
+	if errors.Is(err, resource.ErrInvalidCursor) {
+		awsresponses.WriteJSON(w, 400, map[string]any{
+			"__type":  "InvalidParameterException",
+			"message": "The specified nextToken is invalid.",
+		})
+		return resource.Page{}, false
+	}
+	if err != nil {
+		awsresponses.WriteJSON(w, 500, err.Error())
+		return resource.Page{}, false
+	}
+	return page, true
+}
+
 //
 // CreateLogStream
 //
@@ -176,12 +216,12 @@ func (h *Handler) CreateLogStream(w http.ResponseWriter, r *http.Request) {
 	entry := map[string]any{
 		"group":      req.LogGroupName,
 		"stream":     req.LogStreamName,
-		"arn":        LogStreamArn(req.LogGroupName, req.LogStreamName),
+		"arn":        LogStreamArn(r.Context(), req.LogGroupName, req.LogStreamName),
 		"created_at": time.Now().UnixMilli(),
 	}
 
 	buf, _ := json.Marshal(entry)
-	err := h.Store.Create(&resource.Resource{
+	err := h.Store.Create(r.Context(), &resource.Resource{
 		ID:         id,
 		Namespace:  ns,
 		Service:    "logs",
@@ -204,24 +244,26 @@ func (h *Handler) DescribeLogStreams(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
 	// AWS sends body: {"logGroupName":"X"}
-	var body struct {
-		LogGroupName string `json:"logGroupName"`
-	}
+	var body DescribeLogStreamsRequest
 	util.DecodeAWSJSON(r, &body)
 
-	items, _ := h.Store.List("logs", "log_stream", ns)
+	// Stream IDs are <group>/<stream>
+	page, ok := h.describePage(w, r, resource.Query{
+		Service:   "logs",
+		Type:      "log_stream",
+		Namespace: ns,
+		IDPrefix:  body.LogGroupName + "/" + body.LogStreamNamePrefix,
+	}, body.Limit, body.NextToken)
+	if !ok {
+		return
+	}
 
-	resp := DescribeLogStreamsResponse{LogStreams: []LogStreamElement{}}
+	resp := DescribeLogStreamsResponse{LogStreams: []LogStreamElement{}, NextToken: page.Next}
 
-	for _, it := range items {
+	for _, it := range page.Resources {
 		var attr map[string]any
 		json.Unmarshal(it.Attributes, &attr)
 
-		// filter by log group
-		if attr["group"].(string) != body.LogGroupName {
-			continue
-		}
-
 		resp.LogStreams = append(resp.LogStreams, LogStreamElement{
 			LogStreamName: attr["stream"].(string),
 			Arn:           attr["arn"].(string),
@@ -269,7 +311,7 @@ func (h *Handler) DeleteLogGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_ = h.Store.Delete(req.LogGroupName, "logs", "log_group", ns)
+	_ = h.Store.Delete(r.Context(), req.LogGroupName, "logs", "log_group", ns)
 
 	w.WriteHeader(200)
 }
@@ -296,7 +338,7 @@ func (h *Handler) DeleteLogStream(w http.ResponseWriter, r *http.Request) {
 	}
 
 	id := req.LogGroupName + "/" + req.LogStreamName
-	_ = h.Store.Delete(id, "logs", "log_stream", ns)
+	_ = h.Store.Delete(r.Context(), id, "logs", "log_stream", ns)
 
 	w.WriteHeader(200)
 }
@@ -359,7 +401,7 @@ func (h *Handler) ListTagsForResource(w http.ResponseWriter, r *http.Request) {
 		resourceID = namePart
 	}
 
-	res, err := h.Store.Get(resourceID, "logs", resourceType, ns)
+	res, err := h.Store.Get(r.Context(), resourceID, "logs", resourceType, ns)
 	if err != nil {
 		// Return empty tags if resource doesn't exist
 		awsresponses.WriteJSON(w, 200, map[string]any{
@@ -441,30 +483,32 @@ func (h *Handler) TagResource(w http.ResponseWriter, r *http.Request) {
 		resourceID = namePart
 	}
 
-	res, err := h.Store.Get(resourceID, "logs", resourceType, ns)
+	_, err := h.Store.Get(r.Context(), resourceID, "logs", resourceType, ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 404, "Resource not found")
 		return
 	}
 
-	var attr map[string]any
-	json.Unmarshal(res.Attributes, &attr)
+	_, err = h.Store.Mutate(r.Context(), resourceID, "logs", resourceType, ns, func(res *resource.Resource) error {
+		var attr map[string]any
+		json.Unmarshal(res.Attributes, &attr)
 
-	// Merge new tags with existing tags
-	existingTags, _ := attr["tags"].(map[string]any)
-	if existingTags == nil {
-		existingTags = make(map[string]any)
-	}
+		// Merge new tags with existing tags
+		existingTags, _ := attr["tags"].(map[string]any)
+		if existingTags == nil {
+			existingTags = make(map[string]any)
+		}
 
-	for k, v := range req.Tags {
-		existingTags[k] = v
-	}
+		for k, v := range req.Tags {
+			existingTags[k] = v
+		}
 
-	attr["tags"] = existingTags
+		attr["tags"] = existingTags
 
-	buf, _ := json.Marshal(attr)
-	res.Attributes = buf
-	if err := h.Store.Update(res); err != nil {
+		res.Attributes, _ = json.Marshal(attr)
+		return nil
+	})
+	if err != nil {
 		awsresponses.WriteJSON(w, 500, err.Error())
 		return
 	}
@@ -522,27 +566,29 @@ func (h *Handler) UntagResource(w http.ResponseWriter, r *http.Request) {
 		resourceID = namePart
 	}
 
-	res, err := h.Store.Get(resourceID, "logs", resourceType, ns)
+	_, err := h.Store.Get(r.Context(), resourceID, "logs", resourceType, ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 404, "Resource not found")
 		return
 	}
 
-	var attr map[string]any
-	json.Unmarshal(res.Attributes, &attr)
-
-	// Remove specified tag keys
-	existingTags, _ := attr["tags"].(map[string]any)
-	if existingTags != nil {
-		for _, key := range req.TagKeys {
-			delete(existingTags, key)
+	_, err = h.Store.Mutate(r.Context(), resourceID, "logs", resourceType, ns, func(res *resource.Resource) error {
+		var attr map[string]any
+		json.Unmarshal(res.Attributes, &attr)
+
+		// Remove specified tag keys
+		existingTags, _ := attr["tags"].(map[string]any)
+		if existingTags != nil {
+			for _, key := range req.TagKeys {
+				delete(existingTags, key)
+			}
+			attr["tags"] = existingTags
 		}
-		attr["tags"] = existingTags
-	}
 
-	buf, _ := json.Marshal(attr)
-	res.Attributes = buf
-	if err := h.Store.Update(res); err != nil {
+		res.Attributes, _ = json.Marshal(attr)
+		return nil
+	})
+	if err != nil {
 		awsresponses.WriteJSON(w, 500, err.Error())
 		return
 	}
@@ -6,6 +6,8 @@ package logs_test
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
@@ -13,64 +15,13 @@ import (
 
 	"opensnack/internal/api/logs"
 	"opensnack/internal/resource"
-
-	"github.com/labstack/echo/v4"
 )
 
-//
-// MockStore (same as other services)
-//
-
-type MockStore struct {
-	data map[string]resource.Resource
-}
-
-func NewMockStore() *MockStore {
-	return &MockStore{data: map[string]resource.Resource{}}
-}
-
-func key(id, ns string) string { return ns + "|" + id }
-
-func (m *MockStore) Create(r *resource.Resource) error {
-	m.data[key(r.ID, r.Namespace)] = *r
-	return nil
-}
-
-func (m *MockStore) Update(r *resource.Resource) error {
-	m.data[key(r.ID, r.Namespace)] = *r
-	return nil
-}
-
-func (m *MockStore) Get(id, s, t, ns string) (*resource.Resource, error) {
-	v, ok := m.data[key(id, ns)]
-	if !ok {
-		return nil, echo.NewHTTPError(404)
-	}
-	return &v, nil
-}
-
-func (m *MockStore) List(s, t, ns string) ([]resource.Resource, error) {
-	out := []resource.Resource{}
-	for _, r := range m.data {
-		if r.Service == s && r.Type == t && r.Namespace == ns {
-			out = append(out, r)
-		}
-	}
-	return out, nil
-}
-
-func (m *MockStore) Delete(id, s, t, ns string) error {
-	delete(m.data, key(id, ns))
-	return nil
-}
-
 //
 // Helpers
 //
 
-func ctx(method, target string, body *strings.Reader, targetHeader string) (echo.Context, *httptest.ResponseRecorder, *echo.Echo) {
-	e := echo.New()
-
+func ctx(method, target string, body *strings.Reader, targetHeader string) (*http.Request, *httptest.ResponseRecorder) {
 	if body == nil {
 		body = strings.NewReader("")
 	}
@@ -78,10 +29,10 @@ func ctx(method, target string, body *strings.Reader, targetHeader string) (echo
 	req := httptest.NewRequest(method, target, body)
 	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
 	req.Header.Set("X-Amz-Target", targetHeader)
-	req.Header.Set("X-Opensnack-Namespace", "ns1")
+	req.Header.Set("User-Agent", "opensnack-test custom-ns1")
 
 	rec := httptest.NewRecorder()
-	return e.NewContext(req, rec), rec, e
+	return req, rec
 }
 
 //
@@ -89,31 +40,31 @@ func ctx(method, target string, body *strings.Reader, targetHeader string) (echo
 //
 
 func TestCreateLogGroup(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := logs.NewHandler(store)
 
 	body := `{"logGroupName":"MyGroup"}`
-	c, rec, _ := ctx("POST", "/logs", strings.NewReader(body), "Logs_20140328.CreateLogGroup")
-	_ = h.Dispatch(c)
+	req, rec := ctx("POST", "/logs", strings.NewReader(body), "Logs_20140328.CreateLogGroup")
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
 	}
 
-	if _, err := store.Get("MyGroup", "logs", "log_group", "ns1"); err != nil {
+	if _, err := store.Get(t.Context(), "MyGroup", "logs", "log_group", "ns1"); err != nil {
 		t.Fatalf("log group not created")
 	}
 }
 
 func TestDescribeLogGroups(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := logs.NewHandler(store)
 
 	// seed
-	attrs := map[string]any{"group": "G1", "arn": logs.LogGroupArn("G1"), "created_at": time.Now().UnixMilli()}
+	attrs := map[string]any{"group": "G1", "arn": logs.LogGroupArn(t.Context(), "G1"), "created_at": time.Now().UnixMilli()}
 	buf, _ := json.Marshal(attrs)
 
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:         "G1",
 		Namespace:  "ns1",
 		Service:    "logs",
@@ -121,8 +72,8 @@ func TestDescribeLogGroups(t *testing.T) {
 		Attributes: buf,
 	})
 
-	c, rec, _ := ctx("POST", "/logs", strings.NewReader("{}"), "Logs_20140328.DescribeLogGroups")
-	_ = h.Dispatch(c)
+	req, rec := ctx("POST", "/logs", strings.NewReader("{}"), "Logs_20140328.DescribeLogGroups")
+	h.Dispatch(rec, req)
 
 	if !strings.Contains(rec.Body.String(), `"logGroupName":"G1"`) {
 		t.Fatalf("missing log group: %s", rec.Body.String())
@@ -130,38 +81,38 @@ func TestDescribeLogGroups(t *testing.T) {
 }
 
 func TestCreateLogStream(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := logs.NewHandler(store)
 
 	body := `{"logGroupName":"GroupA","logStreamName":"Stream1"}`
-	c, rec, _ := ctx("POST", "/logs", strings.NewReader(body), "Logs_20140328.CreateLogStream")
-	_ = h.Dispatch(c)
+	req, rec := ctx("POST", "/logs", strings.NewReader(body), "Logs_20140328.CreateLogStream")
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("got %d", rec.Code)
 	}
 
-	if _, err := store.Get("GroupA/Stream1", "logs", "log_stream", "ns1"); err != nil {
+	if _, err := store.Get(t.Context(), "GroupA/Stream1", "logs", "log_stream", "ns1"); err != nil {
 		t.Fatalf("log stream not created")
 	}
 }
 
 func TestDescribeLogStreams(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := logs.NewHandler(store)
 
-	attrs := map[string]any{"group": "G2", "stream": "S1", "arn": logs.LogStreamArn("G2", "S1"), "created_at": time.Now().UnixMilli()}
+	attrs := map[string]any{"group": "G2", "stream": "S1", "arn": logs.LogStreamArn(t.Context(), "G2", "S1"), "created_at": time.Now().UnixMilli()}
 	buf, _ := json.Marshal(attrs)
 
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID: "G2/S1", Namespace: "ns1",
 		Service: "logs", Type: "log_stream",
 		Attributes: buf,
 	})
 
 	body := `{"logGroupName":"G2"}`
-	c, rec, _ := ctx("POST", "/logs", strings.NewReader(body), "Logs_20140328.DescribeLogStreams")
-	_ = h.Dispatch(c)
+	req, rec := ctx("POST", "/logs", strings.NewReader(body), "Logs_20140328.DescribeLogStreams")
+	h.Dispatch(rec, req)
 
 	if !strings.Contains(rec.Body.String(), `"logStreamName":"S1"`) {
 		t.Fatalf("missing S1: %s", rec.Body.String())
@@ -169,13 +120,13 @@ func TestDescribeLogStreams(t *testing.T) {
 }
 
 func TestPutLogEvents(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := logs.NewHandler(store)
 
 	body := `{"logGroupName":"G1","logStreamName":"S1","logEvents":[{"timestamp":1,"message":"hi"}]}`
-	c, rec, _ := ctx("POST", "/logs", strings.NewReader(body), "Logs_20140328.PutLogEvents")
+	req, rec := ctx("POST", "/logs", strings.NewReader(body), "Logs_20140328.PutLogEvents")
 
-	_ = h.Dispatch(c)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
@@ -185,3 +136,68 @@ func TestPutLogEvents(t *testing.T) {
 		t.Fatalf("missing nextSequenceToken: %s", rec.Body.String())
 	}
 }
+
+func TestDescribeLogGroups_NextToken(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := logs.NewHandler(store)
+
+	for i := range 5 {
+		body := fmt.Sprintf(`{"logGroupName":"group%d"}`, i)
+		req, rec := ctx("POST", "/logs", strings.NewReader(body), "Logs_20140328.CreateLogGroup")
+		h.Dispatch(rec, req)
+		if rec.Code != 200 {
+			t.Fatalf("CreateLogGroup group%d: %d %s", i, rec.Code, rec.Body.String())
+		}
+	}
+
+	seen := map[string]bool{}
+	token := ""
+	for pages := 1; ; pages++ {
+		if pages > 5 {
+			t.Fatalf("paging did not terminate")
+		}
+
+		body, _ := json.Marshal(map[string]any{"limit": 2, "nextToken": token})
+		req, rec := ctx("POST", "/logs", strings.NewReader(string(body)), "Logs_20140328.DescribeLogGroups")
+		h.Dispatch(rec, req)
+
+		if rec.Code != 200 {
+			t.Fatalf("page %d: expected 200, got %d: %s", pages, rec.Code, rec.Body.String())
+		}
+
+		var resp logs.DescribeLogGroupsResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+
+		if len(resp.LogGroups) > 2 {
+			t.Fatalf("page %d has %d groups, limit is 2", pages, len(resp.LogGroups))
+		}
+		for _, g := range resp.LogGroups {
+			if seen[g.LogGroupName] {
+				t.Fatalf("group %s listed twice", g.LogGroupName)
+			}
+			seen[g.LogGroupName] = true
+		}
+
+		if resp.NextToken == "" {
+			break
+		}
+		token = resp.NextToken
+	}
+
+	if len(seen) != 5 {
+		t.Fatalf("expected 5 groups across pages, got %v", seen)
+	}
+}
+
+func TestDescribeLogGroups_InvalidNextToken(t *testing.T) {
+	h := logs.NewHandler(resource.NewMemoryStore())
+
+	req, rec := ctx("POST", "/logs", strings.NewReader(`{"nextToken":"bogus"}`), "Logs_20140328.DescribeLogGroups")
+	h.Dispatch(rec, req)
+
+	if rec.Code != 400 {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
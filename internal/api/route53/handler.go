@@ -5,11 +5,13 @@
 package route53
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,8 +23,7 @@ import (
 )
 
 const (
-	APIVersion     = "2013-04-01"
-	route53Account = "000000000000"
+	APIVersion = "2013-04-01"
 )
 
 type Handler struct {
@@ -37,7 +38,7 @@ func NewHandler(store resource.Store) *Handler {
 func hostedZoneID(name string) string {
 	// Route53 hosted zone IDs are random strings like Z1234567890ABC
 	// For simplicity, we'll generate a deterministic ID based on the name
-	return "Z" + util.DeterministicHex("hzone", 24)
+	return "Z" + util.DeterministicHex("hzone:"+name, 24)
 }
 
 // Build Route53 Change ID
@@ -198,7 +199,7 @@ func (h *Handler) CreateHostedZone(w http.ResponseWriter, r *http.Request) {
 	zoneID := hostedZoneID(name)
 
 	// Check if zone already exists (by ID)
-	_, err := h.Store.Get(zoneID, "route53", "hostedzone", ns)
+	_, err := h.Store.Get(r.Context(), zoneID, "route53", "hostedzone", ns)
 	if err == nil {
 		awsresponses.WriteErrorXML(w, http.StatusBadRequest, "HostedZoneAlreadyExists", "Hosted zone already exists: "+name, "")
 		return
@@ -245,13 +246,13 @@ func (h *Handler) CreateHostedZone(w http.ResponseWriter, r *http.Request) {
 		Attributes: buf,
 	}
 
-	if err := h.Store.Create(res); err != nil {
+	if err := h.Store.Create(r.Context(), res); err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusInternalServerError, "InternalFailure", "Failed to create hosted zone: "+err.Error(), "")
 		return
 	}
 
 	// Create default NS and SOA records
-	h.createDefaultRecords(zoneID, name, nameServers, ns)
+	h.createDefaultRecords(r.Context(), zoneID, name, nameServers, ns)
 
 	// Build Config from request
 	config := &HostedZoneConfig{}
@@ -288,7 +289,7 @@ func (h *Handler) CreateHostedZone(w http.ResponseWriter, r *http.Request) {
 }
 
 // createDefaultRecords creates default NS and SOA records for a hosted zone
-func (h *Handler) createDefaultRecords(zoneID, zoneName string, nameServers []string, ns string) {
+func (h *Handler) createDefaultRecords(ctx context.Context, zoneID, zoneName string, nameServers []string, ns string) {
 	// Create NS record
 	nsRecord := map[string]any{
 		"name":    zoneName,
@@ -305,7 +306,7 @@ func (h *Handler) createDefaultRecords(zoneID, zoneName string, nameServers []st
 		Type:       "record",
 		Attributes: nsBuf,
 	}
-	h.Store.Create(nsRes)
+	h.Store.Create(ctx, nsRes)
 
 	// Create SOA record
 	soaRecord := map[string]any{
@@ -323,7 +324,7 @@ func (h *Handler) createDefaultRecords(zoneID, zoneName string, nameServers []st
 		Type:       "record",
 		Attributes: soaBuf,
 	}
-	h.Store.Create(soaRes)
+	h.Store.Create(ctx, soaRes)
 }
 
 // GetHostedZone retrieves a hosted zone
@@ -365,7 +366,7 @@ func (h *Handler) GetHostedZone(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get hosted zone from store
-	res, err := h.Store.Get(zoneID, "route53", "hostedzone", ns)
+	res, err := h.Store.Get(r.Context(), zoneID, "route53", "hostedzone", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusNotFound, "NoSuchHostedZone", "Hosted zone not found: "+zoneID, "")
 		return
@@ -409,9 +410,7 @@ func (h *Handler) GetHostedZone(w http.ResponseWriter, r *http.Request) {
 		delegationSetID = "/delegationset/N" + util.DeterministicHex(zoneID, 12)
 		// Persist the generated ID back to storage
 		entry["delegation_set_id"] = delegationSetID
-		buf, _ := json.Marshal(entry)
-		res.Attributes = buf
-		h.Store.Update(res)
+		h.saveDelegationSetID(r.Context(), res, delegationSetID)
 	} else {
 		// Normalize format: ensure it has /delegationset/ prefix
 		// Handle both stored formats: "/delegationset/N..." and "N..."
@@ -428,9 +427,7 @@ func (h *Handler) GetHostedZone(w http.ResponseWriter, r *http.Request) {
 		// If we normalized it, persist back to storage
 		if originalID != delegationSetID {
 			entry["delegation_set_id"] = delegationSetID
-			buf, _ := json.Marshal(entry)
-			res.Attributes = buf
-			h.Store.Update(res)
+			h.saveDelegationSetID(r.Context(), res, delegationSetID)
 		}
 	}
 
@@ -465,15 +462,50 @@ func (h *Handler) GetHostedZone(w http.ResponseWriter, r *http.Request) {
 	awsresponses.WriteXML(w, output)
 }
 
-// ListHostedZones lists all hosted zones
+// saveDelegationSetID stores the normalised delegation set ID of a zone
+// that was created without one, or in an older format.
+func (h *Handler) saveDelegationSetID(ctx context.Context, zone *resource.Resource, id string) {
+	h.Store.Mutate(ctx, zone.ID, zone.Service, zone.Type, zone.Namespace, func(res *resource.Resource) error {
+		var entry map[string]any
+		if err := json.Unmarshal(res.Attributes, &entry); err != nil {
+			return err
+		}
+		entry["delegation_set_id"] = id
+		res.Attributes, _ = json.Marshal(entry)
+		return nil
+	})
+}
+
+// ListHostedZones lists hosted zones a page at a time, in zone ID order
 func (h *Handler) ListHostedZones(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
-	zones, err := h.Store.List("route53", "hostedzone", ns)
+	r.ParseForm()
+	marker := strings.TrimPrefix(r.FormValue("marker"), "/hostedzone/")
+	maxItems, ok := parseMaxItems(r.FormValue("maxitems"), 100)
+	if !ok {
+		awsresponses.WriteErrorXML(w, http.StatusBadRequest, "InvalidInput", "maxitems must be a positive integer", "")
+		return
+	}
+
+	// Fetch one extra zone: its ID is the next marker.
+	page, err := h.Store.Query(r.Context(), resource.Query{
+		Service:   "route53",
+		Type:      "hostedzone",
+		Namespace: ns,
+		StartID:   marker,
+		Limit:     maxItems + 1,
+	})
 	if err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusInternalServerError, "InternalFailure", "Failed to list hosted zones: "+err.Error(), "")
 		return
 	}
+	zones := page.Resources
+	nextMarker := ""
+	if len(zones) > maxItems {
+		nextMarker = zones[maxItems].ID
+		zones = zones[:maxItems]
+	}
 
 	var hostedZones []HostedZone
 	for _, zoneRes := range zones {
@@ -498,8 +530,10 @@ func (h *Handler) ListHostedZones(w http.ResponseWriter, r *http.Request) {
 			HostedZones: HostedZones{
 				HostedZone: hostedZones,
 			},
-			IsTruncated: false,
-			MaxItems:    fmt.Sprintf("%d", len(hostedZones)),
+			IsTruncated: nextMarker != "",
+			MaxItems:    fmt.Sprintf("%d", maxItems),
+			Marker:      r.FormValue("marker"),
+			NextMarker:  nextMarker,
 		},
 		ResponseMetadata: ResponseMetadata{
 			RequestID: awsresponses.NextRequestID(),
@@ -509,6 +543,19 @@ func (h *Handler) ListHostedZones(w http.ResponseWriter, r *http.Request) {
 	awsresponses.WriteXML(w, output)
 }
 
+// parseMaxItems reads a maxitems parameter, which defaults to def and is
+// capped at def as Route53 does.
+func parseMaxItems(raw string, def int) (int, bool) {
+	if raw == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return min(n, def), true
+}
+
 // ChangeResourceRecordSets creates or updates resource record sets
 func (h *Handler) ChangeResourceRecordSets(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
@@ -548,7 +595,7 @@ func (h *Handler) ChangeResourceRecordSets(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Verify zone exists
-	_, err := h.Store.Get(hostedZoneID, "route53", "hostedzone", ns)
+	_, err := h.Store.Get(r.Context(), hostedZoneID, "route53", "hostedzone", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusNotFound, "NoSuchHostedZone", "Hosted zone not found: "+hostedZoneID, "")
 		return
@@ -631,16 +678,16 @@ func (h *Handler) ChangeResourceRecordSets(w http.ResponseWriter, r *http.Reques
 		}
 
 		// Check if record exists
-		_, err := h.Store.Get(recordID, "route53", "record", ns)
+		_, err := h.Store.Get(r.Context(), recordID, "route53", "record", ns)
 		if err == nil {
 			// Update existing record
-			h.Store.Update(recordRes)
+			h.Store.Update(r.Context(), recordRes)
 		} else {
 			// Create new record
-			h.Store.Create(recordRes)
+			h.Store.Create(r.Context(), recordRes)
 		}
 	} else if action == "DELETE" {
-		h.Store.Delete(recordID, "route53", "record", ns)
+		h.Store.Delete(r.Context(), recordID, "route53", "record", ns)
 	}
 
 	changeID := changeID()
@@ -701,61 +748,58 @@ func (h *Handler) ListResourceRecordSets(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Verify zone exists
-	_, err := h.Store.Get(hostedZoneID, "route53", "hostedzone", ns)
+	_, err := h.Store.Get(r.Context(), hostedZoneID, "route53", "hostedzone", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusNotFound, "NoSuchHostedZone", "Hosted zone not found: "+hostedZoneID, "")
 		return
 	}
 
-	// Parse query parameters for filtering
+	// Records are stored as <zone>:<type>:<name>, so the zone's records
+	// share an ID prefix and a type and name pick a starting point.
 	r.ParseForm()
-	filterName := r.FormValue("name")
-	filterType := r.FormValue("type")
-	maxItemsStr := r.FormValue("maxitems")
-	maxItems := 0
-	if maxItemsStr != "" {
-		fmt.Sscanf(maxItemsStr, "%d", &maxItems)
+	startName := r.FormValue("name")
+	startType := r.FormValue("type")
+	if startName != "" && !strings.HasSuffix(startName, ".") {
+		startName = startName + "."
+	}
+	if startType != "" && startName == "" {
+		awsresponses.WriteErrorXML(w, http.StatusBadRequest, "InvalidInput", "The type parameter requires the name parameter", "")
+		return
+	}
+	maxItems, ok := parseMaxItems(r.FormValue("maxitems"), 300)
+	if !ok {
+		awsresponses.WriteErrorXML(w, http.StatusBadRequest, "InvalidInput", "maxitems must be a positive integer", "")
+		return
 	}
 
-	// Get all records for this zone
-	allRecords, err := h.Store.List("route53", "record", ns)
+	q := resource.Query{
+		Service:   "route53",
+		Type:      "record",
+		Namespace: ns,
+		IDPrefix:  hostedZoneID + ":",
+		Limit:     maxItems + 1,
+	}
+	if startType != "" {
+		q.StartID = hostedZoneID + ":" + startType + ":" + startName
+	} else if startName != "" {
+		q.Match = map[string]any{"name": startName}
+	}
+	page, err := h.Store.Query(r.Context(), q)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusInternalServerError, "InternalFailure", "Failed to list records: "+err.Error(), "")
 		return
 	}
 
 	var recordSets []ResourceRecordSet
-	for _, recordRes := range allRecords {
+	for _, recordRes := range page.Resources {
 		var entry map[string]any
 		if err := json.Unmarshal(recordRes.Attributes, &entry); err != nil {
 			continue
 		}
 
-		// Filter by zone ID
-		if entry["zone_id"].(string) != hostedZoneID {
-			continue
-		}
-
 		recordName := entry["name"].(string)
 		recordType := entry["type"].(string)
 
-		// Filter by name if provided
-		if filterName != "" {
-			// Normalize both names (ensure they end with dot)
-			normalizedFilterName := filterName
-			if !strings.HasSuffix(normalizedFilterName, ".") {
-				normalizedFilterName = normalizedFilterName + "."
-			}
-			if recordName != normalizedFilterName {
-				continue
-			}
-		}
-
-		// Filter by type if provided
-		if filterType != "" && recordType != filterType {
-			continue
-		}
-
 		var records []ResourceRecord
 		if recordValues, ok := entry["records"].([]string); ok {
 			for _, value := range recordValues {
@@ -779,23 +823,29 @@ func (h *Handler) ListResourceRecordSets(w http.ResponseWriter, r *http.Request)
 		}
 
 		recordSets = append(recordSets, recordSet)
+	}
 
-		// Apply maxItems limit if specified
-		if maxItems > 0 && len(recordSets) >= maxItems {
-			break
-		}
+	// The extra record fetched past maxItems is where the next page starts.
+	var next *ResourceRecordSet
+	if len(recordSets) > maxItems {
+		next = &recordSets[maxItems]
+		recordSets = recordSets[:maxItems]
 	}
 
 	output := ListResourceRecordSetsOutput{
 		ResourceRecordSets: ResourceRecordSets{
 			ResourceRecordSet: recordSets,
 		},
-		IsTruncated: false,
-		MaxItems:    fmt.Sprintf("%d", len(recordSets)),
+		IsTruncated: next != nil,
+		MaxItems:    fmt.Sprintf("%d", maxItems),
 		ResponseMetadata: ResponseMetadata{
 			RequestID: awsresponses.NextRequestID(),
 		},
 	}
+	if next != nil {
+		output.NextRecordName = next.Name
+		output.NextRecordType = next.Type
+	}
 
 	awsresponses.WriteXML(w, output)
 }
@@ -958,14 +1008,14 @@ func (h *Handler) DeleteHostedZone(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify zone exists
-	_, err := h.Store.Get(zoneID, "route53", "hostedzone", ns)
+	_, err := h.Store.Get(r.Context(), zoneID, "route53", "hostedzone", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusNotFound, "NoSuchHostedZone", "Hosted zone not found: "+zoneID, "")
 		return
 	}
 
 	// Delete the hosted zone
-	if err := h.Store.Delete(zoneID, "route53", "hostedzone", ns); err != nil {
+	if err := h.Store.Delete(r.Context(), zoneID, "route53", "hostedzone", ns); err != nil {
 		awsresponses.WriteErrorXML(w, http.StatusInternalServerError, "InternalFailure", "Failed to delete hosted zone: "+err.Error(), "")
 		return
 	}
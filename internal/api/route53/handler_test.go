@@ -0,0 +1,116 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package route53_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"opensnack/internal/api/route53"
+	"opensnack/internal/resource"
+)
+
+func newCtx(method, target, body string) (*http.Request, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("User-Agent", "opensnack-test custom-ns1")
+	return req, httptest.NewRecorder()
+}
+
+func createZone(t *testing.T, h *route53.Handler, name string) {
+	t.Helper()
+
+	body := fmt.Sprintf(`<CreateHostedZoneRequest xmlns="https://route53.amazonaws.com/doc/2013-04-01/">`+
+		`<Name>%s</Name><CallerReference>%s</CallerReference></CreateHostedZoneRequest>`, name, name)
+	req, rec := newCtx("POST", "/route53/2013-04-01/hostedzone", body)
+	h.Dispatch(rec, req)
+
+	if rec.Code != 200 && rec.Code != 201 {
+		t.Fatalf("CreateHostedZone %s: %d %s", name, rec.Code, rec.Body.String())
+	}
+}
+
+func TestListHostedZones_Marker(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := route53.NewHandler(store)
+
+	want := map[string]bool{}
+	for i := range 5 {
+		name := fmt.Sprintf("zone%d.example.com.", i)
+		createZone(t, h, name)
+		want[name] = true
+	}
+
+	seen := map[string]bool{}
+	marker := ""
+	for pages := 1; ; pages++ {
+		if pages > 5 {
+			t.Fatalf("paging did not terminate")
+		}
+
+		target := "/route53/2013-04-01/hostedzone?maxitems=2"
+		if marker != "" {
+			target += "&marker=" + url.QueryEscape(marker)
+		}
+		req, rec := newCtx("GET", target, "")
+		h.Dispatch(rec, req)
+
+		if rec.Code != 200 {
+			t.Fatalf("page %d: expected 200, got %d: %s", pages, rec.Code, rec.Body.String())
+		}
+
+		var resp route53.ListHostedZonesOutput
+		if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid XML: %v", err)
+		}
+		result := resp.ListHostedZonesResult
+
+		if len(result.HostedZones.HostedZone) > 2 {
+			t.Fatalf("page %d has %d zones, MaxItems is 2", pages, len(result.HostedZones.HostedZone))
+		}
+		for _, z := range result.HostedZones.HostedZone {
+			if seen[z.Name] {
+				t.Fatalf("zone %s listed twice", z.Name)
+			}
+			seen[z.Name] = true
+		}
+
+		if !result.IsTruncated {
+			if result.NextMarker != "" {
+				t.Fatalf("last page has NextMarker %q", result.NextMarker)
+			}
+			break
+		}
+		if result.NextMarker == "" {
+			t.Fatalf("page %d is truncated without a NextMarker", pages)
+		}
+		marker = result.NextMarker
+	}
+
+	if len(seen) != len(want) {
+		t.Fatalf("expected %d zones across pages, got %d: %v", len(want), len(seen), seen)
+	}
+	for name := range want {
+		if !seen[name] {
+			t.Fatalf("zone %s missing from pages", name)
+		}
+	}
+}
+
+func TestListHostedZones_BadMaxItems(t *testing.T) {
+	h := route53.NewHandler(resource.NewMemoryStore())
+
+	req, rec := newCtx("GET", "/route53/2013-04-01/hostedzone?maxitems=0", "")
+	h.Dispatch(rec, req)
+
+	if rec.Code != 400 {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
@@ -5,9 +5,11 @@
 package s3
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
@@ -25,7 +27,12 @@ import (
 // OBJECT ROOT
 //
 
-func objectRoot() string {
+// objectRoot returns h.ObjectRoot, falling back to OPENSNACK_OBJECT_ROOT
+// for handlers the router did not configure.
+func (h *Handler) objectRoot() string {
+	if h.ObjectRoot != "" {
+		return h.ObjectRoot
+	}
 	root := os.Getenv("OPENSNACK_OBJECT_ROOT")
 	if root == "" {
 		root = "/tmp/opensnack/objects"
@@ -33,8 +40,8 @@ func objectRoot() string {
 	return root
 }
 
-func objectPath(namespace, bucket, key string) string {
-	return filepath.Join(objectRoot(), namespace, bucket, key)
+func (h *Handler) objectPath(namespace, bucket, key string) string {
+	return filepath.Join(h.objectRoot(), namespace, bucket, key)
 }
 
 //
@@ -112,7 +119,7 @@ func (h *Handler) PutObject(w http.ResponseWriter, r *http.Request) {
 	bucket, key := extractBucketKey(r.URL.Path)
 
 	// 1️⃣ Check bucket exists FIRST (AWS behavior)
-	if _, err := h.Store.Get(bucket, "s3", "bucket", ns); err != nil {
+	if _, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns); err != nil {
 		w.WriteHeader(404)
 		awsresponses.WriteXML(w, NoSuchBucket(bucket))
 		return
@@ -132,44 +139,63 @@ func (h *Handler) PutObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 4️⃣ Write file
-	path := objectPath(ns, bucket, key)
-
-	if err := ensureParentDir(path); err != nil {
+	// 4️⃣ Write file and metadata
+	etag, err := h.storeObject(r.Context(), ns, bucket, key, bodyBytes)
+	if err != nil {
 		awsresponses.WriteJSON(w, 500, err.Error())
 		return
 	}
 
-	if err := os.WriteFile(path, bodyBytes, 0o644); err != nil {
-		awsresponses.WriteJSON(w, 500, err.Error())
-		return
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(200)
+}
+
+//
+// OBJECT WRITES FROM OTHER SERVICES
+//
+
+// ErrNoSuchBucket is returned by WriteObject when the bucket is missing.
+var ErrNoSuchBucket = errors.New("The specified bucket does not exist")
+
+// WriteObject stores an object on behalf of another service, such as a
+// DynamoDB table export, and returns its ETag.
+func (h *Handler) WriteObject(ctx context.Context, ns, bucket, key string, body []byte) (string, error) {
+	if _, err := h.Store.Get(ctx, bucket, "s3", "bucket", ns); err != nil {
+		return "", ErrNoSuchBucket
 	}
+	return h.storeObject(ctx, ns, bucket, key, body)
+}
 
-	etag := computeETag(bodyBytes)
-	contentType := detectContentType(bodyBytes, key)
+// storeObject writes the object file and its metadata.
+func (h *Handler) storeObject(ctx context.Context, ns, bucket, key string, body []byte) (string, error) {
+	path := h.objectPath(ns, bucket, key)
+	if err := ensureParentDir(path); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		return "", err
+	}
 
-	// 5️⃣ Store metadata
+	etag := computeETag(body)
 	meta := map[string]any{
 		"bucket":       bucket,
 		"key":          key,
 		"etag":         etag,
-		"content_type": contentType,
-		"size":         len(bodyBytes),
+		"content_type": detectContentType(body, key),
+		"size":         len(body),
 		"created_at":   time.Now().Format(time.RFC3339),
 	}
 
 	buf, _ := jsonMarshal(meta)
 
-	h.Store.Create(&resource.Resource{
+	h.Store.Create(ctx, &resource.Resource{
 		ID:         bucket + "/" + key,
 		Namespace:  ns,
 		Service:    "s3",
 		Type:       "object",
 		Attributes: buf,
 	})
-
-	w.Header().Set("ETag", etag)
-	w.WriteHeader(200)
+	return etag, nil
 }
 
 //
@@ -181,13 +207,13 @@ func (h *Handler) GetObject(w http.ResponseWriter, r *http.Request) {
 	bucket, key := extractBucketKey(r.URL.Path)
 
 	// Bucket exists?
-	if _, err := h.Store.Get(bucket, "s3", "bucket", ns); err != nil {
+	if _, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns); err != nil {
 		w.WriteHeader(404)
 		awsresponses.WriteXML(w, NoSuchBucket(bucket))
 		return
 	}
 
-	res, err := h.Store.Get(bucket+"/"+key, "s3", "object", ns)
+	res, err := h.Store.Get(r.Context(), bucket+"/"+key, "s3", "object", ns)
 	if err != nil {
 		w.WriteHeader(404)
 		awsresponses.WriteXML(w, NoSuchKey(bucket, key))
@@ -197,7 +223,7 @@ func (h *Handler) GetObject(w http.ResponseWriter, r *http.Request) {
 	var meta map[string]any
 	jsonUnmarshal(res.Attributes, &meta)
 
-	path := objectPath(ns, bucket, key)
+	path := h.objectPath(ns, bucket, key)
 	bodyBytes, err := os.ReadFile(path)
 	if err != nil {
 		w.WriteHeader(404)
@@ -224,13 +250,13 @@ func (h *Handler) HeadObject(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 	bucket, key := extractBucketKey(r.URL.Path)
 
-	if _, err := h.Store.Get(bucket, "s3", "bucket", ns); err != nil {
+	if _, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns); err != nil {
 		w.WriteHeader(404)
 		awsresponses.WriteXML(w, NoSuchBucket(bucket))
 		return
 	}
 
-	res, err := h.Store.Get(bucket+"/"+key, "s3", "object", ns)
+	res, err := h.Store.Get(r.Context(), bucket+"/"+key, "s3", "object", ns)
 	if err != nil {
 		w.WriteHeader(404)
 		awsresponses.WriteXML(w, NoSuchKey(bucket, key))
@@ -262,17 +288,17 @@ func (h *Handler) DeleteObject(w http.ResponseWriter, r *http.Request) {
 	// but deleting missing key in existing bucket returns 204 silently
 
 	// If bucket missing, S3 returns 404 NoSuchBucket for DELETE
-	if _, err := h.Store.Get(bucket, "s3", "bucket", ns); err != nil {
+	if _, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns); err != nil {
 		w.WriteHeader(404)
 		awsresponses.WriteXML(w, NoSuchBucket(bucket))
 		return
 	}
 
-	path := objectPath(ns, bucket, key)
+	path := h.objectPath(ns, bucket, key)
 	_ = os.Remove(path)
 
 	// Delete metadata even if missing
-	h.Store.Delete(bucket+"/"+key, "s3", "object", ns)
+	h.Store.Delete(r.Context(), bucket+"/"+key, "s3", "object", ns)
 
 	w.WriteHeader(204)
 }
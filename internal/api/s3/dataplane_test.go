@@ -7,76 +7,22 @@ package s3_test
 import (
 	"bytes"
 	"io"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
-	"github.com/labstack/echo/v4"
-
 	"opensnack/internal/api/s3"
 	"opensnack/internal/resource"
 )
 
-//
-// Mock Store (same pattern used for SNS/SQS/IAM)
-//
-
-// type MockStore struct {
-// 	data map[string]resource.Resource
-// }
-
-// func NewMockStore() *MockStore {
-// 	return &MockStore{
-// 		data: map[string]resource.Resource{},
-// 	}
-// }
-
-func key(id, ns string) string {
-	return ns + "|" + id
-}
-
-func (m *MockStore) Create(r *resource.Resource) error {
-	m.data[key(r.ID, r.Namespace)] = *r
-	return nil
-}
-
-func (m *MockStore) Update(r *resource.Resource) error {
-	m.data[key(r.ID, r.Namespace)] = *r
-	return nil
-}
-
-func (m *MockStore) Get(id, service, typ, ns string) (*resource.Resource, error) {
-	v, ok := m.data[key(id, ns)]
-	if !ok {
-		return nil, echo.NewHTTPError(404)
-	}
-	return &v, nil
-}
-
-func (m *MockStore) List(service, typ, ns string) ([]resource.Resource, error) {
-	var out []resource.Resource
-	for _, v := range m.data {
-		if v.Service == service && v.Type == typ && v.Namespace == ns {
-			out = append(out, v)
-		}
-	}
-	return out, nil
-}
-
-func (m *MockStore) Delete(id, service, typ, ns string) error {
-	delete(m.data, key(id, ns))
-	return nil
-}
-
 //
 // Test helpers
 //
 
-func newCtx(method, path string, body []byte) (echo.Context, *httptest.ResponseRecorder, *echo.Echo) {
-	e := echo.New()
-
+func newCtx(method, path string, body []byte) (*http.Request, *httptest.ResponseRecorder) {
 	var rdr io.Reader
 	if body == nil {
 		rdr = strings.NewReader("")
@@ -85,37 +31,18 @@ func newCtx(method, path string, body []byte) (echo.Context, *httptest.ResponseR
 	}
 
 	req := httptest.NewRequest(method, path, rdr)
+	req.Header.Set("User-Agent", "opensnack-test custom-ns1")
 	rec := httptest.NewRecorder()
-	req.Header.Set("X-Opensnack-Namespace", "ns1")
-
-	c := e.NewContext(req, rec)
-
-	// Infer bucket and key from the path: /bucket/key...
-	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
-
-	bucket := parts[0]
-	key := ""
-	if len(parts) > 1 {
-		key = parts[1]
-	}
 
-	c.SetParamNames("bucket", "*")
-	c.SetParamValues(bucket, key)
-
-	return c, rec, e
+	return req, rec
 }
 
-//
-// Test root directory (temporary)
-//
-
-func tempObjectRoot(t *testing.T) string {
-	dir, err := os.MkdirTemp("", "opensnack_s3_test_*")
-	if err != nil {
-		t.Fatalf("mktemp failed: %v", err)
-	}
-	t.Setenv("OPENSNACK_OBJECT_ROOT", dir)
-	return dir
+// newObjectHandler returns a handler writing objects under a fresh
+// temporary root, and that root.
+func newObjectHandler(t *testing.T, store resource.Store) (*s3.Handler, string) {
+	h := s3.NewHandler(store)
+	h.ObjectRoot = t.TempDir()
+	return h, h.ObjectRoot
 }
 
 //
@@ -123,28 +50,24 @@ func tempObjectRoot(t *testing.T) string {
 //
 
 func TestPutAndGetObject(t *testing.T) {
-	root := tempObjectRoot(t)
 
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 
 	// Create bucket metadata
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:        "mybucket",
 		Namespace: "ns1",
 		Service:   "s3",
 		Type:      "bucket",
 	})
 
-	h := s3.NewHandler(store)
+	h, root := newObjectHandler(t, store)
 
 	// PUT object
 	body := []byte("hello world")
-	c, rec, _ := newCtx("PUT", "/mybucket/hello.txt", body)
+	req, rec := newCtx("PUT", "/mybucket/hello.txt", body)
 
-	err := h.PutObject(c)
-	if err != nil {
-		t.Fatalf("PutObject error: %v", err)
-	}
+	h.PutObject(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
@@ -161,11 +84,8 @@ func TestPutAndGetObject(t *testing.T) {
 	}
 
 	// GET object
-	c2, rec2, _ := newCtx("GET", "/mybucket/hello.txt", nil)
-	err = h.GetObject(c2)
-	if err != nil {
-		t.Fatalf("GetObject error: %v", err)
-	}
+	req2, rec2 := newCtx("GET", "/mybucket/hello.txt", nil)
+	h.GetObject(rec2, req2)
 
 	if rec2.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec2.Code)
@@ -177,29 +97,25 @@ func TestPutAndGetObject(t *testing.T) {
 }
 
 func TestHeadObject(t *testing.T) {
-	tempObjectRoot(t)
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:        "bucket1",
 		Namespace: "ns1",
 		Service:   "s3",
 		Type:      "bucket",
 	})
 
-	h := s3.NewHandler(store)
+	h, _ := newObjectHandler(t, store)
 
 	// PUT first
 	body := []byte("abc123")
-	c, _, _ := newCtx("PUT", "/bucket1/x.txt", body)
-	h.PutObject(c)
+	req, rec := newCtx("PUT", "/bucket1/x.txt", body)
+	h.PutObject(rec, req)
 
 	// HEAD now
-	c2, rec2, _ := newCtx("HEAD", "/bucket1/x.txt", nil)
-	err := h.HeadObject(c2)
-	if err != nil {
-		t.Fatalf("HeadObject error: %v", err)
-	}
+	req2, rec2 := newCtx("HEAD", "/bucket1/x.txt", nil)
+	h.HeadObject(rec2, req2)
 
 	if rec2.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec2.Code)
@@ -215,22 +131,21 @@ func TestHeadObject(t *testing.T) {
 }
 
 func TestDeleteObject(t *testing.T) {
-	root := tempObjectRoot(t)
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:        "b1",
 		Namespace: "ns1",
 		Service:   "s3",
 		Type:      "bucket",
 	})
 
-	h := s3.NewHandler(store)
+	h, root := newObjectHandler(t, store)
 
 	// PUT object
 	body := []byte("zzz")
-	c, _, _ := newCtx("PUT", "/b1/a/b/c.txt", body)
-	h.PutObject(c)
+	req, rec := newCtx("PUT", "/b1/a/b/c.txt", body)
+	h.PutObject(rec, req)
 
 	path := filepath.Join(root, "ns1", "b1", "a", "b", "c.txt")
 
@@ -239,8 +154,8 @@ func TestDeleteObject(t *testing.T) {
 	}
 
 	// DELETE
-	c2, rec2, _ := newCtx("DELETE", "/b1/a/b/c.txt", nil)
-	h.DeleteObject(c2)
+	req2, rec2 := newCtx("DELETE", "/b1/a/b/c.txt", nil)
+	h.DeleteObject(rec2, req2)
 
 	if rec2.Code != 204 {
 		t.Fatalf("expected 204, got %d", rec2.Code)
@@ -253,64 +168,56 @@ func TestDeleteObject(t *testing.T) {
 }
 
 func TestNoSuchBucket(t *testing.T) {
-	tempObjectRoot(t)
-	store := NewMockStore()
-	h := s3.NewHandler(store)
+	store := resource.NewMemoryStore()
+	h, _ := newObjectHandler(t, store)
 
 	body := []byte("abc")
 
-	c, rec, _ := newCtx("PUT", "/idontexist/k.txt", body)
-	err := h.PutObject(c)
+	req, rec := newCtx("PUT", "/idontexist/k.txt", body)
+	h.PutObject(rec, req)
 
-	if err == nil {
-		// handler returned XML directly, not an error
-		if rec.Code != 404 {
-			t.Fatalf("expected 404 for NoSuchBucket; got %d", rec.Code)
-		}
+	if rec.Code != 404 {
+		t.Fatalf("expected 404 for NoSuchBucket; got %d", rec.Code)
 	}
 }
 
 func TestNoSuchKey(t *testing.T) {
-	tempObjectRoot(t)
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 
 	// Create bucket only
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:        "b2",
 		Namespace: "ns1",
 		Service:   "s3",
 		Type:      "bucket",
 	})
 
-	h := s3.NewHandler(store)
+	h, _ := newObjectHandler(t, store)
 
-	c, rec, _ := newCtx("GET", "/b2/nothing/here.txt", nil)
-	err := h.GetObject(c)
+	req, rec := newCtx("GET", "/b2/nothing/here.txt", nil)
+	h.GetObject(rec, req)
 
-	if err == nil {
-		if rec.Code != 404 {
-			t.Fatalf("expected 404 for missing key, got %d", rec.Code)
-		}
+	if rec.Code != 404 {
+		t.Fatalf("expected 404 for missing key, got %d", rec.Code)
 	}
 }
 
 func TestBinaryUpload(t *testing.T) {
-	root := tempObjectRoot(t)
 
-	store := NewMockStore()
-	store.Create(&resource.Resource{
+	store := resource.NewMemoryStore()
+	store.Create(t.Context(), &resource.Resource{
 		ID:        "binbucket",
 		Namespace: "ns1",
 		Service:   "s3",
 		Type:      "bucket",
 	})
 
-	h := s3.NewHandler(store)
+	h, root := newObjectHandler(t, store)
 
 	// Binary body
 	body := []byte{0x00, 0xFF, 0xAA, 0x55}
-	c, rec, _ := newCtx("PUT", "/binbucket/file.bin", body)
-	h.PutObject(c)
+	req, rec := newCtx("PUT", "/binbucket/file.bin", body)
+	h.PutObject(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200")
@@ -325,8 +232,8 @@ func TestBinaryUpload(t *testing.T) {
 	}
 
 	// GET and compare
-	c2, rec2, _ := newCtx("GET", "/binbucket/file.bin", nil)
-	h.GetObject(c2)
+	req2, rec2 := newCtx("GET", "/binbucket/file.bin", nil)
+	h.GetObject(rec2, req2)
 
 	if !bytes.Equal(rec2.Body.Bytes(), body) {
 		t.Fatalf("GET returned wrong binary data")
@@ -5,6 +5,7 @@
 package s3
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
@@ -23,10 +24,12 @@ import (
 
 type Handler struct {
 	Store resource.Store
+	// ObjectRoot is the directory object bodies are written under.
+	ObjectRoot string
 }
 
 func NewHandler(store resource.Store) *Handler {
-	return &Handler{store}
+	return &Handler{Store: store}
 }
 
 // extractBucketKey extracts bucket and key from URL path
@@ -66,7 +69,7 @@ func (h *Handler) CreateBucket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if exists already
-	_, err := h.Store.Get(bucket, "s3", "bucket", ns)
+	_, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns)
 	zap.L().Debug("CreateBucket: checking existence of bucket",
 		zap.String("bucket", bucket),
 		zap.String("namespace", ns),
@@ -102,7 +105,7 @@ func (h *Handler) CreateBucket(w http.ResponseWriter, r *http.Request) {
 			Attributes: buf,
 		}
 
-		if err := h.Store.Create(res); err != nil {
+		if err := h.Store.Create(r.Context(), res); err != nil {
 			awsresponses.WriteJSON(w, 500, err.Error())
 		}
 
@@ -140,7 +143,7 @@ func (h *Handler) CreateBucket(w http.ResponseWriter, r *http.Request) {
 		Attributes: buf,
 	}
 
-	if err := h.Store.Create(res); err != nil {
+	if err := h.Store.Create(r.Context(), res); err != nil {
 		awsresponses.WriteJSON(w, 500, err.Error())
 	}
 
@@ -161,7 +164,7 @@ func (h *Handler) DeleteBucket(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
 	// Delete even if not exists — AWS behavior is idempotent
-	_ = h.Store.Delete(bucket, "s3", "bucket", ns)
+	_ = h.Store.Delete(r.Context(), bucket, "s3", "bucket", ns)
 
 	awsresponses.WriteEmpty204(w)
 }
@@ -174,7 +177,7 @@ func (h *Handler) DeleteBucket(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) ListBuckets(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
-	items, err := h.Store.List("s3", "bucket", ns)
+	items, err := h.Store.List(r.Context(), "s3", "bucket", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, 500, err.Error())
 	}
@@ -195,6 +198,26 @@ func (h *Handler) ListBuckets(w http.ResponseWriter, r *http.Request) {
 	awsresponses.WriteXML(w, resp)
 }
 
+// setBucketAttribute stores value under key in a bucket's attributes,
+// or removes key if value is nil, without losing concurrent changes to
+// the bucket's other settings.
+func (h *Handler) setBucketAttribute(ctx context.Context, ns, bucket, key string, value any) error {
+	_, err := h.Store.Mutate(ctx, bucket, "s3", "bucket", ns, func(res *resource.Resource) error {
+		attr := make(map[string]any)
+		if len(res.Attributes) > 0 {
+			json.Unmarshal(res.Attributes, &attr)
+		}
+		if value == nil {
+			delete(attr, key)
+		} else {
+			attr[key] = value
+		}
+		res.Attributes, _ = json.Marshal(attr)
+		return nil
+	})
+	return err
+}
+
 //
 // ─── HEAD BUCKET ───────────────────────────────────────────────────────────────
 //
@@ -209,7 +232,7 @@ func (h *Handler) HeadBucket(w http.ResponseWriter, r *http.Request) {
 		zap.String("namespace", ns),
 	)
 
-	res, err := h.Store.Get(bucket, "s3", "bucket", ns)
+	res, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns)
 
 	if err != nil {
 		// Any error == bucket does not exist
@@ -248,7 +271,7 @@ func (h *Handler) GetBucketLocation(w http.ResponseWriter, r *http.Request) {
 	bucket, _ := extractBucketKey(r.URL.Path)
 	ns := util.NamespaceFromHeader(r)
 
-	_, err := h.Store.Get(bucket, "s3", "bucket", ns)
+	_, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns)
 	if err != nil {
 		awsresponses.WriteS3ErrorXML(
 			w,
@@ -277,7 +300,7 @@ func (h *Handler) PutBucketVersioning(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
 	// Check bucket exists
-	res, err := h.Store.Get(bucket, "s3", "bucket", ns)
+	_, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns)
 	if err != nil {
 		awsresponses.WriteS3ErrorXML(
 			w,
@@ -298,15 +321,7 @@ func (h *Handler) PutBucketVersioning(w http.ResponseWriter, r *http.Request) {
 	_ = xml.Unmarshal(bodyBytes, &versioningCfg)
 
 	// Update bucket attributes
-	attr := make(map[string]any)
-	if len(res.Attributes) > 0 {
-		json.Unmarshal(res.Attributes, &attr)
-	}
-	attr["versioning"] = versioningCfg.Status
-
-	buf, _ := json.Marshal(attr)
-	res.Attributes = buf
-	if err := h.Store.Update(res); err != nil {
+	if err := h.setBucketAttribute(r.Context(), ns, bucket, "versioning", versioningCfg.Status); err != nil {
 		awsresponses.WriteJSON(w, 500, err.Error())
 		return
 	}
@@ -324,7 +339,7 @@ func (h *Handler) GetBucketVersioning(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
 	// Check bucket exists
-	res, err := h.Store.Get(bucket, "s3", "bucket", ns)
+	res, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns)
 	if err != nil {
 		awsresponses.WriteS3ErrorXML(
 			w,
@@ -365,7 +380,7 @@ func (h *Handler) PutBucketLifecycleConfiguration(w http.ResponseWriter, r *http
 	ns := util.NamespaceFromHeader(r)
 
 	// Check bucket exists
-	res, err := h.Store.Get(bucket, "s3", "bucket", ns)
+	_, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns)
 	if err != nil {
 		awsresponses.WriteS3ErrorXML(
 			w,
@@ -384,14 +399,7 @@ func (h *Handler) PutBucketLifecycleConfiguration(w http.ResponseWriter, r *http
 
 	// Handle empty body - delete lifecycle configuration
 	if len(bodyBytes) == 0 {
-		attr := make(map[string]any)
-		if len(res.Attributes) > 0 {
-			json.Unmarshal(res.Attributes, &attr)
-		}
-		delete(attr, "lifecycle")
-		buf, _ := json.Marshal(attr)
-		res.Attributes = buf
-		if err := h.Store.Update(res); err != nil {
+		if err := h.setBucketAttribute(r.Context(), ns, bucket, "lifecycle", nil); err != nil {
 			awsresponses.WriteJSON(w, 500, err.Error())
 			return
 		}
@@ -416,14 +424,7 @@ func (h *Handler) PutBucketLifecycleConfiguration(w http.ResponseWriter, r *http
 
 	// Handle empty rules - delete lifecycle configuration
 	if len(lifecycleCfg.Rules) == 0 {
-		attr := make(map[string]any)
-		if len(res.Attributes) > 0 {
-			json.Unmarshal(res.Attributes, &attr)
-		}
-		delete(attr, "lifecycle")
-		buf, _ := json.Marshal(attr)
-		res.Attributes = buf
-		if err := h.Store.Update(res); err != nil {
+		if err := h.setBucketAttribute(r.Context(), ns, bucket, "lifecycle", nil); err != nil {
 			awsresponses.WriteJSON(w, 500, err.Error())
 			return
 		}
@@ -450,15 +451,7 @@ func (h *Handler) PutBucketLifecycleConfiguration(w http.ResponseWriter, r *http
 	}
 
 	// Update bucket attributes
-	attr := make(map[string]any)
-	if len(res.Attributes) > 0 {
-		json.Unmarshal(res.Attributes, &attr)
-	}
-	attr["lifecycle"] = lifecycleData
-
-	buf, _ := json.Marshal(attr)
-	res.Attributes = buf
-	if err := h.Store.Update(res); err != nil {
+	if err := h.setBucketAttribute(r.Context(), ns, bucket, "lifecycle", lifecycleData); err != nil {
 		awsresponses.WriteJSON(w, 500, err.Error())
 	}
 
@@ -475,7 +468,7 @@ func (h *Handler) GetBucketLifecycleConfiguration(w http.ResponseWriter, r *http
 	ns := util.NamespaceFromHeader(r)
 
 	// Check bucket exists
-	res, err := h.Store.Get(bucket, "s3", "bucket", ns)
+	res, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns)
 	if err != nil {
 		awsresponses.WriteS3ErrorXML(
 			w,
@@ -599,7 +592,7 @@ func (h *Handler) PutBucketAcl(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
 	// Check bucket exists
-	res, err := h.Store.Get(bucket, "s3", "bucket", ns)
+	_, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns)
 	if err != nil {
 		awsresponses.WriteS3ErrorXML(
 			w,
@@ -647,15 +640,7 @@ func (h *Handler) PutBucketAcl(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update bucket attributes
-	attr := make(map[string]any)
-	if len(res.Attributes) > 0 {
-		json.Unmarshal(res.Attributes, &attr)
-	}
-	attr["acl"] = acl
-
-	buf, _ := json.Marshal(attr)
-	res.Attributes = buf
-	if err := h.Store.Update(res); err != nil {
+	if err := h.setBucketAttribute(r.Context(), ns, bucket, "acl", acl); err != nil {
 		awsresponses.WriteJSON(w, 500, err.Error())
 	}
 
@@ -672,7 +657,7 @@ func (h *Handler) PutBucketPolicy(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
 	// Check bucket exists
-	res, err := h.Store.Get(bucket, "s3", "bucket", ns)
+	_, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusNotFound, map[string]any{
 			"Code":    "NoSuchBucket",
@@ -702,15 +687,7 @@ func (h *Handler) PutBucketPolicy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update bucket attributes
-	attr := make(map[string]any)
-	if len(res.Attributes) > 0 {
-		json.Unmarshal(res.Attributes, &attr)
-	}
-	attr["policy"] = string(bodyBytes)
-
-	buf, _ := json.Marshal(attr)
-	res.Attributes = buf
-	if err := h.Store.Update(res); err != nil {
+	if err := h.setBucketAttribute(r.Context(), ns, bucket, "policy", string(bodyBytes)); err != nil {
 		awsresponses.WriteJSON(w, 500, err.Error())
 		return
 	}
@@ -728,7 +705,7 @@ func (h *Handler) GetBucketPolicy(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
 	// Check bucket exists
-	res, err := h.Store.Get(bucket, "s3", "bucket", ns)
+	res, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns)
 	if err != nil {
 		awsresponses.WriteS3ErrorXML(
 			w,
@@ -773,7 +750,7 @@ func (h *Handler) GetBucketAcl(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
 	// Check bucket exists
-	res, err := h.Store.Get(bucket, "s3", "bucket", ns)
+	res, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns)
 	if err != nil {
 		awsresponses.WriteS3ErrorXML(
 			w,
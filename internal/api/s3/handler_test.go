@@ -7,23 +7,21 @@ package s3_test
 import (
 	"encoding/json"
 	"net/http/httptest"
-	"opensnack/internal/api/s3"
-	"opensnack/internal/resource"
 	"testing"
 	"time"
 
-	"github.com/labstack/echo/v4"
+	"opensnack/internal/api/s3"
+	"opensnack/internal/resource"
 )
 
 func TestCreateBucket_AlreadyExists(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := s3.NewHandler(store)
-	e := echo.New()
 
 	// Precreate bucket
 	entry := s3.BucketEntry{Name: "dup", CreationDate: time.Now()}
 	buf, _ := json.Marshal(entry)
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:         "dup",
 		Namespace:  "ns1",
 		Service:    "s3",
@@ -32,17 +30,10 @@ func TestCreateBucket_AlreadyExists(t *testing.T) {
 	})
 
 	req := httptest.NewRequest("PUT", "/dup", nil)
-	req.Header.Set("X-Opensnack-Namespace", "ns1")
+	req.Header.Set("User-Agent", "opensnack-test custom-ns1")
 	rec := httptest.NewRecorder()
 
-	c := e.NewContext(req, rec)
-	c.SetParamNames("bucket")
-	c.SetParamValues("dup")
-
-	err := h.CreateBucket(c)
-	if err != nil {
-		t.Fatal(err)
-	}
+	h.CreateBucket(rec, req)
 
 	if rec.Code != 409 {
 		t.Fatalf("expected 409, got %d", rec.Code)
@@ -50,19 +41,14 @@ func TestCreateBucket_AlreadyExists(t *testing.T) {
 }
 
 func TestHeadBucket_NotExists(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := s3.NewHandler(store)
-	e := echo.New()
 
 	req := httptest.NewRequest("HEAD", "/ghost", nil)
-	req.Header.Set("X-Opensnack-Namespace", "ns1")
+	req.Header.Set("User-Agent", "opensnack-test custom-ns1")
 	rec := httptest.NewRecorder()
 
-	c := e.NewContext(req, rec)
-	c.SetParamNames("bucket")
-	c.SetParamValues("ghost")
-
-	_ = h.HeadBucket(c)
+	h.HeadBucket(rec, req)
 
 	if rec.Code != 404 {
 		t.Fatalf("expected 404, got %d", rec.Code)
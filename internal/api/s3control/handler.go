@@ -84,7 +84,7 @@ func (h *Handler) ListTagsForResource(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
 	// Look up tags in the bucket’s resource entry
-	res, err := h.Store.Get(bucket, "s3", "bucket", ns)
+	res, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns)
 	if err != nil {
 		// Return empty tagset — AWS does this
 		w.WriteHeader(200)
@@ -145,7 +145,7 @@ func (h *Handler) PutBucketTagging(w http.ResponseWriter, r *http.Request) {
 	parts := strings.SplitN(path, "/", 2)
 	bucket := parts[0]
 
-	res, err := h.Store.Get(bucket, "s3", "bucket", ns)
+	_, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns)
 	if err != nil {
 		w.WriteHeader(404)
 		awsresponses.WriteXML(w, s3.NoSuchBucket(bucket))
@@ -162,14 +162,16 @@ func (h *Handler) PutBucketTagging(w http.ResponseWriter, r *http.Request) {
 		tagMap[t.Key] = t.Value
 	}
 
-	// Load attributes
-	var attrs map[string]any
-	json.Unmarshal(res.Attributes, &attrs)
-	attrs["tags"] = tagMap
+	_, err = h.Store.Mutate(r.Context(), bucket, "s3", "bucket", ns, func(res *resource.Resource) error {
+		// Load attributes
+		var attrs map[string]any
+		json.Unmarshal(res.Attributes, &attrs)
+		attrs["tags"] = tagMap
 
-	buf, _ := json.Marshal(attrs)
-	res.Attributes = buf
-	if err := h.Store.Update(res); err != nil {
+		res.Attributes, _ = json.Marshal(attrs)
+		return nil
+	})
+	if err != nil {
 		awsresponses.WriteJSON(w, 500, err.Error())
 		return
 	}
@@ -184,7 +186,7 @@ func (h *Handler) GetBucketTagging(w http.ResponseWriter, r *http.Request) {
 	parts := strings.SplitN(path, "/", 2)
 	bucket := parts[0]
 
-	res, err := h.Store.Get(bucket, "s3", "bucket", ns)
+	res, err := h.Store.Get(r.Context(), bucket, "s3", "bucket", ns)
 	if err != nil {
 		w.WriteHeader(404)
 		awsresponses.WriteXML(w, s3.NoSuchBucket(bucket))
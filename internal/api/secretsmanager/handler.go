@@ -5,11 +5,14 @@
 package secretsmanager
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
+	"opensnack/internal/awsarn"
 	"opensnack/internal/awsresponses"
 	"opensnack/internal/resource"
 	"opensnack/internal/util"
@@ -18,9 +21,7 @@ import (
 )
 
 const (
-	APIVersion     = "2017-10-17"
-	secretsRegion  = "us-east-1"
-	secretsAccount = "000000000000"
+	APIVersion = "2017-10-17"
 )
 
 type Handler struct {
@@ -32,11 +33,11 @@ func NewHandler(store resource.Store) *Handler {
 }
 
 // Build SecretsManager ARN
-func secretArn(secretName string) string {
+func secretArn(ctx context.Context, secretName string) string {
 	// AWS SecretsManager ARN format: arn:aws:secretsmanager:region:account:secret:name-6RandomChars
 	// For simplicity, we'll use a deterministic approach based on the name
 	suffix := util.RandomHex(3)
-	return "arn:aws:secretsmanager:" + secretsRegion + ":" + secretsAccount + ":secret:" + secretName + "-" + suffix
+	return awsarn.FromContext(ctx).ARN("secretsmanager", "secret:"+secretName+"-"+suffix)
 }
 
 // writeSecretsJSON writes JSON response with SecretsManager-specific Content-Type
@@ -138,7 +139,7 @@ func (h *Handler) CreateSecret(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if secret already exists
-	_, err := h.Store.Get(req.Name, "secretsmanager", "secret", ns)
+	_, err := h.Store.Get(r.Context(), req.Name, "secretsmanager", "secret", ns)
 	if err == nil {
 		writeSecretsJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "ResourceExistsException",
@@ -149,7 +150,7 @@ func (h *Handler) CreateSecret(w http.ResponseWriter, r *http.Request) {
 
 	now := time.Now().UTC()
 	createdDate := float64(now.Unix())
-	arn := secretArn(req.Name)
+	arn := secretArn(r.Context(), req.Name)
 	versionId := uuid.New().String()
 
 	// Store secret metadata
@@ -193,7 +194,7 @@ func (h *Handler) CreateSecret(w http.ResponseWriter, r *http.Request) {
 		Attributes: buf,
 	}
 
-	if err := h.Store.Create(res); err != nil {
+	if err := h.Store.Create(r.Context(), res); err != nil {
 		writeSecretsJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalFailure",
 			"message": "Failed to create secret: " + err.Error(),
@@ -234,7 +235,7 @@ func (h *Handler) DescribeSecret(w http.ResponseWriter, r *http.Request) {
 	secretName := extractSecretName(req.SecretId)
 
 	// Get secret from store
-	res, err := h.Store.Get(secretName, "secretsmanager", "secret", ns)
+	res, err := h.Store.Get(r.Context(), secretName, "secretsmanager", "secret", ns)
 	if err != nil {
 		writeSecretsJSON(w, http.StatusNotFound, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -295,7 +296,7 @@ func (h *Handler) GetSecretValue(w http.ResponseWriter, r *http.Request) {
 	secretName := extractSecretName(req.SecretId)
 
 	// Get secret from store
-	res, err := h.Store.Get(secretName, "secretsmanager", "secret", ns)
+	res, err := h.Store.Get(r.Context(), secretName, "secretsmanager", "secret", ns)
 	if err != nil {
 		writeSecretsJSON(w, http.StatusNotFound, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -400,7 +401,7 @@ func (h *Handler) PutSecretValue(w http.ResponseWriter, r *http.Request) {
 	secretName := extractSecretName(req.SecretId)
 
 	// Get secret from store
-	res, err := h.Store.Get(secretName, "secretsmanager", "secret", ns)
+	_, err := h.Store.Get(r.Context(), secretName, "secretsmanager", "secret", ns)
 	if err != nil {
 		writeSecretsJSON(w, http.StatusNotFound, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -409,15 +410,6 @@ func (h *Handler) PutSecretValue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var entry map[string]any
-	if err := json.Unmarshal(res.Attributes, &entry); err != nil {
-		writeSecretsJSON(w, http.StatusInternalServerError, map[string]any{
-			"__type":  "InternalFailure",
-			"message": "Failed to decode secret metadata",
-		})
-		return
-	}
-
 	now := time.Now().UTC()
 	versionId := uuid.New().String()
 	versionStages := req.VersionStages
@@ -425,41 +417,51 @@ func (h *Handler) PutSecretValue(w http.ResponseWriter, r *http.Request) {
 		versionStages = []string{"AWSCURRENT"}
 	}
 
-	// Create new version entry
-	versionEntry := map[string]any{
-		"version_id":     versionId,
-		"secret_string":  req.SecretString,
-		"secret_binary":  req.SecretBinary,
-		"created_date":   float64(now.Unix()),
-		"version_stages": versionStages,
-	}
+	// Add the version in one Mutate so concurrent PutSecretValue calls
+	// cannot drop each other's versions
+	var entry map[string]any
+	_, err = h.Store.Mutate(r.Context(), secretName, "secretsmanager", "secret", ns, func(res *resource.Resource) error {
+		entry = nil
+		if err := json.Unmarshal(res.Attributes, &entry); err != nil {
+			return errors.New("failed to decode secret metadata")
+		}
 
-	// Update versions map
-	versions, ok := entry["versions"].(map[string]any)
-	if !ok {
-		versions = make(map[string]any)
-		entry["versions"] = versions
-	}
-	versions[versionId] = versionEntry
+		// Create new version entry
+		versionEntry := map[string]any{
+			"version_id":     versionId,
+			"secret_string":  req.SecretString,
+			"secret_binary":  req.SecretBinary,
+			"created_date":   float64(now.Unix()),
+			"version_stages": versionStages,
+		}
 
-	// Update current version
-	entry["current_version"] = versionEntry
+		// Update versions map
+		versions, ok := entry["versions"].(map[string]any)
+		if !ok {
+			versions = make(map[string]any)
+			entry["versions"] = versions
+		}
+		versions[versionId] = versionEntry
 
-	// Update version_ids_to_stages
-	versionIdsToStages, ok := entry["version_ids_to_stages"].(map[string][]string)
-	if !ok {
-		versionIdsToStages = make(map[string][]string)
-		entry["version_ids_to_stages"] = versionIdsToStages
-	}
-	versionIdsToStages[versionId] = versionStages
+		// Update current version
+		entry["current_version"] = versionEntry
 
-	// Update last changed date
-	entry["last_changed_date"] = float64(now.Unix())
+		// Update version_ids_to_stages
+		versionIdsToStages, ok := entry["version_ids_to_stages"].(map[string][]string)
+		if !ok {
+			versionIdsToStages = make(map[string][]string)
+			entry["version_ids_to_stages"] = versionIdsToStages
+		}
+		versionIdsToStages[versionId] = versionStages
 
-	// Save updated secret
-	buf, _ := json.Marshal(entry)
-	res.Attributes = buf
-	if err := h.Store.Update(res); err != nil {
+		// Update last changed date
+		entry["last_changed_date"] = float64(now.Unix())
+
+		buf, _ := json.Marshal(entry)
+		res.Attributes = buf
+		return nil
+	})
+	if err != nil {
 		writeSecretsJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalFailure",
 			"message": "Failed to update secret: " + err.Error(),
@@ -477,11 +479,52 @@ func (h *Handler) PutSecretValue(w http.ResponseWriter, r *http.Request) {
 	writeSecretsJSON(w, http.StatusOK, output)
 }
 
-// ListSecrets lists all secrets
+// ListSecrets lists secrets a page at a time
 func (h *Handler) ListSecrets(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
-	secrets, err := h.Store.List("secretsmanager", "secret", ns)
+	var req ListSecretsInput
+	if err := util.DecodeAWSJSON(r, &req); err != nil {
+		writeSecretsJSON(w, http.StatusBadRequest, map[string]any{
+			"__type":  "InvalidParameterException",
+			"message": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	q := resource.Query{
+		Service:   "secretsmanager",
+		Type:      "secret",
+		Namespace: ns,
+		Limit:     100,
+		Cursor:    req.NextToken,
+	}
+	if req.MaxResults != 0 {
+		if req.MaxResults < 1 || req.MaxResults > 100 {
+			writeSecretsJSON(w, http.StatusBadRequest, map[string]any{
+				"__type":  "InvalidParameterException",
+				"message": "MaxResults must be between 1 and 100",
+			})
+			return
+		}
+		q.Limit = int(req.MaxResults)
+	}
+	// A single name filter is a prefix of the secret name, which is
+	// its resource ID.
+	for _, f := range req.Filters {
+		if f.Key == "name" && len(f.Values) == 1 && !strings.HasPrefix(f.Values[0], "!") {
+			q.IDPrefix = f.Values[0]
+		}
+	}
+
+	page, err := h.Store.Query(r.Context(), q)
+	if errors.Is(err, resource.ErrInvalidCursor) {
+		writeSecretsJSON(w, http.StatusBadRequest, map[string]any{
+			"__type":  "InvalidNextTokenException",
+			"message": "The NextToken value is invalid.",
+		})
+		return
+	}
 	if err != nil {
 		writeSecretsJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalFailure",
@@ -490,8 +533,8 @@ func (h *Handler) ListSecrets(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	secretList := make([]SecretListEntry, 0, len(secrets))
-	for _, secretRes := range secrets {
+	secretList := make([]SecretListEntry, 0, len(page.Resources))
+	for _, secretRes := range page.Resources {
 		var entry map[string]any
 		if err := json.Unmarshal(secretRes.Attributes, &entry); err != nil {
 			continue
@@ -518,6 +561,7 @@ func (h *Handler) ListSecrets(w http.ResponseWriter, r *http.Request) {
 
 	writeSecretsJSON(w, http.StatusOK, ListSecretsOutput{
 		SecretList: secretList,
+		NextToken:  page.Next,
 	})
 }
 
@@ -545,7 +589,7 @@ func (h *Handler) DeleteSecret(w http.ResponseWriter, r *http.Request) {
 	secretName := extractSecretName(req.SecretId)
 
 	// Get secret from store to verify it exists
-	res, err := h.Store.Get(secretName, "secretsmanager", "secret", ns)
+	res, err := h.Store.Get(r.Context(), secretName, "secretsmanager", "secret", ns)
 	if err != nil {
 		writeSecretsJSON(w, http.StatusNotFound, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -564,7 +608,7 @@ func (h *Handler) DeleteSecret(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete the secret
-	if err := h.Store.Delete(secretName, "secretsmanager", "secret", ns); err != nil {
+	if err := h.Store.Delete(r.Context(), secretName, "secretsmanager", "secret", ns); err != nil {
 		writeSecretsJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalFailure",
 			"message": "Failed to delete secret: " + err.Error(),
@@ -606,7 +650,7 @@ func (h *Handler) GetResourcePolicy(w http.ResponseWriter, r *http.Request) {
 	secretName := extractSecretName(req.SecretId)
 
 	// Get secret from store
-	res, err := h.Store.Get(secretName, "secretsmanager", "secret", ns)
+	res, err := h.Store.Get(r.Context(), secretName, "secretsmanager", "secret", ns)
 	if err != nil {
 		writeSecretsJSON(w, http.StatusNotFound, map[string]any{
 			"__type":  "ResourceNotFoundException",
@@ -638,7 +682,7 @@ func (h *Handler) GetResourcePolicy(w http.ResponseWriter, r *http.Request) {
     {
       "Effect": "Allow",
       "Principal": {
-        "AWS": "arn:aws:iam::000000000000:root"
+        "AWS": "` + awsarn.FromContext(r.Context()).GlobalARN("iam", "root") + `"
       },
       "Action": "secretsmanager:*",
       "Resource": "*"
@@ -0,0 +1,245 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"opensnack/internal/awsarn"
+	"opensnack/internal/awsresponses"
+	"opensnack/internal/resource"
+	"opensnack/internal/util"
+
+	"github.com/google/uuid"
+)
+
+//
+// SUBSCRIPTION CONFIRMATION
+//
+// http/https subscriptions start out pending. Subscribe POSTs a
+// SubscriptionConfirmation message carrying a token and a SubscribeURL to
+// the endpoint; the subscription only receives notifications once the
+// endpoint visits SubscribeURL or calls ConfirmSubscription with the token.
+//
+
+// pendingConfirmationArn is what Subscribe returns for unconfirmed
+// subscriptions unless ReturnSubscriptionArn is set.
+const pendingConfirmationArn = "pending confirmation"
+
+func requiresConfirmation(protocol string) bool {
+	return protocol == "http" || protocol == "https"
+}
+
+// confirmationMessage is the body POSTed to a pending endpoint.
+type confirmationMessage struct {
+	Type             string `json:"Type"`
+	MessageId        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicArn         string `json:"TopicArn"`
+	Message          string `json:"Message"`
+	SubscribeURL     string `json:"SubscribeURL"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+}
+
+func subscribeURL(ctx context.Context, ns, topicArn, token string) string {
+	return awsarn.FromContext(ctx).URL() + "?Action=ConfirmSubscription&Version=" + APIVersion +
+		"&TopicArn=" + url.QueryEscape(topicArn) + "&Token=" + token + namespaceQuery(ns)
+}
+
+// namespaceParam carries the namespace in the SubscribeURL and
+// UnsubscribeURL links: whoever follows them sends its own User-Agent,
+// which rarely names the namespace the subscription lives in.
+const namespaceParam = "Namespace"
+
+// namespaceQuery is the query string suffix naming ns in a link; links
+// into the default namespace look like the ones AWS hands out.
+func namespaceQuery(ns string) string {
+	if ns == "" || ns == "default" {
+		return ""
+	}
+	return "&" + namespaceParam + "=" + url.QueryEscape(ns)
+}
+
+// LinkNamespace returns the namespace of a ConfirmSubscription or
+// Unsubscribe request: the one named by the link it follows, if any,
+// otherwise the caller's.
+func LinkNamespace(r *http.Request) string {
+	if ns := r.FormValue(namespaceParam); ns != "" {
+		return ns
+	}
+	return util.NamespaceFromHeader(r)
+}
+
+// requestConfirmation sends the SubscriptionConfirmation message and records
+// the attempt like any other delivery.
+func (h *Handler) requestConfirmation(ctx context.Context, ns string, sub *subscription) {
+	now := time.Now().UTC()
+	msg := confirmationMessage{
+		Type:      "SubscriptionConfirmation",
+		MessageId: uuid.NewString(),
+		Token:     sub.Token,
+		TopicArn:  sub.TopicArn,
+		Message: "You have chosen to subscribe to the topic " + sub.TopicArn +
+			".\nTo confirm the subscription, visit the SubscribeURL included in this message.",
+		SubscribeURL:     subscribeURL(ctx, ns, sub.TopicArn, sub.Token),
+		Timestamp:        now.Format("2006-01-02T15:04:05.000Z"),
+		SignatureVersion: "1",
+		Signature:        notificationSignature,
+		SigningCertURL:   signingCertURL(ctx),
+	}
+	buf, _ := json.Marshal(msg)
+
+	rec := deliveryRecord{
+		MessageId:       msg.MessageId,
+		MessageType:     msg.Type,
+		TopicArn:        sub.TopicArn,
+		SubscriptionArn: subscriptionArn(ctx, sub.ID),
+		Protocol:        sub.Protocol,
+		Endpoint:        sub.Endpoint,
+		Payload:         string(buf),
+		CreatedAt:       now,
+	}
+	endpointCtx, cancel := context.WithTimeout(ctx, h.DeliveryDeadline)
+	defer cancel()
+	h.deliverToEndpoint(endpointCtx, sub, &rec)
+	h.saveDelivery(ctx, ns, sub.ID, &rec)
+}
+
+// UnsignedLink reports whether form, sent without credentials, is one of
+// the links handed out in SNS messages: ConfirmSubscription with a token
+// issued for the topic, or Unsubscribe of an existing subscription that
+// did not ask for unsubscribes to be authenticated.
+func (h *Handler) UnsignedLink(ctx context.Context, ns string, form url.Values) bool {
+	switch form.Get("Action") {
+	case "ConfirmSubscription":
+		topicArn, token := form.Get("TopicArn"), form.Get("Token")
+		if topicArn == "" || token == "" {
+			return false
+		}
+		page, err := h.Store.Query(ctx, resource.Query{
+			Service:   "sns",
+			Type:      "subscription",
+			Namespace: ns,
+			Match:     map[string]any{"topic_arn": topicArn, "token": token},
+			Limit:     1,
+		})
+		return err == nil && len(page.Resources) > 0
+	case "Unsubscribe":
+		parts := strings.Split(form.Get("SubscriptionArn"), ":")
+		if len(parts) < 6 {
+			return false
+		}
+		item, err := h.Store.Get(ctx, parts[len(parts)-1], "sns", "subscription", ns)
+		if err != nil {
+			return false
+		}
+		var storedAttrs map[string]interface{}
+		if err := json.Unmarshal(item.Attributes, &storedAttrs); err != nil {
+			return false
+		}
+		authenticate, _ := storedAttrs["authenticate_on_unsubscribe"].(bool)
+		return !authenticate
+	}
+	return false
+}
+
+// ConfirmSubscription
+func (h *Handler) ConfirmSubscription(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	ns := LinkNamespace(r)
+	topicArn := r.FormValue("TopicArn")
+	token := r.FormValue("Token")
+
+	if topicArn == "" {
+		awsresponses.WriteErrorXML(
+			w,
+			http.StatusBadRequest,
+			"MissingParameter",
+			"TopicArn is required",
+			"",
+		)
+		return
+	}
+
+	if token == "" {
+		awsresponses.WriteErrorXML(
+			w,
+			http.StatusBadRequest,
+			"MissingParameter",
+			"Token is required",
+			"",
+		)
+		return
+	}
+
+	if _, serr := h.lookupTopic(r.Context(), ns, topicArn); serr != nil {
+		writeError(w, serr, topicArn)
+		return
+	}
+
+	page, err := h.Store.Query(r.Context(), resource.Query{
+		Service:   "sns",
+		Type:      "subscription",
+		Namespace: ns,
+		Match:     map[string]any{"topic_arn": topicArn, "token": token},
+	})
+	if err != nil {
+		awsresponses.WriteJSON(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for i := range page.Resources {
+		item := &page.Resources[i]
+		var storedAttrs map[string]interface{}
+		if err := json.Unmarshal(item.Attributes, &storedAttrs); err != nil {
+			continue
+		}
+
+		// Confirming an already confirmed subscription is a no-op
+		if pending, _ := storedAttrs["pending_confirmation"].(bool); pending {
+			_, err := h.Store.Mutate(r.Context(), item.ID, "sns", "subscription", ns, func(sub *resource.Resource) error {
+				var storedAttrs map[string]interface{}
+				if err := json.Unmarshal(sub.Attributes, &storedAttrs); err != nil {
+					return err
+				}
+				delete(storedAttrs, "pending_confirmation")
+				if r.FormValue("AuthenticateOnUnsubscribe") == "true" {
+					storedAttrs["authenticate_on_unsubscribe"] = true
+				}
+				buf, err := json.Marshal(storedAttrs)
+				if err != nil {
+					return err
+				}
+				sub.Attributes = buf
+				return nil
+			})
+			if err != nil {
+				awsresponses.WriteJSON(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+
+		resp := ConfirmSubscriptionResponse{
+			ConfirmSubscriptionResult: ConfirmSubscriptionResult{
+				SubscriptionArn: subscriptionArn(r.Context(), item.ID),
+			},
+			ResponseMetadata: ResponseMetadata{
+				RequestId: awsresponses.NextRequestID(),
+			},
+		}
+		awsresponses.WriteXML(w, resp)
+		return
+	}
+
+	writeError(w, errInvalidParameter("Invalid token"), topicArn)
+}
@@ -0,0 +1,208 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sns_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"opensnack/internal/api/sns"
+	"opensnack/internal/resource"
+)
+
+type webhookRequest struct {
+	header http.Header
+	body   string
+}
+
+// webhook is an http subscriber. It always accepts SubscriptionConfirmation
+// messages and answers notifications with status, after release is
+// closed if it is set.
+type webhook struct {
+	*httptest.Server
+	status  int
+	release <-chan struct{}
+
+	mu       sync.Mutex
+	requests []webhookRequest
+}
+
+func newWebhook(status int) *webhook {
+	return startWebhook(&webhook{status: status})
+}
+
+// newSlowWebhook holds every notification until release is closed or the
+// sender gives up.
+func newSlowWebhook(release <-chan struct{}) *webhook {
+	return startWebhook(&webhook{status: http.StatusOK, release: release})
+}
+
+func startWebhook(wh *webhook) *webhook {
+	wh.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		wh.mu.Lock()
+		wh.requests = append(wh.requests, webhookRequest{header: r.Header, body: string(b)})
+		wh.mu.Unlock()
+		if r.Header.Get("x-amz-sns-message-type") != "SubscriptionConfirmation" {
+			if wh.release != nil {
+				select {
+				case <-wh.release:
+				case <-r.Context().Done():
+				}
+			}
+			w.WriteHeader(wh.status)
+		}
+	}))
+	return wh
+}
+
+// received returns the requests of one x-amz-sns-message-type.
+func (wh *webhook) received(messageType string) []webhookRequest {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	var out []webhookRequest
+	for _, req := range wh.requests {
+		if req.header.Get("x-amz-sns-message-type") == messageType {
+			out = append(out, req)
+		}
+	}
+	return out
+}
+
+// confirmation decodes the last SubscriptionConfirmation the webhook received.
+func (wh *webhook) confirmation(t *testing.T) map[string]string {
+	t.Helper()
+	reqs := wh.received("SubscriptionConfirmation")
+	if len(reqs) == 0 {
+		t.Fatalf("webhook received no SubscriptionConfirmation")
+	}
+	var msg map[string]string
+	if err := json.Unmarshal([]byte(reqs[len(reqs)-1].body), &msg); err != nil {
+		t.Fatalf("bad confirmation body: %s", reqs[len(reqs)-1].body)
+	}
+	return msg
+}
+
+func confirm(h *sns.Handler, topicArn, token string) *httptest.ResponseRecorder {
+	return callQuery(h, url.Values{
+		"Action":   {"ConfirmSubscription"},
+		"TopicArn": {topicArn},
+		"Token":    {token},
+	})
+}
+
+// subscribeConfirmed subscribes an http webhook and completes the handshake.
+func subscribeConfirmed(t *testing.T, h *sns.Handler, wh *webhook) string {
+	t.Helper()
+	subArn := subscribe(t, h, "http", wh.URL, nil)
+	if rec := confirm(h, testTopicArn, wh.confirmation(t)["Token"]); rec.Code != 200 {
+		t.Fatalf("ConfirmSubscription failed: %s", rec.Body.String())
+	}
+	return subArn
+}
+
+func subscriptionAttrs(t *testing.T, h *sns.Handler, subArn string) map[string]string {
+	t.Helper()
+	rec := callQuery(h, url.Values{
+		"Action":          {"GetSubscriptionAttributes"},
+		"SubscriptionArn": {subArn},
+	})
+	var resp sns.GetSubscriptionAttributesResponse
+	if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad response: %s", rec.Body.String())
+	}
+	out := map[string]string{}
+	for _, e := range resp.GetSubscriptionAttributesResult.Attributes.Entries {
+		out[e.Key] = e.Value
+	}
+	return out
+}
+
+func TestSubscribe_HTTPRequiresConfirmation(t *testing.T) {
+	wh := newWebhook(http.StatusOK)
+	defer wh.Close()
+
+	store := resource.NewMemoryStore()
+	h := sns.NewHandler(store)
+	seedTopic(t, store, "events")
+
+	rec := callQuery(h, url.Values{
+		"Action":   {"Subscribe"},
+		"TopicArn": {testTopicArn},
+		"Protocol": {"http"},
+		"Endpoint": {wh.URL},
+	})
+	if !strings.Contains(rec.Body.String(), "<SubscriptionArn>pending confirmation</SubscriptionArn>") {
+		t.Fatalf("expected pending confirmation, got %s", rec.Body.String())
+	}
+
+	msg := wh.confirmation(t)
+	if msg["Type"] != "SubscriptionConfirmation" || msg["TopicArn"] != testTopicArn || msg["Token"] == "" {
+		t.Fatalf("unexpected confirmation message: %v", msg)
+	}
+	subscribeURL, err := url.Parse(msg["SubscribeURL"])
+	if err != nil || subscribeURL.Query().Get("Action") != "ConfirmSubscription" ||
+		subscribeURL.Query().Get("Token") != msg["Token"] {
+		t.Fatalf("unexpected SubscribeURL: %s", msg["SubscribeURL"])
+	}
+
+	list := callQuery(h, url.Values{"Action": {"ListSubscriptionsByTopic"}, "TopicArn": {testTopicArn}})
+	if !strings.Contains(list.Body.String(), "<SubscriptionArn>PendingConfirmation</SubscriptionArn>") {
+		t.Fatalf("pending subscription should be listed as PendingConfirmation: %s", list.Body.String())
+	}
+
+	// Nothing is delivered until the endpoint confirms.
+	publishWith(t, h, "before", nil)
+	if n := len(wh.received("Notification")); n != 0 {
+		t.Fatalf("pending subscription received %d notifications", n)
+	}
+}
+
+func TestConfirmSubscription(t *testing.T) {
+	wh := newWebhook(http.StatusOK)
+	defer wh.Close()
+
+	store := resource.NewMemoryStore()
+	h := sns.NewHandler(store)
+	seedTopic(t, store, "events")
+	subArn := subscribe(t, h, "http", wh.URL, nil)
+
+	if attrs := subscriptionAttrs(t, h, subArn); attrs["PendingConfirmation"] != "true" {
+		t.Fatalf("expected PendingConfirmation=true, got %v", attrs)
+	}
+
+	if rec := confirm(h, testTopicArn, "wrong"); !strings.Contains(rec.Body.String(), "Invalid token") {
+		t.Fatalf("expected invalid token error, got %s", rec.Body.String())
+	}
+
+	// The SubscribeURL is a plain GET against the Query API.
+	subscribeURL, _ := url.Parse(wh.confirmation(t)["SubscribeURL"])
+	req, rec := newCtx("GET", "/?"+subscribeURL.RawQuery, nil)
+	h.Dispatch(rec, req)
+	var resp sns.ConfirmSubscriptionResponse
+	if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad ConfirmSubscription response: %s", rec.Body.String())
+	}
+	if resp.ConfirmSubscriptionResult.SubscriptionArn != subArn {
+		t.Fatalf("expected %s, got %s", subArn, resp.ConfirmSubscriptionResult.SubscriptionArn)
+	}
+
+	if attrs := subscriptionAttrs(t, h, subArn); attrs["PendingConfirmation"] != "false" {
+		t.Fatalf("expected PendingConfirmation=false, got %v", attrs)
+	}
+
+	publishWith(t, h, "after", nil)
+	got := wh.received("Notification")
+	if len(got) != 1 || !strings.Contains(got[0].body, `"Message":"after"`) {
+		t.Fatalf("confirmed subscription should receive notifications, got %v", got)
+	}
+}
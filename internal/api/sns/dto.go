@@ -31,8 +31,9 @@ type TopicArnMember struct {
 }
 
 type ListTopicsResult struct {
-	XMLName xml.Name         `xml:"ListTopicsResult"`
-	Topics  []TopicArnMember `xml:"Topics>member"`
+	XMLName   xml.Name         `xml:"ListTopicsResult"`
+	Topics    []TopicArnMember `xml:"Topics>member"`
+	NextToken string           `xml:"NextToken,omitempty"`
 }
 
 type ListTopicsResponse struct {
@@ -59,6 +60,33 @@ type PublishResponse struct {
 	ResponseMetadata ResponseMetadata `xml:"ResponseMetadata"`
 }
 
+// PublishBatch
+type PublishBatchResultEntry struct {
+	XMLName   xml.Name `xml:"member"`
+	Id        string   `xml:"Id"`
+	MessageId string   `xml:"MessageId"`
+}
+
+type BatchResultErrorEntry struct {
+	XMLName     xml.Name `xml:"member"`
+	Id          string   `xml:"Id"`
+	Code        string   `xml:"Code"`
+	Message     string   `xml:"Message"`
+	SenderFault bool     `xml:"SenderFault"`
+}
+
+type PublishBatchResult struct {
+	XMLName    xml.Name                  `xml:"PublishBatchResult"`
+	Successful []PublishBatchResultEntry `xml:"Successful>member"`
+	Failed     []BatchResultErrorEntry   `xml:"Failed>member"`
+}
+
+type PublishBatchResponse struct {
+	XMLName            xml.Name           `xml:"PublishBatchResponse"`
+	PublishBatchResult PublishBatchResult `xml:"PublishBatchResult"`
+	ResponseMetadata   ResponseMetadata   `xml:"ResponseMetadata"`
+}
+
 // GetTopicAttributes
 type AttributeEntry struct {
 	XMLName xml.Name `xml:"entry"`
@@ -123,6 +151,18 @@ type SubscribeResponse struct {
 	ResponseMetadata ResponseMetadata `xml:"ResponseMetadata"`
 }
 
+// ConfirmSubscription
+type ConfirmSubscriptionResult struct {
+	XMLName         xml.Name `xml:"ConfirmSubscriptionResult"`
+	SubscriptionArn string   `xml:"SubscriptionArn"`
+}
+
+type ConfirmSubscriptionResponse struct {
+	XMLName                   xml.Name                  `xml:"ConfirmSubscriptionResponse"`
+	ConfirmSubscriptionResult ConfirmSubscriptionResult `xml:"ConfirmSubscriptionResult"`
+	ResponseMetadata          ResponseMetadata          `xml:"ResponseMetadata"`
+}
+
 // GetSubscriptionAttributes
 type GetSubscriptionAttributesResult struct {
 	XMLName    xml.Name   `xml:"GetSubscriptionAttributesResult"`
@@ -135,6 +175,12 @@ type GetSubscriptionAttributesResponse struct {
 	ResponseMetadata                ResponseMetadata                `xml:"ResponseMetadata"`
 }
 
+// SetSubscriptionAttributes
+type SetSubscriptionAttributesResponse struct {
+	XMLName          xml.Name         `xml:"SetSubscriptionAttributesResponse"`
+	ResponseMetadata ResponseMetadata `xml:"ResponseMetadata"`
+}
+
 // ListSubscriptionsByTopic
 type Subscription struct {
 	XMLName         xml.Name `xml:"member"`
@@ -153,6 +199,7 @@ type Subscriptions struct {
 type ListSubscriptionsByTopicResult struct {
 	XMLName       xml.Name      `xml:"ListSubscriptionsByTopicResult"`
 	Subscriptions Subscriptions `xml:"Subscriptions"`
+	NextToken     string        `xml:"NextToken,omitempty"`
 }
 
 type ListSubscriptionsByTopicResponse struct {
@@ -0,0 +1,382 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+//
+// SUBSCRIPTION FILTER POLICIES
+//
+// A filter policy is a JSON object whose keys name message attributes
+// (FilterPolicyScope=MessageAttributes, the default) or fields of a JSON
+// message body (FilterPolicyScope=MessageBody). Every key must match; a key
+// matches when any of the conditions in its array matches:
+//
+//   "a": ["x", 5]                          exact string / number
+//   "a": [{"prefix": "x"}]                 also suffix, equals-ignore-case
+//   "a": [{"anything-but": ["x", "y"]}]    also a single value or {"prefix": ...}
+//   "a": [{"numeric": [">=", 0, "<", 10]}]
+//   "a": [{"exists": false}]
+//   "a": [{"cidr": "10.0.0.0/24"}]
+//   "$or": [{...}, {...}]                  any of the sub-policies
+//
+// Body policies may nest objects to reach into nested fields. When the
+// value being matched is an array, the condition matches if any element does.
+//
+
+const (
+	scopeMessageAttributes = "MessageAttributes"
+	scopeMessageBody       = "MessageBody"
+)
+
+// subscriptionAttributeNames are the attributes accepted by Subscribe and
+// SetSubscriptionAttributes.
+var subscriptionAttributeNames = map[string]bool{
+	"DeliveryPolicy":      true,
+	"FilterPolicy":        true,
+	"FilterPolicyScope":   true,
+	"RawMessageDelivery":  true,
+	"RedrivePolicy":       true,
+	"SubscriptionRoleArn": true,
+	"ReplayPolicy":        true,
+}
+
+// validateSubscriptionAttributes checks the attributes a subscription will
+// hold once attrs are applied.
+func validateSubscriptionAttributes(attrs map[string]string) *snsError {
+	for name := range attrs {
+		if !subscriptionAttributeNames[name] {
+			return errInvalidParameter("Invalid parameter: AttributeName")
+		}
+	}
+	if v, ok := attrs["RawMessageDelivery"]; ok && v != "" && v != "true" && v != "false" {
+		return errInvalidParameter("Invalid parameter: Attributes Reason: RawMessageDelivery: Invalid value [%s]. Must be true or false.", v)
+	}
+	scope := attrs["FilterPolicyScope"]
+	if scope != "" && scope != scopeMessageAttributes && scope != scopeMessageBody {
+		return errInvalidParameter("Invalid parameter: Attributes Reason: FilterPolicyScope: Invalid value [%s]. Please use either MessageBody or MessageAttributes", scope)
+	}
+	if raw := attrs["FilterPolicy"]; raw != "" {
+		if _, err := parseFilterPolicy(raw, scope); err != nil {
+			return errInvalidParameter("Invalid parameter: FilterPolicy: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// parseFilterPolicy decodes and validates a filter policy.
+func parseFilterPolicy(raw, scope string) (map[string]any, error) {
+	var policy map[string]any
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil || policy == nil {
+		return nil, fmt.Errorf("failed to parse JSON")
+	}
+	if err := validatePolicy(policy, scope != scopeMessageBody); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func validatePolicy(policy map[string]any, flat bool) error {
+	for key, value := range policy {
+		if key == "$or" {
+			alts, ok := value.([]any)
+			if !ok || len(alts) < 2 {
+				return fmt.Errorf("$or must be an array of at least two policies")
+			}
+			for _, alt := range alts {
+				sub, ok := alt.(map[string]any)
+				if !ok {
+					return fmt.Errorf("$or must be an array of at least two policies")
+				}
+				if err := validatePolicy(sub, flat); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			if flat {
+				return fmt.Errorf("\"%s\" must be an array of conditions", key)
+			}
+			if err := validatePolicy(v, flat); err != nil {
+				return err
+			}
+		case []any:
+			if len(v) == 0 {
+				return fmt.Errorf("Empty arrays are not allowed")
+			}
+			for _, cond := range v {
+				if err := validateCondition(cond); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("\"%s\" must be an object or an array", key)
+		}
+	}
+	return nil
+}
+
+func validateCondition(cond any) error {
+	if _, ok := cond.([]any); ok {
+		return fmt.Errorf("Match value must be String, number, true, false, or null")
+	}
+	op, ok := cond.(map[string]any)
+	if !ok {
+		return nil // string, number, boolean or null literal
+	}
+	if len(op) != 1 {
+		return fmt.Errorf("Only one key allowed in match expression")
+	}
+	for name, arg := range op {
+		switch name {
+		case "prefix", "suffix", "equals-ignore-case":
+			if _, ok := arg.(string); !ok {
+				return fmt.Errorf("%s match pattern must be a string", name)
+			}
+		case "exists":
+			if _, ok := arg.(bool); !ok {
+				return fmt.Errorf("exists match pattern must be either true or false.")
+			}
+		case "cidr":
+			s, _ := arg.(string)
+			if _, _, err := net.ParseCIDR(s); err != nil {
+				return fmt.Errorf("Malformed CIDR, one '/' required")
+			}
+		case "anything-but":
+			switch a := arg.(type) {
+			case string, float64:
+			case []any:
+				if len(a) == 0 {
+					return fmt.Errorf("Empty arrays are not allowed")
+				}
+				for _, item := range a {
+					switch item.(type) {
+					case string, float64:
+					default:
+						return fmt.Errorf("Inside anything-but list, only strings and numbers are supported")
+					}
+				}
+			case map[string]any:
+				p, ok := a["prefix"].(string)
+				if len(a) != 1 || !ok || p == "" {
+					return fmt.Errorf("Unsupported anything-but pattern")
+				}
+			default:
+				return fmt.Errorf("Unsupported anything-but pattern")
+			}
+		case "numeric":
+			return validateNumeric(arg)
+		default:
+			return fmt.Errorf("Unrecognized match type %s", name)
+		}
+	}
+	return nil
+}
+
+func validateNumeric(arg any) error {
+	terms, ok := arg.([]any)
+	if !ok || (len(terms) != 2 && len(terms) != 4) {
+		return fmt.Errorf("Value of numeric must be an array.")
+	}
+	for i := 0; i < len(terms); i += 2 {
+		op, _ := terms[i].(string)
+		if _, ok := terms[i+1].(float64); !ok {
+			return fmt.Errorf("Value of %s must be numeric", op)
+		}
+		switch op {
+		case "=":
+			if len(terms) != 2 {
+				return fmt.Errorf("Too many elements in numeric expression")
+			}
+		case "<", "<=", ">", ">=":
+		default:
+			return fmt.Errorf("Unrecognized numeric range operator: %v", terms[i])
+		}
+	}
+	return nil
+}
+
+// accepts reports whether the subscription's filter policy lets a message through.
+func (s *subscription) accepts(in publishInput) bool {
+	raw := s.Attributes["FilterPolicy"]
+	if raw == "" {
+		return true
+	}
+	scope := s.Attributes["FilterPolicyScope"]
+	policy, err := parseFilterPolicy(raw, scope)
+	if err != nil {
+		return false
+	}
+
+	var doc map[string]any
+	if scope == scopeMessageBody {
+		if err := json.Unmarshal([]byte(messageFor(in, s.Protocol)), &doc); err != nil {
+			return false
+		}
+	} else {
+		doc = attributeDocument(in.MessageAttributes)
+	}
+	return matchPolicy(policy, doc)
+}
+
+// attributeDocument converts message attributes into the values a policy
+// is matched against. Binary attributes are never matched.
+func attributeDocument(attrs map[string]messageAttribute) map[string]any {
+	doc := map[string]any{}
+	for name, attr := range attrs {
+		switch strings.SplitN(attr.DataType, ".", 2)[0] {
+		case "Number":
+			if n, err := strconv.ParseFloat(attr.StringValue, 64); err == nil {
+				doc[name] = n
+			}
+		case "String":
+			if strings.HasPrefix(attr.DataType, "String.Array") {
+				var values []any
+				if json.Unmarshal([]byte(attr.StringValue), &values) == nil {
+					doc[name] = values
+					continue
+				}
+			}
+			doc[name] = attr.StringValue
+		}
+	}
+	return doc
+}
+
+func matchPolicy(policy, doc map[string]any) bool {
+	for key, value := range policy {
+		if key == "$or" {
+			matched := false
+			for _, alt := range value.([]any) {
+				if matchPolicy(alt.(map[string]any), doc) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+			continue
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			nested, _ := doc[key].(map[string]any)
+			if !matchPolicy(v, nested) {
+				return false
+			}
+		case []any:
+			field, present := doc[key]
+			values, ok := field.([]any)
+			if !ok {
+				values = []any{field}
+			}
+			if !matchConditions(v, values, present) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchConditions(conds, values []any, present bool) bool {
+	for _, cond := range conds {
+		if op, ok := cond.(map[string]any); ok {
+			if matchOperator(op, values, present) {
+				return true
+			}
+			continue
+		}
+		if present && containsValue(values, cond) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsValue(values []any, want any) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+func matchOperator(op map[string]any, values []any, present bool) bool {
+	for name, arg := range op {
+		if name == "exists" {
+			return present == arg.(bool)
+		}
+		if !present {
+			return false
+		}
+		for _, v := range values {
+			if matchValue(name, arg, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchValue(name string, arg, v any) bool {
+	s, isString := v.(string)
+	switch name {
+	case "prefix":
+		return isString && strings.HasPrefix(s, arg.(string))
+	case "suffix":
+		return isString && strings.HasSuffix(s, arg.(string))
+	case "equals-ignore-case":
+		return isString && strings.EqualFold(s, arg.(string))
+	case "cidr":
+		_, network, _ := net.ParseCIDR(arg.(string))
+		ip := net.ParseIP(s)
+		return isString && ip != nil && network.Contains(ip)
+	case "numeric":
+		n, ok := v.(float64)
+		return ok && matchNumeric(arg.([]any), n)
+	case "anything-but":
+		switch a := arg.(type) {
+		case []any:
+			return !containsValue(a, v)
+		case map[string]any:
+			return isString && !strings.HasPrefix(s, a["prefix"].(string))
+		default:
+			return v != a
+		}
+	}
+	return false
+}
+
+func matchNumeric(terms []any, n float64) bool {
+	for i := 0; i < len(terms); i += 2 {
+		bound := terms[i+1].(float64)
+		var ok bool
+		switch terms[i].(string) {
+		case "=":
+			ok = n == bound
+		case "<":
+			ok = n < bound
+		case "<=":
+			ok = n <= bound
+		case ">":
+			ok = n > bound
+		case ">=":
+			ok = n >= bound
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,203 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sns_test
+
+import (
+	"encoding/xml"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"opensnack/internal/api/sns"
+	"opensnack/internal/resource"
+)
+
+// attr is a message attribute as {DataType, StringValue}.
+type attr [2]string
+
+func publishWith(t *testing.T, h *sns.Handler, message string, attrs map[string]attr) {
+	t.Helper()
+	form := url.Values{
+		"Action":   {"Publish"},
+		"TopicArn": {testTopicArn},
+		"Message":  {message},
+	}
+	i := 1
+	for name, a := range attrs {
+		p := "MessageAttributes.entry." + strconv.Itoa(i) + "."
+		form.Set(p+"Name", name)
+		form.Set(p+"Value.DataType", a[0])
+		form.Set(p+"Value.StringValue", a[1])
+		i++
+	}
+	if rec := callQuery(h, form); rec.Code != 200 {
+		t.Fatalf("publish failed: %s", rec.Body.String())
+	}
+}
+
+func queueBodies(t *testing.T, h *sns.Handler, queue string) []string {
+	t.Helper()
+	var bodies []string
+	for _, m := range receiveAll(t, h, queue) {
+		bodies = append(bodies, m.Body)
+	}
+	sort.Strings(bodies)
+	return bodies
+}
+
+func TestFilterPolicy_Matching(t *testing.T) {
+	cases := []struct {
+		name    string
+		policy  string
+		scope   string
+		message string
+		attrs   map[string]attr
+		want    bool
+	}{
+		{"exact string", `{"store":["example_corp"]}`, "", "m", map[string]attr{"store": {"String", "example_corp"}}, true},
+		{"exact string mismatch", `{"store":["example_corp"]}`, "", "m", map[string]attr{"store": {"String", "other"}}, false},
+		{"missing attribute", `{"store":["example_corp"]}`, "", "m", nil, false},
+		{"exact number", `{"price":[100]}`, "", "m", map[string]attr{"price": {"Number", "100.0"}}, true},
+		{"prefix", `{"event":[{"prefix":"order-"}]}`, "", "m", map[string]attr{"event": {"String", "order-created"}}, true},
+		{"prefix mismatch", `{"event":[{"prefix":"order-"}]}`, "", "m", map[string]attr{"event": {"String", "user-created"}}, false},
+		{"anything-but list", `{"event":[{"anything-but":["a","b"]}]}`, "", "m", map[string]attr{"event": {"String", "c"}}, true},
+		{"anything-but excluded", `{"event":[{"anything-but":["a","b"]}]}`, "", "m", map[string]attr{"event": {"String", "b"}}, false},
+		{"anything-but missing", `{"event":[{"anything-but":"a"}]}`, "", "m", nil, false},
+		{"anything-but prefix", `{"event":[{"anything-but":{"prefix":"test-"}}]}`, "", "m", map[string]attr{"event": {"String", "test-1"}}, false},
+		{"numeric range", `{"price":[{"numeric":[">=",10,"<",20]}]}`, "", "m", map[string]attr{"price": {"Number", "15"}}, true},
+		{"numeric out of range", `{"price":[{"numeric":[">=",10,"<",20]}]}`, "", "m", map[string]attr{"price": {"Number", "20"}}, false},
+		{"numeric on string", `{"price":[{"numeric":[">",1]}]}`, "", "m", map[string]attr{"price": {"String", "5"}}, false},
+		{"exists true", `{"trace":[{"exists":true}]}`, "", "m", map[string]attr{"trace": {"String", "x"}}, true},
+		{"exists false", `{"trace":[{"exists":false}]}`, "", "m", nil, true},
+		{"exists false present", `{"trace":[{"exists":false}]}`, "", "m", map[string]attr{"trace": {"String", "x"}}, false},
+		{"string array", `{"tags":["b"]}`, "", "m", map[string]attr{"tags": {"String.Array", `["a","b"]`}}, true},
+		{"all keys must match", `{"a":["1"],"b":["2"]}`, "", "m", map[string]attr{"a": {"String", "1"}}, false},
+		{"or", `{"$or":[{"a":["1"]},{"b":["2"]}]}`, "", "m", map[string]attr{"b": {"String", "2"}}, true},
+		{"body exact", `{"status":["paid"]}`, "MessageBody", `{"status":"paid"}`, nil, true},
+		{"body nested", `{"order":{"total":[{"numeric":[">",50]}]}}`, "MessageBody", `{"order":{"total":75}}`, nil, true},
+		{"body nested mismatch", `{"order":{"total":[{"numeric":[">",50]}]}}`, "MessageBody", `{"order":{"total":10}}`, nil, false},
+		{"body array", `{"items":[{"prefix":"sku-"}]}`, "MessageBody", `{"items":["x","sku-1"]}`, nil, true},
+		{"body ignores attributes", `{"status":["paid"]}`, "MessageBody", `{"status":"open"}`, map[string]attr{"status": {"String", "paid"}}, false},
+		{"body not json", `{"status":["paid"]}`, "MessageBody", "plain text", nil, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := resource.NewMemoryStore()
+			h := sns.NewHandler(store)
+			seedTopic(t, store, "events")
+			attrs := map[string]string{"RawMessageDelivery": "true", "FilterPolicy": tc.policy}
+			if tc.scope != "" {
+				attrs["FilterPolicyScope"] = tc.scope
+			}
+			subscribe(t, h, "sqs", seedQueue(t, store, "q"), attrs)
+
+			publishWith(t, h, tc.message, tc.attrs)
+
+			if got := len(receiveAll(t, h, "q")) == 1; got != tc.want {
+				t.Fatalf("delivered=%v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// A local fan-out: each subscriber only sees the messages its policy selects.
+func TestFilterPolicy_FanOut(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sns.NewHandler(store)
+	seedTopic(t, store, "events")
+
+	raw := map[string]string{"RawMessageDelivery": "true"}
+	with := func(extra map[string]string) map[string]string {
+		out := map[string]string{}
+		for k, v := range raw {
+			out[k] = v
+		}
+		for k, v := range extra {
+			out[k] = v
+		}
+		return out
+	}
+
+	subscribe(t, h, "sqs", seedQueue(t, store, "all"), raw)
+	subscribe(t, h, "sqs", seedQueue(t, store, "orders"), with(map[string]string{
+		"FilterPolicy": `{"event":[{"prefix":"order."}],"region":[{"anything-but":"test"}]}`,
+	}))
+	subscribe(t, h, "sqs", seedQueue(t, store, "big"), with(map[string]string{
+		"FilterPolicy":      `{"detail":{"amount":[{"numeric":[">=",1000]}]}}`,
+		"FilterPolicyScope": "MessageBody",
+	}))
+
+	publishWith(t, h, `{"detail":{"amount":5}}`, map[string]attr{
+		"event": {"String", "order.created"}, "region": {"String", "eu"},
+	})
+	publishWith(t, h, `{"detail":{"amount":5000}}`, map[string]attr{
+		"event": {"String", "order.created"}, "region": {"String", "test"},
+	})
+	publishWith(t, h, `{"detail":{"amount":2000}}`, map[string]attr{
+		"event": {"String", "user.signup"},
+	})
+
+	if got := queueBodies(t, h, "all"); len(got) != 3 {
+		t.Fatalf("unfiltered subscriber should see every message, got %v", got)
+	}
+	if got := strings.Join(queueBodies(t, h, "orders"), ","); got != `{"detail":{"amount":5}}` {
+		t.Fatalf("orders subscriber got %s", got)
+	}
+	if got := strings.Join(queueBodies(t, h, "big"), ","); got != `{"detail":{"amount":2000}},{"detail":{"amount":5000}}` {
+		t.Fatalf("big subscriber got %s", got)
+	}
+}
+
+func TestSetSubscriptionAttributes(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sns.NewHandler(store)
+	seedTopic(t, store, "events")
+	subArn := subscribe(t, h, "sqs", seedQueue(t, store, "q"), nil)
+
+	set := func(name, value string) string {
+		rec := callQuery(h, url.Values{
+			"Action":          {"SetSubscriptionAttributes"},
+			"SubscriptionArn": {subArn},
+			"AttributeName":   {name},
+			"AttributeValue":  {value},
+		})
+		return rec.Body.String()
+	}
+
+	if body := set("FilterPolicy", `{"store":["a"]}`); !strings.Contains(body, "SetSubscriptionAttributesResponse") {
+		t.Fatalf("SetSubscriptionAttributes failed: %s", body)
+	}
+	if body := set("FilterPolicy", `{"store":"a"}`); !strings.Contains(body, "InvalidParameter") {
+		t.Fatalf("expected invalid policy to be rejected: %s", body)
+	}
+	if body := set("FilterPolicy", `{"a":{"b":["c"]}}`); !strings.Contains(body, "InvalidParameter") {
+		t.Fatalf("nested policy needs MessageBody scope: %s", body)
+	}
+	if body := set("FilterPolicyScope", "Headers"); !strings.Contains(body, "InvalidParameter") {
+		t.Fatalf("expected invalid scope to be rejected: %s", body)
+	}
+	if body := set("Bogus", "1"); !strings.Contains(body, "InvalidParameter") {
+		t.Fatalf("expected unknown attribute to be rejected: %s", body)
+	}
+
+	rec := callQuery(h, url.Values{
+		"Action":          {"GetSubscriptionAttributes"},
+		"SubscriptionArn": {subArn},
+	})
+	var resp sns.GetSubscriptionAttributesResponse
+	if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad response: %s", rec.Body.String())
+	}
+	got := map[string]string{}
+	for _, e := range resp.GetSubscriptionAttributesResult.Attributes.Entries {
+		got[e.Key] = e.Value
+	}
+	if got["FilterPolicy"] != `{"store":["a"]}` || got["FilterPolicyScope"] != "MessageAttributes" {
+		t.Fatalf("unexpected attributes: %v", got)
+	}
+}
@@ -5,12 +5,16 @@
 package sns
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"opensnack/internal/api/sqs"
+	"opensnack/internal/awsarn"
 	"opensnack/internal/awsresponses"
 	"opensnack/internal/resource"
 	"opensnack/internal/util"
@@ -20,26 +24,39 @@ import (
 
 const (
 	APIVersion = "2010-03-31"
-	snsRegion  = "us-east-1"
-	snsAccount = "000000000000"
+
+	listPageSize = 100
 )
 
 type Handler struct {
 	Store resource.Store
+	// Queues delivers notifications to sqs subscriptions. The router shares
+	// its SQS handler here so both services use the same message lock.
+	Queues *sqs.Handler
+	// Client is used for http/https subscription deliveries.
+	Client *http.Client
+	// DeliveryDeadline bounds how long a request waits on http/https
+	// endpoints, over every attempt and subscription.
+	DeliveryDeadline time.Duration
 }
 
 func NewHandler(store resource.Store) *Handler {
-	return &Handler{Store: store}
+	return &Handler{
+		Store:            store,
+		Queues:           sqs.NewHandler(store),
+		Client:           &http.Client{Timeout: deliveryTimeout},
+		DeliveryDeadline: deliveryDeadline,
+	}
 }
 
 // Build SNS ARN
-func topicArn(name string) string {
-	return "arn:aws:sns:" + snsRegion + ":" + snsAccount + ":" + name
+func topicArn(ctx context.Context, name string) string {
+	return awsarn.FromContext(ctx).ARN("sns", name)
 }
 
 // Build SNS Subscription ARN
-func subscriptionArn(subscriptionID string) string {
-	return "arn:aws:sns:" + snsRegion + ":" + snsAccount + ":" + subscriptionID
+func subscriptionArn(ctx context.Context, subscriptionID string) string {
+	return awsarn.FromContext(ctx).ARN("sns", subscriptionID)
 }
 
 // SNS Dispatcher
@@ -64,14 +81,20 @@ func (h *Handler) Dispatch(w http.ResponseWriter, r *http.Request) {
 		h.DeleteTopic(w, r)
 	case "Publish":
 		h.Publish(w, r)
+	case "PublishBatch":
+		h.PublishBatch(w, r)
 	case "ListTagsForResource":
 		h.ListTagsForResource(w, r)
 	case "Subscribe":
 		h.Subscribe(w, r)
 	case "GetSubscriptionAttributes":
 		h.GetSubscriptionAttributes(w, r)
+	case "SetSubscriptionAttributes":
+		h.SetSubscriptionAttributes(w, r)
 	case "ListSubscriptionsByTopic":
 		h.ListSubscriptionsByTopic(w, r)
+	case "ConfirmSubscription":
+		h.ConfirmSubscription(w, r)
 	case "Unsubscribe":
 		h.Unsubscribe(w, r)
 	default:
@@ -82,6 +105,7 @@ func (h *Handler) Dispatch(w http.ResponseWriter, r *http.Request) {
 			"Unknown SNS Action",
 			action,
 		)
+		return
 	}
 }
 
@@ -99,21 +123,23 @@ func (h *Handler) CreateTopic(w http.ResponseWriter, r *http.Request) {
 			"Name is required",
 			"",
 		)
+		return
 	}
 
 	// Check if exists
-	_, err := h.Store.Get(topicName, "sns", "topic", ns)
+	_, err := h.Store.Get(r.Context(), topicName, "sns", "topic", ns)
 	if err == nil {
 		// Return existing ARN
 		resp := CreateTopicResponse{
 			CreateTopicResult: CreateTopicResult{
-				TopicArn: topicArn(topicName),
+				TopicArn: topicArn(r.Context(), topicName),
 			},
 			ResponseMetadata: ResponseMetadata{
 				RequestId: awsresponses.NextRequestID(),
 			},
 		}
 		awsresponses.WriteXML(w, resp)
+		return
 	}
 
 	// Create
@@ -131,13 +157,14 @@ func (h *Handler) CreateTopic(w http.ResponseWriter, r *http.Request) {
 		Attributes: buf,
 	}
 
-	if err := h.Store.Create(res); err != nil {
+	if err := h.Store.Create(r.Context(), res); err != nil {
 		awsresponses.WriteJSON(w, 500, err.Error())
+		return
 	}
 
 	resp := CreateTopicResponse{
 		CreateTopicResult: CreateTopicResult{
-			TopicArn: topicArn(topicName),
+			TopicArn: topicArn(r.Context(), topicName),
 		},
 		ResponseMetadata: ResponseMetadata{
 			RequestId: awsresponses.NextRequestID(),
@@ -152,22 +179,24 @@ func (h *Handler) ListTopics(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	ns := util.NamespaceFromHeader(r)
 
-	items, err := h.Store.List("sns", "topic", ns)
-	if err != nil {
-		awsresponses.WriteJSON(w, 500, err.Error())
+	page, serr := h.listPage(r.Context(), resource.Query{Service: "sns", Type: "topic", Namespace: ns}, r.FormValue("NextToken"))
+	if serr != nil {
+		writeError(w, serr, "")
+		return
 	}
 
 	members := []TopicArnMember{}
 
-	for _, it := range items {
+	for _, it := range page.Resources {
 		members = append(members, TopicArnMember{
-			TopicArn: topicArn(it.ID),
+			TopicArn: topicArn(r.Context(), it.ID),
 		})
 	}
 
 	resp := ListTopicsResponse{
 		ListTopicsResult: ListTopicsResult{
-			Topics: members,
+			Topics:    members,
+			NextToken: page.Next,
 		},
 		ResponseMetadata: ResponseMetadata{
 			RequestId: awsresponses.NextRequestID(),
@@ -177,6 +206,21 @@ func (h *Handler) ListTopics(w http.ResponseWriter, r *http.Request) {
 	awsresponses.WriteXML(w, resp)
 }
 
+// listPage runs one page of a List* action. SNS returns up to 100 entries
+// per call; NextToken is the store cursor.
+func (h *Handler) listPage(ctx context.Context, q resource.Query, nextToken string) (resource.Page, *snsError) {
+	q.Limit = listPageSize
+	q.Cursor = nextToken
+	page, err := h.Store.Query(ctx, q)
+	if errors.Is(err, resource.ErrInvalidCursor) {
+		return page, errInvalidParameter("Invalid parameter: NextToken")
+	}
+	if err != nil {
+		return page, &snsError{"InternalError", err.Error()}
+	}
+	return page, nil
+}
+
 // DeleteTopic
 func (h *Handler) DeleteTopic(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
@@ -195,6 +239,7 @@ func (h *Handler) DeleteTopic(w http.ResponseWriter, r *http.Request) {
 			"TopicArn is required",
 			"",
 		)
+		return
 	}
 
 	parts := strings.Split(arn, ":")
@@ -206,39 +251,32 @@ func (h *Handler) DeleteTopic(w http.ResponseWriter, r *http.Request) {
 			"Invalid TopicArn format",
 			arn,
 		)
+		return
 	}
 	name := parts[len(parts)-1]
 
-	// AWS allows idempotent delete - it's OK if the topic doesn't exist
-	_ = h.Store.Delete(name, "sns", "topic", ns)
-
-	resp := DeleteTopicResponse{
-		ResponseMetadata: ResponseMetadata{
-			RequestId: awsresponses.NextRequestID(),
-		},
+	// The topic's subscriptions go with it, as in AWS.
+	subs, err := h.Store.Query(r.Context(), resource.Query{
+		Service:   "sns",
+		Type:      "subscription",
+		Namespace: ns,
+		Match:     map[string]any{"topic_arn": arn},
+	})
+	if err != nil {
+		awsresponses.WriteJSON(w, http.StatusInternalServerError, err.Error())
+		return
 	}
-
-	awsresponses.WriteXML(w, resp)
-}
-
-// Publish (stub)
-func (h *Handler) Publish(w http.ResponseWriter, r *http.Request) {
-	r.ParseForm()
-	message := r.FormValue("Message")
-	if message == "" {
-		awsresponses.WriteErrorXML(
-			w,
-			http.StatusBadRequest,
-			"MissingParameter",
-			"Message is required",
-			"",
-		)
+	for _, sub := range subs.Resources {
+		if err := h.deleteSubscription(r.Context(), ns, sub.ID); err != nil {
+			awsresponses.WriteJSON(w, http.StatusInternalServerError, err.Error())
+			return
+		}
 	}
 
-	resp := PublishResponse{
-		PublishResult: PublishResult{
-			MessageId: uuid.NewString(),
-		},
+	// AWS allows idempotent delete - it's OK if the topic doesn't exist
+	_ = h.Store.Delete(r.Context(), name, "sns", "topic", ns)
+
+	resp := DeleteTopicResponse{
 		ResponseMetadata: ResponseMetadata{
 			RequestId: awsresponses.NextRequestID(),
 		},
@@ -265,13 +303,14 @@ func (h *Handler) GetTopicAttributes(w http.ResponseWriter, r *http.Request) {
 			"TopicArn is required",
 			"",
 		)
+		return
 	}
 
 	parts := strings.Split(arn, ":")
 	topicName := parts[len(parts)-1]
 
 	// Get topic from store
-	topic, err := h.Store.Get(topicName, "sns", "topic", ns)
+	topic, err := h.Store.Get(r.Context(), topicName, "sns", "topic", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(
 			w,
@@ -280,6 +319,7 @@ func (h *Handler) GetTopicAttributes(w http.ResponseWriter, r *http.Request) {
 			"Topic does not exist",
 			arn,
 		)
+		return
 	}
 
 	// Parse stored attributes
@@ -306,7 +346,7 @@ func (h *Handler) GetTopicAttributes(w http.ResponseWriter, r *http.Request) {
 	// Build response attributes with defaults
 	responseAttrs := make(map[string]string)
 	responseAttrs["TopicArn"] = arn
-	responseAttrs["Owner"] = "000000000000"
+	responseAttrs["Owner"] = awsarn.FromContext(r.Context()).AccountID
 
 	// Include all stored attributes (excluding empty strings)
 	// Special handling for Policy - AWS always returns it, defaulting to {} if not set
@@ -383,6 +423,7 @@ func (h *Handler) SetTopicAttributes(w http.ResponseWriter, r *http.Request) {
 			"TopicArn is required",
 			"",
 		)
+		return
 	}
 
 	if attributeName == "" {
@@ -393,13 +434,14 @@ func (h *Handler) SetTopicAttributes(w http.ResponseWriter, r *http.Request) {
 			"AttributeName is required",
 			"",
 		)
+		return
 	}
 
 	parts := strings.Split(arn, ":")
 	topicName := parts[len(parts)-1]
 
 	// Get topic from store
-	topic, err := h.Store.Get(topicName, "sns", "topic", ns)
+	_, err := h.Store.Get(r.Context(), topicName, "sns", "topic", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(
 			w,
@@ -408,58 +450,60 @@ func (h *Handler) SetTopicAttributes(w http.ResponseWriter, r *http.Request) {
 			"Topic does not exist",
 			arn,
 		)
+		return
 	}
 
-	// Parse existing attributes
-	var storedAttrs map[string]interface{}
-	if err := json.Unmarshal(topic.Attributes, &storedAttrs); err != nil {
-		storedAttrs = make(map[string]interface{})
-	}
+	_, err = h.Store.Mutate(r.Context(), topicName, "sns", "topic", ns, func(topic *resource.Resource) error {
+		// Parse existing attributes
+		var storedAttrs map[string]interface{}
+		if err := json.Unmarshal(topic.Attributes, &storedAttrs); err != nil {
+			storedAttrs = make(map[string]interface{})
+		}
 
-	// Get existing topic attributes (if any)
-	var topicAttrs map[string]string
-	if attrs, ok := storedAttrs["attributes"].(map[string]interface{}); ok {
-		topicAttrs = make(map[string]string)
-		for k, v := range attrs {
-			if str, ok := v.(string); ok {
-				topicAttrs[k] = str
+		// Get existing topic attributes (if any)
+		var topicAttrs map[string]string
+		if attrs, ok := storedAttrs["attributes"].(map[string]interface{}); ok {
+			topicAttrs = make(map[string]string)
+			for k, v := range attrs {
+				if str, ok := v.(string); ok {
+					topicAttrs[k] = str
+				}
 			}
+		} else if attrs, ok := storedAttrs["attributes"].(map[string]string); ok {
+			topicAttrs = attrs
+		} else {
+			topicAttrs = make(map[string]string)
 		}
-	} else if attrs, ok := storedAttrs["attributes"].(map[string]string); ok {
-		topicAttrs = attrs
-	} else {
-		topicAttrs = make(map[string]string)
-	}
 
-	// Update attribute
-	// If attribute value is empty string, remove it (AWS SNS behavior)
-	if attributeValue == "" {
-		delete(topicAttrs, attributeName)
-	} else {
-		topicAttrs[attributeName] = attributeValue
-	}
+		// Update attribute
+		// If attribute value is empty string, remove it (AWS SNS behavior)
+		if attributeValue == "" {
+			delete(topicAttrs, attributeName)
+		} else {
+			topicAttrs[attributeName] = attributeValue
+		}
 
-	// Update stored attributes
-	storedAttrs["attributes"] = topicAttrs
+		// Update stored attributes
+		storedAttrs["attributes"] = topicAttrs
 
-	// Preserve other fields like name and created_at
-	if _, ok := storedAttrs["name"]; !ok {
-		storedAttrs["name"] = topicName
-	}
-	if _, ok := storedAttrs["created_at"]; !ok {
-		storedAttrs["created_at"] = time.Now().UTC()
-	}
+		// Preserve other fields like name and created_at
+		if _, ok := storedAttrs["name"]; !ok {
+			storedAttrs["name"] = topicName
+		}
+		if _, ok := storedAttrs["created_at"]; !ok {
+			storedAttrs["created_at"] = time.Now().UTC()
+		}
 
-	// Marshal updated attributes
-	buf, err := json.Marshal(storedAttrs)
+		buf, err := json.Marshal(storedAttrs)
+		if err != nil {
+			return err
+		}
+		topic.Attributes = buf
+		return nil
+	})
 	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusInternalServerError, err.Error())
-	}
-
-	// Update topic in store
-	topic.Attributes = buf
-	if err := h.Store.Update(topic); err != nil {
-		awsresponses.WriteJSON(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	resp := SetTopicAttributesResponse{
@@ -489,6 +533,7 @@ func (h *Handler) ListTagsForResource(w http.ResponseWriter, r *http.Request) {
 			"ResourceArn is required",
 			"",
 		)
+		return
 	}
 
 	// Extract topic name from ARN
@@ -501,11 +546,12 @@ func (h *Handler) ListTagsForResource(w http.ResponseWriter, r *http.Request) {
 			"Invalid ResourceArn format",
 			arn,
 		)
+		return
 	}
 	topicName := parts[len(parts)-1]
 
 	// Get topic from store
-	topic, err := h.Store.Get(topicName, "sns", "topic", ns)
+	topic, err := h.Store.Get(r.Context(), topicName, "sns", "topic", ns)
 	if err != nil {
 		// AWS returns empty tags if resource doesn't exist
 		resp := ListTagsForResourceResponse{
@@ -519,6 +565,7 @@ func (h *Handler) ListTagsForResource(w http.ResponseWriter, r *http.Request) {
 			},
 		}
 		awsresponses.WriteXML(w, resp)
+		return
 	}
 
 	// Parse stored attributes
@@ -585,6 +632,7 @@ func (h *Handler) Subscribe(w http.ResponseWriter, r *http.Request) {
 			"TopicArn is required",
 			"",
 		)
+		return
 	}
 
 	if protocol == "" {
@@ -595,6 +643,7 @@ func (h *Handler) Subscribe(w http.ResponseWriter, r *http.Request) {
 			"Protocol is required",
 			"",
 		)
+		return
 	}
 
 	if endpoint == "" {
@@ -605,6 +654,7 @@ func (h *Handler) Subscribe(w http.ResponseWriter, r *http.Request) {
 			"Endpoint is required",
 			"",
 		)
+		return
 	}
 
 	// Extract topic name from ARN
@@ -617,11 +667,12 @@ func (h *Handler) Subscribe(w http.ResponseWriter, r *http.Request) {
 			"Invalid TopicArn format",
 			topicArn,
 		)
+		return
 	}
 	topicName := parts[len(parts)-1]
 
 	// Verify topic exists
-	_, err := h.Store.Get(topicName, "sns", "topic", ns)
+	_, err := h.Store.Get(r.Context(), topicName, "sns", "topic", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(
 			w,
@@ -630,11 +681,12 @@ func (h *Handler) Subscribe(w http.ResponseWriter, r *http.Request) {
 			"Topic does not exist",
 			topicArn,
 		)
+		return
 	}
 
 	// Generate subscription ID (using UUID for uniqueness)
 	subscriptionID := uuid.NewString()
-	subscriptionArn := subscriptionArn(subscriptionID)
+	subscriptionArn := subscriptionArn(r.Context(), subscriptionID)
 
 	// Create subscription entry
 	entry := map[string]any{
@@ -643,6 +695,22 @@ func (h *Handler) Subscribe(w http.ResponseWriter, r *http.Request) {
 		"endpoint":   endpoint,
 		"created_at": time.Now().UTC(),
 	}
+	attrs := formEntries(r, "Attributes.entry")
+	if serr := validateSubscriptionAttributes(attrs); serr != nil {
+		writeError(w, serr, topicArn)
+		return
+	}
+	if len(attrs) > 0 {
+		entry["attributes"] = attrs
+	}
+
+	// http/https endpoints must confirm before they receive notifications
+	token := ""
+	if requiresConfirmation(protocol) {
+		token = util.RandomHex(64)
+		entry["pending_confirmation"] = true
+		entry["token"] = token
+	}
 
 	buf, _ := json.Marshal(entry)
 	res := &resource.Resource{
@@ -653,8 +721,22 @@ func (h *Handler) Subscribe(w http.ResponseWriter, r *http.Request) {
 		Attributes: buf,
 	}
 
-	if err := h.Store.Create(res); err != nil {
+	if err := h.Store.Create(r.Context(), res); err != nil {
 		awsresponses.WriteJSON(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if token != "" {
+		h.requestConfirmation(r.Context(), ns, &subscription{
+			ID:       subscriptionID,
+			TopicArn: topicArn,
+			Protocol: protocol,
+			Endpoint: endpoint,
+			Token:    token,
+		})
+		if r.FormValue("ReturnSubscriptionArn") != "true" {
+			subscriptionArn = pendingConfirmationArn
+		}
 	}
 
 	resp := SubscribeResponse{
@@ -687,6 +769,7 @@ func (h *Handler) GetSubscriptionAttributes(w http.ResponseWriter, r *http.Reque
 			"SubscriptionArn is required",
 			"",
 		)
+		return
 	}
 
 	// Extract subscription ID from ARN
@@ -700,11 +783,12 @@ func (h *Handler) GetSubscriptionAttributes(w http.ResponseWriter, r *http.Reque
 			"Invalid SubscriptionArn format",
 			subscriptionArn,
 		)
+		return
 	}
 	subscriptionID := parts[len(parts)-1]
 
 	// Get subscription from store
-	subscription, err := h.Store.Get(subscriptionID, "sns", "subscription", ns)
+	subscription, err := h.Store.Get(r.Context(), subscriptionID, "sns", "subscription", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(
 			w,
@@ -713,6 +797,7 @@ func (h *Handler) GetSubscriptionAttributes(w http.ResponseWriter, r *http.Reque
 			"Subscription does not exist",
 			subscriptionArn,
 		)
+		return
 	}
 
 	// Parse stored attributes
@@ -741,9 +826,26 @@ func (h *Handler) GetSubscriptionAttributes(w http.ResponseWriter, r *http.Reque
 	responseAttrs["TopicArn"] = topicArn
 	responseAttrs["Protocol"] = protocol
 	responseAttrs["Endpoint"] = endpoint
-	responseAttrs["Owner"] = snsAccount
+	responseAttrs["Owner"] = awsarn.FromContext(r.Context()).AccountID
 	responseAttrs["ConfirmationWasAuthenticated"] = "true"
 	responseAttrs["PendingConfirmation"] = "false"
+	if pending, _ := storedAttrs["pending_confirmation"].(bool); pending {
+		responseAttrs["ConfirmationWasAuthenticated"] = "false"
+		responseAttrs["PendingConfirmation"] = "true"
+	}
+	responseAttrs["RawMessageDelivery"] = "false"
+	if attrs, ok := storedAttrs["attributes"].(map[string]interface{}); ok {
+		for k, v := range attrs {
+			if str, ok := v.(string); ok {
+				responseAttrs[k] = str
+			}
+		}
+	}
+	if _, ok := responseAttrs["FilterPolicy"]; ok {
+		if _, ok := responseAttrs["FilterPolicyScope"]; !ok {
+			responseAttrs["FilterPolicyScope"] = scopeMessageAttributes
+		}
+	}
 
 	// Convert map to slice of AttributeEntry
 	var entries []AttributeEntry
@@ -768,6 +870,109 @@ func (h *Handler) GetSubscriptionAttributes(w http.ResponseWriter, r *http.Reque
 	awsresponses.WriteXML(w, resp)
 }
 
+// SetSubscriptionAttributes
+func (h *Handler) SetSubscriptionAttributes(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	ns := util.NamespaceFromHeader(r)
+	subscriptionArn := r.FormValue("SubscriptionArn")
+	attributeName := r.FormValue("AttributeName")
+	attributeValue := r.FormValue("AttributeValue")
+
+	if subscriptionArn == "" {
+		awsresponses.WriteErrorXML(
+			w,
+			http.StatusBadRequest,
+			"MissingParameter",
+			"SubscriptionArn is required",
+			"",
+		)
+		return
+	}
+
+	if attributeName == "" {
+		awsresponses.WriteErrorXML(
+			w,
+			http.StatusBadRequest,
+			"MissingParameter",
+			"AttributeName is required",
+			"",
+		)
+		return
+	}
+
+	if !subscriptionAttributeNames[attributeName] {
+		writeError(w, errInvalidParameter("Invalid parameter: AttributeName"), subscriptionArn)
+		return
+	}
+
+	parts := strings.Split(subscriptionArn, ":")
+	subscriptionID := parts[len(parts)-1]
+	_, err := h.Store.Get(r.Context(), subscriptionID, "sns", "subscription", ns)
+	if err != nil {
+		awsresponses.WriteErrorXML(
+			w,
+			http.StatusNotFound,
+			"NotFound",
+			"Subscription does not exist",
+			subscriptionArn,
+		)
+		return
+	}
+
+	_, err = h.Store.Mutate(r.Context(), subscriptionID, "sns", "subscription", ns, func(subscription *resource.Resource) error {
+		// Parse existing attributes
+		var storedAttrs map[string]interface{}
+		if err := json.Unmarshal(subscription.Attributes, &storedAttrs); err != nil {
+			storedAttrs = make(map[string]interface{})
+		}
+
+		subAttrs := make(map[string]string)
+		if attrs, ok := storedAttrs["attributes"].(map[string]interface{}); ok {
+			for k, v := range attrs {
+				if str, ok := v.(string); ok {
+					subAttrs[k] = str
+				}
+			}
+		}
+
+		// An empty value clears the attribute
+		if attributeValue == "" {
+			delete(subAttrs, attributeName)
+		} else {
+			subAttrs[attributeName] = attributeValue
+		}
+
+		if serr := validateSubscriptionAttributes(subAttrs); serr != nil {
+			return serr
+		}
+
+		storedAttrs["attributes"] = subAttrs
+		buf, err := json.Marshal(storedAttrs)
+		if err != nil {
+			return err
+		}
+		subscription.Attributes = buf
+		return nil
+	})
+	var serr *snsError
+	if errors.As(err, &serr) {
+		writeError(w, serr, subscriptionArn)
+		return
+	}
+	if err != nil {
+		awsresponses.WriteJSON(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := SetSubscriptionAttributesResponse{
+		ResponseMetadata: ResponseMetadata{
+			RequestId: awsresponses.NextRequestID(),
+		},
+	}
+
+	awsresponses.WriteXML(w, resp)
+}
+
 // ListSubscriptionsByTopic
 func (h *Handler) ListSubscriptionsByTopic(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
@@ -786,33 +991,29 @@ func (h *Handler) ListSubscriptionsByTopic(w http.ResponseWriter, r *http.Reques
 			"TopicArn is required",
 			"",
 		)
+		return
 	}
 
-	// List all subscriptions in the namespace
-	items, err := h.Store.List("sns", "subscription", ns)
-	if err != nil {
-		awsresponses.WriteJSON(w, http.StatusInternalServerError, err.Error())
+	// List the topic's subscriptions a page at a time
+	page, serr := h.listPage(r.Context(), resource.Query{
+		Service:   "sns",
+		Type:      "subscription",
+		Namespace: ns,
+		Match:     map[string]any{"topic_arn": topicArn},
+	}, r.FormValue("NextToken"))
+	if serr != nil {
+		writeError(w, serr, topicArn)
+		return
 	}
 
-	// Filter subscriptions by topic_arn and build response
 	var subscriptions []Subscription
-	for _, item := range items {
+	for _, item := range page.Resources {
 		// Parse stored attributes
 		var storedAttrs map[string]interface{}
 		if err := json.Unmarshal(item.Attributes, &storedAttrs); err != nil {
 			continue
 		}
 
-		// Check if this subscription belongs to the requested topic
-		storedTopicArn := ""
-		if ta, ok := storedAttrs["topic_arn"].(string); ok {
-			storedTopicArn = ta
-		}
-
-		if storedTopicArn != topicArn {
-			continue
-		}
-
 		// Extract subscription details
 		protocol := ""
 		if p, ok := storedAttrs["protocol"].(string); ok {
@@ -823,15 +1024,18 @@ func (h *Handler) ListSubscriptionsByTopic(w http.ResponseWriter, r *http.Reques
 			endpoint = e
 		}
 
-		// Build subscription ARN
-		subscriptionArn := subscriptionArn(item.ID)
+		// Build subscription ARN; unconfirmed subscriptions have none yet
+		subscriptionArn := subscriptionArn(r.Context(), item.ID)
+		if pending, _ := storedAttrs["pending_confirmation"].(bool); pending {
+			subscriptionArn = "PendingConfirmation"
+		}
 
 		subscriptions = append(subscriptions, Subscription{
 			SubscriptionArn: subscriptionArn,
 			TopicArn:        topicArn,
 			Protocol:        protocol,
 			Endpoint:        endpoint,
-			Owner:           snsAccount,
+			Owner:           awsarn.FromContext(r.Context()).AccountID,
 		})
 	}
 
@@ -840,6 +1044,7 @@ func (h *Handler) ListSubscriptionsByTopic(w http.ResponseWriter, r *http.Reques
 			Subscriptions: Subscriptions{
 				Subscriptions: subscriptions,
 			},
+			NextToken: page.Next,
 		},
 		ResponseMetadata: ResponseMetadata{
 			RequestId: awsresponses.NextRequestID(),
@@ -852,7 +1057,7 @@ func (h *Handler) ListSubscriptionsByTopic(w http.ResponseWriter, r *http.Reques
 // Unsubscribe
 func (h *Handler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
-	ns := util.NamespaceFromHeader(r)
+	ns := LinkNamespace(r)
 	r.ParseForm()
 	subscriptionArn := r.FormValue("SubscriptionArn")
 	if subscriptionArn == "" {
@@ -867,6 +1072,7 @@ func (h *Handler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
 			"SubscriptionArn is required",
 			"",
 		)
+		return
 	}
 
 	// Extract subscription ID from ARN
@@ -880,11 +1086,15 @@ func (h *Handler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
 			"Invalid SubscriptionArn format",
 			subscriptionArn,
 		)
+		return
 	}
 	subscriptionID := parts[len(parts)-1]
 
 	// AWS allows idempotent unsubscribe - it's OK if the subscription doesn't exist
-	_ = h.Store.Delete(subscriptionID, "sns", "subscription", ns)
+	if err := h.deleteSubscription(r.Context(), ns, subscriptionID); err != nil {
+		awsresponses.WriteJSON(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
 	resp := UnsubscribeResponse{
 		ResponseMetadata: ResponseMetadata{
@@ -6,6 +6,8 @@ package sns_test
 
 import (
 	"encoding/json"
+	"encoding/xml"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -14,71 +16,20 @@ import (
 
 	"opensnack/internal/api/sns"
 	"opensnack/internal/resource"
-
-	"github.com/labstack/echo/v4"
 )
 
-//
-// MockStore (identical pattern to SQS & S3 tests)
-//
-
-type MockStore struct {
-	data map[string]resource.Resource
-}
-
-func NewMockStore() *MockStore {
-	return &MockStore{data: map[string]resource.Resource{}}
-}
-
-func key(id, ns string) string { return ns + "|" + id }
-
-func (m *MockStore) Create(r *resource.Resource) error {
-	m.data[key(r.ID, r.Namespace)] = *r
-	return nil
-}
-
-func (m *MockStore) Update(r *resource.Resource) error {
-	m.data[key(r.ID, r.Namespace)] = *r
-	return nil
-}
-
-func (m *MockStore) Get(id, service, typ, ns string) (*resource.Resource, error) {
-	v, ok := m.data[key(id, ns)]
-	if !ok {
-		return nil, echo.NewHTTPError(http.StatusNotFound)
-	}
-	return &v, nil
-}
-
-func (m *MockStore) List(service, typ, ns string) ([]resource.Resource, error) {
-	out := []resource.Resource{}
-	for _, v := range m.data {
-		if v.Service == service && v.Type == typ && v.Namespace == ns {
-			out = append(out, v)
-		}
-	}
-	return out, nil
-}
-
-func (m *MockStore) Delete(id, service, typ, ns string) error {
-	delete(m.data, key(id, ns))
-	return nil
-}
-
 // Helper
-func newCtx(method, target string, body *strings.Reader) (echo.Context, *httptest.ResponseRecorder, *echo.Echo) {
-	e := echo.New()
-
+func newCtx(method, target string, body *strings.Reader) (*http.Request, *httptest.ResponseRecorder) {
 	if body == nil {
 		body = strings.NewReader("")
 	}
 
 	req := httptest.NewRequest(method, target, body)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("X-Opensnack-Namespace", "ns1")
+	req.Header.Set("User-Agent", "opensnack-test custom-ns1")
 
 	rec := httptest.NewRecorder()
-	return e.NewContext(req, rec), rec, e
+	return req, rec
 }
 
 //
@@ -86,16 +37,13 @@ func newCtx(method, target string, body *strings.Reader) (echo.Context, *httptes
 //
 
 func TestCreateTopic(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := sns.NewHandler(store)
 
 	body := strings.NewReader("Name=mytopic")
-	c, rec, _ := newCtx("POST", "/sns?Action=CreateTopic", body)
+	req, rec := newCtx("POST", "/sns?Action=CreateTopic", body)
 
-	err := h.Dispatch(c)
-	if err != nil {
-		t.Fatal(err)
-	}
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
@@ -107,16 +55,16 @@ func TestCreateTopic(t *testing.T) {
 }
 
 func TestCreateTopic_Idempotent(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := sns.NewHandler(store)
 
 	body := strings.NewReader("Name=dup")
-	c1, _, _ := newCtx("POST", "/sns?Action=CreateTopic", body)
-	_ = h.Dispatch(c1)
+	req1, _ := newCtx("POST", "/sns?Action=CreateTopic", body)
+	h.Dispatch(httptest.NewRecorder(), req1)
 
 	body2 := strings.NewReader("Name=dup")
-	c2, rec2, _ := newCtx("POST", "/sns?Action=CreateTopic", body2)
-	_ = h.Dispatch(c2)
+	req2, rec2 := newCtx("POST", "/sns?Action=CreateTopic", body2)
+	h.Dispatch(rec2, req2)
 
 	if rec2.Code != 200 {
 		t.Fatalf("expected 200 for idempotent create")
@@ -124,7 +72,7 @@ func TestCreateTopic_Idempotent(t *testing.T) {
 }
 
 func TestListTopics(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := sns.NewHandler(store)
 
 	// seed two topics
@@ -132,7 +80,7 @@ func TestListTopics(t *testing.T) {
 		buf, _ := json.Marshal(map[string]any{
 			"name": name, "created_at": time.Now(),
 		})
-		store.Create(&resource.Resource{
+		store.Create(t.Context(), &resource.Resource{
 			ID:         name,
 			Namespace:  "ns1",
 			Service:    "sns",
@@ -141,8 +89,8 @@ func TestListTopics(t *testing.T) {
 		})
 	}
 
-	c, rec, _ := newCtx("POST", "/sns?Action=ListTopics", nil)
-	_ = h.Dispatch(c)
+	req, rec := newCtx("POST", "/sns?Action=ListTopics", nil)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
@@ -153,13 +101,57 @@ func TestListTopics(t *testing.T) {
 	}
 }
 
+func TestListTopics_NextToken(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sns.NewHandler(store)
+
+	for i := 0; i < 150; i++ {
+		store.Create(t.Context(), &resource.Resource{
+			ID:         fmt.Sprintf("topic-%03d", i),
+			Namespace:  "ns1",
+			Service:    "sns",
+			Type:       "topic",
+			Attributes: []byte(`{}`),
+		})
+	}
+
+	req, rec := newCtx("POST", "/sns?Action=ListTopics", nil)
+	h.Dispatch(rec, req)
+	var first sns.ListTopicsResponse
+	if err := xml.Unmarshal(rec.Body.Bytes(), &first); err != nil {
+		t.Fatalf("bad list response: %s", rec.Body.String())
+	}
+	if len(first.ListTopicsResult.Topics) != 100 || first.ListTopicsResult.NextToken == "" {
+		t.Fatalf("expected a full first page and a NextToken, got %d topics, token %q",
+			len(first.ListTopicsResult.Topics), first.ListTopicsResult.NextToken)
+	}
+
+	req, rec = newCtx("POST", "/sns?Action=ListTopics", strings.NewReader("NextToken="+first.ListTopicsResult.NextToken))
+	h.Dispatch(rec, req)
+	var second sns.ListTopicsResponse
+	xml.Unmarshal(rec.Body.Bytes(), &second)
+	topics := second.ListTopicsResult.Topics
+	if len(topics) != 50 || second.ListTopicsResult.NextToken != "" {
+		t.Fatalf("expected the last 50 topics and no NextToken, got %d, token %q", len(topics), second.ListTopicsResult.NextToken)
+	}
+	if topics[0].TopicArn != "arn:aws:sns:us-east-1:000000000000:topic-100" {
+		t.Fatalf("second page starts at %s", topics[0].TopicArn)
+	}
+
+	req, rec = newCtx("POST", "/sns?Action=ListTopics", strings.NewReader("NextToken=bogus"))
+	h.Dispatch(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "InvalidParameter") {
+		t.Fatalf("expected InvalidParameter for a bad NextToken, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
 func TestDeleteTopic(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := sns.NewHandler(store)
 
 	name := "deadtopic"
 	buf, _ := json.Marshal(map[string]any{"name": name})
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:         name,
 		Namespace:  "ns1",
 		Service:    "sns",
@@ -169,8 +161,8 @@ func TestDeleteTopic(t *testing.T) {
 
 	arn := "arn:aws:sns:us-east-1:000000000000:" + name
 
-	c, rec, _ := newCtx("POST", "/sns?Action=DeleteTopic&TopicArn="+arn, nil)
-	_ = h.Dispatch(c)
+	req, rec := newCtx("POST", "/sns?Action=DeleteTopic&TopicArn="+arn, nil)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
@@ -178,13 +170,22 @@ func TestDeleteTopic(t *testing.T) {
 }
 
 func TestPublish(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := sns.NewHandler(store)
 
-	body := strings.NewReader("Message=hello")
-	c, rec, _ := newCtx("POST", "/sns?Action=Publish", body)
+	buf, _ := json.Marshal(map[string]any{"name": "news"})
+	store.Create(t.Context(), &resource.Resource{
+		ID:         "news",
+		Namespace:  "ns1",
+		Service:    "sns",
+		Type:       "topic",
+		Attributes: buf,
+	})
+
+	body := strings.NewReader("Message=hello&TopicArn=arn:aws:sns:us-east-1:000000000000:news")
+	req, rec := newCtx("POST", "/sns?Action=Publish", body)
 
-	_ = h.Dispatch(c)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
@@ -0,0 +1,708 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sns
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"opensnack/internal/api/sqs"
+	"opensnack/internal/awsarn"
+	"opensnack/internal/awsresponses"
+	"opensnack/internal/resource"
+	"opensnack/internal/util"
+
+	"github.com/google/uuid"
+)
+
+//
+// PUBLISH & FAN-OUT
+//
+// Publish delivers a message to every subscription of a topic before it
+// returns, so local tests can assert on the result straight away. http
+// and https endpoints are sent to in parallel and given DeliveryDeadline
+// in all, so a slow endpoint cannot hold up the request for long:
+//
+//   - sqs:        the message is enqueued in the target queue, wrapped in
+//                 the standard SNS JSON envelope unless RawMessageDelivery
+//                 is set on the subscription;
+//   - http/https: the envelope (or raw body) is POSTed to the endpoint;
+//   - lambda:     there is no local runtime, so the event that would have
+//                 been passed to the function is recorded.
+//
+// Every attempt is stored as a delivery record (service "sns", type
+// "delivery") with its status, so failed deliveries can be inspected.
+// Only the latest maxDeliveryRecords of each subscription are kept, and
+// they go when the subscription does.
+//
+
+const (
+	maxPublishBatchEntries = 10
+	maxMessageBytes        = 262144
+	maxMessageAttributes   = 10
+	deliveryAttempts       = 3
+	deliveryRetryDelay     = 100 * time.Millisecond
+	deliveryTimeout        = 5 * time.Second
+	deliveryDeadline       = 5 * time.Second
+	maxDeliveryRecords     = 100
+
+	// opensnack does not sign notifications; receivers must not verify them.
+	notificationSignature = "EXAMPLE"
+)
+
+// Delivery statuses stored on delivery records.
+const (
+	deliveryDelivered = "DELIVERED"
+	deliveryFailed    = "FAILED"
+	deliveryRecorded  = "RECORDED"
+)
+
+// snsError is rendered by the caller as a Query API error.
+type snsError struct {
+	Code    string
+	Message string
+}
+
+func (e *snsError) Error() string { return e.Code + ": " + e.Message }
+
+func errInvalidParameter(format string, args ...any) *snsError {
+	return &snsError{"InvalidParameter", fmt.Sprintf(format, args...)}
+}
+
+func writeError(w http.ResponseWriter, e *snsError, resource string) {
+	status := http.StatusBadRequest
+	switch e.Code {
+	case "NotFound":
+		status = http.StatusNotFound
+	case "InternalError":
+		status = http.StatusInternalServerError
+	}
+	awsresponses.WriteErrorXML(w, status, e.Code, e.Message, resource)
+}
+
+type messageAttribute struct {
+	DataType    string
+	StringValue string
+	BinaryValue []byte
+}
+
+type publishInput struct {
+	Message                string
+	Subject                string
+	MessageStructure       string
+	MessageAttributes      map[string]messageAttribute
+	MessageGroupId         string
+	MessageDeduplicationId string
+}
+
+// subscription is the stored form of an SNS subscription.
+type subscription struct {
+	ID         string            `json:"-"`
+	TopicArn   string            `json:"topic_arn"`
+	Protocol   string            `json:"protocol"`
+	Endpoint   string            `json:"endpoint"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// PendingConfirmation is set on http/https subscriptions until the
+	// endpoint confirms them with Token.
+	PendingConfirmation bool   `json:"pending_confirmation,omitempty"`
+	Token               string `json:"token,omitempty"`
+}
+
+func (s *subscription) rawDelivery() bool {
+	return strings.EqualFold(s.Attributes["RawMessageDelivery"], "true")
+}
+
+type envelopeAttribute struct {
+	Type  string `json:"Type"`
+	Value string `json:"Value"`
+}
+
+// notification is the JSON envelope SNS wraps around delivered messages.
+type notification struct {
+	Type              string                       `json:"Type"`
+	MessageId         string                       `json:"MessageId"`
+	TopicArn          string                       `json:"TopicArn"`
+	Subject           string                       `json:"Subject,omitempty"`
+	Message           string                       `json:"Message"`
+	Timestamp         string                       `json:"Timestamp"`
+	SignatureVersion  string                       `json:"SignatureVersion"`
+	Signature         string                       `json:"Signature"`
+	SigningCertURL    string                       `json:"SigningCertURL"`
+	UnsubscribeURL    string                       `json:"UnsubscribeURL"`
+	MessageAttributes map[string]envelopeAttribute `json:"MessageAttributes,omitempty"`
+}
+
+type deliveryRecord struct {
+	MessageId       string    `json:"message_id"`
+	MessageType     string    `json:"message_type"`
+	TopicArn        string    `json:"topic_arn"`
+	SubscriptionArn string    `json:"subscription_arn"`
+	Protocol        string    `json:"protocol"`
+	Endpoint        string    `json:"endpoint"`
+	Status          string    `json:"status"`
+	StatusCode      int       `json:"status_code,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	Attempts        int       `json:"attempts"`
+	Payload         string    `json:"payload"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func signingCertURL(ctx context.Context) string {
+	return "https://sns." + awsarn.FromContext(ctx).Region + ".amazonaws.com/SimpleNotificationService-opensnack.pem"
+}
+
+func unsubscribeURL(ctx context.Context, ns, subArn string) string {
+	return awsarn.FromContext(ctx).URL() + "?Action=Unsubscribe&Version=" + APIVersion +
+		"&SubscriptionArn=" + url.QueryEscape(subArn) + namespaceQuery(ns)
+}
+
+// lookupTopic resolves a topic ARN to its stored resource.
+func (h *Handler) lookupTopic(ctx context.Context, ns, arn string) (*resource.Resource, *snsError) {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 6 {
+		return nil, errInvalidParameter("Invalid parameter: TopicArn")
+	}
+	topic, err := h.Store.Get(ctx, parts[len(parts)-1], "sns", "topic", ns)
+	if err != nil || topic == nil {
+		return nil, &snsError{"NotFound", "Topic does not exist"}
+	}
+	return topic, nil
+}
+
+// topicAttributes returns the user-settable attributes stored with a topic.
+func topicAttributes(topic *resource.Resource) map[string]string {
+	var stored struct {
+		Attributes map[string]string `json:"attributes"`
+	}
+	_ = json.Unmarshal(topic.Attributes, &stored)
+	if stored.Attributes == nil {
+		stored.Attributes = map[string]string{}
+	}
+	return stored.Attributes
+}
+
+// topicSubscriptions lists the subscriptions attached to a topic.
+func (h *Handler) topicSubscriptions(ctx context.Context, ns, arn string) ([]subscription, error) {
+	page, err := h.Store.Query(ctx, resource.Query{
+		Service:   "sns",
+		Type:      "subscription",
+		Namespace: ns,
+		Match:     map[string]any{"topic_arn": arn},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var subs []subscription
+	for _, item := range page.Resources {
+		var sub subscription
+		if err := json.Unmarshal(item.Attributes, &sub); err != nil {
+			continue
+		}
+		sub.ID = item.ID
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// validatePublish checks a message before any delivery is attempted.
+func validatePublish(topic *resource.Resource, in *publishInput) *snsError {
+	if in.Message == "" {
+		return errInvalidParameter("Invalid parameter: Empty message")
+	}
+	if len(in.Message) > maxMessageBytes {
+		return errInvalidParameter("Invalid parameter: Message too long")
+	}
+	if len(in.Subject) > 100 {
+		return errInvalidParameter("Invalid parameter: Subject")
+	}
+	if in.MessageStructure != "" {
+		if in.MessageStructure != "json" {
+			return errInvalidParameter("Invalid parameter: MessageStructure")
+		}
+		var bodies map[string]any
+		if err := json.Unmarshal([]byte(in.Message), &bodies); err != nil {
+			return errInvalidParameter("Invalid parameter: Message Structure - JSON message body failed to parse")
+		}
+		if _, ok := bodies["default"].(string); !ok {
+			return errInvalidParameter("Invalid parameter: Message Structure - No default entry in JSON message body")
+		}
+	}
+	if len(in.MessageAttributes) > maxMessageAttributes {
+		return errInvalidParameter("Number of message attributes [%d] exceeds the allowed maximum [%d].", len(in.MessageAttributes), maxMessageAttributes)
+	}
+	for name, attr := range in.MessageAttributes {
+		typ := strings.SplitN(attr.DataType, ".", 2)[0]
+		switch typ {
+		case "String", "Number":
+			if attr.StringValue == "" {
+				return &snsError{"ParameterValueInvalid", fmt.Sprintf("The message attribute '%s' must contain non-empty message attribute value for message attribute type '%s'.", name, typ)}
+			}
+		case "Binary":
+			if len(attr.BinaryValue) == 0 {
+				return &snsError{"ParameterValueInvalid", fmt.Sprintf("The message attribute '%s' must contain non-empty message attribute value for message attribute type 'Binary'.", name)}
+			}
+		default:
+			return &snsError{"ParameterValueInvalid", fmt.Sprintf("The message attribute '%s' has an invalid message attribute type, the set of supported type prefixes is Binary, Number, and String.", name)}
+		}
+	}
+
+	if strings.HasSuffix(topic.ID, ".fifo") {
+		if in.MessageGroupId == "" {
+			return errInvalidParameter("Invalid parameter: The MessageGroupId parameter is required for FIFO topics")
+		}
+		if in.MessageDeduplicationId == "" {
+			if topicAttributes(topic)["ContentBasedDeduplication"] != "true" {
+				return errInvalidParameter("Invalid parameter: The topic should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly")
+			}
+			sum := sha256.Sum256([]byte(in.Message))
+			in.MessageDeduplicationId = hex.EncodeToString(sum[:])
+		}
+	} else if in.MessageGroupId != "" || in.MessageDeduplicationId != "" {
+		return errInvalidParameter("Invalid parameter: The request includes MessageGroupId or MessageDeduplicationId parameters, which are only supported for FIFO topics")
+	}
+	return nil
+}
+
+// publish validates a message and fans it out to every confirmed
+// subscription of the topic whose filter policy accepts it. http/https
+// deliveries run in parallel and give up at deadline. Delivery failures
+// are recorded, not returned.
+func (h *Handler) publish(ctx context.Context, ns string, topic *resource.Resource, arn string, in publishInput, deadline time.Time) (string, *snsError) {
+	if serr := validatePublish(topic, &in); serr != nil {
+		return "", serr
+	}
+	subs, err := h.topicSubscriptions(ctx, ns, arn)
+	if err != nil {
+		return "", &snsError{"InternalError", err.Error()}
+	}
+
+	endpointCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	var wg sync.WaitGroup
+
+	messageID := uuid.NewString()
+	now := time.Now().UTC()
+	for i := range subs {
+		if subs[i].PendingConfirmation || !subs[i].accepts(in) {
+			continue
+		}
+		if requiresConfirmation(subs[i].Protocol) {
+			wg.Go(func() { h.deliver(endpointCtx, ns, arn, messageID, now, &subs[i], in) })
+			continue
+		}
+		h.deliver(ctx, ns, arn, messageID, now, &subs[i], in)
+	}
+	wg.Wait()
+	return messageID, nil
+}
+
+// messageFor picks the per-protocol body of a MessageStructure=json message.
+func messageFor(in publishInput, protocol string) string {
+	if in.MessageStructure != "json" {
+		return in.Message
+	}
+	var bodies map[string]any
+	_ = json.Unmarshal([]byte(in.Message), &bodies)
+	if s, ok := bodies[protocol].(string); ok {
+		return s
+	}
+	s, _ := bodies["default"].(string)
+	return s
+}
+
+func buildNotification(ctx context.Context, ns, arn, messageID string, at time.Time, sub *subscription, in publishInput) notification {
+	n := notification{
+		Type:             "Notification",
+		MessageId:        messageID,
+		TopicArn:         arn,
+		Subject:          in.Subject,
+		Message:          messageFor(in, sub.Protocol),
+		Timestamp:        at.Format("2006-01-02T15:04:05.000Z"),
+		SignatureVersion: "1",
+		Signature:        notificationSignature,
+		SigningCertURL:   signingCertURL(ctx),
+		UnsubscribeURL:   unsubscribeURL(ctx, ns, subscriptionArn(ctx, sub.ID)),
+	}
+	if len(in.MessageAttributes) > 0 {
+		n.MessageAttributes = map[string]envelopeAttribute{}
+		for name, attr := range in.MessageAttributes {
+			value := attr.StringValue
+			if strings.HasPrefix(attr.DataType, "Binary") {
+				value = base64.StdEncoding.EncodeToString(attr.BinaryValue)
+			}
+			n.MessageAttributes[name] = envelopeAttribute{Type: attr.DataType, Value: value}
+		}
+	}
+	return n
+}
+
+// deliver sends one message to one subscription and records the outcome.
+func (h *Handler) deliver(ctx context.Context, ns, arn, messageID string, at time.Time, sub *subscription, in publishInput) {
+	n := buildNotification(ctx, ns, arn, messageID, at, sub, in)
+	envelope, _ := json.Marshal(n)
+
+	rec := deliveryRecord{
+		MessageId:       messageID,
+		MessageType:     "Notification",
+		TopicArn:        arn,
+		SubscriptionArn: subscriptionArn(ctx, sub.ID),
+		Protocol:        sub.Protocol,
+		Endpoint:        sub.Endpoint,
+		Payload:         string(envelope),
+		CreatedAt:       at,
+	}
+	if sub.rawDelivery() {
+		rec.Payload = n.Message
+	}
+
+	switch sub.Protocol {
+	case "sqs":
+		h.deliverToQueue(ctx, ns, sub, in, &rec)
+	case "http", "https":
+		h.deliverToEndpoint(ctx, sub, &rec)
+	case "lambda":
+		h.deliverToFunction(ctx, ns, sub, n, &rec)
+	default:
+		// email, sms, application: nothing to send to locally.
+		rec.Status = deliveryRecorded
+	}
+
+	h.saveDelivery(ctx, ns, sub.ID, &rec)
+}
+
+func (h *Handler) deliverToQueue(ctx context.Context, ns string, sub *subscription, in publishInput, rec *deliveryRecord) {
+	msg := sqs.QueueMessage{
+		Body:                   rec.Payload,
+		MessageGroupId:         in.MessageGroupId,
+		MessageDeduplicationId: in.MessageDeduplicationId,
+	}
+	if sub.rawDelivery() && len(in.MessageAttributes) > 0 {
+		msg.MessageAttributes = map[string]sqs.MessageAttributeValue{}
+		for name, attr := range in.MessageAttributes {
+			msg.MessageAttributes[name] = sqs.MessageAttributeValue{
+				DataType:    attr.DataType,
+				StringValue: attr.StringValue,
+				BinaryValue: attr.BinaryValue,
+			}
+		}
+	}
+
+	rec.Attempts = 1
+	if _, err := h.Queues.SendToQueue(ctx, ns, sub.Endpoint, msg); err != nil {
+		rec.Status = deliveryFailed
+		rec.Error = err.Error()
+		return
+	}
+	rec.Status = deliveryDelivered
+}
+
+// deliverToEndpoint POSTs rec.Payload to an http/https subscription,
+// retrying failed attempts until ctx is done.
+func (h *Handler) deliverToEndpoint(ctx context.Context, sub *subscription, rec *deliveryRecord) {
+	for rec.Attempts < deliveryAttempts {
+		if rec.Attempts > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(deliveryRetryDelay * time.Duration(rec.Attempts)):
+			}
+		}
+		rec.Attempts++
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewBufferString(rec.Payload))
+		if err != nil {
+			rec.Status = deliveryFailed
+			rec.Error = err.Error()
+			return
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+		req.Header.Set("User-Agent", "Amazon Simple Notification Service Agent")
+		req.Header.Set("x-amz-sns-message-type", rec.MessageType)
+		req.Header.Set("x-amz-sns-message-id", rec.MessageId)
+		req.Header.Set("x-amz-sns-topic-arn", rec.TopicArn)
+		if rec.MessageType == "Notification" {
+			req.Header.Set("x-amz-sns-subscription-arn", rec.SubscriptionArn)
+			if sub.rawDelivery() {
+				req.Header.Set("x-amz-sns-rawdelivery", "true")
+			}
+		}
+
+		resp, err := h.Client.Do(req)
+		if err != nil {
+			rec.Status = deliveryFailed
+			rec.Error = err.Error()
+			continue
+		}
+		resp.Body.Close()
+		rec.StatusCode = resp.StatusCode
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			rec.Status = deliveryDelivered
+			rec.Error = ""
+			return
+		}
+		rec.Status = deliveryFailed
+		rec.Error = "endpoint returned " + resp.Status
+	}
+}
+
+// deliverToFunction records the event a Lambda subscriber would receive.
+func (h *Handler) deliverToFunction(ctx context.Context, ns string, sub *subscription, n notification, rec *deliveryRecord) {
+	event := map[string]any{
+		"Records": []map[string]any{{
+			"EventSource":          "aws:sns",
+			"EventVersion":         "1.0",
+			"EventSubscriptionArn": rec.SubscriptionArn,
+			"Sns":                  n,
+		}},
+	}
+	buf, _ := json.Marshal(event)
+	rec.Payload = string(buf)
+	rec.Attempts = 1
+
+	parts := strings.Split(sub.Endpoint, ":")
+	name := ""
+	if len(parts) >= 7 {
+		name = parts[6]
+	}
+	if _, err := h.Store.Get(ctx, name, "lambda", "function", ns); err != nil {
+		rec.Status = deliveryFailed
+		rec.Error = "Function not found: " + sub.Endpoint
+		return
+	}
+	rec.Status = deliveryRecorded
+}
+
+// saveDelivery stores rec, even once a delivery has run out of time, and
+// drops the subscription's oldest records past maxDeliveryRecords.
+func (h *Handler) saveDelivery(ctx context.Context, ns, subID string, rec *deliveryRecord) {
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	// Records are keyed by subscription, then in the order they were
+	// saved, so a prefix query lists one subscription's oldest first.
+	err = h.Store.Create(ctx, &resource.Resource{
+		ID:         fmt.Sprintf("%s/%020d-%s", subID, time.Now().UnixNano(), uuid.NewString()),
+		Namespace:  ns,
+		Service:    "sns",
+		Type:       "delivery",
+		Attributes: buf,
+	})
+	if err != nil {
+		return
+	}
+	page, err := h.Store.Query(ctx, resource.Query{Service: "sns", Type: "delivery", Namespace: ns, IDPrefix: subID + "/"})
+	if err != nil {
+		return
+	}
+	for i := 0; i < len(page.Resources)-maxDeliveryRecords; i++ {
+		_ = h.Store.Delete(ctx, page.Resources[i].ID, "sns", "delivery", ns)
+	}
+}
+
+// deleteSubscription deletes a subscription and its delivery records.
+func (h *Handler) deleteSubscription(ctx context.Context, ns, subID string) error {
+	if err := h.Store.Delete(ctx, subID, "sns", "subscription", ns); err != nil {
+		return err
+	}
+	page, err := h.Store.Query(ctx, resource.Query{Service: "sns", Type: "delivery", Namespace: ns, IDPrefix: subID + "/"})
+	if err != nil {
+		return err
+	}
+	for _, rec := range page.Resources {
+		if err := h.Store.Delete(ctx, rec.ID, "sns", "delivery", ns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formEntries parses Query API prefix.N.key / prefix.N.value pairs.
+func formEntries(r *http.Request, prefix string) map[string]string {
+	out := map[string]string{}
+	for i := 1; ; i++ {
+		key := r.FormValue(fmt.Sprintf("%s.%d.key", prefix, i))
+		if key == "" {
+			return out
+		}
+		out[key] = r.FormValue(fmt.Sprintf("%s.%d.value", prefix, i))
+	}
+}
+
+// formMessageAttributes parses prefix.N.Name / prefix.N.Value.* entries.
+func formMessageAttributes(r *http.Request, prefix string) (map[string]messageAttribute, *snsError) {
+	out := map[string]messageAttribute{}
+	for i := 1; ; i++ {
+		p := fmt.Sprintf("%s.%d.", prefix, i)
+		name := r.FormValue(p + "Name")
+		if name == "" {
+			return out, nil
+		}
+		attr := messageAttribute{
+			DataType:    r.FormValue(p + "Value.DataType"),
+			StringValue: r.FormValue(p + "Value.StringValue"),
+		}
+		if b := r.FormValue(p + "Value.BinaryValue"); b != "" {
+			decoded, err := base64.StdEncoding.DecodeString(b)
+			if err != nil {
+				return nil, &snsError{"ParameterValueInvalid", fmt.Sprintf("The message attribute '%s' has an invalid binary value.", name)}
+			}
+			attr.BinaryValue = decoded
+		}
+		out[name] = attr
+	}
+}
+
+func formPublishInput(r *http.Request, prefix string) (publishInput, *snsError) {
+	attrs, serr := formMessageAttributes(r, prefix+"MessageAttributes.entry")
+	if serr != nil {
+		return publishInput{}, serr
+	}
+	return publishInput{
+		Message:                r.FormValue(prefix + "Message"),
+		Subject:                r.FormValue(prefix + "Subject"),
+		MessageStructure:       r.FormValue(prefix + "MessageStructure"),
+		MessageAttributes:      attrs,
+		MessageGroupId:         r.FormValue(prefix + "MessageGroupId"),
+		MessageDeduplicationId: r.FormValue(prefix + "MessageDeduplicationId"),
+	}, nil
+}
+
+//
+// QUERY API HANDLERS
+//
+
+// Publish
+func (h *Handler) Publish(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	ns := util.NamespaceFromHeader(r)
+
+	arn := r.FormValue("TopicArn")
+	if arn == "" {
+		arn = r.FormValue("TargetArn")
+	}
+	if arn == "" {
+		writeError(w, errInvalidParameter("Invalid parameter: TopicArn or TargetArn Reason: no value for required parameter"), "")
+		return
+	}
+
+	in, serr := formPublishInput(r, "")
+	if serr != nil {
+		writeError(w, serr, arn)
+		return
+	}
+	topic, serr := h.lookupTopic(r.Context(), ns, arn)
+	if serr != nil {
+		writeError(w, serr, arn)
+		return
+	}
+	messageID, serr := h.publish(r.Context(), ns, topic, arn, in, time.Now().Add(h.DeliveryDeadline))
+	if serr != nil {
+		writeError(w, serr, arn)
+		return
+	}
+
+	resp := PublishResponse{
+		PublishResult: PublishResult{
+			MessageId: messageID,
+		},
+		ResponseMetadata: ResponseMetadata{
+			RequestId: awsresponses.NextRequestID(),
+		},
+	}
+
+	awsresponses.WriteXML(w, resp)
+}
+
+// PublishBatch
+func (h *Handler) PublishBatch(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	ns := util.NamespaceFromHeader(r)
+
+	arn := r.FormValue("TopicArn")
+	if arn == "" {
+		writeError(w, errInvalidParameter("Invalid parameter: TopicArn Reason: no value for required parameter"), "")
+		return
+	}
+
+	var ids []string
+	for i := 1; ; i++ {
+		id := r.FormValue(fmt.Sprintf("PublishBatchRequestEntries.member.%d.Id", i))
+		if id == "" {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		writeError(w, &snsError{"EmptyBatchRequest", "The batch request doesn't contain any entries."}, arn)
+		return
+	}
+	if len(ids) > maxPublishBatchEntries {
+		writeError(w, &snsError{"TooManyEntriesInBatchRequest", fmt.Sprintf("The batch request contains more entries than permissible (%d).", maxPublishBatchEntries)}, arn)
+		return
+	}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			writeError(w, &snsError{"BatchEntryIdsNotDistinct", "Two or more batch entries in the request have the same Id."}, arn)
+			return
+		}
+		seen[id] = true
+	}
+
+	topic, serr := h.lookupTopic(r.Context(), ns, arn)
+	if serr != nil {
+		writeError(w, serr, arn)
+		return
+	}
+
+	// The deadline covers the whole batch.
+	deadline := time.Now().Add(h.DeliveryDeadline)
+	result := PublishBatchResult{
+		Successful: []PublishBatchResultEntry{},
+		Failed:     []BatchResultErrorEntry{},
+	}
+	for i, id := range ids {
+		in, serr := formPublishInput(r, fmt.Sprintf("PublishBatchRequestEntries.member.%d.", i+1))
+		var messageID string
+		if serr == nil {
+			messageID, serr = h.publish(r.Context(), ns, topic, arn, in, deadline)
+		}
+		if serr != nil {
+			result.Failed = append(result.Failed, BatchResultErrorEntry{
+				Id:          id,
+				Code:        serr.Code,
+				Message:     serr.Message,
+				SenderFault: serr.Code != "InternalError",
+			})
+			continue
+		}
+		result.Successful = append(result.Successful, PublishBatchResultEntry{
+			Id:        id,
+			MessageId: messageID,
+		})
+	}
+
+	resp := PublishBatchResponse{
+		PublishBatchResult: result,
+		ResponseMetadata: ResponseMetadata{
+			RequestId: awsresponses.NextRequestID(),
+		},
+	}
+
+	awsresponses.WriteXML(w, resp)
+}
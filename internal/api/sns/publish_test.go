@@ -0,0 +1,388 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sns_test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"opensnack/internal/api/sns"
+	"opensnack/internal/api/sqs"
+	"opensnack/internal/resource"
+)
+
+const testTopicArn = "arn:aws:sns:us-east-1:000000000000:events"
+
+func seedTopic(t *testing.T, store *resource.MemoryStore, name string) {
+	t.Helper()
+	buf, _ := json.Marshal(map[string]any{"name": name})
+	store.Create(t.Context(), &resource.Resource{
+		ID:         name,
+		Namespace:  "ns1",
+		Service:    "sns",
+		Type:       "topic",
+		Attributes: buf,
+	})
+}
+
+func seedQueue(t *testing.T, store *resource.MemoryStore, name string) string {
+	t.Helper()
+	buf, _ := json.Marshal(map[string]any{"name": name})
+	store.Create(t.Context(), &resource.Resource{
+		ID:         name,
+		Namespace:  "ns1",
+		Service:    "sqs",
+		Type:       "queue",
+		Attributes: buf,
+	})
+	return "arn:aws:sqs:us-east-1:000000000000:" + name
+}
+
+func callQuery(h *sns.Handler, form url.Values) *httptest.ResponseRecorder {
+	req, rec := newCtx("POST", "/", strings.NewReader(form.Encode()))
+	h.Dispatch(rec, req)
+	return rec
+}
+
+// subscribe creates a subscription with optional attributes and returns its
+// ARN. http/https subscriptions are left pending confirmation.
+func subscribe(t *testing.T, h *sns.Handler, protocol, endpoint string, attrs map[string]string) string {
+	t.Helper()
+	form := url.Values{
+		"Action":                {"Subscribe"},
+		"TopicArn":              {testTopicArn},
+		"Protocol":              {protocol},
+		"Endpoint":              {endpoint},
+		"ReturnSubscriptionArn": {"true"},
+	}
+	i := 1
+	for k, v := range attrs {
+		form.Set("Attributes.entry."+strconv.Itoa(i)+".key", k)
+		form.Set("Attributes.entry."+strconv.Itoa(i)+".value", v)
+		i++
+	}
+	rec := callQuery(h, form)
+	var resp sns.SubscribeResponse
+	if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("subscribe failed: %s", rec.Body.String())
+	}
+	return resp.SubscribeResult.SubscriptionArn
+}
+
+// receiveAll drains visible messages from a queue through the SQS JSON API.
+func receiveAll(t *testing.T, h *sns.Handler, queue string) []sqs.MessageJSON {
+	t.Helper()
+	max := 10
+	buf, _ := json.Marshal(sqs.ReceiveMessageJSONRequest{
+		QueueUrl:              "http://localhost:4566/000000000000/" + queue,
+		MaxNumberOfMessages:   &max,
+		MessageAttributeNames: []string{"All"},
+	})
+	req := httptest.NewRequest("POST", "/", strings.NewReader(string(buf)))
+	req.Header.Set("X-Amz-Target", "AmazonSQS.ReceiveMessage")
+	req.Header.Set("User-Agent", "opensnack-test custom-ns1")
+	rec := httptest.NewRecorder()
+	h.Queues.Dispatch(rec, req)
+
+	var resp sqs.ReceiveMessageJSONResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("receive failed: %s", rec.Body.String())
+	}
+	return resp.Messages
+}
+
+func deliveries(store *resource.MemoryStore) []map[string]any {
+	items, _ := store.List(context.Background(), "sns", "delivery", "ns1")
+	var out []map[string]any
+	for _, it := range items {
+		var rec map[string]any
+		json.Unmarshal(it.Attributes, &rec)
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestPublish_FanOutToSQSEnvelope(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sns.NewHandler(store)
+	seedTopic(t, store, "events")
+	subArn := subscribe(t, h, "sqs", seedQueue(t, store, "fanq"), nil)
+
+	rec := callQuery(h, url.Values{
+		"Action":                         {"Publish"},
+		"TopicArn":                       {testTopicArn},
+		"Subject":                        {"greeting"},
+		"Message":                        {"hello"},
+		"MessageAttributes.entry.1.Name": {"kind"},
+		"MessageAttributes.entry.1.Value.DataType":    {"String"},
+		"MessageAttributes.entry.1.Value.StringValue": {"order"},
+	})
+	var resp sns.PublishResponse
+	if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != 200 {
+		t.Fatalf("publish failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	msgs := receiveAll(t, h, "fanq")
+	if len(msgs) != 1 {
+		t.Fatalf("expected one queued message, got %d", len(msgs))
+	}
+
+	var env map[string]any
+	if err := json.Unmarshal([]byte(msgs[0].Body), &env); err != nil {
+		t.Fatalf("body is not an SNS envelope: %s", msgs[0].Body)
+	}
+	if env["Type"] != "Notification" || env["Message"] != "hello" || env["Subject"] != "greeting" {
+		t.Fatalf("unexpected envelope: %v", env)
+	}
+	if env["MessageId"] != resp.PublishResult.MessageId || env["TopicArn"] != testTopicArn {
+		t.Fatalf("envelope ids do not match publish: %v", env)
+	}
+	if !strings.Contains(env["UnsubscribeURL"].(string), url.QueryEscape(subArn)) {
+		t.Fatalf("UnsubscribeURL should reference the subscription: %v", env["UnsubscribeURL"])
+	}
+	attrs := env["MessageAttributes"].(map[string]any)
+	if kind := attrs["kind"].(map[string]any); kind["Type"] != "String" || kind["Value"] != "order" {
+		t.Fatalf("unexpected envelope attributes: %v", attrs)
+	}
+
+	recs := deliveries(store)
+	if len(recs) != 1 || recs[0]["status"] != "DELIVERED" || recs[0]["subscription_arn"] != subArn {
+		t.Fatalf("expected a DELIVERED record, got %v", recs)
+	}
+}
+
+func TestPublish_RawMessageDelivery(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sns.NewHandler(store)
+	seedTopic(t, store, "events")
+	subscribe(t, h, "sqs", seedQueue(t, store, "rawq"), map[string]string{"RawMessageDelivery": "true"})
+
+	callQuery(h, url.Values{
+		"Action":                         {"Publish"},
+		"TopicArn":                       {testTopicArn},
+		"Message":                        {`{"id":42}`},
+		"MessageAttributes.entry.1.Name": {"kind"},
+		"MessageAttributes.entry.1.Value.DataType":    {"String"},
+		"MessageAttributes.entry.1.Value.StringValue": {"order"},
+	})
+
+	msgs := receiveAll(t, h, "rawq")
+	if len(msgs) != 1 || msgs[0].Body != `{"id":42}` {
+		t.Fatalf("expected raw body, got %+v", msgs)
+	}
+	if msgs[0].MessageAttributes["kind"].StringValue != "order" {
+		t.Fatalf("raw delivery should forward message attributes: %+v", msgs[0].MessageAttributes)
+	}
+}
+
+func TestPublish_MessageStructureJSON(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sns.NewHandler(store)
+	seedTopic(t, store, "events")
+	subscribe(t, h, "sqs", seedQueue(t, store, "q"), map[string]string{"RawMessageDelivery": "true"})
+
+	rec := callQuery(h, url.Values{
+		"Action":           {"Publish"},
+		"TopicArn":         {testTopicArn},
+		"MessageStructure": {"json"},
+		"Message":          {`{"sqs":"for queues"}`},
+	})
+	if !strings.Contains(rec.Body.String(), "No default entry") {
+		t.Fatalf("expected missing default error, got %s", rec.Body.String())
+	}
+
+	callQuery(h, url.Values{
+		"Action":           {"Publish"},
+		"TopicArn":         {testTopicArn},
+		"MessageStructure": {"json"},
+		"Message":          {`{"default":"fallback","sqs":"for queues"}`},
+	})
+	msgs := receiveAll(t, h, "q")
+	if len(msgs) != 1 || msgs[0].Body != "for queues" {
+		t.Fatalf("expected the sqs-specific body, got %+v", msgs)
+	}
+}
+
+func TestPublish_HTTPDelivery(t *testing.T) {
+	ok := newWebhook(http.StatusOK)
+	defer ok.Close()
+	failing := newWebhook(http.StatusInternalServerError)
+	defer failing.Close()
+
+	store := resource.NewMemoryStore()
+	h := sns.NewHandler(store)
+	seedTopic(t, store, "events")
+	subArn := subscribeConfirmed(t, h, ok)
+	subscribeConfirmed(t, h, failing)
+	subscribe(t, h, "sqs", "arn:aws:sqs:us-east-1:000000000000:missing", nil)
+
+	rec := callQuery(h, url.Values{
+		"Action":   {"Publish"},
+		"TopicArn": {testTopicArn},
+		"Message":  {"ping"},
+	})
+	if rec.Code != 200 {
+		t.Fatalf("failed deliveries must not fail Publish: %s", rec.Body.String())
+	}
+
+	got := ok.received("Notification")
+	if len(got) != 1 {
+		t.Fatalf("expected one notification POST, got %d", len(got))
+	}
+	if got[0].header.Get("x-amz-sns-subscription-arn") != subArn {
+		t.Fatalf("missing SNS headers: %v", got[0].header)
+	}
+	var env map[string]any
+	if err := json.Unmarshal([]byte(got[0].body), &env); err != nil || env["Message"] != "ping" {
+		t.Fatalf("unexpected http body: %s", got[0].body)
+	}
+
+	status := map[string]string{}
+	for _, d := range deliveries(store) {
+		if d["message_type"] != "Notification" {
+			continue
+		}
+		status[d["endpoint"].(string)] = d["status"].(string)
+		if d["endpoint"] == failing.URL && d["attempts"].(float64) != 3 {
+			t.Fatalf("failing endpoint should be retried, got %v attempts", d["attempts"])
+		}
+	}
+	if status[ok.URL] != "DELIVERED" ||
+		status[failing.URL] != "FAILED" ||
+		status["arn:aws:sqs:us-east-1:000000000000:missing"] != "FAILED" {
+		t.Fatalf("unexpected delivery statuses: %v", status)
+	}
+}
+
+func TestPublish_SlowEndpoints(t *testing.T) {
+	release := make(chan struct{})
+	first := newSlowWebhook(release)
+	defer first.Close()
+	second := newSlowWebhook(release)
+	defer second.Close()
+	defer close(release)
+
+	store := resource.NewMemoryStore()
+	h := sns.NewHandler(store)
+	h.DeliveryDeadline = 200 * time.Millisecond
+	seedTopic(t, store, "events")
+	subscribeConfirmed(t, h, first)
+	subscribeConfirmed(t, h, second)
+
+	start := time.Now()
+	rec := callQuery(h, url.Values{
+		"Action":   {"Publish"},
+		"TopicArn": {testTopicArn},
+		"Message":  {"ping"},
+	})
+	if rec.Code != 200 {
+		t.Fatalf("Publish: %s", rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Publish waited %v on slow endpoints", elapsed)
+	}
+
+	failed := 0
+	for _, d := range deliveries(store) {
+		if d["message_type"] == "Notification" && d["status"] == "FAILED" {
+			failed++
+		}
+	}
+	if failed != 2 {
+		t.Fatalf("expected both timed-out deliveries to be recorded as failed, got %v", deliveries(store))
+	}
+}
+
+func TestPublish_DeliveryRecordsKept(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sns.NewHandler(store)
+	seedTopic(t, store, "events")
+	subArn := subscribe(t, h, "sqs", seedQueue(t, store, "fanq"), nil)
+
+	publish := url.Values{"Action": {"Publish"}, "TopicArn": {testTopicArn}, "Message": {"hello"}}
+	for range 105 {
+		if rec := callQuery(h, publish); rec.Code != http.StatusOK {
+			t.Fatalf("publish: %d %s", rec.Code, rec.Body.String())
+		}
+	}
+	if got := len(deliveries(store)); got != 100 {
+		t.Fatalf("expected the last 100 delivery records, got %d", got)
+	}
+
+	// The records go with the subscription, and subscriptions with the topic.
+	callQuery(h, url.Values{"Action": {"Unsubscribe"}, "SubscriptionArn": {subArn}})
+	if got := len(deliveries(store)); got != 0 {
+		t.Fatalf("expected Unsubscribe to delete the delivery records, got %d", got)
+	}
+	subscribe(t, h, "sqs", "arn:aws:sqs:us-east-1:000000000000:fanq", nil)
+	callQuery(h, publish)
+	callQuery(h, url.Values{"Action": {"DeleteTopic"}, "TopicArn": {testTopicArn}})
+	if subs, _ := store.List(t.Context(), "sns", "subscription", "ns1"); len(subs) != 0 || len(deliveries(store)) != 0 {
+		t.Fatalf("expected DeleteTopic to delete everything, %d subscriptions and %d delivery records left", len(subs), len(deliveries(store)))
+	}
+}
+
+func TestPublish_TopicNotFound(t *testing.T) {
+	h := sns.NewHandler(resource.NewMemoryStore())
+
+	rec := callQuery(h, url.Values{
+		"Action":   {"Publish"},
+		"TopicArn": {testTopicArn},
+		"Message":  {"hello"},
+	})
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "NotFound") {
+		t.Fatalf("expected NotFound, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPublishBatch(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sns.NewHandler(store)
+	seedTopic(t, store, "events")
+	subscribe(t, h, "sqs", seedQueue(t, store, "batchq"), map[string]string{"RawMessageDelivery": "true"})
+
+	rec := callQuery(h, url.Values{
+		"Action":                                 {"PublishBatch"},
+		"TopicArn":                               {testTopicArn},
+		"PublishBatchRequestEntries.member.1.Id": {"a"},
+		"PublishBatchRequestEntries.member.1.Message": {"one"},
+		"PublishBatchRequestEntries.member.2.Id":      {"b"},
+		"PublishBatchRequestEntries.member.3.Id":      {"c"},
+		"PublishBatchRequestEntries.member.3.Message": {"three"},
+	})
+	var resp sns.PublishBatchResponse
+	if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad PublishBatch response: %s", rec.Body.String())
+	}
+	result := resp.PublishBatchResult
+	if len(result.Successful) != 2 || len(result.Failed) != 1 || result.Failed[0].Id != "b" {
+		t.Fatalf("unexpected batch result: %+v", result)
+	}
+
+	msgs := receiveAll(t, h, "batchq")
+	if len(msgs) != 2 {
+		t.Fatalf("expected two delivered messages, got %d", len(msgs))
+	}
+
+	rec = callQuery(h, url.Values{
+		"Action":                                 {"PublishBatch"},
+		"TopicArn":                               {testTopicArn},
+		"PublishBatchRequestEntries.member.1.Id": {"dup"},
+		"PublishBatchRequestEntries.member.1.Message": {"x"},
+		"PublishBatchRequestEntries.member.2.Id":      {"dup"},
+		"PublishBatchRequestEntries.member.2.Message": {"y"},
+	})
+	if !strings.Contains(rec.Body.String(), "BatchEntryIdsNotDistinct") {
+		t.Fatalf("expected BatchEntryIdsNotDistinct, got %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,1410 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sqs
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"opensnack/internal/awsarn"
+	"opensnack/internal/awsresponses"
+	"opensnack/internal/resource"
+	"opensnack/internal/util"
+
+	"github.com/google/uuid"
+)
+
+//
+// MESSAGE STORAGE
+//
+// Every message is its own resource (service "sqs", type "message") keyed
+// by MessageId. Visibility is tracked as an absolute VisibleAt timestamp:
+// a message can be received once VisibleAt has passed, and receiving it
+// pushes VisibleAt forward by the visibility timeout.
+//
+
+const (
+	maxBatchEntries     = 10
+	maxReceiveMessages  = 10
+	maxWaitTimeSeconds  = 20
+	maxDelaySeconds     = 900
+	maxVisibilitySecs   = 43200
+	receivePollInterval = 200 * time.Millisecond
+)
+
+type storedMessage struct {
+	MessageId              string                           `json:"message_id"`
+	QueueName              string                           `json:"queue_name"`
+	Body                   string                           `json:"body"`
+	MD5OfBody              string                           `json:"md5_of_body"`
+	MessageAttributes      map[string]MessageAttributeValue `json:"message_attributes,omitempty"`
+	MD5OfMessageAttributes string                           `json:"md5_of_message_attributes,omitempty"`
+	SentTimestamp          int64                            `json:"sent_timestamp"`
+	VisibleAt              int64                            `json:"visible_at"`
+	ReceiveCount           int                              `json:"receive_count"`
+	FirstReceiveTimestamp  int64                            `json:"first_receive_timestamp,omitempty"`
+	ReceiptHandle          string                           `json:"receipt_handle,omitempty"`
+	MessageGroupId         string                           `json:"message_group_id,omitempty"`
+	MessageDeduplicationId string                           `json:"message_deduplication_id,omitempty"`
+	SequenceNumber         string                           `json:"sequence_number,omitempty"`
+	SenderId               string                           `json:"sender_id,omitempty"`
+
+	// DeadLetterQueueSourceArn is set while the message sits in a dead-letter queue.
+	DeadLetterQueueSourceArn string `json:"dead_letter_queue_source_arn,omitempty"`
+}
+
+// inFlight reports whether the message has been received and is still hidden.
+func (m *storedMessage) inFlight(now int64) bool {
+	return m.ReceiptHandle != "" && m.VisibleAt > now
+}
+
+// delayed reports whether the message has never been received and is still
+// inside its DelaySeconds window.
+func (m *storedMessage) delayed(now int64) bool {
+	return m.ReceiveCount == 0 && m.VisibleAt > now
+}
+
+// sqsError is a protocol-neutral error; it is rendered as XML or JSON by the caller.
+type sqsError struct {
+	Code    string
+	Message string
+}
+
+func (e *sqsError) Error() string { return e.Code + ": " + e.Message }
+
+func errNonExistentQueue() *sqsError {
+	return &sqsError{"AWS.SimpleQueueService.NonExistentQueue", "The specified queue does not exist."}
+}
+
+func errInvalidParameter(format string, args ...any) *sqsError {
+	return &sqsError{"InvalidParameterValue", fmt.Sprintf(format, args...)}
+}
+
+func writeQueryError(w http.ResponseWriter, e *sqsError) {
+	status := http.StatusBadRequest
+	if e.Code == "InternalError" {
+		status = http.StatusInternalServerError
+	}
+	awsresponses.WriteErrorXML(w, status, e.Code, e.Message, "")
+}
+
+func writeJSONError(w http.ResponseWriter, e *sqsError) {
+	status := http.StatusBadRequest
+	if e.Code == "InternalError" {
+		status = http.StatusInternalServerError
+	}
+	awsresponses.WriteJSON(w, status, map[string]any{
+		"__type":  e.Code,
+		"message": e.Message,
+	})
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+// queueNameFromURL extracts the queue name (last path segment) from a QueueUrl.
+func queueNameFromURL(queueURL string) (string, *sqsError) {
+	if queueURL == "" {
+		return "", &sqsError{"MissingParameter", "The request must contain the parameter QueueUrl."}
+	}
+	u, err := url.Parse(queueURL)
+	if err != nil || u.Path == "" {
+		return "", errInvalidParameter("QueueUrl is invalid")
+	}
+	parts := strings.Split(u.Path, "/")
+	return parts[len(parts)-1], nil
+}
+
+// lookupQueue resolves a QueueUrl to its stored queue resource.
+func (h *Handler) lookupQueue(ctx context.Context, ns, queueURL string) (*resource.Resource, *sqsError) {
+	name, serr := queueNameFromURL(queueURL)
+	if serr != nil {
+		return nil, serr
+	}
+	queue, err := h.Store.Get(ctx, name, "sqs", "queue", ns)
+	if err != nil || queue == nil {
+		return nil, errNonExistentQueue()
+	}
+	return queue, nil
+}
+
+// queueAttributes returns the user-settable attributes stored with a queue.
+func queueAttributes(queue *resource.Resource) map[string]string {
+	var stored struct {
+		Attributes map[string]string `json:"attributes"`
+	}
+	_ = json.Unmarshal(queue.Attributes, &stored)
+	if stored.Attributes == nil {
+		stored.Attributes = map[string]string{}
+	}
+	return stored.Attributes
+}
+
+// queueIntAttribute reads a numeric queue attribute, falling back to def.
+func queueIntAttribute(attrs map[string]string, name string, def int) int {
+	if v, ok := attrs[name]; ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// queueMessages loads every message of a queue ordered by send time.
+// Messages past the queue's MessageRetentionPeriod are deleted on the way.
+func (h *Handler) queueMessages(ctx context.Context, ns string, queue *resource.Resource) ([]storedMessage, error) {
+	page, err := h.Store.Query(ctx, resource.Query{
+		Service:   "sqs",
+		Type:      "message",
+		Namespace: ns,
+		Match:     map[string]any{"queue_name": queue.ID},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	retention := int64(queueIntAttribute(queueAttributes(queue), "MessageRetentionPeriod", 345600)) * 1000
+	now := nowMillis()
+
+	var out []storedMessage
+	for _, item := range page.Resources {
+		var m storedMessage
+		if err := json.Unmarshal(item.Attributes, &m); err != nil {
+			continue
+		}
+		if now-m.SentTimestamp > retention {
+			_ = h.Store.Delete(ctx, m.MessageId, "sqs", "message", ns)
+			continue
+		}
+		out = append(out, m)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].SentTimestamp != out[j].SentTimestamp {
+			return out[i].SentTimestamp < out[j].SentTimestamp
+		}
+		if out[i].SequenceNumber != out[j].SequenceNumber {
+			return out[i].SequenceNumber < out[j].SequenceNumber
+		}
+		return out[i].MessageId < out[j].MessageId
+	})
+	return out, nil
+}
+
+// mutateMessage applies fn to the stored copy of a message and saves
+// the result, re-running fn on the newer copy if another writer (another
+// opensnack process on the same database) changed it first. An error
+// from fn is returned unchanged and nothing is written.
+func (h *Handler) mutateMessage(ctx context.Context, ns, id string, fn func(m *storedMessage) error) (*storedMessage, error) {
+	var m storedMessage
+	_, err := h.Store.Mutate(ctx, id, "sqs", "message", ns, func(res *resource.Resource) error {
+		m = storedMessage{}
+		if err := json.Unmarshal(res.Attributes, &m); err != nil {
+			return err
+		}
+		if err := fn(&m); err != nil {
+			return err
+		}
+		buf, err := json.Marshal(&m)
+		if err != nil {
+			return err
+		}
+		res.Attributes = buf
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// deleteQueueMessages drops all messages belonging to a queue, together
+// with its FIFO deduplication history.
+func (h *Handler) deleteQueueMessages(ctx context.Context, ns, queueName string) {
+	_ = h.purgeMessages(ctx, ns, queueName)
+	h.deleteDedupRecords(ctx, ns, queueName)
+}
+
+// purgeMessages drops every message in a queue, visible or not. FIFO
+// deduplication history is kept, as PurgeQueue does not reset it.
+func (h *Handler) purgeMessages(ctx context.Context, ns, queueName string) error {
+	page, err := h.Store.Query(ctx, resource.Query{
+		Service:   "sqs",
+		Type:      "message",
+		Namespace: ns,
+		Match:     map[string]any{"queue_name": queueName},
+	})
+	if err != nil {
+		return err
+	}
+	for _, item := range page.Resources {
+		if err := h.Store.Delete(ctx, item.ID, "sqs", "message", ns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeQueue empties the queue behind a QueueUrl.
+func (h *Handler) purgeQueue(ctx context.Context, ns, queueURL string) *sqsError {
+	queue, serr := h.lookupQueue(ctx, ns, queueURL)
+	if serr != nil {
+		return serr
+	}
+	if err := h.purgeMessages(ctx, ns, queue.ID); err != nil {
+		return &sqsError{"InternalError", "Failed to purge queue: " + err.Error()}
+	}
+	return nil
+}
+
+// messageCounts returns the visible, in-flight and delayed message counts
+// reported by the ApproximateNumberOfMessages* queue attributes.
+func (h *Handler) messageCounts(ctx context.Context, ns string, queue *resource.Resource) (visible, notVisible, delayed int) {
+	msgs, err := h.queueMessages(ctx, ns, queue)
+	if err != nil {
+		return 0, 0, 0
+	}
+	now := nowMillis()
+	for i := range msgs {
+		switch {
+		case msgs[i].inFlight(now):
+			notVisible++
+		case msgs[i].delayed(now):
+			delayed++
+		default:
+			visible++
+		}
+	}
+	return visible, notVisible, delayed
+}
+
+//
+// RECEIPT HANDLES
+//
+// A receipt handle encodes the MessageId plus a per-receive nonce, so a
+// handle from an earlier receive no longer matches once the message has
+// been received again. A checksum of the two tells a handle that was
+// handed out, whose message may since have been deleted, from one that
+// never was.
+//
+
+func newReceiptHandle(messageID string) string {
+	body := messageID + ":" + util.RandomHex(16)
+	return base64.RawURLEncoding.EncodeToString([]byte(body + ":" + receiptChecksum(body)))
+}
+
+func receiptChecksum(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:8])
+}
+
+func messageIDFromReceiptHandle(handle string) (string, *sqsError) {
+	raw, err := base64.RawURLEncoding.DecodeString(handle)
+	if err != nil {
+		return "", errInvalidReceiptHandle(handle)
+	}
+	i := strings.LastIndexByte(string(raw), ':')
+	if i < 0 || string(raw[i+1:]) != receiptChecksum(string(raw[:i])) {
+		return "", errInvalidReceiptHandle(handle)
+	}
+	id, _, ok := strings.Cut(string(raw[:i]), ":")
+	if !ok || id == "" {
+		return "", errInvalidReceiptHandle(handle)
+	}
+	return id, nil
+}
+
+func errInvalidReceiptHandle(handle string) *sqsError {
+	return &sqsError{"ReceiptHandleIsInvalid", "The input receipt handle \"" + handle + "\" is not a valid receipt handle."}
+}
+
+//
+// CHECKSUMS
+//
+
+func md5Hex(b []byte) string {
+	sum := md5.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// md5OfMessageAttributes implements the checksum AWS SDKs verify on
+// SendMessage and ReceiveMessage: attributes sorted by name, each encoded
+// as length-prefixed name, data type, a transport byte and the value.
+func md5OfMessageAttributes(attrs map[string]MessageAttributeValue) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf []byte
+	writeField := func(b []byte) {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(b)))
+		buf = append(buf, b...)
+	}
+	for _, name := range names {
+		v := attrs[name]
+		writeField([]byte(name))
+		writeField([]byte(v.DataType))
+		if strings.HasPrefix(v.DataType, "Binary") {
+			buf = append(buf, 2)
+			writeField(v.BinaryValue)
+		} else {
+			buf = append(buf, 1)
+			writeField([]byte(v.StringValue))
+		}
+	}
+	return md5Hex(buf)
+}
+
+func validateMessageAttributes(attrs map[string]MessageAttributeValue) *sqsError {
+	for name, v := range attrs {
+		if name == "" {
+			return errInvalidParameter("Message attribute name must not be empty.")
+		}
+		switch {
+		case strings.HasPrefix(v.DataType, "String"), strings.HasPrefix(v.DataType, "Number"):
+			if v.StringValue == "" {
+				return errInvalidParameter("Message (user) attribute '%s' must contain a non-empty value of type '%s'.", name, v.DataType)
+			}
+		case strings.HasPrefix(v.DataType, "Binary"):
+			if len(v.BinaryValue) == 0 {
+				return errInvalidParameter("Message (user) attribute '%s' must contain a non-empty value of type 'Binary'.", name)
+			}
+		default:
+			return errInvalidParameter("The type of message (user) attribute '%s' is invalid. You must use only the following supported type prefixes: Binary, Number, String.", name)
+		}
+	}
+	return nil
+}
+
+//
+// CORE OPERATIONS
+//
+
+type sendInput struct {
+	Body                   string
+	DelaySeconds           *int
+	MessageAttributes      map[string]MessageAttributeValue
+	MessageGroupId         string
+	MessageDeduplicationId string
+}
+
+// sendMessage validates and enqueues a single message.
+func (h *Handler) sendMessage(ctx context.Context, ns string, queue *resource.Resource, in sendInput) (*storedMessage, *sqsError) {
+	attrs := queueAttributes(queue)
+
+	if in.Body == "" {
+		return nil, &sqsError{"MissingParameter", "The request must contain the parameter MessageBody."}
+	}
+	maxSize := queueIntAttribute(attrs, "MaximumMessageSize", 262144)
+	if len(in.Body) > maxSize {
+		return nil, errInvalidParameter("One or more parameters are invalid. Reason: Message must be shorter than %d bytes.", maxSize)
+	}
+	if serr := validateMessageAttributes(in.MessageAttributes); serr != nil {
+		return nil, serr
+	}
+	if serr := prepareFifoSend(queue, &in); serr != nil {
+		return nil, serr
+	}
+
+	delay := queueIntAttribute(attrs, "DelaySeconds", 0)
+	if in.DelaySeconds != nil {
+		delay = *in.DelaySeconds
+	}
+	if delay < 0 || delay > maxDelaySeconds {
+		return nil, errInvalidParameter("Value %d for parameter DelaySeconds is invalid. Reason: must be between 0 and %d.", delay, maxDelaySeconds)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := nowMillis()
+	m := &storedMessage{
+		MessageId:              uuid.NewString(),
+		QueueName:              queue.ID,
+		Body:                   in.Body,
+		MD5OfBody:              md5Hex([]byte(in.Body)),
+		MessageAttributes:      in.MessageAttributes,
+		MD5OfMessageAttributes: md5OfMessageAttributes(in.MessageAttributes),
+		SentTimestamp:          now,
+		SenderId:               awsarn.FromContext(ctx).AccountID,
+		VisibleAt:              now + int64(delay)*1000,
+		MessageGroupId:         in.MessageGroupId,
+		MessageDeduplicationId: in.MessageDeduplicationId,
+	}
+
+	if isFifoQueue(queue) {
+		if dup := h.findDuplicate(ctx, ns, queue.ID, in.MessageDeduplicationId); dup != nil {
+			// Accepted, but not enqueued again.
+			m.MessageId = dup.MessageId
+			m.SequenceNumber = dup.SequenceNumber
+			return m, nil
+		}
+		m.SequenceNumber = h.nextSequenceNumber()
+	}
+
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return nil, &sqsError{"InternalError", err.Error()}
+	}
+	if err := h.Store.Create(ctx, &resource.Resource{
+		ID:         m.MessageId,
+		Namespace:  ns,
+		Service:    "sqs",
+		Type:       "message",
+		Attributes: buf,
+	}); err != nil {
+		return nil, &sqsError{"InternalError", "Failed to store message: " + err.Error()}
+	}
+	if m.SequenceNumber != "" {
+		if err := h.recordDeduplication(ctx, ns, m); err != nil {
+			return nil, &sqsError{"InternalError", "Failed to record deduplication id: " + err.Error()}
+		}
+	}
+	return m, nil
+}
+
+// QueueMessage is a message delivered into a queue by another service,
+// e.g. an SNS subscription.
+type QueueMessage struct {
+	Body                   string
+	MessageAttributes      map[string]MessageAttributeValue
+	MessageGroupId         string
+	MessageDeduplicationId string
+}
+
+// SendToQueue enqueues a message into the queue identified by queueArn and
+// returns its MessageId. It applies the same validation as SendMessage.
+func (h *Handler) SendToQueue(ctx context.Context, ns, queueArn string, msg QueueMessage) (string, error) {
+	name := queueNameFromArn(queueArn)
+	if name == "" {
+		return "", errInvalidParameter("Invalid queue ARN: %s", queueArn)
+	}
+	queue, err := h.Store.Get(ctx, name, "sqs", "queue", ns)
+	if err != nil || queue == nil {
+		return "", errNonExistentQueue()
+	}
+	m, serr := h.sendMessage(ctx, ns, queue, sendInput{
+		Body:                   msg.Body,
+		MessageAttributes:      msg.MessageAttributes,
+		MessageGroupId:         msg.MessageGroupId,
+		MessageDeduplicationId: msg.MessageDeduplicationId,
+	})
+	if serr != nil {
+		return "", serr
+	}
+	return m.MessageId, nil
+}
+
+type receiveInput struct {
+	MaxNumberOfMessages *int
+	VisibilityTimeout   *int
+	WaitTimeSeconds     *int
+}
+
+// receiveMessages hands out up to MaxNumberOfMessages visible messages,
+// long-polling for WaitTimeSeconds when the queue is empty.
+func (h *Handler) receiveMessages(ctx context.Context, ns string, queue *resource.Resource, in receiveInput) ([]storedMessage, *sqsError) {
+	attrs := queueAttributes(queue)
+
+	max := 1
+	if in.MaxNumberOfMessages != nil {
+		max = *in.MaxNumberOfMessages
+	}
+	if max < 1 || max > maxReceiveMessages {
+		return nil, errInvalidParameter("Value %d for parameter MaxNumberOfMessages is invalid. Reason: Must be between 1 and %d, if provided.", max, maxReceiveMessages)
+	}
+
+	visibility := queueIntAttribute(attrs, "VisibilityTimeout", 30)
+	if in.VisibilityTimeout != nil {
+		visibility = *in.VisibilityTimeout
+	}
+	if visibility < 0 || visibility > maxVisibilitySecs {
+		return nil, errInvalidParameter("Value %d for parameter VisibilityTimeout is invalid. Reason: Must be between 0 and %d, if provided.", visibility, maxVisibilitySecs)
+	}
+
+	wait := queueIntAttribute(attrs, "ReceiveMessageWaitTimeSeconds", 0)
+	if in.WaitTimeSeconds != nil {
+		wait = *in.WaitTimeSeconds
+	}
+	if wait < 0 || wait > maxWaitTimeSeconds {
+		return nil, errInvalidParameter("Value %d for parameter WaitTimeSeconds is invalid. Reason: Must be >= 0 and <= %d, if provided.", wait, maxWaitTimeSeconds)
+	}
+
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+	for {
+		msgs, err := h.receiveVisible(ctx, ns, queue, max, visibility)
+		if err != nil {
+			return nil, &sqsError{"InternalError", "Failed to receive messages: " + err.Error()}
+		}
+		if len(msgs) > 0 || !time.Now().Before(deadline) {
+			return msgs, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-time.After(receivePollInterval):
+		}
+	}
+}
+
+// receiveVisible makes up to max currently visible messages invisible for
+// visibility seconds and returns them with fresh receipt handles. On FIFO
+// queues, groups with a message in flight are skipped entirely, and a
+// group stops at its first message that is not yet visible. Messages that
+// have exhausted the queue's maxReceiveCount go to the dead-letter queue
+// instead of being returned.
+func (h *Handler) receiveVisible(ctx context.Context, ns string, queue *resource.Resource, max, visibility int) ([]storedMessage, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	msgs, err := h.queueMessages(ctx, ns, queue)
+	if err != nil {
+		return nil, err
+	}
+
+	now := nowMillis()
+	redrive := queueRedrivePolicy(queue)
+	fifo := isFifoQueue(queue)
+	blocked := map[string]bool{}
+	if fifo {
+		for i := range msgs {
+			if msgs[i].inFlight(now) {
+				blocked[msgs[i].MessageGroupId] = true
+			}
+		}
+	}
+
+	var out []storedMessage
+	for i := range msgs {
+		if len(out) >= max {
+			break
+		}
+		m := &msgs[i]
+		if fifo && blocked[m.MessageGroupId] {
+			continue
+		}
+		if m.VisibleAt > now {
+			if fifo {
+				blocked[m.MessageGroupId] = true
+			}
+			continue
+		}
+		if redrive != nil && m.ReceiveCount >= redrive.MaxReceiveCount {
+			if h.moveToDeadLetterQueue(ctx, ns, queue, m, redrive) {
+				continue
+			}
+		}
+		received, err := h.mutateMessage(ctx, ns, m.MessageId, func(m *storedMessage) error {
+			if m.QueueName != queue.ID || m.VisibleAt > now {
+				return errNotVisible
+			}
+			m.ReceiveCount++
+			if m.FirstReceiveTimestamp == 0 {
+				m.FirstReceiveTimestamp = now
+			}
+			m.ReceiptHandle = newReceiptHandle(m.MessageId)
+			m.VisibleAt = now + int64(visibility)*1000
+			return nil
+		})
+		if errors.Is(err, errNotVisible) {
+			// Received or moved elsewhere since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *received)
+	}
+	return out, nil
+}
+
+// errNotVisible aborts receiving a message that stopped being visible
+// between listing the queue and claiming it.
+var errNotVisible = errors.New("message is not visible")
+
+// deleteMessage removes the message a receipt handle refers to. Handles
+// of messages that are already gone, or that have since been received
+// again, are accepted silently as AWS does; handles that were never
+// handed out for this queue are not.
+func (h *Handler) deleteMessage(ctx context.Context, ns string, queue *resource.Resource, handle string) *sqsError {
+	if handle == "" {
+		return &sqsError{"MissingParameter", "The request must contain the parameter ReceiptHandle."}
+	}
+	id, serr := messageIDFromReceiptHandle(handle)
+	if serr != nil {
+		return serr
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	res, err := h.Store.Get(ctx, id, "sqs", "message", ns)
+	if err != nil || res == nil {
+		return nil
+	}
+	var m storedMessage
+	if err := json.Unmarshal(res.Attributes, &m); err != nil {
+		return nil
+	}
+	if m.QueueName != queue.ID {
+		return errInvalidReceiptHandle(handle)
+	}
+	if m.ReceiptHandle != handle {
+		return nil
+	}
+	if err := h.Store.Delete(ctx, id, "sqs", "message", ns); err != nil {
+		return &sqsError{"InternalError", "Failed to delete message: " + err.Error()}
+	}
+	return nil
+}
+
+// changeMessageVisibility resets the visibility timeout of an in-flight message.
+func (h *Handler) changeMessageVisibility(ctx context.Context, ns string, queue *resource.Resource, handle string, timeout *int) *sqsError {
+	if handle == "" {
+		return &sqsError{"MissingParameter", "The request must contain the parameter ReceiptHandle."}
+	}
+	if timeout == nil {
+		return &sqsError{"MissingParameter", "The request must contain the parameter VisibilityTimeout."}
+	}
+	if *timeout < 0 || *timeout > maxVisibilitySecs {
+		return errInvalidParameter("Value %d for parameter VisibilityTimeout is invalid. Reason: Must be between 0 and %d.", *timeout, maxVisibilitySecs)
+	}
+	id, serr := messageIDFromReceiptHandle(handle)
+	if serr != nil {
+		return serr
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	res, err := h.Store.Get(ctx, id, "sqs", "message", ns)
+	if err != nil || res == nil {
+		return errInvalidParameter("Value %s for parameter ReceiptHandle is invalid. Reason: Message does not exist or is not available for visibility timeout change.", handle)
+	}
+
+	_, err = h.mutateMessage(ctx, ns, id, func(m *storedMessage) error {
+		if m.QueueName != queue.ID || m.ReceiptHandle != handle {
+			return errInvalidParameter("Value %s for parameter ReceiptHandle is invalid. Reason: The receipt handle has expired.", handle)
+		}
+		now := nowMillis()
+		if !m.inFlight(now) {
+			return &sqsError{"AWS.SimpleQueueService.MessageNotInflight", "The message referred to is not in flight."}
+		}
+		m.VisibleAt = now + int64(*timeout)*1000
+		return nil
+	})
+	if errors.As(err, &serr) {
+		return serr
+	}
+	if err != nil {
+		return &sqsError{"InternalError", "Failed to update message: " + err.Error()}
+	}
+	return nil
+}
+
+// validateBatchIds checks the batch-wide constraints shared by every *Batch action.
+func validateBatchIds(ids []string) *sqsError {
+	if len(ids) == 0 {
+		return &sqsError{"AWS.SimpleQueueService.EmptyBatchRequest", "There should be at least one entry in the request."}
+	}
+	if len(ids) > maxBatchEntries {
+		return &sqsError{"AWS.SimpleQueueService.TooManyEntriesInBatchRequest", fmt.Sprintf("Maximum number of entries per request are %d. You have sent %d.", maxBatchEntries, len(ids))}
+	}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			return &sqsError{"AWS.SimpleQueueService.BatchEntryIdsNotDistinct", "Id " + id + " repeated."}
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+func batchError(id string, e *sqsError) BatchResultErrorEntry {
+	return BatchResultErrorEntry{
+		Id:          id,
+		SenderFault: e.Code != "InternalError",
+		Code:        e.Code,
+		Message:     e.Message,
+	}
+}
+
+//
+// RECEIVE RESULT SHAPING
+//
+
+// systemAttributes returns the message system attributes selected by names
+// ("All" selects every supported attribute).
+func systemAttributes(m *storedMessage, names []string) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+	sender := m.SenderId
+	if sender == "" {
+		sender = awsarn.Default.AccountID
+	}
+	all := map[string]string{
+		"SenderId":                         sender,
+		"SentTimestamp":                    strconv.FormatInt(m.SentTimestamp, 10),
+		"ApproximateReceiveCount":          strconv.Itoa(m.ReceiveCount),
+		"ApproximateFirstReceiveTimestamp": strconv.FormatInt(m.FirstReceiveTimestamp, 10),
+	}
+	if m.DeadLetterQueueSourceArn != "" {
+		all["DeadLetterQueueSourceArn"] = m.DeadLetterQueueSourceArn
+	}
+	if m.SequenceNumber != "" {
+		all["MessageGroupId"] = m.MessageGroupId
+		all["MessageDeduplicationId"] = m.MessageDeduplicationId
+		all["SequenceNumber"] = m.SequenceNumber
+	}
+	out := map[string]string{}
+	for _, name := range names {
+		if name == "All" {
+			return all
+		}
+		if v, ok := all[name]; ok {
+			out[name] = v
+		}
+	}
+	return out
+}
+
+// selectMessageAttributes filters user attributes by the requested names.
+// "All" and ".*" select everything; "prefix.*" selects by prefix.
+func selectMessageAttributes(attrs map[string]MessageAttributeValue, names []string) map[string]MessageAttributeValue {
+	if len(attrs) == 0 || len(names) == 0 {
+		return nil
+	}
+	out := map[string]MessageAttributeValue{}
+	for _, name := range names {
+		if name == "All" || name == ".*" {
+			return attrs
+		}
+		if prefix, ok := strings.CutSuffix(name, ".*"); ok {
+			for k, v := range attrs {
+				if strings.HasPrefix(k, prefix+".") || k == prefix {
+					out[k] = v
+				}
+			}
+			continue
+		}
+		if v, ok := attrs[name]; ok {
+			out[name] = v
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+//
+// QUERY API PARAMETER HELPERS
+//
+
+// formIntPtr parses an optional integer form value.
+func formIntPtr(r *http.Request, key string) (*int, *sqsError) {
+	v := r.FormValue(key)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, errInvalidParameter("Value %s for parameter %s is invalid. Reason: must be an integer.", v, key)
+	}
+	return &n, nil
+}
+
+// indexedFormValues collects prefix.1, prefix.2, ... until the first gap.
+func indexedFormValues(r *http.Request, prefix string) []string {
+	var out []string
+	for i := 1; ; i++ {
+		v := r.FormValue(fmt.Sprintf("%s.%d", prefix, i))
+		if v == "" {
+			return out
+		}
+		out = append(out, v)
+	}
+}
+
+// batchEntryIds collects prefix.N.Id for a Query API batch request.
+func batchEntryIds(r *http.Request, prefix string) []string {
+	var out []string
+	for i := 1; ; i++ {
+		id := r.FormValue(fmt.Sprintf("%s.%d.Id", prefix, i))
+		if id == "" {
+			return out
+		}
+		out = append(out, id)
+	}
+}
+
+// formMessageAttributes parses prefix.N.Name / prefix.N.Value.* parameters.
+func formMessageAttributes(r *http.Request, prefix string) (map[string]MessageAttributeValue, *sqsError) {
+	var out map[string]MessageAttributeValue
+	for i := 1; ; i++ {
+		base := fmt.Sprintf("%s.%d", prefix, i)
+		name := r.FormValue(base + ".Name")
+		if name == "" {
+			return out, nil
+		}
+		v := MessageAttributeValue{
+			DataType:    r.FormValue(base + ".Value.DataType"),
+			StringValue: r.FormValue(base + ".Value.StringValue"),
+		}
+		if b64 := r.FormValue(base + ".Value.BinaryValue"); b64 != "" {
+			raw, err := base64.StdEncoding.DecodeString(b64)
+			if err != nil {
+				return nil, errInvalidParameter("Message (user) attribute '%s' has an invalid binary value.", name)
+			}
+			v.BinaryValue = raw
+		}
+		if out == nil {
+			out = map[string]MessageAttributeValue{}
+		}
+		out[name] = v
+	}
+}
+
+func toXMLMessage(m *storedMessage, attributeNames, messageAttributeNames []string) Message {
+	msg := Message{
+		MessageId:     m.MessageId,
+		ReceiptHandle: m.ReceiptHandle,
+		MD5OfBody:     m.MD5OfBody,
+		Body:          m.Body,
+	}
+
+	sys := systemAttributes(m, attributeNames)
+	sysNames := make([]string, 0, len(sys))
+	for name := range sys {
+		sysNames = append(sysNames, name)
+	}
+	sort.Strings(sysNames)
+	for _, name := range sysNames {
+		msg.Attributes = append(msg.Attributes, MessageSystemAttribute{Name: name, Value: sys[name]})
+	}
+
+	selected := selectMessageAttributes(m.MessageAttributes, messageAttributeNames)
+	if len(selected) > 0 {
+		msg.MD5OfMessageAttributes = md5OfMessageAttributes(selected)
+		names := make([]string, 0, len(selected))
+		for name := range selected {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			v := selected[name]
+			xv := MessageAttributeXMLValue{DataType: v.DataType, StringValue: v.StringValue}
+			if len(v.BinaryValue) > 0 {
+				xv.BinaryValue = base64.StdEncoding.EncodeToString(v.BinaryValue)
+			}
+			msg.MessageAttributes = append(msg.MessageAttributes, MessageAttribute{Name: name, Value: xv})
+		}
+	}
+	return msg
+}
+
+func toJSONMessage(m *storedMessage, attributeNames, messageAttributeNames []string) MessageJSON {
+	msg := MessageJSON{
+		MessageId:     m.MessageId,
+		ReceiptHandle: m.ReceiptHandle,
+		MD5OfBody:     m.MD5OfBody,
+		Body:          m.Body,
+		Attributes:    systemAttributes(m, attributeNames),
+	}
+	if selected := selectMessageAttributes(m.MessageAttributes, messageAttributeNames); len(selected) > 0 {
+		msg.MessageAttributes = selected
+		msg.MD5OfMessageAttributes = md5OfMessageAttributes(selected)
+	}
+	return msg
+}
+
+// ─────────────────────────────────────────────────────────────
+// Query API (XML) message handlers
+// ─────────────────────────────────────────────────────────────
+
+func (h *Handler) SendMessage(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+	r.ParseForm()
+
+	queue, serr := h.lookupQueue(r.Context(), ns, r.FormValue("QueueUrl"))
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	delay, serr := formIntPtr(r, "DelaySeconds")
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+	attrs, serr := formMessageAttributes(r, "MessageAttribute")
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	m, serr := h.sendMessage(r.Context(), ns, queue, sendInput{
+		Body:                   r.FormValue("MessageBody"),
+		DelaySeconds:           delay,
+		MessageAttributes:      attrs,
+		MessageGroupId:         r.FormValue("MessageGroupId"),
+		MessageDeduplicationId: r.FormValue("MessageDeduplicationId"),
+	})
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	awsresponses.WriteXML(w, SendMessageResponse{
+		SendMessageResult: SendMessageResult{
+			MD5OfMessageBody:       m.MD5OfBody,
+			MD5OfMessageAttributes: m.MD5OfMessageAttributes,
+			MessageId:              m.MessageId,
+			SequenceNumber:         m.SequenceNumber,
+		},
+		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	})
+}
+
+func (h *Handler) SendMessageBatch(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+	r.ParseForm()
+
+	queue, serr := h.lookupQueue(r.Context(), ns, r.FormValue("QueueUrl"))
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	ids := batchEntryIds(r, "SendMessageBatchRequestEntry")
+	if serr := validateBatchIds(ids); serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	result := SendMessageBatchResult{}
+	for i, id := range ids {
+		base := fmt.Sprintf("SendMessageBatchRequestEntry.%d", i+1)
+
+		delay, serr := formIntPtr(r, base+".DelaySeconds")
+		if serr != nil {
+			result.Failed = append(result.Failed, batchError(id, serr))
+			continue
+		}
+		attrs, serr := formMessageAttributes(r, base+".MessageAttribute")
+		if serr != nil {
+			result.Failed = append(result.Failed, batchError(id, serr))
+			continue
+		}
+
+		m, serr := h.sendMessage(r.Context(), ns, queue, sendInput{
+			Body:                   r.FormValue(base + ".MessageBody"),
+			DelaySeconds:           delay,
+			MessageAttributes:      attrs,
+			MessageGroupId:         r.FormValue(base + ".MessageGroupId"),
+			MessageDeduplicationId: r.FormValue(base + ".MessageDeduplicationId"),
+		})
+		if serr != nil {
+			result.Failed = append(result.Failed, batchError(id, serr))
+			continue
+		}
+		result.Successful = append(result.Successful, SendMessageBatchResultEntry{
+			Id:                     id,
+			MessageId:              m.MessageId,
+			MD5OfMessageBody:       m.MD5OfBody,
+			MD5OfMessageAttributes: m.MD5OfMessageAttributes,
+			SequenceNumber:         m.SequenceNumber,
+		})
+	}
+
+	awsresponses.WriteXML(w, SendMessageBatchResponse{
+		SendMessageBatchResult: result,
+		ResponseMetadata:       ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	})
+}
+
+func (h *Handler) ReceiveMessage(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+	r.ParseForm()
+
+	queue, serr := h.lookupQueue(r.Context(), ns, r.FormValue("QueueUrl"))
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	var in receiveInput
+	if in.MaxNumberOfMessages, serr = formIntPtr(r, "MaxNumberOfMessages"); serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+	if in.VisibilityTimeout, serr = formIntPtr(r, "VisibilityTimeout"); serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+	if in.WaitTimeSeconds, serr = formIntPtr(r, "WaitTimeSeconds"); serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	msgs, serr := h.receiveMessages(r.Context(), ns, queue, in)
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	attributeNames := append(indexedFormValues(r, "AttributeName"), indexedFormValues(r, "MessageSystemAttributeName")...)
+	messageAttributeNames := indexedFormValues(r, "MessageAttributeName")
+
+	result := ReceiveMessageResult{}
+	for i := range msgs {
+		result.Messages = append(result.Messages, toXMLMessage(&msgs[i], attributeNames, messageAttributeNames))
+	}
+
+	awsresponses.WriteXML(w, ReceiveMessageResponse{
+		ReceiveMessageResult: result,
+		ResponseMetadata:     ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	})
+}
+
+func (h *Handler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+	r.ParseForm()
+
+	queue, serr := h.lookupQueue(r.Context(), ns, r.FormValue("QueueUrl"))
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	if serr := h.deleteMessage(r.Context(), ns, queue, r.FormValue("ReceiptHandle")); serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	awsresponses.WriteXML(w, DeleteMessageResponse{
+		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	})
+}
+
+func (h *Handler) DeleteMessageBatch(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+	r.ParseForm()
+
+	queue, serr := h.lookupQueue(r.Context(), ns, r.FormValue("QueueUrl"))
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	ids := batchEntryIds(r, "DeleteMessageBatchRequestEntry")
+	if serr := validateBatchIds(ids); serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	result := DeleteMessageBatchResult{}
+	for i, id := range ids {
+		handle := r.FormValue(fmt.Sprintf("DeleteMessageBatchRequestEntry.%d.ReceiptHandle", i+1))
+		if serr := h.deleteMessage(r.Context(), ns, queue, handle); serr != nil {
+			result.Failed = append(result.Failed, batchError(id, serr))
+			continue
+		}
+		result.Successful = append(result.Successful, DeleteMessageBatchResultEntry{Id: id})
+	}
+
+	awsresponses.WriteXML(w, DeleteMessageBatchResponse{
+		DeleteMessageBatchResult: result,
+		ResponseMetadata:         ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	})
+}
+
+func (h *Handler) ChangeMessageVisibility(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+	r.ParseForm()
+
+	queue, serr := h.lookupQueue(r.Context(), ns, r.FormValue("QueueUrl"))
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	timeout, serr := formIntPtr(r, "VisibilityTimeout")
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	if serr := h.changeMessageVisibility(r.Context(), ns, queue, r.FormValue("ReceiptHandle"), timeout); serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	awsresponses.WriteXML(w, ChangeMessageVisibilityResponse{
+		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	})
+}
+
+func (h *Handler) PurgeQueue(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+	r.ParseForm()
+
+	if serr := h.purgeQueue(r.Context(), ns, r.FormValue("QueueUrl")); serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	awsresponses.WriteXML(w, PurgeQueueResponse{
+		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	})
+}
+
+// ─────────────────────────────────────────────────────────────
+// JSON API message handlers
+// ─────────────────────────────────────────────────────────────
+
+func (h *Handler) SendMessageJSON(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req SendMessageJSONRequest
+	if err := util.DecodeAWSJSON(r, &req); err != nil {
+		writeJSONError(w, errInvalidParameter("Invalid request body: %s", err.Error()))
+		return
+	}
+
+	queue, serr := h.lookupQueue(r.Context(), ns, req.QueueUrl)
+	if serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	m, serr := h.sendMessage(r.Context(), ns, queue, sendInput{
+		Body:                   req.MessageBody,
+		DelaySeconds:           req.DelaySeconds,
+		MessageAttributes:      req.MessageAttributes,
+		MessageGroupId:         req.MessageGroupId,
+		MessageDeduplicationId: req.MessageDeduplicationId,
+	})
+	if serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, SendMessageJSONResponse{
+		MessageId:              m.MessageId,
+		MD5OfMessageBody:       m.MD5OfBody,
+		MD5OfMessageAttributes: m.MD5OfMessageAttributes,
+		SequenceNumber:         m.SequenceNumber,
+	})
+}
+
+func (h *Handler) SendMessageBatchJSON(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req SendMessageBatchJSONRequest
+	if err := util.DecodeAWSJSON(r, &req); err != nil {
+		writeJSONError(w, errInvalidParameter("Invalid request body: %s", err.Error()))
+		return
+	}
+
+	queue, serr := h.lookupQueue(r.Context(), ns, req.QueueUrl)
+	if serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	ids := make([]string, len(req.Entries))
+	for i, e := range req.Entries {
+		ids[i] = e.Id
+	}
+	if serr := validateBatchIds(ids); serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	resp := SendMessageBatchJSONResponse{
+		Successful: []SendMessageBatchResultEntry{},
+		Failed:     []BatchResultErrorEntry{},
+	}
+	for _, e := range req.Entries {
+		m, serr := h.sendMessage(r.Context(), ns, queue, sendInput{
+			Body:                   e.MessageBody,
+			DelaySeconds:           e.DelaySeconds,
+			MessageAttributes:      e.MessageAttributes,
+			MessageGroupId:         e.MessageGroupId,
+			MessageDeduplicationId: e.MessageDeduplicationId,
+		})
+		if serr != nil {
+			resp.Failed = append(resp.Failed, batchError(e.Id, serr))
+			continue
+		}
+		resp.Successful = append(resp.Successful, SendMessageBatchResultEntry{
+			Id:                     e.Id,
+			MessageId:              m.MessageId,
+			MD5OfMessageBody:       m.MD5OfBody,
+			MD5OfMessageAttributes: m.MD5OfMessageAttributes,
+			SequenceNumber:         m.SequenceNumber,
+		})
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) ReceiveMessageJSON(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req ReceiveMessageJSONRequest
+	if err := util.DecodeAWSJSON(r, &req); err != nil {
+		writeJSONError(w, errInvalidParameter("Invalid request body: %s", err.Error()))
+		return
+	}
+
+	queue, serr := h.lookupQueue(r.Context(), ns, req.QueueUrl)
+	if serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	msgs, serr := h.receiveMessages(r.Context(), ns, queue, receiveInput{
+		MaxNumberOfMessages: req.MaxNumberOfMessages,
+		VisibilityTimeout:   req.VisibilityTimeout,
+		WaitTimeSeconds:     req.WaitTimeSeconds,
+	})
+	if serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	attributeNames := append(req.AttributeNames, req.MessageSystemAttributeNames...)
+
+	resp := ReceiveMessageJSONResponse{}
+	for i := range msgs {
+		resp.Messages = append(resp.Messages, toJSONMessage(&msgs[i], attributeNames, req.MessageAttributeNames))
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) DeleteMessageJSON(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req DeleteMessageJSONRequest
+	if err := util.DecodeAWSJSON(r, &req); err != nil {
+		writeJSONError(w, errInvalidParameter("Invalid request body: %s", err.Error()))
+		return
+	}
+
+	queue, serr := h.lookupQueue(r.Context(), ns, req.QueueUrl)
+	if serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	if serr := h.deleteMessage(r.Context(), ns, queue, req.ReceiptHandle); serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, struct{}{})
+}
+
+func (h *Handler) DeleteMessageBatchJSON(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req DeleteMessageBatchJSONRequest
+	if err := util.DecodeAWSJSON(r, &req); err != nil {
+		writeJSONError(w, errInvalidParameter("Invalid request body: %s", err.Error()))
+		return
+	}
+
+	queue, serr := h.lookupQueue(r.Context(), ns, req.QueueUrl)
+	if serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	ids := make([]string, len(req.Entries))
+	for i, e := range req.Entries {
+		ids[i] = e.Id
+	}
+	if serr := validateBatchIds(ids); serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	resp := DeleteMessageBatchJSONResponse{
+		Successful: []DeleteMessageBatchResultEntry{},
+		Failed:     []BatchResultErrorEntry{},
+	}
+	for _, e := range req.Entries {
+		if serr := h.deleteMessage(r.Context(), ns, queue, e.ReceiptHandle); serr != nil {
+			resp.Failed = append(resp.Failed, batchError(e.Id, serr))
+			continue
+		}
+		resp.Successful = append(resp.Successful, DeleteMessageBatchResultEntry{Id: e.Id})
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) ChangeMessageVisibilityJSON(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req ChangeMessageVisibilityJSONRequest
+	if err := util.DecodeAWSJSON(r, &req); err != nil {
+		writeJSONError(w, errInvalidParameter("Invalid request body: %s", err.Error()))
+		return
+	}
+
+	queue, serr := h.lookupQueue(r.Context(), ns, req.QueueUrl)
+	if serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	if serr := h.changeMessageVisibility(r.Context(), ns, queue, req.ReceiptHandle, req.VisibilityTimeout); serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, struct{}{})
+}
+
+func (h *Handler) PurgeQueueJSON(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req PurgeQueueJSONRequest
+	if err := util.DecodeAWSJSON(r, &req); err != nil {
+		writeJSONError(w, errInvalidParameter("Invalid request body: %s", err.Error()))
+		return
+	}
+
+	if serr := h.purgeQueue(r.Context(), ns, req.QueueUrl); serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, struct{}{})
+}
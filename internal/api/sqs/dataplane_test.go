@@ -0,0 +1,474 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sqs_test
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"opensnack/internal/api/sqs"
+	"opensnack/internal/resource"
+)
+
+//
+// ─────────────────────────────────────────────────────────────
+// Helpers
+// ─────────────────────────────────────────────────────────────
+//
+
+const testQueueURL = "http://localhost:4566/000000000000/msgq"
+
+func seedQueue(t *testing.T, store *resource.MemoryStore, name string, attrs map[string]string) {
+	t.Helper()
+	entry := map[string]any{"name": name, "created_at": time.Now()}
+	if attrs != nil {
+		entry["attributes"] = attrs
+	}
+	buf, _ := json.Marshal(entry)
+	store.Create(t.Context(), &resource.Resource{
+		ID:         name,
+		Namespace:  "ns1",
+		Service:    "sqs",
+		Type:       "queue",
+		Attributes: buf,
+	})
+}
+
+// callJSON invokes an AmazonSQS.* JSON action and decodes the response into out.
+func callJSON(t *testing.T, h *sqs.Handler, action string, body any, out any) *httptest.ResponseRecorder {
+	t.Helper()
+	buf, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", "/sqs", strings.NewReader(string(buf)))
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	req.Header.Set("User-Agent", "opensnack-test custom-ns1")
+	rec := httptest.NewRecorder()
+
+	h.Dispatch(rec, req)
+
+	if out != nil && rec.Code == 200 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("invalid JSON for %s: %s", action, rec.Body.String())
+		}
+	}
+	return rec
+}
+
+// callQuery invokes a Query API action with form-encoded parameters.
+func callQuery(h *sqs.Handler, params url.Values) *httptest.ResponseRecorder {
+	req, rec := newContext("POST", "/sqs", strings.NewReader(params.Encode()))
+	h.Dispatch(rec, req)
+	return rec
+}
+
+func intPtr(n int) *int { return &n }
+
+func queueAttrs(t *testing.T, h *sqs.Handler) map[string]string {
+	t.Helper()
+	var resp struct {
+		Attributes map[string]string
+	}
+	callJSON(t, h, "GetQueueAttributes", map[string]any{
+		"QueueUrl":       testQueueURL,
+		"AttributeNames": []string{"All"},
+	}, &resp)
+	return resp.Attributes
+}
+
+//
+// ─────────────────────────────────────────────────────────────
+// TESTS
+// ─────────────────────────────────────────────────────────────
+//
+
+func TestSendReceiveDelete_JSON(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+	seedQueue(t, store, "msgq", nil)
+
+	var sent sqs.SendMessageJSONResponse
+	rec := callJSON(t, h, "SendMessage", sqs.SendMessageJSONRequest{
+		QueueUrl:    testQueueURL,
+		MessageBody: "hello",
+		MessageAttributes: map[string]sqs.MessageAttributeValue{
+			"color": {DataType: "String", StringValue: "blue"},
+		},
+	}, &sent)
+	if rec.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	sum := md5.Sum([]byte("hello"))
+	if sent.MD5OfMessageBody != hex.EncodeToString(sum[:]) {
+		t.Fatalf("wrong body MD5: %s", sent.MD5OfMessageBody)
+	}
+	if sent.MessageId == "" || sent.MD5OfMessageAttributes == "" {
+		t.Fatalf("missing MessageId or attribute MD5: %+v", sent)
+	}
+
+	if got := queueAttrs(t, h)["ApproximateNumberOfMessages"]; got != "1" {
+		t.Fatalf("expected 1 visible message, got %s", got)
+	}
+
+	var recv sqs.ReceiveMessageJSONResponse
+	callJSON(t, h, "ReceiveMessage", sqs.ReceiveMessageJSONRequest{
+		QueueUrl:              testQueueURL,
+		AttributeNames:        []string{"ApproximateReceiveCount"},
+		MessageAttributeNames: []string{"All"},
+	}, &recv)
+	if len(recv.Messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(recv.Messages))
+	}
+	msg := recv.Messages[0]
+	if msg.Body != "hello" || msg.MessageId != sent.MessageId {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	if msg.Attributes["ApproximateReceiveCount"] != "1" {
+		t.Fatalf("expected receive count 1, got %v", msg.Attributes)
+	}
+	if msg.MD5OfMessageAttributes != sent.MD5OfMessageAttributes {
+		t.Fatalf("attribute MD5 mismatch: %s vs %s", msg.MD5OfMessageAttributes, sent.MD5OfMessageAttributes)
+	}
+	if msg.MessageAttributes["color"].StringValue != "blue" {
+		t.Fatalf("missing message attribute: %+v", msg.MessageAttributes)
+	}
+
+	// The message is now in flight and must not be handed out again.
+	var again sqs.ReceiveMessageJSONResponse
+	callJSON(t, h, "ReceiveMessage", sqs.ReceiveMessageJSONRequest{QueueUrl: testQueueURL}, &again)
+	if len(again.Messages) != 0 {
+		t.Fatalf("in-flight message was received twice")
+	}
+	if got := queueAttrs(t, h)["ApproximateNumberOfMessagesNotVisible"]; got != "1" {
+		t.Fatalf("expected 1 in-flight message, got %s", got)
+	}
+
+	rec = callJSON(t, h, "DeleteMessage", sqs.DeleteMessageJSONRequest{
+		QueueUrl:      testQueueURL,
+		ReceiptHandle: msg.ReceiptHandle,
+	}, nil)
+	if rec.Code != 200 {
+		t.Fatalf("delete failed: %s", rec.Body.String())
+	}
+
+	attrs := queueAttrs(t, h)
+	if attrs["ApproximateNumberOfMessages"] != "0" || attrs["ApproximateNumberOfMessagesNotVisible"] != "0" {
+		t.Fatalf("queue should be empty: %v", attrs)
+	}
+
+	// Deleting again is accepted; a handle that was never handed out is not.
+	rec = callJSON(t, h, "DeleteMessage", sqs.DeleteMessageJSONRequest{
+		QueueUrl:      testQueueURL,
+		ReceiptHandle: msg.ReceiptHandle,
+	}, nil)
+	if rec.Code != 200 {
+		t.Fatalf("repeated delete failed: %s", rec.Body.String())
+	}
+	forged := base64.RawURLEncoding.EncodeToString([]byte(sent.MessageId + ":0123456789abcdef"))
+	rec = callJSON(t, h, "DeleteMessage", sqs.DeleteMessageJSONRequest{
+		QueueUrl:      testQueueURL,
+		ReceiptHandle: forged,
+	}, nil)
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "ReceiptHandleIsInvalid") {
+		t.Fatalf("expected ReceiptHandleIsInvalid, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestReceiveMessage_VisibilityTimeout(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+	seedQueue(t, store, "msgq", nil)
+
+	callJSON(t, h, "SendMessage", sqs.SendMessageJSONRequest{QueueUrl: testQueueURL, MessageBody: "again"}, nil)
+
+	// VisibilityTimeout=0 makes the message immediately receivable again.
+	var first, second sqs.ReceiveMessageJSONResponse
+	callJSON(t, h, "ReceiveMessage", sqs.ReceiveMessageJSONRequest{
+		QueueUrl:          testQueueURL,
+		VisibilityTimeout: intPtr(0),
+	}, &first)
+	callJSON(t, h, "ReceiveMessage", sqs.ReceiveMessageJSONRequest{
+		QueueUrl:       testQueueURL,
+		AttributeNames: []string{"All"},
+	}, &second)
+
+	if len(first.Messages) != 1 || len(second.Messages) != 1 {
+		t.Fatalf("expected message on both receives")
+	}
+	if second.Messages[0].Attributes["ApproximateReceiveCount"] != "2" {
+		t.Fatalf("expected receive count 2, got %v", second.Messages[0].Attributes)
+	}
+
+	// The first receipt handle is stale: deleting with it is a no-op.
+	callJSON(t, h, "DeleteMessage", sqs.DeleteMessageJSONRequest{
+		QueueUrl:      testQueueURL,
+		ReceiptHandle: first.Messages[0].ReceiptHandle,
+	}, nil)
+	if got := queueAttrs(t, h)["ApproximateNumberOfMessagesNotVisible"]; got != "1" {
+		t.Fatalf("stale receipt handle deleted the message")
+	}
+
+	// ChangeMessageVisibility to 0 releases it back to the queue.
+	rec := callJSON(t, h, "ChangeMessageVisibility", sqs.ChangeMessageVisibilityJSONRequest{
+		QueueUrl:          testQueueURL,
+		ReceiptHandle:     second.Messages[0].ReceiptHandle,
+		VisibilityTimeout: intPtr(0),
+	}, nil)
+	if rec.Code != 200 {
+		t.Fatalf("change visibility failed: %s", rec.Body.String())
+	}
+	if got := queueAttrs(t, h)["ApproximateNumberOfMessages"]; got != "1" {
+		t.Fatalf("expected message to be visible again, got %s", got)
+	}
+}
+
+func TestSendMessage_DelaySeconds(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+	seedQueue(t, store, "msgq", nil)
+
+	callJSON(t, h, "SendMessage", sqs.SendMessageJSONRequest{
+		QueueUrl:     testQueueURL,
+		MessageBody:  "later",
+		DelaySeconds: intPtr(60),
+	}, nil)
+
+	if got := queueAttrs(t, h)["ApproximateNumberOfMessagesDelayed"]; got != "1" {
+		t.Fatalf("expected 1 delayed message, got %s", got)
+	}
+
+	var recv sqs.ReceiveMessageJSONResponse
+	callJSON(t, h, "ReceiveMessage", sqs.ReceiveMessageJSONRequest{QueueUrl: testQueueURL}, &recv)
+	if len(recv.Messages) != 0 {
+		t.Fatalf("delayed message must not be received")
+	}
+}
+
+func TestReceiveMessage_LongPoll(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+	seedQueue(t, store, "msgq", nil)
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		callJSON(t, h, "SendMessage", sqs.SendMessageJSONRequest{QueueUrl: testQueueURL, MessageBody: "late"}, nil)
+	}()
+
+	start := time.Now()
+	var recv sqs.ReceiveMessageJSONResponse
+	callJSON(t, h, "ReceiveMessage", sqs.ReceiveMessageJSONRequest{
+		QueueUrl:        testQueueURL,
+		WaitTimeSeconds: intPtr(5),
+	}, &recv)
+
+	if len(recv.Messages) != 1 || recv.Messages[0].Body != "late" {
+		t.Fatalf("long poll did not return the late message: %+v", recv)
+	}
+	if time.Since(start) > 4*time.Second {
+		t.Fatalf("long poll waited for the full timeout")
+	}
+}
+
+func TestReceiveMessage_InvalidMaxNumber(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+	seedQueue(t, store, "msgq", nil)
+
+	rec := callJSON(t, h, "ReceiveMessage", sqs.ReceiveMessageJSONRequest{
+		QueueUrl:            testQueueURL,
+		MaxNumberOfMessages: intPtr(11),
+	}, nil)
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "InvalidParameterValue") {
+		t.Fatalf("expected InvalidParameterValue, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestBatchSendAndDelete_JSON(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+	seedQueue(t, store, "msgq", nil)
+
+	var sent sqs.SendMessageBatchJSONResponse
+	callJSON(t, h, "SendMessageBatch", sqs.SendMessageBatchJSONRequest{
+		QueueUrl: testQueueURL,
+		Entries: []sqs.SendMessageBatchRequestEntry{
+			{Id: "a", MessageBody: "one"},
+			{Id: "b", MessageBody: "two"},
+			{Id: "c", MessageBody: ""},
+		},
+	}, &sent)
+	if len(sent.Successful) != 2 || len(sent.Failed) != 1 || sent.Failed[0].Id != "c" {
+		t.Fatalf("unexpected batch result: %+v", sent)
+	}
+
+	var recv sqs.ReceiveMessageJSONResponse
+	callJSON(t, h, "ReceiveMessage", sqs.ReceiveMessageJSONRequest{
+		QueueUrl:            testQueueURL,
+		MaxNumberOfMessages: intPtr(10),
+	}, &recv)
+	if len(recv.Messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(recv.Messages))
+	}
+
+	var deleted sqs.DeleteMessageBatchJSONResponse
+	callJSON(t, h, "DeleteMessageBatch", sqs.DeleteMessageBatchJSONRequest{
+		QueueUrl: testQueueURL,
+		Entries: []sqs.DeleteMessageBatchRequestEntry{
+			{Id: "x", ReceiptHandle: recv.Messages[0].ReceiptHandle},
+			{Id: "y", ReceiptHandle: recv.Messages[1].ReceiptHandle},
+			{Id: "z", ReceiptHandle: "!!not-a-handle!!"},
+		},
+	}, &deleted)
+	if len(deleted.Successful) != 2 || len(deleted.Failed) != 1 || deleted.Failed[0].Code != "ReceiptHandleIsInvalid" {
+		t.Fatalf("unexpected delete batch result: %+v", deleted)
+	}
+
+	rec := callJSON(t, h, "SendMessageBatch", sqs.SendMessageBatchJSONRequest{
+		QueueUrl: testQueueURL,
+		Entries: []sqs.SendMessageBatchRequestEntry{
+			{Id: "dup", MessageBody: "one"},
+			{Id: "dup", MessageBody: "two"},
+		},
+	}, nil)
+	if !strings.Contains(rec.Body.String(), "BatchEntryIdsNotDistinct") {
+		t.Fatalf("expected BatchEntryIdsNotDistinct, got %s", rec.Body.String())
+	}
+}
+
+func TestSendReceive_Query(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+	seedQueue(t, store, "msgq", nil)
+
+	rec := callQuery(h, url.Values{
+		"Action":                               {"SendMessage"},
+		"QueueUrl":                             {testQueueURL},
+		"MessageBody":                          {"xml body"},
+		"MessageAttribute.1.Name":              {"count"},
+		"MessageAttribute.1.Value.DataType":    {"Number"},
+		"MessageAttribute.1.Value.StringValue": {"42"},
+	})
+	var sent sqs.SendMessageResponse
+	if rec.Code != 200 || xml.Unmarshal(rec.Body.Bytes(), &sent) != nil {
+		t.Fatalf("send failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = callQuery(h, url.Values{
+		"Action":                 {"ReceiveMessage"},
+		"QueueUrl":               {testQueueURL},
+		"AttributeName.1":        {"SentTimestamp"},
+		"MessageAttributeName.1": {"All"},
+	})
+	var recv sqs.ReceiveMessageResponse
+	if xml.Unmarshal(rec.Body.Bytes(), &recv) != nil {
+		t.Fatalf("invalid XML: %s", rec.Body.String())
+	}
+	msgs := recv.ReceiveMessageResult.Messages
+	if len(msgs) != 1 || msgs[0].Body != "xml body" {
+		t.Fatalf("unexpected receive: %s", rec.Body.String())
+	}
+	if msgs[0].MD5OfMessageAttributes != sent.SendMessageResult.MD5OfMessageAttributes {
+		t.Fatalf("attribute MD5 mismatch")
+	}
+	if len(msgs[0].Attributes) != 1 || msgs[0].Attributes[0].Name != "SentTimestamp" {
+		t.Fatalf("expected SentTimestamp attribute: %+v", msgs[0].Attributes)
+	}
+
+	rec = callQuery(h, url.Values{
+		"Action":        {"DeleteMessage"},
+		"QueueUrl":      {testQueueURL},
+		"ReceiptHandle": {msgs[0].ReceiptHandle},
+	})
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), "DeleteMessageResponse") {
+		t.Fatalf("delete failed: %s", rec.Body.String())
+	}
+}
+
+func TestSendMessage_NonExistentQueue(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+
+	rec := callQuery(h, url.Values{
+		"Action":      {"SendMessage"},
+		"QueueUrl":    {"http://localhost:4566/000000000000/missing"},
+		"MessageBody": {"x"},
+	})
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "AWS.SimpleQueueService.NonExistentQueue") {
+		t.Fatalf("expected NonExistentQueue, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPurgeQueue_JSON(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+	seedQueue(t, store, "msgq", nil)
+	seedQueue(t, store, "otherq", nil)
+	otherURL := "http://localhost:4566/000000000000/otherq"
+
+	for _, body := range []string{"a", "b", "c"} {
+		callJSON(t, h, "SendMessage", sqs.SendMessageJSONRequest{QueueUrl: testQueueURL, MessageBody: body}, nil)
+	}
+	callJSON(t, h, "SendMessage", sqs.SendMessageJSONRequest{QueueUrl: otherURL, MessageBody: "keep"}, nil)
+
+	// Leave one message in flight: purge removes those too.
+	var recv sqs.ReceiveMessageJSONResponse
+	callJSON(t, h, "ReceiveMessage", sqs.ReceiveMessageJSONRequest{QueueUrl: testQueueURL}, &recv)
+	if len(recv.Messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(recv.Messages))
+	}
+
+	rec := callJSON(t, h, "PurgeQueue", map[string]any{"QueueUrl": testQueueURL}, nil)
+	if rec.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	attrs := queueAttrs(t, h)
+	for _, name := range []string{"ApproximateNumberOfMessages", "ApproximateNumberOfMessagesNotVisible", "ApproximateNumberOfMessagesDelayed"} {
+		if attrs[name] != "0" {
+			t.Fatalf("expected %s 0 after purge, got %s", name, attrs[name])
+		}
+	}
+
+	var other sqs.ReceiveMessageJSONResponse
+	callJSON(t, h, "ReceiveMessage", sqs.ReceiveMessageJSONRequest{QueueUrl: otherURL}, &other)
+	if len(other.Messages) != 1 || other.Messages[0].Body != "keep" {
+		t.Fatalf("purge touched another queue: %+v", other.Messages)
+	}
+}
+
+func TestPurgeQueue_Query(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+	seedQueue(t, store, "msgq", nil)
+
+	callQuery(h, url.Values{"Action": {"SendMessage"}, "QueueUrl": {testQueueURL}, "MessageBody": {"x"}})
+
+	rec := callQuery(h, url.Values{"Action": {"PurgeQueue"}, "QueueUrl": {testQueueURL}})
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), "PurgeQueueResponse") {
+		t.Fatalf("purge failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = callQuery(h, url.Values{"Action": {"ReceiveMessage"}, "QueueUrl": {testQueueURL}})
+	var recv sqs.ReceiveMessageResponse
+	if xml.Unmarshal(rec.Body.Bytes(), &recv) != nil {
+		t.Fatalf("invalid XML: %s", rec.Body.String())
+	}
+	if len(recv.ReceiveMessageResult.Messages) != 0 {
+		t.Fatalf("expected an empty queue after purge, got %d messages", len(recv.ReceiveMessageResult.Messages))
+	}
+
+	rec = callQuery(h, url.Values{"Action": {"PurgeQueue"}, "QueueUrl": {"http://localhost:4566/000000000000/missing"}})
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "AWS.SimpleQueueService.NonExistentQueue") {
+		t.Fatalf("expected NonExistentQueue, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
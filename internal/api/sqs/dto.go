@@ -34,6 +34,7 @@ type CreateQueueResponse struct {
 type ListQueuesResult struct {
 	XMLName   xml.Name `xml:"ListQueuesResult"`
 	QueueUrls []string `xml:"QueueUrl"`
+	NextToken string   `xml:"NextToken,omitempty"`
 }
 
 type ListQueuesResponse struct {
@@ -71,3 +72,323 @@ type CreateQueueJSONRequest struct {
 type CreateQueueJSONResponse struct {
 	QueueUrl string `json:"QueueUrl"`
 }
+
+// ListQueues JSON API Request
+type ListQueuesJSONRequest struct {
+	QueueNamePrefix string `json:"QueueNamePrefix,omitempty"`
+	MaxResults      *int   `json:"MaxResults,omitempty"`
+	NextToken       string `json:"NextToken,omitempty"`
+}
+
+// ListQueues JSON API Response
+type ListQueuesJSONResponse struct {
+	QueueUrls []string `json:"QueueUrls"`
+	NextToken string   `json:"NextToken,omitempty"`
+}
+
+// ─────────────────────────────────────────────────────────────
+// Messages (shared between Query and JSON APIs)
+// ─────────────────────────────────────────────────────────────
+
+// MessageAttributeValue is a user-supplied message attribute.
+// BinaryValue is base64 encoded on the wire by encoding/json.
+type MessageAttributeValue struct {
+	DataType    string `json:"DataType"`
+	StringValue string `json:"StringValue,omitempty"`
+	BinaryValue []byte `json:"BinaryValue,omitempty"`
+}
+
+type BatchResultErrorEntry struct {
+	Id          string `xml:"Id" json:"Id"`
+	SenderFault bool   `xml:"SenderFault" json:"SenderFault"`
+	Code        string `xml:"Code" json:"Code"`
+	Message     string `xml:"Message,omitempty" json:"Message,omitempty"`
+}
+
+type SendMessageBatchResultEntry struct {
+	Id                     string `xml:"Id" json:"Id"`
+	MessageId              string `xml:"MessageId" json:"MessageId"`
+	MD5OfMessageBody       string `xml:"MD5OfMessageBody" json:"MD5OfMessageBody"`
+	MD5OfMessageAttributes string `xml:"MD5OfMessageAttributes,omitempty" json:"MD5OfMessageAttributes,omitempty"`
+	SequenceNumber         string `xml:"SequenceNumber,omitempty" json:"SequenceNumber,omitempty"`
+}
+
+type DeleteMessageBatchResultEntry struct {
+	Id string `xml:"Id" json:"Id"`
+}
+
+// ─────────────────────────────────────────────────────────────
+// SendMessage / SendMessageBatch (Query API)
+// ─────────────────────────────────────────────────────────────
+
+type SendMessageResult struct {
+	XMLName                xml.Name `xml:"SendMessageResult"`
+	MD5OfMessageBody       string   `xml:"MD5OfMessageBody"`
+	MD5OfMessageAttributes string   `xml:"MD5OfMessageAttributes,omitempty"`
+	MessageId              string   `xml:"MessageId"`
+	SequenceNumber         string   `xml:"SequenceNumber,omitempty"`
+}
+
+type SendMessageResponse struct {
+	XMLName           xml.Name          `xml:"SendMessageResponse"`
+	SendMessageResult SendMessageResult `xml:"SendMessageResult"`
+	ResponseMetadata  ResponseMetadata  `xml:"ResponseMetadata"`
+}
+
+type SendMessageBatchResult struct {
+	XMLName    xml.Name                      `xml:"SendMessageBatchResult"`
+	Successful []SendMessageBatchResultEntry `xml:"SendMessageBatchResultEntry"`
+	Failed     []BatchResultErrorEntry       `xml:"BatchResultErrorEntry"`
+}
+
+type SendMessageBatchResponse struct {
+	XMLName                xml.Name               `xml:"SendMessageBatchResponse"`
+	SendMessageBatchResult SendMessageBatchResult `xml:"SendMessageBatchResult"`
+	ResponseMetadata       ResponseMetadata       `xml:"ResponseMetadata"`
+}
+
+// ─────────────────────────────────────────────────────────────
+// ReceiveMessage (Query API)
+// ─────────────────────────────────────────────────────────────
+
+type MessageSystemAttribute struct {
+	Name  string `xml:"Name"`
+	Value string `xml:"Value"`
+}
+
+type MessageAttributeXMLValue struct {
+	StringValue string `xml:"StringValue,omitempty"`
+	BinaryValue string `xml:"BinaryValue,omitempty"`
+	DataType    string `xml:"DataType"`
+}
+
+type MessageAttribute struct {
+	Name  string                   `xml:"Name"`
+	Value MessageAttributeXMLValue `xml:"Value"`
+}
+
+type Message struct {
+	MessageId              string                   `xml:"MessageId"`
+	ReceiptHandle          string                   `xml:"ReceiptHandle"`
+	MD5OfBody              string                   `xml:"MD5OfBody"`
+	Body                   string                   `xml:"Body"`
+	Attributes             []MessageSystemAttribute `xml:"Attribute"`
+	MD5OfMessageAttributes string                   `xml:"MD5OfMessageAttributes,omitempty"`
+	MessageAttributes      []MessageAttribute       `xml:"MessageAttribute"`
+}
+
+type ReceiveMessageResult struct {
+	XMLName  xml.Name  `xml:"ReceiveMessageResult"`
+	Messages []Message `xml:"Message"`
+}
+
+type ReceiveMessageResponse struct {
+	XMLName              xml.Name             `xml:"ReceiveMessageResponse"`
+	ReceiveMessageResult ReceiveMessageResult `xml:"ReceiveMessageResult"`
+	ResponseMetadata     ResponseMetadata     `xml:"ResponseMetadata"`
+}
+
+// ─────────────────────────────────────────────────────────────
+// DeleteMessage / DeleteMessageBatch / ChangeMessageVisibility / PurgeQueue (Query API)
+// ─────────────────────────────────────────────────────────────
+
+type DeleteMessageResponse struct {
+	XMLName          xml.Name         `xml:"DeleteMessageResponse"`
+	ResponseMetadata ResponseMetadata `xml:"ResponseMetadata"`
+}
+
+type DeleteMessageBatchResult struct {
+	XMLName    xml.Name                        `xml:"DeleteMessageBatchResult"`
+	Successful []DeleteMessageBatchResultEntry `xml:"DeleteMessageBatchResultEntry"`
+	Failed     []BatchResultErrorEntry         `xml:"BatchResultErrorEntry"`
+}
+
+type DeleteMessageBatchResponse struct {
+	XMLName                  xml.Name                 `xml:"DeleteMessageBatchResponse"`
+	DeleteMessageBatchResult DeleteMessageBatchResult `xml:"DeleteMessageBatchResult"`
+	ResponseMetadata         ResponseMetadata         `xml:"ResponseMetadata"`
+}
+
+type ChangeMessageVisibilityResponse struct {
+	XMLName          xml.Name         `xml:"ChangeMessageVisibilityResponse"`
+	ResponseMetadata ResponseMetadata `xml:"ResponseMetadata"`
+}
+
+type PurgeQueueResponse struct {
+	XMLName          xml.Name         `xml:"PurgeQueueResponse"`
+	ResponseMetadata ResponseMetadata `xml:"ResponseMetadata"`
+}
+
+// ─────────────────────────────────────────────────────────────
+// Message JSON API DTOs
+// ─────────────────────────────────────────────────────────────
+
+type SendMessageJSONRequest struct {
+	QueueUrl               string                           `json:"QueueUrl"`
+	MessageBody            string                           `json:"MessageBody"`
+	DelaySeconds           *int                             `json:"DelaySeconds,omitempty"`
+	MessageAttributes      map[string]MessageAttributeValue `json:"MessageAttributes,omitempty"`
+	MessageGroupId         string                           `json:"MessageGroupId,omitempty"`
+	MessageDeduplicationId string                           `json:"MessageDeduplicationId,omitempty"`
+}
+
+type SendMessageJSONResponse struct {
+	MessageId              string `json:"MessageId"`
+	MD5OfMessageBody       string `json:"MD5OfMessageBody"`
+	MD5OfMessageAttributes string `json:"MD5OfMessageAttributes,omitempty"`
+	SequenceNumber         string `json:"SequenceNumber,omitempty"`
+}
+
+type SendMessageBatchRequestEntry struct {
+	Id                     string                           `json:"Id"`
+	MessageBody            string                           `json:"MessageBody"`
+	DelaySeconds           *int                             `json:"DelaySeconds,omitempty"`
+	MessageAttributes      map[string]MessageAttributeValue `json:"MessageAttributes,omitempty"`
+	MessageGroupId         string                           `json:"MessageGroupId,omitempty"`
+	MessageDeduplicationId string                           `json:"MessageDeduplicationId,omitempty"`
+}
+
+type SendMessageBatchJSONRequest struct {
+	QueueUrl string                         `json:"QueueUrl"`
+	Entries  []SendMessageBatchRequestEntry `json:"Entries"`
+}
+
+type SendMessageBatchJSONResponse struct {
+	Successful []SendMessageBatchResultEntry `json:"Successful"`
+	Failed     []BatchResultErrorEntry       `json:"Failed"`
+}
+
+type ReceiveMessageJSONRequest struct {
+	QueueUrl                    string   `json:"QueueUrl"`
+	MaxNumberOfMessages         *int     `json:"MaxNumberOfMessages,omitempty"`
+	VisibilityTimeout           *int     `json:"VisibilityTimeout,omitempty"`
+	WaitTimeSeconds             *int     `json:"WaitTimeSeconds,omitempty"`
+	AttributeNames              []string `json:"AttributeNames,omitempty"`
+	MessageSystemAttributeNames []string `json:"MessageSystemAttributeNames,omitempty"`
+	MessageAttributeNames       []string `json:"MessageAttributeNames,omitempty"`
+}
+
+type MessageJSON struct {
+	MessageId              string                           `json:"MessageId"`
+	ReceiptHandle          string                           `json:"ReceiptHandle"`
+	MD5OfBody              string                           `json:"MD5OfBody"`
+	Body                   string                           `json:"Body"`
+	Attributes             map[string]string                `json:"Attributes,omitempty"`
+	MD5OfMessageAttributes string                           `json:"MD5OfMessageAttributes,omitempty"`
+	MessageAttributes      map[string]MessageAttributeValue `json:"MessageAttributes,omitempty"`
+}
+
+type ReceiveMessageJSONResponse struct {
+	Messages []MessageJSON `json:"Messages,omitempty"`
+}
+
+type DeleteMessageJSONRequest struct {
+	QueueUrl      string `json:"QueueUrl"`
+	ReceiptHandle string `json:"ReceiptHandle"`
+}
+
+type DeleteMessageBatchRequestEntry struct {
+	Id            string `json:"Id"`
+	ReceiptHandle string `json:"ReceiptHandle"`
+}
+
+type DeleteMessageBatchJSONRequest struct {
+	QueueUrl string                           `json:"QueueUrl"`
+	Entries  []DeleteMessageBatchRequestEntry `json:"Entries"`
+}
+
+type DeleteMessageBatchJSONResponse struct {
+	Successful []DeleteMessageBatchResultEntry `json:"Successful"`
+	Failed     []BatchResultErrorEntry         `json:"Failed"`
+}
+
+type ChangeMessageVisibilityJSONRequest struct {
+	QueueUrl          string `json:"QueueUrl"`
+	ReceiptHandle     string `json:"ReceiptHandle"`
+	VisibilityTimeout *int   `json:"VisibilityTimeout,omitempty"`
+}
+
+type PurgeQueueJSONRequest struct {
+	QueueUrl string `json:"QueueUrl"`
+}
+
+// ─────────────────────────────────────────────────────────────
+// Dead-letter queues and message move tasks
+// ─────────────────────────────────────────────────────────────
+
+type ListDeadLetterSourceQueuesResult struct {
+	XMLName   xml.Name `xml:"ListDeadLetterSourceQueuesResult"`
+	QueueUrls []string `xml:"QueueUrl"`
+	NextToken string   `xml:"NextToken,omitempty"`
+}
+
+type ListDeadLetterSourceQueuesResponse struct {
+	XMLName                          xml.Name                         `xml:"ListDeadLetterSourceQueuesResponse"`
+	ListDeadLetterSourceQueuesResult ListDeadLetterSourceQueuesResult `xml:"ListDeadLetterSourceQueuesResult"`
+	ResponseMetadata                 ResponseMetadata                 `xml:"ResponseMetadata"`
+}
+
+type ListDeadLetterSourceQueuesJSONRequest struct {
+	QueueUrl   string `json:"QueueUrl"`
+	MaxResults *int   `json:"MaxResults,omitempty"`
+	NextToken  string `json:"NextToken,omitempty"`
+}
+
+type ListDeadLetterSourceQueuesJSONResponse struct {
+	QueueUrls []string `json:"queueUrls"`
+	NextToken string   `json:"NextToken,omitempty"`
+}
+
+type StartMessageMoveTaskResult struct {
+	XMLName    xml.Name `xml:"StartMessageMoveTaskResult"`
+	TaskHandle string   `xml:"TaskHandle"`
+}
+
+type StartMessageMoveTaskResponse struct {
+	XMLName                    xml.Name                   `xml:"StartMessageMoveTaskResponse"`
+	StartMessageMoveTaskResult StartMessageMoveTaskResult `xml:"StartMessageMoveTaskResult"`
+	ResponseMetadata           ResponseMetadata           `xml:"ResponseMetadata"`
+}
+
+type StartMessageMoveTaskJSONRequest struct {
+	SourceArn                    string `json:"SourceArn"`
+	DestinationArn               string `json:"DestinationArn,omitempty"`
+	MaxNumberOfMessagesPerSecond *int   `json:"MaxNumberOfMessagesPerSecond,omitempty"`
+}
+
+type StartMessageMoveTaskJSONResponse struct {
+	TaskHandle string `json:"TaskHandle"`
+}
+
+// MessageMoveTask is a single ListMessageMoveTasks result entry.
+type MessageMoveTask struct {
+	TaskHandle                        string `xml:"TaskHandle,omitempty" json:"TaskHandle,omitempty"`
+	Status                            string `xml:"Status" json:"Status"`
+	SourceArn                         string `xml:"SourceArn" json:"SourceArn"`
+	DestinationArn                    string `xml:"DestinationArn,omitempty" json:"DestinationArn,omitempty"`
+	MaxNumberOfMessagesPerSecond      int    `xml:"MaxNumberOfMessagesPerSecond,omitempty" json:"MaxNumberOfMessagesPerSecond,omitempty"`
+	ApproximateNumberOfMessagesMoved  int    `xml:"ApproximateNumberOfMessagesMoved" json:"ApproximateNumberOfMessagesMoved"`
+	ApproximateNumberOfMessagesToMove int    `xml:"ApproximateNumberOfMessagesToMove" json:"ApproximateNumberOfMessagesToMove"`
+	FailureReason                     string `xml:"FailureReason,omitempty" json:"FailureReason,omitempty"`
+	StartedTimestamp                  int64  `xml:"StartedTimestamp" json:"StartedTimestamp"`
+}
+
+type ListMessageMoveTasksResult struct {
+	XMLName xml.Name          `xml:"ListMessageMoveTasksResult"`
+	Results []MessageMoveTask `xml:"ListMessageMoveTasksResultEntry"`
+}
+
+type ListMessageMoveTasksResponse struct {
+	XMLName                    xml.Name                   `xml:"ListMessageMoveTasksResponse"`
+	ListMessageMoveTasksResult ListMessageMoveTasksResult `xml:"ListMessageMoveTasksResult"`
+	ResponseMetadata           ResponseMetadata           `xml:"ResponseMetadata"`
+}
+
+type ListMessageMoveTasksJSONRequest struct {
+	SourceArn  string `json:"SourceArn"`
+	MaxResults *int   `json:"MaxResults,omitempty"`
+}
+
+type ListMessageMoveTasksJSONResponse struct {
+	Results []MessageMoveTask `json:"Results"`
+}
@@ -0,0 +1,175 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sqs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"opensnack/internal/resource"
+)
+
+//
+// FIFO QUEUES
+//
+// FIFO semantics layered on top of the standard message store:
+//
+//   - every send needs a MessageGroupId and a deduplication id (explicit,
+//     or the SHA-256 of the body when ContentBasedDeduplication is on);
+//   - a repeated deduplication id within dedupInterval is accepted but not
+//     enqueued again, and returns the original MessageId/SequenceNumber;
+//   - messages are handed out in SequenceNumber order, and a group with a
+//     message in flight is blocked until that message is deleted or
+//     becomes visible again.
+//
+// Deduplication records are stored separately (type "dedup") so that they
+// outlive the message they refer to.
+//
+
+const (
+	dedupInterval     = 5 * time.Minute
+	maxFifoIdentifier = 128
+)
+
+type dedupRecord struct {
+	MessageId      string `json:"message_id"`
+	SequenceNumber string `json:"sequence_number"`
+	CreatedAt      int64  `json:"created_at"`
+}
+
+func isFifoQueue(queue *resource.Resource) bool {
+	return queueAttributes(queue)["FifoQueue"] == "true"
+}
+
+// validateQueueAttributes enforces the CreateQueue rules tying the .fifo
+// suffix to the FifoQueue attribute.
+func validateQueueAttributes(name string, attrs map[string]string) *sqsError {
+	fifo := attrs["FifoQueue"] == "true"
+	if fifo && !strings.HasSuffix(name, ".fifo") {
+		return errInvalidParameter("The name of a FIFO queue can only include alphanumeric characters, hyphens, or underscores, must end with .fifo suffix and be 1 to 80 in length.")
+	}
+	if !fifo && strings.HasSuffix(name, ".fifo") {
+		return errInvalidParameter("Can only include alphanumeric characters, hyphens, or underscores. 1 to 80 in length")
+	}
+	if !fifo && attrs["ContentBasedDeduplication"] == "true" {
+		return &sqsError{"InvalidAttributeName", "Unknown Attribute ContentBasedDeduplication."}
+	}
+	return nil
+}
+
+// nextSequenceNumber returns a strictly increasing, 20-digit sequence
+// number derived from the wall clock. Callers must hold h.mu.
+func (h *Handler) nextSequenceNumber() string {
+	seq := time.Now().UnixNano()
+	if seq <= h.lastSequence {
+		seq = h.lastSequence + 1
+	}
+	h.lastSequence = seq
+	return fmt.Sprintf("%020d", seq)
+}
+
+// prepareFifoSend validates the FIFO-only send parameters and resolves the
+// effective deduplication id.
+func prepareFifoSend(queue *resource.Resource, in *sendInput) *sqsError {
+	if !isFifoQueue(queue) {
+		if in.MessageDeduplicationId != "" {
+			return errInvalidParameter("Value %s for parameter MessageDeduplicationId is invalid. Reason: The request include parameter that is not valid for this queue type.", in.MessageDeduplicationId)
+		}
+		return nil
+	}
+
+	if in.MessageGroupId == "" {
+		return &sqsError{"MissingParameter", "The request must contain the parameter MessageGroupId."}
+	}
+	if len(in.MessageGroupId) > maxFifoIdentifier {
+		return errInvalidParameter("Value %s for parameter MessageGroupId is invalid. Reason: MessageGroupId can only include alphanumeric and punctuation characters. 1 to 128 in length.", in.MessageGroupId)
+	}
+	if in.DelaySeconds != nil && *in.DelaySeconds != 0 {
+		return errInvalidParameter("Value %d for parameter DelaySeconds is invalid. Reason: The request include parameter that is not valid for this queue type.", *in.DelaySeconds)
+	}
+
+	if in.MessageDeduplicationId == "" {
+		if queueAttributes(queue)["ContentBasedDeduplication"] != "true" {
+			return errInvalidParameter("The queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly")
+		}
+		sum := sha256.Sum256([]byte(in.Body))
+		in.MessageDeduplicationId = hex.EncodeToString(sum[:])
+	}
+	if len(in.MessageDeduplicationId) > maxFifoIdentifier {
+		return errInvalidParameter("Value %s for parameter MessageDeduplicationId is invalid. Reason: MessageDeduplicationId can only include alphanumeric and punctuation characters. 1 to 128 in length.", in.MessageDeduplicationId)
+	}
+	return nil
+}
+
+func dedupID(queueName, dedupID string) string {
+	return queueName + "/" + dedupID
+}
+
+// findDuplicate returns the live deduplication record for id, if any.
+// Callers must hold h.mu.
+func (h *Handler) findDuplicate(ctx context.Context, ns, queueName, id string) *dedupRecord {
+	res, err := h.Store.Get(ctx, dedupID(queueName, id), "sqs", "dedup", ns)
+	if err != nil || res == nil {
+		return nil
+	}
+	var rec dedupRecord
+	if err := json.Unmarshal(res.Attributes, &rec); err != nil {
+		return nil
+	}
+	if nowMillis()-rec.CreatedAt >= dedupInterval.Milliseconds() {
+		_ = h.Store.Delete(ctx, res.ID, "sqs", "dedup", ns)
+		return nil
+	}
+	return &rec
+}
+
+// recordDeduplication starts the deduplication window for a sent message.
+// Callers must hold h.mu.
+func (h *Handler) recordDeduplication(ctx context.Context, ns string, m *storedMessage) error {
+	buf, err := json.Marshal(dedupRecord{
+		MessageId:      m.MessageId,
+		SequenceNumber: m.SequenceNumber,
+		CreatedAt:      m.SentTimestamp,
+	})
+	if err != nil {
+		return err
+	}
+	return h.Store.Create(ctx, &resource.Resource{
+		ID:         dedupID(m.QueueName, m.MessageDeduplicationId),
+		Namespace:  ns,
+		Service:    "sqs",
+		Type:       "dedup",
+		Attributes: buf,
+	})
+}
+
+// deleteDedupRecords drops the deduplication history of a queue.
+func (h *Handler) deleteDedupRecords(ctx context.Context, ns, queueName string) {
+	page, err := h.Store.Query(ctx, resource.Query{Service: "sqs", Type: "dedup", Namespace: ns, IDPrefix: queueName + "/"})
+	if err != nil {
+		return
+	}
+	for _, item := range page.Resources {
+		_ = h.Store.Delete(ctx, item.ID, "sqs", "dedup", ns)
+	}
+}
+
+// formAttributes parses Query API prefix.N.Name / prefix.N.Value pairs.
+func formAttributes(r *http.Request, prefix string) map[string]string {
+	out := map[string]string{}
+	for i := 1; ; i++ {
+		name := r.FormValue(fmt.Sprintf("%s.%d.Name", prefix, i))
+		if name == "" {
+			return out
+		}
+		out[name] = r.FormValue(fmt.Sprintf("%s.%d.Value", prefix, i))
+	}
+}
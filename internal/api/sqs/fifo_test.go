@@ -0,0 +1,206 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sqs_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"opensnack/internal/api/sqs"
+	"opensnack/internal/resource"
+)
+
+const testFifoURL = "http://localhost:4566/000000000000/orders.fifo"
+
+func sendFifo(t *testing.T, h *sqs.Handler, body, group, dedup string) sqs.SendMessageJSONResponse {
+	t.Helper()
+	var resp sqs.SendMessageJSONResponse
+	rec := callJSON(t, h, "SendMessage", sqs.SendMessageJSONRequest{
+		QueueUrl:               testFifoURL,
+		MessageBody:            body,
+		MessageGroupId:         group,
+		MessageDeduplicationId: dedup,
+	}, &resp)
+	if rec.Code != 200 {
+		t.Fatalf("send %q failed: %s", body, rec.Body.String())
+	}
+	return resp
+}
+
+func receiveBodies(t *testing.T, h *sqs.Handler, max int) ([]string, []sqs.MessageJSON) {
+	t.Helper()
+	var resp sqs.ReceiveMessageJSONResponse
+	callJSON(t, h, "ReceiveMessage", sqs.ReceiveMessageJSONRequest{
+		QueueUrl:            testFifoURL,
+		MaxNumberOfMessages: intPtr(max),
+		AttributeNames:      []string{"All"},
+	}, &resp)
+	var bodies []string
+	for _, m := range resp.Messages {
+		bodies = append(bodies, m.Body)
+	}
+	return bodies, resp.Messages
+}
+
+func TestCreateQueue_FifoNameRules(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+
+	rec := callJSON(t, h, "CreateQueue", sqs.CreateQueueJSONRequest{QueueName: "plain.fifo"}, nil)
+	if rec.Code != 400 {
+		t.Fatalf(".fifo name without FifoQueue should fail, got %d", rec.Code)
+	}
+
+	rec = callJSON(t, h, "CreateQueue", sqs.CreateQueueJSONRequest{
+		QueueName:  "nosuffix",
+		Attributes: map[string]string{"FifoQueue": "true"},
+	}, nil)
+	if rec.Code != 400 {
+		t.Fatalf("FifoQueue without .fifo suffix should fail, got %d", rec.Code)
+	}
+
+	rec = callQuery(h, url.Values{
+		"Action":            {"CreateQueue"},
+		"QueueName":         {"orders.fifo"},
+		"Attribute.1.Name":  {"FifoQueue"},
+		"Attribute.1.Value": {"true"},
+	})
+	if rec.Code != 200 {
+		t.Fatalf("FIFO CreateQueue failed: %s", rec.Body.String())
+	}
+
+	var attrs struct{ Attributes map[string]string }
+	callJSON(t, h, "GetQueueAttributes", map[string]any{
+		"QueueUrl":       testFifoURL,
+		"AttributeNames": []string{"All"},
+	}, &attrs)
+	if attrs.Attributes["FifoQueue"] != "true" {
+		t.Fatalf("FifoQueue attribute not stored: %v", attrs.Attributes)
+	}
+}
+
+func TestSendMessage_FifoRequiredParameters(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+	seedQueue(t, store, "orders.fifo", map[string]string{"FifoQueue": "true"})
+
+	rec := callJSON(t, h, "SendMessage", sqs.SendMessageJSONRequest{
+		QueueUrl:               testFifoURL,
+		MessageBody:            "x",
+		MessageDeduplicationId: "d1",
+	}, nil)
+	if !strings.Contains(rec.Body.String(), "MissingParameter") {
+		t.Fatalf("expected MissingParameter for MessageGroupId, got %s", rec.Body.String())
+	}
+
+	rec = callJSON(t, h, "SendMessage", sqs.SendMessageJSONRequest{
+		QueueUrl:       testFifoURL,
+		MessageBody:    "x",
+		MessageGroupId: "g",
+	}, nil)
+	if !strings.Contains(rec.Body.String(), "ContentBasedDeduplication") {
+		t.Fatalf("expected deduplication error, got %s", rec.Body.String())
+	}
+
+	rec = callJSON(t, h, "SendMessage", sqs.SendMessageJSONRequest{
+		QueueUrl:               testFifoURL,
+		MessageBody:            "x",
+		MessageGroupId:         "g",
+		MessageDeduplicationId: "d1",
+		DelaySeconds:           intPtr(5),
+	}, nil)
+	if rec.Code != 400 {
+		t.Fatalf("per-message DelaySeconds must be rejected on FIFO queues")
+	}
+}
+
+func TestSendMessage_FifoDeduplication(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+	seedQueue(t, store, "orders.fifo", map[string]string{"FifoQueue": "true"})
+
+	first := sendFifo(t, h, "charge", "g", "dedup-1")
+	second := sendFifo(t, h, "charge", "g", "dedup-1")
+
+	if len(first.SequenceNumber) != 20 {
+		t.Fatalf("expected 20-digit SequenceNumber, got %q", first.SequenceNumber)
+	}
+	if first.MessageId != second.MessageId || first.SequenceNumber != second.SequenceNumber {
+		t.Fatalf("duplicate send should return the original message: %+v vs %+v", first, second)
+	}
+
+	bodies, msgs := receiveBodies(t, h, 10)
+	if len(bodies) != 1 {
+		t.Fatalf("expected one message after dedup, got %v", bodies)
+	}
+
+	// Deleting the message does not reopen the deduplication window.
+	callJSON(t, h, "DeleteMessage", sqs.DeleteMessageJSONRequest{
+		QueueUrl:      testFifoURL,
+		ReceiptHandle: msgs[0].ReceiptHandle,
+	}, nil)
+	sendFifo(t, h, "charge", "g", "dedup-1")
+	if bodies, _ := receiveBodies(t, h, 10); len(bodies) != 0 {
+		t.Fatalf("deduplicated send after delete was enqueued: %v", bodies)
+	}
+}
+
+func TestSendMessage_FifoContentBasedDeduplication(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+	seedQueue(t, store, "orders.fifo", map[string]string{
+		"FifoQueue":                 "true",
+		"ContentBasedDeduplication": "true",
+	})
+
+	sendFifo(t, h, "same body", "g", "")
+	sendFifo(t, h, "same body", "g", "")
+	sendFifo(t, h, "other body", "g", "")
+
+	bodies, msgs := receiveBodies(t, h, 10)
+	if strings.Join(bodies, ",") != "same body,other body" {
+		t.Fatalf("unexpected bodies: %v", bodies)
+	}
+	if msgs[0].Attributes["MessageDeduplicationId"] == "" || msgs[0].Attributes["MessageGroupId"] != "g" {
+		t.Fatalf("missing FIFO system attributes: %v", msgs[0].Attributes)
+	}
+}
+
+func TestReceiveMessage_FifoGroupOrdering(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+	seedQueue(t, store, "orders.fifo", map[string]string{"FifoQueue": "true"})
+
+	a1 := sendFifo(t, h, "a1", "A", "1")
+	a2 := sendFifo(t, h, "a2", "A", "2")
+	sendFifo(t, h, "b1", "B", "3")
+
+	if a2.SequenceNumber <= a1.SequenceNumber {
+		t.Fatalf("sequence numbers must increase: %s then %s", a1.SequenceNumber, a2.SequenceNumber)
+	}
+
+	bodies, first := receiveBodies(t, h, 1)
+	if strings.Join(bodies, ",") != "a1" {
+		t.Fatalf("expected a1 first, got %v", bodies)
+	}
+
+	// Group A is blocked while a1 is in flight; only B is available.
+	bodies, _ = receiveBodies(t, h, 10)
+	if strings.Join(bodies, ",") != "b1" {
+		t.Fatalf("expected only b1 while group A is in flight, got %v", bodies)
+	}
+
+	callJSON(t, h, "DeleteMessage", sqs.DeleteMessageJSONRequest{
+		QueueUrl:      testFifoURL,
+		ReceiptHandle: first[0].ReceiptHandle,
+	}, nil)
+
+	// Group B is now blocked by b1; a2 becomes available.
+	bodies, _ = receiveBodies(t, h, 10)
+	if strings.Join(bodies, ",") != "a2" {
+		t.Fatalf("expected a2 after deleting a1, got %v", bodies)
+	}
+}
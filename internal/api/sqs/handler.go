@@ -5,13 +5,18 @@
 package sqs
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"opensnack/internal/awsarn"
 	"opensnack/internal/awsresponses"
 	"opensnack/internal/resource"
 	"opensnack/internal/util"
@@ -19,12 +24,18 @@ import (
 
 const (
 	APIVersion = "2012-11-05"
-	// We’ll build the host dynamically, but keep a fallback.
-	sqsBaseURL = "http://localhost:4566/000000000000/"
+
+	maxListQueuesPage = 1000
 )
 
 type Handler struct {
 	Store resource.Store
+
+	// mu serialises message state transitions (send, receive, delete,
+	// visibility changes) so two consumers never get the same message.
+	mu sync.Mutex
+	// lastSequence backs FIFO SequenceNumber generation; guarded by mu.
+	lastSequence int64
 }
 
 func NewHandler(store resource.Store) *Handler {
@@ -32,8 +43,14 @@ func NewHandler(store resource.Store) *Handler {
 }
 
 // Utility: build canonical SQS QueueUrl
-func buildQueueURL(name string) string {
-	return sqsBaseURL + name
+func buildQueueURL(ctx context.Context, name string) string {
+	s := awsarn.FromContext(ctx)
+	return s.URL(s.AccountID, name)
+}
+
+// Utility: build canonical SQS queue ARN
+func queueArn(ctx context.Context, name string) string {
+	return awsarn.FromContext(ctx).ARN("sqs", name)
 }
 
 // ─────────────────────────────────────────────────────────────
@@ -64,6 +81,26 @@ func (h *Handler) Dispatch(w http.ResponseWriter, r *http.Request) {
 		h.GetQueueUrl(w, r)
 	case "DeleteQueue":
 		h.DeleteQueue(w, r)
+	case "SendMessage":
+		h.SendMessage(w, r)
+	case "SendMessageBatch":
+		h.SendMessageBatch(w, r)
+	case "ReceiveMessage":
+		h.ReceiveMessage(w, r)
+	case "DeleteMessage":
+		h.DeleteMessage(w, r)
+	case "DeleteMessageBatch":
+		h.DeleteMessageBatch(w, r)
+	case "ChangeMessageVisibility":
+		h.ChangeMessageVisibility(w, r)
+	case "PurgeQueue":
+		h.PurgeQueue(w, r)
+	case "ListDeadLetterSourceQueues":
+		h.ListDeadLetterSourceQueues(w, r)
+	case "StartMessageMoveTask":
+		h.StartMessageMoveTask(w, r)
+	case "ListMessageMoveTasks":
+		h.ListMessageMoveTasks(w, r)
 	default:
 		awsresponses.WriteErrorXML(
 			w,
@@ -72,6 +109,7 @@ func (h *Handler) Dispatch(w http.ResponseWriter, r *http.Request) {
 			"Unknown SQS Action",
 			action,
 		)
+		return
 	}
 }
 
@@ -92,11 +130,32 @@ func (h *Handler) dispatchJSONAPI(w http.ResponseWriter, r *http.Request, target
 		h.ListQueueTagsJSON(w, r)
 	case "AmazonSQS.DeleteQueue":
 		h.DeleteQueueJSON(w, r)
+	case "AmazonSQS.SendMessage":
+		h.SendMessageJSON(w, r)
+	case "AmazonSQS.SendMessageBatch":
+		h.SendMessageBatchJSON(w, r)
+	case "AmazonSQS.ReceiveMessage":
+		h.ReceiveMessageJSON(w, r)
+	case "AmazonSQS.DeleteMessage":
+		h.DeleteMessageJSON(w, r)
+	case "AmazonSQS.DeleteMessageBatch":
+		h.DeleteMessageBatchJSON(w, r)
+	case "AmazonSQS.ChangeMessageVisibility":
+		h.ChangeMessageVisibilityJSON(w, r)
+	case "AmazonSQS.PurgeQueue":
+		h.PurgeQueueJSON(w, r)
+	case "AmazonSQS.ListDeadLetterSourceQueues":
+		h.ListDeadLetterSourceQueuesJSON(w, r)
+	case "AmazonSQS.StartMessageMoveTask":
+		h.StartMessageMoveTaskJSON(w, r)
+	case "AmazonSQS.ListMessageMoveTasks":
+		h.ListMessageMoveTasksJSON(w, r)
 	default:
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "InvalidAction",
 			"message": "Unknown SQS operation: " + target,
 		})
+		return
 	}
 }
 
@@ -116,19 +175,31 @@ func (h *Handler) CreateQueue(w http.ResponseWriter, r *http.Request) {
 			"QueueName is required",
 			"",
 		)
+		return
+	}
+
+	attributes := formAttributes(r, "Attribute")
+	if serr := validateQueueAttributes(queueName, attributes); serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+	if serr := h.validateRedrivePolicy(r.Context(), ns, attributes["FifoQueue"] == "true", attributes["RedrivePolicy"]); serr != nil {
+		writeQueryError(w, serr)
+		return
 	}
 
 	// Check if queue exists
-	_, err := h.Store.Get(queueName, "sqs", "queue", ns)
+	_, err := h.Store.Get(r.Context(), queueName, "sqs", "queue", ns)
 	if err == nil {
 		// AWS allows CreateQueue to be idempotent and return existing queue
-		queueURL := buildQueueURL(queueName)
+		queueURL := buildQueueURL(r.Context(), queueName)
 
 		resp := CreateQueueResponse{
 			CreateQueueResult: CreateQueueResult{QueueUrl: queueURL},
 			ResponseMetadata:  ResponseMetadata{RequestId: awsresponses.NextRequestID()},
 		}
 		awsresponses.WriteXML(w, resp)
+		return
 	}
 
 	// Create new queue in store
@@ -137,6 +208,11 @@ func (h *Handler) CreateQueue(w http.ResponseWriter, r *http.Request) {
 		"created_at": time.Now().UTC(),
 	}
 
+	// Store attributes if provided
+	if len(attributes) > 0 {
+		entry["attributes"] = attributes
+	}
+
 	buf, _ := json.Marshal(entry)
 
 	res := &resource.Resource{
@@ -147,7 +223,7 @@ func (h *Handler) CreateQueue(w http.ResponseWriter, r *http.Request) {
 		Attributes: buf,
 	}
 
-	if err := h.Store.Create(res); err != nil {
+	if err := h.Store.Create(r.Context(), res); err != nil {
 		awsresponses.WriteErrorXML(
 			w,
 			http.StatusInternalServerError,
@@ -155,9 +231,10 @@ func (h *Handler) CreateQueue(w http.ResponseWriter, r *http.Request) {
 			"Failed to create queue: "+err.Error(),
 			"",
 		)
+		return
 	}
 
-	queueURL := buildQueueURL(queueName)
+	queueURL := buildQueueURL(r.Context(), queueName)
 
 	resp := CreateQueueResponse{
 		CreateQueueResult: CreateQueueResult{QueueUrl: queueURL},
@@ -172,26 +249,24 @@ func (h *Handler) CreateQueue(w http.ResponseWriter, r *http.Request) {
 // ─────────────────────────────────────────────────────────────
 func (h *Handler) ListQueues(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
+	r.ParseForm()
 
-	items, err := h.Store.List("sqs", "queue", ns)
-	if err != nil {
-		awsresponses.WriteErrorXML(
-			w,
-			http.StatusInternalServerError,
-			"InternalError",
-			"Failed to list queues: "+err.Error(),
-			"",
-		)
+	maxResults, serr := formIntPtr(r, "MaxResults")
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
 	}
 
-	var urls []string
-	for _, item := range items {
-		urls = append(urls, buildQueueURL(item.ID))
+	urls, token, serr := h.listQueues(r.Context(), ns, r.FormValue("QueueNamePrefix"), maxResults, r.FormValue("NextToken"))
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
 	}
 
 	resp := ListQueuesResponse{
 		ListQueuesResult: ListQueuesResult{
 			QueueUrls: urls,
+			NextToken: token,
 		},
 		ResponseMetadata: ResponseMetadata{
 			RequestId: awsresponses.NextRequestID(),
@@ -201,6 +276,39 @@ func (h *Handler) ListQueues(w http.ResponseWriter, r *http.Request) {
 	awsresponses.WriteXML(w, resp)
 }
 
+// listQueues pages through the queues whose name starts with prefix.
+// NextToken is the store cursor after the last queue returned.
+func (h *Handler) listQueues(ctx context.Context, ns, prefix string, maxResults *int, nextToken string) ([]string, string, *sqsError) {
+	limit := maxListQueuesPage
+	if maxResults != nil {
+		if *maxResults < 1 || *maxResults > maxListQueuesPage {
+			return nil, "", errInvalidParameter("Value %d for parameter MaxResults is invalid. Reason: MaxResults must be an integer between 1 and %d.", *maxResults, maxListQueuesPage)
+		}
+		limit = *maxResults
+	}
+
+	page, err := h.Store.Query(ctx, resource.Query{
+		Service:   "sqs",
+		Type:      "queue",
+		Namespace: ns,
+		IDPrefix:  prefix,
+		Limit:     limit,
+		Cursor:    nextToken,
+	})
+	if errors.Is(err, resource.ErrInvalidCursor) {
+		return nil, "", errInvalidParameter("Invalid NextToken value.")
+	}
+	if err != nil {
+		return nil, "", &sqsError{"InternalError", "Failed to list queues: " + err.Error()}
+	}
+
+	urls := []string{}
+	for _, item := range page.Resources {
+		urls = append(urls, buildQueueURL(ctx, item.ID))
+	}
+	return urls, page.Next, nil
+}
+
 // ─────────────────────────────────────────────────────────────
 // GetQueueUrl
 // ─────────────────────────────────────────────────────────────
@@ -216,9 +324,10 @@ func (h *Handler) GetQueueUrl(w http.ResponseWriter, r *http.Request) {
 			"QueueName is required",
 			"",
 		)
+		return
 	}
 
-	_, err := h.Store.Get(qname, "sqs", "queue", ns)
+	_, err := h.Store.Get(r.Context(), qname, "sqs", "queue", ns)
 	if err != nil {
 		awsresponses.WriteErrorXML(
 			w,
@@ -227,9 +336,10 @@ func (h *Handler) GetQueueUrl(w http.ResponseWriter, r *http.Request) {
 			"The specified queue does not exist.",
 			qname,
 		)
+		return
 	}
 
-	queueURL := buildQueueURL(qname)
+	queueURL := buildQueueURL(r.Context(), qname)
 
 	resp := GetQueueUrlResponse{
 		GetQueueUrlResult: GetQueueUrlResult{QueueUrl: queueURL},
@@ -255,13 +365,15 @@ func (h *Handler) DeleteQueue(w http.ResponseWriter, r *http.Request) {
 			"QueueUrl is invalid",
 			queueURL,
 		)
+		return
 	}
 
 	parts := strings.Split(u.Path, "/")
 	queueName := parts[len(parts)-1]
 
 	// AWS allows idempotent delete
-	_ = h.Store.Delete(queueName, "sqs", "queue", ns)
+	_ = h.Store.Delete(r.Context(), queueName, "sqs", "queue", ns)
+	h.deleteQueueMessages(r.Context(), ns, queueName)
 
 	awsresponses.WriteEmpty200(w, nil)
 	return
@@ -280,6 +392,7 @@ func (h *Handler) CreateQueueJSON(w http.ResponseWriter, r *http.Request) {
 			"__type":  "InvalidParameterValue",
 			"message": "Invalid request body: " + err.Error(),
 		})
+		return
 	}
 
 	if req.QueueName == "" {
@@ -287,13 +400,23 @@ func (h *Handler) CreateQueueJSON(w http.ResponseWriter, r *http.Request) {
 			"__type":  "MissingParameter",
 			"message": "QueueName is required",
 		})
+		return
+	}
+
+	if serr := validateQueueAttributes(req.QueueName, req.Attributes); serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+	if serr := h.validateRedrivePolicy(r.Context(), ns, req.Attributes["FifoQueue"] == "true", req.Attributes["RedrivePolicy"]); serr != nil {
+		writeJSONError(w, serr)
+		return
 	}
 
 	// Check if queue exists (idempotent)
-	_, err := h.Store.Get(req.QueueName, "sqs", "queue", ns)
+	_, err := h.Store.Get(r.Context(), req.QueueName, "sqs", "queue", ns)
 	if err == nil {
 		// Queue already exists, return existing queue URL
-		queueURL := buildQueueURL(req.QueueName)
+		queueURL := buildQueueURL(r.Context(), req.QueueName)
 		awsresponses.WriteJSON(w, http.StatusOK, CreateQueueJSONResponse{
 			QueueUrl: queueURL,
 		})
@@ -321,14 +444,15 @@ func (h *Handler) CreateQueueJSON(w http.ResponseWriter, r *http.Request) {
 		Attributes: buf,
 	}
 
-	if err := h.Store.Create(res); err != nil {
+	if err := h.Store.Create(r.Context(), res); err != nil {
 		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalError",
 			"message": "Failed to create queue: " + err.Error(),
 		})
+		return
 	}
 
-	queueURL := buildQueueURL(req.QueueName)
+	queueURL := buildQueueURL(r.Context(), req.QueueName)
 	awsresponses.WriteJSON(w, http.StatusOK, CreateQueueJSONResponse{
 		QueueUrl: queueURL,
 	})
@@ -338,23 +462,22 @@ func (h *Handler) CreateQueueJSON(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) ListQueuesJSON(w http.ResponseWriter, r *http.Request) {
 	ns := util.NamespaceFromHeader(r)
 
-	items, err := h.Store.List("sqs", "queue", ns)
-	if err != nil {
-		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
-			"__type":  "InternalError",
-			"message": "Failed to list queues: " + err.Error(),
-		})
+	var req ListQueuesJSONRequest
+	if err := util.DecodeAWSJSON(r, &req); err != nil {
+		writeJSONError(w, errInvalidParameter("Invalid request body: %s", err.Error()))
+		return
 	}
 
-	var urls []string
-	for _, item := range items {
-		urls = append(urls, buildQueueURL(item.ID))
+	urls, token, serr := h.listQueues(r.Context(), ns, req.QueueNamePrefix, req.MaxResults, req.NextToken)
+	if serr != nil {
+		writeJSONError(w, serr)
+		return
 	}
 
-	awsresponses.WriteJSON(w, http.StatusOK, map[string]any{
-		"QueueUrls": urls,
+	awsresponses.WriteJSON(w, http.StatusOK, ListQueuesJSONResponse{
+		QueueUrls: urls,
+		NextToken: token,
 	})
-	return
 }
 
 func (h *Handler) GetQueueUrlJSON(w http.ResponseWriter, r *http.Request) {
@@ -368,6 +491,7 @@ func (h *Handler) GetQueueUrlJSON(w http.ResponseWriter, r *http.Request) {
 			"__type":  "InvalidParameterValue",
 			"message": "Invalid request body: " + err.Error(),
 		})
+		return
 	}
 
 	if req.QueueName == "" {
@@ -375,17 +499,19 @@ func (h *Handler) GetQueueUrlJSON(w http.ResponseWriter, r *http.Request) {
 			"__type":  "MissingParameter",
 			"message": "QueueName is required",
 		})
+		return
 	}
 
-	_, err := h.Store.Get(req.QueueName, "sqs", "queue", ns)
+	_, err := h.Store.Get(r.Context(), req.QueueName, "sqs", "queue", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "AWS.SimpleQueueService.NonExistentQueue",
 			"message": "The specified queue does not exist.",
 		})
+		return
 	}
 
-	queueURL := buildQueueURL(req.QueueName)
+	queueURL := buildQueueURL(r.Context(), req.QueueName)
 	awsresponses.WriteJSON(w, http.StatusOK, map[string]any{
 		"QueueUrl": queueURL,
 	})
@@ -404,6 +530,7 @@ func (h *Handler) GetQueueAttributesJSON(w http.ResponseWriter, r *http.Request)
 			"__type":  "InvalidParameterValue",
 			"message": "Invalid request body: " + err.Error(),
 		})
+		return
 	}
 
 	if req.QueueUrl == "" {
@@ -411,6 +538,7 @@ func (h *Handler) GetQueueAttributesJSON(w http.ResponseWriter, r *http.Request)
 			"__type":  "MissingParameter",
 			"message": "QueueUrl is required",
 		})
+		return
 	}
 
 	// Extract queue name from QueueUrl
@@ -420,18 +548,20 @@ func (h *Handler) GetQueueAttributesJSON(w http.ResponseWriter, r *http.Request)
 			"__type":  "InvalidParameterValue",
 			"message": "QueueUrl is invalid",
 		})
+		return
 	}
 
 	parts := strings.Split(u.Path, "/")
 	queueName := parts[len(parts)-1]
 
 	// Get queue from store
-	queue, err := h.Store.Get(queueName, "sqs", "queue", ns)
+	queue, err := h.Store.Get(r.Context(), queueName, "sqs", "queue", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "AWS.SimpleQueueService.NonExistentQueue",
 			"message": "The specified queue does not exist.",
 		})
+		return
 	}
 
 	// Parse stored attributes
@@ -498,13 +628,15 @@ func (h *Handler) GetQueueAttributesJSON(w http.ResponseWriter, r *http.Request)
 		createdTimestamp = time.Now().Unix()
 	}
 
+	visible, notVisible, delayed := h.messageCounts(r.Context(), ns, queue)
+
 	// Add requested attributes
 	if requestAll {
 		// Return all standard attributes
-		responseAttrs["QueueArn"] = "arn:aws:sqs:us-east-1:000000000000:" + queueName
-		responseAttrs["ApproximateNumberOfMessages"] = "0"
-		responseAttrs["ApproximateNumberOfMessagesDelayed"] = "0"
-		responseAttrs["ApproximateNumberOfMessagesNotVisible"] = "0"
+		responseAttrs["QueueArn"] = queueArn(r.Context(), queueName)
+		responseAttrs["ApproximateNumberOfMessages"] = strconv.Itoa(visible)
+		responseAttrs["ApproximateNumberOfMessagesDelayed"] = strconv.Itoa(delayed)
+		responseAttrs["ApproximateNumberOfMessagesNotVisible"] = strconv.Itoa(notVisible)
 		responseAttrs["CreatedTimestamp"] = fmt.Sprintf("%d", createdTimestamp)
 		responseAttrs["LastModifiedTimestamp"] = fmt.Sprintf("%d", createdTimestamp)
 		responseAttrs["VisibilityTimeout"] = getAttr("VisibilityTimeout", "30")
@@ -534,13 +666,13 @@ func (h *Handler) GetQueueAttributesJSON(w http.ResponseWriter, r *http.Request)
 		for _, name := range req.AttributeNames {
 			switch name {
 			case "QueueArn":
-				responseAttrs["QueueArn"] = "arn:aws:sqs:us-east-1:000000000000:" + queueName
+				responseAttrs["QueueArn"] = queueArn(r.Context(), queueName)
 			case "ApproximateNumberOfMessages":
-				responseAttrs["ApproximateNumberOfMessages"] = "0"
+				responseAttrs["ApproximateNumberOfMessages"] = strconv.Itoa(visible)
 			case "ApproximateNumberOfMessagesDelayed":
-				responseAttrs["ApproximateNumberOfMessagesDelayed"] = "0"
+				responseAttrs["ApproximateNumberOfMessagesDelayed"] = strconv.Itoa(delayed)
 			case "ApproximateNumberOfMessagesNotVisible":
-				responseAttrs["ApproximateNumberOfMessagesNotVisible"] = "0"
+				responseAttrs["ApproximateNumberOfMessagesNotVisible"] = strconv.Itoa(notVisible)
 			case "CreatedTimestamp":
 				responseAttrs["CreatedTimestamp"] = fmt.Sprintf("%d", createdTimestamp)
 			case "LastModifiedTimestamp":
@@ -584,6 +716,7 @@ func (h *Handler) SetQueueAttributesJSON(w http.ResponseWriter, r *http.Request)
 			"__type":  "InvalidParameterValue",
 			"message": "Invalid request body: " + err.Error(),
 		})
+		return
 	}
 
 	if req.QueueUrl == "" {
@@ -591,6 +724,7 @@ func (h *Handler) SetQueueAttributesJSON(w http.ResponseWriter, r *http.Request)
 			"__type":  "MissingParameter",
 			"message": "QueueUrl is required",
 		})
+		return
 	}
 
 	if len(req.Attributes) == 0 {
@@ -598,6 +732,7 @@ func (h *Handler) SetQueueAttributesJSON(w http.ResponseWriter, r *http.Request)
 			"__type":  "MissingParameter",
 			"message": "Attributes is required",
 		})
+		return
 	}
 
 	// Extract queue name from QueueUrl
@@ -607,80 +742,88 @@ func (h *Handler) SetQueueAttributesJSON(w http.ResponseWriter, r *http.Request)
 			"__type":  "InvalidParameterValue",
 			"message": "QueueUrl is invalid",
 		})
+		return
 	}
 
 	parts := strings.Split(u.Path, "/")
 	queueName := parts[len(parts)-1]
 
 	// Get queue from store
-	queue, err := h.Store.Get(queueName, "sqs", "queue", ns)
-	if err != nil {
+	if _, err := h.Store.Get(r.Context(), queueName, "sqs", "queue", ns); err != nil {
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "AWS.SimpleQueueService.NonExistentQueue",
 			"message": "The specified queue does not exist.",
 		})
+		return
 	}
 
-	// Parse existing attributes
-	var storedAttrs map[string]interface{}
-	if err := json.Unmarshal(queue.Attributes, &storedAttrs); err != nil {
-		storedAttrs = make(map[string]interface{})
-	}
+	_, err = h.Store.Mutate(r.Context(), queueName, "sqs", "queue", ns, func(queue *resource.Resource) error {
+		// Parse existing attributes
+		var storedAttrs map[string]interface{}
+		if err := json.Unmarshal(queue.Attributes, &storedAttrs); err != nil {
+			storedAttrs = make(map[string]interface{})
+		}
 
-	// Get existing queue attributes (if any)
-	var queueAttrs map[string]string
-	if attrs, ok := storedAttrs["attributes"].(map[string]interface{}); ok {
-		queueAttrs = make(map[string]string)
-		for k, v := range attrs {
-			if str, ok := v.(string); ok {
-				queueAttrs[k] = str
+		// Get existing queue attributes (if any)
+		var queueAttrs map[string]string
+		if attrs, ok := storedAttrs["attributes"].(map[string]interface{}); ok {
+			queueAttrs = make(map[string]string)
+			for k, v := range attrs {
+				if str, ok := v.(string); ok {
+					queueAttrs[k] = str
+				}
 			}
+		} else if attrs, ok := storedAttrs["attributes"].(map[string]string); ok {
+			queueAttrs = attrs
+		} else {
+			queueAttrs = make(map[string]string)
 		}
-	} else if attrs, ok := storedAttrs["attributes"].(map[string]string); ok {
-		queueAttrs = attrs
-	} else {
-		queueAttrs = make(map[string]string)
-	}
 
-	// Merge new attributes with existing ones
-	// If an attribute is set to empty string, remove it (AWS SQS behavior)
-	for k, v := range req.Attributes {
-		if v == "" {
-			// Remove attribute if set to empty string
-			delete(queueAttrs, k)
-		} else {
-			queueAttrs[k] = v
+		if serr := h.validateRedrivePolicy(r.Context(), ns, queueAttrs["FifoQueue"] == "true", req.Attributes["RedrivePolicy"]); serr != nil {
+			return serr
 		}
-	}
 
-	// Update stored attributes
-	storedAttrs["attributes"] = queueAttrs
+		// Merge new attributes with existing ones
+		// If an attribute is set to empty string, remove it (AWS SQS behavior)
+		for k, v := range req.Attributes {
+			if v == "" {
+				// Remove attribute if set to empty string
+				delete(queueAttrs, k)
+			} else {
+				queueAttrs[k] = v
+			}
+		}
 
-	// Preserve other fields like name and created_at
-	if _, ok := storedAttrs["name"]; !ok {
-		storedAttrs["name"] = queueName
-	}
-	// Preserve created_at if it exists, otherwise set it
-	if _, ok := storedAttrs["created_at"]; !ok {
-		storedAttrs["created_at"] = time.Now().UTC()
-	}
+		// Update stored attributes
+		storedAttrs["attributes"] = queueAttrs
 
-	// Marshal updated attributes
-	buf, err := json.Marshal(storedAttrs)
-	if err != nil {
-		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
-			"__type":  "InternalError",
-			"message": "Failed to update queue attributes: " + err.Error(),
-		})
-	}
+		// Preserve other fields like name and created_at
+		if _, ok := storedAttrs["name"]; !ok {
+			storedAttrs["name"] = queueName
+		}
+		// Preserve created_at if it exists, otherwise set it
+		if _, ok := storedAttrs["created_at"]; !ok {
+			storedAttrs["created_at"] = time.Now().UTC()
+		}
 
-	// Update queue in store
-	queue.Attributes = buf
-	if err := h.Store.Update(queue); err != nil {
+		buf, err := json.Marshal(storedAttrs)
+		if err != nil {
+			return err
+		}
+		queue.Attributes = buf
+		return nil
+	})
+	var serr *sqsError
+	if errors.As(err, &serr) {
+		writeJSONError(w, serr)
+		return
+	}
+	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalError",
 			"message": "Failed to update queue: " + err.Error(),
 		})
+		return
 	}
 
 	// AWS returns empty JSON object {} for SetQueueAttributes in JSON API format
@@ -699,6 +842,7 @@ func (h *Handler) ListQueueTagsJSON(w http.ResponseWriter, r *http.Request) {
 			"__type":  "InvalidParameterValue",
 			"message": "Invalid request body: " + err.Error(),
 		})
+		return
 	}
 
 	if req.QueueUrl == "" {
@@ -706,6 +850,7 @@ func (h *Handler) ListQueueTagsJSON(w http.ResponseWriter, r *http.Request) {
 			"__type":  "MissingParameter",
 			"message": "QueueUrl is required",
 		})
+		return
 	}
 
 	// Extract queue name from QueueUrl
@@ -715,18 +860,20 @@ func (h *Handler) ListQueueTagsJSON(w http.ResponseWriter, r *http.Request) {
 			"__type":  "InvalidParameterValue",
 			"message": "QueueUrl is invalid",
 		})
+		return
 	}
 
 	parts := strings.Split(u.Path, "/")
 	queueName := parts[len(parts)-1]
 
 	// Get queue from store
-	queue, err := h.Store.Get(queueName, "sqs", "queue", ns)
+	queue, err := h.Store.Get(r.Context(), queueName, "sqs", "queue", ns)
 	if err != nil {
 		awsresponses.WriteJSON(w, http.StatusBadRequest, map[string]any{
 			"__type":  "AWS.SimpleQueueService.NonExistentQueue",
 			"message": "The specified queue does not exist.",
 		})
+		return
 	}
 
 	// Parse stored attributes
@@ -766,6 +913,7 @@ func (h *Handler) DeleteQueueJSON(w http.ResponseWriter, r *http.Request) {
 			"__type":  "InvalidParameterValue",
 			"message": "Invalid request body: " + err.Error(),
 		})
+		return
 	}
 
 	u, err := url.Parse(req.QueueUrl)
@@ -774,13 +922,15 @@ func (h *Handler) DeleteQueueJSON(w http.ResponseWriter, r *http.Request) {
 			"__type":  "InvalidParameterValue",
 			"message": "QueueUrl is invalid",
 		})
+		return
 	}
 
 	parts := strings.Split(u.Path, "/")
 	queueName := parts[len(parts)-1]
 
 	// AWS allows idempotent delete
-	_ = h.Store.Delete(queueName, "sqs", "queue", ns)
+	_ = h.Store.Delete(r.Context(), queueName, "sqs", "queue", ns)
+	h.deleteQueueMessages(r.Context(), ns, queueName)
 
 	// AWS returns empty JSON object {} for DeleteQueue in JSON API format
 	awsresponses.WriteJSON(w, http.StatusOK, struct{}{})
@@ -15,81 +15,26 @@ import (
 
 	"opensnack/internal/api/sqs"
 	"opensnack/internal/resource"
-
-	"github.com/labstack/echo/v4"
 )
 
-//
-// ─────────────────────────────────────────────────────────────
-// Mock Store
-// ─────────────────────────────────────────────────────────────
-//
-
-type MockStore struct {
-	data map[string]resource.Resource
-}
-
-func NewMockStore() *MockStore {
-	return &MockStore{data: map[string]resource.Resource{}}
-}
-
-func key(id, ns string) string {
-	return ns + "|" + id
-}
-
-func (m *MockStore) Create(r *resource.Resource) error {
-	m.data[key(r.ID, r.Namespace)] = *r
-	return nil
-}
-
-func (m *MockStore) Update(r *resource.Resource) error {
-	m.data[key(r.ID, r.Namespace)] = *r
-	return nil
-}
-
-func (m *MockStore) Get(id, service, typ, ns string) (*resource.Resource, error) {
-	v, ok := m.data[key(id, ns)]
-	if !ok {
-		return nil, echo.NewHTTPError(http.StatusNotFound)
-	}
-	return &v, nil
-}
-
-func (m *MockStore) List(service, typ, ns string) ([]resource.Resource, error) {
-	var out []resource.Resource
-	for _, v := range m.data {
-		if v.Service == service && v.Type == typ && v.Namespace == ns {
-			out = append(out, v)
-		}
-	}
-	return out, nil
-}
-
-func (m *MockStore) Delete(id, service, typ, ns string) error {
-	delete(m.data, key(id, ns))
-	return nil
-}
-
 //
 // ─────────────────────────────────────────────────────────────
 // Helpers
 // ─────────────────────────────────────────────────────────────
 //
 
-func newContext(method, target string, body *strings.Reader) (echo.Context, *httptest.ResponseRecorder, *echo.Echo) {
-	e := echo.New()
-
+func newContext(method, target string, body *strings.Reader) (*http.Request, *httptest.ResponseRecorder) {
 	if body == nil {
 		body = strings.NewReader("")
 	}
 
 	req := httptest.NewRequest(method, target, body)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("X-Opensnack-Namespace", "ns1")
+	req.Header.Set("User-Agent", "opensnack-test custom-ns1")
 
 	rec := httptest.NewRecorder()
 
-	return e.NewContext(req, rec), rec, e
+	return req, rec
 }
 
 //
@@ -102,17 +47,13 @@ func newContext(method, target string, body *strings.Reader) (echo.Context, *htt
 // TestCreateQueue
 // -------------------------------------------------------------
 func TestCreateQueue_Basic(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := sqs.NewHandler(store)
 
 	form := strings.NewReader("QueueName=testqueue")
-	c, rec, e := newContext("POST", "/sqs?Action=CreateQueue", form)
-	_ = e
+	req, rec := newContext("POST", "/sqs?Action=CreateQueue", form)
 
-	err := h.Dispatch(c)
-	if err != nil {
-		t.Fatal(err)
-	}
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
@@ -133,18 +74,18 @@ func TestCreateQueue_Basic(t *testing.T) {
 // TestCreateQueue_Idempotent
 // -------------------------------------------------------------
 func TestCreateQueue_Idempotent(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := sqs.NewHandler(store)
 
 	// First create
 	form := strings.NewReader("QueueName=dupq")
-	c1, _, _ := newContext("POST", "/sqs?Action=CreateQueue", form)
-	_ = h.Dispatch(c1)
+	req1, _ := newContext("POST", "/sqs?Action=CreateQueue", form)
+	h.Dispatch(httptest.NewRecorder(), req1)
 
 	// Second create (should not error)
 	form2 := strings.NewReader("QueueName=dupq")
-	c2, rec2, _ := newContext("POST", "/sqs?Action=CreateQueue", form2)
-	_ = h.Dispatch(c2)
+	req2, rec2 := newContext("POST", "/sqs?Action=CreateQueue", form2)
+	h.Dispatch(rec2, req2)
 
 	if rec2.Code != 200 {
 		t.Fatalf("expected 200 on idempotent create, got %d", rec2.Code)
@@ -155,7 +96,7 @@ func TestCreateQueue_Idempotent(t *testing.T) {
 // TestListQueues
 // -------------------------------------------------------------
 func TestListQueues(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := sqs.NewHandler(store)
 
 	// Create multiple queues
@@ -166,7 +107,7 @@ func TestListQueues(t *testing.T) {
 			"created_at": time.Now(),
 		}
 		buf, _ := json.Marshal(attr)
-		store.Create(&resource.Resource{
+		store.Create(t.Context(), &resource.Resource{
 			ID:         name,
 			Namespace:  "ns1",
 			Service:    "sqs",
@@ -175,11 +116,8 @@ func TestListQueues(t *testing.T) {
 		})
 	}
 
-	c, rec, _ := newContext("POST", "/sqs?Action=ListQueues", nil)
-	err := h.Dispatch(c)
-	if err != nil {
-		t.Fatal(err)
-	}
+	req, rec := newContext("POST", "/sqs?Action=ListQueues", nil)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
@@ -193,17 +131,75 @@ func TestListQueues(t *testing.T) {
 	}
 }
 
+// -------------------------------------------------------------
+// TestListQueues_Paging
+// -------------------------------------------------------------
+func TestListQueues_Paging(t *testing.T) {
+	store := resource.NewMemoryStore()
+	h := sqs.NewHandler(store)
+
+	for _, name := range []string{"app-a", "app-b", "app-c", "other"} {
+		store.Create(t.Context(), &resource.Resource{
+			ID:         name,
+			Namespace:  "ns1",
+			Service:    "sqs",
+			Type:       "queue",
+			Attributes: []byte(`{}`),
+		})
+	}
+
+	var got []string
+	token := ""
+	for pages := 1; ; pages++ {
+		target := "/sqs?Action=ListQueues&QueueNamePrefix=app-&MaxResults=2"
+		if token != "" {
+			target += "&NextToken=" + token
+		}
+		req, rec := newContext("POST", target, nil)
+		h.Dispatch(rec, req)
+		if rec.Code != 200 {
+			t.Fatalf("page %d: expected 200, got %d: %s", pages, rec.Code, rec.Body.String())
+		}
+
+		var resp sqs.ListQueuesResponse
+		xml.Unmarshal(rec.Body.Bytes(), &resp)
+		got = append(got, resp.ListQueuesResult.QueueUrls...)
+		token = resp.ListQueuesResult.NextToken
+		if token == "" {
+			break
+		}
+		if pages > 2 {
+			t.Fatalf("too many pages: %v", got)
+		}
+	}
+
+	want := []string{
+		"http://localhost:4566/000000000000/app-a",
+		"http://localhost:4566/000000000000/app-b",
+		"http://localhost:4566/000000000000/app-c",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected queues: %v", got)
+	}
+
+	req, rec := newContext("POST", "/sqs?Action=ListQueues&NextToken=bogus", nil)
+	h.Dispatch(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "InvalidParameterValue") {
+		t.Fatalf("expected InvalidParameterValue for a bad NextToken, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
 // -------------------------------------------------------------
 // TestGetQueueUrl_Found
 // -------------------------------------------------------------
 func TestGetQueueUrl_Found(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := sqs.NewHandler(store)
 
 	entry := map[string]any{"name": "foundq", "created_at": time.Now()}
 	buf, _ := json.Marshal(entry)
 
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:         "foundq",
 		Namespace:  "ns1",
 		Service:    "sqs",
@@ -211,11 +207,8 @@ func TestGetQueueUrl_Found(t *testing.T) {
 		Attributes: buf,
 	})
 
-	c, rec, _ := newContext("POST", "/sqs?Action=GetQueueUrl&QueueName=foundq", nil)
-	err := h.Dispatch(c)
-	if err != nil {
-		t.Fatal(err)
-	}
+	req, rec := newContext("POST", "/sqs?Action=GetQueueUrl&QueueName=foundq", nil)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
@@ -230,11 +223,11 @@ func TestGetQueueUrl_Found(t *testing.T) {
 // TestGetQueueUrl_NotFound
 // -------------------------------------------------------------
 func TestGetQueueUrl_NotFound(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := sqs.NewHandler(store)
 
-	c, rec, _ := newContext("POST", "/sqs?Action=GetQueueUrl&QueueName=nope", nil)
-	_ = h.Dispatch(c)
+	req, rec := newContext("POST", "/sqs?Action=GetQueueUrl&QueueName=nope", nil)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 400 {
 		t.Fatalf("expected 400, got %d", rec.Code)
@@ -250,13 +243,13 @@ func TestGetQueueUrl_NotFound(t *testing.T) {
 // TestDeleteQueue
 // -------------------------------------------------------------
 func TestDeleteQueue(t *testing.T) {
-	store := NewMockStore()
+	store := resource.NewMemoryStore()
 	h := sqs.NewHandler(store)
 
 	// Precreate queue
 	entry := map[string]any{"name": "delq", "created_at": time.Now()}
 	buf, _ := json.Marshal(entry)
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:         "delq",
 		Namespace:  "ns1",
 		Service:    "sqs",
@@ -265,11 +258,8 @@ func TestDeleteQueue(t *testing.T) {
 	})
 
 	// Delete
-	c, rec, _ := newContext("POST", "/sqs?Action=DeleteQueue&QueueUrl=http://localhost:4566/000000000000/delq", nil)
-	err := h.Dispatch(c)
-	if err != nil {
-		t.Fatal(err)
-	}
+	req, rec := newContext("POST", "/sqs?Action=DeleteQueue&QueueUrl=http://localhost:4566/000000000000/delq", nil)
+	h.Dispatch(rec, req)
 
 	if rec.Code != 200 {
 		t.Fatalf("expected 200, got %d", rec.Code)
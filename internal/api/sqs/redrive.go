@@ -0,0 +1,523 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sqs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"opensnack/internal/awsresponses"
+	"opensnack/internal/resource"
+	"opensnack/internal/util"
+
+	"github.com/google/uuid"
+)
+
+//
+// DEAD-LETTER QUEUES
+//
+// A queue with a RedrivePolicy moves a message to its dead-letter queue
+// when a receive would push ApproximateReceiveCount past maxReceiveCount.
+// The message keeps its MessageId and receive count and gains a
+// DeadLetterQueueSourceArn system attribute, which message move tasks use
+// to redrive it back to where it came from.
+//
+// Message move tasks run synchronously inside StartMessageMoveTask, so
+// ListMessageMoveTasks only ever reports COMPLETED or FAILED tasks.
+//
+
+const (
+	maxReceiveCountLimit     = 1000
+	maxDeadLetterSourcesPage = 1000
+	maxMessageMoveTasksLen   = 10
+)
+
+type redrivePolicy struct {
+	DeadLetterTargetArn string
+	MaxReceiveCount     int
+}
+
+// parseRedrivePolicy decodes a RedrivePolicy attribute. maxReceiveCount
+// may be sent either as a number or as a string.
+func parseRedrivePolicy(raw string) (*redrivePolicy, bool) {
+	var doc struct {
+		DeadLetterTargetArn string `json:"deadLetterTargetArn"`
+		MaxReceiveCount     any    `json:"maxReceiveCount"`
+	}
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil || doc.DeadLetterTargetArn == "" {
+		return nil, false
+	}
+
+	var count int
+	switch v := doc.MaxReceiveCount.(type) {
+	case float64:
+		count = int(v)
+	case string:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, false
+		}
+		count = n
+	default:
+		return nil, false
+	}
+	return &redrivePolicy{DeadLetterTargetArn: doc.DeadLetterTargetArn, MaxReceiveCount: count}, true
+}
+
+// queueRedrivePolicy returns the queue's redrive policy, or nil when unset.
+func queueRedrivePolicy(queue *resource.Resource) *redrivePolicy {
+	raw := queueAttributes(queue)["RedrivePolicy"]
+	if raw == "" {
+		return nil
+	}
+	p, ok := parseRedrivePolicy(raw)
+	if !ok {
+		return nil
+	}
+	return p
+}
+
+// queueNameFromArn returns the trailing resource segment of a queue ARN.
+func queueNameFromArn(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 6 {
+		return ""
+	}
+	return parts[len(parts)-1]
+}
+
+// validateRedrivePolicy checks a RedrivePolicy before it is stored.
+func (h *Handler) validateRedrivePolicy(ctx context.Context, ns string, fifo bool, raw string) *sqsError {
+	if raw == "" {
+		return nil
+	}
+	p, ok := parseRedrivePolicy(raw)
+	if !ok {
+		return errInvalidParameter("Value %s for parameter RedrivePolicy is invalid. Reason: Redrive policy is not a valid JSON map.", raw)
+	}
+	if p.MaxReceiveCount < 1 || p.MaxReceiveCount > maxReceiveCountLimit {
+		return errInvalidParameter("Value %s for parameter RedrivePolicy is invalid. Reason: Invalid value for maxReceiveCount: %d, valid values are from 1 to %d both inclusive.", raw, p.MaxReceiveCount, maxReceiveCountLimit)
+	}
+	dlq, err := h.Store.Get(ctx, queueNameFromArn(p.DeadLetterTargetArn), "sqs", "queue", ns)
+	if err != nil || dlq == nil {
+		return errInvalidParameter("Value %s for parameter RedrivePolicy is invalid. Reason: Dead letter target does not exist.", raw)
+	}
+	if isFifoQueue(dlq) != fifo {
+		return errInvalidParameter("Value %s for parameter RedrivePolicy is invalid. Reason: Dead-letter queue must be same type of queue as the source.", raw)
+	}
+	return nil
+}
+
+// redriveAllowed applies the dead-letter queue's RedriveAllowPolicy.
+func redriveAllowed(dlq *resource.Resource, sourceArn string) bool {
+	raw := queueAttributes(dlq)["RedriveAllowPolicy"]
+	if raw == "" {
+		return true
+	}
+	var doc struct {
+		RedrivePermission string   `json:"redrivePermission"`
+		SourceQueueArns   []string `json:"sourceQueueArns"`
+	}
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		return true
+	}
+	switch doc.RedrivePermission {
+	case "denyAll":
+		return false
+	case "byQueue":
+		for _, arn := range doc.SourceQueueArns {
+			if arn == sourceArn {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// moveToDeadLetterQueue re-homes m onto the policy's dead-letter queue.
+// It reports false, leaving m untouched, when the target is missing or
+// refuses the source queue. Callers must hold h.mu.
+func (h *Handler) moveToDeadLetterQueue(ctx context.Context, ns string, queue *resource.Resource, m *storedMessage, p *redrivePolicy) bool {
+	dlq, err := h.Store.Get(ctx, queueNameFromArn(p.DeadLetterTargetArn), "sqs", "queue", ns)
+	if err != nil || dlq == nil {
+		return false
+	}
+	sourceArn := queueArn(ctx, queue.ID)
+	if !redriveAllowed(dlq, sourceArn) {
+		return false
+	}
+
+	moved, err := h.mutateMessage(ctx, ns, m.MessageId, func(m *storedMessage) error {
+		m.QueueName = dlq.ID
+		m.DeadLetterQueueSourceArn = sourceArn
+		m.ReceiptHandle = ""
+		m.VisibleAt = nowMillis()
+		return nil
+	})
+	if err != nil {
+		return false
+	}
+	*m = *moved
+	return true
+}
+
+// deadLetterSourceQueues lists the queues whose RedrivePolicy targets dlqName.
+func (h *Handler) deadLetterSourceQueues(ctx context.Context, ns, dlqName string) ([]string, error) {
+	items, err := h.Store.List(ctx, "sqs", "queue", ns)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for i := range items {
+		if p := queueRedrivePolicy(&items[i]); p != nil && queueNameFromArn(p.DeadLetterTargetArn) == dlqName {
+			names = append(names, items[i].ID)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// listDeadLetterSourceQueues pages through the source queues of a DLQ.
+// NextToken is the index of the next queue to return.
+func (h *Handler) listDeadLetterSourceQueues(ctx context.Context, ns, queueURL string, maxResults *int, nextToken string) ([]string, string, *sqsError) {
+	dlq, serr := h.lookupQueue(ctx, ns, queueURL)
+	if serr != nil {
+		return nil, "", serr
+	}
+
+	limit := maxDeadLetterSourcesPage
+	if maxResults != nil {
+		if *maxResults < 1 || *maxResults > maxDeadLetterSourcesPage {
+			return nil, "", errInvalidParameter("Value %d for parameter MaxResults is invalid. Reason: MaxResults must be an integer between 1 and %d.", *maxResults, maxDeadLetterSourcesPage)
+		}
+		limit = *maxResults
+	}
+	start := 0
+	if nextToken != "" {
+		n, err := strconv.Atoi(nextToken)
+		if err != nil || n < 0 {
+			return nil, "", errInvalidParameter("Invalid NextToken value.")
+		}
+		start = n
+	}
+
+	names, err := h.deadLetterSourceQueues(ctx, ns, dlq.ID)
+	if err != nil {
+		return nil, "", &sqsError{"InternalError", "Failed to list queues: " + err.Error()}
+	}
+
+	urls := []string{}
+	for i := start; i < len(names) && len(urls) < limit; i++ {
+		urls = append(urls, buildQueueURL(ctx, names[i]))
+	}
+	token := ""
+	if start+len(urls) < len(names) {
+		token = strconv.Itoa(start + len(urls))
+	}
+	return urls, token, nil
+}
+
+//
+// MESSAGE MOVE TASKS
+//
+
+type storedMoveTask struct {
+	TaskHandle                   string `json:"task_handle"`
+	Status                       string `json:"status"`
+	SourceArn                    string `json:"source_arn"`
+	DestinationArn               string `json:"destination_arn,omitempty"`
+	MaxNumberOfMessagesPerSecond int    `json:"max_number_of_messages_per_second,omitempty"`
+	Moved                        int    `json:"moved"`
+	ToMove                       int    `json:"to_move"`
+	FailureReason                string `json:"failure_reason,omitempty"`
+	StartedTimestamp             int64  `json:"started_timestamp"`
+}
+
+// startMessageMoveTask moves every available message out of a dead-letter
+// queue, either to DestinationArn or back to each message's source queue.
+func (h *Handler) startMessageMoveTask(ctx context.Context, ns, sourceArn, destinationArn string, rate *int) (string, *sqsError) {
+	if sourceArn == "" {
+		return "", &sqsError{"MissingParameter", "The request must contain the parameter SourceArn."}
+	}
+	source, err := h.Store.Get(ctx, queueNameFromArn(sourceArn), "sqs", "queue", ns)
+	if err != nil || source == nil {
+		return "", &sqsError{"ResourceNotFoundException", "The resource that you specified for the SourceArn parameter doesn't exist."}
+	}
+	if sources, _ := h.deadLetterSourceQueues(ctx, ns, source.ID); len(sources) == 0 {
+		return "", errInvalidParameter("Source queue must be configured as a Dead Letter Queue.")
+	}
+
+	var destination *resource.Resource
+	if destinationArn != "" {
+		destination, err = h.Store.Get(ctx, queueNameFromArn(destinationArn), "sqs", "queue", ns)
+		if err != nil || destination == nil {
+			return "", &sqsError{"ResourceNotFoundException", "The resource that you specified for the DestinationArn parameter doesn't exist."}
+		}
+	}
+
+	task := storedMoveTask{
+		TaskHandle:       uuid.NewString(),
+		Status:           "COMPLETED",
+		SourceArn:        sourceArn,
+		DestinationArn:   destinationArn,
+		StartedTimestamp: nowMillis(),
+	}
+	if rate != nil {
+		task.MaxNumberOfMessagesPerSecond = *rate
+	}
+
+	h.mu.Lock()
+	msgs, err := h.queueMessages(ctx, ns, source)
+	if err != nil {
+		h.mu.Unlock()
+		return "", &sqsError{"InternalError", "Failed to read source queue: " + err.Error()}
+	}
+	now := nowMillis()
+	for i := range msgs {
+		m := &msgs[i]
+		if m.VisibleAt > now {
+			continue
+		}
+		task.ToMove++
+
+		target := destination
+		if target == nil && m.DeadLetterQueueSourceArn != "" {
+			target, _ = h.Store.Get(ctx, queueNameFromArn(m.DeadLetterQueueSourceArn), "sqs", "queue", ns)
+		}
+		if target == nil {
+			task.Status = "FAILED"
+			task.FailureReason = "AWS.SimpleQueueService.NonExistentQueue"
+			continue
+		}
+
+		_, err := h.mutateMessage(ctx, ns, m.MessageId, func(m *storedMessage) error {
+			m.QueueName = target.ID
+			m.DeadLetterQueueSourceArn = ""
+			m.ReceiveCount = 0
+			m.FirstReceiveTimestamp = 0
+			m.ReceiptHandle = ""
+			m.VisibleAt = now
+			return nil
+		})
+		if err != nil {
+			task.Status = "FAILED"
+			task.FailureReason = "InternalError"
+			continue
+		}
+		task.Moved++
+	}
+	h.mu.Unlock()
+
+	buf, _ := json.Marshal(task)
+	if err := h.Store.Create(ctx, &resource.Resource{
+		ID:         task.TaskHandle,
+		Namespace:  ns,
+		Service:    "sqs",
+		Type:       "move_task",
+		Attributes: buf,
+	}); err != nil {
+		return "", &sqsError{"InternalError", "Failed to record move task: " + err.Error()}
+	}
+	return task.TaskHandle, nil
+}
+
+// listMessageMoveTasks returns the most recent tasks for a source queue, newest first.
+func (h *Handler) listMessageMoveTasks(ctx context.Context, ns, sourceArn string, maxResults *int) ([]MessageMoveTask, *sqsError) {
+	if sourceArn == "" {
+		return nil, &sqsError{"MissingParameter", "The request must contain the parameter SourceArn."}
+	}
+	if _, err := h.Store.Get(ctx, queueNameFromArn(sourceArn), "sqs", "queue", ns); err != nil {
+		return nil, &sqsError{"ResourceNotFoundException", "The resource that you specified for the SourceArn parameter doesn't exist."}
+	}
+
+	limit := 1
+	if maxResults != nil {
+		if *maxResults < 1 || *maxResults > maxMessageMoveTasksLen {
+			return nil, errInvalidParameter("Value %d for parameter MaxResults is invalid. Reason: MaxResults must be an integer between 1 and %d.", *maxResults, maxMessageMoveTasksLen)
+		}
+		limit = *maxResults
+	}
+
+	page, err := h.Store.Query(ctx, resource.Query{
+		Service:   "sqs",
+		Type:      "move_task",
+		Namespace: ns,
+		Match:     map[string]any{"source_arn": sourceArn},
+	})
+	if err != nil {
+		return nil, &sqsError{"InternalError", "Failed to list move tasks: " + err.Error()}
+	}
+	var tasks []storedMoveTask
+	for _, item := range page.Resources {
+		var t storedMoveTask
+		if json.Unmarshal(item.Attributes, &t) == nil {
+			tasks = append(tasks, t)
+		}
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].StartedTimestamp > tasks[j].StartedTimestamp
+	})
+
+	out := []MessageMoveTask{}
+	for i := 0; i < len(tasks) && i < limit; i++ {
+		t := tasks[i]
+		entry := MessageMoveTask{
+			Status:                            t.Status,
+			SourceArn:                         t.SourceArn,
+			DestinationArn:                    t.DestinationArn,
+			MaxNumberOfMessagesPerSecond:      t.MaxNumberOfMessagesPerSecond,
+			ApproximateNumberOfMessagesMoved:  t.Moved,
+			ApproximateNumberOfMessagesToMove: t.ToMove,
+			FailureReason:                     t.FailureReason,
+			StartedTimestamp:                  t.StartedTimestamp,
+		}
+		// AWS only exposes the handle of a task that can still be cancelled.
+		if t.Status == "RUNNING" {
+			entry.TaskHandle = t.TaskHandle
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// ─────────────────────────────────────────────────────────────
+// Query API (XML) handlers
+// ─────────────────────────────────────────────────────────────
+
+func (h *Handler) ListDeadLetterSourceQueues(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+	r.ParseForm()
+
+	maxResults, serr := formIntPtr(r, "MaxResults")
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	urls, token, serr := h.listDeadLetterSourceQueues(r.Context(), ns, r.FormValue("QueueUrl"), maxResults, r.FormValue("NextToken"))
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	awsresponses.WriteXML(w, ListDeadLetterSourceQueuesResponse{
+		ListDeadLetterSourceQueuesResult: ListDeadLetterSourceQueuesResult{
+			QueueUrls: urls,
+			NextToken: token,
+		},
+		ResponseMetadata: ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	})
+}
+
+func (h *Handler) StartMessageMoveTask(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+	r.ParseForm()
+
+	rate, serr := formIntPtr(r, "MaxNumberOfMessagesPerSecond")
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	handle, serr := h.startMessageMoveTask(r.Context(), ns, r.FormValue("SourceArn"), r.FormValue("DestinationArn"), rate)
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	awsresponses.WriteXML(w, StartMessageMoveTaskResponse{
+		StartMessageMoveTaskResult: StartMessageMoveTaskResult{TaskHandle: handle},
+		ResponseMetadata:           ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	})
+}
+
+func (h *Handler) ListMessageMoveTasks(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+	r.ParseForm()
+
+	maxResults, serr := formIntPtr(r, "MaxResults")
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	tasks, serr := h.listMessageMoveTasks(r.Context(), ns, r.FormValue("SourceArn"), maxResults)
+	if serr != nil {
+		writeQueryError(w, serr)
+		return
+	}
+
+	awsresponses.WriteXML(w, ListMessageMoveTasksResponse{
+		ListMessageMoveTasksResult: ListMessageMoveTasksResult{Results: tasks},
+		ResponseMetadata:           ResponseMetadata{RequestId: awsresponses.NextRequestID()},
+	})
+}
+
+// ─────────────────────────────────────────────────────────────
+// JSON API handlers
+// ─────────────────────────────────────────────────────────────
+
+func (h *Handler) ListDeadLetterSourceQueuesJSON(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req ListDeadLetterSourceQueuesJSONRequest
+	if err := util.DecodeAWSJSON(r, &req); err != nil {
+		writeJSONError(w, errInvalidParameter("Invalid request body: %s", err.Error()))
+		return
+	}
+
+	urls, token, serr := h.listDeadLetterSourceQueues(r.Context(), ns, req.QueueUrl, req.MaxResults, req.NextToken)
+	if serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, ListDeadLetterSourceQueuesJSONResponse{
+		QueueUrls: urls,
+		NextToken: token,
+	})
+}
+
+func (h *Handler) StartMessageMoveTaskJSON(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req StartMessageMoveTaskJSONRequest
+	if err := util.DecodeAWSJSON(r, &req); err != nil {
+		writeJSONError(w, errInvalidParameter("Invalid request body: %s", err.Error()))
+		return
+	}
+
+	handle, serr := h.startMessageMoveTask(r.Context(), ns, req.SourceArn, req.DestinationArn, req.MaxNumberOfMessagesPerSecond)
+	if serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, StartMessageMoveTaskJSONResponse{TaskHandle: handle})
+}
+
+func (h *Handler) ListMessageMoveTasksJSON(w http.ResponseWriter, r *http.Request) {
+	ns := util.NamespaceFromHeader(r)
+
+	var req ListMessageMoveTasksJSONRequest
+	if err := util.DecodeAWSJSON(r, &req); err != nil {
+		writeJSONError(w, errInvalidParameter("Invalid request body: %s", err.Error()))
+		return
+	}
+
+	tasks, serr := h.listMessageMoveTasks(r.Context(), ns, req.SourceArn, req.MaxResults)
+	if serr != nil {
+		writeJSONError(w, serr)
+		return
+	}
+
+	awsresponses.WriteJSON(w, http.StatusOK, ListMessageMoveTasksJSONResponse{Results: tasks})
+}
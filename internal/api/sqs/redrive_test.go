@@ -0,0 +1,168 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sqs_test
+
+import (
+	"strings"
+	"testing"
+
+	"opensnack/internal/api/sqs"
+	"opensnack/internal/resource"
+)
+
+const (
+	testSourceURL = "http://localhost:4566/000000000000/work"
+	testDLQURL    = "http://localhost:4566/000000000000/work-dlq"
+	testDLQArn    = "arn:aws:sqs:us-east-1:000000000000:work-dlq"
+)
+
+func setupRedrive(t *testing.T, maxReceiveCount string) *sqs.Handler {
+	t.Helper()
+	h := sqs.NewHandler(resource.NewMemoryStore())
+
+	rec := callJSON(t, h, "CreateQueue", sqs.CreateQueueJSONRequest{QueueName: "work-dlq"}, nil)
+	if rec.Code != 200 {
+		t.Fatalf("create DLQ failed: %s", rec.Body.String())
+	}
+	rec = callJSON(t, h, "CreateQueue", sqs.CreateQueueJSONRequest{
+		QueueName: "work",
+		Attributes: map[string]string{
+			"RedrivePolicy": `{"deadLetterTargetArn":"` + testDLQArn + `","maxReceiveCount":` + maxReceiveCount + `}`,
+		},
+	}, nil)
+	if rec.Code != 200 {
+		t.Fatalf("create source queue failed: %s", rec.Body.String())
+	}
+	return h
+}
+
+func attrsOf(t *testing.T, h *sqs.Handler, queueURL string) map[string]string {
+	t.Helper()
+	var resp struct{ Attributes map[string]string }
+	callJSON(t, h, "GetQueueAttributes", map[string]any{
+		"QueueUrl":       queueURL,
+		"AttributeNames": []string{"All"},
+	}, &resp)
+	return resp.Attributes
+}
+
+func receiveFrom(t *testing.T, h *sqs.Handler, queueURL string, visibility int) []sqs.MessageJSON {
+	t.Helper()
+	var resp sqs.ReceiveMessageJSONResponse
+	callJSON(t, h, "ReceiveMessage", sqs.ReceiveMessageJSONRequest{
+		QueueUrl:          queueURL,
+		VisibilityTimeout: intPtr(visibility),
+		AttributeNames:    []string{"All"},
+	}, &resp)
+	return resp.Messages
+}
+
+func TestRedrivePolicy_MovesToDeadLetterQueue(t *testing.T) {
+	h := setupRedrive(t, `"2"`)
+
+	callJSON(t, h, "SendMessage", sqs.SendMessageJSONRequest{QueueUrl: testSourceURL, MessageBody: "poison"}, nil)
+
+	for i := 0; i < 2; i++ {
+		if msgs := receiveFrom(t, h, testSourceURL, 0); len(msgs) != 1 {
+			t.Fatalf("receive %d: expected the message, got %d", i+1, len(msgs))
+		}
+	}
+
+	// The third receive exceeds maxReceiveCount: the message moves instead.
+	if msgs := receiveFrom(t, h, testSourceURL, 0); len(msgs) != 0 {
+		t.Fatalf("message should have been dead-lettered, got %+v", msgs)
+	}
+	if got := attrsOf(t, h, testSourceURL)["ApproximateNumberOfMessages"]; got != "0" {
+		t.Fatalf("source queue should be empty, got %s", got)
+	}
+
+	msgs := receiveFrom(t, h, testDLQURL, 30)
+	if len(msgs) != 1 || msgs[0].Body != "poison" {
+		t.Fatalf("expected poison message in DLQ, got %+v", msgs)
+	}
+	if !strings.HasSuffix(msgs[0].Attributes["DeadLetterQueueSourceArn"], ":work") {
+		t.Fatalf("missing DeadLetterQueueSourceArn: %v", msgs[0].Attributes)
+	}
+}
+
+func TestRedrivePolicy_Validation(t *testing.T) {
+	h := sqs.NewHandler(resource.NewMemoryStore())
+
+	rec := callJSON(t, h, "CreateQueue", sqs.CreateQueueJSONRequest{
+		QueueName: "orphan",
+		Attributes: map[string]string{
+			"RedrivePolicy": `{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:000000000000:missing","maxReceiveCount":3}`,
+		},
+	}, nil)
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "does not exist") {
+		t.Fatalf("expected missing DLQ error, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	h = setupRedrive(t, "3")
+	rec = callJSON(t, h, "SetQueueAttributes", map[string]any{
+		"QueueUrl": testSourceURL,
+		"Attributes": map[string]string{
+			"RedrivePolicy": `{"deadLetterTargetArn":"` + testDLQArn + `","maxReceiveCount":0}`,
+		},
+	}, nil)
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "maxReceiveCount") {
+		t.Fatalf("expected maxReceiveCount error, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestListDeadLetterSourceQueues(t *testing.T) {
+	h := setupRedrive(t, "3")
+
+	var resp sqs.ListDeadLetterSourceQueuesJSONResponse
+	callJSON(t, h, "ListDeadLetterSourceQueues", sqs.ListDeadLetterSourceQueuesJSONRequest{QueueUrl: testDLQURL}, &resp)
+	if len(resp.QueueUrls) != 1 || resp.QueueUrls[0] != testSourceURL {
+		t.Fatalf("unexpected source queues: %+v", resp)
+	}
+
+	callJSON(t, h, "ListDeadLetterSourceQueues", sqs.ListDeadLetterSourceQueuesJSONRequest{QueueUrl: testSourceURL}, &resp)
+	if len(resp.QueueUrls) != 0 {
+		t.Fatalf("source queue is not a DLQ: %+v", resp)
+	}
+}
+
+func TestStartMessageMoveTask_RedrivesToSource(t *testing.T) {
+	h := setupRedrive(t, "1")
+
+	callJSON(t, h, "SendMessage", sqs.SendMessageJSONRequest{QueueUrl: testSourceURL, MessageBody: "retry me"}, nil)
+	receiveFrom(t, h, testSourceURL, 0)
+	receiveFrom(t, h, testSourceURL, 0)
+	if got := attrsOf(t, h, testDLQURL)["ApproximateNumberOfMessages"]; got != "1" {
+		t.Fatalf("expected message in DLQ, got %s", got)
+	}
+
+	rec := callJSON(t, h, "StartMessageMoveTask", sqs.StartMessageMoveTaskJSONRequest{SourceArn: "arn:aws:sqs:us-east-1:000000000000:work"}, nil)
+	if rec.Code != 400 {
+		t.Fatalf("non-DLQ source should be rejected, got %d", rec.Code)
+	}
+
+	var started sqs.StartMessageMoveTaskJSONResponse
+	callJSON(t, h, "StartMessageMoveTask", sqs.StartMessageMoveTaskJSONRequest{SourceArn: testDLQArn}, &started)
+	if started.TaskHandle == "" {
+		t.Fatalf("missing TaskHandle")
+	}
+
+	msgs := receiveFrom(t, h, testSourceURL, 30)
+	if len(msgs) != 1 || msgs[0].Body != "retry me" {
+		t.Fatalf("message was not redriven to its source: %+v", msgs)
+	}
+	if msgs[0].Attributes["ApproximateReceiveCount"] != "1" {
+		t.Fatalf("receive count should reset on redrive: %v", msgs[0].Attributes)
+	}
+
+	var tasks sqs.ListMessageMoveTasksJSONResponse
+	callJSON(t, h, "ListMessageMoveTasks", sqs.ListMessageMoveTasksJSONRequest{SourceArn: testDLQArn}, &tasks)
+	if len(tasks.Results) != 1 {
+		t.Fatalf("expected one task, got %+v", tasks)
+	}
+	task := tasks.Results[0]
+	if task.Status != "COMPLETED" || task.ApproximateNumberOfMessagesMoved != 1 {
+		t.Fatalf("unexpected task: %+v", task)
+	}
+}
@@ -5,11 +5,14 @@
 package ssm
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
+	"opensnack/internal/awsarn"
 	"opensnack/internal/awsresponses"
 	"opensnack/internal/resource"
 	"opensnack/internal/util"
@@ -17,8 +20,6 @@ import (
 
 const (
 	APIVersion = "2014-11-06"
-	ssmRegion  = "us-east-1"
-	ssmAccount = "000000000000"
 )
 
 type Handler struct {
@@ -30,9 +31,9 @@ func NewHandler(store resource.Store) *Handler {
 }
 
 // Build SSM Parameter ARN
-func parameterArn(name string) string {
+func parameterArn(ctx context.Context, name string) string {
 	// AWS SSM Parameter ARN format: arn:aws:ssm:region:account:parameter/name
-	return "arn:aws:ssm:" + ssmRegion + ":" + ssmAccount + ":parameter" + name
+	return awsarn.FromContext(ctx).ARN("ssm", "parameter"+name)
 }
 
 // writeSSMJSON writes JSON response with SSM-specific Content-Type
@@ -127,16 +128,62 @@ func (h *Handler) PutParameter(w http.ResponseWriter, r *http.Request) {
 		paramType = "String"
 	}
 
-	// Check if parameter already exists
-	existing, err := h.Store.Get(req.Name, "ssm", "parameter", ns)
-	var version int64 = 1
-	var createdDate float64
-
 	now := time.Now().UTC()
 	lastModifiedDate := float64(now.Unix())
 
-	if err == nil {
-		// Parameter exists
+	tier := req.Tier
+	if tier == "" {
+		tier = "Standard"
+	}
+
+	// Build parameter metadata
+	metadata := func(version int64, createdDate float64) []byte {
+		buf, _ := json.Marshal(map[string]any{
+			"name":               req.Name,
+			"value":              req.Value,
+			"type":               paramType,
+			"description":        req.Description,
+			"key_id":             req.KeyId,
+			"version":            float64(version),
+			"last_modified_date": lastModifiedDate,
+			"created_date":       createdDate,
+			"arn":                parameterArn(r.Context(), req.Name),
+			"data_type":          req.DataType,
+			"tags":               req.Tags,
+			"tier":               tier,
+		})
+		return buf
+	}
+
+	var version int64 = 1
+
+	// Check if parameter already exists
+	_, err := h.Store.Get(r.Context(), req.Name, "ssm", "parameter", ns)
+	exists := err == nil
+	if !exists {
+		// New parameter - created_date equals last_modified_date
+		res := &resource.Resource{
+			ID:         req.Name,
+			Namespace:  ns,
+			Service:    "ssm",
+			Type:       "parameter",
+			Attributes: metadata(version, lastModifiedDate),
+		}
+		err := h.Store.Create(r.Context(), res)
+		switch {
+		case errors.Is(err, resource.ErrDuplicate):
+			// Another request created it since the Get
+			exists = true
+		case err != nil:
+			writeSSMJSON(w, http.StatusInternalServerError, map[string]any{
+				"__type":  "InternalFailure",
+				"message": "Failed to create parameter: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	if exists {
 		if !req.Overwrite {
 			writeSSMJSON(w, http.StatusBadRequest, map[string]any{
 				"__type":  "ParameterAlreadyExists",
@@ -145,74 +192,35 @@ func (h *Handler) PutParameter(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Get existing version and created_date
-		var entry map[string]any
-		if err := json.Unmarshal(existing.Attributes, &entry); err == nil {
-			if v, ok := entry["version"].(float64); ok {
-				version = int64(v) + 1
-			}
-			if cd, ok := entry["created_date"].(float64); ok {
-				createdDate = cd
+		// Bump the version in one Mutate so concurrent overwrites each
+		// get a version of their own
+		_, err := h.Store.Mutate(r.Context(), req.Name, "ssm", "parameter", ns, func(res *resource.Resource) error {
+			version = 1
+			var createdDate float64
+			var entry map[string]any
+			if err := json.Unmarshal(res.Attributes, &entry); err == nil {
+				if v, ok := entry["version"].(float64); ok {
+					version = int64(v) + 1
+				}
+				if cd, ok := entry["created_date"].(float64); ok {
+					createdDate = cd
+				}
 			}
-		}
-	} else {
-		// New parameter - created_date equals last_modified_date
-		createdDate = lastModifiedDate
-	}
-
-	// Build parameter metadata
-	paramMetadata := map[string]any{
-		"name":              req.Name,
-		"value":             req.Value,
-		"type":              paramType,
-		"description":       req.Description,
-		"key_id":            req.KeyId,
-		"version":           float64(version),
-		"last_modified_date": lastModifiedDate,
-		"created_date":      createdDate,
-		"arn":               parameterArn(req.Name),
-		"data_type":         req.DataType,
-		"tags":              req.Tags,
-	}
-
-	if req.Tier != "" {
-		paramMetadata["tier"] = req.Tier
-	} else {
-		paramMetadata["tier"] = "Standard"
-	}
-
-	buf, _ := json.Marshal(paramMetadata)
-	res := &resource.Resource{
-		ID:         req.Name,
-		Namespace:  ns,
-		Service:    "ssm",
-		Type:       "parameter",
-		Attributes: buf,
-	}
-
-	if err == nil {
-		// Update existing parameter
-		if err := h.Store.Update(res); err != nil {
+			res.Attributes = metadata(version, createdDate)
+			return nil
+		})
+		if err != nil {
 			writeSSMJSON(w, http.StatusInternalServerError, map[string]any{
 				"__type":  "InternalFailure",
 				"message": "Failed to update parameter: " + err.Error(),
 			})
 			return
 		}
-	} else {
-		// Create new parameter
-		if err := h.Store.Create(res); err != nil {
-			writeSSMJSON(w, http.StatusInternalServerError, map[string]any{
-				"__type":  "InternalFailure",
-				"message": "Failed to create parameter: " + err.Error(),
-			})
-			return
-		}
 	}
 
 	output := PutParameterOutput{
 		Version: version,
-		Tier:    paramMetadata["tier"].(string),
+		Tier:    tier,
 	}
 
 	writeSSMJSON(w, http.StatusOK, output)
@@ -240,7 +248,7 @@ func (h *Handler) GetParameter(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get parameter from store
-	res, err := h.Store.Get(req.Name, "ssm", "parameter", ns)
+	res, err := h.Store.Get(r.Context(), req.Name, "ssm", "parameter", ns)
 	if err != nil {
 		writeSSMJSON(w, http.StatusNotFound, map[string]any{
 			"__type":  "ParameterNotFound",
@@ -308,7 +316,7 @@ func (h *Handler) GetParameters(w http.ResponseWriter, r *http.Request) {
 
 	for _, name := range req.Names {
 		// Get parameter from store
-		res, err := h.Store.Get(name, "ssm", "parameter", ns)
+		res, err := h.Store.Get(r.Context(), name, "ssm", "parameter", ns)
 		if err != nil {
 			invalidParameters = append(invalidParameters, name)
 			continue
@@ -361,8 +369,51 @@ func (h *Handler) DescribeParameters(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get all parameters from store
-	allParams, err := h.Store.List("ssm", "parameter", ns)
+	q := resource.Query{
+		Service:   "ssm",
+		Type:      "parameter",
+		Namespace: ns,
+		Limit:     50,
+		Cursor:    req.NextToken,
+	}
+	if req.MaxResults != 0 {
+		if req.MaxResults < 1 || req.MaxResults > 50 {
+			writeSSMJSON(w, http.StatusBadRequest, map[string]any{
+				"__type":  "ValidationException",
+				"message": "MaxResults must be between 1 and 50",
+			})
+			return
+		}
+		q.Limit = int(req.MaxResults)
+	}
+
+	filters := req.ParameterFilters
+	if len(filters) == 0 {
+		filters = req.Filters
+	}
+	// Parameter names are resource IDs, so a BeginsWith name filter is an
+	// ID prefix. Other filters are applied to each page, which can leave
+	// a page short of MaxResults, as it can on AWS.
+	var nameFilters []ParameterFilter
+	for _, filter := range filters {
+		if filter.Key != "Name" {
+			continue
+		}
+		if filter.Option == "BeginsWith" && len(filter.Values) == 1 && q.IDPrefix == "" {
+			q.IDPrefix = filter.Values[0]
+			continue
+		}
+		nameFilters = append(nameFilters, filter)
+	}
+
+	page, err := h.Store.Query(r.Context(), q)
+	if errors.Is(err, resource.ErrInvalidCursor) {
+		writeSSMJSON(w, http.StatusBadRequest, map[string]any{
+			"__type":  "InvalidNextToken",
+			"message": "The specified token isn't valid.",
+		})
+		return
+	}
 	if err != nil {
 		writeSSMJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalFailure",
@@ -373,40 +424,31 @@ func (h *Handler) DescribeParameters(w http.ResponseWriter, r *http.Request) {
 
 	var metadataList []ParameterMetadata
 
-	for _, paramRes := range allParams {
+	for _, paramRes := range page.Resources {
 		var entry map[string]any
 		if err := json.Unmarshal(paramRes.Attributes, &entry); err != nil {
 			continue
 		}
 
-		// Apply filters if provided
-		if len(req.ParameterFilters) > 0 || len(req.Filters) > 0 {
-			filters := req.ParameterFilters
-			if len(filters) == 0 {
-				filters = req.Filters
-			}
-			
-			matched := true
-			for _, filter := range filters {
-				if filter.Key == "Name" {
-					paramName := entry["name"].(string)
-					found := false
-					for _, value := range filter.Values {
-						if paramName == value {
-							found = true
-							break
-						}
-					}
-					if !found {
-						matched = false
-						break
-					}
+		// Apply the remaining name filters
+		matched := true
+		for _, filter := range nameFilters {
+			paramName := entry["name"].(string)
+			found := false
+			for _, value := range filter.Values {
+				if paramName == value {
+					found = true
+					break
 				}
 			}
-			if !matched {
-				continue
+			if !found {
+				matched = false
+				break
 			}
 		}
+		if !matched {
+			continue
+		}
 
 		metadata := ParameterMetadata{
 			Name:        entry["name"].(string),
@@ -436,6 +478,7 @@ func (h *Handler) DescribeParameters(w http.ResponseWriter, r *http.Request) {
 
 	output := DescribeParametersOutput{
 		Parameters: metadataList,
+		NextToken:  page.Next,
 	}
 
 	writeSSMJSON(w, http.StatusOK, output)
@@ -496,7 +539,7 @@ func (h *Handler) ListTagsForResource(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get parameter from store
-	res, err := h.Store.Get(paramName, "ssm", "parameter", ns)
+	res, err := h.Store.Get(r.Context(), paramName, "ssm", "parameter", ns)
 	if err != nil {
 		writeSSMJSON(w, http.StatusNotFound, map[string]any{
 			"__type":  "InvalidResourceId",
@@ -571,7 +614,7 @@ func (h *Handler) DeleteParameter(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify parameter exists
-	_, err := h.Store.Get(req.Name, "ssm", "parameter", ns)
+	_, err := h.Store.Get(r.Context(), req.Name, "ssm", "parameter", ns)
 	if err != nil {
 		writeSSMJSON(w, http.StatusNotFound, map[string]any{
 			"__type":  "ParameterNotFound",
@@ -581,7 +624,7 @@ func (h *Handler) DeleteParameter(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete the parameter
-	if err := h.Store.Delete(req.Name, "ssm", "parameter", ns); err != nil {
+	if err := h.Store.Delete(r.Context(), req.Name, "ssm", "parameter", ns); err != nil {
 		writeSSMJSON(w, http.StatusInternalServerError, map[string]any{
 			"__type":  "InternalFailure",
 			"message": "Failed to delete parameter: " + err.Error(),
@@ -0,0 +1,90 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ssm_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"opensnack/internal/api/ssm"
+	"opensnack/internal/resource"
+)
+
+func call(h *ssm.Handler, action, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("X-Amz-Target", "AmazonSSM."+action)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	rec := httptest.NewRecorder()
+	h.Dispatch(rec, req)
+	return rec
+}
+
+func TestPutParameter_ConcurrentOverwrites(t *testing.T) {
+	h := ssm.NewHandler(resource.NewMemoryStore())
+
+	// Every writer races to create the same new name; each must get a
+	// version of its own.
+	const writers = 16
+	versions := make([]int64, writers)
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Go(func() {
+			rec := call(h, "PutParameter", fmt.Sprintf(`{"Name":"/app/db","Value":"v%d","Overwrite":true}`, i))
+			if rec.Code != 200 {
+				t.Errorf("PutParameter %d: %d %s", i, rec.Code, rec.Body)
+				return
+			}
+			var out ssm.PutParameterOutput
+			json.Unmarshal(rec.Body.Bytes(), &out)
+			versions[i] = out.Version
+		})
+	}
+	wg.Wait()
+
+	slices.Sort(versions)
+	for i, v := range versions {
+		if v != int64(i+1) {
+			t.Fatalf("versions = %v, want 1..%d with no gaps", versions, writers)
+		}
+	}
+}
+
+func TestPutParameter_ConcurrentCreates(t *testing.T) {
+	h := ssm.NewHandler(resource.NewMemoryStore())
+
+	const writers = 16
+	codes := make([]string, writers)
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Go(func() {
+			rec := call(h, "PutParameter", fmt.Sprintf(`{"Name":"/app/db","Value":"v%d"}`, i))
+			var out struct {
+				Type string `json:"__type"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &out)
+			codes[i] = out.Type
+		})
+	}
+	wg.Wait()
+
+	created := 0
+	for _, code := range codes {
+		switch code {
+		case "":
+			created++
+		case "ParameterAlreadyExists":
+		default:
+			t.Errorf("unexpected error %s", code)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("%d writers created the parameter, want 1", created)
+	}
+}
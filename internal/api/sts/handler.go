@@ -7,13 +7,12 @@ package sts
 import (
 	"net/http"
 
+	"opensnack/internal/awsarn"
 	"opensnack/internal/awsresponses"
 )
 
 const (
 	APIVersion = "2011-06-15"
-	stsAccount = "000000000000"
-	stsArn     = "arn:aws:iam::000000000000:user/opensnack"
 	stsUserId  = "opensnack"
 )
 
@@ -45,11 +44,12 @@ func (h *Handler) Dispatch(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) GetCallerIdentity(w http.ResponseWriter, r *http.Request) {
+	scope := awsarn.FromContext(r.Context())
 	resp := GetCallerIdentityResponse{
 		GetCallerIdentityResult: GetCallerIdentityResult{
-			Arn:     stsArn,
+			Arn:     scope.GlobalARN("iam", "user/"+stsUserId),
 			UserId:  stsUserId,
-			Account: stsAccount,
+			Account: scope.AccountID,
 		},
 		ResponseMetadata: ResponseMetadata{
 			RequestId: awsresponses.NextRequestID(),
@@ -0,0 +1,67 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package awsarn builds the ARNs and URLs that handlers hand back to
+// clients, for the account and region each request is served in. The
+// router works those out per request and records them in the request's
+// context; code running outside a request gets Default.
+package awsarn
+
+import (
+	"context"
+	"strings"
+)
+
+// Scope is the account, region and endpoint a request is served for.
+type Scope struct {
+	AccountID string
+	Region    string
+	// Endpoint is the scheme and host the client reached opensnack at,
+	// such as http://localhost:4566.
+	Endpoint string
+}
+
+// Default is the scope of contexts that carry none.
+var Default = Scope{
+	AccountID: "000000000000",
+	Region:    "us-east-1",
+	Endpoint:  "http://localhost:4566",
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that carries s.
+func NewContext(ctx context.Context, s Scope) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the scope recorded in ctx, or Default.
+func FromContext(ctx context.Context) Scope {
+	if s, ok := ctx.Value(contextKey{}).(Scope); ok {
+		return s
+	}
+	return Default
+}
+
+// ARN returns the ARN of a regional resource, such as
+// arn:aws:sqs:us-east-1:000000000000:jobs for ARN("sqs", "jobs").
+func (s Scope) ARN(service, resource string) string {
+	return "arn:aws:" + service + ":" + s.Region + ":" + s.AccountID + ":" + resource
+}
+
+// GlobalARN returns the ARN of a resource in a service without regions,
+// such as IAM.
+func (s Scope) GlobalARN(service, resource string) string {
+	return "arn:aws:" + service + "::" + s.AccountID + ":" + resource
+}
+
+// URL returns the endpoint followed by the given path elements.
+func (s Scope) URL(elem ...string) string {
+	return strings.TrimSuffix(s.Endpoint, "/") + "/" + strings.Join(elem, "/")
+}
+
+// AvailabilityZone returns the region's first availability zone.
+func (s Scope) AvailabilityZone() string {
+	return s.Region + "a"
+}
@@ -0,0 +1,35 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package awsarn_test
+
+import (
+	"context"
+	"testing"
+
+	"opensnack/internal/awsarn"
+)
+
+func TestScope(t *testing.T) {
+	if got := awsarn.FromContext(context.Background()); got != awsarn.Default {
+		t.Fatalf("FromContext without a scope = %+v, want Default", got)
+	}
+
+	s := awsarn.Scope{AccountID: "111122223333", Region: "eu-west-1", Endpoint: "https://sqs.eu-west-1.localhost:4567"}
+	ctx := awsarn.NewContext(t.Context(), s)
+	s = awsarn.FromContext(ctx)
+
+	for _, c := range []struct{ got, want string }{
+		{s.ARN("sqs", "jobs"), "arn:aws:sqs:eu-west-1:111122223333:jobs"},
+		{s.ARN("dynamodb", "table/users"), "arn:aws:dynamodb:eu-west-1:111122223333:table/users"},
+		{s.GlobalARN("iam", "role/ci"), "arn:aws:iam::111122223333:role/ci"},
+		{s.URL(s.AccountID, "jobs"), "https://sqs.eu-west-1.localhost:4567/111122223333/jobs"},
+		{s.URL(), "https://sqs.eu-west-1.localhost:4567/"},
+		{s.AvailabilityZone(), "eu-west-1a"},
+	} {
+		if c.got != c.want {
+			t.Errorf("got %s, want %s", c.got, c.want)
+		}
+	}
+}
@@ -10,22 +10,12 @@ import (
 	"testing"
 
 	"opensnack/internal/awsresponses"
-
-	"github.com/labstack/echo/v4"
 )
 
-func newCtx(method, path string) (echo.Context, *httptest.ResponseRecorder) {
-	e := echo.New()
-	req := httptest.NewRequest(method, path, nil)
-	rec := httptest.NewRecorder()
-	ctx := e.NewContext(req, rec)
-	return ctx, rec
-}
-
 func TestWriteEmpty200(t *testing.T) {
-	c, rec := newCtx("GET", "/")
+	rec := httptest.NewRecorder()
 
-	err := awsresponses.WriteEmpty200(c, map[string]string{"Location": "/test"})
+	err := awsresponses.WriteEmpty200(rec, map[string]string{"Location": "/test"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -42,9 +32,9 @@ func TestWriteEmpty200(t *testing.T) {
 }
 
 func TestWriteEmpty204(t *testing.T) {
-	c, rec := newCtx("DELETE", "/xyz")
+	rec := httptest.NewRecorder()
 
-	err := awsresponses.WriteEmpty204(c)
+	err := awsresponses.WriteEmpty204(rec)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -67,9 +57,30 @@ func TestRequestIDSequence(t *testing.T) {
 }
 
 func TestWriteErrorXML(t *testing.T) {
-	c, rec := newCtx("GET", "/bad")
+	rec := httptest.NewRecorder()
+
+	err := awsresponses.WriteErrorXML(rec, 404, "NoSuchBucket", "Bucket does not exist", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Code != 404 {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "<Code>NoSuchBucket</Code>") {
+		t.Fatalf("expected NoSuchBucket in error: %s", body)
+	}
+	if !strings.Contains(body, "<ErrorResponse>") || !strings.Contains(body, "<Type>Sender</Type>") {
+		t.Fatalf("expected a Query API ErrorResponse: %s", body)
+	}
+}
+
+func TestWriteS3ErrorXML(t *testing.T) {
+	rec := httptest.NewRecorder()
 
-	err := awsresponses.WriteErrorXML(c, 404, "NoSuchBucket", "Bucket does not exist", "foo")
+	err := awsresponses.WriteS3ErrorXML(rec, 404, "NoSuchBucket", "Bucket does not exist", "foo")
 	if err != nil {
 		t.Fatal(err)
 	}
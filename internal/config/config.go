@@ -0,0 +1,447 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package config holds the server's settings. They are taken from, in
+// increasing order of precedence: built-in defaults, a YAML or TOML file,
+// environment variables and command-line flags.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"opensnack/internal/awsarn"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the server's effective configuration.
+type Config struct {
+	Listen   Listen   `yaml:"listen" toml:"listen"`
+	Storage  Storage  `yaml:"storage" toml:"storage"`
+	Logging  Logging  `yaml:"logging" toml:"logging"`
+	Timeouts Timeouts `yaml:"timeouts" toml:"timeouts"`
+	Auth     Auth     `yaml:"auth" toml:"auth"`
+	DynamoDB DynamoDB `yaml:"dynamodb" toml:"dynamodb"`
+
+	// Services lists the services to serve, by SigV4 signing name. Empty
+	// means all of them.
+	Services []string `yaml:"services" toml:"services"`
+
+	// S3Domains are the base domains of virtual-hosted-style S3 host
+	// names, such as localhost in photos.s3.localhost.
+	S3Domains []string `yaml:"s3_domains" toml:"s3_domains"`
+
+	// Region and AccountID are used in ARNs and URLs when a request does
+	// not name its own.
+	Region    string   `yaml:"region" toml:"region"`
+	AccountID string   `yaml:"account_id" toml:"account_id"`
+	Accounts  Accounts `yaml:"accounts" toml:"accounts"`
+}
+
+// Accounts picks the account a request is served in by the access key
+// it is signed with or by its namespace, ahead of AccountID.
+type Accounts struct {
+	AccessKeys map[string]string `yaml:"access_keys,omitempty" toml:"access_keys,omitempty"`
+	Namespaces map[string]string `yaml:"namespaces,omitempty" toml:"namespaces,omitempty"`
+}
+
+type Listen struct {
+	Addr string `yaml:"addr" toml:"addr"`
+
+	// HTTPSAddr, if set, serves the same endpoints over HTTPS. TLSCert
+	// and TLSKey name a certificate to use; without them leaves are
+	// minted by a local CA kept in TLSDir.
+	HTTPSAddr string `yaml:"https_addr" toml:"https_addr"`
+	TLSCert   string `yaml:"tls_cert" toml:"tls_cert"`
+	TLSKey    string `yaml:"tls_key" toml:"tls_key"`
+	TLSDir    string `yaml:"tls_dir" toml:"tls_dir"`
+}
+
+// Auth controls SigV4 signature verification.
+type Auth struct {
+	// SigV4 is "off", accepting any request, or "strict".
+	SigV4 string `yaml:"sigv4" toml:"sigv4"`
+	// AccessKeys maps static access key IDs to their secret keys.
+	AccessKeys map[string]string `yaml:"access_keys,omitempty" toml:"access_keys,omitempty"`
+}
+
+type DynamoDB struct {
+	// TTLInterval is how often items past their TTL are deleted; zero
+	// turns the reaper off.
+	TTLInterval time.Duration `yaml:"ttl_interval" toml:"ttl_interval"`
+}
+
+type Storage struct {
+	// Backend is "postgres", "bolt" or "memory".
+	Backend     string   `yaml:"backend" toml:"backend"`
+	BoltPath    string   `yaml:"bolt_path" toml:"bolt_path"`
+	ObjectRoot  string   `yaml:"object_root" toml:"object_root"`
+	AutoMigrate bool     `yaml:"auto_migrate" toml:"auto_migrate"`
+	Postgres    Postgres `yaml:"postgres" toml:"postgres"`
+}
+
+type Postgres struct {
+	DSN             string        `yaml:"dsn" toml:"dsn"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+}
+
+type Logging struct {
+	// Level is "debug", "info", "warn" or "error".
+	Level string `yaml:"level" toml:"level"`
+	// Format is "console" or "json".
+	Format string `yaml:"format" toml:"format"`
+	// File is a log file written alongside stdout; empty turns it off.
+	File string `yaml:"file" toml:"file"`
+}
+
+type Timeouts struct {
+	Read  time.Duration `yaml:"read" toml:"read"`
+	Write time.Duration `yaml:"write" toml:"write"`
+	Idle  time.Duration `yaml:"idle" toml:"idle"`
+}
+
+// Default returns the settings used when nothing else is configured.
+func Default() *Config {
+	return &Config{
+		Listen: Listen{
+			Addr:   ":4566",
+			TLSDir: defaultTLSDir(),
+		},
+		Storage: Storage{
+			Backend:     "postgres",
+			BoltPath:    "/tmp/opensnack/opensnack.db",
+			ObjectRoot:  "/tmp/opensnack/objects",
+			AutoMigrate: true,
+			Postgres: Postgres{
+				MaxIdleConns:    10,
+				MaxOpenConns:    100,
+				ConnMaxLifetime: time.Hour,
+				ConnMaxIdleTime: 10 * time.Minute,
+			},
+		},
+		Logging: Logging{
+			Level:  "warn",
+			Format: "console",
+			File:   "opensnack.log",
+		},
+		Timeouts: Timeouts{
+			Read:  15 * time.Second,
+			Write: 30 * time.Second, // SQS long polling holds requests for up to 20s
+			Idle:  60 * time.Second,
+		},
+		Auth:      Auth{SigV4: "off"},
+		DynamoDB:  DynamoDB{TTLInterval: 10 * time.Second},
+		S3Domains: []string{"localhost"},
+		Region:    awsarn.Default.Region,
+		AccountID: awsarn.Default.AccountID,
+	}
+}
+
+// defaultTLSDir keeps the generated CA in the user's configuration
+// directory, out of reach of other users.
+func defaultTLSDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return filepath.Join(".opensnack", "tls")
+	}
+	return filepath.Join(dir, "opensnack", "tls")
+}
+
+//
+// SETTINGS
+//
+// Every setting that can come from the environment or a flag is listed
+// once here, with a pointer to its field.
+//
+
+type setting struct {
+	flag, env, usage string
+	field            func(*Config) any
+}
+
+var settings = []setting{
+	{"listen", "OPENSNACK_LISTEN_ADDR", "HTTP listen address", func(c *Config) any { return &c.Listen.Addr }},
+	{"https-listen", "OPENSNACK_HTTPS_ADDR", "HTTPS listen address, off if empty", func(c *Config) any { return &c.Listen.HTTPSAddr }},
+	{"tls-cert", "OPENSNACK_TLS_CERT", "PEM certificate for HTTPS", func(c *Config) any { return &c.Listen.TLSCert }},
+	{"tls-key", "OPENSNACK_TLS_KEY", "PEM private key for HTTPS", func(c *Config) any { return &c.Listen.TLSKey }},
+	{"tls-dir", "OPENSNACK_TLS_DIR", "directory of the generated local CA", func(c *Config) any { return &c.Listen.TLSDir }},
+	{"storage", "OPENSNACK_STORAGE", "storage backend: postgres, bolt or memory", func(c *Config) any { return &c.Storage.Backend }},
+	{"bolt-path", "OPENSNACK_BOLT_PATH", "bolt store file", func(c *Config) any { return &c.Storage.BoltPath }},
+	{"object-root", "OPENSNACK_OBJECT_ROOT", "directory for S3 object bodies", func(c *Config) any { return &c.Storage.ObjectRoot }},
+	{"auto-migrate", "OPENSNACK_AUTO_MIGRATE", "migrate the Postgres schema on startup", func(c *Config) any { return &c.Storage.AutoMigrate }},
+	{"pg-dsn", "OPENSNACK_PG_DSN", "Postgres connection string", func(c *Config) any { return &c.Storage.Postgres.DSN }},
+	{"pg-max-idle-conns", "OPENSNACK_PG_MAX_IDLE_CONNS", "Postgres idle connection pool size", func(c *Config) any { return &c.Storage.Postgres.MaxIdleConns }},
+	{"pg-max-open-conns", "OPENSNACK_PG_MAX_OPEN_CONNS", "Postgres open connection limit", func(c *Config) any { return &c.Storage.Postgres.MaxOpenConns }},
+	{"pg-conn-max-lifetime", "OPENSNACK_PG_CONN_MAX_LIFETIME", "longest a Postgres connection is reused", func(c *Config) any { return &c.Storage.Postgres.ConnMaxLifetime }},
+	{"pg-conn-max-idle-time", "OPENSNACK_PG_CONN_MAX_IDLE_TIME", "longest a Postgres connection sits idle", func(c *Config) any { return &c.Storage.Postgres.ConnMaxIdleTime }},
+	{"log-level", "LOG_LEVEL", "log level: debug, info, warn or error", func(c *Config) any { return &c.Logging.Level }},
+	{"log-format", "LOG_FORMAT", "log format: console or json", func(c *Config) any { return &c.Logging.Format }},
+	{"log-file", "OPENSNACK_LOG_FILE", "log file, off if empty", func(c *Config) any { return &c.Logging.File }},
+	{"read-timeout", "OPENSNACK_READ_TIMEOUT", "HTTP read timeout", func(c *Config) any { return &c.Timeouts.Read }},
+	{"write-timeout", "OPENSNACK_WRITE_TIMEOUT", "HTTP write timeout", func(c *Config) any { return &c.Timeouts.Write }},
+	{"idle-timeout", "OPENSNACK_IDLE_TIMEOUT", "HTTP keep-alive idle timeout", func(c *Config) any { return &c.Timeouts.Idle }},
+	{"sigv4", "OPENSNACK_SIGV4", "signature verification: off or strict", func(c *Config) any { return &c.Auth.SigV4 }},
+	{"access-keys", "OPENSNACK_ACCESS_KEYS", "comma-separated ACCESS_KEY_ID:SECRET_KEY pairs", func(c *Config) any { return &c.Auth.AccessKeys }},
+	{"dynamodb-ttl-interval", "OPENSNACK_DYNAMODB_TTL_INTERVAL", "how often expired DynamoDB items are deleted, off if 0", func(c *Config) any { return &c.DynamoDB.TTLInterval }},
+	{"services", "OPENSNACK_SERVICES", "comma-separated services to serve, all if empty", func(c *Config) any { return &c.Services }},
+	{"s3-domain", "OPENSNACK_S3_DOMAIN", "comma-separated base domains for virtual-hosted-style S3", func(c *Config) any { return &c.S3Domains }},
+	{"region", "OPENSNACK_REGION", "default region", func(c *Config) any { return &c.Region }},
+	{"account-id", "OPENSNACK_ACCOUNT_ID", "default account ID", func(c *Config) any { return &c.AccountID }},
+	{"access-key-accounts", "OPENSNACK_ACCESS_KEY_ACCOUNTS", "comma-separated ACCESS_KEY_ID:ACCOUNT_ID pairs", func(c *Config) any { return &c.Accounts.AccessKeys }},
+	{"namespace-accounts", "OPENSNACK_NAMESPACE_ACCOUNTS", "comma-separated NAMESPACE:ACCOUNT_ID pairs", func(c *Config) any { return &c.Accounts.Namespaces }},
+}
+
+// set parses value into the field p points to.
+func set(p any, value string) error {
+	switch p := p.(type) {
+	case *string:
+		*p = value
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*p = b
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*p = n
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*p = d
+	case *[]string:
+		*p = nil
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				*p = append(*p, s)
+			}
+		}
+	case *map[string]string:
+		*p = map[string]string{}
+		for _, pair := range strings.Split(value, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(pair, ":")
+			if !ok || k == "" {
+				return fmt.Errorf("%q is not a KEY:VALUE pair", pair)
+			}
+			(*p)[k] = v
+		}
+	default:
+		panic(fmt.Sprintf("config: unsupported field type %T", p))
+	}
+	return nil
+}
+
+// Load builds the configuration from the file named by -config or
+// OPENSNACK_CONFIG, the environment and the flags in args. It returns the
+// arguments left after the flags, such as a subcommand.
+func Load(args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("opensnack", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("OPENSNACK_CONFIG"), "YAML or TOML configuration file")
+
+	// Flags are only recorded while parsing, as they must be applied after
+	// the file and the environment.
+	flagged := map[string]string{}
+	for _, s := range settings {
+		record := func(value string) error {
+			if err := set(s.field(Default()), value); err != nil {
+				return err
+			}
+			flagged[s.flag] = value
+			return nil
+		}
+		usage := s.usage + " (" + s.env + ")"
+		if _, ok := s.field(Default()).(*bool); ok {
+			fs.BoolFunc(s.flag, usage, record)
+		} else {
+			fs.Func(s.flag, usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := Default()
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, nil, err
+	}
+	for _, s := range settings {
+		if value, ok := flagged[s.flag]; ok {
+			set(s.field(cfg), value)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// FromEnv returns the defaults overridden by the environment alone, for
+// servers started without a command line, such as in tests.
+func FromEnv() (*Config, error) {
+	cfg := Default()
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv sets each setting whose environment variable is non-empty.
+func (c *Config) applyEnv() error {
+	for _, s := range settings {
+		if value := os.Getenv(s.env); value != "" {
+			if err := set(s.field(c), value); err != nil {
+				return fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+	return nil
+}
+
+// loadFile reads path over c, choosing the format by its extension.
+// Unknown keys are errors so that typos do not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("%s: unknown configuration format %q, want .yaml, .yml or .toml", path, ext)
+	}
+	return nil
+}
+
+var accountID = regexp.MustCompile(`^[0-9]{12}$`)
+
+// Validate checks the settings that have a fixed set of values.
+func (c *Config) Validate() error {
+	if !slices.Contains([]string{"postgres", "bolt", "memory"}, c.Storage.Backend) {
+		return fmt.Errorf("unknown storage backend %q", c.Storage.Backend)
+	}
+	if !slices.Contains([]string{"debug", "info", "warn", "error"}, c.Logging.Level) {
+		return fmt.Errorf("unknown log level %q", c.Logging.Level)
+	}
+	if !slices.Contains([]string{"console", "json"}, c.Logging.Format) {
+		return fmt.Errorf("unknown log format %q", c.Logging.Format)
+	}
+	if !slices.Contains([]string{"off", "strict"}, c.Auth.SigV4) {
+		return fmt.Errorf("unknown sigv4 mode %q", c.Auth.SigV4)
+	}
+	if c.Listen.Addr == "" {
+		return errors.New("listen address is empty")
+	}
+	ids := []string{c.AccountID}
+	ids = slices.AppendSeq(ids, maps.Values(c.Accounts.AccessKeys))
+	ids = slices.AppendSeq(ids, maps.Values(c.Accounts.Namespaces))
+	for _, id := range ids {
+		if !accountID.MatchString(id) {
+			return fmt.Errorf("account ID %q is not 12 digits", id)
+		}
+	}
+	if (c.Listen.TLSCert == "") != (c.Listen.TLSKey == "") {
+		return errors.New("tls_cert and tls_key must be set together")
+	}
+	return nil
+}
+
+// ServiceEnabled reports whether name is one of Services, or whether
+// Services is empty.
+func (c *Config) ServiceEnabled(name string) bool {
+	return len(c.Services) == 0 || slices.Contains(c.Services, name)
+}
+
+//
+// PRINTING
+//
+
+var dsnPassword = regexp.MustCompile(`(password=)(\S+)`)
+
+// Redacted returns a copy of c with the Postgres password and the secret
+// access keys hidden.
+func (c *Config) Redacted() *Config {
+	out := *c
+	out.Services = slices.Clone(c.Services)
+	out.S3Domains = slices.Clone(c.S3Domains)
+	if c.Auth.AccessKeys != nil {
+		out.Auth.AccessKeys = map[string]string{}
+		for id := range c.Auth.AccessKeys {
+			out.Auth.AccessKeys[id] = "xxxxx"
+		}
+	}
+	dsn := out.Storage.Postgres.DSN
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+			dsn = u.String()
+		}
+	} else {
+		dsn = dsnPassword.ReplaceAllString(dsn, "${1}xxxxx")
+	}
+	out.Storage.Postgres.DSN = dsn
+	return &out
+}
+
+// Encode writes c in format, "yaml" or "toml".
+func (c *Config) Encode(w io.Writer, format string) error {
+	switch format {
+	case "yaml", "yml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "toml":
+		return toml.NewEncoder(w).Encode(c)
+	default:
+		return fmt.Errorf("unknown format %q, want yaml or toml", format)
+	}
+}
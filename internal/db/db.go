@@ -5,22 +5,20 @@
 package db
 
 import (
+	"opensnack/internal/config"
 	"opensnack/internal/logging"
-	"os"
-	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-func Connect() *gorm.DB {
-	dsn_from_envvar := os.Getenv("OPENSNACK_PG_DSN")
-	if dsn_from_envvar == "" {
-		panic("OPENSNACK_PG_DSN environment variable is not set")
+func Connect(cfg config.Postgres) *gorm.DB {
+	if cfg.DSN == "" {
+		panic("no Postgres DSN is configured (OPENSNACK_PG_DSN)")
 	}
 
-	db, err := gorm.Open(postgres.Open(dsn_from_envvar), &gorm.Config{
+	db, err := gorm.Open(postgres.Open(cfg.DSN), &gorm.Config{
 		Logger: logging.NewGormLogger(logger.Warn),
 	})
 	if err != nil {
@@ -34,16 +32,16 @@ func Connect() *gorm.DB {
 	}
 
 	// SetMaxIdleConns sets the maximum number of connections in the idle connection pool
-	sqlDB.SetMaxIdleConns(10)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
 
 	// SetMaxOpenConns sets the maximum number of open connections to the database
-	sqlDB.SetMaxOpenConns(100)
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
 
 	// SetConnMaxLifetime sets the maximum amount of time a connection may be reused
-	sqlDB.SetConnMaxLifetime(time.Hour)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	// SetConnMaxIdleTime sets the maximum amount of time a connection may be idle
-	sqlDB.SetConnMaxIdleTime(10 * time.Minute)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
 	return db
 }
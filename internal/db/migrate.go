@@ -0,0 +1,195 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package db
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+//
+// SCHEMA MIGRATIONS
+//
+// Each file in migrations/ is one schema version, named
+// <version>_<name>.sql. Versions are applied in order, each in its own
+// transaction, and recorded in schema_migrations so a later release only
+// runs the ones it adds. A Postgres advisory lock keeps two opensnack
+// processes starting against the same database from racing.
+//
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLock is the advisory lock key held while migrating.
+const migrationLock = 0x6f736e6b
+
+// Migration is one versioned schema change.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// AppliedMigration is a row of schema_migrations.
+type AppliedMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (AppliedMigration) TableName() string {
+	return "schema_migrations"
+}
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS public.schema_migrations (
+	version integer NOT NULL PRIMARY KEY,
+	name text NOT NULL,
+	applied_at timestamptz NOT NULL
+)`
+
+// Migrations returns the migrations built into this binary, oldest first.
+func Migrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	seen := map[int]string{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		num, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: name must be <version>_<name>.sql", e.Name())
+		}
+		if prev, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", prev, e.Name(), version)
+		}
+		seen[version] = e.Name()
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Migration{Version: version, Name: name, SQL: string(body)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// statements splits a migration into the statements it runs. Statements
+// end with a semicolon at the end of a line; "--" comment lines are
+// dropped.
+func (m Migration) statements() []string {
+	var out []string
+	var cur strings.Builder
+	for _, line := range strings.Split(m.SQL, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			out = append(out, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(cur.String()); rest != "" {
+		out = append(out, rest)
+	}
+	return out
+}
+
+// AppliedMigrations returns the versions recorded in schema_migrations,
+// oldest first. It is empty for a database that was never migrated.
+func AppliedMigrations(db *gorm.DB) ([]AppliedMigration, error) {
+	if !db.Migrator().HasTable(&AppliedMigration{}) {
+		return nil, nil
+	}
+	var out []AppliedMigration
+	err := db.Order("version").Find(&out).Error
+	return out, err
+}
+
+// Migrate applies every migration not yet recorded in schema_migrations
+// and returns the ones it ran. It refuses to touch a database that has
+// been migrated by a newer release.
+func Migrate(db *gorm.DB) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	err = db.Connection(func(conn *gorm.DB) error {
+		// The lock is per session, so it must be taken and released on
+		// the one connection the migrations run on.
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLock).Error; err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLock)
+
+		if err := conn.Exec(createMigrationsTable).Error; err != nil {
+			return fmt.Errorf("create schema_migrations: %w", err)
+		}
+		applied, err := AppliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		done := map[int]bool{}
+		latest := 0
+		if len(migrations) > 0 {
+			latest = migrations[len(migrations)-1].Version
+		}
+		for _, a := range applied {
+			if a.Version > latest {
+				return fmt.Errorf("database schema is at version %d but this build only knows up to %d", a.Version, latest)
+			}
+			done[a.Version] = true
+		}
+
+		for _, m := range migrations {
+			if done[m.Version] {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				for _, stmt := range m.statements() {
+					if err := tx.Exec(stmt).Error; err != nil {
+						return err
+					}
+				}
+				return tx.Create(&AppliedMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			zap.L().Info("applied schema migration",
+				zap.Int("version", m.Version),
+				zap.String("name", m.Name),
+			)
+			ran = append(ran, m)
+		}
+		return nil
+	})
+	return ran, err
+}
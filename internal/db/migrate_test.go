@@ -0,0 +1,35 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package db_test
+
+import (
+	"strings"
+	"testing"
+
+	"opensnack/internal/db"
+)
+
+func TestMigrations_Sequential(t *testing.T) {
+	migrations, err := db.Migrations()
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("expected built-in migrations")
+	}
+	// Versions are recorded in schema_migrations, so a gap or a reused
+	// number would make upgrades skip or repeat work.
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("migration %d has version %d", i+1, m.Version)
+		}
+		if m.Name == "" || !(strings.Contains(m.SQL, "CREATE") || strings.Contains(m.SQL, "ALTER")) {
+			t.Fatalf("unexpected migration %+v", m)
+		}
+	}
+	if !strings.Contains(migrations[0].SQL, "public.resources") {
+		t.Fatal("the first migration must create the resources table")
+	}
+}
@@ -2,13 +2,10 @@
 -- License, v. 2.0. If a copy of the MPL was not distributed with this
 -- file, You can obtain one at https://mozilla.org/MPL/2.0/.
 
--- public.resources definition
+-- public.resources holds every resource.Resource. IF NOT EXISTS keeps this
+-- safe on databases that were created by hand from the old init.sql.
 
--- Drop table
-
--- DROP TABLE public.resources;
-
-CREATE TABLE public.resources (
+CREATE TABLE IF NOT EXISTS public.resources (
 	id text NOT NULL,
 	"namespace" text NOT NULL,
 	service text NOT NULL,
@@ -18,4 +15,4 @@ CREATE TABLE public.resources (
 	resource_id uuid DEFAULT gen_random_uuid() NOT NULL,
 	CONSTRAINT resources_pkey PRIMARY KEY (resource_id)
 );
-CREATE UNIQUE INDEX uniq_resource ON public.resources USING btree (id, namespace);
\ No newline at end of file
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_resource ON public.resources USING btree (id, namespace);
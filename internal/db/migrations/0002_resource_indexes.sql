@@ -0,0 +1,14 @@
+-- This Source Code Form is subject to the terms of the Mozilla Public
+-- License, v. 2.0. If a copy of the MPL was not distributed with this
+-- file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+-- Every Store.List filters on (namespace, service, type); Namespaces
+-- filters on (service, type) alone.
+CREATE INDEX IF NOT EXISTS resources_namespace_service_type_idx
+	ON public.resources USING btree ("namespace", service, "type");
+CREATE INDEX IF NOT EXISTS resources_service_type_idx
+	ON public.resources USING btree (service, "type");
+
+-- Containment and key-existence queries on attributes.
+CREATE INDEX IF NOT EXISTS resources_attributes_gin_idx
+	ON public.resources USING gin ("attributes");
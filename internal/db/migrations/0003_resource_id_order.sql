@@ -0,0 +1,8 @@
+-- This Source Code Form is subject to the terms of the Mozilla Public
+-- License, v. 2.0. If a copy of the MPL was not distributed with this
+-- file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+-- Store.Query pages through resources in byte order of their ID, and
+-- filters on ID prefixes, within one namespace, service and type.
+CREATE INDEX IF NOT EXISTS resources_namespace_service_type_id_idx
+	ON public.resources USING btree ("namespace", service, "type", id COLLATE "C");
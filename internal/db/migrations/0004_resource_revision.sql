@@ -0,0 +1,7 @@
+-- This Source Code Form is subject to the terms of the Mozilla Public
+-- License, v. 2.0. If a copy of the MPL was not distributed with this
+-- file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+-- revision is bumped by every write so Store.Mutate can detect a
+-- concurrent update and retry instead of overwriting it.
+ALTER TABLE public.resources ADD COLUMN IF NOT EXISTS revision bigint DEFAULT 1 NOT NULL;
@@ -0,0 +1,283 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package localca keeps a private certificate authority for opensnack's
+// HTTPS listener. The CA is created once and stored on disk so clients
+// can add it to their trust stores; leaf certificates are minted in
+// memory for the host names a client asks for. Name constraints limit
+// the CA to localhost, loopback addresses and the configured S3 domains,
+// so trusting it does not let its key vouch for any other site.
+package localca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	certFile = "ca.pem"
+	keyFile  = "ca-key.pem"
+
+	caValidity   = 10 * 365 * 24 * time.Hour
+	leafValidity = 365 * 24 * time.Hour
+
+	// maxLeaves bounds the leaf cache, as clients choose the names.
+	maxLeaves = 64
+)
+
+// DefaultNames are the names of the certificate served to clients that
+// send no SNI, such as those connecting to an IP address.
+var DefaultNames = []string{"localhost", "*.localhost", "127.0.0.1", "::1"}
+
+// CA is a certificate authority and the leaf certificates it has issued.
+type CA struct {
+	// Cert is the CA certificate and PEM its encoding, for trust stores.
+	Cert *x509.Certificate
+	PEM  []byte
+
+	key crypto.Signer
+
+	mu     sync.Mutex
+	leaves map[string]*tls.Certificate
+}
+
+// LoadOrCreate loads the CA stored in dir, creating and saving a new one
+// if there is none yet. The CA may issue for localhost and domains. dir
+// and the key must belong to the current user and be private to them.
+func LoadOrCreate(dir string, domains ...string) (*CA, error) {
+	domains = permittedDomains(domains)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := checkPrivate(dir); err != nil {
+		return nil, err
+	}
+
+	certPEM, certErr := os.ReadFile(filepath.Join(dir, certFile))
+	keyPEM, keyErr := os.ReadFile(filepath.Join(dir, keyFile))
+	if certErr == nil && keyErr == nil {
+		if err := checkPrivate(filepath.Join(dir, keyFile)); err != nil {
+			return nil, err
+		}
+		ca, err := parse(certPEM, keyPEM)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range domains {
+			if !ca.permits(d) {
+				return nil, fmt.Errorf("the CA in %s cannot issue for %s; remove it to create a new one", dir, d)
+			}
+		}
+		return ca, nil
+	}
+	if !errors.Is(certErr, os.ErrNotExist) || !errors.Is(keyErr, os.ErrNotExist) {
+		return nil, fmt.Errorf("incomplete CA in %s: %v, %v", dir, certErr, keyErr)
+	}
+
+	certPEM, keyPEM, err := generate(domains)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, keyFile), keyPEM, 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, certFile), certPEM, 0o644); err != nil {
+		return nil, err
+	}
+	return parse(certPEM, keyPEM)
+}
+
+// permittedDomains returns localhost and domains, normalised and without
+// duplicates.
+func permittedDomains(domains []string) []string {
+	out := []string{"localhost"}
+	for _, d := range domains {
+		d = strings.ToLower(strings.Trim(strings.TrimSpace(d), "."))
+		if d != "" && !slices.Contains(out, d) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// loopback is the address space leaves may name by IP.
+var loopback = []*net.IPNet{
+	{IP: net.IPv4(127, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv6loopback, Mask: net.CIDRMask(128, 128)},
+}
+
+func generate(domains []string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: "OpenSnack Local CA", Organization: []string{"OpenSnack"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         domains,
+		PermittedIPRanges:           loopback,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+func parse(certPEM, keyPEM []byte) (*CA, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, errors.New("CA files are not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok || !cert.IsCA {
+		return nil, errors.New("CA files do not hold a CA certificate and its key")
+	}
+	return &CA{Cert: cert, PEM: certPEM, key: signer, leaves: map[string]*tls.Certificate{}}, nil
+}
+
+// permits reports whether the CA's name constraints allow name.
+func (ca *CA) permits(name string) bool {
+	for _, d := range ca.Cert.PermittedDNSDomains {
+		if name == d || strings.HasSuffix(name, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func serialNumber() *big.Int {
+	n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return n
+}
+
+// Issue mints a leaf certificate for the given DNS names and IP
+// addresses.
+func (ca *CA) Issue(names ...string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{CommonName: names[0], Organization: []string{"OpenSnack"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, n := range names {
+		if ip := net.ParseIP(n); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, n)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, ca.Cert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// GetCertificate serves a wildcard certificate for the host name the
+// client asked for, so sqs.us-east-1.localhost and
+// photos.s3.localhost are covered as well as localhost itself. Names the
+// CA may not issue for get DefaultNames. At most maxLeaves leaves are
+// cached.
+func (ca *CA) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	names := ca.leafNames(strings.ToLower(strings.TrimSuffix(hello.ServerName, ".")))
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if cert, ok := ca.leaves[names[0]]; ok {
+		return cert, nil
+	}
+	cert, err := ca.Issue(names...)
+	if err != nil {
+		return nil, err
+	}
+	if len(ca.leaves) >= maxLeaves {
+		for k := range ca.leaves {
+			delete(ca.leaves, k)
+			break
+		}
+	}
+	ca.leaves[names[0]] = cert
+	return cert, nil
+}
+
+// leafNames returns the names of the leaf served for name: a wildcard
+// under its parent domain, or under name itself if it is one of the
+// permitted domains. Names under localhost, and names the CA may not
+// issue for, get DefaultNames.
+func (ca *CA) leafNames(name string) []string {
+	if !ca.permits(name) {
+		return DefaultNames
+	}
+	parent := name
+	if _, p, ok := strings.Cut(name, "."); ok && ca.permits(p) {
+		parent = p
+	}
+	if parent == "localhost" {
+		return DefaultNames
+	}
+	return []string{"*." + parent, parent}
+}
+
+// TLSConfig returns a server configuration that uses GetCertificate.
+func (ca *CA) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: ca.GetCertificate,
+	}
+}
@@ -0,0 +1,182 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package localca_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"opensnack/internal/localca"
+)
+
+// caDir returns a directory for LoadOrCreate to create, private to the
+// user unlike t.TempDir itself.
+func caDir(t *testing.T) string {
+	return filepath.Join(t.TempDir(), "tls")
+}
+
+func TestLoadOrCreate_Persists(t *testing.T) {
+	dir := caDir(t)
+	first, err := localca.LoadOrCreate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := localca.LoadOrCreate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.PEM, second.PEM) {
+		t.Fatal("reloading the CA produced a different certificate")
+	}
+	if !second.Cert.IsCA {
+		t.Fatal("certificate is not a CA")
+	}
+}
+
+func TestLoadOrCreate_RefusesSharedFiles(t *testing.T) {
+	dir := caDir(t)
+	if _, err := localca.LoadOrCreate(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chmod(filepath.Join(dir, "ca-key.pem"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := localca.LoadOrCreate(dir); err == nil {
+		t.Error("loaded a CA key readable by other users")
+	}
+	os.Chmod(filepath.Join(dir, "ca-key.pem"), 0o600)
+
+	if err := os.Chmod(dir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := localca.LoadOrCreate(dir); err == nil {
+		t.Error("loaded a CA from a directory writable by other users")
+	}
+}
+
+func TestLoadOrCreate_NameConstraints(t *testing.T) {
+	dir := caDir(t)
+	ca, err := localca.LoadOrCreate(dir, "127.0.0.1.nip.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	for host, allowed := range map[string]bool{
+		"photos.s3.localhost":     true,
+		"photos.127.0.0.1.nip.io": true,
+		"127.0.0.1":               true,
+		"www.example.com":         false,
+		"10.0.0.1":                false,
+	} {
+		cert, err := ca.Issue(host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = cert.Leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots})
+		if allowed && err != nil {
+			t.Errorf("%s: %v", host, err)
+		}
+		if !allowed && err == nil {
+			t.Errorf("%s: a leaf outside the name constraints verified", host)
+		}
+	}
+
+	if _, err := localca.LoadOrCreate(dir, "example.test"); err == nil {
+		t.Error("reused a CA that cannot issue for a newly configured domain")
+	}
+}
+
+func TestGetCertificate_VerifiesAgainstCA(t *testing.T) {
+	ca, err := localca.LoadOrCreate(caDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	for _, host := range []string{
+		"localhost",
+		"sqs.localhost",
+		"sqs.us-east-1.localhost",
+		"photos.s3.localhost",
+		"photos.s3.eu-west-1.localhost",
+		"127.0.0.1",
+	} {
+		sni := host
+		if host == "127.0.0.1" {
+			sni = "" // clients send no SNI for IP addresses
+		}
+		cert, err := ca.GetCertificate(&tls.ClientHelloInfo{ServerName: sni})
+		if err != nil {
+			t.Fatalf("%s: %v", host, err)
+		}
+		if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("%s: %v", host, err)
+		}
+	}
+}
+
+func TestGetCertificate_OtherNames(t *testing.T) {
+	ca, err := localca.LoadOrCreate(caDir(t), "127.0.0.1.nip.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sni := range []string{"www.example.com", "localhost.example.com", "a.b.c.d.e.example.org"} {
+		cert, err := ca.GetCertificate(&tls.ClientHelloInfo{ServerName: sni})
+		if err != nil {
+			t.Fatalf("%s: %v", sni, err)
+		}
+		if !slices.Equal(cert.Leaf.DNSNames, []string{"localhost", "*.localhost"}) {
+			t.Errorf("%s: got a leaf for %q, want the default names", sni, cert.Leaf.DNSNames)
+		}
+	}
+
+	cert, err := ca.GetCertificate(&tls.ClientHelloInfo{ServerName: "photos.127.0.0.1.nip.io"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Leaf.VerifyHostname("photos.127.0.0.1.nip.io"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTLSConfig_RoundTrip(t *testing.T) {
+	ca, err := localca.LoadOrCreate(caDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	srv.TLS = ca.TLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca.PEM) {
+		t.Fatal("CA PEM did not parse")
+	}
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "s3.localhost"},
+	}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+}
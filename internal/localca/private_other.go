@@ -0,0 +1,13 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:build !unix
+
+package localca
+
+// checkPrivate is a no-op where file ownership is not Unix-style; the
+// directory is still created private to the user.
+func checkPrivate(path string) error {
+	return nil
+}
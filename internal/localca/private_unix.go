@@ -0,0 +1,30 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:build unix
+
+package localca
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkPrivate returns an error unless path belongs to the current user
+// and is out of reach of everyone else, so that another local user can
+// neither plant a CA for this user's clients to trust nor read its key.
+func checkPrivate(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is not owned by the current user", path)
+	}
+	if info.Mode()&os.ModeSymlink != 0 || info.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("%s must not be accessible to other users (mode %v)", path, info.Mode())
+	}
+	return nil
+}
@@ -7,18 +7,22 @@ package logging
 import (
 	"os"
 
+	"opensnack/internal/config"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-func New() (*zap.Logger, error) {
+// New returns a logger writing to stdout and, if cfg.File is set, to a
+// rotated log file.
+func New(cfg config.Logging) (*zap.Logger, error) {
 	encoderCfg := zap.NewProductionEncoderConfig()
 	encoderCfg.TimeKey = "ts"
 	encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
 
 	var encoder zapcore.Encoder
-	if os.Getenv("LOG_FORMAT") == "json" {
+	if cfg.Format == "json" {
 		encoder = zapcore.NewJSONEncoder(encoderCfg)
 	} else {
 		encoderCfg.EncodeLevel = zapcore.CapitalColorLevelEncoder
@@ -26,23 +30,25 @@ func New() (*zap.Logger, error) {
 
 	}
 
-	level := zap.WarnLevel
-	if os.Getenv("LOG_LEVEL") == "debug" {
-		level = zap.DebugLevel
+	level, err := zapcore.ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
 	}
 
-	fileWriter := zapcore.AddSync(&lumberjack.Logger{
-		Filename:   "opensnack.log",
-		MaxSize:    100, // MB
-		MaxBackups: 5,
-		MaxAge:     7,
-		Compress:   true,
-	})
-
-	core := zapcore.NewTee(
+	cores := []zapcore.Core{
 		zapcore.NewCore(encoder, zapcore.AddSync(os.Stdout), level),
-		zapcore.NewCore(encoder, fileWriter, level),
-	)
+	}
+	if cfg.File != "" {
+		fileWriter := zapcore.AddSync(&lumberjack.Logger{
+			Filename:   cfg.File,
+			MaxSize:    100, // MB
+			MaxBackups: 5,
+			MaxAge:     7,
+			Compress:   true,
+		})
+		cores = append(cores, zapcore.NewCore(encoder, fileWriter, level))
+	}
+	core := zapcore.NewTee(cores...)
 
 	return zap.New(
 		core,
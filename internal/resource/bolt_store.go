@@ -0,0 +1,320 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+//
+// EMBEDDED STORE
+//
+// BoltStore keeps resources in a single bbolt file so opensnack can run
+// without Postgres. Resources are JSON values in the "resources" bucket,
+// keyed by namespace and ID like the uniq_resource index. The "by_type"
+// bucket indexes them by service, type and namespace for List and
+// Namespaces.
+//
+
+var (
+	resourcesBucket = []byte("resources")
+	byTypeBucket    = []byte("by_type")
+)
+
+// ErrNotFound is returned by the embedded store for missing resources.
+var ErrNotFound = errors.New("record not found")
+
+// ErrDuplicate is returned by every store when creating a resource whose
+// ID is already taken in its namespace.
+var ErrDuplicate = errors.New("duplicate key value violates unique constraint")
+
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens (creating if needed) the store file at path.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{resourcesBucket, byTypeBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db}, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) Create(ctx context.Context, res *Resource) error {
+	return s.db.Update(func(tx *bolt.Tx) error { return boltTx{tx}.Create(ctx, res) })
+}
+
+func (s *BoltStore) Update(ctx context.Context, res *Resource) error {
+	return s.db.Update(func(tx *bolt.Tx) error { return boltTx{tx}.Update(ctx, res) })
+}
+
+func (s *BoltStore) Get(ctx context.Context, id, service, typ, namespace string) (*Resource, error) {
+	var out *Resource
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		out, err = boltTx{tx}.Get(ctx, id, service, typ, namespace)
+		return err
+	})
+	return out, err
+}
+
+func (s *BoltStore) List(ctx context.Context, service, typ, namespace string) ([]Resource, error) {
+	var out []Resource
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		out, err = boltTx{tx}.List(ctx, service, typ, namespace)
+		return err
+	})
+	return out, err
+}
+
+func (s *BoltStore) Query(ctx context.Context, q Query) (Page, error) {
+	var out Page
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		out, err = boltTx{tx}.Query(ctx, q)
+		return err
+	})
+	return out, err
+}
+
+// Mutate runs fn outside any bbolt transaction, so fn may use the store,
+// and swaps in a short write transaction of its own.
+func (s *BoltStore) Mutate(ctx context.Context, id, service, typ, namespace string, fn func(r *Resource) error) (*Resource, error) {
+	return mutate(ctx, s, id, service, typ, namespace, fn, func(res *Resource, rev int64) (bool, error) {
+		var ok bool
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			var err error
+			ok, err = boltTx{tx}.swap(res, rev)
+			return err
+		})
+		return ok, err
+	})
+}
+
+func (s *BoltStore) Delete(ctx context.Context, id, service, typ, namespace string) error {
+	return s.db.Update(func(tx *bolt.Tx) error { return boltTx{tx}.Delete(ctx, id, service, typ, namespace) })
+}
+
+// Transaction runs fn in one bbolt write transaction. bbolt allows a
+// single writer, so concurrent transactions are serialised.
+func (s *BoltStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error { return fn(boltTx{tx}) })
+}
+
+func (s *BoltStore) Namespaces(ctx context.Context, service, typ string) ([]string, error) {
+	var out []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		seen := map[string]bool{}
+		prefix := joinKey(service, typ, "")
+		c := tx.Bucket(byTypeBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			ns, _, _ := bytes.Cut(k[len(prefix):], []byte{0})
+			if !seen[string(ns)] {
+				seen[string(ns)] = true
+				out = append(out, string(ns))
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// joinKey joins key parts with NUL, which never appears in IDs.
+func joinKey(parts ...string) []byte {
+	var b bytes.Buffer
+	for i, p := range parts {
+		if i > 0 {
+			b.WriteByte(0)
+		}
+		b.WriteString(p)
+	}
+	return b.Bytes()
+}
+
+// boltTx is the Store bound to one bbolt transaction.
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t boltTx) load(id, namespace string) (*Resource, error) {
+	raw := t.tx.Bucket(resourcesBucket).Get(joinKey(namespace, id))
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+	var r Resource
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (t boltTx) put(res *Resource) error {
+	raw, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	if err := t.tx.Bucket(resourcesBucket).Put(joinKey(res.Namespace, res.ID), raw); err != nil {
+		return err
+	}
+	return t.tx.Bucket(byTypeBucket).Put(joinKey(res.Service, res.Type, res.Namespace, res.ID), nil)
+}
+
+func (t boltTx) remove(res *Resource) error {
+	if err := t.tx.Bucket(resourcesBucket).Delete(joinKey(res.Namespace, res.ID)); err != nil {
+		return err
+	}
+	return t.tx.Bucket(byTypeBucket).Delete(joinKey(res.Service, res.Type, res.Namespace, res.ID))
+}
+
+func (t boltTx) Create(ctx context.Context, res *Resource) error {
+	if _, err := t.load(res.ID, res.Namespace); err == nil {
+		return ErrDuplicate
+	}
+	if res.CreatedAt.IsZero() {
+		res.CreatedAt = time.Now()
+	}
+	if res.Revision == 0 {
+		res.Revision = 1
+	}
+	return t.put(res)
+}
+
+// Update changes the non-zero fields of an existing resource, as
+// GormStore's Updates does. Updating a missing resource is a no-op.
+func (t boltTx) Update(ctx context.Context, res *Resource) error {
+	cur, err := t.load(res.ID, res.Namespace)
+	if err != nil {
+		return nil
+	}
+	if err := t.remove(cur); err != nil {
+		return err
+	}
+	next := *cur
+	if res.Service != "" {
+		next.Service = res.Service
+	}
+	if res.Type != "" {
+		next.Type = res.Type
+	}
+	if res.Attributes != nil {
+		next.Attributes = res.Attributes
+	}
+	if !res.CreatedAt.IsZero() {
+		next.CreatedAt = res.CreatedAt
+	}
+	next.Revision = cur.Revision + 1
+	return t.put(&next)
+}
+
+// swap writes res if the stored copy is still at revision rev.
+func (t boltTx) swap(res *Resource, rev int64) (bool, error) {
+	cur, err := t.load(res.ID, res.Namespace)
+	if err != nil || cur.Revision != rev {
+		return false, nil
+	}
+	return true, t.put(res)
+}
+
+func (t boltTx) Mutate(ctx context.Context, id, service, typ, namespace string, fn func(r *Resource) error) (*Resource, error) {
+	return mutate(ctx, t, id, service, typ, namespace, fn, t.swap)
+}
+
+func (t boltTx) Get(ctx context.Context, id, service, typ, namespace string) (*Resource, error) {
+	r, err := t.load(id, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if r.Service != service || r.Type != typ {
+		return nil, ErrNotFound
+	}
+	return r, nil
+}
+
+func (t boltTx) List(ctx context.Context, service, typ, namespace string) ([]Resource, error) {
+	page, err := t.Query(ctx, Query{Service: service, Type: typ, Namespace: namespace})
+	return page.Resources, err
+}
+
+// Query walks the by_type index from the cursor, so a page costs its own
+// size plus whatever Match skips.
+func (t boltTx) Query(ctx context.Context, q Query) (Page, error) {
+	matches, err := attributeMatcher(q.Match)
+	if err != nil {
+		return Page{}, err
+	}
+	base := joinKey(q.Service, q.Type, q.Namespace, "")
+	prefix := append(append([]byte(nil), base...), q.IDPrefix...)
+	start := prefix
+	if from := append(append([]byte(nil), base...), q.StartID...); bytes.Compare(from, start) > 0 {
+		start = from
+	}
+	after := ""
+	if q.Cursor != "" {
+		if after, err = DecodeCursor(q.Cursor); err != nil {
+			return Page{}, err
+		}
+		if from := append(append([]byte(nil), base...), after...); bytes.Compare(from, start) > 0 {
+			start = from
+		}
+	}
+
+	var out []Resource
+	c := t.tx.Bucket(byTypeBucket).Cursor()
+	for k, _ := c.Seek(start); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		id := string(k[len(base):])
+		if q.Cursor != "" && id <= after {
+			continue
+		}
+		r, err := t.load(id, q.Namespace)
+		if err != nil {
+			return Page{}, err
+		}
+		if !matches(r.Attributes) {
+			continue
+		}
+		out = append(out, *r)
+		if q.Limit > 0 && len(out) > q.Limit {
+			break
+		}
+	}
+	return pageOf(out, q.Limit), nil
+}
+
+func (t boltTx) Delete(ctx context.Context, id, service, typ, namespace string) error {
+	r, err := t.Get(ctx, id, service, typ, namespace)
+	if err != nil {
+		return nil
+	}
+	return t.remove(r)
+}
@@ -0,0 +1,43 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package resource_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"opensnack/internal/resource"
+	"opensnack/internal/resource/storetest"
+)
+
+func TestBoltStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) resource.Store {
+		s, err := resource.OpenBoltStore(filepath.Join(t.TempDir(), "opensnack.db"))
+		if err != nil {
+			t.Fatalf("OpenBoltStore: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestBoltStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "opensnack.db")
+	s, err := resource.OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("OpenBoltStore: %v", err)
+	}
+	s.Create(t.Context(), &resource.Resource{ID: "b1", Namespace: "default", Service: "s3", Type: "bucket", Attributes: []byte(`{}`)})
+	s.Close()
+
+	s, err = resource.OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer s.Close()
+	if _, err := s.Get(t.Context(), "b1", "s3", "bucket", "default"); err != nil {
+		t.Fatalf("resource lost across reopen: %v", err)
+	}
+}
@@ -4,7 +4,15 @@
 
 package resource
 
-import "gorm.io/gorm"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
 
 type GormStore struct {
 	db *gorm.DB
@@ -14,32 +22,129 @@ func NewGormStore(db *gorm.DB) *GormStore {
 	return &GormStore{db}
 }
 
-func (s *GormStore) Create(res *Resource) error {
-	return s.db.Create(res).Error
+func (s *GormStore) Create(ctx context.Context, res *Resource) error {
+	if res.Revision == 0 {
+		res.Revision = 1
+	}
+	err := s.db.WithContext(ctx).Create(res).Error
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+		return ErrDuplicate
+	}
+	return err
 }
 
-func (s *GormStore) Update(res *Resource) error {
+// Update writes the non-zero fields of res and bumps the revision,
+// whatever it was.
+func (s *GormStore) Update(ctx context.Context, res *Resource) error {
+	cols := map[string]any{"revision": gorm.Expr("revision + 1")}
+	if res.Service != "" {
+		cols["service"] = res.Service
+	}
+	if res.Type != "" {
+		cols["type"] = res.Type
+	}
+	if res.Attributes != nil {
+		cols["attributes"] = res.Attributes
+	}
+	if !res.CreatedAt.IsZero() {
+		cols["created_at"] = res.CreatedAt
+	}
 	// Use explicit WHERE clause for composite primary key (id, namespace)
-	return s.db.Model(&Resource{}).
+	return s.db.WithContext(ctx).Model(&Resource{}).
 		Where("id = ? AND namespace = ?", res.ID, res.Namespace).
-		Updates(res).Error
+		Updates(cols).Error
+}
+
+// Mutate swaps with an UPDATE guarded by the revision it read, so two
+// processes sharing the database cannot overwrite each other either.
+func (s *GormStore) Mutate(ctx context.Context, id, service, typ, namespace string, fn func(r *Resource) error) (*Resource, error) {
+	return mutate(ctx, s, id, service, typ, namespace, fn, func(res *Resource, rev int64) (bool, error) {
+		db := s.db.WithContext(ctx).Model(&Resource{}).
+			Where("id = ? AND namespace = ? AND revision = ?", res.ID, res.Namespace, rev).
+			Updates(map[string]any{
+				"attributes": res.Attributes,
+				"created_at": res.CreatedAt,
+				"revision":   res.Revision,
+			})
+		return db.RowsAffected == 1, db.Error
+	})
 }
 
-func (s *GormStore) Get(id, service, typ, namespace string) (*Resource, error) {
+func (s *GormStore) Get(ctx context.Context, id, service, typ, namespace string) (*Resource, error) {
 	var r Resource
-	err := s.db.Where("id = ? AND service = ? AND type = ? AND namespace = ?",
+	err := s.db.WithContext(ctx).Where("id = ? AND service = ? AND type = ? AND namespace = ?",
 		id, service, typ, namespace).First(&r).Error
 	return &r, err
 }
 
-func (s *GormStore) List(service, typ, namespace string) ([]Resource, error) {
+func (s *GormStore) List(ctx context.Context, service, typ, namespace string) ([]Resource, error) {
 	var out []Resource
-	err := s.db.Where("service = ? AND type = ? AND namespace = ?",
+	err := s.db.WithContext(ctx).Where("service = ? AND type = ? AND namespace = ?",
 		service, typ, namespace).Find(&out).Error
 	return out, err
 }
 
-func (s *GormStore) Delete(id, service, typ, namespace string) error {
-	return s.db.Where("id = ? AND service = ? AND type = ? AND namespace = ?",
+// Query pushes the ID prefix and attribute match down to Postgres; Match
+// becomes a jsonb @> test that the GIN index on attributes serves. IDs
+// are compared with the "C" collation so pages follow byte order.
+func (s *GormStore) Query(ctx context.Context, q Query) (Page, error) {
+	db := s.db.WithContext(ctx).Where("service = ? AND type = ? AND namespace = ?",
+		q.Service, q.Type, q.Namespace)
+	if q.IDPrefix != "" {
+		db = db.Where(`id COLLATE "C" LIKE ? ESCAPE '\'`, likePrefix(q.IDPrefix))
+	}
+	if q.StartID != "" {
+		db = db.Where(`id COLLATE "C" >= ?`, q.StartID)
+	}
+	if len(q.Match) > 0 {
+		doc, err := json.Marshal(q.Match)
+		if err != nil {
+			return Page{}, err
+		}
+		db = db.Where("attributes @> ?::jsonb", string(doc))
+	}
+	if q.Cursor != "" {
+		after, err := DecodeCursor(q.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		db = db.Where(`id COLLATE "C" > ?`, after)
+	}
+	db = db.Order(`id COLLATE "C"`)
+	if q.Limit > 0 {
+		db = db.Limit(q.Limit + 1)
+	}
+
+	var out []Resource
+	if err := db.Find(&out).Error; err != nil {
+		return Page{}, err
+	}
+	return pageOf(out, q.Limit), nil
+}
+
+// likePrefix escapes prefix for a LIKE pattern that matches it as a
+// prefix.
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(prefix) + "%"
+}
+
+func (s *GormStore) Delete(ctx context.Context, id, service, typ, namespace string) error {
+	return s.db.WithContext(ctx).Where("id = ? AND service = ? AND type = ? AND namespace = ?",
 		id, service, typ, namespace).Delete(&Resource{}).Error
 }
+
+func (s *GormStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&GormStore{tx})
+	})
+}
+
+func (s *GormStore) Namespaces(ctx context.Context, service, typ string) ([]string, error) {
+	var out []string
+	err := s.db.WithContext(ctx).Model(&Resource{}).
+		Where("service = ? AND type = ?", service, typ).
+		Distinct().Pluck("namespace", &out).Error
+	return out, err
+}
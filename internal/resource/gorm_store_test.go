@@ -0,0 +1,37 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package resource_test
+
+import (
+	"os"
+	"testing"
+
+	"opensnack/internal/config"
+	"opensnack/internal/db"
+	"opensnack/internal/resource"
+	"opensnack/internal/resource/storetest"
+)
+
+// TestGormStore_Conformance runs against the Postgres named by
+// OPENSNACK_TEST_PG_DSN. Every resource in that database is deleted.
+func TestGormStore_Conformance(t *testing.T) {
+	dsn := os.Getenv("OPENSNACK_TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("OPENSNACK_TEST_PG_DSN is not set")
+	}
+	cfg := config.Default().Storage.Postgres
+	cfg.DSN = dsn
+	pg := db.Connect(cfg)
+	if _, err := db.Migrate(pg); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	storetest.Run(t, func(t *testing.T) resource.Store {
+		if err := pg.Exec("DELETE FROM resources").Error; err != nil {
+			t.Fatalf("clearing resources: %v", err)
+		}
+		return resource.NewGormStore(pg)
+	})
+}
@@ -0,0 +1,248 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package resource
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+//
+// IN-MEMORY STORE
+//
+// MemoryStore keeps resources in a map and forgets them on exit. It is
+// meant for tests: every method is safe for concurrent use and returns
+// copies, so callers can never race on a stored resource.
+//
+
+type memKey struct {
+	namespace, id string
+}
+
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[memKey]Resource
+
+	// txMu serialises transactions; see Transaction.
+	txMu sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: map[memKey]Resource{}}
+}
+
+func cloneResource(r Resource) Resource {
+	r.Attributes = append([]byte(nil), r.Attributes...)
+	return r
+}
+
+func (s *MemoryStore) Create(ctx context.Context, res *Resource) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := memKey{res.Namespace, res.ID}
+	if _, ok := s.data[k]; ok {
+		return ErrDuplicate
+	}
+	if res.CreatedAt.IsZero() {
+		res.CreatedAt = time.Now()
+	}
+	if res.Revision == 0 {
+		res.Revision = 1
+	}
+	s.data[k] = cloneResource(*res)
+	return nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, res *Resource) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.update(res)
+	return nil
+}
+
+// update changes the non-zero fields of an existing resource, as
+// GormStore's Updates does. Updating a missing resource is a no-op.
+func (s *MemoryStore) update(res *Resource) {
+	k := memKey{res.Namespace, res.ID}
+	cur, ok := s.data[k]
+	if !ok {
+		return
+	}
+	if res.Service != "" {
+		cur.Service = res.Service
+	}
+	if res.Type != "" {
+		cur.Type = res.Type
+	}
+	if res.Attributes != nil {
+		cur.Attributes = append([]byte(nil), res.Attributes...)
+	}
+	if !res.CreatedAt.IsZero() {
+		cur.CreatedAt = res.CreatedAt
+	}
+	cur.Revision++
+	s.data[k] = cur
+}
+
+func (s *MemoryStore) Mutate(ctx context.Context, id, service, typ, namespace string, fn func(r *Resource) error) (*Resource, error) {
+	// fn runs without the lock held, so it may read the store.
+	return mutate(ctx, s, id, service, typ, namespace, fn, func(res *Resource, rev int64) (bool, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		k := memKey{res.Namespace, res.ID}
+		if cur, ok := s.data[k]; !ok || cur.Revision != rev {
+			return false, nil
+		}
+		s.data[k] = cloneResource(*res)
+		return true, nil
+	})
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id, service, typ, namespace string) (*Resource, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.data[memKey{namespace, id}]
+	if !ok || r.Service != service || r.Type != typ {
+		return nil, ErrNotFound
+	}
+	r = cloneResource(r)
+	return &r, nil
+}
+
+// List returns matching resources ordered by ID.
+func (s *MemoryStore) List(ctx context.Context, service, typ, namespace string) ([]Resource, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Resource
+	for k, r := range s.data {
+		if k.namespace == namespace && r.Service == service && r.Type == typ {
+			out = append(out, cloneResource(r))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (s *MemoryStore) Query(ctx context.Context, q Query) (Page, error) {
+	list, _ := s.List(ctx, q.Service, q.Type, q.Namespace)
+	return FilterPage(list, q)
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id, service, typ, namespace string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delete(id, service, typ, namespace)
+	return nil
+}
+
+func (s *MemoryStore) delete(id, service, typ, namespace string) {
+	k := memKey{namespace, id}
+	if r, ok := s.data[k]; ok && r.Service == service && r.Type == typ {
+		delete(s.data, k)
+	}
+}
+
+func (s *MemoryStore) Namespaces(ctx context.Context, service, typ string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seen := map[string]bool{}
+	var out []string
+	for k, r := range s.data {
+		if r.Service == service && r.Type == typ && !seen[k.namespace] {
+			seen[k.namespace] = true
+			out = append(out, k.namespace)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Len returns the number of stored resources.
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data)
+}
+
+// Transaction runs fn against a private copy of the data and, if fn
+// succeeds, replays its writes onto the store. Transactions are
+// serialised with each other but do not block plain reads and writes
+// while fn runs, so fn may call back into the store (as handlers do
+// through their Store field).
+func (s *MemoryStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.RLock()
+	tx := &memTx{view: &MemoryStore{data: make(map[memKey]Resource, len(s.data))}}
+	for k, r := range s.data {
+		tx.view.data[k] = r
+	}
+	s.mu.RUnlock()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, op := range tx.ops {
+		op(s)
+	}
+	return nil
+}
+
+// memTx is the Store bound to one MemoryStore transaction. Writes go to
+// view, a private copy, and are queued in ops for commit.
+type memTx struct {
+	view *MemoryStore
+	ops  []func(s *MemoryStore)
+}
+
+func (t *memTx) Create(ctx context.Context, res *Resource) error {
+	if err := t.view.Create(ctx, res); err != nil {
+		return err
+	}
+	r := cloneResource(*res)
+	t.ops = append(t.ops, func(s *MemoryStore) { s.data[memKey{r.Namespace, r.ID}] = r })
+	return nil
+}
+
+func (t *memTx) Update(ctx context.Context, res *Resource) error {
+	t.view.Update(ctx, res)
+	r := cloneResource(*res)
+	t.ops = append(t.ops, func(s *MemoryStore) { s.update(&r) })
+	return nil
+}
+
+func (t *memTx) Get(ctx context.Context, id, service, typ, namespace string) (*Resource, error) {
+	return t.view.Get(ctx, id, service, typ, namespace)
+}
+
+func (t *memTx) List(ctx context.Context, service, typ, namespace string) ([]Resource, error) {
+	return t.view.List(ctx, service, typ, namespace)
+}
+
+func (t *memTx) Query(ctx context.Context, q Query) (Page, error) {
+	return t.view.Query(ctx, q)
+}
+
+func (t *memTx) Mutate(ctx context.Context, id, service, typ, namespace string, fn func(r *Resource) error) (*Resource, error) {
+	r, err := t.view.Mutate(ctx, id, service, typ, namespace, fn)
+	if err != nil {
+		return nil, err
+	}
+	saved := cloneResource(*r)
+	t.ops = append(t.ops, func(s *MemoryStore) { s.data[memKey{saved.Namespace, saved.ID}] = saved })
+	return r, nil
+}
+
+func (t *memTx) Delete(ctx context.Context, id, service, typ, namespace string) error {
+	t.view.Delete(ctx, id, service, typ, namespace)
+	t.ops = append(t.ops, func(s *MemoryStore) { s.delete(id, service, typ, namespace) })
+	return nil
+}
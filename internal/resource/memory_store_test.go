@@ -0,0 +1,55 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package resource_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"opensnack/internal/resource"
+	"opensnack/internal/resource/storetest"
+)
+
+func TestMemoryStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) resource.Store {
+		return resource.NewMemoryStore()
+	})
+}
+
+func TestMemoryStore_Concurrent(t *testing.T) {
+	s := resource.NewMemoryStore()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				id := fmt.Sprintf("w%d-%d", w, i)
+				s.Create(t.Context(), &resource.Resource{ID: id, Namespace: "ns", Service: "sqs", Type: "message", Attributes: []byte(`{}`)})
+				if r, err := s.Get(t.Context(), id, "sqs", "message", "ns"); err == nil {
+					// Returned resources are copies.
+					r.Attributes[0] = 'x'
+				}
+				s.List(t.Context(), "sqs", "message", "ns")
+				s.Transaction(t.Context(), func(tx resource.Store) error {
+					return tx.Update(t.Context(), &resource.Resource{ID: id, Namespace: "ns", Attributes: []byte(`{"n":1}`)})
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	list, _ := s.List(t.Context(), "sqs", "message", "ns")
+	if len(list) != 400 || s.Len() != 400 {
+		t.Fatalf("expected 400 resources, got %d", len(list))
+	}
+	for _, r := range list {
+		if string(r.Attributes) != `{"n":1}` {
+			t.Fatalf("unexpected attributes for %s: %s", r.ID, r.Attributes)
+		}
+	}
+}
@@ -13,4 +13,6 @@ type Resource struct {
 	Type       string `gorm:"index; not null"`
 	Attributes []byte `gorm:"type:jsonb; not null"`
 	CreatedAt  time.Time
+	// Revision starts at 1 and is bumped by every write; see Mutate.
+	Revision int64 `gorm:"not null"`
 }
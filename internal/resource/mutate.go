@@ -0,0 +1,70 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package resource
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+//
+// OPTIMISTIC CONCURRENCY
+//
+// Every write bumps Resource.Revision. Mutate reads a resource, lets the
+// caller change it, and writes it back only if the revision is still the
+// one it read; if another writer got there first it reads the new copy
+// and calls fn again. Handlers that read, change and write a resource go
+// through Mutate so parallel clients (Terraform with -parallelism > 1)
+// cannot lose each other's updates.
+//
+
+// ErrConflict is returned by Mutate when the resource kept changing
+// underneath it for mutateAttempts tries.
+var ErrConflict = errors.New("resource was modified concurrently")
+
+// mutateAttempts bounds how often Mutate retries fn on conflict.
+const mutateAttempts = 32
+
+// swapFunc writes res if the stored copy is still at revision rev. It
+// reports false, and writes nothing, if the revision has moved on or the
+// resource is gone.
+type swapFunc func(res *Resource, rev int64) (bool, error)
+
+// mutate is the retry loop behind every store's Mutate. Only Attributes
+// and CreatedAt changes made by fn are written; the ID, namespace,
+// service and type of a resource are fixed.
+func mutate(ctx context.Context, s Store, id, service, typ, namespace string,
+	fn func(r *Resource) error, swap swapFunc) (*Resource, error) {
+	for attempt := range mutateAttempts {
+		if attempt > 0 {
+			// Back off a little, with jitter, so retries of the same
+			// hot resource do not stay in lockstep.
+			time.Sleep(time.Duration(rand.Int64N(int64(attempt)*int64(100*time.Microsecond) + 1)))
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		r, err := s.Get(ctx, id, service, typ, namespace)
+		if err != nil {
+			return nil, err
+		}
+		rev := r.Revision
+		if err := fn(r); err != nil {
+			return nil, err
+		}
+		r.ID, r.Service, r.Type, r.Namespace = id, service, typ, namespace
+		r.Revision = rev + 1
+		ok, err := swap(r, rev)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return r, nil
+		}
+	}
+	return nil, ErrConflict
+}
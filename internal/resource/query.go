@@ -0,0 +1,168 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package resource
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+//
+// QUERIES
+//
+// A Query selects resources of one service, type and namespace, like
+// List, and can narrow them further by ID prefix and by attribute
+// values. Results come back in ID order (byte order, whatever the
+// database collation), a page at a time: Page.Next is an opaque cursor
+// that continues after the last resource returned, so handlers can hand
+// it straight to clients as a NextToken or Marker.
+//
+
+type Query struct {
+	Service   string
+	Type      string
+	Namespace string
+
+	// IDPrefix keeps resources whose ID starts with it.
+	IDPrefix string
+
+	// StartID keeps resources whose ID sorts at or after it, for APIs
+	// whose markers name the first resource of the next page.
+	StartID string
+
+	// Match keeps resources whose attributes contain this document, as
+	// the Postgres jsonb @> operator defines it: every key in Match must
+	// be present with a matching value, objects are matched recursively
+	// and an array matches if it contains every element listed. For
+	// example {"zone_id": "Z1"} selects the records of one hosted zone.
+	Match map[string]any
+
+	// Limit caps the page size; 0 returns every match.
+	Limit int
+
+	// Cursor continues from a previous Page.Next.
+	Cursor string
+}
+
+type Page struct {
+	Resources []Resource
+	// Next is the cursor for the following page, or empty if this page
+	// is the last.
+	Next string
+}
+
+// ErrInvalidCursor is returned for a Query.Cursor this package did not
+// produce.
+var ErrInvalidCursor = errors.New("invalid pagination token")
+
+// EncodeCursor returns the cursor that continues after id.
+func EncodeCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("id:" + id))
+}
+
+// DecodeCursor returns the ID a cursor continues after.
+func DecodeCursor(cursor string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), "id:") {
+		return "", ErrInvalidCursor
+	}
+	return string(raw[3:]), nil
+}
+
+// FilterPage applies a Query to resources already narrowed to its
+// service, type and namespace. Stores that cannot push queries down to
+// their storage, and test doubles, implement Query with it.
+func FilterPage(list []Resource, q Query) (Page, error) {
+	after := ""
+	if q.Cursor != "" {
+		var err error
+		if after, err = DecodeCursor(q.Cursor); err != nil {
+			return Page{}, err
+		}
+	}
+	matches, err := attributeMatcher(q.Match)
+	if err != nil {
+		return Page{}, err
+	}
+
+	var out []Resource
+	for _, r := range list {
+		if !strings.HasPrefix(r.ID, q.IDPrefix) || r.ID < q.StartID ||
+			(q.Cursor != "" && r.ID <= after) || !matches(r.Attributes) {
+			continue
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return pageOf(out, q.Limit), nil
+}
+
+// attributeMatcher returns a test for attributes containing match.
+func attributeMatcher(match map[string]any) (func(attrs []byte) bool, error) {
+	if len(match) == 0 {
+		return func([]byte) bool { return true }, nil
+	}
+	// Round-trip so match compares like decoded attributes do.
+	buf, err := json.Marshal(match)
+	if err != nil {
+		return nil, err
+	}
+	var pattern any
+	json.Unmarshal(buf, &pattern)
+	return func(attrs []byte) bool {
+		var doc any
+		return json.Unmarshal(attrs, &doc) == nil && jsonContains(doc, pattern)
+	}, nil
+}
+
+// pageOf trims resources fetched with one extra row to limit.
+func pageOf(list []Resource, limit int) Page {
+	if limit <= 0 || len(list) <= limit {
+		return Page{Resources: list}
+	}
+	list = list[:limit]
+	return Page{Resources: list, Next: EncodeCursor(list[limit-1].ID)}
+}
+
+// jsonContains reports whether doc contains pattern, following jsonb @>.
+func jsonContains(doc, pattern any) bool {
+	switch p := pattern.(type) {
+	case map[string]any:
+		d, ok := doc.(map[string]any)
+		if !ok {
+			return false
+		}
+		for k, pv := range p {
+			dv, ok := d[k]
+			if !ok || !jsonContains(dv, pv) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		d, ok := doc.([]any)
+		if !ok {
+			return false
+		}
+		for _, pv := range p {
+			found := false
+			for _, dv := range d {
+				if jsonContains(dv, pv) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	default:
+		return doc == pattern
+	}
+}
@@ -4,10 +4,33 @@
 
 package resource
 
+import "context"
+
 type Store interface {
-	Create(res *Resource) error
-	Update(res *Resource) error
-	Get(id, service, typ, namespace string) (*Resource, error)
-	List(service, typ, namespace string) ([]Resource, error)
-	Delete(id, service, typ, namespace string) error
+	Create(ctx context.Context, res *Resource) error
+	Update(ctx context.Context, res *Resource) error
+	Get(ctx context.Context, id, service, typ, namespace string) (*Resource, error)
+	List(ctx context.Context, service, typ, namespace string) ([]Resource, error)
+	Delete(ctx context.Context, id, service, typ, namespace string) error
+	// Query returns one page of the resources a Query selects, ordered
+	// by ID.
+	Query(ctx context.Context, q Query) (Page, error)
+	// Mutate applies fn to the current copy of a resource and saves the
+	// result unless another write got in first, in which case fn runs
+	// again on the newer copy. An error from fn aborts without writing.
+	// It returns the saved resource.
+	Mutate(ctx context.Context, id, service, typ, namespace string, fn func(r *Resource) error) (*Resource, error)
+}
+
+// Transactor is implemented by stores that can apply several writes
+// atomically. fn receives a Store bound to the transaction; returning an
+// error from fn rolls every write back.
+type Transactor interface {
+	Transaction(ctx context.Context, fn func(tx Store) error) error
+}
+
+// NamespaceLister is implemented by stores that can report which
+// namespaces hold resources of a service and type.
+type NamespaceLister interface {
+	Namespaces(ctx context.Context, service, typ string) ([]string, error)
 }
@@ -0,0 +1,463 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package storetest is the conformance suite every resource.Store
+// backend must pass.
+package storetest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"opensnack/internal/resource"
+)
+
+// Run runs the suite. newStore returns an empty store; it is called once
+// per subtest.
+func Run(t *testing.T, newStore func(t *testing.T) resource.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s resource.Store)
+	}{
+		{"CreateGet", testCreateGet},
+		{"CreateDuplicate", testCreateDuplicate},
+		{"Update", testUpdate},
+		{"Mutate", testMutate},
+		{"MutateConcurrent", testMutateConcurrent},
+		{"List", testList},
+		{"Query", testQuery},
+		{"QueryPaging", testQueryPaging},
+		{"Delete", testDelete},
+		{"Transaction", testTransaction},
+		{"Namespaces", testNamespaces},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func res(id, ns, service, typ, attrs string) *resource.Resource {
+	return &resource.Resource{ID: id, Namespace: ns, Service: service, Type: typ, Attributes: []byte(attrs)}
+}
+
+func mustCreate(t *testing.T, s resource.Store, r *resource.Resource) {
+	t.Helper()
+	if err := s.Create(t.Context(), r); err != nil {
+		t.Fatalf("Create %s/%s: %v", r.Namespace, r.ID, err)
+	}
+}
+
+// sameJSON compares attributes semantically; Postgres jsonb does not
+// keep key order or whitespace.
+func sameJSON(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+	var a, b any
+	if err := json.Unmarshal(got, &a); err != nil {
+		t.Fatalf("stored attributes are not JSON: %s", got)
+	}
+	json.Unmarshal([]byte(want), &b)
+	return reflect.DeepEqual(a, b)
+}
+
+func ids(list []resource.Resource) []string {
+	var out []string
+	for _, r := range list {
+		out = append(out, r.ID)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func testCreateGet(t *testing.T, s resource.Store) {
+	mustCreate(t, s, res("q1", "ns1", "sqs", "queue", `{"b": 2, "a": [1, "x"]}`))
+
+	got, err := s.Get(t.Context(), "q1", "sqs", "queue", "ns1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.ID != "q1" || got.Namespace != "ns1" || got.Service != "sqs" || got.Type != "queue" {
+		t.Fatalf("unexpected resource: %+v", got)
+	}
+	if !sameJSON(t, got.Attributes, `{"a": [1, "x"], "b": 2}`) {
+		t.Fatalf("unexpected attributes: %s", got.Attributes)
+	}
+	if got.CreatedAt.IsZero() {
+		t.Fatal("expected CreatedAt to be set")
+	}
+
+	for _, miss := range [][4]string{
+		{"q2", "sqs", "queue", "ns1"},
+		{"q1", "sns", "queue", "ns1"},
+		{"q1", "sqs", "topic", "ns1"},
+		{"q1", "sqs", "queue", "ns2"},
+	} {
+		if _, err := s.Get(t.Context(), miss[0], miss[1], miss[2], miss[3]); err == nil {
+			t.Fatalf("expected Get%v to fail", miss)
+		}
+	}
+}
+
+func testCreateDuplicate(t *testing.T, s resource.Store) {
+	mustCreate(t, s, res("b1", "ns1", "s3", "bucket", `{}`))
+	if err := s.Create(t.Context(), res("b1", "ns1", "s3", "bucket", `{"again": true}`)); !errors.Is(err, resource.ErrDuplicate) {
+		t.Fatalf("expected a duplicate Create to fail with ErrDuplicate, got %v", err)
+	}
+	// IDs are unique per namespace only.
+	mustCreate(t, s, res("b1", "ns2", "s3", "bucket", `{}`))
+
+	got, err := s.Get(t.Context(), "b1", "s3", "bucket", "ns1")
+	if err != nil || !sameJSON(t, got.Attributes, `{}`) {
+		t.Fatalf("duplicate Create changed the original: %+v %v", got, err)
+	}
+}
+
+func testUpdate(t *testing.T, s resource.Store) {
+	mustCreate(t, s, res("k1", "ns1", "kms", "key", `{"state": "Enabled"}`))
+	created, _ := s.Get(t.Context(), "k1", "kms", "key", "ns1")
+
+	if err := s.Update(t.Context(), res("k1", "ns1", "kms", "key", `{"state": "Disabled", "n": 1}`)); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got, err := s.Get(t.Context(), "k1", "kms", "key", "ns1")
+	if err != nil {
+		t.Fatalf("Get after Update: %v", err)
+	}
+	if !sameJSON(t, got.Attributes, `{"n": 1, "state": "Disabled"}`) {
+		t.Fatalf("unexpected attributes after Update: %s", got.Attributes)
+	}
+	if !got.CreatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("Update changed CreatedAt from %v to %v", created.CreatedAt, got.CreatedAt)
+	}
+	if created.Revision != 1 || got.Revision != 2 {
+		t.Fatalf("expected revisions 1 then 2, got %d then %d", created.Revision, got.Revision)
+	}
+}
+
+// increment is a Mutate fn that adds one to the "n" attribute.
+func increment(r *resource.Resource) error {
+	var attrs struct{ N int }
+	if err := json.Unmarshal(r.Attributes, &attrs); err != nil {
+		return err
+	}
+	r.Attributes = []byte(fmt.Sprintf(`{"n": %d}`, attrs.N+1))
+	return nil
+}
+
+func testMutate(t *testing.T, s resource.Store) {
+	mustCreate(t, s, res("p1", "ns1", "ssm", "parameter", `{"n": 1}`))
+
+	got, err := s.Mutate(t.Context(), "p1", "ssm", "parameter", "ns1", increment)
+	if err != nil {
+		t.Fatalf("Mutate: %v", err)
+	}
+	if !sameJSON(t, got.Attributes, `{"n": 2}`) || got.Revision != 2 {
+		t.Fatalf("unexpected result: %s at revision %d", got.Attributes, got.Revision)
+	}
+	if stored, _ := s.Get(t.Context(), "p1", "ssm", "parameter", "ns1"); !sameJSON(t, stored.Attributes, `{"n": 2}`) || stored.Revision != 2 {
+		t.Fatalf("unexpected stored resource: %s at revision %d", stored.Attributes, stored.Revision)
+	}
+
+	// An error from fn writes nothing.
+	boom := errors.New("boom")
+	_, err = s.Mutate(t.Context(), "p1", "ssm", "parameter", "ns1", func(r *resource.Resource) error {
+		r.Attributes = []byte(`{"n": 100}`)
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected fn's error, got %v", err)
+	}
+	if stored, _ := s.Get(t.Context(), "p1", "ssm", "parameter", "ns1"); !sameJSON(t, stored.Attributes, `{"n": 2}`) {
+		t.Fatalf("failed Mutate wrote %s", stored.Attributes)
+	}
+
+	// A write between the read and the swap makes fn run again on the
+	// newer copy instead of being overwritten.
+	calls := 0
+	got, err = s.Mutate(t.Context(), "p1", "ssm", "parameter", "ns1", func(r *resource.Resource) error {
+		calls++
+		if calls == 1 {
+			if err := s.Update(t.Context(), res("p1", "ns1", "ssm", "parameter", `{"n": 10}`)); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+		}
+		return increment(r)
+	})
+	if err != nil {
+		t.Fatalf("Mutate: %v", err)
+	}
+	if calls != 2 || !sameJSON(t, got.Attributes, `{"n": 11}`) {
+		t.Fatalf("expected a retry ending at n=11, got %d calls and %s", calls, got.Attributes)
+	}
+
+	if _, err := s.Mutate(t.Context(), "p2", "ssm", "parameter", "ns1", increment); err == nil {
+		t.Fatal("expected Mutate of a missing resource to fail")
+	}
+	if _, err := s.Get(t.Context(), "p2", "ssm", "parameter", "ns1"); err == nil {
+		t.Fatal("Mutate of a missing resource created it")
+	}
+}
+
+// testMutateConcurrent has several writers increment one counter; none
+// of their updates may be lost.
+func testMutateConcurrent(t *testing.T, s resource.Store) {
+	mustCreate(t, s, res("c1", "ns1", "ssm", "parameter", `{"n": 0}`))
+
+	const writers, each = 8, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*each)
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range each {
+				if _, err := s.Mutate(t.Context(), "c1", "ssm", "parameter", "ns1", increment); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Mutate: %v", err)
+	}
+
+	got, err := s.Get(t.Context(), "c1", "ssm", "parameter", "ns1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if want := fmt.Sprintf(`{"n": %d}`, writers*each); !sameJSON(t, got.Attributes, want) {
+		t.Fatalf("lost updates: got %s, want %s", got.Attributes, want)
+	}
+	if got.Revision != writers*each+1 {
+		t.Fatalf("expected revision %d, got %d", writers*each+1, got.Revision)
+	}
+}
+
+func testList(t *testing.T, s resource.Store) {
+	mustCreate(t, s, res("a", "ns1", "sqs", "queue", `{}`))
+	mustCreate(t, s, res("b", "ns1", "sqs", "queue", `{}`))
+	mustCreate(t, s, res("c", "ns1", "sqs", "message", `{}`))
+	mustCreate(t, s, res("d", "ns2", "sqs", "queue", `{}`))
+	mustCreate(t, s, res("e", "ns1", "sns", "queue", `{}`))
+
+	list, err := s.List(t.Context(), "sqs", "queue", "ns1")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if got := ids(list); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("unexpected List result: %v", got)
+	}
+	list, err = s.List(t.Context(), "sqs", "queue", "empty")
+	if err != nil || len(list) != 0 {
+		t.Fatalf("expected an empty List, got %v %v", ids(list), err)
+	}
+}
+
+func testQuery(t *testing.T, s resource.Store) {
+	mustCreate(t, s, res("Z1/www.example.com./A", "ns1", "route53", "record", `{"zone_id": "Z1", "type": "A", "tags": {"env": "prod", "team": "web"}}`))
+	mustCreate(t, s, res("Z1/mail.example.com./MX", "ns1", "route53", "record", `{"zone_id": "Z1", "type": "MX", "values": ["10 mx1", "20 mx2"]}`))
+	mustCreate(t, s, res("Z2/www.example.org./A", "ns1", "route53", "record", `{"zone_id": "Z2", "type": "A", "tags": {"env": "dev"}}`))
+	mustCreate(t, s, res("Z1_/odd./A", "ns1", "route53", "record", `{"zone_id": "Z1_", "type": "A"}`))
+	mustCreate(t, s, res("Z1/www.example.com./A", "ns2", "route53", "record", `{"zone_id": "Z1", "type": "A"}`))
+
+	for _, tt := range []struct {
+		name string
+		q    resource.Query
+		want []string
+	}{
+		{"All", resource.Query{}, []string{"Z1/mail.example.com./MX", "Z1/www.example.com./A", "Z1_/odd./A", "Z2/www.example.org./A"}},
+		{"Prefix", resource.Query{IDPrefix: "Z1/"}, []string{"Z1/mail.example.com./MX", "Z1/www.example.com./A"}},
+		// LIKE wildcards in a prefix are literal.
+		{"PrefixWildcard", resource.Query{IDPrefix: "Z1_"}, []string{"Z1_/odd./A"}},
+		{"PrefixNone", resource.Query{IDPrefix: "Z3/"}, nil},
+		{"Match", resource.Query{Match: map[string]any{"zone_id": "Z1"}}, []string{"Z1/mail.example.com./MX", "Z1/www.example.com./A"}},
+		{"MatchSeveral", resource.Query{Match: map[string]any{"zone_id": "Z1", "type": "A"}}, []string{"Z1/www.example.com./A"}},
+		{"MatchNested", resource.Query{Match: map[string]any{"tags": map[string]any{"env": "prod"}}}, []string{"Z1/www.example.com./A"}},
+		{"MatchArray", resource.Query{Match: map[string]any{"values": []any{"20 mx2"}}}, []string{"Z1/mail.example.com./MX"}},
+		{"MatchMissing", resource.Query{Match: map[string]any{"zone_id": "Z9"}}, nil},
+		{"PrefixAndMatch", resource.Query{IDPrefix: "Z1", Match: map[string]any{"type": "A"}}, []string{"Z1/www.example.com./A", "Z1_/odd./A"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.q
+			q.Service, q.Type, q.Namespace = "route53", "record", "ns1"
+			page, err := s.Query(t.Context(), q)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			var got []string
+			for _, r := range page.Resources {
+				got = append(got, r.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if page.Next != "" {
+				t.Fatalf("unexpected Next %q for an unlimited query", page.Next)
+			}
+		})
+	}
+}
+
+func testQueryPaging(t *testing.T, s resource.Store) {
+	for _, id := range []string{"q-07", "q-03", "Q-10", "q-01", "q-05", "q-02", "q-04", "q-06"} {
+		mustCreate(t, s, res(id, "ns1", "sqs", "queue", `{}`))
+	}
+	q := resource.Query{Service: "sqs", Type: "queue", Namespace: "ns1", IDPrefix: "q-", Limit: 3}
+
+	var got []string
+	pages := 0
+	for {
+		page, err := s.Query(t.Context(), q)
+		if err != nil {
+			t.Fatalf("Query page %d: %v", pages, err)
+		}
+		pages++
+		if len(page.Resources) > q.Limit {
+			t.Fatalf("page %d has %d resources, limit %d", pages, len(page.Resources), q.Limit)
+		}
+		for _, r := range page.Resources {
+			got = append(got, r.ID)
+		}
+		if page.Next == "" {
+			break
+		}
+		q.Cursor = page.Next
+	}
+	want := []string{"q-01", "q-02", "q-03", "q-04", "q-05", "q-06", "q-07"}
+	if !reflect.DeepEqual(got, want) || pages != 3 {
+		t.Fatalf("got %v in %d pages, want %v in 3", got, pages, want)
+	}
+
+	// A full last page does not promise another.
+	page, err := s.Query(t.Context(), resource.Query{Service: "sqs", Type: "queue", Namespace: "ns1", Limit: 8})
+	if err != nil || len(page.Resources) != 8 || page.Next != "" {
+		t.Fatalf("exact-size page: %d resources, Next %q, err %v", len(page.Resources), page.Next, err)
+	}
+	// IDs sort in byte order, so upper case comes first.
+	if page.Resources[0].ID != "Q-10" {
+		t.Fatalf("expected byte order, got %s first", page.Resources[0].ID)
+	}
+
+	// StartID is inclusive and need not name an existing resource.
+	page, err = s.Query(t.Context(), resource.Query{Service: "sqs", Type: "queue", Namespace: "ns1", StartID: "q-04", Limit: 2})
+	if err != nil || !reflect.DeepEqual(ids(page.Resources), []string{"q-04", "q-05"}) {
+		t.Fatalf("page from q-04: %v %v", ids(page.Resources), err)
+	}
+	page, err = s.Query(t.Context(), resource.Query{Service: "sqs", Type: "queue", Namespace: "ns1", StartID: "q-065"})
+	if err != nil || !reflect.DeepEqual(ids(page.Resources), []string{"q-07"}) {
+		t.Fatalf("page from q-065: %v %v", ids(page.Resources), err)
+	}
+
+	// A cursor stays valid after the resource it names is deleted.
+	page, _ = s.Query(t.Context(), resource.Query{Service: "sqs", Type: "queue", Namespace: "ns1", IDPrefix: "q-", Limit: 2})
+	if err := s.Delete(t.Context(), "q-02", "sqs", "queue", "ns1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	page, err = s.Query(t.Context(), resource.Query{Service: "sqs", Type: "queue", Namespace: "ns1", IDPrefix: "q-", Limit: 2, Cursor: page.Next})
+	if err != nil || len(page.Resources) != 2 || page.Resources[0].ID != "q-03" {
+		t.Fatalf("page after a deleted cursor: %v %v", ids(page.Resources), err)
+	}
+
+	_, err = s.Query(t.Context(), resource.Query{Service: "sqs", Type: "queue", Namespace: "ns1", Cursor: "not a cursor"})
+	if !errors.Is(err, resource.ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func testDelete(t *testing.T, s resource.Store) {
+	mustCreate(t, s, res("t1", "ns1", "sns", "topic", `{}`))
+
+	// The service and type must match.
+	if err := s.Delete(t.Context(), "t1", "sns", "subscription", "ns1"); err != nil {
+		t.Fatalf("Delete with the wrong type: %v", err)
+	}
+	if _, err := s.Get(t.Context(), "t1", "sns", "topic", "ns1"); err != nil {
+		t.Fatal("Delete with the wrong type removed the resource")
+	}
+
+	if err := s.Delete(t.Context(), "t1", "sns", "topic", "ns1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(t.Context(), "t1", "sns", "topic", "ns1"); err == nil {
+		t.Fatal("expected Get after Delete to fail")
+	}
+	if list, _ := s.List(t.Context(), "sns", "topic", "ns1"); len(list) != 0 {
+		t.Fatalf("deleted resource still listed: %v", ids(list))
+	}
+	if err := s.Delete(t.Context(), "t1", "sns", "topic", "ns1"); err != nil {
+		t.Fatalf("deleting a missing resource: %v", err)
+	}
+
+	// The ID can be reused once deleted.
+	mustCreate(t, s, res("t1", "ns1", "sns", "topic", `{}`))
+}
+
+func testTransaction(t *testing.T, s resource.Store) {
+	txr, ok := s.(resource.Transactor)
+	if !ok {
+		t.Skip("store does not implement resource.Transactor")
+	}
+	mustCreate(t, s, res("i1", "ns1", "dynamodb", "item", `{"v": 1}`))
+
+	err := txr.Transaction(t.Context(), func(tx resource.Store) error {
+		if err := tx.Create(t.Context(), res("i2", "ns1", "dynamodb", "item", `{"v": 2}`)); err != nil {
+			return err
+		}
+		return tx.Update(t.Context(), res("i1", "ns1", "dynamodb", "item", `{"v": 10}`))
+	})
+	if err != nil {
+		t.Fatalf("Transaction: %v", err)
+	}
+	if list, _ := s.List(t.Context(), "dynamodb", "item", "ns1"); len(list) != 2 {
+		t.Fatalf("committed transaction not visible: %v", ids(list))
+	}
+
+	boom := errors.New("boom")
+	err = txr.Transaction(t.Context(), func(tx resource.Store) error {
+		tx.Create(t.Context(), res("i3", "ns1", "dynamodb", "item", `{}`))
+		tx.Update(t.Context(), res("i1", "ns1", "dynamodb", "item", `{"v": 99}`))
+		tx.Delete(t.Context(), "i2", "dynamodb", "item", "ns1")
+		// Writes are visible inside the transaction.
+		if _, err := tx.Get(t.Context(), "i3", "dynamodb", "item", "ns1"); err != nil {
+			t.Errorf("write not visible inside the transaction: %v", err)
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected the transaction error, got %v", err)
+	}
+	got, _ := s.Get(t.Context(), "i1", "dynamodb", "item", "ns1")
+	if list, _ := s.List(t.Context(), "dynamodb", "item", "ns1"); !reflect.DeepEqual(ids(list), []string{"i1", "i2"}) ||
+		got == nil || !sameJSON(t, got.Attributes, `{"v": 10}`) {
+		t.Fatalf("rolled back transaction left changes: %v %+v", ids(list), got)
+	}
+}
+
+func testNamespaces(t *testing.T, s resource.Store) {
+	nl, ok := s.(resource.NamespaceLister)
+	if !ok {
+		t.Skip("store does not implement resource.NamespaceLister")
+	}
+	mustCreate(t, s, res("t1", "ns1", "dynamodb", "table", `{}`))
+	mustCreate(t, s, res("t2", "ns1", "dynamodb", "table", `{}`))
+	mustCreate(t, s, res("t1", "ns2", "dynamodb", "table", `{}`))
+	mustCreate(t, s, res("i1", "ns3", "dynamodb", "item", `{}`))
+
+	got, err := nl.Namespaces(t.Context(), "dynamodb", "table")
+	if err != nil {
+		t.Fatalf("Namespaces: %v", err)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, []string{"ns1", "ns2"}) {
+		t.Fatalf("unexpected namespaces: %v", got)
+	}
+}
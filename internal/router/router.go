@@ -5,6 +5,7 @@
 package router
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
@@ -23,9 +24,24 @@ import (
 	"opensnack/internal/api/sqs"
 	"opensnack/internal/api/ssm"
 	"opensnack/internal/api/sts"
+	"opensnack/internal/config"
 	"opensnack/internal/resource"
+
+	"go.uber.org/zap"
 )
 
+// New serves every service, configured from the environment alone as in
+// tests. An invalid setting is logged and the defaults used instead.
+// Background work stops when ctx is done.
+func New(ctx context.Context, store resource.Store) http.Handler {
+	cfg, err := config.FromEnv()
+	if err != nil {
+		zap.S().Warnf("invalid configuration, using defaults: %v", err)
+		cfg = config.Default()
+	}
+	return NewWithConfig(ctx, store, cfg)
+}
+
 // IMPORTANT:
 // S3 REST routing must match AWS behavior:
 //
@@ -39,18 +55,27 @@ import (
 // ?location has NO VALUE in AWS requests (it's literally '?location')
 // So QueryParam("location") == "" but the parameter *exists*.
 // We must check for existence, not value.
-func New(store resource.Store) http.Handler {
+//
+// Background work, such as the DynamoDB TTL reaper, runs until ctx is
+// done.
+func NewWithConfig(ctx context.Context, store resource.Store, cfg *config.Config) http.Handler {
 	mux := http.NewServeMux()
 
 	s3h := s3.NewHandler(store)
+	s3h.ObjectRoot = cfg.Storage.ObjectRoot
 	sqsh := sqs.NewHandler(store)
 	snsh := sns.NewHandler(store)
+	snsh.Queues = sqsh
 	stsh := sts.NewHandler()
 	iamh := iam.NewHandler(store)
 	logsh := logs.NewHandler(store)
 	lambdah := lambda.NewHandler(store)
 	s3ctl := s3control.NewHandler(store)
 	dynamoh := dynamodb.NewHandler(store)
+	dynamoh.Objects = s3h
+	if interval := cfg.DynamoDB.TTLInterval; interval > 0 && cfg.ServiceEnabled("dynamodb") {
+		go dynamoh.RunTTLReaper(ctx, interval)
+	}
 	kmsh := kms.NewHandler(store)
 	ec2h := ec2.NewHandler(store)
 	elasticacheh := elasticache.NewHandler(store)
@@ -58,8 +83,34 @@ func New(store resource.Store) http.Handler {
 	ssmh := ssm.NewHandler(store)
 	route53h := route53.NewHandler(store)
 
-	// Apply middleware
-	handler := DebugLoggerMiddleware(SigV4Middleware(mux))
+	// Each service's handler, by SigV4 signing name.
+	services := map[string]http.HandlerFunc{
+		"s3":             s3Handler(s3h),
+		"s3control":      s3ctl.ListTagsForResource,
+		"sts":            allow(stsh.Dispatch, "GET", "POST"),
+		"iam":            allow(iamh.Dispatch, "GET", "POST"),
+		"lambda":         lambdaHandler(lambdah),
+		"sqs":            allow(sqsh.Dispatch, "POST"),
+		"sns":            allow(snsh.Dispatch, "GET", "POST"), // GET for SubscribeURL and UnsubscribeURL
+		"logs":           allow(logsh.Dispatch, "POST"),
+		"dynamodb":       allow(dynamoh.Dispatch, "POST"), // and DynamoDB Streams
+		"kms":            allow(kmsh.Dispatch, "POST"),
+		"ec2":            allow(ec2h.Dispatch, "GET", "POST"),
+		"elasticache":    allow(elasticacheh.Dispatch, "GET", "POST"),
+		"secretsmanager": allow(secretsmanagerh.Dispatch, "POST"),
+		"ssm":            allow(ssmh.Dispatch, "POST"),
+		"route53":        route53Handler(route53h),
+	}
+	for _, name := range cfg.Services {
+		if _, ok := services[name]; !ok {
+			zap.S().Warnf("unknown service %q in the enabled services", name)
+		}
+	}
+	for name := range services {
+		if !cfg.ServiceEnabled(name) {
+			services[name] = disabled(name)
+		}
+	}
 
 	// Helper to parse form values
 	parseForm := func(r *http.Request) {
@@ -91,14 +142,14 @@ func New(store resource.Store) http.Handler {
 			if r.Method == "GET" {
 				action := getFormValue(r, "Action")
 				if action != "" {
-					queryDispatch(w, r, stsh, iamh, sqsh, snsh)
+					queryDispatch(w, r, services)
 					return
 				}
-				s3h.ListBuckets(w, r)
+				services["s3"](w, r)
 				return
 			}
 			if r.Method == "POST" {
-				queryDispatch(w, r, stsh, iamh, sqsh, snsh)
+				queryDispatch(w, r, services)
 				return
 			}
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -106,220 +157,89 @@ func New(store resource.Store) http.Handler {
 		}
 
 		// Otherwise, delegate to S3 handler logic
-		s3Handler(s3h)(w, r)
+		services["s3"](w, r)
 	}
 
 	mux.HandleFunc("/", rootHandler)
 
-	// STS routes
-	mux.HandleFunc("/sts", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" || r.Method == "POST" {
-			stsh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	// Per-service path prefixes, as used by the endpoints block in
+	// opentofu/main.tf, still work alongside single-endpoint routing.
+	for _, route := range []struct{ pattern, service string }{
+		{"/sts", "sts"}, {"/sts/", "sts"},
+		{"/iam", "iam"}, {"/iam/", "iam"},
+		{"/s3-control/", "s3control"},
+		{"/lambda", "lambda"}, {"/lambda/", "lambda"},
+		{"/sqs", "sqs"},
+		{"/sns", "sns"},
+		{"/logs", "logs"},
+		{"/dynamodb", "dynamodb"}, {"/dynamodb/", "dynamodb"},
+		{"/dynamodbstreams", "dynamodb"},
+		{"/kms", "kms"}, {"/kms/", "kms"},
+		{"/ec2", "ec2"}, {"/ec2/", "ec2"},
+		{"/elasticache", "elasticache"}, {"/elasticache/", "elasticache"},
+		{"/secretsmanager", "secretsmanager"}, {"/secretsmanager/", "secretsmanager"},
+		{"/ssm", "ssm"}, {"/ssm/", "ssm"},
+		{"/route53/", "route53"},
+	} {
+		mux.HandleFunc(route.pattern, services[route.service])
+	}
+
+	// A request that names its service is sent straight to it, whatever
+	// its path; anything else falls back to the path routes above.
+	vhosts := newS3Domains(cfg.S3Domains)
+	route := func(r *http.Request) (svc, bucket string) {
+		bucket, explicit := vhosts.bucket(r.Host)
+		if !explicit {
+			svc = serviceOf(r, services)
 		}
-	})
-	mux.HandleFunc("/sts/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" || r.Method == "POST" {
-			stsh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		if bucket != "" && (explicit || svc == "" || svc == "s3") {
+			return "s3", bucket
 		}
-	})
-
-	// IAM routes
-	mux.HandleFunc("/iam", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" || r.Method == "POST" {
-			iamh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return svc, ""
+	}
+	dispatch := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		svc, bucket := route(r)
+		if bucket != "" {
+			r = pathStyle(r, bucket)
 		}
-	})
-	mux.HandleFunc("/iam/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" || r.Method == "POST" {
-			iamh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		if h, ok := services[svc]; ok {
+			h(w, r)
+			return
 		}
+		mux.ServeHTTP(w, r)
 	})
 
-	// S3 Control routes
-	mux.HandleFunc("/s3-control/", func(w http.ResponseWriter, r *http.Request) {
-		s3ctl.ListTagsForResource(w, r)
-	})
+	verifier := SigV4FromConfig(cfg.Auth, iamh)
+	verifier.SNS = snsh
+	verifier.Service = func(r *http.Request) string {
+		svc, _ := route(r)
+		return svc
+	}
+	return DebugLoggerMiddleware(verifier.Middleware(withScope(cfg, dispatch)))
+}
 
-	// Lambda routes - must come before S3 wildcard routes
-	mux.HandleFunc("/lambda", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			lambdah.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-	mux.HandleFunc("/lambda/", lambdaHandler(lambdah))
-
-	// SQS routes
-	mux.HandleFunc("/sqs", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			// Check for JSON API format first
-			target := r.Header.Get("X-Amz-Target")
-			if target != "" && strings.HasPrefix(target, "AmazonSQS.") {
-				sqsh.Dispatch(w, r)
-				return
-			}
-			// Check for Query API format
-			parseForm(r)
-			version := getFormValue(r, "Version")
-			action := getFormValue(r, "Action")
-			if version == sqs.APIVersion || isSQSAction(action) {
-				sqsh.Dispatch(w, r)
+// allow serves h for the given methods and answers 405 to the rest.
+func allow(h http.HandlerFunc, methods ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range methods {
+			if r.Method == m {
+				h(w, r)
 				return
 			}
-			sqsh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-
-	// SNS routes
-	mux.HandleFunc("/sns", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			snsh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-
-	// CloudWatch Logs routes
-	mux.HandleFunc("/logs", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			logsh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-
-	// DynamoDB routes
-	mux.HandleFunc("/dynamodb", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			dynamoh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-	mux.HandleFunc("/dynamodb/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			dynamoh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-
-	// KMS routes
-	mux.HandleFunc("/kms", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			kmsh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-	mux.HandleFunc("/kms/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			kmsh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-
-	// EC2 routes
-	mux.HandleFunc("/ec2", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" || r.Method == "POST" {
-			ec2h.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-	mux.HandleFunc("/ec2/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" || r.Method == "POST" {
-			ec2h.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-
-	// ElastiCache routes
-	mux.HandleFunc("/elasticache", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" || r.Method == "POST" {
-			elasticacheh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	})
-	mux.HandleFunc("/elasticache/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" || r.Method == "POST" {
-			elasticacheh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-
-	// SecretsManager routes
-	mux.HandleFunc("/secretsmanager", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			secretsmanagerh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-	mux.HandleFunc("/secretsmanager/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			secretsmanagerh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-
-	// SSM routes
-	mux.HandleFunc("/ssm", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			ssmh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-	mux.HandleFunc("/ssm/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			ssmh.Dispatch(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
 
-	// Route53 routes - REST API format: /route53/2013-04-01/hostedzone
-	mux.HandleFunc("/route53/", route53Handler(route53h))
-
-	// // RDS routes
-	// mux.HandleFunc("/rds", func(w http.ResponseWriter, r *http.Request) {
-	// 	if r.Method == "GET" || r.Method == "POST" {
-	// 		rdsh.Dispatch(w, r)
-	// 	} else {
-	// 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	// 	}
-	// })
-	// mux.HandleFunc("/rds/", func(w http.ResponseWriter, r *http.Request) {
-	// 	if r.Method == "GET" || r.Method == "POST" {
-	// 		rdsh.Dispatch(w, r)
-	// 	} else {
-	// 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	// 	}
-	// })
-
-	// S3 routes are handled by rootHandler above
-
-	return handler
+// disabled answers requests for a service left out of the configured
+// services.
+func disabled(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Service "+name+" is not enabled", http.StatusNotImplemented)
+	}
 }
 
-func queryDispatch(w http.ResponseWriter, r *http.Request, stsh *sts.Handler, iamh *iam.Handler, sqsh *sqs.Handler, snsh *sns.Handler) {
+func queryDispatch(w http.ResponseWriter, r *http.Request, services map[string]http.HandlerFunc) {
 	r.ParseForm()
 	action := r.FormValue("Action")
 	if action == "" {
@@ -327,16 +247,9 @@ func queryDispatch(w http.ResponseWriter, r *http.Request, stsh *sts.Handler, ia
 		return
 	}
 
-	version := r.FormValue("Version")
-	switch version {
-	case sts.APIVersion:
-		stsh.Dispatch(w, r)
-	case iam.APIVersion:
-		iamh.Dispatch(w, r)
-	case sqs.APIVersion:
-		sqsh.Dispatch(w, r)
-	case sns.APIVersion:
-		snsh.Dispatch(w, r)
+	switch version := r.FormValue("Version"); version {
+	case sts.APIVersion, iam.APIVersion, sqs.APIVersion, sns.APIVersion:
+		services[queryVersions[version]](w, r)
 	default:
 		w.WriteHeader(http.StatusBadRequest)
 	}
@@ -526,8 +439,15 @@ func isSQSAction(action string) bool {
 		"GetQueueUrl",
 		"DeleteQueue",
 		"SendMessage",
+		"SendMessageBatch",
 		"ReceiveMessage",
 		"DeleteMessage",
+		"DeleteMessageBatch",
+		"ChangeMessageVisibility",
+		"PurgeQueue",
+		"ListDeadLetterSourceQueues",
+		"StartMessageMoveTask",
+		"ListMessageMoveTasks",
 		"GetQueueAttributes",
 		"SetQueueAttributes",
 	}
@@ -5,65 +5,33 @@
 package router_test
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
 
 	"opensnack/internal/api/s3"
+	"opensnack/internal/config"
 	"opensnack/internal/resource"
 	"opensnack/internal/router"
 
-	"github.com/labstack/echo/v4"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 )
 
-type MockStore struct {
-	data map[string]resource.Resource
-}
-
-func NewMockStore() *MockStore { return &MockStore{data: map[string]resource.Resource{}} }
-
-func (m *MockStore) Create(r *resource.Resource) error {
-	m.data[r.Namespace+"|"+r.ID] = *r
-	return nil
-}
-
-func (m *MockStore) Update(r *resource.Resource) error {
-	m.data[r.Namespace+"|"+r.ID] = *r
-	return nil
-}
-
-func (m *MockStore) Get(id, service, typ, namespace string) (*resource.Resource, error) {
-	r, ok := m.data[namespace+"|"+id]
-	if !ok {
-		return nil, echo.NewHTTPError(404)
-	}
-	return &r, nil
-}
-
-func (m *MockStore) List(service, typ, namespace string) ([]resource.Resource, error) {
-	var out []resource.Resource
-	for _, v := range m.data {
-		if v.Service == service && v.Type == typ && v.Namespace == namespace {
-			out = append(out, v)
-		}
-	}
-	return out, nil
-}
-
-func (m *MockStore) Delete(id, service, typ, namespace string) error {
-	delete(m.data, namespace+"|"+id)
-	return nil
-}
-
 // ───────────────────────────────────────────────────────────
 // ROUTING TESTS
 // ───────────────────────────────────────────────────────────
 
 func TestRouter_ListBucketsRoute(t *testing.T) {
-	store := NewMockStore()
-	e := router.New(store)
+	store := resource.NewMemoryStore()
+	e := router.New(t.Context(), store)
 
 	req := httptest.NewRequest("GET", "/", nil)
 	req.Header.Set("X-Opensnack-Namespace", "ns")
@@ -77,8 +45,8 @@ func TestRouter_ListBucketsRoute(t *testing.T) {
 }
 
 func TestRouter_CreateBucketRoute(t *testing.T) {
-	store := NewMockStore()
-	e := router.New(store)
+	store := resource.NewMemoryStore()
+	e := router.New(t.Context(), store)
 
 	req := httptest.NewRequest("PUT", "/abc", nil)
 	req.Header.Set("X-Opensnack-Namespace", "ns")
@@ -92,8 +60,8 @@ func TestRouter_CreateBucketRoute(t *testing.T) {
 }
 
 func TestRouter_DeleteBucketRoute(t *testing.T) {
-	store := NewMockStore()
-	e := router.New(store)
+	store := resource.NewMemoryStore()
+	e := router.New(t.Context(), store)
 
 	req := httptest.NewRequest("DELETE", "/dead", nil)
 	req.Header.Set("X-Opensnack-Namespace", "ns")
@@ -107,15 +75,15 @@ func TestRouter_DeleteBucketRoute(t *testing.T) {
 }
 
 func TestRouter_HeadBucketRoute(t *testing.T) {
-	store := NewMockStore()
-	e := router.New(store)
+	store := resource.NewMemoryStore()
+	e := router.New(t.Context(), store)
 
 	// Create bucket
 	h := s3.NewHandler(store)
 	_ = h
 	entry := s3.BucketEntry{Name: "head", CreationDate: time.Now()}
 	buf, _ := json.Marshal(entry)
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:         "head",
 		Namespace:  "ns",
 		Service:    "s3",
@@ -124,7 +92,7 @@ func TestRouter_HeadBucketRoute(t *testing.T) {
 	})
 
 	req := httptest.NewRequest("HEAD", "/head", nil)
-	req.Header.Set("X-Opensnack-Namespace", "ns")
+	req.Header.Set("User-Agent", "aws-sdk-go-v2 custom-ns")
 	rec := httptest.NewRecorder()
 
 	e.ServeHTTP(rec, req)
@@ -135,13 +103,13 @@ func TestRouter_HeadBucketRoute(t *testing.T) {
 }
 
 func TestRouter_LocationQueryRoute(t *testing.T) {
-	store := NewMockStore()
-	e := router.New(store)
+	store := resource.NewMemoryStore()
+	e := router.New(t.Context(), store)
 
 	// Create bucket
 	entry := s3.BucketEntry{Name: "loc", CreationDate: time.Now()}
 	buf, _ := json.Marshal(entry)
-	store.Create(&resource.Resource{
+	store.Create(t.Context(), &resource.Resource{
 		ID:         "loc",
 		Namespace:  "ns1",
 		Service:    "s3",
@@ -150,7 +118,7 @@ func TestRouter_LocationQueryRoute(t *testing.T) {
 	})
 
 	req := httptest.NewRequest("GET", "/loc?location", nil)
-	req.Header.Set("X-Opensnack-Namespace", "ns1")
+	req.Header.Set("User-Agent", "aws-sdk-go-v2 custom-ns1")
 	rec := httptest.NewRecorder()
 
 	e.ServeHTTP(rec, req)
@@ -162,3 +130,427 @@ func TestRouter_LocationQueryRoute(t *testing.T) {
 		t.Fatalf("unexpected body: %s", rec.Body.String())
 	}
 }
+
+// ───────────────────────────────────────────────────────────
+// SIGV4 TESTS
+// ───────────────────────────────────────────────────────────
+
+// signedQuery sends a signed Query API request and returns the response.
+func signedQuery(t *testing.T, h http.Handler, creds aws.Credentials, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	body := form.Encode()
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if creds.AccessKeyID != "" {
+		sum := sha256.Sum256([]byte(body))
+		err := v4.NewSigner().SignHTTP(t.Context(), creds, req, hex.EncodeToString(sum[:]), "iam", "us-east-1", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRouter_StrictSigV4(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth = config.Auth{SigV4: "strict", AccessKeys: map[string]string{"admin": "admin-secret"}}
+	store := resource.NewMemoryStore()
+	e := router.NewWithConfig(t.Context(), store, cfg)
+	admin := aws.Credentials{AccessKeyID: "admin", SecretAccessKey: "admin-secret"}
+	createUser := url.Values{"Action": {"CreateUser"}, "UserName": {"ci"}, "Version": {"2010-05-08"}}
+
+	if rec := signedQuery(t, e, aws.Credentials{}, createUser); rec.Code != 403 || !strings.Contains(rec.Body.String(), "MissingAuthenticationToken") {
+		t.Fatalf("expected unsigned requests to be rejected, got %d %s", rec.Code, rec.Body)
+	}
+	wrong := aws.Credentials{AccessKeyID: "admin", SecretAccessKey: "guess"}
+	if rec := signedQuery(t, e, wrong, createUser); rec.Code != 403 || !strings.Contains(rec.Body.String(), "SignatureDoesNotMatch") {
+		t.Fatalf("expected a signature mismatch, got %d %s", rec.Code, rec.Body)
+	}
+
+	// The right key still fails when the signature is too old.
+	body := createUser.Encode()
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	sum := sha256.Sum256([]byte(body))
+	if err := v4.NewSigner().SignHTTP(t.Context(), admin, req, hex.EncodeToString(sum[:]), "iam", "us-east-1", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	skewed := httptest.NewRecorder()
+	e.ServeHTTP(skewed, req)
+	if skewed.Code != 403 || !strings.Contains(skewed.Body.String(), "RequestTimeTooSkewed") {
+		t.Fatalf("expected a skewed request to be rejected, got %d %s", skewed.Code, skewed.Body)
+	}
+
+	if rec := signedQuery(t, e, admin, createUser); rec.Code != 200 {
+		t.Fatalf("CreateUser: %d %s", rec.Code, rec.Body)
+	}
+
+	// A key minted by IAM signs requests too.
+	rec := signedQuery(t, e, admin, url.Values{"Action": {"CreateAccessKey"}, "UserName": {"ci"}, "Version": {"2010-05-08"}})
+	var out struct {
+		Key struct {
+			AccessKeyId     string
+			SecretAccessKey string
+		} `xml:"CreateAccessKeyResult>AccessKey"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &out); err != nil || out.Key.AccessKeyId == "" {
+		t.Fatalf("CreateAccessKey: %d %s", rec.Code, rec.Body)
+	}
+	minted := aws.Credentials{AccessKeyID: out.Key.AccessKeyId, SecretAccessKey: out.Key.SecretAccessKey}
+	listKeys := url.Values{"Action": {"ListAccessKeys"}, "UserName": {"ci"}, "Version": {"2010-05-08"}}
+	if rec := signedQuery(t, e, minted, listKeys); rec.Code != 200 || !strings.Contains(rec.Body.String(), minted.AccessKeyID) {
+		t.Fatalf("ListAccessKeys with the minted key: %d %s", rec.Code, rec.Body)
+	}
+
+	unknown := aws.Credentials{AccessKeyID: "AKIAUNKNOWN", SecretAccessKey: "x"}
+	if rec := signedQuery(t, e, unknown, listKeys); rec.Code != 403 || !strings.Contains(rec.Body.String(), "InvalidClientTokenId") {
+		t.Fatalf("expected an unknown key to be rejected, got %d %s", rec.Code, rec.Body)
+	}
+
+	// A user cannot be deleted while it has keys, and once it is gone its
+	// keys no longer sign.
+	deleteUser := url.Values{"Action": {"DeleteUser"}, "UserName": {"ci"}, "Version": {"2010-05-08"}}
+	if rec := signedQuery(t, e, admin, deleteUser); rec.Code != 409 || !strings.Contains(rec.Body.String(), "DeleteConflict") {
+		t.Fatalf("expected DeleteUser to conflict, got %d %s", rec.Code, rec.Body)
+	}
+	if err := store.Delete(t.Context(), "ci", "iam", "user", "default"); err != nil {
+		t.Fatal(err)
+	}
+	if rec := signedQuery(t, e, minted, listKeys); rec.Code != 403 || !strings.Contains(rec.Body.String(), "InvalidClientTokenId") {
+		t.Fatalf("expected the key of a deleted user to be rejected, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+// snsQuery sends a Query API request signed for SNS.
+func snsQuery(t *testing.T, h http.Handler, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	form.Set("Version", "2010-03-31")
+	body := form.Encode()
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, sign(t, req, body, "sns"))
+	return rec
+}
+
+// subscribeEndpoint subscribes a new HTTP endpoint to a new topic and
+// returns the topic and the messages the endpoint receives, starting with
+// the subscription confirmation.
+func subscribeEndpoint(t *testing.T, h http.Handler) (topicArn string, messages <-chan map[string]any) {
+	t.Helper()
+	received := make(chan map[string]any, 10)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg map[string]any
+		json.NewDecoder(r.Body).Decode(&msg)
+		received <- msg
+	}))
+	t.Cleanup(endpoint.Close)
+
+	rec := snsQuery(t, h, url.Values{"Action": {"CreateTopic"}, "Name": {"orders"}})
+	var topic struct {
+		Arn string `xml:"CreateTopicResult>TopicArn"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &topic); err != nil || topic.Arn == "" {
+		t.Fatalf("CreateTopic: %d %s", rec.Code, rec.Body)
+	}
+	rec = snsQuery(t, h, url.Values{"Action": {"Subscribe"}, "TopicArn": {topic.Arn}, "Protocol": {"http"}, "Endpoint": {endpoint.URL}})
+	if rec.Code != 200 {
+		t.Fatalf("Subscribe: %d %s", rec.Code, rec.Body)
+	}
+	return topic.Arn, received
+}
+
+// nextMessage waits for the next message posted to an SNS endpoint.
+func nextMessage(t *testing.T, messages <-chan map[string]any) map[string]any {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for an SNS message")
+		return nil
+	}
+}
+
+func TestRouter_StrictSigV4_SNSLinks(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth = config.Auth{SigV4: "strict", AccessKeys: map[string]string{"test": "test"}}
+	e := router.NewWithConfig(t.Context(), resource.NewMemoryStore(), cfg)
+	topicArn, messages := subscribeEndpoint(t, e)
+	confirmation := nextMessage(t, messages)
+	subscribeURL, _ := confirmation["SubscribeURL"].(string)
+
+	unsigned := func(method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	form := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+
+	// Only a GET of a link SNS handed out is exempt; the same Action on
+	// any other request shape must still be signed.
+	for name, rec := range map[string]*httptest.ResponseRecorder{
+		"POST with another action in the body": unsigned("POST", "/?Action=ConfirmSubscription",
+			"Action=CreateUser&UserName=evil&Version=2010-05-08", form),
+		"S3 path": unsigned("PUT", "/evilbucket?Action=Unsubscribe", "", nil),
+		"JSON target": unsigned("POST", "/?Action=Unsubscribe", "{}",
+			map[string]string{"X-Amz-Target": "DynamoDB_20120810.ListTables", "Content-Type": "application/x-amz-json-1.0"}),
+		"other query service": unsigned("GET", "/?Action=ConfirmSubscription&Version=2010-05-08&TopicArn="+
+			url.QueryEscape(topicArn)+"&Token=x", "", nil),
+		"wrong token": unsigned("GET", "/?Action=ConfirmSubscription&Version=2010-03-31&TopicArn="+
+			url.QueryEscape(topicArn)+"&Token=guess", "", nil),
+	} {
+		if rec.Code == 200 || !strings.Contains(rec.Body.String(), "MissingAuthenticationToken") {
+			t.Errorf("%s: expected the unsigned request to be rejected, got %d %s", name, rec.Code, rec.Body)
+		}
+	}
+
+	if rec := unsigned("GET", subscribeURL, "", nil); rec.Code != 200 || !strings.Contains(rec.Body.String(), "<SubscriptionArn>") {
+		t.Fatalf("SubscribeURL: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRouter_SNSSubscribeURL(t *testing.T) {
+	for _, ns := range []string{"default", "team-a"} {
+		t.Run(ns, func(t *testing.T) {
+			e := router.New(t.Context(), resource.NewMemoryStore())
+			// The API calls are made in ns; the links are followed
+			// without naming it, as an endpoint does.
+			api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.Header.Set("User-Agent", "aws-sdk-go-v2 custom-"+ns)
+				e.ServeHTTP(w, r)
+			})
+			topicArn, messages := subscribeEndpoint(t, api)
+			confirmation := nextMessage(t, messages)
+			if confirmation["Type"] != "SubscriptionConfirmation" {
+				t.Fatalf("expected a subscription confirmation, got %v", confirmation)
+			}
+
+			// The endpoint visits SubscribeURL as a plain GET, as AWS documents.
+			subscribeURL, _ := confirmation["SubscribeURL"].(string)
+			resp := httptest.NewRecorder()
+			e.ServeHTTP(resp, httptest.NewRequest("GET", subscribeURL, nil))
+			if resp.Code != 200 || !strings.Contains(resp.Body.String(), "<SubscriptionArn>") {
+				t.Fatalf("SubscribeURL: %d %s", resp.Code, resp.Body)
+			}
+
+			if rec := snsQuery(t, api, url.Values{"Action": {"Publish"}, "TopicArn": {topicArn}, "Message": {"hello"}}); rec.Code != 200 {
+				t.Fatalf("Publish: %d %s", rec.Code, rec.Body)
+			}
+			notification := nextMessage(t, messages)
+			if notification["Type"] != "Notification" || notification["Message"] != "hello" {
+				t.Fatalf("expected the notification, got %v", notification)
+			}
+
+			// So does UnsubscribeURL, after which nothing more is delivered.
+			unsubscribeURL, _ := notification["UnsubscribeURL"].(string)
+			resp = httptest.NewRecorder()
+			e.ServeHTTP(resp, httptest.NewRequest("GET", unsubscribeURL, nil))
+			if resp.Code != 200 {
+				t.Fatalf("UnsubscribeURL: %d %s", resp.Code, resp.Body)
+			}
+			rec := snsQuery(t, api, url.Values{"Action": {"ListSubscriptionsByTopic"}, "TopicArn": {topicArn}})
+			if rec.Code != 200 || strings.Contains(rec.Body.String(), "<Endpoint>") {
+				t.Fatalf("expected the subscription to be gone: %d %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+// ───────────────────────────────────────────────────────────
+// SINGLE-ENDPOINT ROUTING TESTS
+// ───────────────────────────────────────────────────────────
+
+// sign signs req for service with throwaway credentials.
+func sign(t *testing.T, req *http.Request, body, service string) *http.Request {
+	t.Helper()
+	sum := sha256.Sum256([]byte(body))
+	creds := aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}
+	if err := v4.NewSigner().SignHTTP(t.Context(), creds, req, hex.EncodeToString(sum[:]), service, "us-east-1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestRouter_SingleEndpoint(t *testing.T) {
+	e := router.New(t.Context(), resource.NewMemoryStore())
+
+	form := func(method, target, body string) *http.Request {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+	jsonTarget := func(target string) *http.Request {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+		req.Header.Set("X-Amz-Target", target)
+		return req
+	}
+	virtualHost := form("POST", "/", "Action=DescribeInstances")
+	virtualHost.Host = "ec2.us-east-1.localhost:4566"
+
+	cases := []struct {
+		name string
+		req  *http.Request
+		want string
+	}{
+		{"target kms", jsonTarget("TrentService.ListKeys"), `"Keys"`},
+		{"target ssm", jsonTarget("AmazonSSM.DescribeParameters"), `"Parameters"`},
+		{"target dynamodb", jsonTarget("DynamoDB_20120810.ListTables"), `"TableNames"`},
+		{"scope ec2", sign(t, form("POST", "/", "Action=DescribeInstances&Version=2016-11-15"),
+			"Action=DescribeInstances&Version=2016-11-15", "ec2"), "DescribeInstancesResponse"},
+		{"version elasticache", form("POST", "/", "Action=DescribeCacheClusters&Version=2015-02-02"), "DescribeCacheClustersResponse"},
+		{"virtual host ec2", virtualHost, "DescribeInstancesResponse"},
+		{"scope route53", sign(t, httptest.NewRequest("GET", "/2013-04-01/hostedzone", nil), "", "route53"), "ListHostedZonesResponse"},
+		// A bucket may share its name with a legacy path prefix.
+		{"scope s3", sign(t, httptest.NewRequest("PUT", "/sqs", nil), "", "s3"), ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, tc.req)
+			if rec.Code != 200 || !strings.Contains(rec.Body.String(), tc.want) {
+				t.Fatalf("got %d %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRouter_S3VirtualHosts(t *testing.T) {
+	cfg := config.Default()
+	cfg.S3Domains = []string{"localhost", "127.0.0.1.nip.io"}
+	cfg.Storage.ObjectRoot = t.TempDir()
+	store := resource.NewMemoryStore()
+	e := router.NewWithConfig(t.Context(), store, cfg)
+
+	send := func(method, host, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Host = host
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, host := range []string{"photos.s3.localhost:4566", "docs.s3.eu-west-1.localhost", "assets.127.0.0.1.nip.io:4566"} {
+		if rec := send("PUT", host, "/", ""); rec.Code != 200 {
+			t.Fatalf("CreateBucket via %s: %d %s", host, rec.Code, rec.Body)
+		}
+	}
+	for _, bucket := range []string{"photos", "docs", "assets"} {
+		if _, err := store.Get(t.Context(), bucket, "s3", "bucket", "default"); err != nil {
+			t.Fatalf("bucket %s was not created: %v", bucket, err)
+		}
+	}
+
+	if rec := send("PUT", "photos.s3.localhost", "/cats/tom.txt", "meow"); rec.Code != 200 {
+		t.Fatalf("PutObject: %d %s", rec.Code, rec.Body)
+	}
+	if rec := send("GET", "photos.localhost:4566", "/cats/tom.txt", ""); rec.Code != 200 || rec.Body.String() != "meow" {
+		t.Fatalf("GetObject: %d %s", rec.Code, rec.Body)
+	}
+
+	// The service hosts themselves are not buckets.
+	if rec := send("GET", "s3.us-east-1.localhost", "/", ""); rec.Code != 200 || !strings.Contains(rec.Body.String(), "photos") {
+		t.Fatalf("ListBuckets: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRouter_EnabledServices(t *testing.T) {
+	cfg := config.Default()
+	cfg.Services = []string{"sqs"}
+	cfg.Storage.ObjectRoot = t.TempDir()
+	e := router.NewWithConfig(t.Context(), resource.NewMemoryStore(), cfg)
+
+	sqsReq := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+	sqsReq.Header.Set("X-Amz-Target", "AmazonSQS.ListQueues")
+	sqsReq.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, sqsReq)
+	if rec.Code != 200 {
+		t.Fatalf("enabled service: %d %s", rec.Code, rec.Body)
+	}
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/", nil),
+		httptest.NewRequest("PUT", "/photos", nil),
+		httptest.NewRequest("POST", "/sns", strings.NewReader("Action=ListTopics&Version=2010-03-31")),
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotImplemented {
+			t.Errorf("%s %s: got %d, want 501", req.Method, req.URL.Path, rec.Code)
+		}
+	}
+}
+
+func TestRouter_AccountAndRegion(t *testing.T) {
+	cfg := config.Default()
+	cfg.Storage.ObjectRoot = t.TempDir()
+	cfg.Accounts.AccessKeys = map[string]string{"ci": "555566667777"}
+	cfg.Accounts.Namespaces = map[string]string{"team-b": "222233334444"}
+	e := router.NewWithConfig(t.Context(), resource.NewMemoryStore(), cfg)
+
+	send := func(req *http.Request, body, accessKeyID, region, service string) string {
+		t.Helper()
+		if accessKeyID != "" {
+			sum := sha256.Sum256([]byte(body))
+			creds := aws.Credentials{AccessKeyID: accessKeyID, SecretAccessKey: "test"}
+			if err := v4.NewSigner().SignHTTP(t.Context(), creds, req, hex.EncodeToString(sum[:]), service, region, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != 200 {
+			t.Fatalf("%s: %d %s", service, rec.Code, rec.Body)
+		}
+		return rec.Body.String()
+	}
+	jsonReq := func(target, body string) *http.Request {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+		req.Header.Set("X-Amz-Target", target)
+		return req
+	}
+	formReq := func(body string) *http.Request {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	// A 12-digit access key is the account; the region is the signed one.
+	body := `{"QueueName":"jobs","Attributes":{}}`
+	if out := send(jsonReq("AmazonSQS.CreateQueue", body), body, "111122223333", "eu-west-1", "sqs"); !strings.Contains(out, "http://example.com/111122223333/jobs") {
+		t.Errorf("CreateQueue: %s", out)
+	}
+	body = `{"QueueUrl":"http://example.com/111122223333/jobs","AttributeNames":["QueueArn"]}`
+	if out := send(jsonReq("AmazonSQS.GetQueueAttributes", body), body, "111122223333", "eu-west-1", "sqs"); !strings.Contains(out, "arn:aws:sqs:eu-west-1:111122223333:jobs") {
+		t.Errorf("GetQueueAttributes: %s", out)
+	}
+
+	// A configured access key.
+	body = "Action=GetCallerIdentity&Version=2011-06-15"
+	if out := send(formReq(body), body, "ci", "us-west-2", "sts"); !strings.Contains(out, "<Account>555566667777</Account>") {
+		t.Errorf("GetCallerIdentity: %s", out)
+	}
+
+	// A configured namespace, with the region taken from the host.
+	req := formReq("Action=CreateTopic&Name=alerts&Version=2010-03-31")
+	req.Host = "sns.ap-southeast-2.localhost:4566"
+	req.Header.Set("User-Agent", "aws-sdk-go-v2 custom-team-b")
+	if out := send(req, "", "", "", "sns"); !strings.Contains(out, "arn:aws:sns:ap-southeast-2:222233334444:alerts") {
+		t.Errorf("CreateTopic: %s", out)
+	}
+
+	// Anything else gets the defaults.
+	req = formReq("Action=CreateTopic&Name=alerts&Version=2010-03-31")
+	if out := send(req, "", "", "", "sns"); !strings.Contains(out, "arn:aws:sns:us-east-1:000000000000:alerts") {
+		t.Errorf("CreateTopic with defaults: %s", out)
+	}
+}
@@ -0,0 +1,86 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package router
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+//
+// S3 VIRTUAL-HOSTED-STYLE ADDRESSING
+//
+// SDKs that do not use path-style put the bucket in the host name. With
+// a base domain of localhost these all name bucket "photos":
+//
+//	photos.s3.localhost:4566
+//	photos.s3.eu-west-1.localhost:4566
+//	photos.localhost:4566 (an SDK given AWS_ENDPOINT_URL=http://localhost:4566)
+//
+// Such requests are rewritten to path-style (/photos/key) and handed to
+// the same S3 routes. Wildcard DNS names such as 127.0.0.1.nip.io or
+// 127.0.0.1.sslip.io work as base domains too.
+//
+
+// defaultS3Domain is the base domain used when none is configured.
+const defaultS3Domain = "localhost"
+
+type s3Domains []string
+
+// newS3Domains normalises the configured base domains for
+// virtual-hosted-style S3.
+func newS3Domains(domains []string) s3Domains {
+	var out s3Domains
+	for _, d := range domains {
+		if d = strings.Trim(strings.TrimSpace(d), "."); d != "" {
+			out = append(out, strings.ToLower(d))
+		}
+	}
+	if len(out) == 0 {
+		out = s3Domains{defaultS3Domain}
+	}
+	return out
+}
+
+// bucket returns the bucket named by a virtual-hosted-style host. explicit
+// is set when the host also carries an "s3" label, so it cannot mean any
+// other service.
+func (d s3Domains) bucket(host string) (bucket string, explicit bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for _, domain := range d {
+		prefix, ok := strings.CutSuffix(host, "."+domain)
+		if !ok || prefix == "" {
+			continue
+		}
+		// s3.<domain> and s3.<region>.<domain> are the service itself.
+		if prefix == "s3" || strings.HasPrefix(prefix, "s3.") && !strings.Contains(prefix[3:], ".") {
+			return "", false
+		}
+		if b, ok := strings.CutSuffix(prefix, ".s3"); ok {
+			return b, true
+		}
+		if i := strings.LastIndex(prefix, ".s3."); i > 0 && !strings.Contains(prefix[i+4:], ".") {
+			return prefix[:i], true
+		}
+		return prefix, false
+	}
+	return "", false
+}
+
+// pathStyle returns a copy of r addressed path-style to bucket.
+func pathStyle(r *http.Request, bucket string) *http.Request {
+	r = r.WithContext(r.Context())
+	u := *r.URL
+	u.Path = "/" + bucket + u.Path
+	if u.RawPath != "" {
+		u.RawPath = "/" + bucket + u.RawPath
+	}
+	r.URL = &u
+	return r
+}
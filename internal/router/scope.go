@@ -0,0 +1,89 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package router
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"opensnack/internal/awsarn"
+	"opensnack/internal/config"
+	"opensnack/internal/sigv4"
+	"opensnack/internal/util"
+)
+
+//
+// ACCOUNT AND REGION
+//
+// Each request is served in one account and region, which end up in the
+// ARNs and URLs handlers return. The region is the one the request was
+// signed for, or named in a host such as sqs.eu-west-1.localhost. The
+// account is, in order: the one configured for the signing access key,
+// the access key itself if it is a 12-digit account ID (as LocalStack
+// does), the one configured for the namespace, and the default.
+//
+
+var (
+	regionLabel = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+	accountID   = regexp.MustCompile(`^[0-9]{12}$`)
+)
+
+// withScope records the request's awsarn.Scope in its context.
+func withScope(cfg *config.Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := awsarn.Scope{
+			AccountID: cfg.AccountID,
+			Region:    cfg.Region,
+			Endpoint:  endpointOf(r),
+		}
+
+		var accessKeyID string
+		if sig, err := sigv4.Parse(r); err == nil && sig != nil {
+			accessKeyID = sig.AccessKeyID
+			if sig.Scope.Region != "" {
+				s.Region = sig.Scope.Region
+			}
+		} else if region, ok := hostRegion(r.Host); ok {
+			s.Region = region
+		}
+
+		if id, ok := cfg.Accounts.AccessKeys[accessKeyID]; ok {
+			s.AccountID = id
+		} else if accountID.MatchString(accessKeyID) {
+			s.AccountID = accessKeyID
+		} else if id, ok := cfg.Accounts.Namespaces[util.NamespaceFromHeader(r)]; ok {
+			s.AccountID = id
+		}
+
+		next.ServeHTTP(w, r.WithContext(awsarn.NewContext(r.Context(), s)))
+	})
+}
+
+// endpointOf returns the scheme and host r was sent to.
+func endpointOf(r *http.Request) string {
+	if r.Host == "" {
+		return awsarn.Default.Endpoint
+	}
+	if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+// hostRegion returns the region named by a label of host, as in
+// sqs.eu-west-1.localhost or photos.s3.eu-west-1.localhost.
+func hostRegion(host string) (string, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, label := range strings.Split(strings.ToLower(host), ".") {
+		if regionLabel.MatchString(label) {
+			return label, true
+		}
+	}
+	return "", false
+}
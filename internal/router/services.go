@@ -0,0 +1,93 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package router
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"opensnack/internal/api/ec2"
+	"opensnack/internal/api/elasticache"
+	"opensnack/internal/api/iam"
+	"opensnack/internal/api/sns"
+	"opensnack/internal/api/sqs"
+	"opensnack/internal/api/sts"
+	"opensnack/internal/sigv4"
+)
+
+//
+// SINGLE-ENDPOINT ROUTING
+//
+// Every service is also served from the bare root, so clients need only
+// AWS_ENDPOINT_URL rather than one endpoint override per service. The
+// service is worked out from, in order: the S3 Control path, the SigV4
+// credential scope, the X-Amz-Target prefix, the Query API Version and
+// finally a virtual-host name such as sqs.us-east-1.localhost.
+//
+
+// targetServices maps X-Amz-Target prefixes of the JSON APIs.
+var targetServices = map[string]string{
+	"DynamoDB_20120810":        "dynamodb",
+	"DynamoDBStreams_20120810": "dynamodb",
+	"AmazonSQS":                "sqs",
+	"TrentService":             "kms",
+	"secretsmanager":           "secretsmanager",
+	"AmazonSSM":                "ssm",
+	"Logs_20140328":            "logs",
+	"AWSLambda_20150331":       "lambda",
+	"AWSLambda":                "lambda",
+}
+
+// queryVersions maps the Version parameter of the Query APIs.
+var queryVersions = map[string]string{
+	sts.APIVersion:         "sts",
+	iam.APIVersion:         "iam",
+	sqs.APIVersion:         "sqs",
+	sns.APIVersion:         "sns",
+	ec2.APIVersion:         "ec2",
+	elasticache.APIVersion: "elasticache",
+}
+
+// serviceOf returns the service r is addressed to, or "" if nothing in
+// the request names one.
+func serviceOf(r *http.Request, known map[string]http.HandlerFunc) string {
+	// S3 Control signs as "s3", so its versioned path comes first.
+	if strings.Contains(r.URL.Path, "/v20180820/") {
+		return "s3control"
+	}
+
+	if sig, err := sigv4.Parse(r); err == nil && sig != nil {
+		if _, ok := known[sig.Scope.Service]; ok {
+			return sig.Scope.Service
+		}
+	}
+
+	if target := r.Header.Get("X-Amz-Target"); target != "" {
+		prefix, _, _ := strings.Cut(target, ".")
+		if svc, ok := targetServices[prefix]; ok {
+			return svc
+		}
+	}
+
+	// Query APIs always post to the root. Parsing the form anywhere else
+	// could swallow an S3 object body.
+	if r.URL.Path == "/" && (r.Method == "GET" || r.Method == "POST") {
+		r.ParseForm()
+		if svc, ok := queryVersions[r.FormValue("Version")]; ok {
+			return svc
+		}
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	label, _, _ := strings.Cut(host, ".")
+	if _, ok := known[label]; ok {
+		return label
+	}
+	return ""
+}
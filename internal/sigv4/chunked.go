@@ -0,0 +1,231 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sigv4
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//
+// STREAMING PAYLOADS
+//
+// S3 clients that cannot hash a body up front send it aws-chunked: each
+// chunk is "<hex size>;chunk-signature=<sig>\r\n<data>\r\n", ending with
+// an empty chunk and, for the -TRAILER variants, trailing headers such
+// as x-amz-checksum-crc32. Each chunk signature chains from the previous
+// one, starting with the request signature.
+//
+
+// maxChunkSize bounds the chunk a client may make us buffer.
+const maxChunkSize = 16 << 20
+
+// DecodeBody replaces an aws-chunked r.Body with the payload it carries,
+// without checking chunk signatures. It is a no-op for other requests.
+func DecodeBody(r *http.Request) error {
+	switch payload := r.Header.Get("X-Amz-Content-Sha256"); payload {
+	case StreamingPayload, StreamingPayloadTrailer, StreamingUnsignedTrailer:
+		return decodeBody(r, payload, nil)
+	}
+	return nil
+}
+
+func decodeBody(r *http.Request, payload string, signer *chunkSigner) error {
+	if payload == StreamingUnsignedTrailer {
+		signer = nil
+	}
+	r.Body = &chunkedReader{
+		body:     r.Body,
+		br:       bufio.NewReader(r.Body),
+		signer:   signer,
+		trailers: payload != StreamingPayload,
+	}
+
+	// Handlers see the decoded payload, as they would behind S3.
+	if n, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64); err == nil {
+		r.ContentLength = n
+		r.Header.Set("Content-Length", strconv.FormatInt(n, 10))
+	} else {
+		r.ContentLength = -1
+		r.Header.Del("Content-Length")
+	}
+	var encodings []string
+	for _, e := range strings.Split(r.Header.Get("Content-Encoding"), ",") {
+		if e = strings.TrimSpace(e); e != "" && e != "aws-chunked" {
+			encodings = append(encodings, e)
+		}
+	}
+	if len(encodings) > 0 {
+		r.Header.Set("Content-Encoding", strings.Join(encodings, ","))
+	} else {
+		r.Header.Del("Content-Encoding")
+	}
+	return nil
+}
+
+// chunkSigner computes the signature chain of a streaming payload.
+type chunkSigner struct {
+	key  []byte
+	sig  *Signature
+	prev string
+}
+
+func (c *chunkSigner) check(got string, data []byte) error {
+	sum := sha256.Sum256(data)
+	want := hmacHex(c.key, "AWS4-HMAC-SHA256-PAYLOAD\n"+c.sig.Date+"\n"+c.sig.Scope.String()+"\n"+
+		c.prev+"\n"+emptySHA256+"\n"+hex.EncodeToString(sum[:]))
+	if !hmac.Equal([]byte(want), []byte(got)) {
+		return ErrSignatureMismatch
+	}
+	c.prev = got
+	return nil
+}
+
+func (c *chunkSigner) checkTrailer(got string, trailer string) error {
+	sum := sha256.Sum256([]byte(trailer))
+	want := hmacHex(c.key, "AWS4-HMAC-SHA256-TRAILER\n"+c.sig.Date+"\n"+c.sig.Scope.String()+"\n"+
+		c.prev+"\n"+hex.EncodeToString(sum[:]))
+	if !hmac.Equal([]byte(want), []byte(got)) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// chunkedReader decodes an aws-chunked body. Chunks are buffered whole
+// so that none of their data is returned before its signature checks.
+type chunkedReader struct {
+	body     io.Closer
+	br       *bufio.Reader
+	signer   *chunkSigner // nil to skip signature checks
+	trailers bool
+
+	buf []byte
+	err error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 && c.err == nil {
+		c.err = c.nextChunk()
+	}
+	if len(c.buf) > 0 {
+		n := copy(p, c.buf)
+		c.buf = c.buf[n:]
+		return n, nil
+	}
+	return 0, c.err
+}
+
+func (c *chunkedReader) Close() error {
+	return c.body.Close()
+}
+
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	sizeHex, ext, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(sizeHex), 16, 64)
+	if err != nil || size < 0 || size > maxChunkSize {
+		return fmt.Errorf("%w: invalid chunk size %q", ErrMalformed, sizeHex)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.br, data); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if c.signer != nil {
+		got, ok := strings.CutPrefix(strings.TrimSpace(ext), "chunk-signature=")
+		if !ok {
+			return fmt.Errorf("%w: chunk has no chunk-signature", ErrMalformed)
+		}
+		if err := c.signer.check(got, data); err != nil {
+			return err
+		}
+	}
+
+	if size == 0 {
+		if c.trailers {
+			if err := c.readTrailers(); err != nil {
+				return err
+			}
+		} else if _, err := c.readLine(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	if line, err := c.readLine(); err != nil || line != "" {
+		return fmt.Errorf("%w: chunk data is not followed by CRLF", ErrMalformed)
+	}
+	c.buf = data
+	return nil
+}
+
+// readTrailers reads the trailing headers after the final chunk and, for
+// a signed stream, checks x-amz-trailer-signature against them.
+func (c *chunkedReader) readTrailers() error {
+	var trailer strings.Builder
+	var sig string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			break
+		}
+		name, value, _ := strings.Cut(line, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "x-amz-trailer-signature" {
+			sig = strings.TrimSpace(value)
+			continue
+		}
+		trailer.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	if c.signer != nil {
+		return c.signer.checkTrailer(sig, trailer.String())
+	}
+	return nil
+}
+
+func (c *chunkedReader) readLine() (string, error) {
+	line, err := c.br.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// hashCheckReader fails the last read of a body that does not hash to
+// the X-Amz-Content-Sha256 it was signed with.
+type hashCheckReader struct {
+	body io.ReadCloser
+	hash hash.Hash
+	want string
+}
+
+func (h *hashCheckReader) Read(p []byte) (int, error) {
+	n, err := h.body.Read(p)
+	h.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(h.hash.Sum(nil)) != strings.ToLower(h.want) {
+		return n, ErrContentSHA256Mismatch
+	}
+	return n, err
+}
+
+func (h *hashCheckReader) Close() error {
+	return h.body.Close()
+}
@@ -0,0 +1,368 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package sigv4 parses and verifies AWS Signature Version 4 requests:
+// Authorization headers, presigned query strings, UNSIGNED-PAYLOAD and
+// aws-chunked streaming payloads.
+package sigv4
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Algorithm = "AWS4-HMAC-SHA256"
+
+	amzDateFormat = "20060102T150405Z"
+
+	// maxPresignExpiry is the longest X-Amz-Expires AWS accepts, 7 days.
+	maxPresignExpiry = 7 * 24 * time.Hour
+
+	// maxClockSkew is how far the X-Amz-Date of a header-signed request
+	// may be from the server's clock, either way.
+	maxClockSkew = 15 * time.Minute
+
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// X-Amz-Content-Sha256 values that are not a hash of the body.
+const (
+	UnsignedPayload          = "UNSIGNED-PAYLOAD"
+	StreamingPayload         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	StreamingPayloadTrailer  = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	StreamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+)
+
+var (
+	// ErrMalformed is returned for a signature that cannot be parsed.
+	ErrMalformed = errors.New("malformed signature")
+	// ErrUnknownKey is returned when the access key is not recognised.
+	ErrUnknownKey = errors.New("the security token included in the request is invalid")
+	// ErrSignatureMismatch is returned when the signature, or a chunk
+	// signature, does not match the one computed from the request.
+	ErrSignatureMismatch = errors.New("the request signature we calculated does not match the signature you provided")
+	// ErrExpired is returned for a presigned URL past its X-Amz-Expires.
+	ErrExpired = errors.New("request has expired")
+	// ErrRequestTimeTooSkewed is returned for a header-signed request
+	// whose X-Amz-Date is more than 15 minutes from the server's clock.
+	ErrRequestTimeTooSkewed = errors.New("the difference between the request time and the current time is too large")
+	// ErrContentSHA256Mismatch is returned by the request body when it
+	// does not hash to the X-Amz-Content-Sha256 it was signed with.
+	ErrContentSHA256Mismatch = errors.New("the provided x-amz-content-sha256 header does not match what was computed")
+)
+
+// Scope is the credential scope of a signature.
+type Scope struct {
+	Date    string
+	Region  string
+	Service string
+}
+
+func (s Scope) String() string {
+	return s.Date + "/" + s.Region + "/" + s.Service + "/aws4_request"
+}
+
+// Signature is the SigV4 signature of one request.
+type Signature struct {
+	AccessKeyID   string
+	Scope         Scope
+	Date          string // X-Amz-Date
+	SignedHeaders []string
+	Signature     string
+
+	// Presigned is set for query-string authentication, which also
+	// carries an expiry.
+	Presigned bool
+	Expires   time.Duration
+}
+
+// Parse returns the signature of r, from its Authorization header or its
+// presigned query string. It returns nil and no error if r is not signed
+// with SigV4.
+func Parse(r *http.Request) (*Signature, error) {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if !strings.HasPrefix(auth, Algorithm+" ") {
+			return nil, nil
+		}
+		return parseHeader(r, strings.TrimPrefix(auth, Algorithm+" "))
+	}
+	q := r.URL.Query()
+	if q.Get("X-Amz-Algorithm") == "" && q.Get("X-Amz-Signature") == "" {
+		return nil, nil
+	}
+	return parseQuery(q)
+}
+
+func parseHeader(r *http.Request, params string) (*Signature, error) {
+	sig := &Signature{Date: r.Header.Get("X-Amz-Date")}
+	var credential, signedHeaders string
+	for _, p := range strings.Split(params, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+		switch k {
+		case "Credential":
+			credential = v
+		case "SignedHeaders":
+			signedHeaders = v
+		case "Signature":
+			sig.Signature = v
+		}
+	}
+	if credential == "" || signedHeaders == "" || sig.Signature == "" {
+		return nil, fmt.Errorf("%w: Authorization header requires Credential, SignedHeaders and Signature", ErrMalformed)
+	}
+	if sig.Date == "" {
+		return nil, fmt.Errorf("%w: X-Amz-Date header is required", ErrMalformed)
+	}
+	if err := sig.setCredential(credential); err != nil {
+		return nil, err
+	}
+	sig.SignedHeaders = strings.Split(signedHeaders, ";")
+	return sig, nil
+}
+
+func parseQuery(q url.Values) (*Signature, error) {
+	if alg := q.Get("X-Amz-Algorithm"); alg != Algorithm {
+		return nil, fmt.Errorf("%w: unsupported X-Amz-Algorithm %q", ErrMalformed, alg)
+	}
+	sig := &Signature{
+		Date:      q.Get("X-Amz-Date"),
+		Signature: q.Get("X-Amz-Signature"),
+		Presigned: true,
+	}
+	if sig.Date == "" || sig.Signature == "" || q.Get("X-Amz-SignedHeaders") == "" {
+		return nil, fmt.Errorf("%w: presigned URL requires X-Amz-Date, X-Amz-SignedHeaders and X-Amz-Signature", ErrMalformed)
+	}
+	if err := sig.setCredential(q.Get("X-Amz-Credential")); err != nil {
+		return nil, err
+	}
+	secs, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+	if err != nil || secs < 1 || time.Duration(secs)*time.Second > maxPresignExpiry {
+		return nil, fmt.Errorf("%w: X-Amz-Expires must be between 1 and 604800 seconds", ErrMalformed)
+	}
+	sig.Expires = time.Duration(secs) * time.Second
+	sig.SignedHeaders = strings.Split(q.Get("X-Amz-SignedHeaders"), ";")
+	return sig, nil
+}
+
+// setCredential parses "AKID/20240101/us-east-1/s3/aws4_request".
+func (s *Signature) setCredential(credential string) error {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[0] == "" || parts[4] != "aws4_request" {
+		return fmt.Errorf("%w: invalid credential %q", ErrMalformed, credential)
+	}
+	s.AccessKeyID = parts[0]
+	s.Scope = Scope{Date: parts[1], Region: parts[2], Service: parts[3]}
+	return nil
+}
+
+// Verify checks the signature of r against secret, and that it is still
+// valid at now: a header signature within 15 minutes of it, a presigned
+// URL before its expiry. On success it also wraps r.Body so that the
+// payload is checked as it is read: a body signed with its SHA-256 fails
+// with ErrContentSHA256Mismatch if it does not match, and an aws-chunked
+// body is decoded and every chunk signature checked (see DecodeBody).
+func (s *Signature) Verify(r *http.Request, secret string, now time.Time) error {
+	signedAt, err := time.Parse(amzDateFormat, s.Date)
+	if err != nil {
+		return fmt.Errorf("%w: invalid X-Amz-Date %q", ErrMalformed, s.Date)
+	}
+	if s.Scope.Date != signedAt.Format("20060102") {
+		return fmt.Errorf("%w: credential scope date %q does not match X-Amz-Date %q", ErrMalformed, s.Scope.Date, s.Date)
+	}
+	if !slices.Contains(s.SignedHeaders, "host") {
+		return fmt.Errorf("%w: host must be a signed header", ErrMalformed)
+	}
+	switch {
+	case s.Presigned:
+		if now.After(signedAt.Add(s.Expires)) {
+			return ErrExpired
+		}
+	case now.Sub(signedAt) > maxClockSkew || signedAt.Sub(now) > maxClockSkew:
+		return ErrRequestTimeTooSkewed
+	}
+
+	payload, err := s.payloadHash(r)
+	if err != nil {
+		return err
+	}
+	key := signingKey(secret, s.Scope)
+	want := hmacHex(key, s.stringToSign(canonicalRequest(r, s, payload)))
+	if !hmac.Equal([]byte(want), []byte(s.Signature)) {
+		return ErrSignatureMismatch
+	}
+
+	switch payload {
+	case UnsignedPayload:
+	case StreamingPayload, StreamingPayloadTrailer, StreamingUnsignedTrailer:
+		return decodeBody(r, payload, &chunkSigner{key: key, sig: s, prev: s.Signature})
+	default:
+		if len(payload) == sha256.Size*2 && r.Body != nil {
+			r.Body = &hashCheckReader{body: r.Body, hash: sha256.New(), want: payload}
+		}
+	}
+	return nil
+}
+
+// payloadHash returns the hashed-payload line of the canonical request.
+// Clients that do not send X-Amz-Content-Sha256 sign the body's hash,
+// except for presigned S3 URLs, whose payload is never signed.
+func (s *Signature) payloadHash(r *http.Request) (string, error) {
+	if v := r.Header.Get("X-Amz-Content-Sha256"); v != "" {
+		return v, nil
+	}
+	if v := r.URL.Query().Get("X-Amz-Content-Sha256"); v != "" {
+		return v, nil
+	}
+	if s.Presigned && s.Scope.Service == "s3" {
+		return UnsignedPayload, nil
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return emptySHA256, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (s *Signature) stringToSign(canonical string) string {
+	sum := sha256.Sum256([]byte(canonical))
+	return Algorithm + "\n" + s.Date + "\n" + s.Scope.String() + "\n" + hex.EncodeToString(sum[:])
+}
+
+// canonicalRequest builds the canonical request of the signing spec.
+func canonicalRequest(r *http.Request, s *Signature, payload string) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte('\n')
+	b.WriteString(canonicalURI(r, s.Scope.Service))
+	b.WriteByte('\n')
+	b.WriteString(canonicalQuery(r.URL.RawQuery))
+	b.WriteByte('\n')
+	for _, name := range s.SignedHeaders {
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(canonicalHeader(r, name))
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	b.WriteString(strings.Join(s.SignedHeaders, ";"))
+	b.WriteByte('\n')
+	b.WriteString(payload)
+	return b.String()
+}
+
+// canonicalURI is the path as the client sent it. S3 signs it as is;
+// every other service signs it escaped a second time.
+func canonicalURI(r *http.Request, service string) string {
+	path := r.URL.EscapedPath()
+	if r.RequestURI != "" && !strings.HasPrefix(r.RequestURI, "http") {
+		path, _, _ = strings.Cut(r.RequestURI, "?")
+	}
+	if path == "" {
+		path = "/"
+	}
+	if service == "s3" {
+		return path
+	}
+	return escape(path, false)
+}
+
+// canonicalQuery sorts the query parameters, minus the signature itself,
+// and encodes them the way signers do.
+func canonicalQuery(raw string) string {
+	q, _ := url.ParseQuery(raw)
+	q.Del("X-Amz-Signature")
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		vals := q[k]
+		sort.Strings(vals)
+		for _, v := range vals {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(escape(k, true))
+			b.WriteByte('=')
+			b.WriteString(escape(v, true))
+		}
+	}
+	return b.String()
+}
+
+func canonicalHeader(r *http.Request, name string) string {
+	var vals []string
+	switch name {
+	case "host":
+		vals = []string{r.Host}
+	case "content-length":
+		vals = r.Header.Values(name)
+		if len(vals) == 0 && r.ContentLength >= 0 {
+			vals = []string{strconv.FormatInt(r.ContentLength, 10)}
+		}
+	default:
+		vals = r.Header.Values(name)
+	}
+	for i, v := range vals {
+		vals[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(vals, ",")
+}
+
+// escape percent-encodes everything but the unreserved characters, and
+// '/' unless encodeSlash is set.
+func escape(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&15])
+	}
+	return b.String()
+}
+
+func signingKey(secret string, scope Scope) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), scope.Date)
+	key = hmacSHA256(key, scope.Region)
+	key = hmacSHA256(key, scope.Service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hmacHex(key []byte, data string) string {
+	return hex.EncodeToString(hmacSHA256(key, data))
+}
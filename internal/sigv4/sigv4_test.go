@@ -0,0 +1,303 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sigv4_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"opensnack/internal/sigv4"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+var creds = aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// serverRequest turns a signed client request into the request a server
+// receives.
+func serverRequest(client *http.Request, body []byte) *http.Request {
+	r := httptest.NewRequest(client.Method, client.URL.String(), bytes.NewReader(body))
+	for k, v := range client.Header {
+		r.Header[k] = v
+	}
+	return r
+}
+
+// verify parses r and verifies it with the test secret.
+func verify(t *testing.T, r *http.Request, secret string, now time.Time) error {
+	t.Helper()
+	sig, err := sigv4.Parse(r)
+	if err != nil {
+		return err
+	}
+	if sig == nil {
+		t.Fatal("request is not signed")
+	}
+	if sig.AccessKeyID != creds.AccessKeyID {
+		t.Fatalf("unexpected access key %q", sig.AccessKeyID)
+	}
+	return sig.Verify(r, secret, now)
+}
+
+func TestVerify_HeaderSigned(t *testing.T) {
+	body := []byte("Action=CreateQueue&QueueName=jobs&Version=2012-11-05")
+	client, _ := http.NewRequest("POST", "http://localhost:4566/", bytes.NewReader(body))
+	client.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	now := time.Now()
+	if err := v4.NewSigner().SignHTTP(t.Context(), creds, client, sha256Hex(body), "sqs", "us-east-1", now); err != nil {
+		t.Fatal(err)
+	}
+
+	r := serverRequest(client, body)
+	if err := verify(t, r, creds.SecretAccessKey, now); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if got, _ := io.ReadAll(r.Body); !bytes.Equal(got, body) {
+		t.Fatalf("body not preserved: %q", got)
+	}
+
+	if err := verify(t, serverRequest(client, body), "wrong", now); !errors.Is(err, sigv4.ErrSignatureMismatch) {
+		t.Fatalf("expected a mismatch for the wrong secret, got %v", err)
+	}
+	tampered := bytes.Replace(body, []byte("jobs"), []byte("jabs"), 1)
+	if err := verify(t, serverRequest(client, tampered), creds.SecretAccessKey, now); !errors.Is(err, sigv4.ErrSignatureMismatch) {
+		t.Fatalf("expected a mismatch for a tampered body, got %v", err)
+	}
+}
+
+// signQuery signs a Query API request made at signedAt.
+func signQuery(t *testing.T, signedAt time.Time) (*http.Request, []byte) {
+	t.Helper()
+	body := []byte("Action=ListQueues&Version=2012-11-05")
+	client, _ := http.NewRequest("POST", "http://localhost:4566/", bytes.NewReader(body))
+	client.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := v4.NewSigner().SignHTTP(t.Context(), creds, client, sha256Hex(body), "sqs", "us-east-1", signedAt); err != nil {
+		t.Fatal(err)
+	}
+	return client, body
+}
+
+func TestVerify_ClockSkew(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		offset time.Duration
+		want   error
+	}{
+		{-14 * time.Minute, nil},
+		{14 * time.Minute, nil},
+		{-16 * time.Minute, sigv4.ErrRequestTimeTooSkewed},
+		{16 * time.Minute, sigv4.ErrRequestTimeTooSkewed},
+	} {
+		client, body := signQuery(t, now.Add(tc.offset))
+		if err := verify(t, serverRequest(client, body), creds.SecretAccessKey, now); !errors.Is(err, tc.want) {
+			t.Errorf("signed %v from now: expected %v, got %v", tc.offset, tc.want, err)
+		}
+	}
+}
+
+func TestVerify_ScopeDateMismatch(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 5, 0, 0, time.UTC)
+	client, body := signQuery(t, now)
+	r := serverRequest(client, body)
+	r.Header.Set("Authorization", strings.Replace(r.Header.Get("Authorization"), "/20240102/", "/20240101/", 1))
+	if err := verify(t, r, creds.SecretAccessKey, now); !errors.Is(err, sigv4.ErrMalformed) {
+		t.Fatalf("expected a malformed signature, got %v", err)
+	}
+}
+
+func TestVerify_HostNotSigned(t *testing.T) {
+	now := time.Now()
+	client, body := signQuery(t, now)
+	r := serverRequest(client, body)
+	auth := r.Header.Get("Authorization")
+	if !strings.Contains(auth, "SignedHeaders=content-length;content-type;host;") {
+		t.Fatalf("unexpected signed headers: %s", auth)
+	}
+	r.Header.Set("Authorization", strings.Replace(auth, "host;", "", 1))
+	if err := verify(t, r, creds.SecretAccessKey, now); !errors.Is(err, sigv4.ErrMalformed) {
+		t.Fatalf("expected a malformed signature, got %v", err)
+	}
+}
+
+func TestVerify_S3UnsignedPayload(t *testing.T) {
+	client, _ := http.NewRequest("PUT", "http://localhost:4566/bucket/dir/a%20b%2Bc.txt?tagging=&x-id=PutObject", strings.NewReader("hello"))
+	client.Header.Set("X-Amz-Content-Sha256", sigv4.UnsignedPayload)
+	now := time.Now()
+	err := v4.NewSigner().SignHTTP(t.Context(), creds, client, sigv4.UnsignedPayload, "s3", "eu-west-2", now,
+		func(o *v4.SignerOptions) { o.DisableURIPathEscaping = true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(t, serverRequest(client, []byte("hello")), creds.SecretAccessKey, now); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+}
+
+func TestVerify_PayloadHashMismatch(t *testing.T) {
+	client, _ := http.NewRequest("PUT", "http://localhost:4566/bucket/key", strings.NewReader("hello"))
+	client.Header.Set("X-Amz-Content-Sha256", sha256Hex([]byte("hello")))
+	now := time.Now()
+	err := v4.NewSigner().SignHTTP(t.Context(), creds, client, sha256Hex([]byte("hello")), "s3", "us-east-1", now,
+		func(o *v4.SignerOptions) { o.DisableURIPathEscaping = true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := serverRequest(client, []byte("jello"))
+	if err := verify(t, r, creds.SecretAccessKey, now); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if _, err := io.ReadAll(r.Body); !errors.Is(err, sigv4.ErrContentSHA256Mismatch) {
+		t.Fatalf("expected a content hash mismatch, got %v", err)
+	}
+}
+
+func TestVerify_Presigned(t *testing.T) {
+	client, _ := http.NewRequest("GET", "http://localhost:4566/bucket/key?X-Amz-Expires=300", nil)
+	now := time.Now()
+	signed, _, err := v4.NewSigner().PresignHTTP(t.Context(), creds, client, sigv4.UnsignedPayload, "s3", "us-east-1", now,
+		func(o *v4.SignerOptions) { o.DisableURIPathEscaping = true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", signed, nil)
+	if err := verify(t, r, creds.SecretAccessKey, now); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	r = httptest.NewRequest("GET", signed, nil)
+	if err := verify(t, r, creds.SecretAccessKey, now.Add(301*time.Second)); !errors.Is(err, sigv4.ErrExpired) {
+		t.Fatalf("expected the URL to expire, got %v", err)
+	}
+
+	r = httptest.NewRequest("GET", strings.Replace(signed, "/bucket/key", "/bucket/other", 1), nil)
+	if err := verify(t, r, creds.SecretAccessKey, now); !errors.Is(err, sigv4.ErrSignatureMismatch) {
+		t.Fatalf("expected a mismatch for another key, got %v", err)
+	}
+}
+
+func TestParse_Unsigned(t *testing.T) {
+	r := httptest.NewRequest("GET", "/bucket", nil)
+	if sig, err := sigv4.Parse(r); sig != nil || err != nil {
+		t.Fatalf("expected no signature, got %+v %v", sig, err)
+	}
+	r.Header.Set("Authorization", sigv4.Algorithm+" Credential=AKID/20240101/us-east-1")
+	if _, err := sigv4.Parse(r); !errors.Is(err, sigv4.ErrMalformed) {
+		t.Fatalf("expected a malformed signature, got %v", err)
+	}
+}
+
+//
+// Streaming payloads
+//
+
+// chunkedBody encodes data aws-chunked with chunk signatures chained from
+// seed, as S3 clients do.
+func chunkedBody(data []byte, size int, date, scope, seed string) []byte {
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range strings.Split(strings.TrimSuffix(scope, "/aws4_request"), "/") {
+		key = hmacSum(key, part)
+	}
+	key = hmacSum(key, "aws4_request")
+
+	var out bytes.Buffer
+	prev := seed
+	for {
+		n := min(size, len(data))
+		chunk := data[:n]
+		data = data[n:]
+		prev = hex.EncodeToString(hmacSum(key, "AWS4-HMAC-SHA256-PAYLOAD\n"+date+"\n"+scope+"\n"+prev+"\n"+
+			sha256Hex(nil)+"\n"+sha256Hex(chunk)))
+		fmt.Fprintf(&out, "%x;chunk-signature=%s\r\n%s\r\n", n, prev, chunk)
+		if n == 0 {
+			return out.Bytes()
+		}
+	}
+}
+
+func hmacSum(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func signStreaming(t *testing.T, data []byte) (*http.Request, *sigv4.Signature) {
+	t.Helper()
+	client, _ := http.NewRequest("PUT", "http://localhost:4566/bucket/big", nil)
+	client.Header.Set("X-Amz-Content-Sha256", sigv4.StreamingPayload)
+	client.Header.Set("X-Amz-Decoded-Content-Length", strconv.Itoa(len(data)))
+	client.Header.Set("Content-Encoding", "aws-chunked")
+	err := v4.NewSigner().SignHTTP(t.Context(), creds, client, sigv4.StreamingPayload, "s3", "us-east-1", time.Now(),
+		func(o *v4.SignerOptions) { o.DisableURIPathEscaping = true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := sigv4.Parse(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, sig
+}
+
+func TestVerify_StreamingPayload(t *testing.T) {
+	data := bytes.Repeat([]byte("opensnack "), 2000)
+	client, sig := signStreaming(t, data)
+	body := chunkedBody(data, 8192, sig.Date, sig.Scope.String(), sig.Signature)
+
+	r := serverRequest(client, body)
+	if err := verify(t, r, creds.SecretAccessKey, time.Now()); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	got, err := io.ReadAll(r.Body)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("decoded %d bytes, err %v", len(got), err)
+	}
+	if r.ContentLength != int64(len(data)) || r.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("headers not rewritten: %d %q", r.ContentLength, r.Header.Get("Content-Encoding"))
+	}
+
+	// A chunk altered in flight fails when it is read.
+	tampered := bytes.Replace(body, []byte("opensnack"), []byte("OPENSNACK"), 1)
+	r = serverRequest(client, tampered)
+	if err := verify(t, r, creds.SecretAccessKey, time.Now()); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if _, err := io.ReadAll(r.Body); !errors.Is(err, sigv4.ErrSignatureMismatch) {
+		t.Fatalf("expected a chunk signature mismatch, got %v", err)
+	}
+}
+
+func TestDecodeBody_UnsignedTrailer(t *testing.T) {
+	body := "5\r\nhello\r\n6\r\n world\r\n0\r\nx-amz-checksum-crc32:AAAAAA==\r\n\r\n"
+	r := httptest.NewRequest("PUT", "/bucket/key", strings.NewReader(body))
+	r.Header.Set("X-Amz-Content-Sha256", sigv4.StreamingUnsignedTrailer)
+	r.Header.Set("X-Amz-Decoded-Content-Length", "11")
+	r.Header.Set("Content-Encoding", "aws-chunked")
+
+	if err := sigv4.DecodeBody(r); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r.Body)
+	if err != nil || string(got) != "hello world" {
+		t.Fatalf("decoded %q, err %v", got, err)
+	}
+}
@@ -0,0 +1,79 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package opensnacktest runs opensnack in-process for Go integration
+// tests:
+//
+//	func TestUpload(t *testing.T) {
+//		srv := opensnacktest.NewServer(t)
+//		client := s3.NewFromConfig(srv.Config, func(o *s3.Options) {
+//			o.UsePathStyle = true
+//		})
+//		...
+//	}
+//
+// Each server has its own in-memory store and object directory, so tests
+// do not see each other's resources.
+package opensnacktest
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"opensnack/internal/config"
+	"opensnack/internal/resource"
+	"opensnack/internal/router"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	// Region is the region the returned SDK config uses.
+	Region = "us-east-1"
+	// AccessKeyID and SecretAccessKey are the static test credentials.
+	AccessKeyID     = "test"
+	SecretAccessKey = "test"
+)
+
+// Server is a running opensnack.
+type Server struct {
+	// URL is the endpoint, such as http://127.0.0.1:38211.
+	URL string
+	// Config is an AWS SDK config pointed at URL with static test
+	// credentials. S3 clients also need UsePathStyle.
+	Config aws.Config
+	// Store holds every resource the server creates.
+	Store *resource.MemoryStore
+}
+
+// NewServer starts opensnack on a local port and stops it, with its
+// background work, when the test ends. It runs with the default settings
+// whatever the environment says and writes S3 object bodies under
+// t.TempDir(), so tests using it may call t.Parallel.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Storage.ObjectRoot = t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	store := resource.NewMemoryStore()
+	ts := httptest.NewServer(router.NewWithConfig(ctx, store, cfg))
+	t.Cleanup(ts.Close)
+
+	creds := aws.Credentials{AccessKeyID: AccessKeyID, SecretAccessKey: SecretAccessKey, Source: "opensnacktest"}
+	return &Server{
+		URL:   ts.URL,
+		Store: store,
+		Config: aws.Config{
+			Region:       Region,
+			BaseEndpoint: aws.String(ts.URL),
+			HTTPClient:   ts.Client(),
+			Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+				return creds, nil
+			}),
+		},
+	}
+}
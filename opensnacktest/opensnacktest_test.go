@@ -0,0 +1,53 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package opensnacktest_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"opensnack/opensnacktest"
+)
+
+func TestNewServer(t *testing.T) {
+	t.Parallel()
+	srv := opensnacktest.NewServer(t)
+
+	if *srv.Config.BaseEndpoint != srv.URL || srv.Config.Region != opensnacktest.Region {
+		t.Fatalf("unexpected config: %+v", srv.Config)
+	}
+	creds, err := srv.Config.Credentials.Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != opensnacktest.AccessKeyID {
+		t.Fatalf("unexpected credentials: %+v %v", creds, err)
+	}
+
+	form := url.Values{"Action": {"CreateQueue"}, "QueueName": {"jobs"}, "Version": {"2012-11-05"}}
+	resp, err := srv.Config.HTTPClient.Do(mustRequest(t, srv.URL, form))
+	if err != nil {
+		t.Fatalf("CreateQueue: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !strings.Contains(string(body), "jobs") {
+		t.Fatalf("unexpected CreateQueue response: %d %s", resp.StatusCode, body)
+	}
+	if list, _ := srv.Store.List(t.Context(), "sqs", "queue", "default"); len(list) != 1 {
+		t.Fatalf("expected the queue in the store, got %d resources", len(list))
+	}
+}
+
+func mustRequest(t *testing.T, endpoint string, form url.Values) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest("POST", endpoint+"/", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}